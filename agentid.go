@@ -0,0 +1,166 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+//Agent IDs are written in the "<hostname>-<agentid>-<payload>-<audittype>" names of extracted and parsed files, so
+//every source of the same agent must give the same ID, without "-" or characters which can't be in file names
+
+//Agent ID of audits collected without an agent, such as by manual collection scripts and Redline
+const PlaceholderAgentID = "0000000000000000000000"
+
+//FireEye Endpoint Security agent IDs are 22 letters and digits, which are case sensitive
+var agentIDRegex = regexp.MustCompile(`^[A-Za-z0-9]{22}$`)
+
+//Some sources give agent IDs as GUIDs, with or without braces, which are written as 32 lowercase hex digits
+var agentIDGUIDRegex = regexp.MustCompile(`^\{?([0-9A-Fa-f]{8})-([0-9A-Fa-f]{4})-([0-9A-Fa-f]{4})-([0-9A-Fa-f]{4})-([0-9A-Fa-f]{12})\}?$`)
+var agentIDGUIDHexRegex = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+//GUID agent IDs in "<hostname>-<agentid>-..." file names, whose "-" would split them into several name parts
+var agentIDGUIDNameRegex = regexp.MustCompile(`-(\{?[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}\}?)(-|\.[A-Za-z]+$)`)
+
+//Characters of agent IDs which are replaced by "_" so they can't break file names
+var agentIDUnsafeRegex = regexp.MustCompile(`[^A-Za-z0-9_.]`)
+
+//AgentIDs normalizes and validates the agent IDs of a run. "AgentID_Aliases" of the main config maps known aliases to
+//their canonical IDs, and lowercase variants of canonical IDs, or of IDs seen in the input file names, get their case back
+//A nil AgentIDs only normalizes the format of IDs
+type AgentIDs struct {
+	aliases   map[string]string //Lowercase alias or ID -> canonical ID
+	canonical map[string]string //Lowercase ID -> ID with its case, for lowercase variants
+	mu        sync.Mutex
+	warned    map[string]bool
+}
+
+//NewAgentIDs checks the "AgentID_Aliases" of the main config, whose canonical IDs must be agent IDs or GUIDs
+func NewAgentIDs(aliases map[string]string) (*AgentIDs, error) {
+	ids := &AgentIDs{aliases: map[string]string{}, canonical: map[string]string{}, warned: map[string]bool{}}
+	for alias, canonical := range aliases {
+		normalized, problem := normalizeAgentIDFormat(canonical)
+		if problem != "" {
+			return nil, errors.New("canonical agent ID '" + canonical + "' of alias '" + alias + "' " + problem)
+		}
+		ids.aliases[strings.ToLower(strings.TrimSpace(alias))] = normalized
+		//GUID aliases also match their normalized form, as found in file names
+		if normalizedAlias, problem := normalizeAgentIDFormat(alias); problem == "" {
+			ids.aliases[strings.ToLower(normalizedAlias)] = normalized
+		}
+		ids.canonical[strings.ToLower(normalized)] = normalized
+	}
+	return ids, nil
+}
+
+//Learn records the mixed-case agent IDs of "<hostname>-<agentid>-<payload>-<audittype>" file names, so lowercase
+//variants of them in other file names are written with the same case
+func (ids *AgentIDs) Learn(files []os.FileInfo) {
+	if ids == nil {
+		return
+	}
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+	for _, file := range files {
+		parts := strings.Split(strings.TrimSuffix(file.Name(), filepath.Ext(file.Name())), "-")
+		if len(parts) < 4 {
+			continue
+		}
+		agentid := parts[len(parts)-3]
+		if agentIDRegex.MatchString(agentid) && agentid != strings.ToLower(agentid) {
+			if _, known := ids.canonical[strings.ToLower(agentid)]; !known {
+				ids.canonical[strings.ToLower(agentid)] = agentid
+			}
+		}
+	}
+}
+
+//normalizeAgentIDFormat returns the agent ID with GUIDs as 32 lowercase hex digits, and why it is not a valid agent ID, if it is not
+func normalizeAgentIDFormat(agentid string) (string, string) {
+	agentid = strings.TrimSpace(agentid)
+	if m := agentIDGUIDRegex.FindStringSubmatch(agentid); len(m) == 6 {
+		return strings.ToLower(strings.Join(m[1:], "")), ""
+	}
+	if agentIDRegex.MatchString(agentid) || agentIDGUIDHexRegex.MatchString(agentid) {
+		return agentid, ""
+	}
+	if agentid == "" {
+		return PlaceholderAgentID, "is empty"
+	}
+	return agentIDUnsafeRegex.ReplaceAllString(agentid, "_"), "is neither 22 letters and digits nor a GUID"
+}
+
+//NormalizeAgentID returns the canonical form of an agent ID, and a warning if it is not valid or may be a lowercase
+//variant of an unknown agent ID. Aliases are matched ignoring case and GUIDs are written as 32 lowercase hex digits
+func (ids *AgentIDs) NormalizeAgentID(agentid string) (string, string) {
+	if agentid == PlaceholderAgentID || agentid == "AGENTIDPLACEHOLDER0000" {
+		return agentid, ""
+	}
+	if ids != nil {
+		if canonical, found := ids.aliases[strings.ToLower(strings.TrimSpace(agentid))]; found {
+			return canonical, ""
+		}
+	}
+	normalized, problem := normalizeAgentIDFormat(agentid)
+	if problem != "" {
+		return normalized, "AgentID '" + agentid + "' " + problem + ", written as '" + normalized + "'. Map it to its canonical ID in 'AgentID_Aliases' of the main config."
+	}
+	if ids == nil {
+		return normalized, ""
+	}
+	if canonical, found := ids.aliases[strings.ToLower(normalized)]; found {
+		return canonical, ""
+	}
+	if len(normalized) == 22 && normalized == strings.ToLower(normalized) && strings.ToUpper(normalized) != normalized {
+		ids.mu.Lock()
+		canonical, found := ids.canonical[normalized]
+		ids.mu.Unlock()
+		if found {
+			return canonical, ""
+		}
+		return normalized, "AgentID '" + agentid + "' is all lowercase, which may be a lowercase variant of a case sensitive agent ID. Map it to its canonical ID in 'AgentID_Aliases' of the main config."
+	}
+	return normalized, ""
+}
+
+//Normalize returns the canonical form of an agent ID, warning once per run about each agent ID which is not valid
+func (ids *AgentIDs) Normalize(options Options, agentid string, source string) string {
+	normalized, warning := ids.NormalizeAgentID(agentid)
+	if warning == "" {
+		return normalized
+	}
+	if ids != nil {
+		ids.mu.Lock()
+		warned := ids.warned[agentid]
+		ids.warned[agentid] = true
+		ids.mu.Unlock()
+		if warned {
+			return normalized
+		}
+	}
+	options.Log.Println(options.Warnbox + "WARNING - " + warning + " First seen in '" + source + "'.")
+	return normalized
+}
+
+//NormalizeAgentIDFileName replaces a GUID agent ID in a "<hostname>-<agentid>-..." file name, such as from another
+//tool, with its normalized form, so the name splits into its parts on "-"
+func NormalizeAgentIDFileName(name string) string {
+	return agentIDGUIDNameRegex.ReplaceAllStringFunc(name, func(match string) string {
+		m := agentIDGUIDNameRegex.FindStringSubmatch(match)
+		normalized, _ := normalizeAgentIDFormat(m[1])
+		return "-" + normalized + m[2]
+	})
+}
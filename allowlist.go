@@ -0,0 +1,216 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"regexp"
+	"strings"
+)
+
+//Audits checked against '-al' allowlists unless '-ala' is provided
+const AllowlistDefaultAudits = "FileItem,PersistenceItem,EventItem_ProcessEvent"
+
+var allowlistMD5Regex = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+var allowlistSHA256Regex = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+//Columns holding the path of the file a row is about, parent process paths and registry paths are not matched
+var allowlistPathColumns = map[string]bool{
+	"fullpath":            true,
+	"filepath":            true,
+	"path":                true,
+	"processpath":         true,
+	"servicepath":         true,
+	"modulepath":          true,
+	"applicationfullpath": true,
+	"linkfilepath":        true,
+}
+
+//Allowlist holds the known-good hashes and paths of '-al' files
+//Paths ending in "*" match every path starting with them
+type Allowlist struct {
+	MD5          map[string]bool
+	SHA256       map[string]bool
+	Paths        map[string]bool
+	PathPrefixes []string
+	Audits       map[string]string //Lowercase audit type to "mark" or "exclude"
+}
+
+//ReadAllowlist reads the comma delimited allowlist files, each with one MD5, SHA256, or path per line and '#' starting a comment
+//Lines with several comma or tab delimited fields, such as software inventory exports, add every hash and path among them
+//audits is a comma delimited list of "<AuditType>[=mark|exclude]", marking rows by default
+func ReadAllowlist(files string, audits string) (*Allowlist, error) {
+	allowlist := &Allowlist{map[string]bool{}, map[string]bool{}, map[string]bool{}, []string{}, map[string]string{}}
+	if audits == "" {
+		audits = AllowlistDefaultAudits
+	}
+	for _, audit := range strings.Split(audits, ",") {
+		parts := strings.SplitN(strings.TrimSpace(audit), "=", 2)
+		if parts[0] == "" {
+			continue
+		}
+		mode := "mark"
+		if len(parts) == 2 {
+			mode = strings.ToLower(strings.TrimSpace(parts[1]))
+		}
+		if mode != "mark" && mode != "exclude" {
+			return nil, errors.New("audit '" + audit + "' has mode '" + mode + "', expected \"mark\" or \"exclude\"")
+		}
+		allowlist.Audits[strings.ToLower(parts[0])] = mode
+	}
+
+	for _, path := range strings.Split(files, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		file, err_o := os.Open(path)
+		if err_o != nil {
+			return nil, err_o
+		}
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\uFEFF"))
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			fields := strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == '\t' })
+			for _, field := range fields {
+				field = strings.Trim(strings.TrimSpace(field), `"`)
+				if allowlistMD5Regex.MatchString(field) {
+					allowlist.MD5[strings.ToLower(field)] = true
+				} else if allowlistSHA256Regex.MatchString(field) {
+					allowlist.SHA256[strings.ToLower(field)] = true
+				} else if len(fields) == 1 || strings.ContainsAny(field, `\/`) {
+					allowlist.addPath(field)
+				}
+			}
+		}
+		err_s := scanner.Err()
+		file.Close()
+		if err_s != nil {
+			return nil, errors.New("could not read '" + path + "'. " + err_s.Error())
+		}
+	}
+	return allowlist, nil
+}
+
+func (allowlist *Allowlist) addPath(path string) {
+	path = strings.ToLower(strings.Replace(path, "/", `\`, -1))
+	if strings.HasSuffix(path, "*") {
+		allowlist.PathPrefixes = append(allowlist.PathPrefixes, strings.TrimSuffix(path, "*"))
+	} else {
+		allowlist.Paths[path] = true
+	}
+}
+
+//Size returns the number of hashes and paths in the allowlist
+func (allowlist *Allowlist) Size() int {
+	return len(allowlist.MD5) + len(allowlist.SHA256) + len(allowlist.Paths) + len(allowlist.PathPrefixes)
+}
+
+//MatchesPath reports whether a path is allowlisted, ignoring case and the direction of slashes
+func (allowlist *Allowlist) MatchesPath(path string) bool {
+	path = strings.ToLower(strings.Replace(path, "/", `\`, -1))
+	if allowlist.Paths[path] {
+		return true
+	}
+	for _, prefix := range allowlist.PathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+//ApplyAllowlist marks allowlisted rows with a "Suppressed" column or removes them, depending on the mode of the audit
+//A row is allowlisted when all of its MD5/SHA256 values are, or when it has no hashes and all of its file paths are
+//Returns the headers and rows, and the number of rows suppressed
+func ApplyAllowlist(options Options, auditType string, csvHeaders []string, csvRows [][]string) ([]string, [][]string, int) {
+	allowlist := options.Allowlist
+	if allowlist == nil {
+		return csvHeaders, csvRows, 0
+	}
+	mode, exists := allowlist.Audits[strings.ToLower(auditType)]
+	if !exists {
+		return csvHeaders, csvRows, 0
+	}
+	md5Cols, sha256Cols, pathCols := []int{}, []int{}, []int{}
+	for i, header := range csvHeaders {
+		lower := strings.ToLower(header)
+		if strings.HasSuffix(lower, "md5") || strings.HasSuffix(lower, "md5sum") {
+			md5Cols = append(md5Cols, i)
+		} else if strings.HasSuffix(lower, "sha256") || strings.HasSuffix(lower, "sha256sum") {
+			sha256Cols = append(sha256Cols, i)
+		} else if allowlistPathColumns[lower] {
+			pathCols = append(pathCols, i)
+		}
+	}
+	if len(md5Cols)+len(sha256Cols)+len(pathCols) == 0 {
+		return csvHeaders, csvRows, 0
+	}
+
+	allowlisted := func(row []string) bool {
+		hashes, known := 0, 0
+		for _, cols := range [][]int{md5Cols, sha256Cols} {
+			for _, i := range cols {
+				if i >= len(row) || row[i] == "" {
+					continue
+				}
+				hashes++
+				value := strings.ToLower(row[i])
+				if allowlist.MD5[value] || allowlist.SHA256[value] {
+					known++
+				}
+			}
+		}
+		if hashes > 0 {
+			return known == hashes
+		}
+		paths := 0
+		for _, i := range pathCols {
+			if i >= len(row) || row[i] == "" {
+				continue
+			}
+			paths++
+			if !allowlist.MatchesPath(row[i]) {
+				return false
+			}
+		}
+		return paths > 0
+	}
+
+	suppressed := 0
+	if mode == "exclude" {
+		keptRows := csvRows[:0]
+		for _, row := range csvRows {
+			if allowlisted(row) {
+				suppressed++
+				continue
+			}
+			keptRows = append(keptRows, row)
+		}
+		return csvHeaders, keptRows, suppressed
+	}
+	csvHeaders = append(csvHeaders, "Suppressed")
+	for i := range csvRows {
+		value := "false"
+		if allowlisted(csvRows[i]) {
+			value = "true"
+			suppressed++
+		}
+		csvRows[i] = append(csvRows[i], value)
+	}
+	return csvHeaders, csvRows, suppressed
+}
@@ -0,0 +1,180 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//AnalystNote is one row of a '-notes' file
+//Hostname and AuditType may be "" or "*" to match any, Match holds the conditions every row must meet
+type AnalystNote struct {
+	Hostname  string
+	AuditType string
+	Match     []AnalystNoteCondition
+	Note      string
+}
+
+//AnalystNoteCondition is "<Column>=<value>" (case-insensitive) or "<Column>~<regex>"
+type AnalystNoteCondition struct {
+	Column string
+	Value  string
+	Regex  *regexp.Regexp
+}
+
+//ReadAnalystNotes reads a '-notes' CSV file with "Hostname", "AuditType", "Match", and "Note" columns
+//Match is "*" or conditions joined with " && ", such as "name=svchost.exe && path~(?i)\\temp\\"
+func ReadAnalystNotes(path string) ([]AnalystNote, error) {
+	file, err_o := os.Open(path)
+	if err_o != nil {
+		return nil, err_o
+	}
+	defer file.Close()
+	reader, _ := NewDialectCSVReader(file)
+	headers, err_r := reader.Read()
+	if err_r != nil {
+		return nil, err_r
+	}
+	cols := map[string]int{}
+	for i, header := range headers {
+		cols[strings.ToLower(strings.TrimSpace(header))] = i
+	}
+	for _, required := range []string{"hostname", "audittype", "match", "note"} {
+		if _, exists := cols[required]; !exists {
+			return nil, errors.New("missing column '" + required + "', expected \"Hostname,AuditType,Match,Note\"")
+		}
+	}
+
+	notes := []AnalystNote{}
+	for line := 2; ; line++ {
+		row, err_r := reader.Read()
+		if err_r == io.EOF {
+			break
+		} else if err_r != nil {
+			return nil, err_r
+		}
+		for len(row) < len(headers) {
+			row = append(row, "")
+		}
+		note := AnalystNote{
+			strings.TrimSpace(row[cols["hostname"]]),
+			strings.TrimSpace(row[cols["audittype"]]),
+			nil,
+			strings.TrimSpace(row[cols["note"]]),
+		}
+		if note.Note == "" {
+			continue
+		}
+		match := strings.TrimSpace(row[cols["match"]])
+		if match != "" && match != "*" {
+			for _, expression := range strings.Split(match, "&&") {
+				condition, err_c := parseAnalystNoteCondition(strings.TrimSpace(expression))
+				if err_c != nil {
+					return nil, errors.New("row " + strconv.Itoa(line) + ": " + err_c.Error())
+				}
+				note.Match = append(note.Match, condition)
+			}
+		}
+		notes = append(notes, note)
+	}
+	return notes, nil
+}
+
+func parseAnalystNoteCondition(expression string) (AnalystNoteCondition, error) {
+	i := strings.IndexAny(expression, "=~")
+	if i <= 0 {
+		return AnalystNoteCondition{}, errors.New("match '" + expression + "' is not '<Column>=<value>' or '<Column>~<regex>'")
+	}
+	condition := AnalystNoteCondition{Column: strings.TrimSpace(expression[:i]), Value: strings.TrimSpace(expression[i+1:])}
+	if expression[i] == '~' {
+		regex, err_c := regexp.Compile(condition.Value)
+		if err_c != nil {
+			return AnalystNoteCondition{}, errors.New("match '" + expression + "' has an invalid regex. " + err_c.Error())
+		}
+		condition.Regex = regex
+	}
+	return condition, nil
+}
+
+//AnalystNotesFor returns the notes of every rule matching a row, col returns the index of a header or -1
+func AnalystNotesFor(options Options, auditType string, hostname string, row []string, col func(header string) int) []string {
+	matched := []string{}
+	for _, note := range options.AnalystNotes {
+		if note.AuditType != "" && note.AuditType != "*" && !strings.EqualFold(note.AuditType, auditType) {
+			continue
+		}
+		if note.Hostname != "" && note.Hostname != "*" && !strings.EqualFold(NormalizeHostname(note.Hostname, options), NormalizeHostname(hostname, options)) {
+			continue
+		}
+		ok := true
+		for _, condition := range note.Match {
+			i := col(condition.Column)
+			if i == -1 || i >= len(row) {
+				ok = false
+			} else if condition.Regex != nil {
+				ok = condition.Regex.MatchString(row[i])
+			} else {
+				ok = strings.EqualFold(row[i], condition.Value)
+			}
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			matched = append(matched, note.Note)
+		}
+	}
+	return matched
+}
+
+//ApplyAnalystNotes writes the notes of matching '-notes' rules into the "Notes" column and returns the number of rows noted
+func ApplyAnalystNotes(options Options, auditType string, csvHeaders []string, csvRows [][]string) int {
+	if len(options.AnalystNotes) == 0 {
+		return 0
+	}
+	header2index := map[string]int{}
+	for i, header := range csvHeaders {
+		header2index[header] = i
+	}
+	col := func(header string) int {
+		if i, exists := header2index[header]; exists {
+			return i
+		}
+		return -1
+	}
+	col_index_notes := col("Notes")
+	col_index_hostname := col("Hostname")
+	if col_index_notes == -1 {
+		return 0
+	}
+	noted := 0
+	for _, row := range csvRows {
+		hostname := ""
+		if col_index_hostname != -1 && col_index_hostname < len(row) {
+			hostname = row[col_index_hostname]
+		}
+		notes := AnalystNotesFor(options, auditType, hostname, row, col)
+		if len(notes) == 0 || col_index_notes >= len(row) {
+			continue
+		}
+		if row[col_index_notes] != "" {
+			notes = append([]string{row[col_index_notes]}, notes...)
+		}
+		row[col_index_notes] = strings.Join(notes, " || ")
+		noted++
+	}
+	return noted
+}
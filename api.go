@@ -0,0 +1,446 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//ParsedAudit is one parsed audit table, holding the same data as a CSV file written by the CLI
+type ParsedAudit struct {
+	Hostname  string
+	AgentID   string
+	AuditType string //"EventItem_<eventtype>" for each event type of an eventbuffer audit
+	Headers   []string
+	Rows      [][]string
+}
+
+//GetVersion returns the version of GoAuditParser, which is also written to config files and '-pmeta' sidecars
+func GetVersion() string {
+	return version
+}
+
+//LibraryOptions are the settings of the library functions for callers which cannot run Setup(), such as the
+//language bindings of the c-shared build which pass them as JSON. Keys left out keep the CLI's defaults, and
+//keys are only ever added, so callers written against older versions keep working
+type LibraryOptions struct {
+	ReplaceNewLineFeeds bool   `json:"replace_newlines"` //-rn
+	Raw                 bool   `json:"raw"`              //-raw
+	Fast                bool   `json:"fast"`             //-fast
+	AltHostname         string `json:"hostname"`         //-pah <str>
+	AltAgentID          string `json:"agentid"`          //-paa <str>
+	HostnameShort       bool   `json:"hostname_short"`   //-hs
+	CSVFormat           int    `json:"csv_format"`       //-pcf <int>
+	OutputFormat        string `json:"output_format"`    //-of <str>
+	TimelineFormat      string `json:"timeline_format"`  //-tlfmt <str>
+	ConfigPath          string `json:"config"`           //-c <file>, the built-in main config template if empty
+	TimelineConfigPath  string `json:"timeline_config"`  //-tlcf <file>, the built-in timeline config template if empty
+}
+
+//NewLibraryOptions returns the options Setup() would for the same flags, without reading the command line,
+//printing, or creating config files in the user's data directory. Errors are returned instead of exiting
+func NewLibraryOptions(lib LibraryOptions) (Options, error) {
+	options := Options{
+		OutputPath:          "parsed",
+		ConfigPath:          lib.ConfigPath,
+		TimelineConfigFile:  lib.TimelineConfigPath,
+		Threads:             -1,
+		WriterThreads:       1,
+		ExtractFileFormat:   1,
+		ExtractXMLFormat:    1,
+		ParseCSVFormat:      lib.CSVFormat,
+		OutputFormat:        strings.ToLower(strings.TrimSpace(lib.OutputFormat)),
+		TimelineFormat:      strings.ToLower(strings.TrimSpace(lib.TimelineFormat)),
+		XMLSplitByteSize:    300000000,
+		ParseLineBufferSize: 1024 * 1024 * 20,
+		ParseFileWorkers:    1,
+		ParseAnomalyPolicy:  ParseAnomalyPolicyStrict,
+		ParseAltHostname:    lib.AltHostname,
+		ParseAltAgentID:     lib.AltAgentID,
+		HostnameShort:       lib.HostnameShort,
+		ReplaceNewLineFeeds: lib.ReplaceNewLineFeeds,
+		FastMode:            lib.Fast,
+		ExcelFriendly:       !lib.Raw,
+		TimelineFilterEmpty: true,
+		Box:                 "[+] ",
+		Warnbox:             "[!] ",
+		RunID:               NewRunID(),
+		AuditDebugLog:       &AuditDebugLog{},
+	}
+	if options.ParseCSVFormat == 0 {
+		options.ParseCSVFormat = 1
+	} else if options.ParseCSVFormat < 0 || options.ParseCSVFormat >= 3 {
+		return options, errors.New("csv_format " + strconv.Itoa(lib.CSVFormat) + " is not 1 or 2")
+	}
+	if options.OutputFormat == "" {
+		options.OutputFormat = OutputFormatCSV
+	} else if _, known := outputFormats[options.OutputFormat]; !known {
+		return options, errors.New("output_format '" + lib.OutputFormat + "' is not '" + strings.Join(OutputFormatNames(), "', '") + "'")
+	}
+	if options.OutputFormat != OutputFormatCSV {
+		options.ExcelFriendly = false
+	}
+	if options.TimelineFormat == "" {
+		options.TimelineFormat = TimelineFormatCSV
+	} else if _, known := timelineFormatExtensions[options.TimelineFormat]; !known && options.TimelineFormat == TimelineFormatSQLite {
+		return options, errors.New("timeline_format 'sqlite' needs GoAuditParser built with \"-tags sqlite\"")
+	} else if !known {
+		return options, errors.New("timeline_format '" + lib.TimelineFormat + "' is not '" + strings.Join(TimelineFormatNames(), "', '") + "'")
+	}
+	if options.FastMode {
+		options.ExcelFriendly = false
+		options.ReplaceNewLineFeeds = false
+		options.ParseRawTimestamps = true
+	}
+
+	b := []byte(GetMainConfigTemplate(options))
+	if options.ConfigPath != "" {
+		var err_r error
+		if b, err_r = ioutil.ReadFile(options.ConfigPath); err_r != nil {
+			return options, err_r
+		}
+	}
+	if err_j := json.Unmarshal(b, &options.Config); err_j != nil {
+		return options, errors.New("could not parse JSON from main config file '" + options.ConfigPath + "': " + err_j.Error())
+	}
+	var err_p error
+	if options.FileMode, err_p = ParseOutputPermissions(options.Config.OutputPermissions.File); err_p != nil {
+		return options, err_p
+	}
+	if options.DirMode, err_p = ParseOutputPermissions(options.Config.OutputPermissions.Directory); err_p != nil {
+		return options, err_p
+	}
+	if options.OutputGroupID, err_p = LookupOutputGroup(options.Config.OutputPermissions.Group); err_p != nil {
+		return options, err_p
+	}
+	if err_r := ValidateOutputRoutes(options.Config.OutputRoutes); err_r != nil {
+		return options, errors.New("could not read 'Output_Routes' of main config file: " + err_r.Error())
+	}
+	var err_a error
+	if options.AgentIDs, err_a = NewAgentIDs(options.Config.AgentIDAliases); err_a != nil {
+		return options, errors.New("could not read 'AgentID_Aliases' of main config file: " + err_a.Error())
+	}
+	if options.ParseAltAgentID != "" {
+		options.ParseAltAgentID, _ = options.AgentIDs.NormalizeAgentID(options.ParseAltAgentID)
+	}
+	return options, nil
+}
+
+//GoAuditParser_ParseFile parses a single XML audit file with options from Setup() and returns its table
+//Eventbuffer and stateagentinspector audits produce one table per event type, use GoAuditParser_ParseFileAll for those
+//It is a Parser with the options, which new callers should use through NewParser
+func GoAuditParser_ParseFile(path string, opts Options) (ParsedAudit, error) {
+	audits, err := GoAuditParser_ParseFileAll(path, opts)
+	if err != nil {
+		return ParsedAudit{}, err
+	}
+	if len(audits) == 0 {
+		return ParsedAudit{}, nil
+	}
+	if len(audits) > 1 {
+		return ParsedAudit{}, errors.New("file '" + filepath.Base(path) + "' contains " + strconv.Itoa(len(audits)) + " audit tables, use GoAuditParser_ParseFileAll")
+	}
+	return audits[0], nil
+}
+
+//GoAuditParser_ParseFileAll parses a single XML audit file with options from Setup() and returns every table it contains
+//It is Parser.ParseFileTables with the options, which new callers should use through NewParser. If the options
+//have no main config, the built-in template is used
+func GoAuditParser_ParseFileAll(path string, opts Options) ([]ParsedAudit, error) {
+	return (&Parser{opts}).ParseFileTables(path)
+}
+
+//ParserOptions are the settings of a Parser, the zero value parses like the CLI's defaults
+//Config replaces the main config of LibraryOptions.ConfigPath, so callers can build it in memory
+type ParserOptions struct {
+	LibraryOptions
+	Config *Main_Config_JSON
+}
+
+//Parser parses XML audit files in-process and returns their records without writing output files
+//It holds its own copy of the options, so several Parsers with different settings can be used at once,
+//and a Parser may be used by several goroutines
+type Parser struct {
+	options Options
+}
+
+//NewParser returns a Parser for the settings, or an error if they or the main config could not be used
+func NewParser(popts ParserOptions) (*Parser, error) {
+	options, err := NewLibraryOptions(popts.LibraryOptions)
+	if err != nil {
+		return nil, err
+	}
+	if popts.Config != nil {
+		if err_r := ValidateOutputRoutes(popts.Config.OutputRoutes); err_r != nil {
+			return nil, errors.New("could not read 'Output_Routes' of main config: " + err_r.Error())
+		}
+		options.Config = *popts.Config
+	}
+	//Debug blocks are not returned, so don't collect them for the life of the Parser
+	options.AuditDebugLog = nil
+	return &Parser{options}, nil
+}
+
+//Options returns the options the Parser parses with
+func (p *Parser) Options() Options {
+	return p.options
+}
+
+//AuditRecord is one parsed audit item, a row of the CSV file the CLI would write
+//Headers is shared by every record of the same table and must not be changed
+type AuditRecord struct {
+	Hostname  string
+	AgentID   string
+	AuditType string //"EventItem_<eventtype>" for each event type of an eventbuffer audit
+	Headers   []string
+	Values    []string
+}
+
+//Get returns the value of a column, or "" if the record has no such column
+func (r AuditRecord) Get(header string) string {
+	for i, h := range r.Headers {
+		if h == header && i < len(r.Values) {
+			return r.Values[i]
+		}
+	}
+	return ""
+}
+
+//Fields returns the non-empty values of the record by their column header
+func (r AuditRecord) Fields() map[string]string {
+	fields := map[string]string{}
+	for i, h := range r.Headers {
+		if i < len(r.Values) && r.Values[i] != "" {
+			fields[h] = r.Values[i]
+		}
+	}
+	return fields
+}
+
+//ParseFile parses a single XML audit file and returns its records in the order of their tables and rows
+//An empty audit returns no records and no error
+func (p *Parser) ParseFile(path string) ([]AuditRecord, error) {
+	audits, err := p.ParseFileTables(path)
+	if err != nil {
+		return nil, err
+	}
+	records := []AuditRecord{}
+	for _, audit := range audits {
+		for _, row := range audit.Rows {
+			records = append(records, AuditRecord{audit.Hostname, audit.AgentID, audit.AuditType, audit.Headers, row})
+		}
+	}
+	return records, nil
+}
+
+//ParseFileTables parses a single XML audit file and returns every table it contains, in the order they were parsed
+//An empty audit returns no tables and no error
+func (p *Parser) ParseFileTables(path string) ([]ParsedAudit, error) {
+	opts := p.options
+	opts.ParseInMemory = true
+	job, _, err := parseSingleFile(path, "", opts)
+	if err != nil || job == nil {
+		return []ParsedAudit{}, err
+	}
+	audits := []ParsedAudit{}
+	for _, output := range job.outputs {
+		hostname, agentid := SplitPrefixIdentity(output.SplitPrefix)
+		audits = append(audits, ParsedAudit{hostname, agentid, output.SplitSuffix, output.Headers, output.Rows})
+	}
+	return audits, nil
+}
+
+//GoAuditParser_ParseFileToCSV parses a single XML audit file and writes its CSV file(s) to outputDir like the CLI does
+//Returns the paths of the files written, an empty audit writes no files and returns no error
+func GoAuditParser_ParseFileToCSV(path string, outputDir string, opts Options) ([]string, error) {
+	if err_m := MkdirAllOutput(opts, outputDir); err_m != nil {
+		return nil, err_m
+	}
+	job, opts, err := parseSingleFile(path, outputDir, opts)
+	if err != nil || job == nil {
+		return []string{}, err
+	}
+	done := WriteCSVJob(opts, *job)
+	if !strings.Contains(done.message, "parsed successfully") {
+		return nil, errors.New(strings.TrimPrefix(done.message, opts.Warnbox))
+	}
+	files := []string{}
+	for _, output := range job.outputs {
+		if output.Streamed != nil {
+			files = append(files, output.Streamed.Paths(opts, output)...)
+		} else if opts.ExcelFriendly && len(output.Rows) > 999999 {
+			for i := 0; i < len(output.Rows); i += 999999 {
+				files = append(files, CSVSplitPath(opts, output, (i/999999)+1))
+			}
+		} else {
+			files = append(files, output.Path)
+		}
+	}
+	return files, nil
+}
+
+//Runs the parse thread on a single XML file with its output staged in outputDir and returns the job to write
+//The job is nil if the audit is empty. Returns the options the thread was run with
+func parseSingleFile(path string, outputDir string, opts Options) (*CSVWriteJob, Options, error) {
+	st, err_s := os.Stat(path)
+	if err_s != nil {
+		return nil, opts, err_s
+	}
+	if st.IsDir() {
+		return nil, opts, errors.New("'" + path + "' is a directory")
+	}
+
+	if opts.Config.Version == "" {
+		err_j := json.Unmarshal([]byte(GetMainConfigTemplate(opts)), &opts.Config)
+		if err_j != nil {
+			return nil, opts, err_j
+		}
+	}
+	if opts.ParseLineBufferSize <= 0 {
+		opts.ParseLineBufferSize = 1024 * 1024 * 20
+	}
+
+	opts.InputPath = filepath.Dir(path)
+	opts.OutputPath = outputDir
+	if opts.RunID == "" {
+		opts.RunID = NewRunID()
+	}
+	opts.ForceReparse = true
+	opts.Verbose = 0
+
+	fileconfig := Parse_Config_XMLFile{InputFileName: st.Name(), InputFileSize: st.Size()}
+
+	//Buffered so the thread can hand off its result without a reader running
+	c := make(chan ThreadReturn_Parse, 1)
+	writeQueue := make(chan CSVWriteJob, 1)
+	c_queued := make(chan int, 1)
+	GoAuditParser_Thread(fileconfig, ExtraStruct1{}, opts, 0, c, writeQueue, c_queued)
+
+	select {
+	case done := <-c:
+		if strings.Contains(done.message, "is empty") {
+			return nil, opts, nil
+		}
+		msg := strings.TrimPrefix(strings.TrimPrefix(done.message, opts.Warnbox), opts.Box)
+		return nil, opts, errors.New(msg)
+	default:
+	}
+
+	job := <-writeQueue
+	return &job, opts, nil
+}
+
+//GoAuditParser_BuildTimeline timelines the CSV files of csvDir like '-tlo -o <csv_dir>' and returns the timeline file(s) written
+//outputFile may contain "<DATE>" and "<TIME>" like '-tlf <file>', and is "<csv_dir>/_Timeline_<DATE>_<TIME>.csv" if empty,
+//with the extension of the "timeline_format" instead of ".csv".
+//The timeline config is checked before the timeliner runs, since it exits the process on errors the CLI can't recover from
+func GoAuditParser_BuildTimeline(csvDir string, outputFile string, opts Options) ([]string, error) {
+	csvFiles := 0
+	for _, c := range TimelineCases(csvDir) {
+		files, err_r := ReadOutputDir(opts, c.Path)
+		if err_r != nil {
+			return nil, err_r
+		}
+		for _, name := range files {
+			if !strings.HasPrefix(filepath.Base(name), "_Timeline_") && strings.HasSuffix(name, ".csv") {
+				csvFiles++
+			}
+		}
+	}
+	if csvFiles == 0 {
+		return nil, errors.New("could not identify any CSV files in '" + csvDir + "'")
+	}
+
+	if outputFile == "" {
+		outputFile = filepath.Join(strings.Split(csvDir, ",")[0], "_Timeline_<DATE>_<TIME>"+TimelineFileExtension(opts))
+	}
+	currentTime := time.Now()
+	outputFile = strings.ReplaceAll(outputFile, "<DATE>", currentTime.Format("2006-01-02"))
+	outputFile = strings.ReplaceAll(outputFile, "<TIME>", currentTime.Format("1504"))
+	file, err_c := CreateOutputFile(opts, outputFile)
+	if err_c != nil {
+		return nil, err_c
+	}
+	file.Close()
+
+	//The built-in template is written to a scratch file rather than the user's data directory
+	if opts.TimelineConfigFile == "" {
+		tempDir, err_t := ioutil.TempDir("", "goauditparser")
+		if err_t != nil {
+			return nil, err_t
+		}
+		defer os.RemoveAll(tempDir)
+		opts.TimelineConfigFile = filepath.Join(tempDir, "timeline.json")
+		if err_w := ioutil.WriteFile(opts.TimelineConfigFile, []byte(GetTimelineConfigTemplate()), 0644); err_w != nil {
+			return nil, err_w
+		}
+	}
+	b, err_o := ioutil.ReadFile(opts.TimelineConfigFile)
+	if err_o != nil {
+		return nil, err_o
+	}
+	if err_v := validateTimelineConfig(b); err_v != nil {
+		return nil, errors.New("timeline config file '" + opts.TimelineConfigFile + "' " + err_v.Error())
+	}
+
+	opts.OutputPath = csvDir
+	opts.TimelineOutputFile = outputFile
+	opts.TimelineOnly = true
+	opts.Timeline = true
+	GoAuditTimeliner_Start(opts)
+
+	//Excel-friendly timelines over 1mil rows continue in "<file>_2.csv" and on
+	timelineFiles := []string{outputFile}
+	for i := 2; ; i++ {
+		splitFile := strings.TrimSuffix(outputFile, ".csv") + "_" + strconv.Itoa(i) + ".csv"
+		if _, err_s := os.Stat(splitFile); err_s != nil {
+			break
+		}
+		timelineFiles = append(timelineFiles, splitFile)
+	}
+	return timelineFiles, nil
+}
+
+//Returns an error for the timeline config problems GoAuditTimeliner_Start would exit on
+func validateTimelineConfig(b []byte) error {
+	var config Timeline_Config_JSON
+	if err_j := json.Unmarshal(b, &config); err_j != nil {
+		return errors.New("is not valid JSON: " + err_j.Error())
+	}
+	for _, audit := range config.Audits {
+		if audit.SummaryTemplate != "" {
+			if _, err_t := template.New(audit.FilenameSuffix).Parse(audit.SummaryTemplate); err_t != nil {
+				return errors.New("has an invalid Summary_Template for '" + audit.Name + "': " + err_t.Error())
+			}
+		}
+		for _, extraField := range audit.ExtraFields {
+			if !strings.Contains(extraField, "{{") {
+				continue
+			}
+			if _, field := timelineSplitExtraField(extraField); field == "" {
+				return errors.New("has an Extra_Fields expression for '" + audit.Name + "' without '>' and the extra field to write: " + extraField)
+			}
+			text := extraField[:strings.LastIndex(extraField, ">")]
+			if _, err_t := template.New(audit.FilenameSuffix).Funcs(timelineExpressionFuncs).Parse(text); err_t != nil {
+				return errors.New("has an invalid Extra_Fields expression for '" + audit.Name + "': " + err_t.Error())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+)
+
+//The script.xml of a triage package lists the audit modules the agent was asked to run, and its manifest.json the
+//results each audit produced. Audits which were requested but have no results, or whose results are missing from
+//the archive, are recorded in "_GAPRunSummary.json" so incomplete collections are noticed
+
+//Module of an "ExecuteModuleCommand" of script.xml, <module name="w32processes-memory" version="1.0.0.0" />
+var regScriptModule = regexp.MustCompile(`<module\s[^>]*\bname="([^"]+)"`)
+
+//AuditMismatch is an audit of an archive which was requested or listed without producing an audit to parse
+type AuditMismatch struct {
+	Archive  string `json:"archive"`
+	Hostname string `json:"hostname"`
+	AgentID  string `json:"agent_id"`
+	Audit    string `json:"audit"`
+	Problem  string `json:"problem"`
+}
+
+//ScriptModules returns the audit modules requested by a script.xml, in order and without duplicates
+func ScriptModules(script io.Reader) ([]string, error) {
+	b, err_r := ioutil.ReadAll(script)
+	if err_r != nil {
+		return nil, err_r
+	}
+	modules := []string{}
+	seen := map[string]bool{}
+	for _, m := range regScriptModule.FindAllStringSubmatch(string(b), -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			modules = append(modules, m[1])
+		}
+	}
+	return modules, nil
+}
+
+//ManifestAuditProblems returns the problem of each audit which script.xml requested but manifest.json does not list,
+//or which manifest.json lists with only an issues file. manifestAudits has true for audits with results
+func ManifestAuditProblems(requested []string, manifestAudits map[string]bool) map[string]string {
+	problems := map[string]string{}
+	for _, module := range requested {
+		if _, listed := manifestAudits[module]; !listed {
+			problems[module] = "requested by script.xml but not in manifest.json"
+		}
+	}
+	for audit, hasResults := range manifestAudits {
+		if !hasResults {
+			problems[audit] = "listed in manifest.json without results, only issues"
+		}
+	}
+	return problems
+}
+
+//sortAuditMismatches orders mismatches by archive and audit, as threads finish archives in any order
+func sortAuditMismatches(mismatches []AuditMismatch) {
+	sort.Slice(mismatches, func(i, j int) bool {
+		if mismatches[i].Archive != mismatches[j].Archive {
+			return mismatches[i].Archive < mismatches[j].Archive
+		}
+		return mismatches[i].Audit < mismatches[j].Audit
+	})
+}
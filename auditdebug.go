@@ -0,0 +1,133 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//Columns of "<hostname>-<agentid>-0-AuditDebug.csv", "File" is the XML file the Debug block came from
+var auditDebugHeaders = []string{"Tag", "Notes", "Hostname", "AgentID", "AuditType", "File", "Created", "UID", "Message"}
+
+const auditDebugFileColumn = 5
+
+//AuditDebugEntry is a Debug block of an audit, such as "Registry key not found", which often explains why expected items are missing
+type AuditDebugEntry struct {
+	Created string
+	UID     string
+	Message string
+}
+
+//Debug rows of one host by XML file
+type auditDebugHost struct {
+	hostname string
+	agentid  string
+	files    map[string][][]string
+}
+
+//AuditDebugLog collects the Debug blocks of every XML file of a run by host
+type AuditDebugLog struct {
+	mu    sync.Mutex
+	hosts map[string]*auditDebugHost
+}
+
+//Add records the Debug blocks of a parsed XML file, also when there are none so rows of an earlier parse are replaced
+//A nil log is ignored
+func (log *AuditDebugLog) Add(options Options, hostname string, agentid string, auditType string, xmlFileName string, entries []AuditDebugEntry) {
+	if log == nil {
+		return
+	}
+	rows := [][]string{}
+	for _, entry := range entries {
+		message := entry.Message
+		if options.ReplaceNewLineFeeds {
+			message = strings.Replace(message, "\n", "|", -1)
+		}
+		rows = append(rows, []string{"", "", hostname, agentid, auditType, xmlFileName, entry.Created, entry.UID, message})
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if log.hosts == nil {
+		log.hosts = map[string]*auditDebugHost{}
+	}
+	key := hostname + "-" + agentid
+	if _, exists := log.hosts[key]; !exists {
+		log.hosts[key] = &auditDebugHost{hostname, agentid, map[string][][]string{}}
+	}
+	log.hosts[key].files[xmlFileName] = rows
+}
+
+//Save writes the Debug blocks of each host to "<hostname>-<agentid>-0-AuditDebug.csv" in the output directory
+//Rows of XML files which were not parsed in this run, such as cached ones, are kept from the existing file
+//Returns the number of Debug rows written
+func (log *AuditDebugLog) Save(options Options) (int, error) {
+	if log == nil {
+		return 0, nil
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	written := 0
+	for _, host := range log.hosts {
+		csvDir := AuditOutputDir(options, "AuditDebug")
+		csvPath := filepath.Join(csvDir, host.hostname+"-"+host.agentid+"-0-AuditDebug.csv")
+		files := map[string][][]string{}
+		if csvFile, err_o := os.Open(csvPath); err_o == nil {
+			records, _ := csv.NewReader(csvFile).ReadAll()
+			csvFile.Close()
+			for i, record := range records {
+				if i == 0 || len(record) != len(auditDebugHeaders) {
+					continue
+				}
+				if _, parsed := host.files[record[auditDebugFileColumn]]; !parsed {
+					files[record[auditDebugFileColumn]] = append(files[record[auditDebugFileColumn]], record)
+				}
+			}
+		}
+		for name, rows := range host.files {
+			if len(rows) > 0 {
+				files[name] = rows
+			}
+		}
+		if len(files) == 0 {
+			os.Remove(csvPath)
+			continue
+		}
+
+		names := []string{}
+		for name := range files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if err_m := MkdirAllOutput(options, csvDir); err_m != nil {
+			return written, err_m
+		}
+		csvFile, err_c := CreateOutputFile(options, csvPath)
+		if err_c != nil {
+			return written, err_c
+		}
+		writer := csv.NewWriter(csvFile)
+		writer.Write(auditDebugHeaders)
+		for _, name := range names {
+			writer.WriteAll(files[name])
+			written += len(files[name])
+		}
+		csvFile.Close()
+		if err_w := writer.Error(); err_w != nil {
+			return written, err_w
+		}
+	}
+	return written, nil
+}
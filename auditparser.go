@@ -12,10 +12,11 @@ package goauditparser
 
 import (
 	"bufio"
+	"crypto/sha1"
 	b64 "encoding/base64"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -27,17 +28,19 @@ import (
 	"strings"
 	"time"
 
-	"github.com/sbwhitecap/tqdm"
-	. "github.com/sbwhitecap/tqdm/iterators"
 )
 
 const version string = "1.0.0"
 
+//Generator of an audit from its itemList header, <itemList generator="w32processes-memory" ...>
+var regItemListGenerator = regexp.MustCompile(`generator="([^"]+)"`)
+
 type ThreadReturn_Parse struct {
 	threadnum int
 	xmlfile   string
 	xmlsize   int64
 	message   string
+	audits    []ParseAuditStat //Rows parsed per audit table, only set once the CSV files are written
 }
 
 type RowValue struct {
@@ -59,17 +62,17 @@ func GoAuditParser_Start(options Options) {
 		dirfiles, err_r := ioutil.ReadDir(options.InputPath)
 
 		if err_r != nil {
-			fmt.Println(options.Warnbox + "ERROR - Could not read input as an existing file or directory '" + options.InputPath + "'.")
+			options.Log.Println(options.Warnbox + "ERROR - Could not read input as an existing file or directory '" + options.InputPath + "'.")
 			log.Fatal(err_r)
 		}
 
 		if len(dirfiles) == 0 {
-			fmt.Println(options.Warnbox + "ERROR - No files found in input directory '" + options.InputPath + "'.")
+			options.Log.Println(options.Warnbox + "ERROR - No files found in input directory '" + options.InputPath + "'.")
 			return
 		}
 
 		// Ingest split files too
-		splitfiles, err_r2 := ioutil.ReadDir(filepath.Join(options.InputPath, "xmlsplit"))
+		splitfiles, err_r2 := ioutil.ReadDir(XMLSplitDir(options))
 		if err_r2 == nil {
 			files = append(files, splitfiles...)
 		}
@@ -77,29 +80,64 @@ func GoAuditParser_Start(options Options) {
 		files = dirfiles
 	}
 
-	//Remove directories
+	//Archives extracted by earlier runs with '-readonly-input' are in the scratch directory instead
+	if options.ReadOnlyInput {
+		if err_m := MkdirAllOutput(options, InputScratchDir(options)); err_m != nil {
+			options.Log.Println(options.Warnbox + "ERROR - Could not create the scratch directory '" + InputScratchDir(options) + "' of read-only input '" + options.InputPath + "'. " + err_m.Error())
+			return
+		}
+		if options.Verbose > 0 {
+			options.Log.Println(options.Box + "Input '" + options.InputPath + "' is read-only, writing its parse cache, split XML, and extracted files to '" + InputScratchDir(options) + "'.")
+		}
+		if err_st != nil || input_st.IsDir() {
+			scratchfiles, _ := ioutil.ReadDir(InputScratchDir(options))
+			files = append(files, scratchfiles...)
+		}
+	}
+
+	//Remove directories, except Redline session and manual collection directories which get extracted, files still being written, and default flags
 	for i := 0; i < len(files); i++ {
-		if files[i].IsDir() {
+		if _, isTemp := TempFileRunID(files[i].Name()); isTemp || files[i].Name() == FlagFileName {
+			files = append(files[0:i], files[i+1:len(files)]...)
+			i--
+			continue
+		}
+		dirPath := filepath.Join(options.InputPath, files[i].Name())
+		if files[i].IsDir() && !(options.Config.AutoExtract && ((strings.ToLower(filepath.Ext(files[i].Name())) == ".mans" && IsRedlineSession(dirPath)) || IsManualCollection(options, dirPath))) {
 			files = append(files[0:i], files[i+1:len(files)]...)
 			i--
 		}
 	}
+	options.AgentIDs.Learn(files)
+
+	//Only process files this worker claimed from the distributed queue
+	if DistributedEnabled(options) {
+		files = DistributedClaimFiles(options, files)
+		options.Log.Println(options.Box + "Claimed " + strconv.Itoa(len(files)) + " file(s) from the distributed queue '" + options.DistributedQueueDir + "'.")
+		DistributedSeedParseCache(options)
+		defer func() {
+			options.DistributedClaims.Release(options)
+			if err_m := DistributedMergeParseCaches(options); err_m != nil {
+				options.Log.Println(options.Warnbox + "WARNING - Could not merge worker parse caches into '_GAPParseCache.json'. " + err_m.Error())
+			}
+		}()
+	}
 
 	//Check for JSON Config File
-	inputConfigFile := filepath.Join(options.InputPath, "_GAPParseCache.json")
+	inputConfigFile := ParseCachePath(options)
 	if options.Verbose > 0 {
-		fmt.Println(options.Box + "Reading the parse config file '" + inputConfigFile + "'...")
+		options.Log.Println(options.Box + "Reading the parse config file '" + inputConfigFile + "'...")
 	}
 	fi, err_s := os.Stat(inputConfigFile)
 	//If config file exists, create the file
 	if os.IsNotExist(err_s) || fi.Size() == 0 {
 		//Create config file
 		if options.Verbose > 0 {
-			fmt.Println(options.Warnbox + "NOTICE - Parse config file '" + inputConfigFile + "' does not exist or is empty. Creating new one...")
+			options.Log.Println(options.Warnbox + "NOTICE - Parse config file '" + inputConfigFile + "' does not exist or is empty. Creating new one...")
 		}
-		file, err_c := os.Create(inputConfigFile)
+		file, err_c := CreateOutputFile(options, inputConfigFile)
 		if err_c != nil {
-			fmt.Println(options.Box + "ERROR - Could not create the parse config file '" + inputConfigFile + "'")
+			options.Log.Println(options.Box + "ERROR - Could not create the parse config file '" + inputConfigFile + "'")
 			log.Fatal(err_c)
 		}
 		n := Parse_Config_JSON{}
@@ -111,28 +149,28 @@ func GoAuditParser_Start(options Options) {
 	//Read JSON from config file
 	file, err_o := os.Open(inputConfigFile)
 	if err_o != nil {
-		fmt.Println(options.Warnbox + "ERROR - Could not open the parse config file '" + inputConfigFile + "'")
+		options.Log.Println(options.Warnbox + "ERROR - Could not open the parse config file '" + inputConfigFile + "'")
 		log.Fatal(err_o)
 	}
 	b, err_i := ioutil.ReadAll(file)
 	if err_i != nil {
-		fmt.Println(options.Warnbox + "ERROR - Could not read contents from the parse config file '" + inputConfigFile + "'.")
+		options.Log.Println(options.Warnbox + "ERROR - Could not read contents from the parse config file '" + inputConfigFile + "'.")
 		log.Fatal(err_i)
 	}
 	var config Parse_Config_JSON
 	err_j := json.Unmarshal(b, &config)
 	if err_j != nil {
-		fmt.Println(options.Warnbox + "ERROR - Could not parse JSON from parse config file '" + inputConfigFile + "'. Please fix or delete the file and try again.")
+		options.Log.Println(options.Warnbox + "ERROR - Could not parse JSON from parse config file '" + inputConfigFile + "'. Please fix or delete the file and try again.")
 		log.Fatal(err_j)
 	}
 	file.Close()
 	if config.Version != version {
-		fmt.Println(options.Box + "Updating old parse config file from v" + config.Version + " to v" + version + "...")
+		options.Log.Println(options.Box + "Updating old parse config file from v" + config.Version + " to v" + version + "...")
 		//Write new JSON to file
-		newFile, err_c := os.Create(inputConfigFile)
+		newFile, err_c := CreateOutputFile(options, inputConfigFile)
 		config.Version = version
 		if err_c != nil {
-			fmt.Println(options.Warnbox + "ERROR - Could not create new version of the parse config file '" + inputConfigFile + "'.")
+			options.Log.Println(options.Warnbox + "ERROR - Could not create new version of the parse config file '" + inputConfigFile + "'.")
 			log.Fatal(err_c)
 		}
 		b, _ := json.Marshal(config)
@@ -140,9 +178,25 @@ func GoAuditParser_Start(options Options) {
 		newFile.Close()
 	}
 
+	//Drop entries of XML files deleted since they were parsed, so they are not reported as cached or missing
+	config, pruned := ReconcileParseCache(options, config)
+	if options.PruneCache {
+		PrintPrunedParseCache(options, ConfirmPrunedCSVs(options, pruned))
+	} else if len(pruned) > 0 && options.Verbose > 0 {
+		options.Log.Println(options.Box + "NOTICE - Pruned " + strconv.Itoa(len(pruned)) + " parse cache entries of XML files which no longer exist.")
+	}
+	if len(pruned) > 0 {
+		if err_s := ParseConfigSave(config, options); err_s != nil {
+			options.Log.Println(options.Warnbox + "WARNING - Could not update '" + filepath.Base(inputConfigFile) + "'. " + err_s.Error())
+		}
+	}
+	if options.PruneCache {
+		return
+	}
+
 	absOutputPath, err_a := filepath.Abs(options.OutputPath)
 	if err_a != nil {
-		fmt.Println(options.Warnbox + "ERROR - Could not get absolute file path for '" + options.OutputPath + "'.")
+		options.Log.Println(options.Warnbox + "ERROR - Could not get absolute file path for '" + options.OutputPath + "'.")
 		log.Fatal(err_a)
 	}
 	var configOutDirIndex int
@@ -153,6 +207,11 @@ func GoAuditParser_Start(options Options) {
 	c_Failed := 0
 	c_Empty := 0
 	c_Issues := 0
+	c_Skipped := 0
+	summary := NewParseRunSummary(options)
+
+	//XML audits extracted into memory by '-emem <int>' which were not parsed are written to disk, so they are parsed next run
+	defer options.MemoryPayloads.SpillAll(options)
 
 	//Auto extract
 	if options.Config.AutoExtract {
@@ -161,12 +220,12 @@ func GoAuditParser_Start(options Options) {
 		for i := 0; i < len(files); i++ {
 			filename := filepath.Base(files[i].Name())
 
-			if strings.ToLower(filepath.Ext(filename)) == ".zip" || strings.ToLower(filepath.Ext(filename)) == ".mans" {
+			if strings.ToLower(filepath.Ext(filename)) == ".zip" || strings.ToLower(filepath.Ext(filename)) == ".mans" || files[i].IsDir() {
 				archives = append(archives, files[i])
 				files = append(files[:i], files[i+1:]...)
 				i--
 				continue
-			} else if filename == "_GAPParseCache.json" {
+			} else if strings.HasPrefix(filename, "_GAPParseCache") && strings.HasSuffix(filename, ".json") {
 				files = append(files[:i], files[i+1:]...)
 				i--
 				continue
@@ -175,7 +234,12 @@ func GoAuditParser_Start(options Options) {
 
 		//Unarchive any files
 		if len(archives) > 0 {
-			newfiles := GoAuditExtract_Start(options, archives, config, configOutDirIndex)
+			newfiles, mismatches := GoAuditExtract_Start(options, archives, config, configOutDirIndex)
+			summary.AuditMismatches = append(summary.AuditMismatches, mismatches...)
+			//Claim extracted files so workers listing the input directory later do not parse them too
+			if DistributedEnabled(options) {
+				newfiles = DistributedClaimFiles(options, newfiles)
+			}
 			for i, newfile := range newfiles {
 				found := false
 				for j, oldfile := range files {
@@ -192,9 +256,13 @@ func GoAuditParser_Start(options Options) {
 		}
 	}
 
+	//Event types split by '-ebs' are parsed from their original audit when it is also in the input
+	files, splitDuplicates := RemoveSplitEventDuplicates(files)
+	c_Cached += splitDuplicates
+
 	//Check if any files remain
 	if len(files) == 0 {
-		fmt.Println(options.Box + "All identified file(s) already parsed.")
+		options.Log.Println(options.Box + "All identified file(s) already parsed.")
 		return
 	}
 
@@ -218,21 +286,30 @@ func GoAuditParser_Start(options Options) {
 		if ExtraFunc5(options, fileconfig) {
 			//do not remove file even if it was previously parsed
 		} else if fileconfig.Status == "parsed" {
+			summary.SetFileStatus(files[i].Name(), "cached")
 			files = append(files[:i], files[i+1:]...)
 			i--
 			c_Cached++
 		} else if fileconfig.Status == "split" {
+			summary.SetFileStatus(files[i].Name(), "cached")
 			files = append(files[:i], files[i+1:]...)
 			i--
 			c_Cached++
-		} else if fileconfig.Status == "ignored/issues" {
+		} else if fileconfig.Status == "parsed/issues" || (fileconfig.Status == "ignored/issues" && !options.ParseIssues) {
+			summary.SetFileStatus(files[i].Name(), "issues")
 			files = append(files[:i], files[i+1:]...)
 			i--
 			c_Issues++
 		} else if fileconfig.Status == "ignored/empty" {
+			summary.SetFileStatus(files[i].Name(), "empty")
 			files = append(files[:i], files[i+1:]...)
 			i--
 			c_Empty++
+		} else if fileconfig.Status == "skipped/notaudit" && !options.ParseNonAuditFail {
+			summary.SetFileStatus(files[i].Name(), "skipped")
+			files = append(files[:i], files[i+1:]...)
+			i--
+			c_Skipped++
 		}
 	}
 
@@ -244,7 +321,20 @@ func GoAuditParser_Start(options Options) {
 			if strings.Contains(files[i].Name(), "_spxml") || strings.Contains(files[i].Name(), "stateagentinspector") || strings.Contains(files[i].Name(), "eventbuffer") {
 				continue
 			}
-			if files[i].Size() >= int64(options.XMLSplitByteSize) {
+			splitPath := filepath.Join(options.InputPath, files[i].Name())
+			if IsMemoryPayload(files[i]) {
+				splitPath = filepath.Join(InputScratchDir(options), files[i].Name())
+			}
+			if files[i].Size() >= int64(options.XMLSplitByteSize) || NeedsXMLSplit(options, splitPath, files[i].Size()) {
+				//The splitter reads XML audits from disk
+				if IsMemoryPayload(files[i]) {
+					spilled, err_s := options.MemoryPayloads.Spill(options, files[i])
+					if err_s != nil {
+						options.Log.Println(options.Warnbox + "WARNING - Could not write XML file '" + files[i].Name() + "' held in memory to disk to split it. " + err_s.Error())
+						continue
+					}
+					files[i] = spilled
+				}
 				splitfiles = append(splitfiles, files[i])
 				files = append(files[:i], files[i+1:]...)
 				i--
@@ -254,7 +344,7 @@ func GoAuditParser_Start(options Options) {
 		//Split all big files
 		if len(splitfiles) > 0 {
 			options.SubTaskFiles = splitfiles
-			options.XMLSplitOutputDir = filepath.Join(options.InputPath, "xmlsplit")
+			options.XMLSplitOutputDir = XMLSplitDir(options)
 			subTaskFiles := GoAuditXMLSplitter_Start(options)
 			options.SubTaskFiles = nil
 			for i := 0; i < len(subTaskFiles); i++ {
@@ -274,6 +364,7 @@ func GoAuditParser_Start(options Options) {
 			}
 			for i := 0; i < len(splitfiles); i++ {
 				config = ParseConfigUpdateXMLParse(configOutDirIndex, splitfiles[i], "File was split.", ExtraFunc6(options), config)
+				summary.SetFileStatus(splitfiles[i].Name(), "split")
 			}
 			files = append(files, subTaskFiles...)
 		}
@@ -281,6 +372,17 @@ func GoAuditParser_Start(options Options) {
 		debug.FreeOSMemory()
 	}
 
+	//Parse the audits of a host together so its output is complete before the next hosts
+	var fileHosts []string
+	hostRemaining := map[string]int{}
+	hostsActive := map[string]bool{}
+	if options.HostGroups > 0 {
+		files, fileHosts = GroupFilesByHost(options, files)
+		for _, host := range fileHosts {
+			hostRemaining[host]++
+		}
+	}
+
 	//"Extra" functions used for addons
 	var es1 ExtraStruct1
 	if ExtraEnabled() {
@@ -297,7 +399,11 @@ func GoAuditParser_Start(options Options) {
 
 	if len(files) != 0 {
 
+		options.Progress.Stage(ProgressStageParse, len(files))
+		options.Log.StageStarted(ProgressStageParse, len(files))
 		c := make(chan ThreadReturn_Parse)
+		c_queued := make(chan int)
+		c_written := make(chan ThreadReturn_Parse)
 		if options.Threads < 1 {
 			options.Threads = 1
 		}
@@ -305,47 +411,123 @@ func GoAuditParser_Start(options Options) {
 			options.Threads = len(files)
 		}
 
-		c_tqdm := make(chan bool)
 		c_debug := make(chan map[int]string)
 
+		//Files handed off to the writer threads are counted by their own bar as they are queued
+		var bar, writeBar *ProgressBar
 		if options.Verbose == 0 {
-			go TQDM(len(files), options, options.Box+"Parsing XML audits to CSV into '"+options.OutputPath+"'"+extramsg, c_tqdm)
+			bar = NewProgressBar(options, options.Box+"Parsing XML audits to CSV into '"+options.OutputPath+"'"+extramsg, len(files))
+			if options.WriterThreads > 0 && !options.MinimizedOutput {
+				writeBar = NewProgressBar(options, options.Box+"Writing CSV files", 0)
+			}
 		} else {
-			fmt.Println(options.Box + "Parsing XML audits to CSV into '" + options.OutputPath + "'" + extramsg)
+			options.Log.Println(options.Box + "Parsing XML audits to CSV into '" + options.OutputPath + "'" + extramsg)
 			go Debug(options, c_debug)
 		}
 
-		threadMessages := []string{}
+		//Start CSV writer threads with a bounded queue so parsing and writing overlap
+		var writeQueue chan CSVWriteJob
+		if options.WriterThreads > 0 {
+			writeQueue = make(chan CSVWriteJob, options.WriterThreads)
+			for w := 0; w < options.WriterThreads; w++ {
+				go GoAuditCSVWriter_Thread(options, writeQueue, c_written)
+			}
+		}
+
+		threadResults := []ThreadReturn_Parse{}
 
 		//Count bytes until next parse config file save
 		var filesize_total int64 = 0
 		var filesize_max int64 = 500000000
 
-		//Start threads
-		for i := 0; i < len(files); i++ {
-			if i >= options.Threads {
-				done := <-c
+		running := 0
+		finished := 0
+
+		//Record the final result of a file
+		finish := func(done ThreadReturn_Parse) {
+			finished++
+			options.Progress.Finish(done.threadnum)
+			options.Log.FileFinished(ProgressStageParse, files[done.threadnum].Name(), ParseResultStatus(done.message), done.message)
+			bar.Add(1)
+			threadResults = append(threadResults, done)
+			if options.HostGroups > 0 {
+				host := fileHosts[done.threadnum]
+				hostRemaining[host]--
+				if hostRemaining[host] == 0 {
+					delete(hostsActive, host)
+					if options.Verbose > 0 && host != "" {
+						options.Log.Println(options.Box + "NOTICE - Finished all audits of host '" + host + "'.")
+					}
+					if options.NotifyHosts {
+						hostResults := []ThreadReturn_Parse{}
+						for _, result := range threadResults {
+							if fileHosts[result.threadnum] == host {
+								hostResults = append(hostResults, result)
+							}
+						}
+						options.Notifier.HostFinished(options, host, hostResults)
+					}
+				}
+			}
+			config = ParseConfigUpdateXMLParse(configOutDirIndex, files[done.threadnum], done.message, ExtraFunc6(options), config)
+			RemoveParseCheckpoint(options, files[done.threadnum].Name())
+			options.MemoryPayloads.Finish(options, files[done.threadnum], ParseResultStatus(done.message))
+			filesize_total += done.xmlsize
+			if filesize_total > filesize_max || finished == len(files) {
+				filesize_total = 0
+				err_s := ParseConfigSave(config, options)
+				if err_s != nil {
+					options.Log.Println(options.Warnbox + "WARNING - Could not update '_GAPParseCache.json'. " + err_s.Error())
+				}
+				debug.FreeOSMemory()
+			}
+		}
+
+		//Wait for a parse thread to finish or hand off its output, or for a writer to finish a file
+		wait := func() {
+			select {
+			case done := <-c:
+				running--
 				delete(threadbuffer, done.threadnum)
-				if options.Verbose == 0 {
-					c_tqdm <- true
-				} else {
+				if options.Verbose > 0 {
 					c_debug <- threadbuffer
 				}
-				threadMessages = append(threadMessages, done.message)
-				config = ParseConfigUpdateXMLParse(configOutDirIndex, files[done.threadnum], done.message, ExtraFunc6(options), config)
-				filesize_total += done.xmlsize
-				if filesize_total > filesize_max {
-					filesize_total = 0
-					err_s := ParseConfigSave(config, options)
-					if err_s != nil {
-						fmt.Println(options.Warnbox + "WARNING - Could not update '_GAPParseCache.json'. " + err_s.Error())
-					}
-					debug.FreeOSMemory()
+				finish(done)
+			case threadnum := <-c_queued:
+				running--
+				delete(threadbuffer, threadnum)
+				if options.Verbose > 0 {
+					c_debug <- threadbuffer
+				}
+				writeBar.AddTotal(1)
+			case done := <-c_written:
+				writeBar.Add(1)
+				finish(done)
+			}
+		}
+
+		//Collection times of extracted triage packages for '-pcm'
+		if options.ParseCollectionMetadata {
+			options.CollectionMetadata = ReadCollectionMetadataCSVs(options.AgentIDs, []string{options.OutputPath, options.ExtractionOutputDir, options.InputPath, InputScratchDir(options)})
+		}
+
+		//Start threads
+		for i := 0; i < len(files); i++ {
+			for running >= options.Threads {
+				wait()
+			}
+			if options.HostGroups > 0 {
+				for !hostsActive[fileHosts[i]] && len(hostsActive) >= options.HostGroups {
+					wait()
 				}
+				hostsActive[fileHosts[i]] = true
 			}
 			fileconfig := Parse_Config_XMLFile{}
 			config, fileconfig = InputConfig_GetXMLParseConfig(files[i], configOutDirIndex, config)
-			go GoAuditParser_Thread(fileconfig, es1, options, i, c)
+			options.Progress.Start(i, files[i].Name())
+			options.Log.FileStarted(ProgressStageParse, files[i].Name())
+			go GoAuditParser_Thread(fileconfig, es1, options, i, c, writeQueue, c_queued)
+			running++
 			threadbuffer[i] = files[i].Name() + "||" + time.Now().Format("2006-01-02T15:04:05-0700")
 			threadindex++
 			if options.Verbose > 0 {
@@ -354,72 +536,147 @@ func GoAuditParser_Start(options Options) {
 			}
 		}
 
-		//Wait for last few threads
-		for i := 0; i < options.Threads; i++ {
-			done := <-c
-			delete(threadbuffer, done.threadnum)
-			if options.Verbose == 0 {
-				c_tqdm <- true
-			} else {
-				c_debug <- threadbuffer
-			}
-			threadMessages = append(threadMessages, done.message)
-			config = ParseConfigUpdateXMLParse(configOutDirIndex, files[done.threadnum], done.message, ExtraFunc6(options), config)
-			if filesize_total > filesize_max || i == options.Threads-1 {
-				filesize_total = 0
-				err_s := ParseConfigSave(config, options)
-				if err_s != nil {
-					fmt.Println(options.Warnbox + "WARNING - Could not update '_GAPParseCache.json'. " + err_s.Error())
-				}
-				debug.FreeOSMemory()
-			}
+		//Wait for last few threads and writes
+		for finished < len(files) {
+			wait()
 		}
-
-		for _, msg := range threadMessages {
-			if strings.Contains(msg, "parsed successfully") {
+		if writeQueue != nil {
+			close(writeQueue)
+		}
+		writeBar.Close()
+		bar.Close()
+		options.Log.StageFinished(ProgressStageParse, len(files))
+
+		for _, done := range threadResults {
+			msg := done.message
+			status := ParseResultStatus(msg)
+			switch status {
+			case "parsed":
 				c_Success++
-				if options.Verbose > 0 {
+				if strings.Contains(msg, "Duplicate header") || strings.Contains(msg, "parse anomalies") || strings.Contains(msg, "failed normalization") {
+					fmt.Println(msg)
+				} else if options.Verbose > 0 {
 					fmt.Println(msg)
 				}
-			} else if strings.Contains(msg, "Could not rename") {
-				c_Failed++
-				fmt.Println(msg)
-			} else if strings.Contains(msg, "Could not parse file") {
+			case "failed":
 				c_Failed++
 				fmt.Println(msg)
-			} else if strings.Contains(msg, "already exists") {
+			case "cached":
 				c_Cached++
 				if options.Verbose > 0 {
 					fmt.Println(msg)
 				}
-			} else if strings.Contains(msg, "Issues file") {
+			case "issues":
 				c_Issues++
 				if options.Verbose > 0 {
 					fmt.Println(msg)
 				}
-			} else if strings.Contains(msg, "is empty") {
+			case "empty":
 				c_Empty++
 				fmt.Println(msg)
-			} else if strings.Contains(msg, "does not exist") {
-				c_Failed++
-				fmt.Println(msg)
-			} else {
+			case "skipped":
+				c_Skipped++
+				if options.Verbose > 0 {
+					fmt.Println(msg)
+				}
+			default:
 				if options.Verbose > 0 {
 					fmt.Println(msg)
 				}
 			}
+			summary.Add(options, done, status)
+		}
+
+		//Debug blocks of the parsed audits, cached audits keep the rows written when they were parsed
+		if debugRows, err_d := options.AuditDebugLog.Save(options); err_d != nil {
+			options.Log.Println(options.Warnbox + "WARNING - Could not write '<hostname>-<agentid>-0-AuditDebug.csv' files. " + err_d.Error())
+		} else if debugRows > 0 && options.Verbose > 0 {
+			options.Log.Println(options.Box + "Wrote " + strconv.Itoa(debugRows) + " audit Debug message(s) to '<hostname>-<agentid>-0-AuditDebug.csv' files.")
+		}
+
+		//Issues of the parsed issues files for '-pi', cached issues files keep the rows written when they were parsed
+		if issueRows, err_i := options.IssuesLog.Save(options); err_i != nil {
+			options.Log.Println(options.Warnbox + "WARNING - Could not write '<hostname>-<agentid>-issues.csv' files. " + err_i.Error())
+		} else if issueRows > 0 && options.Verbose > 0 {
+			options.Log.Println(options.Box + "Wrote " + strconv.Itoa(issueRows) + " issue(s) to '<hostname>-<agentid>-issues.csv' files.")
+		}
+
+		//Hits of the parsed event files for '-phits', cached event files keep the rows written when they were parsed
+		if hitRows, err_h := options.HitsLog.Save(options); err_h != nil {
+			options.Log.Println(options.Warnbox + "WARNING - Could not write '<hostname>-<agentid>-Hits.csv' files. " + err_h.Error())
+		} else if hitRows > 0 && options.Verbose > 0 {
+			options.Log.Println(options.Box + "Wrote " + strconv.Itoa(hitRows) + " hit(s) to '<hostname>-<agentid>-Hits.csv' files.")
+		}
+
+		//Pseudonyms of '-redact', which the analyst needs to look up the original values
+		if added, err_r := options.Redaction.Save(options); err_r != nil {
+			options.Log.Println(options.Warnbox + "ERROR - Could not write redaction map '" + options.Redaction.MapFile + "'. " + err_r.Error())
+		} else if added > 0 {
+			options.Log.Println(options.Box + "NOTICE - Added " + strconv.Itoa(added) + " pseudonym(s) to redaction map '" + options.Redaction.MapFile + "'. It holds the original values, keep it out of shared copies of the output.")
 		}
 	}
 
 	elapsed := time.Since(start)
 	time.Sleep(10 * time.Millisecond)
 
-	fmt.Println(options.Box + "Parse Statistics:")
+	options.Log.Println(options.Box + "Parse Statistics:")
 	fmt.Println(options.Box+" - Parsed: ", c_Success)
 	fmt.Println(options.Box+" - Failed: ", c_Failed)
 	fmt.Println(options.Box+" - Cached: ", c_Cached)
 	fmt.Println(options.Box+" - Empty:  ", c_Empty)
 	fmt.Println(options.Box+" - Issues: ", c_Issues)
+	if c_Skipped > 0 {
+		fmt.Println(options.Box+" - Skipped:", c_Skipped, "(not audits)")
+	}
+	if len(summary.AuditMismatches) > 0 {
+		fmt.Println(options.Box+" - Audit Mismatches:", len(summary.AuditMismatches), "(see '_GAPRunSummary.json')")
+	}
+	parseCounts := map[string]int{
+		"parsed":     c_Success,
+		"failed":     c_Failed,
+		"cached":     c_Cached,
+		"empty":      c_Empty,
+		"issues":     c_Issues,
+		"skipped":    c_Skipped,
+		"mismatches": len(summary.AuditMismatches),
+	}
+	options.Log.Statistics(ProgressStageParse, parseCounts)
+	options.Notifier.Statistics(ProgressStageParse, parseCounts)
+	if anomalyCount := options.ParseAnomalyLog.Len(); anomalyCount > 0 {
+		fmt.Println(options.Box+" - Anomalies: ", anomalyCount)
+		if csvPath, err_s := options.ParseAnomalyLog.Save(options); err_s != nil {
+			options.Log.Println(options.Warnbox + "WARNING - Could not write '" + csvPath + "'. " + err_s.Error())
+		} else {
+			options.Log.Println(options.Box + "Parse anomalies were skipped with '-pap lenient' and are listed in '" + csvPath + "'.")
+		}
+	}
+	if options.DataQualityLog.Len() > 0 {
+		if csvPath, err_s := options.DataQualityLog.Save(options); err_s != nil {
+			options.Log.Println(options.Warnbox + "WARNING - Could not write '" + csvPath + "'. " + err_s.Error())
+		} else if options.Verbose > 0 {
+			options.Log.Println(options.Box + "Column data quality metrics are in '" + csvPath + "'.")
+		}
+	}
+	if options.TagRuleHits != nil && options.TagRuleHits.Checked > 0 {
+		if csvPath, matched, err_s := options.TagRuleHits.Save(options); err_s != nil {
+			options.Log.Println(options.Warnbox + "WARNING - Could not write '" + csvPath + "'. " + err_s.Error())
+		} else {
+			options.Log.Println(options.Box + strconv.Itoa(matched) + " of " + strconv.Itoa(len(options.TagRules)) + " tag rule(s) matched rows of the files parsed in this run. The hits of each rule are in '" + csvPath + "'.")
+		}
+	}
+	if summary.Files > 0 {
+		summary.Print(options)
+	}
+	//Compare against the previous run over the same input, runs with every file cached keep the previous summary
+	if previous, err_l := LoadParseRunSummary(options); err_l == nil && len(previous.FileStatus) > 0 && previous.InputPath == summary.InputPath && len(summary.FileStatus) > 0 {
+		summary.Diff(previous).Print(options, previous)
+	}
+	if summary.Files > 0 {
+		err_s := summary.Save(options, elapsed)
+		if err_s != nil {
+			options.Log.Println(options.Warnbox + "WARNING - Could not write '_GAPRunSummary.json'. " + err_s.Error())
+		}
+	}
 
 	fmt.Printf(options.Box+"Parsed %d file(s) in %s.", len(files), elapsed.Truncate(time.Millisecond).String())
 	if options.Timeline || !options.MinimizedOutput {
@@ -427,11 +684,36 @@ func GoAuditParser_Start(options Options) {
 	}
 }
 
-func TQDM(total int, options Options, message string, c_tqdm chan bool) {
-	tqdm.With(Interval(0, total), message, func(v interface{}) (brk bool) {
-		<-c_tqdm
-		return
-	})
+//scannerLineError returns the error of an XML file whose scanner stopped after lineCount lines were scanned
+//A line longer than the '-plb <int>' read buffer stops the scanner at the line after the last scanned one
+func scannerLineError(options Options, xmlFileName string, lineCount int, err_se error) string {
+	message := options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. `
+	if err_se == bufio.ErrTooLong {
+		return message + `Line ` + strconv.Itoa(lineCount+1) + ` is longer than the line buffer of ` + strconv.Itoa(options.ParseLineBufferSize) + ` bytes, increase it with '-plb <int>'.`
+	}
+	return message + `Could not read line ` + strconv.Itoa(lineCount+1) + `. ` + err_se.Error()
+}
+
+//ParseResultStatus returns the status of a file from the message of its parse thread, one of "parsed", "failed",
+//"cached", "issues", "empty", "skipped", or "" for other messages
+func ParseResultStatus(msg string) string {
+	switch {
+	case strings.Contains(msg, "parsed successfully"):
+		return "parsed"
+	case strings.Contains(msg, "Could not rename"), strings.Contains(msg, "Could not parse file"):
+		return "failed"
+	case strings.Contains(msg, "already exists"):
+		return "cached"
+	case strings.Contains(msg, "Issues file"):
+		return "issues"
+	case strings.Contains(msg, "is empty"):
+		return "empty"
+	case strings.Contains(msg, "is not an audit"):
+		return "skipped"
+	case strings.Contains(msg, "does not exist"):
+		return "failed"
+	}
+	return ""
 }
 
 func Debug(options Options, c_debug chan map[int]string) {
@@ -450,7 +732,7 @@ func Debug(options Options, c_debug chan map[int]string) {
 			if time.Now().After(last.Add(time.Second * 30)) {
 				last = time.Now()
 				if options.Verbose < 3 && len(stats) != 0 {
-					fmt.Println(options.Box + time.Now().Format("2006-01-02 15:04:05") + " - " + strconv.Itoa(len(stats)) + " file(s) are being processed:")
+					options.Log.Println(options.Box + time.Now().Format("2006-01-02 15:04:05") + " - " + strconv.Itoa(len(stats)) + " file(s) are being processed:")
 					lines := []string{}
 					for _, v := range stats {
 						filename := strings.Split(v, "||")[0]
@@ -480,16 +762,21 @@ func fmtDuration(d time.Duration) string {
 	return fmt.Sprintf("%02d:%02d:%02d", h, m, s)
 }
 
-func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, options Options, threadNum int, c chan ThreadReturn_Parse) {
+func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, options Options, threadNum int, c chan ThreadReturn_Parse, writeQueue chan CSVWriteJob, c_queued chan int) {
 
 	xmlFileSize := fileconfig.InputFileSize
 	xmlFileName := fileconfig.InputFileName
 	xmlFilePath := filepath.Join(options.InputPath, xmlFileName)
-	//Check if file is a split file
-	if _, err_s := os.Stat(xmlFilePath); os.IsNotExist(err_s) {
-		xmlFilePath = filepath.Join(filepath.Join(options.InputPath, "xmlsplit"), xmlFileName)
-		if _, err_s2 := os.Stat(xmlFilePath); os.IsNotExist(err_s2) {
-			c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + "ERROR - File '" + filepath.Join(options.InputPath, xmlFileName) + "' does not exist."}
+	//Check if file is a split file, or was extracted to the scratch directory of '-readonly-input'
+	if _, err_s := options.MemoryPayloads.Stat(xmlFilePath); os.IsNotExist(err_s) {
+		xmlFilePath = filepath.Join(XMLSplitDir(options), xmlFileName)
+		_, err_s2 := os.Stat(xmlFilePath)
+		if os.IsNotExist(err_s2) && options.ReadOnlyInput {
+			xmlFilePath = filepath.Join(InputScratchDir(options), xmlFileName)
+			_, err_s2 = options.MemoryPayloads.Stat(xmlFilePath)
+		}
+		if os.IsNotExist(err_s2) {
+			c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + "ERROR - File '" + filepath.Join(options.InputPath, xmlFileName) + "' does not exist.", nil}
 			return
 		}
 	}
@@ -497,6 +784,19 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 	csvFilePathTemp := ""
 	csvFilePathHasAuditType := false
 
+	//Parsed CSV files to be written
+	outputs := []CSVWriteOutput{}
+
+	//Rows of a huge normal audit '-pstream' wrote while parsing, and the rows allowlisted or noted in them
+	var streamed *StreamedOutput
+	streamedRows, streamSuppressed, streamNoted, streamTagged := 0, 0, 0, 0
+
+	//Anomalies skipped with the lenient '-pap' policy
+	anomalies := NewParseAnomalies(options, xmlFileName)
+
+	//Repeated cell values of this file share one copy
+	pool := NewValuePool()
+
 	//Perform extra addon functions
 	var es2 ExtraStruct2
 	if ExtraEnabled() {
@@ -506,36 +806,56 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 	AUDIT_NORMAL := 1
 	AUDIT_EVENTBUFFER := 2
 	AUDIT_STATEAGENTINSPECTOR := 3
+	AUDIT_ISSUES := 4
 	auditXMLStyle := 0
 
 	//Get First 2 Lines of Audit
-	f, err_f := os.Open(xmlFilePath)
+	f, err_f := options.MemoryPayloads.Open(xmlFilePath)
 	if err_f != nil {
-		c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + "ERROR - File '" + xmlFilePath + "' does not exist."}
+		c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + "ERROR - File '" + xmlFilePath + "' does not exist.", nil}
 		return
 	}
 	scanner := bufio.NewScanner(f)
 	row_count := 0
 	itemListLine := ""
+	generator := ""
+	inDebug := false
+	debugOnly := false
 	for scanner.Scan() {
 		row_count++
 		itemListLine = strings.TrimSpace(scanner.Text())
+		//XML files which are not audits, such as tool exports, are skipped unless '-pnafail' reports them as failures
+		if (row_count == 1 && !strings.HasPrefix(itemListLine, "<?xml")) || (row_count == 2 && !strings.HasPrefix(strings.ToLower(itemListLine), "<itemlist") && !strings.HasPrefix(strings.ToLower(itemListLine), "<issuelist")) {
+			if root := NonAuditXMLRoot(options, xmlFilePath); root != "" && !options.ParseNonAuditFail {
+				f.Close()
+				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `NOTICE - File '` + xmlFileName + `' is not an audit and was skipped. Its root element is <` + root + `>.`, nil}
+				return
+			}
+		}
 		if row_count == 1 && !strings.HasPrefix(itemListLine, "<?xml") {
 			f.Close()
-			c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Unexpected 1st Line: ` + itemListLine}
+			c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Unexpected 1st Line: ` + itemListLine, nil}
 			return
 		}
 		if row_count == 2 {
 			itemListLine = strings.ToLower(itemListLine)
 			if strings.HasPrefix(itemListLine, "<issuelist") {
+				//Collection failures are written to "<hostname>-<agentid>-issues.csv" with '-pi'
+				if options.ParseIssues {
+					auditXMLStyle = AUDIT_ISSUES
+					break
+				}
 				f.Close()
-				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `NOTICE - Issues file '` + xmlFileName + `' ignored.`}
+				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `NOTICE - Issues file '` + xmlFileName + `' ignored.`, nil}
 				return
 			} else if !strings.HasPrefix(itemListLine, "<itemlist") {
 				f.Close()
-				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Unexpected 2nd Line: ` + itemListLine}
+				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Unexpected 2nd Line: ` + itemListLine, nil}
 				return
 			}
+			if m := regItemListGenerator.FindStringSubmatch(itemListLine); len(m) > 1 {
+				generator = m[1]
+			}
 			auditXMLStyle = AUDIT_NORMAL
 			if strings.Contains(itemListLine, `generator="eventbuffer"`) {
 				auditXMLStyle = AUDIT_EVENTBUFFER
@@ -545,12 +865,22 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 			}
 		}
 		if row_count >= 3 {
+			//Debug blocks may come before the first item, which names the audit type
+			comp := strings.ToLower(itemListLine)
+			if inDebug || strings.HasPrefix(comp, "<debug") {
+				inDebug = !strings.HasPrefix(comp, "</debug>") && !(strings.HasPrefix(comp, "<debug") && strings.HasSuffix(comp, "/>"))
+				debugOnly = true
+				continue
+			}
+			if comp != "</itemlist>" {
+				debugOnly = false
+			}
 			break
 		}
 	}
 	f.Close()
 	if auditXMLStyle == 0 {
-		c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Unexpected XML schema.`}
+		c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Unexpected XML schema.`, nil}
 		return
 	}
 
@@ -559,23 +889,34 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 	agentid := ""
 	payload := ""
 	auditType := ""
+	itemTag := ""
+	splitEventType := ""
 
 	if auditXMLStyle == AUDIT_NORMAL {
-		//Get AuditType from 2nd Line
-		if row_count != 3 {
-			c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + "WARNING - File '" + xmlFileName + "' is empty."}
+		//Get AuditType from the first item
+		if row_count < 3 {
+			c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + "WARNING - File '" + xmlFileName + "' is empty.", nil}
 			return
 		}
+		//Audits without items are still parsed for their Debug blocks, under the name of their generator
+		if debugOnly && generator != "" {
+			itemListLine = "<" + generator + ">"
+		}
 		regAuditType := regexp.MustCompile(`<([^ >]+)[ >]`)
 		regAuditTypeSubmatch := regAuditType.FindStringSubmatch(itemListLine)
 		if len(regAuditTypeSubmatch) <= 1 || regAuditTypeSubmatch[1] == "" {
-			c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Could not identify audit type from line: '` + itemListLine}
+			c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Could not identify audit type from line: '` + itemListLine, nil}
 			return
 		}
 		auditType = regAuditTypeSubmatch[1]
+		itemTag = auditType
+		//Event types split by '-ebs' are parsed as the eventbuffer audit they came from
+		if strings.EqualFold(generator, SplitEventGenerator) && !debugOnly {
+			auditType, splitEventType = SplitEventAuditType(auditType)
+		}
 	}
 
-	basefilename := strings.TrimSuffix(xmlFileName, ".xml")
+	basefilename := NormalizeAgentIDFileName(strings.TrimSuffix(xmlFileName, ".xml"))
 
 	parts := strings.Split(basefilename, "-")
 	//For non-standarized naming schemes
@@ -622,12 +963,34 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 			}
 		}
 	}
+	agentid = options.AgentIDs.Normalize(options, agentid, xmlFileName)
+	originalHostname := hostname
+	hostname = NormalizeHostname(hostname, options)
+	//'-redact' rules of the "Hostname" column redact the hostname of the output files as well
+	originalHostname = options.Redaction.Hostname(originalHostname)
+	hostname = options.Redaction.Hostname(hostname)
 	csvFilePath = filepath.Join(csvFilePath, hostname+"-"+agentid+"-"+payload+"-")
 
 	if options.Verbose > 3 {
 		fmt.Println("\nAudit Style:", auditXMLStyle)
 	}
 
+	resumeNote := ""
+
+	if auditXMLStyle == AUDIT_ISSUES {
+		generator, issues, err_i := ReadIssuesFile(options, xmlFilePath)
+		if err_i != nil {
+			c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. ` + err_i.Error(), nil}
+			return
+		}
+		if generator == "" {
+			generator = payload
+		}
+		options.IssuesLog.Add(options, hostname, agentid, generator, RedactedInputName(options, xmlFileName), issues)
+		c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Box + `NOTICE - Issues file '` + xmlFileName + `' had ` + strconv.Itoa(len(issues)) + ` issue(s) written.`, nil}
+		return
+	}
+
 	//xmlFile, err_o := os.Open(xmlFilePath)
 	if auditXMLStyle == AUDIT_NORMAL {
 
@@ -636,625 +999,285 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 			es2 = ExtraFunc3(options, fileconfig, es2)
 		}
 
-		useScanner := xmlFileSize >= 100000000 // 100 MB
-		var lines []string
-		var scanner *bufio.Scanner
-		var file *os.File
-
-		if useScanner {
-			var err_f error
-			file, err_f = os.Open(xmlFilePath)
-			if err_f != nil {
-				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + "ERROR - File " + xmlFilePath + "' does not exist."}
-				return
-			}
-			//https://stackoverflow.com/questions/21124327/how-to-read-a-text-file-line-by-line-in-go-when-some-lines-are-long-enough-to-ca
-			scanner = bufio.NewScanner(file)
-			buf := make([]byte, 0, 64*1024)
-			scanner.Buffer(buf, 1024*1024*20)
+		//Always stream the file so memory usage does not depend on file size or thread count
+		file, err_f := options.MemoryPayloads.Open(xmlFilePath)
+		if err_f != nil {
+			c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + "ERROR - File '" + xmlFilePath + "' does not exist.", nil}
+			return
+		}
 
-		} else {
-			content, err_o := ioutil.ReadFile(xmlFilePath)
-			if err_o != nil {
-				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + "ERROR - Could not open file '" + xmlFilePath + "' to split. " + err_o.Error()}
-				return
+		//Resume from the checkpoint of an earlier run which stopped in this file ('-pck')
+		start := normalAuditStart{InHeader: true}
+		var checkpointer *ParseCheckpointer
+		if options.ParseCheckpointMinutes > 0 {
+			xmlFileStat, _ := file.Stat()
+			resumed, resumedHeaders, resumedRows := ReadParseCheckpoint(options, xmlFileName, xmlFileStat)
+			if resumed != nil {
+				if _, err_s := file.Seek(resumed.ByteOffset, io.SeekStart); err_s == nil {
+					start = normalAuditStart{false, resumed.LineCount, resumedHeaders, resumedRows}
+					resumeNote = resumed.ResumeNote()
+				} else {
+					file.Seek(0, io.SeekStart)
+					resumed = nil
+				}
 			}
-			lines = strings.Split(string(content), "\n")
+			checkpointer = NewParseCheckpointer(options, xmlFileName, xmlFileStat, resumed)
+		}
+		var offset int64
+		if !start.InHeader {
+			offset, _ = file.Seek(0, io.SeekCurrent)
 		}
+		//https://stackoverflow.com/questions/21124327/how-to-read-a-text-file-line-by-line-in-go-when-some-lines-are-long-enough-to-ca
+		scanner, lineStart := newOffsetScanner(file, offset, options.ParseLineBufferSize, anomalies.ScanLines(options.ParseLineBufferSize))
 
 		var csvFileTemp *os.File
 
-		regAuditOpen := regexp.MustCompile(`^[ \t]*<([^ >]+)[ >]`)
-		regAuditCloseORFieldSubClose := regexp.MustCompile(`^[ \t]*</([^ >]+)>`)
-		regAuditCreated := regexp.MustCompile(`created="([^"]+)"`)
-		regAuditUID := regexp.MustCompile(`uid="([^"]+)"`)
-		regFieldSLClose := regexp.MustCompile(`^[ \t]*<([-_A-Za-z0-9]+) ?/>$`)               //  <remoteIpAddress />
-		regFieldSL := regexp.MustCompile(`^[ \t]*<([-_A-Za-z0-9]+)>(.*)</[-_A-Za-z0-9]+>$`)  //  <remoteIpAddress>10.34.155.235</remoteIpAddress>
-		regFieldMLOpenORFieldSubOpen := regexp.MustCompile(`^[ \t]*<([-_A-Za-z0-9]+)>(.*)$`) //  <httpHeader>POST /wsman HTTP/1.1
-		regFieldMLClose := regexp.MustCompile(`^([^<>]*)</([-_A-Za-z0-9]+)>$`)               //</httpHeader>
-		regFieldSubOpen := regexp.MustCompile(`^[ \t]*<([-_A-Za-z0-9]+)>$`)
-
-		STATES := map[int]string{}
-		STATES[0] = "STATE_HEADER"
-		STATES[1] = "STATE_EXPECTING_AUDITITEMOPEN_OR_ITEMLISTCLOSE_OR_DEBUGOPEN"
-		STATES[2] = "STATE_EXPECTING_FIELDOPEN_OR_AUDITITEMCLOSE"
-		STATES[3] = "STATE_EXPECTING_AUDITITEMOPEN_OR_FIELDCLOSE"
-		STATES[4] = "STATE_EXPECTING_FIELDCLOSE"
-		STATES[5] = "STATE_FINISHED"
-		STATES[6] = "STATE_EXPECTING_DEBUGCLOSE"
-
-		STATE_HEADER := 0
-		STATE_EXPECTING_AUDITITEMOPEN_OR_ITEMLISTCLOSE_OR_DEBUGOPEN := 1
-		STATE_EXPECTING_FIELDOPEN_OR_AUDITITEMCLOSE := 2
-		STATE_EXPECTING_AUDITITEMOPEN_OR_FIELDCLOSE := 3
-		STATE_EXPECTING_FIELDCLOSE := 4
-		STATE_FINISHED := 5
-		STATE_EXPECTING_DEBUGCLOSE := 6
-
-		state := STATE_HEADER
-
-		headers := map[string]int{}          // map["ColumnHeader"]ColumnID
-		rows := []map[int]*strings.Builder{} // []map[ColumnID]"Value"
-		row := map[int]*strings.Builder{}    // map[ColumnID]"Value"
-
-		lineCount := 0
-
-		headerPathParts := []string{}
-
-		multilineHeader := ""
+		firstItemCheck := func() string {
+			if !csvFilePathHasAuditType {
+				csvFilePathHasAuditType = true
+				//"Output_Routes" of the main config may send the audit type to a subdirectory
+				auditOutputDir := AuditOutputDir(options, auditType)
+				csvFilePath = filepath.Join(auditOutputDir, filepath.Base(csvFilePath)+auditType+OutputFileExtension(options))
+				csvFilePathTemp = TempOutputPath(options, csvFilePath)
+				//The library's Parser only returns the rows
+				if options.ParseInMemory {
+					return ""
+				}
+				if err_m := MkdirAllOutput(options, auditOutputDir); err_m != nil {
+					return options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Could not create output directory '` + auditOutputDir + `'. ` + err_m.Error()
+				}
 
-		include_value := true
+				_, o_err := os.Stat(csvFilePath)
+				if !options.ForceReparse && !options.WipeOutput && !os.IsNotExist(o_err) {
+					return options.Box + `NOTICE - Parsed audit for file '` + xmlFileName + `' already exists. Use '-f' flag to force reparse.`
+				}
+				var err error
+				csvFileTemp, err = CreateOutputFile(options, csvFilePathTemp)
+				if err != nil {
+					return options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Could not create file '` + csvFilePathTemp + `'. ` + err.Error()
+				}
+			}
+			return ""
+		}
 
-		var byteindex uint64 = 0
-		bytepadding := len(strconv.FormatInt(xmlFileSize, 10))
-		lastupdate := time.Now()
+		//Debug blocks, written to "<hostname>-<agentid>-0-AuditDebug.csv"
+		debugEntries := []AuditDebugEntry{}
+		onDebug := func(entry AuditDebugEntry) {
+			debugEntries = append(debugEntries, entry)
+		}
 
-		//For every line in file
-		for {
+		//Line of each row's audit item for '-praw', rows resumed from a checkpoint have none
+		itemLines := make([]int, len(start.Rows))
+		var onRow func(int)
+		if options.ParseRawXML {
+			onRow = func(line int) {
+				itemLines = append(itemLines, line)
+			}
+		}
 
-			if options.Verbose > 2 && time.Now().After(lastupdate.Add(time.Second*5)) {
-				lastupdate = time.Now()
-				fmt.Printf(options.Box+time.Now().Format("2006-01-02 15:04:05")+" - %"+strconv.Itoa(bytepadding)+"d/%s %6.2f%% "+filepath.Base(xmlFilePath)+"\n", byteindex, strconv.FormatInt(xmlFileSize, 10), (float32(byteindex)/float32(xmlFileSize))*100.0)
+		var headers map[string]int
+		var rows []map[int]*strings.Builder
+		var lineCount int
+		var errmsg string
+
+		//With '-pstream', a first pass finds every header so rows can be written before the whole file is parsed
+		var streamOutput CSVWriteOutput
+		var streamCSVHeaders []string
+		if UseStreamedParsing(options, xmlFileSize) && start.InHeader && checkpointer == nil {
+			scanned, scanerr := ScanNormalAuditHeaders(options, es1, es2, xmlFilePath, xmlFileName, xmlFileSize, itemTag)
+			if scanerr != "" {
+				file.Close()
+				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, scanerr, nil}
+				return
+			}
+			start.Headers = scanned
+			restored := CopyHeaderMap(scanned)
+			if splitEventType != "" {
+				restored = RestoreSplitEventHeaders(splitEventType, restored, nil)
+			}
+			streamCSVHeaders = normalAuditCSVHeaders(options, auditType, restored)
+		}
+		//Writes the rows parsed so far, returns false if they could not be written
+		streamErr := ""
+		flushStream := func(headers map[string]int, rows []map[int]*strings.Builder) bool {
+			if streamed == nil {
+				streamed = NewStreamedOutput(csvFileTemp, csvFilePathTemp)
+			}
+			if splitEventType != "" {
+				headers = RestoreSplitEventHeaders(splitEventType, CopyHeaderMap(headers), rows)
 			}
+			csvHeaders, csvRows := normalAuditCSVRows(options, auditType, hostname, originalHostname, agentid, pool, streamCSVHeaders, headers, rows, nil)
+			streamOutput = CSVWriteOutput{csvHeaders, GetFieldDescriptionsRow(options, auditType, csvHeaders), csvRows, nil, csvFilePathTemp, csvFilePath, hostname + "-" + agentid + "-" + payload, auditType, xmlFileName, streamed}
+			streamedRows += len(csvRows)
+			batch := []CSVWriteOutput{streamOutput}
+			suppressed, noted, tagged := applyOutputRowSteps(options, agentid, payload, batch)
+			streamSuppressed += suppressed
+			streamNoted += noted
+			streamTagged += tagged
+			if err_w := streamed.Write(options, batch[0], batch[0].Headers, batch[0].Desc, batch[0].Rows); err_w != nil {
+				streamErr = options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Could not write file '` + csvFilePathTemp + `'. ` + err_w.Error()
+				return false
+			}
+			streamOutput.Headers, streamOutput.Desc, streamOutput.Rows = batch[0].Headers, batch[0].Desc, nil
+			return true
+		}
 
-			var line string
-			if useScanner {
+		chunked := false
+		if UseChunkedParsing(options, xmlFileSize) && start.InHeader && streamCSVHeaders == nil {
+			headers, rows, errmsg, chunked = ParseNormalAuditChunked(options, es1, es2, xmlFilePath, xmlFileName, xmlFileSize, itemTag, firstItemCheck, onRow, onDebug)
+		}
+		if !chunked {
+			next := func() (string, bool) {
 				if !scanner.Scan() {
-					break
+					return "", false
 				}
-				line = scanner.Text()
-			} else {
-				if lineCount == len(lines) {
-					break
+				return scanner.Text(), true
+			}
+			var onItem func(map[string]int, []map[int]*strings.Builder, int) bool
+			if checkpointer != nil {
+				checkpointWarned := false
+				onItem = func(headers map[string]int, rows []map[int]*strings.Builder, lines int) bool {
+					if err_c := checkpointer.Save(headers, rows, lines, *lineStart); err_c != nil && !checkpointWarned {
+						checkpointWarned = true
+						options.Log.Println(options.Warnbox + "WARNING - Could not save checkpoint of file '" + xmlFileName + "'. " + err_c.Error())
+					}
+					return false
+				}
+			} else if streamCSVHeaders != nil {
+				//Write the rows once they hold about '-pstream <int>' megabytes
+				bound := int64(options.ParseStreamMB) * 1024 * 1024
+				held, measured := int64(0), 0
+				onItem = func(headers map[string]int, rows []map[int]*strings.Builder, lines int) bool {
+					held += StreamedRowsSize(rows[measured:])
+					measured = len(rows)
+					if held < bound || streamErr != "" || csvFileTemp == nil {
+						return false
+					}
+					held, measured = 0, 0
+					return flushStream(headers, rows)
 				}
-				line = lines[lineCount]
 			}
-			byteindex += uint64(len(line))
-			line = strings.TrimSuffix(line, "\r")
-			lineCount++
-
-			if options.Verbose > 3 {
-				fmt.Println("==========================")
-				fmt.Println("File Name:       ", xmlFileName)
-				fmt.Println("File Progress:   ", fmt.Sprintf("%d/%s %6.2f%%", byteindex, strconv.FormatInt(xmlFileSize, 10), (float32(byteindex)/float32(xmlFileSize))*100.0))
-				fmt.Println("Line Number:     ", lineCount)
-				fmt.Println("State:           ", state, STATES[state])
-				fmt.Println("Header Parts:    ", strings.Join(headerPathParts, "."))
-				fmt.Println("MultiLine Header:", multilineHeader)
-				fmt.Println("Include Value:   ", include_value)
-				fmt.Println("Raw Line:        ", line)
-				uEnc := b64.URLEncoding.EncodeToString([]byte(line))
-				fmt.Println("Base64 Line:     ", uEnc)
-
+			headers, rows, lineCount, errmsg = parseNormalAuditLines(options, es1, es2, next, itemTag, xmlFileName, xmlFilePath, xmlFileSize, start, anomalies, firstItemCheck, onItem, onRow, onDebug)
+			if errmsg == "" && streamErr == "" && streamed != nil && len(rows) > 0 {
+				flushStream(headers, rows)
+				rows = nil
 			}
-
-			// <?xml version="1.0" encoding="UTF-8"?>
-			if state == STATE_HEADER && lineCount == 1 {
-				line = strings.TrimSpace(line)
-				if !strings.HasPrefix(line, "<?xml ") {
-					if useScanner {
-						file.Close()
-					}
-					c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Unexpected 1st Line: ` + line}
-					return
-				}
-				continue
+			if errmsg == "" {
+				errmsg = streamErr
 			}
-			// <itemList generator="eventbuffer" generatorVersion="29.7.8" itemSchemaLocation="http://schemas.mandiant.com/2013/11/stateagentinspectoritem.xsd" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:noNamespaceSchemaLocation="http://schemas.mandiant.com/2013/11/stateagentinspectoritem.xsd">
-			if state == STATE_HEADER && lineCount == 2 {
-				line = strings.ToLower(strings.TrimSpace(line))
-				if strings.HasPrefix(line, "<issuelist") {
-					if useScanner {
-						file.Close()
-					}
-					c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `NOTICE - Issues file '` + xmlFileName + `' ignored.`}
-					return
-				} else if !strings.HasPrefix(line, "<itemlist") {
-					if useScanner {
-						file.Close()
-					}
-					c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Unexpected 2nd Line: ` + line}
-					return
-				}
-				state = STATE_EXPECTING_AUDITITEMOPEN_OR_ITEMLISTCLOSE_OR_DEBUGOPEN
-				continue
+		}
+		if errmsg != "" {
+			file.Close()
+			if streamed != nil {
+				streamed.Abort()
+			} else if csvFileTemp != nil {
+				csvFileTemp.Close()
 			}
+			c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, errmsg, nil}
+			return
+		}
+		/*
+		   headers := map[string]int{} // map["ColumnHeader"]ColumnID
+		   rows := []map[int]string{}  // []map[ColumnID]"Value"
+		   row  := map[int]string{}    // map[ColumnID]"Value"
+		*/
 
-			if state == STATE_EXPECTING_AUDITITEMOPEN_OR_ITEMLISTCLOSE_OR_DEBUGOPEN {
+		file.Close()
 
-				if es1.ExtraBool1 {
-					include_value = false
-				}
+		//Check if a line was too long for the read buffer
+		if err_se := scanner.Err(); err_se != nil {
+			if streamed != nil {
+				streamed.Abort()
+			} else if csvFileTemp != nil {
+				csvFileTemp.Close()
+				os.Remove(csvFilePathTemp)
+			}
+			c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, scannerLineError(options, xmlFileName, lineCount, err_se), nil}
+			return
+		}
 
-				if len(row) != 0 {
-					rows = append(rows, row)
-				}
-				row = map[int]*strings.Builder{}
-				headerPathParts = []string{}
+		//Audits without items often only hold Debug blocks explaining why
+		options.AuditDebugLog.Add(options, hostname, agentid, auditType, RedactedInputName(options, xmlFileName), debugEntries)
 
-				comp := strings.ToLower(strings.TrimSpace(line))
+		if streamed != nil {
+			//The writer threads only rename the streamed temp file
+			outputs = append(outputs, streamOutput)
+		} else {
+			if len(rows) == 0 {
+				csvFileTemp.Close()
+				os.Remove(csvFilePathTemp)
+				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `WARNING - File '` + xmlFileName + `' is empty.`, nil}
+				return
+			}
+			if splitEventType != "" {
+				headers = RestoreSplitEventHeaders(splitEventType, headers, rows)
+			}
 
-				//END
-				if comp == "</itemlist>" {
-					//Finish up...
-					state = STATE_FINISHED
-					break
-				}
-				//DEBUG
-				// <Debug created="2020-10-05T18:01:05Z" uid="473bc9ba-fc52-437e-8610-1bf6c4aabd93">
-				//  <Message>
-				//Wow6432Node\Microsoft\Windows\CurrentVersion\Group Policy\State\Machine\Scripts\Startup: Registry key not found</Message>
-				// </Debug>
-				if strings.HasPrefix(comp, "<debug") {
-					//Finish up...
-					state = STATE_EXPECTING_DEBUGCLOSE
-					continue
-				}
-				//Check if audit type ^<([^ >]+)[ >]
-				m := regAuditOpen.FindStringSubmatch(line)
-				if len(m) <= 1 {
-					if useScanner {
-						file.Close()
-					}
-					c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Expected '^<([^ >]+)[ >]' or '</itemList>' on line ` + strconv.Itoa(lineCount) + `: ` + line}
-					return
-				}
+			csvHeaders := normalAuditCSVHeaders(options, auditType, headers)
+			csvHeaders, csvRows := normalAuditCSVRows(options, auditType, hostname, originalHostname, agentid, pool, csvHeaders, headers, rows, itemLines)
 
-				if !csvFilePathHasAuditType {
-					csvFilePathHasAuditType = true
-					csvFilePath += auditType + ".csv"
-					csvFilePathTemp = csvFilePath + ".incomplete"
+			outputs = append(outputs, CSVWriteOutput{csvHeaders, GetFieldDescriptionsRow(options, auditType, csvHeaders), csvRows, csvFileTemp, csvFilePathTemp, csvFilePath, hostname + "-" + agentid + "-" + payload, auditType, xmlFileName, nil})
+		}
 
-					_, o_err := os.Stat(csvFilePath)
-					if !options.ForceReparse && !options.WipeOutput && !os.IsNotExist(o_err) {
-						if useScanner {
-							file.Close()
-						}
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Box + `NOTICE - Parsed audit for file '` + xmlFileName + `' already exists. Use '-f' flag to force reparse.`}
-						return
-					}
-					var err error
-					csvFileTemp, err = os.Create(csvFilePathTemp)
-					if err != nil {
-						if useScanner {
-							file.Close()
+	} else if (auditXMLStyle == AUDIT_EVENTBUFFER || auditXMLStyle == AUDIT_STATEAGENTINSPECTOR) && !es1.ExtraBool1 {
+
+		eventTypes := map[string]int{}   // map[EventType]EventTypeID
+		allHeaders := []map[string]int{} // [EventTypeID]map["ColumnHeader"]ColumnID
+		tables := [][][]RowValue{}       // [EventTypeID][Row][ColumnID]Value
+		row := []RowValue{}              // [ColumnID]Value
+		tableLines := [][]int{}          // [EventTypeID][Row]Line of the <eventItem> for '-praw'
+		hitRows := [][]string{}          // [Row]Indicator hit of an event for '-phits'
+		eventLine := 0
+
+		//Resume from the checkpoint of an earlier run which stopped in this file ('-pck')
+		var checkpointer *ParseCheckpointer
+		var resumed *ParseCheckpoint
+		openEventScanner := func(xmlFile XMLInput) (*bufio.Scanner, *int64) {
+			var offset int64
+			if options.ParseCheckpointMinutes > 0 {
+				xmlFileStat, _ := xmlFile.Stat()
+				var resumedTables *EventCheckpointTables
+				resumed, resumedTables = ReadEventParseCheckpoint(options, xmlFileName, xmlFileStat)
+				if resumed != nil {
+					if _, err_s := xmlFile.Seek(resumed.ByteOffset, io.SeekStart); err_s == nil {
+						eventTypes, allHeaders, tables, hitRows = resumedTables.EventTypes, resumedTables.Headers, resumedTables.Tables, resumedTables.HitRows
+						//Events resumed from a checkpoint have no line for '-praw'
+						for _, table := range tables {
+							tableLines = append(tableLines, make([]int, len(table)))
 						}
-						csvFileTemp.Close()
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Could not create file '` + csvFilePathTemp + `'. ` + err.Error()}
-						return
+						offset = resumed.ByteOffset
+						resumeNote = resumed.ResumeNote()
+					} else {
+						xmlFile.Seek(0, io.SeekStart)
+						resumed = nil
 					}
 				}
+				checkpointer = NewParseCheckpointer(options, xmlFileName, xmlFileStat, resumed)
+			}
+			//https://stackoverflow.com/questions/21124327/how-to-read-a-text-file-line-by-line-in-go-when-some-lines-are-long-enough-to-ca
+			return newOffsetScanner(xmlFile, offset, options.ParseLineBufferSize, anomalies.ScanLines(options.ParseLineBufferSize))
+		}
+		//Called at the start of each <eventItem>, once the events before it are in the tables
+		checkpointWarned := false
+		saveCheckpoint := func(lineCount int, byteOffset int64) {
+			if checkpointer == nil {
+				return
+			}
+			if err_c := checkpointer.SaveEvents(&EventCheckpointTables{eventTypes, allHeaders, tables, hitRows}, lineCount, byteOffset); err_c != nil && !checkpointWarned {
+				checkpointWarned = true
+				options.Log.Println(options.Warnbox + "WARNING - Could not save checkpoint of file '" + xmlFileName + "'. " + err_c.Error())
+			}
+		}
 
-				//Get AuditItem Attributes
-				mC := regAuditCreated.FindStringSubmatch(line)
-				mUID := regAuditUID.FindStringSubmatch(line)
-
-				if len(mC) > 1 {
-					add_value_to_row_normal("FireEyeGeneratedTime", mC[1], headerPathParts, headers, row, options, true, include_value)
-				}
-				if ExtraEnabled() {
-					include_value = ExtraFunc4(options, es1, es2, line, headerPathParts, headers, row, include_value)
-				} else if len(mUID) > 1 {
-					add_value_to_row_normal("Audit UID", mUID[1], headerPathParts, headers, row, options, true, include_value)
-				}
-				state = STATE_EXPECTING_FIELDOPEN_OR_AUDITITEMCLOSE
-				continue
+		if auditXMLStyle == AUDIT_EVENTBUFFER {
+			xmlFile, err_o := options.MemoryPayloads.Open(xmlFilePath)
+			if err_o != nil {
+				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. ` + err_o.Error(), nil}
+				return
 			}
 
-			if state == STATE_EXPECTING_FIELDOPEN_OR_AUDITITEMCLOSE || state == STATE_EXPECTING_AUDITITEMOPEN_OR_FIELDCLOSE {
-
-				if state == STATE_EXPECTING_AUDITITEMOPEN_OR_FIELDCLOSE {
-					//regFieldMLClose         := regexp.MustCompile(`^([^<^>]*)</([-_A-Za-z0-9]+)>$`)                  //  </httpHeader>
-					m := regFieldMLClose.FindStringSubmatch(line)
-					//Check if line is multi-line field close
-					if len(m) > 2 {
-						value := m[1]
-						header := m[2]
-						if strings.TrimSpace(value) != "" {
-							headerPathParts = headerPathParts[:len(headerPathParts)-1]
-							if header != multilineHeader {
-								c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. MultiLine Field Close '(.*)</([A-Za-z0-9]+)>$' Header ` + header + ` did not match Open Header '` + multilineHeader + `' on line ` + strconv.Itoa(lineCount) + `: ` + line}
-								return
-							}
-							add_value_to_row_normal(multilineHeader, value, headerPathParts, headers, row, options, false, include_value)
-							multilineHeader = ""
-							state = STATE_EXPECTING_FIELDOPEN_OR_AUDITITEMCLOSE
-							continue
-						}
-						//check if line is multi-line field mid
-					} else if !strings.Contains(line, "<") {
-						headerPathParts = headerPathParts[:len(headerPathParts)-1]
-						add_value_to_row_normal(multilineHeader, line+"\n", headerPathParts, headers, row, options, false, include_value)
-						state = STATE_EXPECTING_FIELDCLOSE
-						continue
-					}
-					//If line is not a multi-line field, it must be a new audit
-				}
-
-				//regAuditCloseORFieldSubClose := regexp.MustCompile(`^[ \t]*</([^ >]+)[ >]`)
-				m1 := regAuditCloseORFieldSubClose.FindStringSubmatch(line)
-				if len(m1) > 1 {
-					endTag := m1[1]
-					if options.Verbose > 3 {
-						fmt.Println("EndTag:      ", endTag, "HeaderPathParts:", headerPathParts)
-					}
-					//Check if end of row item
-					if len(headerPathParts) == 0 && endTag == auditType {
-						state = STATE_EXPECTING_AUDITITEMOPEN_OR_ITEMLISTCLOSE_OR_DEBUGOPEN
-						continue
-						//Check if end of field group
-					} else if len(headerPathParts) != 0 && endTag == headerPathParts[len(headerPathParts)-1] {
-						headerPathParts = headerPathParts[:len(headerPathParts)-1]
-						continue
-					} else {
-						if len(headerPathParts) == 0 {
-							if useScanner {
-								file.Close()
-							}
-							csvFileTemp.Close()
-							c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Expected AuditItem Close Tag '</` + auditType + `>' on line ` + strconv.Itoa(lineCount) + `: ` + line}
-							return
-						} else {
-							if useScanner {
-								file.Close()
-							}
-							csvFileTemp.Close()
-							c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Expected SubField Close Tag '</` + headerPathParts[len(headerPathParts)-1] + `>' on line ` + strconv.Itoa(lineCount) + `: ` + line}
-							return
-						}
-					}
-				}
-				//regFieldSLClose         := regexp.MustCompile(`^[ \t]*<([-_A-Za-z0-9]+) ?/>$`)                   //  <remoteIpAddress />
-				m2 := regFieldSLClose.FindStringSubmatch(line)
-				if len(m2) > 1 {
-					header := m2[1]
-					value := ""
-					add_value_to_row_normal(header, value, headerPathParts, headers, row, options, true, include_value)
-					continue
-				}
-
-				//regFieldSL              := regexp.MustCompile(`^[ \t]*<([-_A-Za-z0-9]+)>(.*)</[-_A-Za-z0-9]+>$`) //  <remoteIpAddress>10.34.155.235</remoteIpAddress>
-				m3 := regFieldSL.FindStringSubmatch(line)
-				if len(m3) > 2 {
-					header := m3[1]
-					value := m3[2]
-					add_value_to_row_normal(header, value, headerPathParts, headers, row, options, true, include_value)
-					continue
-				}
-
-				//regFieldMLOpenORFieldSubOpen          := regexp.MustCompile(`^[ \t]*<([-_A-Za-z0-9]+)>(.*)$`                   //  <httpHeader>POST /wsman HTTP/1.1
-				m4 := regFieldMLOpenORFieldSubOpen.FindStringSubmatch(line)
-				if len(m4) > 2 {
-					multilineHeader = m4[1]
-					value := m4[2]
-					if strings.TrimSpace(value) != "" {
-						add_value_to_row_normal(multilineHeader, value, headerPathParts, headers, row, options, true, include_value)
-						state = STATE_EXPECTING_FIELDCLOSE
-						continue
-					}
-					headerPathParts = append(headerPathParts, multilineHeader)
-					state = STATE_EXPECTING_AUDITITEMOPEN_OR_FIELDCLOSE
-					continue
-				}
-
-				//regFieldSubOpen         := regexp.MustCompile(`^[ \t]*<([-_A-Za-z0-9]+)>$`)
-				m5 := regFieldSubOpen.FindStringSubmatch(line)
-				if len(m5) > 1 {
-					header := m5[1]
-					headerPathParts = append(headerPathParts, header)
-					continue
-				}
-
-				errmsg := `Expected AuditItem Close Tag '</` + auditType + `>'`
-				if len(headerPathParts) == 0 {
-					errmsg = `Expected SubField Close Tag '</` + auditType + `>'`
-				}
-				if useScanner {
-					file.Close()
-				}
-				csvFileTemp.Close()
-				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. ` + errmsg + `, SingleLine Field Close '^[ \t]*<([-_A-Za-z0-9]+) ?/>$', SingleLine Field '^[ \t]*<([-_A-Za-z0-9]+)>(.*)</[-_A-Za-z0-9]+>$', MultiLine Field Open '^[ \t]*<([-_A-Za-z0-9]+)>(.+)$', or MultiLine SubField Open '^[ \t]*<([-_A-Za-z0-9]+)>$' on line ` + strconv.Itoa(lineCount) + `: ` + line}
-				return
-			}
-
-			if state == STATE_EXPECTING_FIELDCLOSE {
-				//regFieldMLClose         := regexp.MustCompile(`(.*)</([-_A-Za-z0-9]+)>$`)                        //</httpHeader>
-				m := regFieldMLClose.FindStringSubmatch(line)
-				if len(m) > 2 {
-					value := m[1]
-					header := m[2]
-					if header != multilineHeader {
-						if useScanner {
-							file.Close()
-						}
-						csvFileTemp.Close()
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. MultiLine Field Close '(.*)</([A-Za-z0-9]+)>$' Header ` + header + ` did not match Open Header '` + multilineHeader + `' on line ` + strconv.Itoa(lineCount) + `: ` + line}
-						return
-					}
-					add_value_to_row_normal(multilineHeader, value, headerPathParts, headers, row, options, false, include_value)
-					multilineHeader = ""
-					state = STATE_EXPECTING_FIELDOPEN_OR_AUDITITEMCLOSE
-				} else {
-					add_value_to_row_normal(multilineHeader, line+"\n", headerPathParts, headers, row, options, false, include_value)
-				}
-				continue
-
-			}
-
-			if state == STATE_EXPECTING_DEBUGCLOSE {
-				if strings.ToLower(strings.TrimSpace(line)) == "</debug>" {
-					//Finish up...
-					state = STATE_EXPECTING_AUDITITEMOPEN_OR_ITEMLISTCLOSE_OR_DEBUGOPEN
-				}
-				continue
-			}
-
-			if useScanner {
-				file.Close()
-			}
-			csvFileTemp.Close()
-			c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `INTERNAL ERROR - Could not parse file '` + xmlFileName + `'. Unexpected state ` + strconv.Itoa(state) + ` on line ` + strconv.Itoa(lineCount) + `: ` + line}
-			return
-
-		}
-		/*
-		   headers := map[string]int{} // map["ColumnHeader"]ColumnID
-		   rows := []map[int]string{}  // []map[ColumnID]"Value"
-		   row  := map[int]string{}    // map[ColumnID]"Value"
-		*/
-
-		if useScanner {
-			file.Close()
-		}
-
-		if len(rows) == 0 {
-			csvFileTemp.Close()
-			os.Remove(csvFilePathTemp)
-			c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `WARNING - File '` + xmlFileName + `' is empty.`}
-			return
-		}
-
-		csvHeaders := []string{}
-
-		//Add mandatory headers
-		for _, h := range options.Config.HeadersMandatory {
-			if _, exists := headers[h]; exists {
-				csvHeaders = append(csvHeaders, h)
-			} else {
-				csvHeaders = append(csvHeaders, h)
-			}
-		}
-
-		//Add optional headers if they exist
-		for _, h := range options.Config.HeadersOptional {
-			if _, exists := headers[h]; exists {
-				csvHeaders = append(csvHeaders, h)
-			}
-		}
-
-		//Get audit-specific config if it exists
-		configindex := -1
-		for i, c := range options.Config.AuditHeaderConfigs {
-			if strings.ToLower(c.ItemName) == strings.ToLower(auditType) {
-				configindex = i
-				break
-			}
-		}
-
-		//Add audit-specific header order
-		if configindex != -1 {
-			for _, h := range options.Config.AuditHeaderConfigs[configindex].HeaderOrder {
-				csvHeaders = append(csvHeaders, h)
-			}
-
-		}
-
-		//Add remaining headers if allowed
-		if !options.Config.OmitUnlisted {
-			remainingHeaders := []string{}
-			for h, _ := range headers {
-				found := false
-				for _, h2 := range csvHeaders {
-					if h2 == h {
-						found = true
-						break
-					}
-				}
-				if found {
-					continue
-				} else {
-					remainingHeaders = append(remainingHeaders, h)
-				}
-			}
-
-			//Case insensitive sort
-			sort.Slice(remainingHeaders, func(i, j int) bool {
-				return strings.ToLower(remainingHeaders[i]) < strings.ToLower(remainingHeaders[j])
-			})
-
-			//Remove specified headers
-			if configindex != -1 {
-				for _, h := range options.Config.AuditHeaderConfigs[configindex].HeadersOmitted {
-					for i, h2 := range remainingHeaders {
-						if h2 == h {
-							remainingHeaders = append(remainingHeaders[0:i], remainingHeaders[i+1:len(remainingHeaders)]...)
-						}
-					}
-				}
-			}
-
-			for _, h := range remainingHeaders {
-				csvHeaders = append(csvHeaders, h)
-			}
-		}
-
-		//Create rows
-		csvRows := [][]string{}
-		for _, row := range rows {
-			csvRow := make([]string, len(csvHeaders))
-			for i, header := range csvHeaders {
-				if header == "Hostname" {
-					csvRow[i] = hostname
-					continue
-				}
-				if header == "AgentID" {
-					csvRow[i] = agentid
-					continue
-				}
-				colID, exists1 := headers[header]
-				if !exists1 {
-					csvRow[i] = ""
-					continue
-				}
-				value, exists2 := row[colID]
-				if exists2 {
-					csvRow[i] = value.String()
-				}
-			}
-			csvRows = append(csvRows, csvRow)
-		}
-
-		//LOG file fix
-		if strings.ToLower(auditType) == "log" {
-			col_index_arg := -1
-			col_index_msg := -1
-			for i := 0; i < len(csvHeaders); i++ {
-				if csvHeaders[i] == "args.arg" {
-					col_index_arg = i
-					continue
-				} else if csvHeaders[i] == "msg" {
-					col_index_msg = i
-					continue
-				}
-			}
-			//If we found both expected headers, continue
-			if col_index_arg != -1 && col_index_msg != -1 {
-				csvHeaders = append(csvHeaders, "msg_full")
-				for i := 0; i < len(csvRows); i++ {
-					sep := "\n"
-					if options.ReplaceNewLineFeeds {
-						sep = "|"
-					}
-					args := strings.Split(csvRows[i][col_index_arg], sep)
-					msg := csvRows[i][col_index_msg]
-					for j := 0; j < len(args); j++ {
-						msg = strings.Replace(msg, "^"+strconv.Itoa(j+1), strings.TrimSuffix(args[j], "\r"), 1)
-					}
-					csvRows[i] = append(csvRows[i], msg)
-				}
-			}
-		}
-
-		//Truncate cell values to 32k if ExcelFriendly
-		if options.ExcelFriendly {
-			for i := 0; i < len(csvRows); i++ {
-				for j := 0; j < len(csvRows[0]); j++ {
-					if len(csvRows[i][j]) > 32000 {
-						csvRows[i][j] = csvRows[i][j][0:32000] + "..."
-					}
-				}
-			}
-		}
-
-		//Write file out with 1mil lines only if ExcelFriendly
-		if options.ExcelFriendly && len(csvRows) > 999999 {
-			csvFileTemp.Close()
-			splitfilepathtemp := filepath.Join(options.OutputPath, hostname+"-"+agentid+"-"+payload+"_spcsv1-"+auditType+".csv.incomplete")
-			splitfilepath := filepath.Join(options.OutputPath, hostname+"-"+agentid+"-"+payload+"_spcsv1-"+auditType+".csv")
-			var err_c error
-			csvFileTemp, err_c = os.Create(splitfilepathtemp)
-			if err_c != nil {
-				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not create temp split file '` + filepath.Base(splitfilepathtemp) + `' to normal file '` + filepath.Base(splitfilepath) + `'. ` + err_c.Error()}
-				return
-			}
-			csvout := csv.NewWriter(csvFileTemp)
-			for i := 0; i < len(csvRows); i += 999999 {
-				isLastChunk := i+999999 > len(csvRows)
-				if isLastChunk {
-					csvout.Write(csvHeaders)
-					csvout.WriteAll(csvRows[i:])
-					break
-				}
-				csvout.Write(csvHeaders)
-				csvout.WriteAll(csvRows[i : i+999999])
-				csvout.Flush()
-				csvFileTemp.Close()
-				err_r := os.Rename(splitfilepathtemp, splitfilepath)
-				if err_r != nil {
-					c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not rename temp file '` + filepath.Base(splitfilepathtemp) + `' to normal file '` + filepath.Base(splitfilepath) + `'. ` + err_r.Error()}
-					return
-				}
-
-				splitfilepathtemp = filepath.Join(options.OutputPath, hostname+"-"+agentid+"-"+payload+"_spcsv"+strconv.Itoa((i/999999)+2)+"-"+auditType+".csv.incomplete")
-				splitfilepath = filepath.Join(options.OutputPath, hostname+"-"+agentid+"-"+payload+"_spcsv"+strconv.Itoa((i/999999)+2)+"-"+auditType+".csv")
-				var err_c error
-				csvFileTemp, err_c = os.Create(splitfilepathtemp)
-				if err_c != nil {
-					c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not create temp split file '` + filepath.Base(splitfilepathtemp) + `' to normal file '` + filepath.Base(splitfilepath) + `'. ` + err_c.Error()}
-					return
-				}
-				csvout = csv.NewWriter(csvFileTemp)
-			}
-			csvout.Flush()
-			csvFileTemp.Close()
-			err_r := os.Rename(splitfilepathtemp, splitfilepath)
-			if err_r != nil {
-				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not rename temp file '` + filepath.Base(csvFilePathTemp) + `' to normal file '` + filepath.Base(csvFilePath) + `'. ` + err_r.Error()}
-				return
-			}
-			//Write entire file out not split at all
-		} else {
-			csvout := csv.NewWriter(csvFileTemp)
-			csvout.Write(csvHeaders)
-			csvout.WriteAll(csvRows)
-			csvout.Flush()
-			csvFileTemp.Close()
-			err_r := os.Rename(csvFilePathTemp, csvFilePath)
-			if err_r != nil {
-				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not rename temp file '` + filepath.Base(csvFilePathTemp) + `' to normal file '` + filepath.Base(csvFilePath) + `'. ` + err_r.Error()}
-				return
-			}
-		}
-
-	} else if (auditXMLStyle == AUDIT_EVENTBUFFER || auditXMLStyle == AUDIT_STATEAGENTINSPECTOR) && !es1.ExtraBool1 {
-
-		eventTypes := map[string]int{}   // map[EventType]EventTypeID
-		allHeaders := []map[string]int{} // [EventTypeID]map["ColumnHeader"]ColumnID
-		tables := [][][]RowValue{}       // [EventTypeID][Row][ColumnID]Value
-		row := []RowValue{}              // [ColumnID]Value
-
-		if auditXMLStyle == AUDIT_EVENTBUFFER {
-			xmlFile, err_o := os.Open(xmlFilePath)
-			if err_o != nil {
-				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. ` + err_o.Error()}
-				return
-			}
-
-			//https://stackoverflow.com/questions/21124327/how-to-read-a-text-file-line-by-line-in-go-when-some-lines-are-long-enough-to-ca
-			scanner := bufio.NewScanner(xmlFile)
-			buf := make([]byte, 0, 64*1024)
-			scanner.Buffer(buf, 1024*1024*20)
-			rowCount := 0
+			scanner, lineStart := openEventScanner(xmlFile)
+			lineCount := 0
 
 			regEventOpen := regexp.MustCompile(`^[ \t]*<eventItem.*>$`) //<eventItem sequence_num="1670535298" uid="6209762">
 			regEventOpenSN := regexp.MustCompile(`sequence_num="(\d+)"`)
@@ -1277,6 +1300,10 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 			STATE_FINISHED := 6
 
 			state := STATE_HEADER
+			if resumed != nil {
+				state = STATE_EXPECTING_EVENTOPEN_OR_END
+				lineCount = resumed.LineCount
+			}
 
 			eventType := ""
 			eventTypeID := -1
@@ -1286,27 +1313,44 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 			attr_sequence_num := ""
 			attr_ext1 := ""
 			attr_ext2 := ""
+			attr_hits := [][]string{}
+
+			//Set while skipping the rest of an event after an anomaly with the lenient '-pap' policy
+			resync := false
+			//Fails the file, or records the anomaly and returns true once the rest of the event will be skipped
+			anomaly := func(kind string, message string) bool {
+				if !anomalies.Continue(lineCount, kind, message) {
+					xmlFile.Close()
+					c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, ParseAnomalyError(options, kind, xmlFileName, message), nil}
+					return false
+				}
+				row = []RowValue{}
+				state = STATE_EXPECTING_EVENTOPEN_OR_END
+				resync = true
+				return true
+			}
 
 			//For every line in file
 			for scanner.Scan() {
-				rowCount++
+				lineCount++
+				anomalies.RecordTruncation(lineCount)
 				line := scanner.Text()
 				// <?xml version="1.0" encoding="UTF-8"?>
-				if state == STATE_HEADER && rowCount == 1 {
+				if state == STATE_HEADER && lineCount == 1 {
 					line = strings.TrimSpace(line)
 					if !strings.HasPrefix(line, "<?xml ") {
 						xmlFile.Close()
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Unexpected 1st Line: ` + line}
+						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Unexpected 1st Line: ` + line, nil}
 						return
 					}
 					continue
 				}
 				// <itemList generator="eventbuffer" generatorVersion="29.7.8" itemSchemaLocation="http://schemas.mandiant.com/2013/11/stateagentinspectoritem.xsd" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:noNamespaceSchemaLocation="http://schemas.mandiant.com/2013/11/stateagentinspectoritem.xsd">
-				if state == STATE_HEADER && rowCount == 2 {
+				if state == STATE_HEADER && lineCount == 2 {
 					line = strings.TrimSpace(line)
 					if !strings.HasPrefix(line, "<itemList ") {
 						xmlFile.Close()
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Unexpected 2nd Line: ` + line}
+						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Unexpected 2nd Line: ` + line, nil}
 						return
 					}
 					state = STATE_EXPECTING_EVENTOPEN_OR_END
@@ -1317,9 +1361,19 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 
 					if len(row) != 0 {
 						tables[eventTypeID] = append(tables[eventTypeID], row)
+						tableLines[eventTypeID] = append(tableLines[eventTypeID], eventLine)
+						hitRows = AppendEventHitRows(options, hitRows, attr_uid, attr_sequence_num, eventType, eventRowValue(row, allHeaders[eventTypeID], "EventBufferTime_"+eventType), attr_hits)
 					}
 					row = []RowValue{}
 
+					//Skip to the next event or the end of the item list
+					if resync {
+						if line != "</itemList>" && !regEventOpen.MatchString(line) {
+							continue
+						}
+						resync = false
+					}
+
 					//END
 					if line == "</itemList>" {
 						//Finish up...
@@ -1329,16 +1383,20 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 					//Check if <eventItem.*>
 					m := regEventOpen.FindStringSubmatch(line)
 					if len(m) < 1 {
-						xmlFile.Close()
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Expected '^[ \t]*<eventItem.*>' or '</itemList>' on line ` + strconv.Itoa(rowCount) + `: ` + line}
-						return
+						if !anomaly(ParseAnomalyUnexpectedTag, `Expected '^[ \t]*<eventItem.*>' or '</itemList>' on line `+strconv.Itoa(lineCount)+`: `+line) {
+							return
+						}
+						continue
 					}
+					eventLine = lineCount
+					saveCheckpoint(lineCount-1, *lineStart)
 
 					//Reset and get attributes
 					attr_uid = ""
 					attr_sequence_num = ""
 					attr_ext1 = ""
 					attr_ext2 = ""
+					attr_hits = nil
 					mSN := regEventOpenSN.FindStringSubmatch(line)
 					mUID := regEventOpenUID.FindStringSubmatch(line)
 					mHITS := regEventOpenHITS.FindStringSubmatch(line)
@@ -1349,25 +1407,9 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 						attr_uid = mUID[1]
 					}
 					if len(mHITS) > 1 {
-						temp := mHITS[1]
-						//Ex. "[f5565076-4567-4f91-bf69-2f654e245a20, 06743fce-d219-4945-bdc8-1bc34213c25c, 84b7dbf8-98e8-42fe-a3bc-5e48bacae0ab] [e5db9997-94b2-45ba-9ed4-3d5a8bb35717, 1bca5ad3-f24c-45f3-8bc8-9680cc0b59cb, c9cbda93-30e6-48f9-8000-c28b3fbc2786] [0b11c953-df78-42b4-ad10-2222d2367356, 3304e31d-ca63-49e5-b75c-dbae36ac0d18, c98f827b-bd27-4143-8f80-af9ae27a8134]"
-						temp = strings.Replace(temp, "] [", "|", -1)
-						temp = strings.Replace(temp, " ", "", -1)
-						temp = strings.Replace(temp, "]", "", -1)
-						temp = strings.Replace(temp, "[", "", -1)
-						ext1 := []string{}
-						ext2 := []string{}
-						//Now looks like: "f5565076-4567-4f91-bf69-2f654e245a20,06743fce-d219-4945-bdc8-1bc34213c25c,84b7dbf8-98e8-42fe-a3bc-5e48bacae0ab|e5db9997-94b2-45ba-9ed4-3d5a8bb35717,1bca5ad3-f24c-45f3-8bc8-9680cc0b59cb,c9cbda93-30e6-48f9-8000-c28b3fbc2786|0b11c953-df78-42b4-ad10-2222d2367356,3304e31d-ca63-49e5-b75c-dbae36ac0d18,c98f827b-bd27-4143-8f80-af9ae27a8134"
-						for _, ext1_item := range strings.Split(temp, "|") {
-							ext1 = append(ext1, `"`+strings.Split(ext1_item, ",")[0]+`"`)
-							tempdata := []string{}
-							for _, ext2_item := range strings.Split(ext1_item, ",") {
-								tempdata = append(tempdata, `"`+ext2_item+`"`)
-							}
-							ext2 = append(ext2, "["+strings.Join(tempdata, ",")+"]")
-						}
-						attr_ext1 = "[" + strings.Join(ext1, ",") + "]"
-						attr_ext2 = "[" + strings.Join(ext2, ",") + "]"
+						//Ex. "[f5565076-4567-4f91-bf69-2f654e245a20, 06743fce-d219-4945-bdc8-1bc34213c25c, 84b7dbf8-98e8-42fe-a3bc-5e48bacae0ab] [e5db9997-94b2-45ba-9ed4-3d5a8bb35717, 1bca5ad3-f24c-45f3-8bc8-9680cc0b59cb, c9cbda93-30e6-48f9-8000-c28b3fbc2786]"
+						attr_hits = ParseEventHits(mHITS[1])
+						attr_ext1, attr_ext2 = FormatEventHits(options, attr_hits)
 					}
 					state = STATE_EXPECTING_TYPEOPEN
 					continue
@@ -1376,9 +1418,10 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 				if state == STATE_EXPECTING_TYPEOPEN {
 					m := regTypeOpen.FindStringSubmatch(line)
 					if len(m) < 2 {
-						xmlFile.Close()
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Expected Event Type '^[ \t]*<([A-Za-z0-9]+)>' on line ` + strconv.Itoa(rowCount) + `: ` + line}
-						return
+						if !anomaly(ParseAnomalyUnexpectedTag, `Expected Event Type '^[ \t]*<([A-Za-z0-9]+)>' on line `+strconv.Itoa(lineCount)+`: `+line) {
+							return
+						}
+						continue
 					}
 					eventType = UpperCamelCase(m[1])
 					val, exists := eventTypes[eventType]
@@ -1386,6 +1429,7 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 						eventTypeID = len(eventTypes)
 						eventTypes[eventType] = eventTypeID
 						tables = append(tables, [][]RowValue{})
+						tableLines = append(tableLines, []int{})
 						allHeaders = append(allHeaders, map[string]int{})
 						allHeaders[eventTypeID]["Hostname"] = 0
 						allHeaders[eventTypeID]["AgentID"] = 1
@@ -1394,16 +1438,19 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 					}
 
 					if attr_uid != "" {
-						row = add_value_to_row_eventbuffer("UID", attr_uid, allHeaders[eventTypeID], row, options, true)
+						row = add_value_to_row_eventbuffer("UID", attr_uid, allHeaders[eventTypeID], row, options, pool, true)
 					}
 					if attr_sequence_num != "" {
-						row = add_value_to_row_eventbuffer("Sequence Number", attr_sequence_num, allHeaders[eventTypeID], row, options, true)
+						row = add_value_to_row_eventbuffer("Sequence Number", attr_sequence_num, allHeaders[eventTypeID], row, options, pool, true)
 					}
 					if attr_ext1 != "" {
-						row = add_value_to_row_eventbuffer(ExtraFunc7(options, 1), attr_ext1, allHeaders[eventTypeID], row, options, true)
+						row = add_value_to_row_eventbuffer(ExtraFunc7(options, 1), attr_ext1, allHeaders[eventTypeID], row, options, pool, true)
 					}
 					if attr_ext2 != "" {
-						row = add_value_to_row_eventbuffer(ExtraFunc7(options, 2), attr_ext2, allHeaders[eventTypeID], row, options, true)
+						row = add_value_to_row_eventbuffer(ExtraFunc7(options, 2), attr_ext2, allHeaders[eventTypeID], row, options, pool, true)
+					}
+					if len(attr_hits) != 0 && (options.ParseHits || options.ParseHitsCap > 0) {
+						row = add_value_to_row_eventbuffer(EventHitCountHeader, strconv.Itoa(len(attr_hits)), allHeaders[eventTypeID], row, options, pool, true)
 					}
 
 					state = STATE_EXPECTING_FIELDOPEN_OR_TYPECLOSE
@@ -1416,9 +1463,10 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 					if len(m1) > 1 {
 						eventCloseType := UpperCamelCase(m1[1])
 						if eventType != eventCloseType {
-							xmlFile.Close()
-							c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Event Type Close did not match '` + eventType + `' on line ` + strconv.Itoa(rowCount) + `: ` + line}
-							return
+							if !anomaly(ParseAnomalyUnexpectedTag, `Event Type Close did not match '`+eventType+`' on line `+strconv.Itoa(lineCount)+`: `+line) {
+								return
+							}
+							continue
 						}
 						state = STATE_EXPECTING_EVENTCLOSE
 						continue
@@ -1434,7 +1482,8 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 						if field == "Hostname" {
 							field = "DNSHostname"
 						}
-						row = add_value_to_row_eventbuffer(field, value, allHeaders[eventTypeID], row, options, true)
+						field = DisambiguateHeader(options, field)
+						row = add_value_to_row_eventbuffer(field, value, allHeaders[eventTypeID], row, options, pool, true)
 						state = STATE_EXPECTING_FIELDOPEN_OR_TYPECLOSE
 						continue
 					}
@@ -1450,7 +1499,8 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 						if field == "Hostname" {
 							field = "DNSHostname"
 						}
-						row = add_value_to_row_eventbuffer(field, value, allHeaders[eventTypeID], row, options, true)
+						field = DisambiguateHeader(options, field)
+						row = add_value_to_row_eventbuffer(field, value, allHeaders[eventTypeID], row, options, pool, true)
 						fieldType = field
 						state = STATE_EXPECTING_FIELDCLOSED
 						continue
@@ -1466,14 +1516,16 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 						if field == "Hostname" {
 							field = "DNSHostname"
 						}
-						row = add_value_to_row_eventbuffer(field, "", allHeaders[eventTypeID], row, options, true)
+						field = DisambiguateHeader(options, field)
+						row = add_value_to_row_eventbuffer(field, "", allHeaders[eventTypeID], row, options, pool, true)
 						state = STATE_EXPECTING_FIELDOPEN_OR_TYPECLOSE
 						continue
 					}
 
-					xmlFile.Close()
-					c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Expected Record Close '^[ \t]*<(/[A-Za-z0-9]+)>$', SingleLine Field '^[ \t]*<([A-Za-z0-9]+)>(.*)</[A-Za-z0-9]+>$', Closed SingleLine Field '', or MultiLine Field Open '^[ \t]*<([A-Za-z0-9]+)>(.*)' on line ` + strconv.Itoa(rowCount) + `: ` + line}
-					return
+					if !anomaly(ParseAnomalyUnexpectedTag, `Expected Record Close '^[ \t]*<(/[A-Za-z0-9]+)>$', SingleLine Field '^[ \t]*<([A-Za-z0-9]+)>(.*)</[A-Za-z0-9]+>$', Closed SingleLine Field '', or MultiLine Field Open '^[ \t]*<([A-Za-z0-9]+)>(.*)' on line `+strconv.Itoa(lineCount)+`: `+line) {
+						return
+					}
+					continue
 				}
 
 				if state == STATE_EXPECTING_FIELDCLOSED {
@@ -1488,14 +1540,17 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 						if field == "Hostname" {
 							field = "DNSHostname"
 						}
+						field = DisambiguateHeader(options, field)
 						if fieldType != field {
-							c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. MultiLine Field Type Close '(.*)</([A-Za-z0-9]+)>$' did not match '` + fieldType + `' on line ` + strconv.Itoa(rowCount) + `: ` + line}
-							return
+							if !anomaly(ParseAnomalyUnexpectedTag, `MultiLine Field Type Close '(.*)</([A-Za-z0-9]+)>$' did not match '`+fieldType+`' on line `+strconv.Itoa(lineCount)+`: `+line) {
+								return
+							}
+							continue
 						}
-						row = add_value_to_row_eventbuffer(field, value, allHeaders[eventTypeID], row, options, false)
+						row = add_value_to_row_eventbuffer(field, value, allHeaders[eventTypeID], row, options, pool, false)
 						state = STATE_EXPECTING_FIELDOPEN_OR_TYPECLOSE
 					} else {
-						row = add_value_to_row_eventbuffer(fieldType, line, allHeaders[eventTypeID], row, options, false)
+						row = add_value_to_row_eventbuffer(fieldType, line, allHeaders[eventTypeID], row, options, pool, false)
 						state = STATE_EXPECTING_FIELDCLOSED
 					}
 					continue
@@ -1509,27 +1564,30 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 						state = STATE_EXPECTING_EVENTOPEN_OR_END
 						continue
 					}
-					xmlFile.Close()
-					c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Expected Event Close '^[ \t]*</eventItem>$' on line ` + strconv.Itoa(rowCount) + `: ` + line}
+					if !anomaly(ParseAnomalyUnexpectedTag, `Expected Event Close '^[ \t]*</eventItem>$' on line `+strconv.Itoa(lineCount)+`: `+line) {
+						return
+					}
+					continue
+				}
+				if !anomaly(ParseAnomalyUnknownState, `Unexpected state `+strconv.Itoa(state)+` on line `+strconv.Itoa(lineCount)+`: `+line) {
 					return
 				}
-				xmlFile.Close()
-				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `INTERNAL ERROR - Could not parse file '` + xmlFileName + `'. Unexpected state ` + strconv.Itoa(state) + `on line ` + strconv.Itoa(rowCount) + `: ` + line}
-				return
 			}
 			xmlFile.Close()
+			if err_se := scanner.Err(); err_se != nil {
+				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, scannerLineError(options, xmlFileName, lineCount, err_se), nil}
+				return
+			}
 		} else {
 
-			xmlFile, err_o := os.Open(xmlFilePath)
+			xmlFile, err_o := options.MemoryPayloads.Open(xmlFilePath)
 			if err_o != nil {
-				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. - Could not open file '` + xmlFilePath + `'. ` + err_o.Error()}
+				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. - Could not open file '` + xmlFilePath + `'. ` + err_o.Error(), nil}
 				return
 			}
 
-			scanner := bufio.NewScanner(xmlFile)
-			buf := make([]byte, 0, 64*1024)
-			scanner.Buffer(buf, 1024*1024*20)
-			rowCount := 0
+			scanner, lineStart := openEventScanner(xmlFile)
+			lineCount := 0
 
 			regEventOpen := regexp.MustCompile(`^[ \t]*<eventItem.*>$`) // <eventItem sequence_num="1670535298" uid="6209762">
 			regEventOpenSN := regexp.MustCompile(`sequence_num="(\d+)"`)
@@ -1563,6 +1621,10 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 			STATE_FINISHED := 11
 
 			state := STATE_HEADER
+			if resumed != nil {
+				state = STATE_EXPECTING_EVENTOPEN_OR_END
+				lineCount = resumed.LineCount
+			}
 
 			eventType := ""
 			eventTypeID := -1
@@ -1571,30 +1633,47 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 			attr_sequence_num := ""
 			attr_ext1 := ""
 			attr_ext2 := ""
+			attr_hits := [][]string{}
 
 			field_timestamp := ""
 			field_name := ""
 
+			//Set while skipping the rest of an event after an anomaly with the lenient '-pap' policy
+			resync := false
+			//Fails the file, or records the anomaly and returns true once the rest of the event will be skipped
+			anomaly := func(kind string, message string) bool {
+				if !anomalies.Continue(lineCount, kind, message) {
+					xmlFile.Close()
+					c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, ParseAnomalyError(options, kind, xmlFileName, message), nil}
+					return false
+				}
+				row = []RowValue{}
+				state = STATE_EXPECTING_EVENTOPEN_OR_END
+				resync = true
+				return true
+			}
+
 			//For every line in file
 			for scanner.Scan() {
-				rowCount++
+				lineCount++
+				anomalies.RecordTruncation(lineCount)
 				line := scanner.Text()
 				// <?xml version="1.0" encoding="UTF-8"?>
-				if state == STATE_HEADER && rowCount == 1 {
+				if state == STATE_HEADER && lineCount == 1 {
 					line = strings.TrimSpace(line)
 					if !strings.HasPrefix(line, "<?xml ") {
 						xmlFile.Close()
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Unexpected 1st Line: ` + line}
+						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Unexpected 1st Line: ` + line, nil}
 						return
 					}
 					continue
 				}
 				// <itemList generator="eventbuffer" generatorVersion="29.7.8" itemSchemaLocation="http://schemas.mandiant.com/2013/11/stateagentinspectoritem.xsd" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:noNamespaceSchemaLocation="http://schemas.mandiant.com/2013/11/stateagentinspectoritem.xsd">
-				if state == STATE_HEADER && rowCount == 2 {
+				if state == STATE_HEADER && lineCount == 2 {
 					line = strings.TrimSpace(line)
 					if !strings.HasPrefix(line, "<itemList ") {
 						xmlFile.Close()
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Unexpected 2nd Line: ` + line}
+						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Unexpected 2nd Line: ` + line, nil}
 						return
 					}
 					state = STATE_EXPECTING_EVENTOPEN_OR_END
@@ -1605,9 +1684,19 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 
 					if len(row) != 0 {
 						tables[eventTypeID] = append(tables[eventTypeID], row)
+						tableLines[eventTypeID] = append(tableLines[eventTypeID], eventLine)
+						hitRows = AppendEventHitRows(options, hitRows, attr_uid, attr_sequence_num, eventType, eventRowValue(row, allHeaders[eventTypeID], "EventBufferTime_"+eventType), attr_hits)
 					}
 					row = []RowValue{}
 
+					//Skip to the next event or the end of the item list
+					if resync {
+						if line != "</itemList>" && !regEventOpen.MatchString(line) {
+							continue
+						}
+						resync = false
+					}
+
 					//END
 					if line == "</itemList>" {
 						//Finish up...
@@ -1617,16 +1706,20 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 					//regEventOpen     := regexp.MustCompile(`^[ \t]*<eventItem.*>$`)                         // <eventItem sequence_num="1670535298" uid="6209762">
 					m := regEventOpen.FindStringSubmatch(line)
 					if len(m) < 1 {
-						xmlFile.Close()
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Expected '^[ \t]*<eventItem.*>' or '</itemList>' on line ` + strconv.Itoa(rowCount) + `: ` + line}
-						return
+						if !anomaly(ParseAnomalyUnexpectedTag, `Expected '^[ \t]*<eventItem.*>' or '</itemList>' on line `+strconv.Itoa(lineCount)+`: `+line) {
+							return
+						}
+						continue
 					}
+					eventLine = lineCount
+					saveCheckpoint(lineCount-1, *lineStart)
 
 					//Reset and get attributes
 					attr_uid = ""
 					attr_sequence_num = ""
 					attr_ext1 = ""
 					attr_ext2 = ""
+					attr_hits = nil
 					field_timestamp = ""
 					mSN := regEventOpenSN.FindStringSubmatch(line)
 					mUID := regEventOpenUID.FindStringSubmatch(line)
@@ -1638,25 +1731,9 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 						attr_uid = mUID[1]
 					}
 					if len(mHITS) > 1 {
-						temp := mHITS[1]
-						//Ex. "[f5565076-4567-4f91-bf69-2f654e245a20, 06743fce-d219-4945-bdc8-1bc34213c25c, 84b7dbf8-98e8-42fe-a3bc-5e48bacae0ab] [e5db9997-94b2-45ba-9ed4-3d5a8bb35717, 1bca5ad3-f24c-45f3-8bc8-9680cc0b59cb, c9cbda93-30e6-48f9-8000-c28b3fbc2786] [0b11c953-df78-42b4-ad10-2222d2367356, 3304e31d-ca63-49e5-b75c-dbae36ac0d18, c98f827b-bd27-4143-8f80-af9ae27a8134]"
-						temp = strings.Replace(temp, "] [", "|", -1)
-						temp = strings.Replace(temp, " ", "", -1)
-						temp = strings.Replace(temp, "]", "", -1)
-						temp = strings.Replace(temp, "[", "", -1)
-						ext1 := []string{}
-						ext2 := []string{}
-						//Now looks like: "f5565076-4567-4f91-bf69-2f654e245a20,06743fce-d219-4945-bdc8-1bc34213c25c,84b7dbf8-98e8-42fe-a3bc-5e48bacae0ab|e5db9997-94b2-45ba-9ed4-3d5a8bb35717,1bca5ad3-f24c-45f3-8bc8-9680cc0b59cb,c9cbda93-30e6-48f9-8000-c28b3fbc2786|0b11c953-df78-42b4-ad10-2222d2367356,3304e31d-ca63-49e5-b75c-dbae36ac0d18,c98f827b-bd27-4143-8f80-af9ae27a8134"
-						for _, ext1_item := range strings.Split(temp, "|") {
-							ext1 = append(ext1, `"`+strings.Split(ext1_item, ",")[0]+`"`)
-							tempdata := []string{}
-							for _, ext2_item := range strings.Split(ext1_item, ",") {
-								tempdata = append(tempdata, `"`+ext2_item+`"`)
-							}
-							ext2 = append(ext2, "["+strings.Join(tempdata, ",")+"]")
-						}
-						attr_ext1 = "[" + strings.Join(ext1, ",") + "]"
-						attr_ext2 = "[" + strings.Join(ext2, ",") + "]"
+						//Ex. "[f5565076-4567-4f91-bf69-2f654e245a20, 06743fce-d219-4945-bdc8-1bc34213c25c, 84b7dbf8-98e8-42fe-a3bc-5e48bacae0ab] [e5db9997-94b2-45ba-9ed4-3d5a8bb35717, 1bca5ad3-f24c-45f3-8bc8-9680cc0b59cb, c9cbda93-30e6-48f9-8000-c28b3fbc2786]"
+						attr_hits = ParseEventHits(mHITS[1])
+						attr_ext1, attr_ext2 = FormatEventHits(options, attr_hits)
 					}
 					state = STATE_EXPECTING_TIMESTAMP
 					continue
@@ -1668,9 +1745,10 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 					if len(m) < 2 {
 						m2 := regTimestampClosed.FindStringSubmatch(line)
 						if len(m2) < 1 {
-							xmlFile.Close()
-							c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Expected Timestamp '^[ \t]*<timestamp>(.*)</timestamp>$' or '^[ \t]*<timestamp />$' on line ` + strconv.Itoa(rowCount) + `: ` + line}
-							return
+							if !anomaly(ParseAnomalyUnexpectedTag, `Expected Timestamp '^[ \t]*<timestamp>(.*)</timestamp>$' or '^[ \t]*<timestamp />$' on line `+strconv.Itoa(lineCount)+`: `+line) {
+								return
+							}
+							continue
 						}
 						field_timestamp = ""
 					} else {
@@ -1684,9 +1762,10 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 					//regType          := regexp.MustCompile(`^[ \t]*<eventType>(.*)</eventType>$`)           //  <eventType>dnsLookupEvent</eventType>
 					m := regType.FindStringSubmatch(line)
 					if len(m) < 2 {
-						xmlFile.Close()
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Expected Event Type '^[ \t]*<eventType>(.*)</eventType>$' on line ` + strconv.Itoa(rowCount) + `: ` + line}
-						return
+						if !anomaly(ParseAnomalyUnexpectedTag, `Expected Event Type '^[ \t]*<eventType>(.*)</eventType>$' on line `+strconv.Itoa(lineCount)+`: `+line) {
+							return
+						}
+						continue
 					}
 					eventType = UpperCamelCase(m[1])
 					val, exists := eventTypes[eventType]
@@ -1694,6 +1773,7 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 						eventTypeID = len(eventTypes)
 						eventTypes[eventType] = eventTypeID
 						tables = append(tables, [][]RowValue{})
+						tableLines = append(tableLines, []int{})
 						allHeaders = append(allHeaders, map[string]int{})
 						allHeaders[eventTypeID]["Hostname"] = 0
 						allHeaders[eventTypeID]["AgentID"] = 1
@@ -1702,19 +1782,22 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 					}
 
 					if attr_uid != "" {
-						row = add_value_to_row_eventbuffer("UID", attr_uid, allHeaders[eventTypeID], row, options, true)
+						row = add_value_to_row_eventbuffer("UID", attr_uid, allHeaders[eventTypeID], row, options, pool, true)
 					}
 					if attr_sequence_num != "" {
-						row = add_value_to_row_eventbuffer("Sequence Number", attr_sequence_num, allHeaders[eventTypeID], row, options, true)
+						row = add_value_to_row_eventbuffer("Sequence Number", attr_sequence_num, allHeaders[eventTypeID], row, options, pool, true)
 					}
 					if attr_ext1 != "" {
-						row = add_value_to_row_eventbuffer(ExtraFunc7(options, 1), attr_ext1, allHeaders[eventTypeID], row, options, true)
+						row = add_value_to_row_eventbuffer(ExtraFunc7(options, 1), attr_ext1, allHeaders[eventTypeID], row, options, pool, true)
 					}
 					if attr_ext2 != "" {
-						row = add_value_to_row_eventbuffer(ExtraFunc7(options, 2), attr_ext2, allHeaders[eventTypeID], row, options, true)
+						row = add_value_to_row_eventbuffer(ExtraFunc7(options, 2), attr_ext2, allHeaders[eventTypeID], row, options, pool, true)
+					}
+					if len(attr_hits) != 0 && (options.ParseHits || options.ParseHitsCap > 0) {
+						row = add_value_to_row_eventbuffer(EventHitCountHeader, strconv.Itoa(len(attr_hits)), allHeaders[eventTypeID], row, options, pool, true)
 					}
 					if field_timestamp != "" {
-						row = add_value_to_row_eventbuffer("EventBufferTime_"+eventType, field_timestamp, allHeaders[eventTypeID], row, options, true)
+						row = add_value_to_row_eventbuffer("EventBufferTime_"+eventType, field_timestamp, allHeaders[eventTypeID], row, options, pool, true)
 					}
 
 					state = STATE_EXPECTING_DETAILSOPEN
@@ -1725,9 +1808,10 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 					//regDetailsOpen   := regexp.MustCompile(`^[ \t]*<details>$`)                             //  <details>
 					m := regDetailsOpen.FindStringSubmatch(line)
 					if len(m) == 0 {
-						xmlFile.Close()
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Expected Details Open Tag '^[ \t]*<details>$' on line ` + strconv.Itoa(rowCount) + `: ` + line}
-						return
+						if !anomaly(ParseAnomalyUnexpectedTag, `Expected Details Open Tag '^[ \t]*<details>$' on line `+strconv.Itoa(lineCount)+`: `+line) {
+							return
+						}
+						continue
 					}
 					state = STATE_EXPECTING_DETAILOPEN_OR_DETAILSCLOSE
 					continue
@@ -1744,9 +1828,10 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 					//regDetailOpen    := regexp.MustCompile(`^[ \t]*<detail>$`)                              //   <detail>
 					m2 := regDetailOpen.FindStringSubmatch(line)
 					if len(m2) == 0 {
-						xmlFile.Close()
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Expected Details Open Tag '^[ \t]*<details>$' or Details Close Tag '^[ \t]*</details>$' on line ` + strconv.Itoa(rowCount) + `: ` + line}
-						return
+						if !anomaly(ParseAnomalyUnexpectedTag, `Expected Details Open Tag '^[ \t]*<details>$' or Details Close Tag '^[ \t]*</details>$' on line `+strconv.Itoa(lineCount)+`: `+line) {
+							return
+						}
+						continue
 					}
 					state = STATE_EXPECTING_DETAILNAME
 					continue
@@ -1757,14 +1842,16 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 					m := regName.FindStringSubmatch(line)
 
 					if len(m) < 2 {
-						xmlFile.Close()
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Expected Detail Name '^[ \t]*<name>(.*)</name>$ on line ` + strconv.Itoa(rowCount) + `: ` + line}
-						return
+						if !anomaly(ParseAnomalyUnexpectedTag, `Expected Detail Name '^[ \t]*<name>(.*)</name>$ on line `+strconv.Itoa(lineCount)+`: `+line) {
+							return
+						}
+						continue
 					}
 					field_name = UpperCamelCase(m[1])
 					if field_name == "Hostname" {
 						field_name = "DNSHostname"
 					}
+					field_name = DisambiguateHeader(options, field_name)
 					state = STATE_EXPECTING_DETAILVALUE
 					continue
 				}
@@ -1774,7 +1861,7 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 					m := regValueSL.FindStringSubmatch(line)
 					if len(m) == 2 {
 						value := m[1]
-						row = add_value_to_row_eventbuffer(field_name, value, allHeaders[eventTypeID], row, options, true)
+						row = add_value_to_row_eventbuffer(field_name, value, allHeaders[eventTypeID], row, options, pool, true)
 						field_name = ""
 						state = STATE_EXPECTING_DETAILCLOSE
 						continue
@@ -1783,7 +1870,7 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 					//regValueSLClosed := regexp.MustCompile(`^[ \t]*<value ?/>$`)                             //    <value />
 					m3 := regValueSLClosed.FindStringSubmatch(line)
 					if len(m3) == 1 {
-						row = add_value_to_row_eventbuffer(field_name, "", allHeaders[eventTypeID], row, options, true)
+						row = add_value_to_row_eventbuffer(field_name, "", allHeaders[eventTypeID], row, options, pool, true)
 						field_name = ""
 						state = STATE_EXPECTING_DETAILCLOSE
 						continue
@@ -1792,12 +1879,13 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 					//regValueMLOpen   := regexp.MustCompile(`^[ \t]*<value>(.*)$`)                           //    <value>POST /wsman HTTP/1.1
 					m2 := regValueMLOpen.FindStringSubmatch(line)
 					if len(m2) < 2 {
-						xmlFile.Close()
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Expected Detail Value SingleLine '^[ \t]*<value>(.*)</value>$' or MultiLine Open '^[ \t]*<value>(.*)$' on line ` + strconv.Itoa(rowCount) + `: ` + line}
-						return
+						if !anomaly(ParseAnomalyUnexpectedTag, `Expected Detail Value SingleLine '^[ \t]*<value>(.*)</value>$' or MultiLine Open '^[ \t]*<value>(.*)$' on line `+strconv.Itoa(lineCount)+`: `+line) {
+							return
+						}
+						continue
 					}
 					value := m2[1]
-					row = add_value_to_row_eventbuffer(field_name, value, allHeaders[eventTypeID], row, options, true)
+					row = add_value_to_row_eventbuffer(field_name, value, allHeaders[eventTypeID], row, options, pool, true)
 					state = STATE_EXPECTING_DETAILVALUECLOSE
 					continue
 				}
@@ -1806,12 +1894,12 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 					//regValueMLClose  := regexp.MustCompile(`^(.*)</value>$`)                                //</value>
 					m := regValueMLClose.FindStringSubmatch(line)
 					if len(m) == 0 {
-						row = add_value_to_row_eventbuffer(field_name, line, allHeaders[eventTypeID], row, options, false)
+						row = add_value_to_row_eventbuffer(field_name, line, allHeaders[eventTypeID], row, options, pool, false)
 						state = STATE_EXPECTING_DETAILVALUECLOSE
 						continue
 					}
 					value := m[1]
-					row = add_value_to_row_eventbuffer(field_name, value, allHeaders[eventTypeID], row, options, false)
+					row = add_value_to_row_eventbuffer(field_name, value, allHeaders[eventTypeID], row, options, pool, false)
 					state = STATE_EXPECTING_DETAILCLOSE
 					continue
 				}
@@ -1820,9 +1908,10 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 					//regDetailClose   := regexp.MustCompile(`^[ \t]*</detail>$`)                             //   </detail>
 					m := regDetailClose.FindStringSubmatch(line)
 					if len(m) == 0 {
-						xmlFile.Close()
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Expected Detail Close Tag '^[ \t]*</detail>$' on line ` + strconv.Itoa(rowCount) + `: ` + line}
-						return
+						if !anomaly(ParseAnomalyUnexpectedTag, `Expected Detail Close Tag '^[ \t]*</detail>$' on line `+strconv.Itoa(lineCount)+`: `+line) {
+							return
+						}
+						continue
 					}
 					state = STATE_EXPECTING_DETAILOPEN_OR_DETAILSCLOSE
 					continue
@@ -1833,30 +1922,43 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 					//regEventClose    := regexp.MustCompile(`^[ \t]*</eventItem>$`)                          // </eventItem>
 					m := regEventClose.FindStringSubmatch(line)
 					if len(m) == 0 {
-						xmlFile.Close()
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Expected Event Close Tag '^[ \t]*</eventItem>$' on line ` + strconv.Itoa(rowCount) + `: ` + line}
-						return
+						if !anomaly(ParseAnomalyUnexpectedTag, `Expected Event Close Tag '^[ \t]*</eventItem>$' on line `+strconv.Itoa(lineCount)+`: `+line) {
+							return
+						}
+						continue
 					}
 
 					state = STATE_EXPECTING_EVENTOPEN_OR_END
 					continue
 				}
 
-				xmlFile.Close()
-				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `INTERNAL ERROR - Could not parse file '` + xmlFileName + `'. Unexpected state ` + strconv.Itoa(state) + ` on line ` + strconv.Itoa(rowCount) + `: ` + line}
-				return
+				if !anomaly(ParseAnomalyUnknownState, `Unexpected state `+strconv.Itoa(state)+` on line `+strconv.Itoa(lineCount)+`: `+line) {
+					return
+				}
 			}
 			xmlFile.Close()
+			if err_se := scanner.Err(); err_se != nil {
+				c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, scannerLineError(options, xmlFileName, lineCount, err_se), nil}
+				return
+			}
 		}
 
 		//Create the split files
 		if len(tables) == 0 {
-			c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `WARNING - File '` + xmlFileName + `' is empty.`}
+			c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `WARNING - File '` + xmlFileName + `' is empty.`, nil}
 			return
 		}
 
 		for eventType, eventTypeID := range eventTypes {
 
+			//Event types which were already parsed are kept, like the output of other audits
+			csvFilePathEvent := filepath.Join(AuditOutputDir(options, "EventItem_"+eventType), filepath.Base(csvFilePath)+"EventItem_"+eventType+OutputFileExtension(options))
+			if !options.ParseInMemory && !options.ForceReparse && !options.WipeOutput {
+				if _, o_err := os.Stat(csvFilePathEvent); !os.IsNotExist(o_err) {
+					continue
+				}
+			}
+
 			headers := allHeaders[eventTypeID]
 			rows := tables[eventTypeID]
 
@@ -1871,6 +1973,11 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 				}
 			}
 
+			//Keep the original hostname if it was normalized
+			if HostnameNormalizationEnabled(options) {
+				csvHeaders = append(csvHeaders, "OriginalHostname")
+			}
+
 			//Add optional headers if they exist
 			for _, h := range options.Config.HeadersOptional {
 				if _, exists := headers[h]; exists {
@@ -1936,10 +2043,12 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 				}
 			}
 
-			//Create rows
-			csvRows := [][]string{csvHeaders}
+			//Create rows, redacting the columns of '-redact' rules
+			redactColumns := options.Redaction.RedactionColumns("EventItem_"+eventType, csvHeaders)
+			separator := GetMultiValueSeparator(options)
+			csvRows := NewRowTable(len(rows), len(csvHeaders))
 			for j, _ := range rows {
-				csvRow := make([]string, len(csvHeaders))
+				csvRow := csvRows[j]
 				for i, header := range csvHeaders {
 					if header == "EventBufferType" {
 						csvRow[i] = eventType
@@ -1949,6 +2058,10 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 						csvRow[i] = hostname
 						continue
 					}
+					if header == "OriginalHostname" {
+						csvRow[i] = originalHostname
+						continue
+					}
 					if header == "AgentID" {
 						csvRow[i] = agentid
 						continue
@@ -1965,7 +2078,12 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 						}
 					}
 				}
-				csvRows = append(csvRows, csvRow)
+				if redactColumns != nil {
+					options.Redaction.RedactRow(redactColumns, csvRow, separator)
+				}
+			}
+			if options.ParseRawXML {
+				csvHeaders, csvRows = AddRawXMLColumn(csvHeaders, csvRows, tableLines[eventTypeID])
 			}
 
 			//Truncate cell values to 32k if ExcelFriendly
@@ -1979,97 +2097,753 @@ func GoAuditParser_Thread(fileconfig Parse_Config_XMLFile, es1 ExtraStruct1, opt
 				}
 			}
 
-			//Write file out with 1mil lines only if ExcelFriendly
-			if options.ExcelFriendly && len(csvRows) > 999999 {
+			outputs = append(outputs, CSVWriteOutput{csvHeaders, GetFieldDescriptionsRow(options, "EventItem_"+eventType, csvHeaders), csvRows, nil, TempOutputPath(options, csvFilePathEvent), csvFilePathEvent, hostname + "-" + agentid + "-" + payload, "EventItem_" + eventType, xmlFileName, nil})
+		}
 
-				splitfilepathtemp := filepath.Join(options.OutputPath, hostname+"-"+agentid+"-"+payload+"_spcsv1-EventItem_"+eventType+".csv.incomplete")
-				splitfilepath := filepath.Join(options.OutputPath, hostname+"-"+agentid+"-"+payload+"_spcsv1-EventItem_"+eventType+".csv")
+		//One row per hit, so events with hundreds of indicators can be capped with '-phcap <int>' without losing any
+		for _, hitRow := range hitRows {
+			hitRow[0] = hostname
+			hitRow[1] = agentid
+		}
+		options.HitsLog.Add(hostname, agentid, RedactedInputName(options, xmlFileName), hitRows)
+		if len(hitRows) != 0 {
+			csvFilePathHits := filepath.Join(AuditOutputDir(options, EventHitsAuditType), filepath.Base(csvFilePath)+EventHitsAuditType+OutputFileExtension(options))
+			outputs = append(outputs, CSVWriteOutput{eventHitsHeaders, GetFieldDescriptionsRow(options, EventHitsAuditType, eventHitsHeaders), hitRows, nil, TempOutputPath(options, csvFilePathHits), csvFilePathHits, hostname + "-" + agentid + "-" + payload, EventHitsAuditType, xmlFileName, nil})
+		}
+	}
 
-				csvFileTemp, err_c := os.Create(splitfilepathtemp)
-				if err_c != nil {
-					c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not create temp split file '` + filepath.Base(splitfilepathtemp) + `' to normal file '` + filepath.Base(splitfilepath) + `'. ` + err_c.Error()}
-					return
+	//Keys joining the rows of processes with the events they caused ('-plink')
+	if options.ParseLinkKeys {
+		AddProcessKeyColumns(options, outputs)
+	}
+
+	//Column metrics for '-pdq', timestamp columns which mostly failed normalization are always warned about
+	quality := MeasureDataQuality(options, xmlFileName, outputs)
+	options.DataQualityLog.Add(quality)
+	countnote := DuplicateHeaderNote(outputs) + DataQualityNote(quality) + resumeNote + anomalies.Note()
+	options.ParseAnomalyLog.Add(anomalies)
+
+	//Rows '-pstream' wrote while parsing already had these steps applied batch by batch
+	suppressed, noted, tagged := streamSuppressed, streamNoted, streamTagged
+	if streamed == nil {
+		suppressed, noted, tagged = applyOutputRowSteps(options, agentid, payload, outputs)
+	}
+	if suppressed > 0 {
+		countnote += ` Suppressed ` + strconv.Itoa(suppressed) + ` allowlisted row(s).`
+	}
+	if tagged > 0 {
+		countnote += ` Tagged ` + strconv.Itoa(tagged) + ` row(s).`
+	}
+	if noted > 0 {
+		countnote += ` Added analyst notes to ` + strconv.Itoa(noted) + ` row(s).`
+	}
+
+	//Original XML of the noted rows for '-praw', read again only if a row was noted
+	if options.ParseRawXML {
+		if auditXMLStyle == AUDIT_EVENTBUFFER || auditXMLStyle == AUDIT_STATEAGENTINSPECTOR {
+			itemTag = "eventItem"
+		}
+		if resolved := ResolveRawXML(options, xmlFilePath, itemTag, outputs); resolved > 0 {
+			countnote += ` Added the raw XML of ` + strconv.Itoa(resolved) + ` noted row(s).`
+		}
+	}
+
+	//Collapse identical rows after the item count check, which needs every parsed row
+	if options.ParseDeduplicate {
+		collapsed := 0
+		for i := range outputs {
+			removed := 0
+			outputs[i].Headers, outputs[i].Rows, removed = DeduplicateRows(outputs[i].Headers, outputs[i].Rows)
+			if outputs[i].Desc != nil {
+				outputs[i].Desc = append(outputs[i].Desc, "Number of identical rows collapsed into this row ('-pdd').")
+			}
+			collapsed += removed
+		}
+		if collapsed > 0 {
+			countnote += ` Collapsed ` + strconv.Itoa(collapsed) + ` identical row(s).`
+		}
+	}
+
+	//Hand the CSV output off to the writer threads so the next file can start parsing
+	job := CSVWriteJob{threadNum, xmlFileName, xmlFileSize, outputs, countnote}
+	if writeQueue != nil {
+		writeQueue <- job
+		c_queued <- threadNum
+		return
+	}
+	c <- WriteCSVJob(options, job)
+}
+
+//applyOutputRowSteps adds the '-pcm' collection metadata columns, removes the rows of '-al' allowlists,
+//and adds '-tag' tags and '-notes' analyst notes to the rows of each output
+//Returns the number of rows suppressed, noted, and tagged
+func applyOutputRowSteps(options Options, agentid string, payload string, outputs []CSVWriteOutput) (int, int, int) {
+	//When the data was collected from metadata.json, for '-pcm'
+	if options.ParseCollectionMetadata {
+		if metadata, found := FindCollectionMetadata(options, agentid, payload); found {
+			for i := range outputs {
+				outputs[i].Headers, outputs[i].Rows = AddCollectionMetadataColumns(metadata, outputs[i].Headers, outputs[i].Rows)
+				if outputs[i].Desc != nil {
+					outputs[i].Desc = append(outputs[i].Desc, "Time the script was requested, from the triage package's metadata.json ('-pcm').", "Time the acquisition completed, from the triage package's metadata.json ('-pcm').")
 				}
-				csvout := csv.NewWriter(csvFileTemp)
-				for i := 0; i < len(csvRows); i += 999999 {
-					isLastChunk := i+999999 > len(csvRows)
-					if isLastChunk {
-						csvout.Write(csvHeaders)
-						csvout.WriteAll(csvRows[i:])
-						break
+			}
+		}
+	}
+
+	//Known-good rows of '-al' allowlists, before notes so excluded rows are not noted
+	suppressed := 0
+	if options.Allowlist != nil {
+		for i := range outputs {
+			headerCount := len(outputs[i].Headers)
+			removed := 0
+			outputs[i].Headers, outputs[i].Rows, removed = ApplyAllowlist(options, outputs[i].SplitSuffix, outputs[i].Headers, outputs[i].Rows)
+			if outputs[i].Desc != nil && len(outputs[i].Headers) > headerCount {
+				outputs[i].Desc = append(outputs[i].Desc, "Whether the row matched a known-good hash or path of the '-al' allowlist.")
+			}
+			suppressed += removed
+		}
+	}
+
+	//Tags of '-tag' rules, which note the columns they matched before the analyst notes
+	tagged := 0
+	if len(options.TagRules) > 0 {
+		for i := range outputs {
+			hostname, _ := SplitPrefixIdentity(outputs[i].SplitPrefix)
+			tagged += ApplyTagRules(options, hostname, outputs[i].SplitSuffix, outputs[i].Headers, outputs[i].Rows)
+		}
+	}
+
+	//Analyst notes from '-notes', before collapsing rows so rows with different notes are kept apart
+	noted := 0
+	if len(options.AnalystNotes) > 0 {
+		for i := range outputs {
+			noted += ApplyAnalystNotes(options, outputs[i].SplitSuffix, outputs[i].Headers, outputs[i].Rows)
+		}
+	}
+	return suppressed, noted, tagged
+}
+
+//normalAuditCSVHeaders orders the headers of a normal audit for its CSV file: the mandatory headers, the optional
+//headers found, the audit's "Header_Order", then the remaining headers unless "Omit_Nonordered_Headers" is set
+func normalAuditCSVHeaders(options Options, auditType string, headers map[string]int) []string {
+	csvHeaders := []string{}
+
+	//Add mandatory headers
+	for _, h := range options.Config.HeadersMandatory {
+		if _, exists := headers[h]; exists {
+			csvHeaders = append(csvHeaders, h)
+		} else {
+			csvHeaders = append(csvHeaders, h)
+		}
+	}
+
+	//Keep the original hostname if it was normalized
+	if HostnameNormalizationEnabled(options) {
+		csvHeaders = append(csvHeaders, "OriginalHostname")
+	}
+
+	//Add optional headers if they exist
+	for _, h := range options.Config.HeadersOptional {
+		if _, exists := headers[h]; exists {
+			csvHeaders = append(csvHeaders, h)
+		}
+	}
+
+	//Get audit-specific config if it exists
+	configindex := -1
+	for i, c := range options.Config.AuditHeaderConfigs {
+		if strings.ToLower(c.ItemName) == strings.ToLower(auditType) {
+			configindex = i
+			break
+		}
+	}
+
+	//Add audit-specific header order
+	if configindex != -1 {
+		for _, h := range options.Config.AuditHeaderConfigs[configindex].HeaderOrder {
+			csvHeaders = append(csvHeaders, h)
+		}
+
+	}
+
+	//Add remaining headers if allowed
+	if !options.Config.OmitUnlisted {
+		remainingHeaders := []string{}
+		for h, _ := range headers {
+			found := false
+			for _, h2 := range csvHeaders {
+				if h2 == h {
+					found = true
+					break
+				}
+			}
+			if found {
+				continue
+			} else {
+				remainingHeaders = append(remainingHeaders, h)
+			}
+		}
+
+		//Case insensitive sort
+		sort.Slice(remainingHeaders, func(i, j int) bool {
+			return strings.ToLower(remainingHeaders[i]) < strings.ToLower(remainingHeaders[j])
+		})
+
+		//Remove specified headers
+		if configindex != -1 {
+			for _, h := range options.Config.AuditHeaderConfigs[configindex].HeadersOmitted {
+				for i, h2 := range remainingHeaders {
+					if h2 == h {
+						remainingHeaders = append(remainingHeaders[0:i], remainingHeaders[i+1:len(remainingHeaders)]...)
 					}
-					csvout.Write(csvHeaders)
-					csvout.WriteAll(csvRows[i : i+999999])
-					csvout.Flush()
-					csvFileTemp.Close()
-					err_r := os.Rename(splitfilepathtemp, splitfilepath)
-					if err_r != nil {
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not rename temp file '` + filepath.Base(splitfilepathtemp) + `' to normal file '` + filepath.Base(splitfilepath) + `'. ` + err_r.Error()}
-						return
+				}
+			}
+		}
+
+		for _, h := range remainingHeaders {
+			csvHeaders = append(csvHeaders, h)
+		}
+	}
+
+	return csvHeaders
+}
+
+//normalAuditCSVRows builds the CSV rows of parsed audit items and runs the enrichments of the audit type, which may add columns
+//itemLines are the lines of the rows' audit items for '-praw'. csvHeaders is not changed, so it can be used for every batch of '-pstream'
+func normalAuditCSVRows(options Options, auditType string, hostname string, originalHostname string, agentid string, pool *ValuePool, csvHeaders []string, headers map[string]int, rows []map[int]*strings.Builder, itemLines []int) ([]string, [][]string) {
+	csvHeaders = append([]string{}, csvHeaders...)
+
+	//Create rows, redacting the columns of '-redact' rules
+	redactColumns := options.Redaction.RedactionColumns(auditType, csvHeaders)
+	separator := GetMultiValueSeparator(options)
+	csvRows := NewRowTable(len(rows), len(csvHeaders))
+	for j, row := range rows {
+		csvRow := csvRows[j]
+		for i, header := range csvHeaders {
+			if header == "Hostname" {
+				csvRow[i] = hostname
+				continue
+			}
+			if header == "OriginalHostname" {
+				csvRow[i] = originalHostname
+				continue
+			}
+			if header == "AgentID" {
+				csvRow[i] = agentid
+				continue
+			}
+			colID, exists1 := headers[header]
+			if !exists1 {
+				csvRow[i] = ""
+				continue
+			}
+			value, exists2 := row[colID]
+			if exists2 {
+				csvRow[i] = pool.Intern(value.String())
+			}
+		}
+		if redactColumns != nil {
+			options.Redaction.RedactRow(redactColumns, csvRow, separator)
+		}
+	}
+	if options.ParseRawXML {
+		csvHeaders, csvRows = AddRawXMLColumn(csvHeaders, csvRows, itemLines)
+	}
+
+	//LOG file fix
+	if strings.ToLower(auditType) == "log" {
+		col_index_arg := -1
+		col_index_msg := -1
+		for i := 0; i < len(csvHeaders); i++ {
+			if csvHeaders[i] == "args.arg" {
+				col_index_arg = i
+				continue
+			} else if csvHeaders[i] == "msg" {
+				col_index_msg = i
+				continue
+			}
+		}
+		//If we found both expected headers, continue
+		if col_index_arg != -1 && col_index_msg != -1 {
+			csvHeaders = append(csvHeaders, "msg_full")
+			for i := 0; i < len(csvRows); i++ {
+				sep := GetMultiValueSeparator(options)
+				if sep == "\r\n" {
+					sep = "\n"
+				}
+				args := strings.Split(csvRows[i][col_index_arg], sep)
+				msg := csvRows[i][col_index_msg]
+				for j := 0; j < len(args); j++ {
+					msg = strings.Replace(msg, "^"+strconv.Itoa(j+1), strings.TrimSuffix(args[j], "\r"), 1)
+				}
+				csvRows[i] = append(csvRows[i], msg)
+			}
+		}
+	}
+
+	//Syslog and ShellHistory activity enrichment
+	csvHeaders, csvRows = EnrichUnixActivity(auditType, csvHeaders, csvRows)
+
+	//Link quarantined files to their acquired payloads
+	csvHeaders, csvRows = EnrichQuarantine(options, auditType, csvHeaders, csvRows)
+
+	//Flatten PEInfo signature chains into signer/issuer columns
+	csvHeaders, csvRows = EnrichSignatureChains(options, auditType, csvHeaders, csvRows)
+
+	//Describe and filter event log entries by source and EID
+	csvHeaders, csvRows = EnrichEventKnowledge(options, auditType, csvHeaders, csvRows)
+
+	//Truncate cell values to 32k if ExcelFriendly
+	if options.ExcelFriendly {
+		for i := 0; i < len(csvRows); i++ {
+			for j := 0; j < len(csvRows[0]); j++ {
+				if len(csvRows[i][j]) > 32000 {
+					csvRows[i][j] = csvRows[i][j][0:32000] + "..."
+				}
+			}
+		}
+	}
+
+	return csvHeaders, csvRows
+}
+
+//normalAuditStart is where parseNormalAuditLines starts in a file
+type normalAuditStart struct {
+	InHeader  bool                       //Start at the XML header, otherwise at an audit item
+	LineCount int                        //Lines before the first line returned
+	Headers   map[string]int             //Headers and rows parsed before, if any
+	Rows      []map[int]*strings.Builder
+}
+
+//parseNormalAuditLines runs the normal audit state machine over the lines returned by next
+//onFirstItem is called when the first audit item opens and stops parsing if it returns a message
+//onItem, if not nil, is called with the rows parsed before each audit item opens and the number of lines before it,
+//and returns true if it took the rows, such as '-pstream' writing them, so they are dropped
+//onDebug, if not nil, is called with the message of each Debug block
+//Returns the headers, rows, number of lines read, and a message if the file could not be parsed
+func parseNormalAuditLines(options Options, es1 ExtraStruct1, es2 ExtraStruct2, next func() (string, bool), auditType string, xmlFileName string, xmlFilePath string, xmlFileSize int64, start normalAuditStart, anomalies *ParseAnomalies, onFirstItem func() string, onItem func(map[string]int, []map[int]*strings.Builder, int) bool, onRow func(int), onDebug func(AuditDebugEntry)) (map[string]int, []map[int]*strings.Builder, int, string) {
+	regAuditOpen := regexp.MustCompile(`^[ \t]*<([^ >]+)[ >]`)
+	regAuditCloseORFieldSubClose := regexp.MustCompile(`^[ \t]*</([^ >]+)>`)
+	regAuditCreated := regexp.MustCompile(`created="([^"]+)"`)
+	regAuditUID := regexp.MustCompile(`uid="([^"]+)"`)
+	//Items of '-ebs' files keep the attributes of their original event
+	regAuditSN := regexp.MustCompile(`sequence_num="(\d+)"`)
+	regAuditOldUID := regexp.MustCompile(`old_uid="([^"]+)"`)
+	regFieldSLClose := regexp.MustCompile(`^[ \t]*<([-_A-Za-z0-9]+) ?/>$`)               //  <remoteIpAddress />
+	regFieldSL := regexp.MustCompile(`^[ \t]*<([-_A-Za-z0-9]+)>(.*)</[-_A-Za-z0-9]+>$`)  //  <remoteIpAddress>10.34.155.235</remoteIpAddress>
+	regFieldMLOpenORFieldSubOpen := regexp.MustCompile(`^[ \t]*<([-_A-Za-z0-9]+)>(.*)$`) //  <httpHeader>POST /wsman HTTP/1.1
+	regFieldMLClose := regexp.MustCompile(`^([^<>]*)</([-_A-Za-z0-9]+)>$`)               //</httpHeader>
+	regFieldSubOpen := regexp.MustCompile(`^[ \t]*<([-_A-Za-z0-9]+)>$`)
+	regDebugTag := regexp.MustCompile(`</?[-_A-Za-z0-9]+ ?/?>`) //  <Message>
+
+	STATES := map[int]string{}
+	STATES[0] = "STATE_HEADER"
+	STATES[1] = "STATE_EXPECTING_AUDITITEMOPEN_OR_ITEMLISTCLOSE_OR_DEBUGOPEN"
+	STATES[2] = "STATE_EXPECTING_FIELDOPEN_OR_AUDITITEMCLOSE"
+	STATES[3] = "STATE_EXPECTING_AUDITITEMOPEN_OR_FIELDCLOSE"
+	STATES[4] = "STATE_EXPECTING_FIELDCLOSE"
+	STATES[5] = "STATE_FINISHED"
+	STATES[6] = "STATE_EXPECTING_DEBUGCLOSE"
+
+	STATE_HEADER := 0
+	STATE_EXPECTING_AUDITITEMOPEN_OR_ITEMLISTCLOSE_OR_DEBUGOPEN := 1
+	STATE_EXPECTING_FIELDOPEN_OR_AUDITITEMCLOSE := 2
+	STATE_EXPECTING_AUDITITEMOPEN_OR_FIELDCLOSE := 3
+	STATE_EXPECTING_FIELDCLOSE := 4
+	STATE_FINISHED := 5
+	STATE_EXPECTING_DEBUGCLOSE := 6
+
+	state := STATE_HEADER
+	if !start.InHeader {
+		state = STATE_EXPECTING_AUDITITEMOPEN_OR_ITEMLISTCLOSE_OR_DEBUGOPEN
+	}
+	firstItem := false
+
+	headers := map[string]int{}          // map["ColumnHeader"]ColumnID
+	rows := []map[int]*strings.Builder{} // []map[ColumnID]"Value"
+	row := map[int]*strings.Builder{}    // map[ColumnID]"Value"
+	if start.Headers != nil {
+		headers = start.Headers
+		rows = start.Rows
+	}
+
+	lineCount := start.LineCount
+
+	headerPathParts := []string{}
+
+	multilineHeader := ""
+	//Value of the open multi-line field, held so its middle lines are appended without finding its column again
+	var multilineValue *strings.Builder
+
+	include_value := true
+
+	debug := AuditDebugEntry{}
+	debugMessage := []string{}
+
+	//Line of the open tag of the current audit item, reported to onRow with its row
+	itemLine := 0
+
+	//Set while skipping the rest of an audit item after an anomaly with the lenient '-pap' policy
+	resync := false
+	//Returns the error of an anomaly, or "" once it is recorded and the rest of the audit item will be skipped
+	anomaly := func(kind string, message string) string {
+		if !anomalies.Continue(lineCount, kind, message) {
+			return ParseAnomalyError(options, kind, xmlFileName, message)
+		}
+		row = map[int]*strings.Builder{}
+		headerPathParts = []string{}
+		multilineHeader = ""
+		multilineValue = nil
+		state = STATE_EXPECTING_AUDITITEMOPEN_OR_ITEMLISTCLOSE_OR_DEBUGOPEN
+		resync = true
+		return ""
+	}
+
+	var byteindex uint64 = 0
+	bytepadding := len(strconv.FormatInt(xmlFileSize, 10))
+	lastupdate := time.Now()
+
+	//For every line in file
+	for {
+
+		if options.Verbose > 2 && time.Now().After(lastupdate.Add(time.Second*5)) {
+			lastupdate = time.Now()
+			fmt.Printf(options.Box+time.Now().Format("2006-01-02 15:04:05")+" - %"+strconv.Itoa(bytepadding)+"d/%s %6.2f%% "+filepath.Base(xmlFilePath)+"\n", byteindex, strconv.FormatInt(xmlFileSize, 10), (float32(byteindex)/float32(xmlFileSize))*100.0)
+		}
+
+		line, ok := next()
+		if !ok {
+			break
+		}
+		byteindex += uint64(len(line))
+		line = strings.TrimSuffix(line, "\r")
+		lineCount++
+		anomalies.RecordTruncation(lineCount)
+
+		if options.Verbose > 3 {
+			fmt.Println("==========================")
+			fmt.Println("File Name:       ", xmlFileName)
+			fmt.Println("File Progress:   ", fmt.Sprintf("%d/%s %6.2f%%", byteindex, strconv.FormatInt(xmlFileSize, 10), (float32(byteindex)/float32(xmlFileSize))*100.0))
+			fmt.Println("Line Number:     ", lineCount)
+			fmt.Println("State:           ", state, STATES[state])
+			fmt.Println("Header Parts:    ", strings.Join(headerPathParts, "."))
+			fmt.Println("MultiLine Header:", multilineHeader)
+			fmt.Println("Include Value:   ", include_value)
+			fmt.Println("Raw Line:        ", line)
+			uEnc := b64.URLEncoding.EncodeToString([]byte(line))
+			fmt.Println("Base64 Line:     ", uEnc)
+
+		}
+
+		// <?xml version="1.0" encoding="UTF-8"?>
+		if state == STATE_HEADER && lineCount == 1 {
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "<?xml ") {
+				return headers, rows, lineCount, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Unexpected 1st Line: ` + line
+			}
+			continue
+		}
+		// <itemList generator="eventbuffer" generatorVersion="29.7.8" itemSchemaLocation="http://schemas.mandiant.com/2013/11/stateagentinspectoritem.xsd" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:noNamespaceSchemaLocation="http://schemas.mandiant.com/2013/11/stateagentinspectoritem.xsd">
+		if state == STATE_HEADER && lineCount == 2 {
+			line = strings.ToLower(strings.TrimSpace(line))
+			if strings.HasPrefix(line, "<issuelist") {
+				return headers, rows, lineCount, options.Warnbox + `NOTICE - Issues file '` + xmlFileName + `' ignored.`
+			} else if !strings.HasPrefix(line, "<itemlist") {
+				return headers, rows, lineCount, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Unexpected 2nd Line: ` + line
+			}
+			state = STATE_EXPECTING_AUDITITEMOPEN_OR_ITEMLISTCLOSE_OR_DEBUGOPEN
+			continue
+		}
+
+		if state == STATE_EXPECTING_AUDITITEMOPEN_OR_ITEMLISTCLOSE_OR_DEBUGOPEN {
+
+			if es1.ExtraBool1 {
+				include_value = false
+			}
+
+			if len(row) != 0 {
+				rows = append(rows, row)
+				if onRow != nil {
+					onRow(itemLine)
+				}
+			}
+			row = map[int]*strings.Builder{}
+			headerPathParts = []string{}
+
+			comp := strings.ToLower(strings.TrimSpace(line))
+
+			//Skip to the next audit item, Debug item, or the end of the item list
+			if resync {
+				m := regAuditOpen.FindStringSubmatch(line)
+				if comp != "</itemlist>" && !strings.HasPrefix(comp, "<debug") && (len(m) <= 1 || m[1] != auditType) {
+					continue
+				}
+				resync = false
+			}
+
+			//END
+			if comp == "</itemlist>" {
+				//Finish up...
+				state = STATE_FINISHED
+				break
+			}
+			//DEBUG
+			// <Debug created="2020-10-05T18:01:05Z" uid="473bc9ba-fc52-437e-8610-1bf6c4aabd93">
+			//  <Message>
+			//Wow6432Node\Microsoft\Windows\CurrentVersion\Group Policy\State\Machine\Scripts\Startup: Registry key not found</Message>
+			// </Debug>
+			if strings.HasPrefix(comp, "<debug") {
+				debug = AuditDebugEntry{}
+				debugMessage = []string{}
+				if mC := regAuditCreated.FindStringSubmatch(line); len(mC) > 1 {
+					debug.Created = mC[1]
+					if !options.ParseRawTimestamps {
+						debug.Created = NormalizeTime(debug.Created)
+					}
+				}
+				if mUID := regAuditUID.FindStringSubmatch(line); len(mUID) > 1 {
+					debug.UID = mUID[1]
+				}
+				if strings.HasSuffix(comp, "/>") {
+					if onDebug != nil {
+						onDebug(debug)
 					}
+					continue
+				}
+				state = STATE_EXPECTING_DEBUGCLOSE
+				continue
+			}
+			//Check if audit type ^<([^ >]+)[ >]
+			m := regAuditOpen.FindStringSubmatch(line)
+			if len(m) <= 1 {
+				if msg := anomaly(ParseAnomalyUnexpectedTag, `Expected '^<([^ >]+)[ >]' or '</itemList>' on line `+strconv.Itoa(lineCount)+`: `+line); msg != "" {
+					return headers, rows, lineCount, msg
+				}
+				continue
+			}
 
-					splitfilepathtemp = filepath.Join(options.OutputPath, hostname+"-"+agentid+"-"+payload+"_spcsv"+strconv.Itoa((i/999999)+2)+"-EventItem_"+eventType+".csv.incomplete")
-					splitfilepath = filepath.Join(options.OutputPath, hostname+"-"+agentid+"-"+payload+"_spcsv"+strconv.Itoa((i/999999)+2)+"-EventItem_"+eventType+".csv")
-					var err_c error
-					csvFileTemp, err_c = os.Create(splitfilepathtemp)
-					if err_c != nil {
-						c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not create temp split file '` + filepath.Base(splitfilepathtemp) + `' to normal file '` + filepath.Base(splitfilepath) + `'. ` + err_c.Error()}
-						return
+			if !firstItem {
+				firstItem = true
+				if msg := onFirstItem(); msg != "" {
+					return headers, rows, lineCount, msg
+				}
+			}
+			if onItem != nil && onItem(headers, rows, lineCount-1) {
+				for i := range rows {
+					rows[i] = nil
+				}
+				rows = rows[:0]
+			}
+			itemLine = lineCount
+
+			//Get AuditItem Attributes
+			mC := regAuditCreated.FindStringSubmatch(line)
+			mUID := regAuditUID.FindStringSubmatch(line)
+
+			if len(mC) > 1 && include_value {
+				add_column_value_to_row_normal("FireEyeGeneratedTime", mC[1], headers, row, options, true)
+			}
+			if ExtraEnabled() {
+				include_value = ExtraFunc4(options, es1, es2, line, headerPathParts, headers, row, include_value)
+			} else if len(mUID) > 1 && include_value {
+				add_column_value_to_row_normal("Audit UID", mUID[1], headers, row, options, true)
+			}
+			if mOldUID := regAuditOldUID.FindStringSubmatch(line); len(mOldUID) > 1 && include_value {
+				add_column_value_to_row_normal("UID", mOldUID[1], headers, row, options, true)
+			}
+			if mSN := regAuditSN.FindStringSubmatch(line); len(mSN) > 1 && include_value {
+				add_column_value_to_row_normal("Sequence Number", mSN[1], headers, row, options, true)
+			}
+			state = STATE_EXPECTING_FIELDOPEN_OR_AUDITITEMCLOSE
+			continue
+		}
+
+		if state == STATE_EXPECTING_FIELDOPEN_OR_AUDITITEMCLOSE || state == STATE_EXPECTING_AUDITITEMOPEN_OR_FIELDCLOSE {
+
+			if state == STATE_EXPECTING_AUDITITEMOPEN_OR_FIELDCLOSE {
+				//regFieldMLClose         := regexp.MustCompile(`^([^<^>]*)</([-_A-Za-z0-9]+)>$`)                  //  </httpHeader>
+				m := regFieldMLClose.FindStringSubmatch(line)
+				//Check if line is multi-line field close
+				if len(m) > 2 {
+					value := m[1]
+					header := m[2]
+					if strings.TrimSpace(value) != "" {
+						headerPathParts = headerPathParts[:len(headerPathParts)-1]
+						if header != multilineHeader {
+							if msg := anomaly(ParseAnomalyUnexpectedTag, `MultiLine Field Close '(.*)</([A-Za-z0-9]+)>$' Header `+header+` did not match Open Header '`+multilineHeader+`' on line `+strconv.Itoa(lineCount)+`: `+line); msg != "" {
+								return headers, rows, lineCount, msg
+							}
+							continue
+						}
+						add_value_to_row_normal(multilineHeader, value, headerPathParts, headers, row, options, false, include_value)
+						multilineHeader = ""
+						state = STATE_EXPECTING_FIELDOPEN_OR_AUDITITEMCLOSE
+						continue
 					}
-					csvout = csv.NewWriter(csvFileTemp)
+					//check if line is multi-line field mid
+				} else if !strings.Contains(line, "<") {
+					headerPathParts = headerPathParts[:len(headerPathParts)-1]
+					multilineValue = add_value_to_row_normal(multilineHeader, line+"\n", headerPathParts, headers, row, options, false, include_value)
+					state = STATE_EXPECTING_FIELDCLOSE
+					continue
 				}
-				csvout.Flush()
-				csvFileTemp.Close()
-				err_r := os.Rename(splitfilepathtemp, splitfilepath)
-				if err_r != nil {
-					c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not rename temp file '` + filepath.Base(csvFilePathTemp) + `' to normal file '` + filepath.Base(csvFilePath) + `'. ` + err_r.Error()}
-					return
+				//If line is not a multi-line field, it must be a new audit
+			}
+
+			//regAuditCloseORFieldSubClose := regexp.MustCompile(`^[ \t]*</([^ >]+)[ >]`)
+			m1 := regAuditCloseORFieldSubClose.FindStringSubmatch(line)
+			if len(m1) > 1 {
+				endTag := m1[1]
+				if options.Verbose > 3 {
+					fmt.Println("EndTag:      ", endTag, "HeaderPathParts:", headerPathParts)
 				}
-				//Write entire file out not split at all
-			} else {
-				csvFilePathEvent := csvFilePath + "EventItem_" + eventType + ".csv"
-				csvFilePathEventTemp := csvFilePathEvent + ".incomplete"
+				//Check if end of row item
+				if len(headerPathParts) == 0 && endTag == auditType {
+					state = STATE_EXPECTING_AUDITITEMOPEN_OR_ITEMLISTCLOSE_OR_DEBUGOPEN
+					continue
+					//Check if end of field group
+				} else if len(headerPathParts) != 0 && endTag == headerPathParts[len(headerPathParts)-1] {
+					headerPathParts = headerPathParts[:len(headerPathParts)-1]
+					continue
+				} else {
+					expected := `Expected AuditItem Close Tag '</` + auditType + `>'`
+					if len(headerPathParts) != 0 {
+						expected = `Expected SubField Close Tag '</` + headerPathParts[len(headerPathParts)-1] + `>'`
+					}
+					if msg := anomaly(ParseAnomalyUnexpectedTag, expected+` on line `+strconv.Itoa(lineCount)+`: `+line); msg != "" {
+						return headers, rows, lineCount, msg
+					}
+					continue
+				}
+			}
+			//regFieldSLClose         := regexp.MustCompile(`^[ \t]*<([-_A-Za-z0-9]+) ?/>$`)                   //  <remoteIpAddress />
+			m2 := regFieldSLClose.FindStringSubmatch(line)
+			if len(m2) > 1 {
+				header := m2[1]
+				value := ""
+				add_value_to_row_normal(header, value, headerPathParts, headers, row, options, true, include_value)
+				continue
+			}
 
-				_, o_err := os.Stat(csvFilePath)
-				if !options.ForceReparse && !options.WipeOutput && !os.IsNotExist(o_err) {
+			//regFieldSL              := regexp.MustCompile(`^[ \t]*<([-_A-Za-z0-9]+)>(.*)</[-_A-Za-z0-9]+>$`) //  <remoteIpAddress>10.34.155.235</remoteIpAddress>
+			m3 := regFieldSL.FindStringSubmatch(line)
+			if len(m3) > 2 {
+				header := m3[1]
+				value := m3[2]
+				add_value_to_row_normal(header, value, headerPathParts, headers, row, options, true, include_value)
+				continue
+			}
+
+			//regFieldMLOpenORFieldSubOpen          := regexp.MustCompile(`^[ \t]*<([-_A-Za-z0-9]+)>(.*)$`                   //  <httpHeader>POST /wsman HTTP/1.1
+			m4 := regFieldMLOpenORFieldSubOpen.FindStringSubmatch(line)
+			if len(m4) > 2 {
+				multilineHeader = m4[1]
+				value := m4[2]
+				if strings.TrimSpace(value) != "" {
+					multilineValue = add_value_to_row_normal(multilineHeader, value, headerPathParts, headers, row, options, true, include_value)
+					state = STATE_EXPECTING_FIELDCLOSE
 					continue
 				}
+				headerPathParts = append(headerPathParts, multilineHeader)
+				state = STATE_EXPECTING_AUDITITEMOPEN_OR_FIELDCLOSE
+				continue
+			}
 
-				csvFileTemp, err_c := os.Create(csvFilePathEventTemp)
-				if err_c != nil {
-					c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. Could not create file '` + csvFilePathEventTemp + `'. ` + err_c.Error()}
-					return
+			//regFieldSubOpen         := regexp.MustCompile(`^[ \t]*<([-_A-Za-z0-9]+)>$`)
+			m5 := regFieldSubOpen.FindStringSubmatch(line)
+			if len(m5) > 1 {
+				header := m5[1]
+				headerPathParts = append(headerPathParts, header)
+				continue
+			}
+
+			errmsg := `Expected AuditItem Close Tag '</` + auditType + `>'`
+			if len(headerPathParts) == 0 {
+				errmsg = `Expected SubField Close Tag '</` + auditType + `>'`
+			}
+			if msg := anomaly(ParseAnomalyUnexpectedTag, errmsg+`, SingleLine Field Close '^[ \t]*<([-_A-Za-z0-9]+) ?/>$', SingleLine Field '^[ \t]*<([-_A-Za-z0-9]+)>(.*)</[-_A-Za-z0-9]+>$', MultiLine Field Open '^[ \t]*<([-_A-Za-z0-9]+)>(.+)$', or MultiLine SubField Open '^[ \t]*<([-_A-Za-z0-9]+)>$' on line `+strconv.Itoa(lineCount)+`: `+line); msg != "" {
+				return headers, rows, lineCount, msg
+			}
+			continue
+		}
+
+		if state == STATE_EXPECTING_FIELDCLOSE {
+			//Only a line ending with '>' can close the field, so the middle lines of huge fields skip the regex
+			//regFieldMLClose         := regexp.MustCompile(`(.*)</([-_A-Za-z0-9]+)>$`)                        //</httpHeader>
+			var m []string
+			if strings.HasSuffix(line, ">") {
+				m = regFieldMLClose.FindStringSubmatch(line)
+			}
+			if len(m) > 2 {
+				value := m[1]
+				header := m[2]
+				if header != multilineHeader {
+					if msg := anomaly(ParseAnomalyUnexpectedTag, `MultiLine Field Close '(.*)</([A-Za-z0-9]+)>$' Header `+header+` did not match Open Header '`+multilineHeader+`' on line `+strconv.Itoa(lineCount)+`: `+line); msg != "" {
+						return headers, rows, lineCount, msg
+					}
+					continue
 				}
+				add_value_to_row_normal(multilineHeader, value, headerPathParts, headers, row, options, false, include_value)
+				multilineHeader = ""
+				multilineValue = nil
+				state = STATE_EXPECTING_FIELDOPEN_OR_AUDITITEMCLOSE
+			} else if multilineValue != nil {
+				multilineValue.WriteString(normalize_value_normal(line+"\n", options))
+			} else {
+				multilineValue = add_value_to_row_normal(multilineHeader, line+"\n", headerPathParts, headers, row, options, false, include_value)
+			}
+			continue
 
-				csvout := csv.NewWriter(csvFileTemp)
-				csvout.WriteAll(csvRows)
-				csvout.Flush()
-				csvFileTemp.Close()
-				err_r := os.Rename(csvFilePathEventTemp, csvFilePathEvent)
-				if err_r != nil {
-					c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Warnbox + `ERROR - Could not rename temp file '` + filepath.Base(csvFilePathTemp) + `' to normal file '` + filepath.Base(csvFilePath) + `'. ` + err_r.Error()}
-					return
+		}
+
+		if state == STATE_EXPECTING_DEBUGCLOSE {
+			if strings.ToLower(strings.TrimSpace(line)) == "</debug>" {
+				//Finish up...
+				if onDebug != nil {
+					debug.Message = strings.Join(debugMessage, "\n")
+					onDebug(debug)
 				}
+				state = STATE_EXPECTING_AUDITITEMOPEN_OR_ITEMLISTCLOSE_OR_DEBUGOPEN
+				continue
 			}
+			//Keep the text of the Message element, its tags are on the same lines
+			if text := strings.TrimSpace(regDebugTag.ReplaceAllString(line, "")); text != "" {
+				debugMessage = append(debugMessage, text)
+			}
+			continue
+		}
 
+		if msg := anomaly(ParseAnomalyUnknownState, `Unexpected state `+strconv.Itoa(state)+` on line `+strconv.Itoa(lineCount)+`: `+line); msg != "" {
+			return headers, rows, lineCount, msg
 		}
+
 	}
-	c <- ThreadReturn_Parse{threadNum, xmlFileName, xmlFileSize, options.Box + `NOTICE - File '` + xmlFileName + `' parsed successfully.`}
+	return headers, rows, lineCount, ""
 }
 
-func add_value_to_row_normal(header string, value string, headerPathParts []string, headers map[string]int, row map[int]*strings.Builder, options Options, existingGetsNewLine bool, include_value bool) {
+//Returns the value of the column, or nil if the value was not included
+func add_value_to_row_normal(header string, value string, headerPathParts []string, headers map[string]int, row map[int]*strings.Builder, options Options, existingGetsNewLine bool, include_value bool) *strings.Builder {
 
 	if !include_value {
-		return
+		return nil
 	}
 
 	//Add path prefix to header
 	if len(headerPathParts) > 0 {
 		header = strings.Join(headerPathParts, ".") + "." + header
+	} else {
+		header = DisambiguateHeader(options, header)
 	}
+	return add_column_value_to_row_normal(header, value, headers, row, options, existingGetsNewLine)
+}
+
+//Formats a value as it is written to a row, converting timestamps and replacing new lines as requested
+func normalize_value_normal(value string, options Options) string {
 
 	//Check to see if value is timestamp
-	value = parse_time(value)
+	if !options.ParseRawTimestamps {
+		value = NormalizeTime(value)
+	}
 
 	//Check to see if new lines should be replaced
 	if options.ReplaceNewLineFeeds {
@@ -2078,6 +2852,14 @@ func add_value_to_row_normal(header string, value string, headerPathParts []stri
 		value = strings.Replace(value, "\n", newlinechar, -1)
 		value = strings.Replace(value, "\r", newlinechar, -1)
 	}
+	return value
+}
+
+//Adds a value to a column GoAuditParser fills itself, like "FireEyeGeneratedTime", without renaming it
+//Returns the value of the column
+func add_column_value_to_row_normal(header string, value string, headers map[string]int, row map[int]*strings.Builder, options Options, existingGetsNewLine bool) *strings.Builder {
+
+	value = normalize_value_normal(value, options)
 
 	//Check if header already exists
 	colID, headerExists := headers[header]
@@ -2088,26 +2870,26 @@ func add_value_to_row_normal(header string, value string, headerPathParts []stri
 	}
 
 	//Check if value already exists
-	_, valueExists := row[colID]
+	builder, valueExists := row[colID]
 	if valueExists {
 		if existingGetsNewLine {
-			if options.ReplaceNewLineFeeds {
-				value = "|" + value
-			} else {
-				value = "\r\n" + value
-			}
+			value = GetMultiValueSeparator(options) + value
 		}
-		row[colID].WriteString(value)
+		builder.WriteString(value)
 	} else {
-		row[colID] = &strings.Builder{}
-		row[colID].WriteString(value)
+		builder = &strings.Builder{}
+		builder.WriteString(value)
+		row[colID] = builder
 	}
+	return builder
 }
 
-func add_value_to_row_eventbuffer(header string, value string, headers map[string]int, row []RowValue, options Options, existingValueGetsNewLine bool) []RowValue {
+func add_value_to_row_eventbuffer(header string, value string, headers map[string]int, row []RowValue, options Options, pool *ValuePool, existingValueGetsNewLine bool) []RowValue {
 
 	//Check to see if value is timestamp
-	value = parse_time(value)
+	if !options.ParseRawTimestamps {
+		value = NormalizeTime(value)
+	}
 
 	//Check to see if new lines should be replaced
 	if options.ReplaceNewLineFeeds {
@@ -2130,11 +2912,7 @@ func add_value_to_row_eventbuffer(header string, value string, headers map[strin
 	for index, rowvalue := range row {
 		if rowvalue.colid == colID {
 			if existingValueGetsNewLine {
-				if options.ReplaceNewLineFeeds {
-					value = "|" + value
-				} else {
-					value = "\r\n" + value
-				}
+				value = GetMultiValueSeparator(options) + value
 			}
 			row[index].value += value
 			found = true
@@ -2146,23 +2924,110 @@ func add_value_to_row_eventbuffer(header string, value string, headers map[strin
 	if !found {
 		rowValue := RowValue{}
 		rowValue.colid = colID
-		rowValue.value = value
+		rowValue.value = pool.Intern(value)
 		row = append(row, rowValue)
 	}
 
 	return row
 }
 
-//Parses a time value
-func parse_time(timevalue string) string {
-	length := len(timevalue)
-	//2019-12-19T11:11:45.299Z
-	if (length == 23 || length == 24) && timevalue[4] == '-' && timevalue[7] == '-' && timevalue[13] == ':' && timevalue[16] == ':' && timevalue[19] == '.' {
-		return timevalue[0:10] + " " + timevalue[11:23]
+//Columns GoAuditParser fills itself besides the mandatory headers
+var generatedHeaders = map[string]bool{
+	"OriginalHostname":     true,
+	"FireEyeGeneratedTime": true,
+	"Audit UID":            true,
+	"UID":                  true,
+	"Sequence Number":      true,
+	"EventBufferType":      true,
+}
+
+//Ordinal suffix given to audit fields named like a column GoAuditParser fills itself
+const duplicateHeaderSuffix = " (2)"
+
+//DisambiguateHeader renames an audit field that collides with a column GoAuditParser fills itself, like "Hostname" to "Hostname (2)",
+//so its values are neither overwritten nor merged into that column
+func DisambiguateHeader(options Options, header string) string {
+	if generatedHeaders[header] {
+		return header + duplicateHeaderSuffix
+	}
+	for _, h := range options.Config.HeadersMandatory {
+		if h == header {
+			return header + duplicateHeaderSuffix
+		}
+	}
+	return header
+}
+
+//DuplicateHeaderNote returns a warning listing the renamed headers of the outputs, or "" if none were renamed
+func DuplicateHeaderNote(outputs []CSVWriteOutput) string {
+	renamed := map[string]bool{}
+	for _, output := range outputs {
+		for _, header := range output.Headers {
+			if strings.HasSuffix(header, duplicateHeaderSuffix) {
+				renamed[header] = true
+			}
+		}
+	}
+	if len(renamed) == 0 {
+		return ""
+	}
+	names := []string{}
+	for header := range renamed {
+		names = append(names, `'`+strings.TrimSuffix(header, duplicateHeaderSuffix)+`' to '`+header+`'`)
+	}
+	sort.Strings(names)
+	return ` WARNING - Duplicate header(s) collided with GoAuditParser columns and were renamed: ` + strings.Join(names, ", ") + `.`
+}
+
+//Columns which differ between otherwise identical items, so they are not compared by DeduplicateRows
+var deduplicateIgnoredHeaders = map[string]bool{
+	"UID":             true,
+	"Sequence Number": true,
+}
+
+//DeduplicateRows keeps the first of each set of identical rows and appends a "Count" column with the size of the set
+//Returns the new headers and rows, and the number of rows removed
+func DeduplicateRows(headers []string, rows [][]string) ([]string, [][]string, int) {
+	countHeader := "Count"
+	for _, header := range headers {
+		if header == countHeader {
+			countHeader += duplicateHeaderSuffix
+			break
+		}
+	}
+	compared := []int{}
+	for i, header := range headers {
+		if !deduplicateIgnoredHeaders[header] {
+			compared = append(compared, i)
+		}
+	}
+
+	uniqueRows := [][]string{}
+	counts := []int{}
+	index := map[[sha1.Size]byte]int{}
+	var key strings.Builder
+	for _, row := range rows {
+		key.Reset()
+		for _, i := range compared {
+			if i < len(row) {
+				key.WriteString(row[i])
+			}
+			key.WriteByte(0)
+		}
+		hash := sha1.Sum([]byte(key.String()))
+		if j, exists := index[hash]; exists {
+			counts[j]++
+			continue
+		}
+		index[hash] = len(uniqueRows)
+		uniqueRows = append(uniqueRows, row)
+		counts = append(counts, 1)
 	}
-	//2019-12-19T11:11:45Z
-	if (length == 19 || length == 20) && timevalue[4] == '-' && timevalue[7] == '-' && timevalue[13] == ':' && timevalue[16] == ':' {
-		return timevalue[0:10] + " " + timevalue[11:19]
+	for j := range uniqueRows {
+		for len(uniqueRows[j]) < len(headers) {
+			uniqueRows[j] = append(uniqueRows[j], "")
+		}
+		uniqueRows[j] = append(uniqueRows[j], strconv.Itoa(counts[j]))
 	}
-	return timevalue
+	return append(headers, countHeader), uniqueRows, len(rows) - len(uniqueRows)
 }
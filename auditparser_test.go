@@ -0,0 +1,80 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//Event log audit of gen-testdata whose messages are padded to thousands of lines, like the message of a huge event
+func benchmarkEventLogLines(items int, msgLines int) ([]string, int64) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	writeTestDataEventLogs(w, rand.New(rand.NewSource(1)), "BENCH-WKS001", items, msgLines)
+	w.Flush()
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"), int64(buf.Len())
+}
+
+func BenchmarkParseNormalAuditLines(b *testing.B) {
+	const items = 20
+	lines, size := benchmarkEventLogLines(items, 5000)
+	options := Options{Box: "[+] ", Warnbox: "[!] "}
+	firstItem := func() string { return "" }
+	b.SetBytes(size)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		line := 0
+		next := func() (string, bool) {
+			if line >= len(lines) {
+				return "", false
+			}
+			line++
+			return lines[line-1], true
+		}
+		_, rows, _, errmsg := parseNormalAuditLines(options, ExtraStruct1{}, ExtraStruct2{}, next, "EventLogItem", "bench-w32eventlogs.xml", "bench-w32eventlogs.xml", size, normalAuditStart{InHeader: true}, nil, firstItem, nil, nil, nil)
+		if errmsg != "" || len(rows) != items {
+			b.Fatalf("parsed %d of %d rows: %s", len(rows), items, errmsg)
+		}
+	}
+}
+
+func TestParseEventBufferLongLine(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	writeTestDataEventBuffer(w, rand.New(rand.NewSource(1)), "HOST-01", 5)
+	w.Flush()
+	lines := strings.Split(buf.String(), "\n")
+	//Line 10 is longer than the line buffer
+	lines[9] = "    <process>" + strings.Repeat("x", 8192) + "</process>"
+	path := filepath.Join(t.TempDir(), "HOST-01-bPlNFGdSC2wd8f2QnFhk5A-3ab439e73270ce54c3125a76987daa9f-eventbuffer.xml")
+	if err_w := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err_w != nil {
+		t.Fatal(err_w)
+	}
+	options, err_l := NewLibraryOptions(LibraryOptions{})
+	if err_l != nil {
+		t.Fatal(err_l)
+	}
+	options.ParseLineBufferSize = 4096
+	_, err_p := (&Parser{options}).ParseFile(path)
+	if err_p == nil {
+		t.Fatal("parsed a line longer than '-plb <int>'")
+	}
+	if !strings.Contains(err_p.Error(), "Line 10 is longer") || !strings.Contains(err_p.Error(), "'-plb <int>'") {
+		t.Errorf("error %q does not name line 10 and '-plb <int>'", err_p.Error())
+	}
+}
@@ -0,0 +1,370 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//ParseCheckpoint is the progress of a '-pck' parse through an XML file, written to "_GAPCheckpoints/<xml_file>.json"
+//The rows parsed before ByteOffset are appended to "_GAPCheckpoints/<xml_file>.rows" as one JSON object per line
+type ParseCheckpoint struct {
+	Version    string
+	Size       int64
+	ModTime    int64
+	Options    string //Parse options which change the parsed values, a checkpoint of other options is not resumed
+	ByteOffset int64  //Start of the line opening the next audit item
+	LineCount  int
+	RowCount   int
+	EventRows  map[string]int `json:",omitempty"` //Rows of each event type of an eventbuffer or stateagentinspector file
+	HitRows    int            `json:",omitempty"` //'-phits' rows of an eventbuffer or stateagentinspector file
+	Updated    string
+}
+
+//EventCheckpointTables are the events parsed from an eventbuffer or stateagentinspector file, which '-pck' saves and resumes
+type EventCheckpointTables struct {
+	EventTypes map[string]int   //map[EventType]EventTypeID
+	Headers    []map[string]int //[EventTypeID]map["ColumnHeader"]ColumnID
+	Tables     [][][]RowValue   //[EventTypeID][Row][ColumnID]Value
+	HitRows    [][]string
+}
+
+//One line of the rows file of an eventbuffer or stateagentinspector checkpoint, either an event or a '-phits' row
+type eventCheckpointRecord struct {
+	EventType string      `json:"t,omitempty"`
+	Values    [][2]string `json:"v,omitempty"`
+	Hit       []string    `json:"h,omitempty"`
+}
+
+//ParseCheckpointDir returns the directory checkpoints are kept in, next to the parse cache
+func ParseCheckpointDir(options Options) string {
+	return filepath.Join(filepath.Dir(ParseCachePath(options)), "_GAPCheckpoints")
+}
+
+func parseCheckpointPath(options Options, xmlFileName string) string {
+	return filepath.Join(ParseCheckpointDir(options), xmlFileName+".json")
+}
+
+func parseCheckpointRowsPath(options Options, xmlFileName string) string {
+	return filepath.Join(ParseCheckpointDir(options), xmlFileName+".rows")
+}
+
+//parseCheckpointOptions fingerprints every option which changes the values or headers of the parsed rows, so a checkpoint
+//saved with other options is not resumed. '-fast' is included as it implies '-rn' and raw timestamps
+func parseCheckpointOptions(options Options) string {
+	return strings.Join([]string{
+		strconv.FormatBool(options.FastMode),
+		strconv.FormatBool(options.ReplaceNewLineFeeds),
+		GetMultiValueSeparator(options),
+		strconv.FormatBool(options.ParseRawTimestamps),
+		options.ParseAnomalyPolicy,
+		strconv.Itoa(options.ParseLineBufferSize),
+		strings.Join(options.Config.HeadersMandatory, ","),
+		strconv.FormatBool(options.ParseHits),
+		strconv.Itoa(options.ParseHitsCap),
+		strconv.Itoa(len(eventHitsHeaders)),
+	}, "|")
+}
+
+//RemoveParseCheckpoint deletes the checkpoint of a file once it has been parsed
+func RemoveParseCheckpoint(options Options, xmlFileName string) {
+	if options.ParseCheckpointMinutes <= 0 {
+		return
+	}
+	os.Remove(parseCheckpointPath(options, xmlFileName))
+	os.Remove(parseCheckpointRowsPath(options, xmlFileName))
+	os.Remove(ParseCheckpointDir(options)) //Only removed once empty
+}
+
+//readParseCheckpoint returns the checkpoint of an XML file and calls record with each of its saved rows, or returns nil if there is none for this version of the file
+func readParseCheckpoint(options Options, xmlFileName string, xmlFile os.FileInfo, record func([]byte) bool) *ParseCheckpoint {
+	if options.ParseCheckpointMinutes <= 0 || options.ForceReparse {
+		return nil
+	}
+	b, err_r := ioutil.ReadFile(parseCheckpointPath(options, xmlFileName))
+	if err_r != nil {
+		return nil
+	}
+	checkpoint := &ParseCheckpoint{}
+	if err_j := json.Unmarshal(b, checkpoint); err_j != nil {
+		return nil
+	}
+	if checkpoint.Version != version || checkpoint.Size != xmlFile.Size() || checkpoint.ModTime != xmlFile.ModTime().Unix() || checkpoint.Options != parseCheckpointOptions(options) {
+		return nil
+	}
+
+	rowsFile, err_o := os.Open(parseCheckpointRowsPath(options, xmlFileName))
+	if err_o != nil {
+		return nil
+	}
+	defer rowsFile.Close()
+	scanner := bufio.NewScanner(rowsFile)
+	scanner.Buffer(newLineBuffer(options.ParseLineBufferSize), options.ParseLineBufferSize)
+	//Rows appended after the last checkpoint was saved are parsed again
+	read := 0
+	for read < checkpoint.RowCount && scanner.Scan() {
+		if !record(scanner.Bytes()) {
+			return nil
+		}
+		read++
+	}
+	if read < checkpoint.RowCount {
+		return nil
+	}
+	return checkpoint
+}
+
+//ReadParseCheckpoint returns the checkpoint of an XML file with its headers and rows, or nil if there is none for this version of the file
+func ReadParseCheckpoint(options Options, xmlFileName string, xmlFile os.FileInfo) (*ParseCheckpoint, map[string]int, []map[int]*strings.Builder) {
+	headers := map[string]int{}
+	rows := []map[int]*strings.Builder{}
+	checkpoint := readParseCheckpoint(options, xmlFileName, xmlFile, func(line []byte) bool {
+		values := [][2]string{}
+		if err_j := json.Unmarshal(line, &values); err_j != nil {
+			return false
+		}
+		row := map[int]*strings.Builder{}
+		for _, value := range values {
+			if _, exists := headers[value[0]]; !exists {
+				headers[value[0]] = len(headers)
+			}
+			builder := &strings.Builder{}
+			builder.WriteString(value[1])
+			row[headers[value[0]]] = builder
+		}
+		rows = append(rows, row)
+		return true
+	})
+	if checkpoint == nil {
+		return nil, nil, nil
+	}
+	return checkpoint, headers, rows
+}
+
+//ReadEventParseCheckpoint returns the checkpoint of an eventbuffer or stateagentinspector file with its events, or nil if there is none for this version of the file
+//Hostname and AgentID are columns 0 and 1 of every event type, like a new event type of the parsers
+func ReadEventParseCheckpoint(options Options, xmlFileName string, xmlFile os.FileInfo) (*ParseCheckpoint, *EventCheckpointTables) {
+	tables := &EventCheckpointTables{EventTypes: map[string]int{}}
+	checkpoint := readParseCheckpoint(options, xmlFileName, xmlFile, func(line []byte) bool {
+		record := eventCheckpointRecord{}
+		if err_j := json.Unmarshal(line, &record); err_j != nil {
+			return false
+		}
+		if record.Hit != nil {
+			tables.HitRows = append(tables.HitRows, record.Hit)
+			return true
+		}
+		eventTypeID, exists := tables.EventTypes[record.EventType]
+		if !exists {
+			eventTypeID = len(tables.EventTypes)
+			tables.EventTypes[record.EventType] = eventTypeID
+			tables.Tables = append(tables.Tables, [][]RowValue{})
+			tables.Headers = append(tables.Headers, map[string]int{"Hostname": 0, "AgentID": 1})
+		}
+		headers := tables.Headers[eventTypeID]
+		row := make([]RowValue, 0, len(record.Values))
+		for _, value := range record.Values {
+			if _, exists := headers[value[0]]; !exists {
+				headers[value[0]] = len(headers)
+			}
+			row = append(row, RowValue{headers[value[0]], value[1]})
+		}
+		tables.Tables[eventTypeID] = append(tables.Tables[eventTypeID], row)
+		return true
+	})
+	if checkpoint == nil {
+		return nil, nil
+	}
+	return checkpoint, tables
+}
+
+//ParseCheckpointer saves the progress of a parse every '-pck' minutes
+type ParseCheckpointer struct {
+	options     Options
+	xmlFileName string
+	checkpoint  ParseCheckpoint
+	headerNames map[int]string
+	lastSave    time.Time
+}
+
+//NewParseCheckpointer starts checkpointing an XML file, continuing a resumed checkpoint if there is one
+func NewParseCheckpointer(options Options, xmlFileName string, xmlFile os.FileInfo, resumed *ParseCheckpoint) *ParseCheckpointer {
+	checkpointer := &ParseCheckpointer{options, xmlFileName, ParseCheckpoint{version, xmlFile.Size(), xmlFile.ModTime().Unix(), parseCheckpointOptions(options), 0, 0, 0, nil, 0, ""}, map[int]string{}, time.Now()}
+	if resumed != nil {
+		checkpointer.checkpoint = *resumed
+	} else {
+		os.Remove(parseCheckpointRowsPath(options, xmlFileName))
+	}
+	return checkpointer
+}
+
+//due reports whether '-pck' minutes have passed since the last checkpoint, restarting the wait if they have
+func (checkpointer *ParseCheckpointer) due() bool {
+	if time.Since(checkpointer.lastSave) < time.Duration(checkpointer.options.ParseCheckpointMinutes)*time.Minute {
+		return false
+	}
+	checkpointer.lastSave = time.Now()
+	return true
+}
+
+//appendRows adds the lines written by write to the rows file of the checkpoint
+func (checkpointer *ParseCheckpointer) appendRows(write func(writer *bufio.Writer)) error {
+	if err_m := MkdirAllOutput(checkpointer.options, ParseCheckpointDir(checkpointer.options)); err_m != nil {
+		return err_m
+	}
+	rowsFile, err_o := OpenOutputFile(checkpointer.options, parseCheckpointRowsPath(checkpointer.options, checkpointer.xmlFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err_o != nil {
+		return err_o
+	}
+	writer := bufio.NewWriter(rowsFile)
+	write(writer)
+	err_w := writer.Flush()
+	if err_w == nil {
+		err_w = rowsFile.Sync()
+	}
+	rowsFile.Close()
+	return err_w
+}
+
+//commit records the offset of the next audit item once the rows before it are on disk
+func (checkpointer *ParseCheckpointer) commit(lineCount int, byteOffset int64) error {
+	checkpointer.checkpoint.ByteOffset = byteOffset
+	checkpointer.checkpoint.LineCount = lineCount
+	checkpointer.checkpoint.Updated = time.Now().UTC().Format("2006-01-02 15:04:05")
+	b, _ := json.MarshalIndent(checkpointer.checkpoint, "", "    ")
+	path := parseCheckpointPath(checkpointer.options, checkpointer.xmlFileName)
+	if err_w := WriteOutputFile(checkpointer.options, TempOutputPath(checkpointer.options, path), b, 0644); err_w != nil {
+		return err_w
+	}
+	return os.Rename(TempOutputPath(checkpointer.options, path), path)
+}
+
+//Save appends the rows parsed since the last checkpoint and records the offset of the next audit item, if it is time to
+//lineCount lines have been parsed and byteOffset is the start of the line after them
+func (checkpointer *ParseCheckpointer) Save(headers map[string]int, rows []map[int]*strings.Builder, lineCount int, byteOffset int64) error {
+	if !checkpointer.due() {
+		return nil
+	}
+	if len(checkpointer.headerNames) != len(headers) {
+		for name, id := range headers {
+			checkpointer.headerNames[id] = name
+		}
+	}
+
+	err_w := checkpointer.appendRows(func(writer *bufio.Writer) {
+		for _, row := range rows[checkpointer.checkpoint.RowCount:] {
+			values := make([][2]string, 0, len(row))
+			for id, value := range row {
+				values = append(values, [2]string{checkpointer.headerNames[id], value.String()})
+			}
+			b, _ := json.Marshal(values)
+			writer.Write(b)
+			writer.WriteString("\n")
+		}
+	})
+	if err_w != nil {
+		return err_w
+	}
+
+	//The rows are on disk before the checkpoint which counts them
+	checkpointer.checkpoint.RowCount = len(rows)
+	return checkpointer.commit(lineCount, byteOffset)
+}
+
+//SaveEvents appends the events and '-phits' rows parsed since the last checkpoint and records the offset of the next <eventItem>, if it is time to
+//lineCount lines have been parsed and byteOffset is the start of the line after them
+func (checkpointer *ParseCheckpointer) SaveEvents(tables *EventCheckpointTables, lineCount int, byteOffset int64) error {
+	if !checkpointer.due() {
+		return nil
+	}
+	if checkpointer.checkpoint.EventRows == nil {
+		checkpointer.checkpoint.EventRows = map[string]int{}
+	}
+
+	written := 0
+	err_w := checkpointer.appendRows(func(writer *bufio.Writer) {
+		for eventType, eventTypeID := range tables.EventTypes {
+			headerNames := map[int]string{}
+			for name, id := range tables.Headers[eventTypeID] {
+				headerNames[id] = name
+			}
+			for _, row := range tables.Tables[eventTypeID][checkpointer.checkpoint.EventRows[eventType]:] {
+				record := eventCheckpointRecord{EventType: eventType, Values: make([][2]string, 0, len(row))}
+				for _, value := range row {
+					record.Values = append(record.Values, [2]string{headerNames[value.colid], value.value})
+				}
+				b, _ := json.Marshal(record)
+				writer.Write(b)
+				writer.WriteString("\n")
+				written++
+			}
+		}
+		for _, hitRow := range tables.HitRows[checkpointer.checkpoint.HitRows:] {
+			b, _ := json.Marshal(eventCheckpointRecord{Hit: hitRow})
+			writer.Write(b)
+			writer.WriteString("\n")
+			written++
+		}
+	})
+	if err_w != nil {
+		return err_w
+	}
+
+	//The rows are on disk before the checkpoint which counts them
+	for eventType, eventTypeID := range tables.EventTypes {
+		checkpointer.checkpoint.EventRows[eventType] = len(tables.Tables[eventTypeID])
+	}
+	checkpointer.checkpoint.HitRows = len(tables.HitRows)
+	checkpointer.checkpoint.RowCount += written
+	return checkpointer.commit(lineCount, byteOffset)
+}
+
+//ResumeNote describes where a parse resumed from a checkpoint
+func (checkpoint *ParseCheckpoint) ResumeNote() string {
+	return ` Resumed from checkpoint at line ` + strconv.Itoa(checkpoint.LineCount+1) + ` with ` + strconv.Itoa(checkpoint.RowCount) + ` row(s).`
+}
+
+//newLineBuffer returns the initial read buffer of a line scanner whose lines are at most '-plb <int>' bytes
+//A scanner accepts lines up to the capacity of its buffer, so it starts at no more than the line buffer size
+func newLineBuffer(bufferSize int) []byte {
+	if bufferSize < 64*1024 {
+		return make([]byte, 0, bufferSize)
+	}
+	return make([]byte, 0, 64*1024)
+}
+
+//newOffsetScanner scans the lines of r, which starts at byte offset of its file
+//*lineStart is the byte offset of the line last returned by Scan, split may consume a line over several calls
+func newOffsetScanner(r io.Reader, offset int64, bufferSize int, split bufio.SplitFunc) (*bufio.Scanner, *int64) {
+	pos := offset
+	begin := offset
+	lineStart := new(int64)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(newLineBuffer(bufferSize), bufferSize)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := split(data, atEOF)
+		pos += int64(advance)
+		if token != nil {
+			*lineStart = begin
+			begin = pos
+		}
+		return advance, token, err
+	})
+	return scanner, lineStart
+}
@@ -0,0 +1,212 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//Smallest range of a file parsed by one '-pfw' worker
+const chunkedParseMinChunkSize = 8 * 1024 * 1024
+
+//UseChunkedParsing reports whether a normal audit of this size is parsed by several '-pfw' workers
+//Progress output of "-vvv" follows a single position in the file, so it always parses sequentially
+func UseChunkedParsing(options Options, xmlFileSize int64) bool {
+	return options.ParseFileWorkers > 1 && options.Verbose <= 2 && xmlFileSize >= 2*chunkedParseMinChunkSize
+}
+
+//ParseNormalAuditChunked splits a normal audit into ranges of whole audit items and parses them on several goroutines
+//The rows of each range are reassembled in file order, so the result is the same as parsing the file sequentially
+//Returns false if the file could not be split or a range could not be parsed, so it is parsed sequentially instead
+//and any error is reported with its exact line number. Ranges always use the strict '-pap' policy, so anomalies
+//are also recorded by the sequential parser
+func ParseNormalAuditChunked(options Options, es1 ExtraStruct1, es2 ExtraStruct2, xmlFilePath string, xmlFileName string, xmlFileSize int64, auditType string, onFirstItem func() string, onRow func(int), onDebug func(AuditDebugEntry)) (map[string]int, []map[int]*strings.Builder, string, bool) {
+	workers := options.ParseFileWorkers
+	if max := int(xmlFileSize / chunkedParseMinChunkSize); workers > max {
+		workers = max
+	}
+	boundaries := findChunkBoundaries(options, xmlFilePath, xmlFileSize, auditType, workers)
+	if len(boundaries) < 2 {
+		return nil, nil, "", false
+	}
+	if msg := onFirstItem(); msg != "" {
+		return nil, nil, msg, true
+	}
+	boundaries = append(boundaries, xmlFileSize)
+
+	type chunkResult struct {
+		headers map[string]int
+		rows    []map[int]*strings.Builder
+		debug   []AuditDebugEntry
+		lines   int   //Lines of the file in the range
+		rowLine []int //Line of each row's audit item, counted from the start of the range
+		failed  bool
+	}
+	results := make([]chunkResult, len(boundaries)-1)
+	noop := func() string { return "" }
+	var wg sync.WaitGroup
+	for i := 0; i < len(boundaries)-1; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			file, err_o := options.MemoryPayloads.Open(xmlFilePath)
+			if err_o != nil {
+				results[i].failed = true
+				return
+			}
+			defer file.Close()
+			if _, err_s := file.Seek(boundaries[i], io.SeekStart); err_s != nil {
+				results[i].failed = true
+				return
+			}
+			scanner := bufio.NewScanner(io.LimitReader(file, boundaries[i+1]-boundaries[i]))
+			scanner.Buffer(newLineBuffer(options.ParseLineBufferSize), options.ParseLineBufferSize)
+			//Every range but the last ends after an audit item, so close the item list for the state machine
+			closed := i == len(boundaries)-2
+			next := func() (string, bool) {
+				if scanner.Scan() {
+					return scanner.Text(), true
+				}
+				if !closed {
+					closed = true
+					return "</itemList>", true
+				}
+				return "", false
+			}
+			debug := []AuditDebugEntry{}
+			collectDebug := func(entry AuditDebugEntry) {
+				debug = append(debug, entry)
+			}
+			rowLine := []int{}
+			collectRow := func(line int) {
+				rowLine = append(rowLine, line)
+			}
+			headers, rows, lines, errmsg := parseNormalAuditLines(options, es1, es2, next, auditType, xmlFileName, xmlFilePath, xmlFileSize, normalAuditStart{InHeader: i == 0}, nil, noop, nil, collectRow, collectDebug)
+			if i != len(boundaries)-2 {
+				lines-- //The closing line added above
+			}
+			results[i] = chunkResult{headers, rows, debug, lines, rowLine, errmsg != "" || scanner.Err() != nil}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if result.failed {
+			if options.Verbose > 0 {
+				options.Log.Println(options.Warnbox + "NOTICE - Could not parse file '" + xmlFileName + "' in parallel. Parsing it sequentially.")
+			}
+			return nil, nil, "", false
+		}
+	}
+
+	//Debug blocks are reported in file order too
+	if onDebug != nil {
+		for _, result := range results {
+			for _, entry := range result.debug {
+				onDebug(entry)
+			}
+		}
+	}
+
+	//Lines of the audit items of the rows, offset by the lines of the ranges before them
+	if onRow != nil {
+		offset := 0
+		for _, result := range results {
+			for _, line := range result.rowLine {
+				onRow(offset + line)
+			}
+			offset += result.lines
+		}
+	}
+
+	//Reassemble the rows in order, renumbering the columns of each range by header name
+	headers := results[0].headers
+	rows := results[0].rows
+	for _, result := range results[1:] {
+		names := make([]string, 0, len(result.headers))
+		for name := range result.headers {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(a, b int) bool {
+			return result.headers[names[a]] < result.headers[names[b]]
+		})
+		columnIDs := map[int]int{}
+		for _, name := range names {
+			if _, exists := headers[name]; !exists {
+				headers[name] = len(headers)
+			}
+			columnIDs[result.headers[name]] = headers[name]
+		}
+		for _, row := range result.rows {
+			newRow := make(map[int]*strings.Builder, len(row))
+			for id, value := range row {
+				newRow[columnIDs[id]] = value
+			}
+			rows = append(rows, newRow)
+		}
+	}
+	return headers, rows, "", true
+}
+
+//Returns the byte offsets at which each worker starts parsing, beginning with 0
+//A range starts on the opening line of an audit item which directly follows the closing line of the previous one
+func findChunkBoundaries(options Options, xmlFilePath string, xmlFileSize int64, auditType string, workers int) []int64 {
+	file, err_o := options.MemoryPayloads.Open(xmlFilePath)
+	if err_o != nil {
+		return nil
+	}
+	defer file.Close()
+
+	//Only split item lists, anything else is reported by the sequential parser
+	scanner, lineStart := newOffsetScanner(file, 0, options.ParseLineBufferSize, bufio.ScanLines)
+	for i := 0; i < 2; i++ {
+		if !scanner.Scan() {
+			return nil
+		}
+	}
+	if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(scanner.Text())), "<itemlist") {
+		return nil
+	}
+
+	itemClose := "</" + auditType + ">"
+	boundaries := []int64{0}
+	for k := 1; k < workers; k++ {
+		offset := xmlFileSize * int64(k) / int64(workers)
+		if offset <= boundaries[len(boundaries)-1] {
+			continue
+		}
+		if _, err_s := file.Seek(offset, io.SeekStart); err_s != nil {
+			break
+		}
+		scanner, lineStart = newOffsetScanner(file, offset, options.ParseLineBufferSize, bufio.ScanLines)
+		//The first line may be partial
+		scanner.Scan()
+		found := false
+		previousClose := false
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if previousClose && (strings.HasPrefix(line, "<"+auditType+" ") || line == "<"+auditType+">") {
+				boundaries = append(boundaries, *lineStart)
+				found = true
+				break
+			}
+			previousClose = line == itemClose
+		}
+		if !found {
+			break
+		}
+	}
+	return boundaries
+}
@@ -0,0 +1,171 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//Columns added to every row by '-pcm'
+var CollectionMetadataColumns = []string{"ScriptRequestTime", "AcquisitionCompleteTime"}
+
+//metadata.json keys of the time the triage was requested and the time the acquisition finished. They are the
+//"req_timestamp" and "finish_time" of the triage acquisitions of the Endpoint Security (HX) API, "/hx/api/v3/acqs/triages"
+var collectionRequestKeys = []string{"req_timestamp"}
+var collectionCompleteKeys = []string{"finish_time"}
+
+//CollectionMetadata holds when the data of a triage package was collected, from its metadata.json
+type CollectionMetadata struct {
+	Archive                 string
+	Hostname                string
+	AgentID                 string
+	Payloads                []string
+	ScriptRequestTime       string
+	AcquisitionCompleteTime string
+}
+
+//ReadCollectionMetadataTimes returns the script request time and acquisition complete time of a metadata.json, "" if missing
+func ReadCollectionMetadataTimes(contents []byte) (string, string) {
+	var metadata interface{}
+	if err_j := json.Unmarshal(contents, &metadata); err_j != nil {
+		return "", ""
+	}
+	return findCollectionTime(metadata, collectionRequestKeys), findCollectionTime(metadata, collectionCompleteKeys)
+}
+
+//Returns the first time under one of the keys, searching nested objects in key order
+func findCollectionTime(value interface{}, keys []string) string {
+	object, isObject := value.(map[string]interface{})
+	if !isObject {
+		return ""
+	}
+	for _, key := range keys {
+		if s, isString := object[key].(string); isString {
+			if t, ok := ParseAcquisitionTime(s); ok {
+				return t.Format("2006-01-02 15:04:05")
+			}
+		}
+	}
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if found := findCollectionTime(object[name], keys); found != "" {
+			return found
+		}
+	}
+	return ""
+}
+
+//WriteCollectionMetadataCSV writes the collection times of a triage package to "<hostname>-<agentid>-<archive>-CollectionMetadata.csv"
+func WriteCollectionMetadataCSV(options Options, dir string, metadata CollectionMetadata) (string, error) {
+	headers := []string{"Tag", "Notes", "Hostname", "AgentID", "Archive", "Payloads", "ScriptRequestTime", "AcquisitionCompleteTime"}
+	hostname, fileHostname := RedactedSidecarHostname(options, metadata.Hostname)
+	archiveName := RedactedArchiveName(options, metadata.Archive, metadata.Hostname)
+	row := []string{"", "", hostname, metadata.AgentID, archiveName, strings.Join(metadata.Payloads, " "), metadata.ScriptRequestTime, metadata.AcquisitionCompleteTime}
+	options.Redaction.RedactRow(options.Redaction.RedactionColumns("CollectionMetadata", headers), row, GetMultiValueSeparator(options))
+
+	archive := strings.TrimSuffix(filepath.Base(archiveName), filepath.Ext(archiveName))
+	archive = strings.Replace(archive, "-", "_", -1)
+	csvPath := filepath.Join(dir, fileHostname+"-"+metadata.AgentID+"-"+archive+"-CollectionMetadata.csv")
+	csvFile, err_c := CreateOutputFile(options, csvPath)
+	if err_c != nil {
+		return csvPath, err_c
+	}
+	writer := csv.NewWriter(csvFile)
+	writer.WriteAll([][]string{headers, row})
+	csvFile.Close()
+	return csvPath, writer.Error()
+}
+
+//ReadCollectionMetadataCSVs reads the "CollectionMetadata" CSV files of the directories, by canonical Agent ID
+func ReadCollectionMetadataCSVs(ids *AgentIDs, dirs []string) map[string][]CollectionMetadata {
+	collections := map[string][]CollectionMetadata{}
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		if dir == "" || seen[filepath.Clean(dir)] {
+			continue
+		}
+		seen[filepath.Clean(dir)] = true
+		files, _ := ioutil.ReadDir(dir)
+		for _, file := range files {
+			if file.IsDir() || !strings.HasSuffix(file.Name(), "-CollectionMetadata.csv") {
+				continue
+			}
+			csvFile, err_o := os.Open(filepath.Join(dir, file.Name()))
+			if err_o != nil {
+				continue
+			}
+			records, err_r := csv.NewReader(csvFile).ReadAll()
+			csvFile.Close()
+			if err_r != nil || len(records) < 2 {
+				continue
+			}
+			columns := map[string]int{}
+			for i, header := range records[0] {
+				columns[header] = i
+			}
+			value := func(record []string, header string) string {
+				if i, exists := columns[header]; exists && i < len(record) {
+					return record[i]
+				}
+				return ""
+			}
+			for _, record := range records[1:] {
+				metadata := CollectionMetadata{value(record, "Archive"), value(record, "Hostname"), value(record, "AgentID"), strings.Fields(value(record, "Payloads")), value(record, "ScriptRequestTime"), value(record, "AcquisitionCompleteTime")}
+				metadata.AgentID, _ = ids.NormalizeAgentID(metadata.AgentID)
+				collections[metadata.AgentID] = append(collections[metadata.AgentID], metadata)
+			}
+		}
+	}
+	return collections
+}
+
+//FindCollectionMetadata returns the collection an audit payload of an agent came from
+//If the payload is not listed, such as with '-exf 2', the agent's latest collection is used
+func FindCollectionMetadata(options Options, agentid string, payload string) (CollectionMetadata, bool) {
+	collections := options.CollectionMetadata[agentid]
+	if len(collections) == 0 {
+		return CollectionMetadata{}, false
+	}
+	if i := strings.Index(payload, "_spxml"); i != -1 {
+		payload = payload[:i]
+	}
+	latest := collections[0]
+	for _, collection := range collections {
+		for _, p := range collection.Payloads {
+			if p == payload {
+				return collection, true
+			}
+		}
+		if collection.ScriptRequestTime > latest.ScriptRequestTime {
+			latest = collection
+		}
+	}
+	return latest, true
+}
+
+//AddCollectionMetadataColumns adds the '-pcm' collection time columns to every row
+func AddCollectionMetadataColumns(metadata CollectionMetadata, csvHeaders []string, csvRows [][]string) ([]string, [][]string) {
+	csvHeaders = append(csvHeaders, CollectionMetadataColumns...)
+	for i := range csvRows {
+		csvRows[i] = append(csvRows[i], metadata.ScriptRequestTime, metadata.AcquisitionCompleteTime)
+	}
+	return csvHeaders, csvRows
+}
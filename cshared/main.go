@@ -0,0 +1,104 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+//Build with 'go build -buildmode=c-shared -o libgoauditparser.so ./cshared' for Python, C#, and other languages
+//Every function takes and returns UTF-8 C strings. Returned strings are JSON and must be released with FreeString
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+    "encoding/json"
+    "strings"
+    "unsafe"
+
+    "github.com/fireeye/goauditparser"
+)
+
+//Raised only if an exported function is removed or changes its arguments or result
+//Keys added to the options or results do not change it
+const abiVersion = 1
+
+//Result of every exported function which does work, "error" is "" if "ok" is true
+type result struct {
+    OK    bool     `json:"ok"`
+    Error string   `json:"error"`
+    Files []string `json:"files"`
+}
+
+//Returns the result as a C string owned by the caller
+func cResult(files []string, err error) *C.char {
+    res := result{OK: err == nil, Files: files}
+    if res.Files == nil {
+        res.Files = []string{}
+    }
+    if err != nil {
+        res.Error = err.Error()
+    }
+    b, _ := json.Marshal(res)
+    return C.CString(string(b))
+}
+
+//Reads the JSON options, an empty string or "{}" keeps the CLI's defaults
+func libraryOptions(optionsJSON *C.char) (goauditparser.Options, error) {
+    lib := goauditparser.LibraryOptions{}
+    if text := strings.TrimSpace(C.GoString(optionsJSON)); text != "" {
+        if err_j := json.Unmarshal([]byte(text), &lib); err_j != nil {
+            return goauditparser.Options{}, err_j
+        }
+    }
+    return goauditparser.NewLibraryOptions(lib)
+}
+
+//ABIVersion returns the version of the exported functions, checked by bindings before calling anything else
+//export ABIVersion
+func ABIVersion() C.int {
+    return C.int(abiVersion)
+}
+
+//Version returns the version of GoAuditParser, release it with FreeString
+//export Version
+func Version() *C.char {
+    return C.CString(goauditparser.GetVersion())
+}
+
+//ParseFileToCSV parses one XML audit file into CSV file(s) in outputDir
+//Returns {"ok":true,"error":"","files":["<csv>",...]}, release it with FreeString
+//export ParseFileToCSV
+func ParseFileToCSV(xmlPath *C.char, outputDir *C.char, optionsJSON *C.char) *C.char {
+    options, err_o := libraryOptions(optionsJSON)
+    if err_o != nil {
+        return cResult(nil, err_o)
+    }
+    return cResult(goauditparser.GoAuditParser_ParseFileToCSV(C.GoString(xmlPath), C.GoString(outputDir), options))
+}
+
+//BuildTimeline timelines the CSV files of csvDir, outputFile may be "" for "<csv_dir>/_Timeline_<DATE>_<TIME>.csv"
+//Returns {"ok":true,"error":"","files":["<timeline>",...]}, release it with FreeString
+//export BuildTimeline
+func BuildTimeline(csvDir *C.char, outputFile *C.char, optionsJSON *C.char) *C.char {
+    options, err_o := libraryOptions(optionsJSON)
+    if err_o != nil {
+        return cResult(nil, err_o)
+    }
+    return cResult(goauditparser.GoAuditParser_BuildTimeline(C.GoString(csvDir), C.GoString(outputFile), options))
+}
+
+//FreeString releases a string returned by any of the functions above
+//export FreeString
+func FreeString(s *C.char) {
+    C.free(unsafe.Pointer(s))
+}
+
+//Required by -buildmode=c-shared, never called
+func main() {}
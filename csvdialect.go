@@ -0,0 +1,211 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+//CSVDialect describes how a CSV file was written, so CSV files resaved by Excel or edited by hand can still be read
+type CSVDialect struct {
+	Encoding  string //"UTF-8", "UTF-8 BOM", "UTF-16LE", "UTF-16BE", or "Windows-1252"
+	Delimiter rune
+	SepLine   bool //Excel "sep=;" first line
+}
+
+//String returns a short description such as "UTF-8 BOM, ';' delimited"
+func (dialect CSVDialect) String() string {
+	delimiter := string(dialect.Delimiter)
+	if dialect.Delimiter == '\t' {
+		delimiter = "tab"
+	}
+	return dialect.Encoding + ", '" + delimiter + "' delimited"
+}
+
+//IsDefault returns true if the file looks like it was written by GoAuditParser
+func (dialect CSVDialect) IsDefault() bool {
+	return dialect.Encoding == "UTF-8" && dialect.Delimiter == ',' && !dialect.SepLine
+}
+
+//Bytes peeked to detect the encoding and delimiter
+const csvDialectSniffSize = 64 * 1024
+
+//NewDialectCSVReader detects the byte order mark, encoding, and delimiter of a CSV file and returns a reader for it
+//Rows may have fewer or more fields than the headers, callers must check row lengths
+func NewDialectCSVReader(r io.Reader) (*csv.Reader, CSVDialect) {
+	lineReader, dialect := newDialectLineReader(r)
+	reader := csv.NewReader(lineReader)
+	reader.Comma = dialect.Delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	return reader, dialect
+}
+
+//Decode a CSV file to UTF-8 after its byte order mark and "sep=" line
+func newDialectLineReader(r io.Reader) (*bufio.Reader, CSVDialect) {
+	dialect := CSVDialect{Encoding: "UTF-8", Delimiter: ','}
+	buffered := bufio.NewReaderSize(r, csvDialectSniffSize)
+	var decoded io.Reader = buffered
+
+	bom, _ := buffered.Peek(3)
+	if bytes.HasPrefix(bom, []byte{0xEF, 0xBB, 0xBF}) {
+		dialect.Encoding = "UTF-8 BOM"
+		buffered.Discard(3)
+	} else if bytes.HasPrefix(bom, []byte{0xFF, 0xFE}) {
+		dialect.Encoding = "UTF-16LE"
+		buffered.Discard(2)
+		decoded = bufio.NewReader(&utf16Reader{src: buffered, bigEndian: false})
+	} else if bytes.HasPrefix(bom, []byte{0xFE, 0xFF}) {
+		dialect.Encoding = "UTF-16BE"
+		buffered.Discard(2)
+		decoded = bufio.NewReader(&utf16Reader{src: buffered, bigEndian: true})
+	} else {
+		sample, _ := buffered.Peek(csvDialectSniffSize)
+		if !csvValidUTF8Prefix(sample) {
+			dialect.Encoding = "Windows-1252"
+			decoded = bufio.NewReader(&windows1252Reader{src: buffered})
+		}
+	}
+
+	//Sniff the delimiter from the first line after the '-pprov comment' line
+	lineReader := bufio.NewReaderSize(decoded, csvDialectSniffSize)
+	skipProvenanceComment(lineReader)
+	firstLine, _ := lineReader.Peek(csvDialectSniffSize)
+	if i := bytes.IndexByte(firstLine, '\n'); i != -1 {
+		firstLine = firstLine[:i]
+	}
+	firstLine = bytes.TrimRight(firstLine, "\r")
+	if len(firstLine) == 5 && strings.EqualFold(string(firstLine[:4]), "sep=") {
+		dialect.SepLine = true
+		dialect.Delimiter = rune(firstLine[4])
+		lineReader.ReadString('\n')
+	} else {
+		dialect.Delimiter = csvSniffDelimiter(firstLine)
+	}
+	return lineReader, dialect
+}
+
+//Valid UTF-8, allowing a rune cut off at the end of the sample
+func csvValidUTF8Prefix(sample []byte) bool {
+	for len(sample) > 0 {
+		r, size := utf8.DecodeRune(sample)
+		if r == utf8.RuneError && size == 1 {
+			return !utf8.FullRune(sample) && len(sample) < utf8.UTFMax
+		}
+		sample = sample[size:]
+	}
+	return true
+}
+
+//The most common of ',', ';', '\t', and '|' outside of quotes in the header line, defaulting to ','
+func csvSniffDelimiter(line []byte) rune {
+	counts := map[byte]int{}
+	quoted := false
+	for _, b := range line {
+		if b == '"' {
+			quoted = !quoted
+		} else if !quoted && (b == ',' || b == ';' || b == '\t' || b == '|') {
+			counts[b]++
+		}
+	}
+	delimiter := byte(',')
+	for _, b := range []byte{';', '\t', '|'} {
+		if counts[b] > counts[delimiter] {
+			delimiter = b
+		}
+	}
+	return rune(delimiter)
+}
+
+//utf16Reader decodes UTF-16 to UTF-8
+type utf16Reader struct {
+	src       *bufio.Reader
+	bigEndian bool
+	pending   []byte
+}
+
+func (u *utf16Reader) readUnit() (uint16, error) {
+	var b [2]byte
+	_, err_r := io.ReadFull(u.src, b[:])
+	if err_r != nil {
+		return 0, err_r
+	}
+	if u.bigEndian {
+		return uint16(b[0])<<8 | uint16(b[1]), nil
+	}
+	return uint16(b[1])<<8 | uint16(b[0]), nil
+}
+
+func (u *utf16Reader) Read(p []byte) (int, error) {
+	for len(u.pending) < len(p) {
+		unit, err_r := u.readUnit()
+		if err_r != nil {
+			if len(u.pending) > 0 {
+				break
+			}
+			if err_r == io.ErrUnexpectedEOF {
+				err_r = io.EOF
+			}
+			return 0, err_r
+		}
+		r := rune(unit)
+		if utf16.IsSurrogate(r) {
+			low, err_l := u.readUnit()
+			if err_l != nil {
+				r = utf8.RuneError
+			} else {
+				r = utf16.DecodeRune(r, rune(low))
+			}
+		}
+		u.pending = append(u.pending, string(r)...)
+	}
+	n := copy(p, u.pending)
+	u.pending = u.pending[n:]
+	return n, nil
+}
+
+//Windows-1252 characters for bytes 0x80 to 0x9F, the rest match Latin-1
+var windows1252High = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+//windows1252Reader decodes Windows-1252, which Excel uses when saving "CSV (Comma delimited)" on Windows, to UTF-8
+type windows1252Reader struct {
+	src     *bufio.Reader
+	pending []byte
+}
+
+func (w *windows1252Reader) Read(p []byte) (int, error) {
+	for len(w.pending) < len(p) {
+		b, err_r := w.src.ReadByte()
+		if err_r != nil {
+			if len(w.pending) > 0 {
+				break
+			}
+			return 0, err_r
+		}
+		r := rune(b)
+		if b >= 0x80 && b <= 0x9F {
+			r = windows1252High[b-0x80]
+		}
+		w.pending = append(w.pending, string(r)...)
+	}
+	n := copy(p, w.pending)
+	w.pending = w.pending[n:]
+	return n, nil
+}
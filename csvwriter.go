@@ -0,0 +1,164 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+//CSVWriteOutput is a single parsed CSV file waiting to be written to disk
+type CSVWriteOutput struct {
+	Headers     []string
+	Desc        []string //Field descriptions row written under the headers, may be nil
+	Rows        [][]string
+	TempFile    *os.File //Already created temp file, may be nil
+	TempPath    string
+	Path        string
+	SplitPrefix string //"<hostname>-<agentid>-<payload>" used when splitting by 1mil rows
+	SplitSuffix string //"<audittype>" used when splitting by 1mil rows
+	Source      string //XML file the output was parsed from, recorded in the '-pmeta' sidecar and '-pprov comment' line
+	Streamed    *StreamedOutput //Rows '-pstream' already wrote while parsing, Rows is empty, may be nil
+}
+
+//RowCount returns the number of rows of the output, including those '-pstream' already wrote
+func (output CSVWriteOutput) RowCount() int {
+	if output.Streamed != nil {
+		return output.Streamed.Rows
+	}
+	return len(output.Rows)
+}
+
+//CSVWriteJob holds every CSV output parsed from one XML file
+type CSVWriteJob struct {
+	threadnum int
+	xmlfile   string
+	xmlsize   int64
+	outputs   []CSVWriteOutput
+	countnote string //Item count mismatch and duplicate header warnings appended to the success message
+}
+
+//GoAuditCSVWriter_Thread writes queued CSV jobs until the queue is closed
+func GoAuditCSVWriter_Thread(options Options, queue chan CSVWriteJob, c_written chan ThreadReturn_Parse) {
+	for job := range queue {
+		c_written <- WriteCSVJob(options, job)
+	}
+}
+
+//WriteCSVJob writes all outputs of a job and returns the final thread message for the XML file
+func WriteCSVJob(options Options, job CSVWriteJob) ThreadReturn_Parse {
+	for i, output := range job.outputs {
+		errmsg := WriteCSVOutput(options, output)
+		if errmsg != "" {
+			//Release any temp files that will not be written
+			for _, skipped := range job.outputs[i+1:] {
+				if skipped.Streamed != nil {
+					skipped.Streamed.Abort()
+				} else if skipped.TempFile != nil {
+					skipped.TempFile.Close()
+				}
+			}
+			return ThreadReturn_Parse{job.threadnum, job.xmlfile, job.xmlsize, options.Warnbox + errmsg, nil}
+		}
+	}
+	audits := []ParseAuditStat{}
+	for _, output := range job.outputs {
+		hostname, _ := SplitPrefixIdentity(output.SplitPrefix)
+		audits = append(audits, ParseAuditStat{hostname, output.SplitSuffix, output.RowCount()})
+	}
+	return ThreadReturn_Parse{job.threadnum, job.xmlfile, job.xmlsize, options.Box + `NOTICE - File '` + job.xmlfile + `' parsed successfully.` + job.countnote, audits}
+}
+
+//WriteCSVOutput writes a parsed file in the '-of' output format through its temp file, splitting by 1mil rows if ExcelFriendly
+func WriteCSVOutput(options Options, output CSVWriteOutput) string {
+	if output.Streamed != nil {
+		return output.Streamed.Finish(options, output)
+	}
+	//Files without a temp file yet may be routed to a subdirectory which does not exist
+	if output.TempFile == nil {
+		if err_m := MkdirAllOutput(options, filepath.Dir(output.Path)); err_m != nil {
+			return `ERROR - Could not create output directory '` + filepath.Dir(output.Path) + `'. ` + err_m.Error()
+		}
+	}
+
+	//Write file out with 1mil lines only if ExcelFriendly
+	if options.ExcelFriendly && len(output.Rows) > 999999 {
+		if output.TempFile != nil {
+			output.TempFile.Close()
+			os.Remove(output.TempPath)
+		}
+		for i := 0; i < len(output.Rows); i += 999999 {
+			splitfilepath := CSVSplitPath(options, output, (i/999999)+1)
+			splitfilepathtemp := TempOutputPath(options, splitfilepath)
+			end := i + 999999
+			if end > len(output.Rows) {
+				end = len(output.Rows)
+			}
+
+			csvFileTemp, err_c := CreateOutputFile(options, splitfilepathtemp)
+			if err_c != nil {
+				return `ERROR - Could not create temp split file '` + filepath.Base(splitfilepathtemp) + `' to normal file '` + filepath.Base(splitfilepath) + `'. ` + err_c.Error()
+			}
+			metaHash := NewOutputMetaHash(options)
+			err_w := WriteProvenanceComment(options, OutputMetaWriter(csvFileTemp, metaHash), output.Source)
+			headerRows := 0
+			if err_w == nil {
+				headerRows, err_w = GetOutputFormat(options).Write(options, OutputMetaWriter(csvFileTemp, metaHash), output.Headers, output.Desc, output.Rows[i:end])
+			}
+			csvFileTemp.Close()
+			if err_w != nil {
+				return `ERROR - Could not write temp split file '` + filepath.Base(splitfilepathtemp) + `'. ` + err_w.Error()
+			}
+			err_r := os.Rename(splitfilepathtemp, splitfilepath)
+			if err_r != nil {
+				return `ERROR - Could not rename temp file '` + filepath.Base(splitfilepathtemp) + `' to normal file '` + filepath.Base(splitfilepath) + `'. ` + err_r.Error()
+			}
+			if err_m := WriteOutputMeta(options, splitfilepath, metaHash, output.Source, output.Headers, headerRows, end-i); err_m != nil {
+				return `ERROR - Could not write sidecar of file '` + filepath.Base(splitfilepath) + `'. ` + err_m.Error()
+			}
+		}
+		return ""
+	}
+
+	//Write entire file out not split at all
+	csvFileTemp := output.TempFile
+	if csvFileTemp == nil {
+		var err_c error
+		csvFileTemp, err_c = CreateOutputFile(options, output.TempPath)
+		if err_c != nil {
+			return `ERROR - Could not create file '` + output.TempPath + `'. ` + err_c.Error()
+		}
+	}
+	metaHash := NewOutputMetaHash(options)
+	err_w := WriteProvenanceComment(options, OutputMetaWriter(csvFileTemp, metaHash), output.Source)
+	headerRows := 0
+	if err_w == nil {
+		headerRows, err_w = GetOutputFormat(options).Write(options, OutputMetaWriter(csvFileTemp, metaHash), output.Headers, output.Desc, output.Rows)
+	}
+	csvFileTemp.Close()
+	if err_w != nil {
+		return `ERROR - Could not write file '` + output.TempPath + `'. ` + err_w.Error()
+	}
+	err_r := os.Rename(output.TempPath, output.Path)
+	if err_r != nil {
+		return `ERROR - Could not rename temp file '` + filepath.Base(output.TempPath) + `' to normal file '` + filepath.Base(output.Path) + `'. ` + err_r.Error()
+	}
+	if err_m := WriteOutputMeta(options, output.Path, metaHash, output.Source, output.Headers, headerRows, len(output.Rows)); err_m != nil {
+		return `ERROR - Could not write sidecar of file '` + filepath.Base(output.Path) + `'. ` + err_m.Error()
+	}
+	return ""
+}
+
+//CSVSplitPath returns the path of one of the 1mil row files an output is split into if ExcelFriendly, starting at 1
+func CSVSplitPath(options Options, output CSVWriteOutput, splitNum int) string {
+	return filepath.Join(AuditOutputDir(options, output.SplitSuffix), output.SplitPrefix+"_spcsv"+strconv.Itoa(splitNum)+"-"+output.SplitSuffix+OutputFileExtension(options))
+}
@@ -0,0 +1,239 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//Percent of a timestamp column's values which must fail normalization before the file is warned about
+const dataQualityTimestampWarnPercent = 90
+
+//ColumnQuality holds the data quality metrics of one column of a parsed file
+//Timestamp failures are values of a timestamp column which were not normalized to "yyyy-mm-dd hh:mm:ss"
+type ColumnQuality struct {
+	File              string
+	AuditType         string
+	Column            string
+	Rows              int
+	Empty             int
+	MaxLength         int
+	Timestamp         bool
+	TimestampValues   int
+	TimestampFailures int
+}
+
+//EmptyPercent returns the percent of rows without a value
+func (q ColumnQuality) EmptyPercent() float64 {
+	return dataQualityPercent(q.Empty, q.Rows)
+}
+
+//TimestampFailurePercent returns the percent of timestamp values which were not normalized
+func (q ColumnQuality) TimestampFailurePercent() float64 {
+	return dataQualityPercent(q.TimestampFailures, q.TimestampValues)
+}
+
+func dataQualityPercent(part int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(int(float64(part)/float64(total)*10000)) / 100
+}
+
+//Timestamp fields of each audit in the built-in timeline config, by its filename suffix
+var dataQualityTimestampFields map[string]map[string]bool
+var dataQualityTimestampFieldsOnce sync.Once
+
+//Returns the columns the built-in timeline config reads timestamps from for an audit type
+func timelineTimestampFields(auditType string) map[string]bool {
+	dataQualityTimestampFieldsOnce.Do(func() {
+		dataQualityTimestampFields = map[string]map[string]bool{}
+		var config Timeline_Config_JSON
+		if err_j := json.Unmarshal([]byte(GetTimelineConfigTemplate()), &config); err_j != nil {
+			return
+		}
+		for _, audit := range config.Audits {
+			fields := map[string]bool{}
+			for _, field := range audit.TimestampFields {
+				fields[strings.Split(field, ">")[0]] = true
+			}
+			dataQualityTimestampFields[audit.FilenameSuffix] = fields
+		}
+	})
+	return dataQualityTimestampFields[auditType]
+}
+
+//Returns true if a value which was not normalized still looks like a date or time, such as "01/07/2020 01:42:04"
+func isDateLike(value string) bool {
+	if len(value) < 8 || len(value) > 40 || !strings.ContainsAny(value, "0123456789") {
+		return false
+	}
+	separators := 0
+	for _, sep := range []string{"-", "/", ":", "."} {
+		if strings.Contains(value, sep) {
+			separators++
+		}
+	}
+	return separators >= 2
+}
+
+//MeasureDataQuality returns the metrics of every audit column of the parsed outputs of an XML file
+//A column is a timestamp column if most of its values were normalized, or if the timeline config reads timestamps
+//from it and one of its values looks like a date. Timestamps are not checked when '-fast' keeps them raw
+func MeasureDataQuality(options Options, xmlFileName string, outputs []CSVWriteOutput) []ColumnQuality {
+	skipped := map[string]bool{"OriginalHostname": true, RawXMLHeader: true}
+	for _, h := range options.Config.HeadersMandatory {
+		skipped[h] = true
+	}
+	separator := GetMultiValueSeparator(options)
+	if separator == "\r\n" {
+		separator = "\n"
+	}
+	columns := []ColumnQuality{}
+	for _, output := range outputs {
+		//Rows '-pstream' wrote while parsing are no longer held
+		if output.Streamed != nil {
+			continue
+		}
+		timelineFields := timelineTimestampFields(output.SplitSuffix)
+		for i, header := range output.Headers {
+			if skipped[header] {
+				continue
+			}
+			q := ColumnQuality{File: RedactedInputName(options, xmlFileName), AuditType: output.SplitSuffix, Column: header, Rows: len(output.Rows)}
+			normalized, dateLike := 0, 0
+			for _, row := range output.Rows {
+				if i >= len(row) || row[i] == "" {
+					q.Empty++
+					continue
+				}
+				if len(row[i]) > q.MaxLength {
+					q.MaxLength = len(row[i])
+				}
+				if options.ParseRawTimestamps {
+					continue
+				}
+				values := []string{row[i]}
+				if strings.Contains(row[i], separator) {
+					values = strings.Split(row[i], separator)
+				}
+				for _, value := range values {
+					value = strings.TrimSpace(value)
+					if value == "" {
+						continue
+					}
+					q.TimestampValues++
+					if IsNormalizedTime(value) {
+						normalized++
+					} else {
+						q.TimestampFailures++
+						if isDateLike(value) {
+							dateLike++
+						}
+					}
+				}
+			}
+			q.Timestamp = normalized > 0 && normalized*2 >= q.TimestampValues
+			if timelineFields[header] && normalized+dateLike > 0 {
+				q.Timestamp = true
+			}
+			if !q.Timestamp {
+				q.TimestampValues = 0
+				q.TimestampFailures = 0
+			}
+			columns = append(columns, q)
+		}
+	}
+	return columns
+}
+
+//DataQualityNote returns a warning listing the timestamp columns which mostly failed normalization, or "" if there are none
+func DataQualityNote(columns []ColumnQuality) string {
+	failed := []string{}
+	for _, q := range columns {
+		if q.Timestamp && q.TimestampFailures > 0 && q.TimestampFailurePercent() > dataQualityTimestampWarnPercent {
+			failed = append(failed, `'`+q.AuditType+`.`+q.Column+`' (`+strconv.FormatFloat(q.TimestampFailurePercent(), 'f', -1, 64)+`%)`)
+		}
+	}
+	if len(failed) == 0 {
+		return ""
+	}
+	sort.Strings(failed)
+	return ` WARNING - Timestamp column(s) mostly failed normalization and will not sort in timelines: ` + strings.Join(failed, ", ") + `.`
+}
+
+//DataQualityLog collects the column metrics of every XML file of a run for "_GAPDataQuality.csv"
+type DataQualityLog struct {
+	mu      sync.Mutex
+	columns []ColumnQuality
+}
+
+//Add records the column metrics of a parsed file, a nil log is ignored
+func (log *DataQualityLog) Add(columns []ColumnQuality) {
+	if log == nil || len(columns) == 0 {
+		return
+	}
+	log.mu.Lock()
+	log.columns = append(log.columns, columns...)
+	log.mu.Unlock()
+}
+
+//Len returns the number of columns recorded
+func (log *DataQualityLog) Len() int {
+	if log == nil {
+		return 0
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return len(log.columns)
+}
+
+//Save writes the column metrics of this run to "_GAPDataQuality.csv" in the output directory
+func (log *DataQualityLog) Save(options Options) (string, error) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	csvPath := filepath.Join(options.OutputPath, "_GAPDataQuality.csv")
+	sort.SliceStable(log.columns, func(i, j int) bool {
+		if log.columns[i].File != log.columns[j].File {
+			return log.columns[i].File < log.columns[j].File
+		}
+		return log.columns[i].AuditType < log.columns[j].AuditType
+	})
+	csvFile, err_c := CreateOutputFile(options, csvPath)
+	if err_c != nil {
+		return csvPath, err_c
+	}
+	writer := csv.NewWriter(csvFile)
+	writer.Write([]string{"File", "AuditType", "Column", "Rows", "Empty", "EmptyPercent", "MaxLength", "TimestampColumn", "TimestampFailures", "TimestampFailurePercent"})
+	for _, q := range log.columns {
+		writer.Write([]string{
+			q.File,
+			q.AuditType,
+			q.Column,
+			strconv.Itoa(q.Rows),
+			strconv.Itoa(q.Empty),
+			strconv.FormatFloat(q.EmptyPercent(), 'f', -1, 64),
+			strconv.Itoa(q.MaxLength),
+			strconv.FormatBool(q.Timestamp),
+			strconv.Itoa(q.TimestampFailures),
+			strconv.FormatFloat(q.TimestampFailurePercent(), 'f', -1, 64),
+		})
+	}
+	writer.Flush()
+	csvFile.Close()
+	return csvPath, writer.Error()
+}
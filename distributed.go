@@ -0,0 +1,337 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Distributed processing lets multiple GoAuditParser instances on different machines share one input directory.
+//The queue directory ('-dq <dir>') is shared between all workers. Each worker claims an archive or XML file
+//by atomically creating "<dq>/claims/<file>.claim" and only processes files it claimed. Each worker keeps its
+//own parse cache "_GAPParseCache_<workerid>.json", which is merged into "_GAPParseCache.json" when it finishes.
+//Claims are keyed by the size and modification time of the file, so a changed file is claimed again. Workers touch
+//their claims while they run, claims of files which failed are removed when the worker finishes, and claims of a worker
+//which stopped without finishing are taken over by other workers once they are stale.
+
+const (
+	distributedHeartbeat       = 10 * time.Second //Claims of a running worker are touched this often
+	distributedStaleAfter      = 60 * time.Second //Claims which were not touched this long lost their worker and are taken over
+	distributedMergeLockStale  = 30 * time.Second //Merge locks this old were left by a worker which stopped while merging
+	distributedClaimDoneMarker = "done"
+)
+
+var regDistributedUnsafe = regexp.MustCompile(`[^-_.A-Za-z0-9]`)
+
+//DistributedClaims are the claims of this worker, which are touched until they are released
+type DistributedClaims struct {
+	mu     sync.Mutex
+	claims map[string]distributedClaim //Claim path -> claimed file
+	stop   chan struct{}
+}
+
+type distributedClaim struct {
+	name string
+	size int64
+}
+
+//NewDistributedClaims returns the claims of a worker, which has none yet
+func NewDistributedClaims() *DistributedClaims {
+	return &DistributedClaims{claims: map[string]distributedClaim{}}
+}
+
+//add records a claim of this worker, starting the heartbeat of its claims with the first one
+func (claims *DistributedClaims) add(path string, file os.FileInfo) {
+	if claims == nil {
+		return
+	}
+	claims.mu.Lock()
+	defer claims.mu.Unlock()
+	claims.claims[path] = distributedClaim{name: filepath.Base(file.Name()), size: file.Size()}
+	if claims.stop == nil {
+		claims.stop = make(chan struct{})
+		go claims.heartbeat(claims.stop)
+	}
+}
+
+//heartbeat touches the claims of this worker until stop is closed, so other workers don't take them over
+func (claims *DistributedClaims) heartbeat(stop chan struct{}) {
+	ticker := time.NewTicker(distributedHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			now := time.Now()
+			claims.mu.Lock()
+			for path := range claims.claims {
+				os.Chtimes(path, now, now)
+			}
+			claims.mu.Unlock()
+		}
+	}
+}
+
+//Release stops the heartbeat and marks the claims of files with a finished status in the parse cache of this worker
+//as done, so no other worker processes them again. Claims of failed files are removed for other workers to retry
+func (claims *DistributedClaims) Release(options Options) {
+	if claims == nil {
+		return
+	}
+	claims.mu.Lock()
+	defer claims.mu.Unlock()
+	if claims.stop != nil {
+		close(claims.stop)
+		claims.stop = nil
+	}
+	finished := map[distributedClaim]bool{}
+	var cache Parse_Config_JSON
+	if b, err_r := ioutil.ReadFile(ParseCachePath(options)); err_r == nil && json.Unmarshal(b, &cache) == nil {
+		for _, outdir := range cache.OutputDirectories {
+			for _, xmlFile := range outdir.XMLFiles {
+				if parseCacheStatusFinal(xmlFile.Status) {
+					finished[distributedClaim{name: xmlFile.InputFileName, size: xmlFile.InputFileSize}] = true
+				}
+			}
+			for _, archiveFile := range outdir.ArchiveFiles {
+				if parseCacheStatusFinal(archiveFile.Status) {
+					finished[distributedClaim{name: archiveFile.InputFileName, size: archiveFile.InputFileSize}] = true
+				}
+			}
+		}
+	}
+	released := 0
+	for path, claim := range claims.claims {
+		if finished[claim] {
+			if f, err_o := OpenOutputFile(options, path, os.O_APPEND|os.O_WRONLY, 0644); err_o == nil {
+				f.WriteString(distributedClaimDoneMarker + "\t" + time.Now().UTC().Format(jobTimestampFormat) + "\n")
+				f.Close()
+			}
+		} else if os.Remove(path) == nil {
+			released++
+		}
+		delete(claims.claims, path)
+	}
+	if released > 0 {
+		options.Log.Println(options.Box + "NOTICE - Released the claims of " + strconv.Itoa(released) + " file(s) which were not processed, so other workers retry them.")
+	}
+}
+
+//DistributedEnabled returns true if a distributed queue directory was specified with '-dq'
+func DistributedEnabled(options Options) bool {
+	return options.DistributedQueueDir != ""
+}
+
+//ParseCachePath returns the parse cache file of this instance
+func ParseCachePath(options Options) string {
+	if DistributedEnabled(options) {
+		return filepath.Join(InputScratchDir(options), "_GAPParseCache_"+regDistributedUnsafe.ReplaceAllString(options.DistributedWorkerID, "_")+".json")
+	}
+	return filepath.Join(InputScratchDir(options), "_GAPParseCache.json")
+}
+
+//DistributedSeedParseCache starts a worker parse cache from the merged parse cache so previously parsed files stay cached
+func DistributedSeedParseCache(options Options) {
+	workerCache := ParseCachePath(options)
+	if _, err_s := os.Stat(workerCache); !os.IsNotExist(err_s) {
+		return
+	}
+	b, err_r := ioutil.ReadFile(filepath.Join(InputScratchDir(options), "_GAPParseCache.json"))
+	if err_r != nil || len(b) == 0 {
+		return
+	}
+	WriteOutputFile(options, workerCache, b, 0644)
+}
+
+//distributedStale returns the first line of a claim or lock file if it was not touched for the duration, and false if
+//it is recent, was released, or is done
+func distributedStale(path string, after time.Duration) (string, bool) {
+	fi, err_s := os.Stat(path)
+	if err_s != nil || time.Since(fi.ModTime()) < after {
+		return "", false
+	}
+	b, err_r := ioutil.ReadFile(path)
+	if err_r != nil {
+		return "", false
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	for _, line := range lines {
+		if strings.HasPrefix(line, distributedClaimDoneMarker+"\t") {
+			return "", false
+		}
+	}
+	return strings.Split(lines[0], "\t")[0], true
+}
+
+//distributedTakeOver removes a stale claim or lock file. Renaming it first makes sure only one worker takes it over
+func distributedTakeOver(options Options, path string) bool {
+	stalePath := path + "." + regDistributedUnsafe.ReplaceAllString(options.DistributedWorkerID, "_") + ".stale"
+	if os.Rename(path, stalePath) != nil {
+		return false
+	}
+	os.Remove(stalePath)
+	return true
+}
+
+//DistributedClaim atomically claims a file for this worker, returning false if another worker already has it
+func DistributedClaim(options Options, file os.FileInfo) bool {
+	claimsDir := filepath.Join(options.DistributedQueueDir, "claims")
+	if err := MkdirAllOutput(options, claimsDir); err != nil {
+		options.Log.Println(options.Warnbox + "ERROR - Could not create distributed queue directory '" + claimsDir + "'. " + err.Error())
+		return false
+	}
+	//Input directories may be mounted at different paths on each machine, so key by the input directory name
+	filename := filepath.Base(file.Name())
+	key := filepath.Base(options.InputPath) + "__" + filename + "__" + strconv.FormatInt(file.Size(), 10) + "_" + strconv.FormatInt(file.ModTime().Unix(), 10)
+	claimPath := filepath.Join(claimsDir, regDistributedUnsafe.ReplaceAllString(key, "_")+".claim")
+	f, err_c := OpenOutputFile(options, claimPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err_c != nil {
+		worker, stale := distributedStale(claimPath, distributedStaleAfter)
+		if !stale || !distributedTakeOver(options, claimPath) {
+			return false
+		}
+		options.Log.Println(options.Warnbox + "NOTICE - Taking over file '" + filename + "' from worker '" + worker + "', which stopped without finishing it.")
+		if f, err_c = OpenOutputFile(options, claimPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644); err_c != nil {
+			return false
+		}
+	}
+	f.WriteString(options.DistributedWorkerID + "\t" + time.Now().UTC().Format(jobTimestampFormat) + "\n")
+	f.Close()
+	options.DistributedClaims.add(claimPath, file)
+	return true
+}
+
+//DistributedClaimFiles keeps only the files this worker was able to claim
+func DistributedClaimFiles(options Options, files []os.FileInfo) []os.FileInfo {
+	claimed := []os.FileInfo{}
+	for _, file := range files {
+		name := filepath.Base(file.Name())
+		if strings.HasPrefix(name, "_GAPParseCache") || strings.HasPrefix(name, "_GAPWipeLog") {
+			continue
+		}
+		if DistributedClaim(options, file) {
+			claimed = append(claimed, file)
+		} else if options.Verbose > 0 {
+			options.Log.Println(options.Box + "File '" + name + "' is claimed by another worker.")
+		}
+	}
+	return claimed
+}
+
+//DistributedMergeParseCaches merges every worker parse cache in the input directory into "_GAPParseCache.json"
+func DistributedMergeParseCaches(options Options) error {
+	//Only one worker may rewrite the merged cache at a time
+	lockPath := filepath.Join(options.DistributedQueueDir, "merge.lock")
+	var lock *os.File
+	for i := 0; ; i++ {
+		var err_c error
+		lock, err_c = OpenOutputFile(options, lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err_c == nil {
+			break
+		}
+		//A worker which stopped while merging leaves its lock behind
+		if worker, stale := distributedStale(lockPath, distributedMergeLockStale); stale && distributedTakeOver(options, lockPath) {
+			options.Log.Println(options.Warnbox + "NOTICE - Removed the merge lock '" + lockPath + "' left by worker '" + worker + "'.")
+			continue
+		}
+		if i >= 120 {
+			return errors.New("timed out waiting for merge lock '" + lockPath + "'")
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	lock.WriteString(options.DistributedWorkerID + "\n")
+	lock.Close()
+	defer os.Remove(lockPath)
+
+	mergedPath := filepath.Join(InputScratchDir(options), "_GAPParseCache.json")
+	merged := Parse_Config_JSON{}
+	if b, err_r := ioutil.ReadFile(mergedPath); err_r == nil && len(b) > 0 {
+		if err_j := json.Unmarshal(b, &merged); err_j != nil {
+			return err_j
+		}
+	}
+	merged.Version = version
+
+	cachefiles, err_r := ioutil.ReadDir(InputScratchDir(options))
+	if err_r != nil {
+		return err_r
+	}
+	for _, cachefile := range cachefiles {
+		name := cachefile.Name()
+		if !strings.HasPrefix(name, "_GAPParseCache_") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		b, err_r := ioutil.ReadFile(filepath.Join(InputScratchDir(options), name))
+		if err_r != nil {
+			return err_r
+		}
+		var worker Parse_Config_JSON
+		if err_j := json.Unmarshal(b, &worker); err_j != nil {
+			options.Log.Println(options.Warnbox + "WARNING - Could not parse JSON from worker parse cache '" + name + "'. Skipping.")
+			continue
+		}
+		for _, outdir := range worker.OutputDirectories {
+			var dirIndex int
+			merged, dirIndex = InputConfig_GetOutDirIndex(outdir.OutputDirectory, merged)
+			for _, xmlFile := range outdir.XMLFiles {
+				merged.OutputDirectories[dirIndex].XMLFiles = mergeParseCacheXMLFile(merged.OutputDirectories[dirIndex].XMLFiles, xmlFile)
+			}
+			for _, archiveFile := range outdir.ArchiveFiles {
+				merged.OutputDirectories[dirIndex].ArchiveFiles = mergeParseCacheArchiveFile(merged.OutputDirectories[dirIndex].ArchiveFiles, archiveFile)
+			}
+		}
+	}
+
+	b, err_m := json.Marshal(merged)
+	if err_m != nil {
+		return err_m
+	}
+	return WriteOutputFile(options, mergedPath, b, 0644)
+}
+
+//Statuses that are not yet finished should not overwrite a finished status from another worker
+func parseCacheStatusFinal(status string) bool {
+	return status != "" && !strings.HasPrefix(status, "failed")
+}
+
+func mergeParseCacheXMLFile(files []Parse_Config_XMLFile, file Parse_Config_XMLFile) []Parse_Config_XMLFile {
+	for i, existing := range files {
+		if existing.InputFileName == file.InputFileName && existing.InputFileSize == file.InputFileSize {
+			if parseCacheStatusFinal(file.Status) || !parseCacheStatusFinal(existing.Status) {
+				files[i].Status = file.Status
+			}
+			return files
+		}
+	}
+	return append(files, file)
+}
+
+func mergeParseCacheArchiveFile(files []Parse_Config_ArchiveFile, file Parse_Config_ArchiveFile) []Parse_Config_ArchiveFile {
+	for i, existing := range files {
+		if existing.InputFileName == file.InputFileName && existing.InputFileSize == file.InputFileSize {
+			if parseCacheStatusFinal(file.Status) || !parseCacheStatusFinal(existing.Status) {
+				files[i].Status = file.Status
+			}
+			return files
+		}
+	}
+	return append(files, file)
+}
@@ -0,0 +1,182 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+
+package goauditparser
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//Writes XML files to a new input directory and returns it with a queue directory next to it
+func writeDistributedTestInput(t *testing.T, count int) (string, string) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input")
+	if err_m := os.Mkdir(input, 0755); err_m != nil {
+		t.Fatal(err_m)
+	}
+	for i := 0; i < count; i++ {
+		name := "HOST-" + strconv.Itoa(i) + "-bPlNFGdSC2wd8f2QnFhk5A-82fbf86758bf5c97d2d2a313e4f95957-w32processes-memory.xml"
+		if err_w := ioutil.WriteFile(filepath.Join(input, name), []byte("<itemList/>"), 0644); err_w != nil {
+			t.Fatal(err_w)
+		}
+	}
+	return input, filepath.Join(dir, "queue")
+}
+
+//Returns the options of a worker sharing the queue directory
+func distributedTestOptions(t *testing.T, input string, queue string, worker string) Options {
+	options, err_l := NewLibraryOptions(LibraryOptions{})
+	if err_l != nil {
+		t.Fatal(err_l)
+	}
+	options.InputPath = input
+	options.DistributedQueueDir = queue
+	options.DistributedWorkerID = worker
+	options.DistributedClaims = NewDistributedClaims()
+	return options
+}
+
+//Claims the files of the input directory like a worker run, records the claimed files as parsed in the parse cache
+//of the worker, then releases its claims and merges the parse caches. Returns the names of the files it parsed
+func runDistributedTestWorker(t *testing.T, options Options) []string {
+	files, err_r := ioutil.ReadDir(options.InputPath)
+	if err_r != nil {
+		t.Error(err_r)
+		return nil
+	}
+	files = DistributedClaimFiles(options, files)
+	DistributedSeedParseCache(options)
+	cache := Parse_Config_JSON{}
+	if b, err_r := ioutil.ReadFile(ParseCachePath(options)); err_r == nil {
+		json.Unmarshal(b, &cache)
+	}
+	cache, dirIndex := InputConfig_GetOutDirIndex(options.OutputPath, cache)
+	parsed := []string{}
+	for _, file := range files {
+		cache = ParseConfigUpdateXMLParse(dirIndex, file, "File '"+file.Name()+"' parsed successfully.", false, cache)
+		parsed = append(parsed, file.Name())
+	}
+	b, _ := json.Marshal(cache)
+	if err_w := ioutil.WriteFile(ParseCachePath(options), b, 0644); err_w != nil {
+		t.Error(err_w)
+	}
+	options.DistributedClaims.Release(options)
+	if err_m := DistributedMergeParseCaches(options); err_m != nil {
+		t.Error(err_m)
+	}
+	return parsed
+}
+
+func TestDistributedWorkersParseEachFileOnce(t *testing.T) {
+	input, queue := writeDistributedTestInput(t, 50)
+	workers := []Options{
+		distributedTestOptions(t, input, queue, "worker-a"),
+		distributedTestOptions(t, input, queue, "worker-b"),
+	}
+
+	parsedBy := map[string][]string{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, options := range workers {
+		wg.Add(1)
+		go func(options Options) {
+			defer wg.Done()
+			parsed := runDistributedTestWorker(t, options)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, name := range parsed {
+				parsedBy[name] = append(parsedBy[name], options.DistributedWorkerID)
+			}
+		}(options)
+	}
+	wg.Wait()
+
+	files, _ := ioutil.ReadDir(input)
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasPrefix(name, "_GAPParseCache") {
+			continue
+		}
+		if len(parsedBy[name]) != 1 {
+			t.Errorf("'%s' was parsed by %d workers %v, not 1", name, len(parsedBy[name]), parsedBy[name])
+		}
+	}
+	if len(parsedBy) != 50 {
+		t.Errorf("%d of 50 files were parsed", len(parsedBy))
+	}
+
+	//Every file is in the merged parse cache once
+	var merged Parse_Config_JSON
+	b, err_r := ioutil.ReadFile(filepath.Join(input, "_GAPParseCache.json"))
+	if err_r != nil {
+		t.Fatal(err_r)
+	}
+	if err_j := json.Unmarshal(b, &merged); err_j != nil {
+		t.Fatal(err_j)
+	}
+	if len(merged.OutputDirectories) != 1 || len(merged.OutputDirectories[0].XMLFiles) != 50 {
+		t.Errorf("merged parse cache %s does not have the 50 files once", string(b))
+	}
+
+	//Claims of finished files are done, so running the workers again parses nothing
+	for _, options := range workers {
+		if parsed := runDistributedTestWorker(t, options); len(parsed) != 0 {
+			t.Errorf("worker '%s' parsed %v again", options.DistributedWorkerID, parsed)
+		}
+	}
+}
+
+func TestDistributedClaimStale(t *testing.T) {
+	input, queue := writeDistributedTestInput(t, 1)
+	files, _ := ioutil.ReadDir(input)
+	stopped := distributedTestOptions(t, input, queue, "worker-a")
+	other := distributedTestOptions(t, input, queue, "worker-b")
+	defer other.DistributedClaims.Release(other)
+
+	//Worker a stops without releasing its claim, which is no longer touched
+	if !DistributedClaim(stopped, files[0]) {
+		t.Fatal("worker-a could not claim the file")
+	}
+	stopped.DistributedClaims.mu.Lock()
+	close(stopped.DistributedClaims.stop)
+	stopped.DistributedClaims.stop = nil
+	stopped.DistributedClaims.mu.Unlock()
+	if DistributedClaim(other, files[0]) {
+		t.Fatal("worker-b took over a claim which is not stale")
+	}
+
+	claims, _ := filepath.Glob(filepath.Join(queue, "claims", "*.claim"))
+	if len(claims) != 1 {
+		t.Fatalf("%d claim files, not 1", len(claims))
+	}
+	lastTouched := time.Now().Add(-distributedStaleAfter - time.Second)
+	if err_c := os.Chtimes(claims[0], lastTouched, lastTouched); err_c != nil {
+		t.Fatal(err_c)
+	}
+	if !DistributedClaim(other, files[0]) {
+		t.Fatal("worker-b did not take over the stale claim")
+	}
+	b, _ := ioutil.ReadFile(claims[0])
+	if !strings.HasPrefix(string(b), "worker-b\t") {
+		t.Errorf("claim '%s' is not held by worker-b", string(b))
+	}
+	if DistributedClaim(stopped, files[0]) {
+		t.Error("worker-a claimed the file again after worker-b took it over")
+	}
+}
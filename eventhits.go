@@ -0,0 +1,206 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//Audit type of the '-phits' output, with one row per indicator hit of an event
+const EventHitsAuditType = "EventItem_Hits"
+
+//Column of the number of hits of an event, added to the event rows with '-phits' or '-phcap <int>'
+const EventHitCountHeader = "HitCount"
+
+//Audit type of the "<hostname>-<agentid>-Hits.csv" files '-phits' writes with the hits of every event file of a host
+const HostHitsAuditType = "Hits"
+
+var eventHitsHeaders = []string{"Hostname", "AgentID", "UID", "Sequence Number", "EventBufferType", "Timestamp", "Hit", "Indicator", "Other GUIDs"}
+
+const eventHitsTimestampColumn = 5
+
+//Columns of "<hostname>-<agentid>-Hits.csv", the '-phits' columns and the event file the row came from
+var hostHitsHeaders = append(append([]string{}, eventHitsHeaders...), "File")
+
+const hostHitsFileColumn = 9
+
+//ParseEventHits splits the hits attribute of an <eventItem> into its bracketed groups of GUIDs
+//Ex. "[f5565076-..., 06743fce-...] [e5db9997-..., 1bca5ad3-...]" is [[f5565076-... 06743fce-...] [e5db9997-... 1bca5ad3-...]]
+func ParseEventHits(hits string) [][]string {
+	hits = strings.Replace(hits, "] [", "|", -1)
+	hits = strings.Replace(hits, " ", "", -1)
+	hits = strings.Replace(hits, "]", "", -1)
+	hits = strings.Replace(hits, "[", "", -1)
+	groups := [][]string{}
+	for _, group := range strings.Split(hits, "|") {
+		groups = append(groups, strings.Split(group, ","))
+	}
+	return groups
+}
+
+//FormatEventHits returns the cells of the first GUID of every hit, ["a","c"], and of every GUID, [["a","b"],["c","d"]]
+//Only the first '-phcap <int>' hits are kept if it is set, the rest are only in the '-phits' output
+func FormatEventHits(options Options, groups [][]string) (string, string) {
+	if options.ParseHitsCap > 0 && len(groups) > options.ParseHitsCap {
+		groups = groups[:options.ParseHitsCap]
+	}
+	ext1 := []string{}
+	ext2 := []string{}
+	for _, group := range groups {
+		ext1 = append(ext1, `"`+group[0]+`"`)
+		tempdata := []string{}
+		for _, guid := range group {
+			tempdata = append(tempdata, `"`+guid+`"`)
+		}
+		ext2 = append(ext2, "["+strings.Join(tempdata, ",")+"]")
+	}
+	return "[" + strings.Join(ext1, ",") + "]", "[" + strings.Join(ext2, ",") + "]"
+}
+
+//AppendEventHitRows adds a '-phits' row for every hit of a parsed event, leaving Hostname and AgentID empty until the output is written
+func AppendEventHitRows(options Options, hitRows [][]string, uid string, sequenceNum string, eventType string, timestamp string, groups [][]string) [][]string {
+	if !options.ParseHits {
+		return hitRows
+	}
+	for i, group := range groups {
+		hitRows = append(hitRows, []string{"", "", uid, sequenceNum, eventType, timestamp, strconv.Itoa(i + 1), group[0], strings.Join(group[1:], ",")})
+	}
+	return hitRows
+}
+
+//eventRowValue returns the value of a column of a parsed event row, or "" if the event does not have it
+func eventRowValue(row []RowValue, headers map[string]int, header string) string {
+	colID, exists := headers[header]
+	if !exists {
+		return ""
+	}
+	for _, value := range row {
+		if value.colid == colID {
+			return value.value
+		}
+	}
+	return ""
+}
+
+//HitsLog collects the '-phits' rows of every event file of a run by host, so the indicator hits of a host can be reviewed
+//in one "<hostname>-<agentid>-Hits.csv" file instead of one file per eventbuffer or stateagentinspector payload
+type HitsLog struct {
+	mu    sync.Mutex
+	hosts map[string]*hitsHost
+}
+
+//Hit rows of one host by event file
+type hitsHost struct {
+	hostname string
+	agentid  string
+	files    map[string][][]string
+}
+
+//Add records the hit rows of a parsed event file, also when there are none so rows of an earlier parse are replaced
+//A nil log is ignored
+func (log *HitsLog) Add(hostname string, agentid string, xmlFileName string, hitRows [][]string) {
+	if log == nil {
+		return
+	}
+	rows := make([][]string, 0, len(hitRows))
+	for _, hitRow := range hitRows {
+		rows = append(rows, append(append([]string{}, hitRow...), xmlFileName))
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if log.hosts == nil {
+		log.hosts = map[string]*hitsHost{}
+	}
+	key := hostname + "-" + agentid
+	if _, exists := log.hosts[key]; !exists {
+		log.hosts[key] = &hitsHost{hostname, agentid, map[string][][]string{}}
+	}
+	log.hosts[key].files[xmlFileName] = rows
+}
+
+//Save writes the hits of each host to "<hostname>-<agentid>-Hits.csv", sorted by the timestamp of their events
+//Rows of event files which were not parsed in this run, such as cached ones, are kept from the existing file
+//Returns the number of hit rows written
+func (log *HitsLog) Save(options Options) (int, error) {
+	if log == nil {
+		return 0, nil
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	written := 0
+	for _, host := range log.hosts {
+		csvDir := AuditOutputDir(options, HostHitsAuditType)
+		csvPath := filepath.Join(csvDir, host.hostname+"-"+host.agentid+"-"+HostHitsAuditType+".csv")
+		rows := [][]string{}
+		if csvFile, err_o := os.Open(csvPath); err_o == nil {
+			records, _ := csv.NewReader(csvFile).ReadAll()
+			csvFile.Close()
+			for i, record := range records {
+				if i == 0 || len(record) != len(hostHitsHeaders) {
+					continue
+				}
+				if _, parsed := host.files[record[hostHitsFileColumn]]; !parsed {
+					rows = append(rows, record)
+				}
+			}
+		}
+		for _, fileRows := range host.files {
+			rows = append(rows, fileRows...)
+		}
+		if len(rows) == 0 {
+			os.Remove(csvPath)
+			continue
+		}
+
+		//Normalized timestamps sort in time order, events without one come first
+		sort.SliceStable(rows, func(i, j int) bool {
+			if rows[i][eventHitsTimestampColumn] != rows[j][eventHitsTimestampColumn] {
+				return rows[i][eventHitsTimestampColumn] < rows[j][eventHitsTimestampColumn]
+			}
+			if rows[i][hostHitsFileColumn] != rows[j][hostHitsFileColumn] {
+				return rows[i][hostHitsFileColumn] < rows[j][hostHitsFileColumn]
+			}
+			si, _ := strconv.Atoi(rows[i][3])
+			sj, _ := strconv.Atoi(rows[j][3])
+			if si != sj {
+				return si < sj
+			}
+			hi, _ := strconv.Atoi(rows[i][6])
+			hj, _ := strconv.Atoi(rows[j][6])
+			return hi < hj
+		})
+		if err_m := MkdirAllOutput(options, csvDir); err_m != nil {
+			return written, err_m
+		}
+		csvFile, err_c := CreateOutputFile(options, csvPath)
+		if err_c != nil {
+			return written, err_c
+		}
+		writer := csv.NewWriter(csvFile)
+		writer.Write(hostHitsHeaders)
+		for _, row := range rows {
+			writer.Write(row)
+			written++
+		}
+		writer.Flush()
+		csvFile.Close()
+		if err_w := writer.Error(); err_w != nil {
+			return written, err_w
+		}
+	}
+	return written, nil
+}
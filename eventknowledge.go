@@ -0,0 +1,195 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+)
+
+//EventKnowledge describes a Windows event log entry by its source and EID
+//An empty Source matches the EID from any source
+type EventKnowledge struct {
+	Source      string `json:"Source"`
+	EID         string `json:"EID"`
+	Severity    string `json:"Severity"`
+	Category    string `json:"Category"`
+	Description string `json:"Description"`
+}
+
+var eventKnowledgeBuiltIn = []EventKnowledge{
+	//Authentication
+	{"Security-Auditing", "4624", "Info", "Authentication", "An account was successfully logged on."},
+	{"Security-Auditing", "4625", "Medium", "Authentication", "An account failed to log on."},
+	{"Security-Auditing", "4634", "Info", "Authentication", "An account was logged off."},
+	{"Security-Auditing", "4647", "Info", "Authentication", "User initiated logoff."},
+	{"Security-Auditing", "4648", "Medium", "Authentication", "A logon was attempted using explicit credentials."},
+	{"Security-Auditing", "4672", "Low", "Authentication", "Special privileges assigned to new logon."},
+	{"Security-Auditing", "4768", "Info", "Authentication", "A Kerberos authentication ticket (TGT) was requested."},
+	{"Security-Auditing", "4769", "Info", "Authentication", "A Kerberos service ticket was requested."},
+	{"Security-Auditing", "4771", "Medium", "Authentication", "Kerberos pre-authentication failed."},
+	{"Security-Auditing", "4776", "Info", "Authentication", "The computer attempted to validate the credentials for an account (NTLM)."},
+	//Remote access
+	{"Security-Auditing", "4778", "Low", "Remote Access", "A session was reconnected to a Window Station."},
+	{"Security-Auditing", "4779", "Low", "Remote Access", "A session was disconnected from a Window Station."},
+	{"TerminalServices-LocalSessionManager", "21", "Low", "Remote Access", "Remote Desktop Services: Session logon succeeded."},
+	{"TerminalServices-LocalSessionManager", "24", "Info", "Remote Access", "Remote Desktop Services: Session has been disconnected."},
+	{"TerminalServices-LocalSessionManager", "25", "Low", "Remote Access", "Remote Desktop Services: Session reconnection succeeded."},
+	{"TerminalServices-RemoteConnectionManager", "1149", "Low", "Remote Access", "Remote Desktop Services: User authentication succeeded."},
+	//Account management
+	{"Security-Auditing", "4720", "Medium", "Account Management", "A user account was created."},
+	{"Security-Auditing", "4722", "Low", "Account Management", "A user account was enabled."},
+	{"Security-Auditing", "4724", "Medium", "Account Management", "An attempt was made to reset an account's password."},
+	{"Security-Auditing", "4726", "Medium", "Account Management", "A user account was deleted."},
+	{"Security-Auditing", "4728", "High", "Account Management", "A member was added to a security-enabled global group."},
+	{"Security-Auditing", "4732", "High", "Account Management", "A member was added to a security-enabled local group."},
+	{"Security-Auditing", "4740", "Medium", "Account Management", "A user account was locked out."},
+	{"Security-Auditing", "4756", "High", "Account Management", "A member was added to a security-enabled universal group."},
+	//Processes
+	{"Security-Auditing", "4688", "Info", "Process Creation", "A new process has been created."},
+	{"Security-Auditing", "4689", "Info", "Process Exit", "A process has exited."},
+	//Services
+	{"Security-Auditing", "4697", "High", "Service Install", "A service was installed in the system."},
+	{"Service Control Manager", "7045", "High", "Service Install", "A service was installed in the system."},
+	{"Service Control Manager", "7034", "Medium", "Service Change", "A service terminated unexpectedly."},
+	{"Service Control Manager", "7036", "Info", "Service Change", "A service entered the running or stopped state."},
+	{"Service Control Manager", "7040", "Low", "Service Change", "The start type of a service was changed."},
+	//Scheduled tasks
+	{"Security-Auditing", "4698", "High", "Scheduled Task", "A scheduled task was created."},
+	{"Security-Auditing", "4699", "Medium", "Scheduled Task", "A scheduled task was deleted."},
+	{"Security-Auditing", "4702", "Medium", "Scheduled Task", "A scheduled task was updated."},
+	{"TaskScheduler", "106", "Medium", "Scheduled Task", "A scheduled task was registered."},
+	{"TaskScheduler", "141", "Medium", "Scheduled Task", "A scheduled task was deleted."},
+	//Logs and policy
+	{"Eventlog", "1102", "High", "Log Cleared", "The audit log was cleared."},
+	{"Eventlog", "104", "High", "Log Cleared", "An event log was cleared."},
+	{"Security-Auditing", "4719", "High", "Policy Change", "System audit policy was changed."},
+	//PowerShell
+	{"PowerShell", "4103", "Low", "PowerShell", "PowerShell module logging recorded a pipeline execution."},
+	{"PowerShell", "4104", "Medium", "PowerShell", "PowerShell script block logging recorded a script."},
+	{"PowerShell", "400", "Info", "PowerShell", "The PowerShell engine was started."},
+	//Antivirus
+	{"Windows Defender", "1116", "High", "Antivirus", "Windows Defender detected malware or other unwanted software."},
+	{"Windows Defender", "1117", "High", "Antivirus", "Windows Defender took action to protect the system from malware."},
+}
+
+//Make "Microsoft-Windows-Security-Auditing" and "Security-Auditing" the same source
+func eventKnowledgeKey(source string, eid string) string {
+	source = strings.ToLower(strings.TrimSpace(source))
+	source = strings.TrimPrefix(source, "microsoft-windows-")
+	return source + "|" + strings.TrimSpace(eid)
+}
+
+//LoadEventKnowledge returns the built-in knowledge pack, extended and overridden by the JSON array in packFile if provided
+func LoadEventKnowledge(packFile string) (map[string]EventKnowledge, error) {
+	pack := map[string]EventKnowledge{}
+	for _, entry := range eventKnowledgeBuiltIn {
+		pack[eventKnowledgeKey(entry.Source, entry.EID)] = entry
+	}
+	if packFile == "" {
+		return pack, nil
+	}
+	b, err_r := ioutil.ReadFile(packFile)
+	if err_r != nil {
+		return nil, err_r
+	}
+	entries := []EventKnowledge{}
+	if err_j := json.Unmarshal(b, &entries); err_j != nil {
+		return nil, err_j
+	}
+	for _, entry := range entries {
+		pack[eventKnowledgeKey(entry.Source, entry.EID)] = entry
+	}
+	return pack, nil
+}
+
+//LookupEventKnowledge returns the knowledge of an event by its source, then by its EID alone
+func LookupEventKnowledge(pack map[string]EventKnowledge, source string, eid string) (EventKnowledge, bool) {
+	if entry, exists := pack[eventKnowledgeKey(source, eid)]; exists {
+		return entry, true
+	}
+	entry, exists := pack[eventKnowledgeKey("", eid)]
+	return entry, exists
+}
+
+//EventKnowledgeCategories returns the categories of the pack, such as "Authentication" and "Service Install"
+func EventKnowledgeCategories(pack map[string]EventKnowledge) []string {
+	categories := []string{}
+	seen := map[string]bool{}
+	for _, entry := range eventKnowledgeBuiltIn {
+		if !seen[entry.Category] {
+			seen[entry.Category] = true
+			categories = append(categories, entry.Category)
+		}
+	}
+	for _, entry := range pack {
+		if !seen[entry.Category] && entry.Category != "" {
+			seen[entry.Category] = true
+			categories = append(categories, entry.Category)
+		}
+	}
+	return categories
+}
+
+//EventKnowledgeMatches reports whether a category is kept by the '-ekf' filter
+//Each comma delimited filter matches the start of a category, ignoring case and spaces, so "auth" matches "Authentication"
+func EventKnowledgeMatches(filter string, category string) bool {
+	if filter == "" {
+		return true
+	}
+	category = strings.ToLower(strings.Replace(category, " ", "", -1))
+	if category == "" {
+		return false
+	}
+	for _, part := range strings.Split(filter, ",") {
+		part = strings.ToLower(strings.Replace(part, " ", "", -1))
+		if part != "" && strings.HasPrefix(category, part) {
+			return true
+		}
+	}
+	return false
+}
+
+//EnrichEventKnowledge adds "EventSeverity", "EventCategory", and "EventDescription" columns to EventLogItem audits
+//and drops the rows not kept by the '-ekf' filter
+func EnrichEventKnowledge(options Options, auditType string, csvHeaders []string, csvRows [][]string) ([]string, [][]string) {
+	if strings.ToLower(auditType) != "eventlogitem" || options.EventKnowledgePack == nil {
+		return csvHeaders, csvRows
+	}
+	col_index_eid := -1
+	col_index_source := -1
+	for i, header := range csvHeaders {
+		if header == "EID" {
+			col_index_eid = i
+		} else if header == "source" {
+			col_index_source = i
+		}
+	}
+	if col_index_eid == -1 {
+		return csvHeaders, csvRows
+	}
+
+	csvHeaders = append(csvHeaders, "EventSeverity", "EventCategory", "EventDescription")
+	keptRows := csvRows[:0]
+	for i := 0; i < len(csvRows); i++ {
+		source := ""
+		if col_index_source != -1 {
+			source = csvRows[i][col_index_source]
+		}
+		entry, _ := LookupEventKnowledge(options.EventKnowledgePack, source, csvRows[i][col_index_eid])
+		if !EventKnowledgeMatches(options.EventKnowledgeFilter, entry.Category) {
+			continue
+		}
+		keptRows = append(keptRows, append(csvRows[i], entry.Severity, entry.Category, entry.Description))
+	}
+	return csvHeaders, keptRows
+}
@@ -24,28 +24,21 @@ import (
 	"time"
 )
 
+//SplitEventGenerator is the itemList generator of the per-event-type XML files written by '-ebs'
+const SplitEventGenerator = "eventbufferGAP"
+
 func GoAuditEventSplitter_Start(options Options) {
 	//Set Random seed for GUIDs
 	rand.Seed(time.Now().UnixNano())
 
 	// Make output directory if it doesn't exist
 	if _, err := os.Stat(options.EventBufferSplitDir); os.IsNotExist(err) {
-		if err = os.MkdirAll(options.EventBufferSplitDir, os.ModePerm); err != nil {
-			fmt.Println(options.Warnbox + "ERROR - Could not create output directory '" + options.EventBufferSplitDir + "'.")
+		if err = MkdirAllOutput(options, options.EventBufferSplitDir); err != nil {
+			options.Log.Println(options.Warnbox + "ERROR - Could not create output directory '" + options.EventBufferSplitDir + "'.")
 			log.Fatal(err)
 		}
 	} else if options.WipeOutput {
-		outputfiles, _ := ioutil.ReadDir(options.EventBufferSplitDir)
-		if len(outputfiles) > 0 {
-			fmt.Println(options.Box + "Deleting all pre-existing XML files in the output directory '" + options.EventBufferSplitDir + "' as specified with the '-wo' flag.")
-			for _, file := range outputfiles {
-				var filename = file.Name()
-				if strings.HasSuffix(filename, ".xml") {
-					fmt.Println(options.Box + "Removing pre-existing XML file '" + filename + "'...")
-					os.Remove(filepath.Join(options.EventBufferSplitDir, filename))
-				}
-			}
-		}
+		WipeOutputDirectory(options, options.EventBufferSplitDir, ".xml")
 	}
 
 	// Get input files
@@ -60,12 +53,12 @@ func GoAuditEventSplitter_Start(options Options) {
 		dirfiles, err_r := ioutil.ReadDir(options.InputPath)
 
 		if err_r != nil {
-			fmt.Println(options.Warnbox + "ERROR - Could not read input as an existing file or directory '" + options.InputPath + "'.")
+			options.Log.Println(options.Warnbox + "ERROR - Could not read input as an existing file or directory '" + options.InputPath + "'.")
 			log.Fatal(err_r)
 		}
 
 		if len(dirfiles) == 0 {
-			fmt.Println(options.Warnbox + "ERROR - No files found in input directory '" + options.InputPath + "'.")
+			options.Log.Println(options.Warnbox + "ERROR - No files found in input directory '" + options.InputPath + "'.")
 			return
 		}
 
@@ -78,24 +71,24 @@ func GoAuditEventSplitter_Start(options Options) {
 		files = dirfiles
 	}
 
-	fmt.Println(options.Box + "Splitting eventbuffer and stateagentinspector audits...")
+	options.Log.Println(options.Box + "Splitting eventbuffer and stateagentinspector audits...")
 	for _, file := range files {
 		//skip files already split        // Split EventBuffer Files
 		if filepath.Ext(file.Name()) == ".issues" || strings.HasSuffix(strings.TrimSuffix(filepath.Base(file.Name()), filepath.Ext(file.Name())), "issues") {
 			continue
 		}
 		if strings.Contains(file.Name(), "-eventbuffer") {
-			fmt.Println(options.Box + "Splitting '" + file.Name() + "'...")
+			options.Log.Println(options.Box + "Splitting '" + file.Name() + "'...")
 			originalFileName := filepath.Join(options.InputPath, file.Name())
 			originalFile, err_o := os.Open(originalFileName)
 			if err_o != nil {
-				fmt.Println(options.Warnbox + "ERROR - Could not open file '" + originalFileName + "' to split.")
+				options.Log.Println(options.Warnbox + "ERROR - Could not open file '" + originalFileName + "' to split.")
 				log.Fatal(err_o)
 			}
 
 			parts := strings.Split(file.Name(), "-")
 			if len(parts) < 4 {
-				fmt.Println(options.Warnbox + "ERROR - File '" + originalFileName + "' does not match standard naming scheme, and could not be split.")
+				options.Log.Println(options.Warnbox + "ERROR - File '" + originalFileName + "' does not match standard naming scheme, and could not be split.")
 			}
 			hostname := strings.Join(parts[0:len(parts)-3], "-")
 			agentid := parts[len(parts)-3]
@@ -149,7 +142,7 @@ func GoAuditEventSplitter_Start(options Options) {
 				if state == STATE_HEADER && rowCount == 1 {
 					line = strings.TrimSpace(line)
 					if !strings.HasPrefix(line, "<?xml ") {
-						fmt.Println(options.Warnbox + "ERROR - Unexpected 1st Line: '" + line + "'.")
+						options.Log.Println(options.Warnbox + "ERROR - Unexpected 1st Line: '" + line + "'.")
 						return
 					}
 					header = line + "\n"
@@ -159,10 +152,10 @@ func GoAuditEventSplitter_Start(options Options) {
 				if state == STATE_HEADER && rowCount == 2 {
 					line = strings.TrimSpace(line)
 					if !strings.HasPrefix(line, "<itemList ") {
-						fmt.Println(options.Warnbox + "ERROR - Unexpected 2nd Line: '" + line + "'.")
+						options.Log.Println(options.Warnbox + "ERROR - Unexpected 2nd Line: '" + line + "'.")
 						return
 					}
-					header += `<itemList generator="eventbufferGAP" generatorVersion="29.7.8">` + "\n"
+					header += `<itemList generator="` + SplitEventGenerator + `" generatorVersion="29.7.8">` + "\n"
 					state = STATE_EXPECTING_EVENTOPEN_OR_END
 					continue
 				}
@@ -178,7 +171,7 @@ func GoAuditEventSplitter_Start(options Options) {
 					//Check if <eventItem.*>
 					m := regEventOpen.FindStringSubmatch(line)
 					if len(m) < 1 {
-						fmt.Println(options.Warnbox + `ERROR - Expected '^[ \t]*<eventItem.*>' or '</itemList>' on line ` + strconv.Itoa(rowCount) + `: ` + line)
+						options.Log.Println(options.Warnbox + `ERROR - Expected '^[ \t]*<eventItem.*>' or '</itemList>' on line ` + strconv.Itoa(rowCount) + `: ` + line)
 						return
 					}
 
@@ -205,7 +198,7 @@ func GoAuditEventSplitter_Start(options Options) {
 				if state == STATE_EXPECTING_TYPEOPEN {
 					m := regTypeOpen.FindStringSubmatch(line)
 					if len(m) < 2 {
-						fmt.Println(options.Warnbox + `ERROR - Expected Event Type '^[ \t]*<([A-Za-z0-9]+)>' on line ` + strconv.Itoa(rowCount) + `: ` + line)
+						options.Log.Println(options.Warnbox + `ERROR - Expected Event Type '^[ \t]*<([A-Za-z0-9]+)>' on line ` + strconv.Itoa(rowCount) + `: ` + line)
 						return
 					}
 					eventType = UpperCamelCase(m[1])
@@ -232,7 +225,7 @@ func GoAuditEventSplitter_Start(options Options) {
 					if len(m1) > 1 {
 						eventCloseType := UpperCamelCase(m1[1])
 						if eventType != eventCloseType {
-							fmt.Println(options.Warnbox + `ERROR - Event Type Close did not match '` + eventType + `' on line ` + strconv.Itoa(rowCount) + `: ` + line)
+							options.Log.Println(options.Warnbox + `ERROR - Event Type Close did not match '` + eventType + `' on line ` + strconv.Itoa(rowCount) + `: ` + line)
 							return
 						}
 						record += " </" + eventType + "Item>\n"
@@ -255,13 +248,13 @@ func GoAuditEventSplitter_Start(options Options) {
 						value := m2[2]
 						if field == "Timestamp" {
 							field = "GeneratedTime"
-							value = value[0:19] + "Z"
+							value = AuditTimeSeconds(value)
 						}
 						if field == "StartTime" {
-							value = value[0:19] + "Z"
+							value = AuditTimeSeconds(value)
 						}
 						if field == "EndTime" {
-							value = value[0:19] + "Z"
+							value = AuditTimeSeconds(value)
 						}
 						if field == "Md5" {
 							field = "Md5sum"
@@ -278,13 +271,13 @@ func GoAuditEventSplitter_Start(options Options) {
 						value := m3[2]
 						if field == "Timestamp" {
 							field = "GeneratedTime"
-							value = value[0:19] + "Z"
+							value = AuditTimeSeconds(value)
 						}
 						if field == "StartTime" {
-							value = value[0:19] + "Z"
+							value = AuditTimeSeconds(value)
 						}
 						if field == "EndTime" {
-							value = value[0:19] + "Z"
+							value = AuditTimeSeconds(value)
 						}
 						if field == "Md5" {
 							field = "Md5sum"
@@ -310,7 +303,7 @@ func GoAuditEventSplitter_Start(options Options) {
 						continue
 					}
 
-					fmt.Println(options.Warnbox + `ERROR - Expected Record Close '^[ \t]*<(/[A-Za-z0-9]+)>$', SingleLine Field '^[ \t]*<([A-Za-z0-9]+)>(.*)</[A-Za-z0-9]+>$', Closed SingleLine Field '', or MultiLine Field Open '^[ \t]*<([A-Za-z0-9]+)>(.*)' on line ` + strconv.Itoa(rowCount) + `: ` + line)
+					options.Log.Println(options.Warnbox + `ERROR - Expected Record Close '^[ \t]*<(/[A-Za-z0-9]+)>$', SingleLine Field '^[ \t]*<([A-Za-z0-9]+)>(.*)</[A-Za-z0-9]+>$', Closed SingleLine Field '', or MultiLine Field Open '^[ \t]*<([A-Za-z0-9]+)>(.*)' on line ` + strconv.Itoa(rowCount) + `: ` + line)
 					return
 				}
 
@@ -322,19 +315,19 @@ func GoAuditEventSplitter_Start(options Options) {
 						field := UpperCamelCase(m[2])
 						if field == "Timestamp" {
 							field = "GeneratedTime"
-							value = value[0:19] + "Z"
+							value = AuditTimeSeconds(value)
 						}
 						if field == "StartTime" {
-							value = value[0:19] + "Z"
+							value = AuditTimeSeconds(value)
 						}
 						if field == "EndTime" {
-							value = value[0:19] + "Z"
+							value = AuditTimeSeconds(value)
 						}
 						if field == "Md5" {
 							field = "Md5sum"
 						}
 						if fieldType != field {
-							fmt.Println(options.Warnbox + `ERROR - MultiLine Field Type Close '(.*)</([A-Za-z0-9]+)>$' did not match '` + fieldType + `' on line ` + strconv.Itoa(rowCount) + `: ` + line)
+							options.Log.Println(options.Warnbox + `ERROR - MultiLine Field Type Close '(.*)</([A-Za-z0-9]+)>$' did not match '` + fieldType + `' on line ` + strconv.Itoa(rowCount) + `: ` + line)
 							return
 						}
 						record += value + "</" + field + ">\n"
@@ -354,7 +347,7 @@ func GoAuditEventSplitter_Start(options Options) {
 						state = STATE_EXPECTING_EVENTOPEN_OR_END
 						continue
 					}
-					fmt.Println(options.Warnbox + `ERROR - Expected Event Close '^[ \t]*</eventItem>$' on line ` + strconv.Itoa(rowCount) + `: ` + line)
+					options.Log.Println(options.Warnbox + `ERROR - Expected Event Close '^[ \t]*</eventItem>$' on line ` + strconv.Itoa(rowCount) + `: ` + line)
 					return
 				}
 
@@ -366,9 +359,10 @@ func GoAuditEventSplitter_Start(options Options) {
 			//Create the split files
 			for auditType, records := range splitEventFiles {
 				outputFilePath := splitFileNameStart + auditType + "Item.xml"
-				outputFile, err_c := os.Create(outputFilePath)
+				outputFilePathTemp := TempOutputPath(options, outputFilePath)
+				outputFile, err_c := CreateOutputFile(options, outputFilePathTemp)
 				if err_c != nil {
-					fmt.Println(options.Warnbox + "ERROR - Could not create split file '" + outputFilePath + "'.")
+					options.Log.Println(options.Warnbox + "ERROR - Could not create split file '" + outputFilePathTemp + "'.")
 					log.Fatal(err_c)
 				}
 
@@ -379,20 +373,24 @@ func GoAuditEventSplitter_Start(options Options) {
 				outputFile.WriteString("</itemList>")
 				outputFile.Sync()
 				outputFile.Close()
+				if err_r := os.Rename(outputFilePathTemp, outputFilePath); err_r != nil {
+					options.Log.Println(options.Warnbox + "ERROR - Could not rename temp file '" + outputFilePathTemp + "' to split file '" + outputFilePath + "'.")
+					log.Fatal(err_r)
+				}
 			}
 
 		} else if strings.Contains(file.Name(), "-stateagentinspector") {
-			fmt.Println(options.Box + "Splitting '" + file.Name() + "'...")
+			options.Log.Println(options.Box + "Splitting '" + file.Name() + "'...")
 			originalFileName := filepath.Join(options.InputPath, file.Name())
 			originalFile, err_o := os.Open(originalFileName)
 			if err_o != nil {
-				fmt.Println(options.Warnbox + "ERROR - Could not open file '" + originalFileName + "' to split.")
+				options.Log.Println(options.Warnbox + "ERROR - Could not open file '" + originalFileName + "' to split.")
 				log.Fatal(err_o)
 			}
 
 			parts := strings.Split(file.Name(), "-")
 			if len(parts) < 4 {
-				fmt.Println(options.Warnbox + "ERROR - File '" + originalFileName + "' does not match standard naming scheme, and could not be split.")
+				options.Log.Println(options.Warnbox + "ERROR - File '" + originalFileName + "' does not match standard naming scheme, and could not be split.")
 			}
 			hostname := strings.Join(parts[0:len(parts)-3], "-")
 			agentid := parts[len(parts)-3]
@@ -458,7 +456,7 @@ func GoAuditEventSplitter_Start(options Options) {
 				if state == STATE_HEADER && rowCount == 1 {
 					line = strings.TrimSpace(line)
 					if !strings.HasPrefix(line, "<?xml ") {
-						fmt.Println(options.Warnbox + "ERROR - Unexpected 1st Line: '" + line + "'.")
+						options.Log.Println(options.Warnbox + "ERROR - Unexpected 1st Line: '" + line + "'.")
 						return
 					}
 					header = line + "\n"
@@ -468,10 +466,10 @@ func GoAuditEventSplitter_Start(options Options) {
 				if state == STATE_HEADER && rowCount == 2 {
 					line = strings.TrimSpace(line)
 					if !strings.HasPrefix(line, "<itemList ") {
-						fmt.Println(options.Warnbox + "ERROR - Unexpected 2nd Line: '" + line + "'.")
+						options.Log.Println(options.Warnbox + "ERROR - Unexpected 2nd Line: '" + line + "'.")
 						return
 					}
-					header += `<itemList generator="eventbufferGAP" generatorVersion="29.7.8">` + "\n"
+					header += `<itemList generator="` + SplitEventGenerator + `" generatorVersion="29.7.8">` + "\n"
 					state = STATE_EXPECTING_EVENTOPEN_OR_END
 					continue
 				}
@@ -487,7 +485,7 @@ func GoAuditEventSplitter_Start(options Options) {
 					//regEventOpen     := regexp.MustCompile(`^[ \t]*<eventItem.*>$`)                         // <eventItem sequence_num="1670535298" uid="6209762">
 					m := regEventOpen.FindStringSubmatch(line)
 					if len(m) < 1 {
-						fmt.Println(options.Warnbox + `ERROR - Expected '^[ \t]*<eventItem.*>' or '</itemList>' on line ` + strconv.Itoa(rowCount) + `: ` + line)
+						options.Log.Println(options.Warnbox + `ERROR - Expected '^[ \t]*<eventItem.*>' or '</itemList>' on line ` + strconv.Itoa(rowCount) + `: ` + line)
 						return
 					}
 
@@ -517,12 +515,12 @@ func GoAuditEventSplitter_Start(options Options) {
 					if len(m) < 2 {
 						m2 := regTimestampClosed.FindStringSubmatch(line)
 						if len(m2) < 1 {
-							fmt.Println(options.Warnbox + `ERROR - Expected Timestamp '^[ \t]*<timestamp>(.*)</timestamp>$' or '^[ \t]*<timestamp />$' on line ` + strconv.Itoa(rowCount) + `: ` + line)
+							options.Log.Println(options.Warnbox + `ERROR - Expected Timestamp '^[ \t]*<timestamp>(.*)</timestamp>$' or '^[ \t]*<timestamp />$' on line ` + strconv.Itoa(rowCount) + `: ` + line)
 							return
 						}
 						field_timestamp = ""
 					} else {
-						field_timestamp = m[1][0:19] + "Z"
+						field_timestamp = AuditTimeSeconds(m[1])
 					}
 					state = STATE_EXPECTING_EVENTTYPE
 					continue
@@ -532,7 +530,7 @@ func GoAuditEventSplitter_Start(options Options) {
 					//regType          := regexp.MustCompile(`^[ \t]*<eventType>(.*)</eventType>$`)           //  <eventType>dnsLookupEvent</eventType>
 					m := regType.FindStringSubmatch(line)
 					if len(m) < 2 {
-						fmt.Println(options.Warnbox + `ERROR - Expected Event Type '^[ \t]*<eventType>(.*)</eventType>$' on line ` + strconv.Itoa(rowCount) + `: ` + line)
+						options.Log.Println(options.Warnbox + `ERROR - Expected Event Type '^[ \t]*<eventType>(.*)</eventType>$' on line ` + strconv.Itoa(rowCount) + `: ` + line)
 						return
 					}
 					eventType = UpperCamelCase(m[1])
@@ -558,7 +556,7 @@ func GoAuditEventSplitter_Start(options Options) {
 					//regDetailsOpen   := regexp.MustCompile(`^[ \t]*<details>$`)                             //  <details>
 					m := regDetailsOpen.FindStringSubmatch(line)
 					if len(m) == 0 {
-						fmt.Println(options.Warnbox + `ERROR - Expected Details Open Tag '^[ \t]*<details>$' on line ` + strconv.Itoa(rowCount) + `: ` + line)
+						options.Log.Println(options.Warnbox + `ERROR - Expected Details Open Tag '^[ \t]*<details>$' on line ` + strconv.Itoa(rowCount) + `: ` + line)
 						return
 					}
 					state = STATE_EXPECTING_DETAILOPEN_OR_DETAILSCLOSE
@@ -587,7 +585,7 @@ func GoAuditEventSplitter_Start(options Options) {
 					//regDetailOpen    := regexp.MustCompile(`^[ \t]*<detail>$`)                              //   <detail>
 					m2 := regDetailOpen.FindStringSubmatch(line)
 					if len(m2) == 0 {
-						fmt.Println(options.Warnbox + `ERROR - Expected Details Open Tag '^[ \t]*<details>$' or Details Close Tag '^[ \t]*</details>$' on line ` + strconv.Itoa(rowCount) + `: ` + line)
+						options.Log.Println(options.Warnbox + `ERROR - Expected Details Open Tag '^[ \t]*<details>$' or Details Close Tag '^[ \t]*</details>$' on line ` + strconv.Itoa(rowCount) + `: ` + line)
 						return
 					}
 					state = STATE_EXPECTING_DETAILNAME
@@ -599,7 +597,7 @@ func GoAuditEventSplitter_Start(options Options) {
 					m := regName.FindStringSubmatch(line)
 
 					if len(m) < 2 {
-						fmt.Println(options.Warnbox + `ERROR - Expected Detail Name '^[ \t]*<name>(.*)</name>$ on line ` + strconv.Itoa(rowCount) + `: ` + line)
+						options.Log.Println(options.Warnbox + `ERROR - Expected Detail Name '^[ \t]*<name>(.*)</name>$ on line ` + strconv.Itoa(rowCount) + `: ` + line)
 						return
 					}
 					field_name = UpperCamelCase(m[1])
@@ -616,10 +614,10 @@ func GoAuditEventSplitter_Start(options Options) {
 					if len(m) == 2 {
 						value := m[1]
 						if field_name == "StartTime" {
-							value = value[0:19] + "Z"
+							value = AuditTimeSeconds(value)
 						}
 						if field_name == "EndTime" {
-							value = value[0:19] + "Z"
+							value = AuditTimeSeconds(value)
 						}
 						record += "  <" + field_name + ">" + value + "</" + field_name + ">\n"
 						field_name = ""
@@ -639,7 +637,7 @@ func GoAuditEventSplitter_Start(options Options) {
 					//regValueMLOpen   := regexp.MustCompile(`^[ \t]*<value>(.*)$`)                           //    <value>POST /wsman HTTP/1.1
 					m2 := regValueMLOpen.FindStringSubmatch(line)
 					if len(m2) < 2 {
-						fmt.Println(options.Warnbox + `ERROR - Expected Detail Value SingleLine '^[ \t]*<value>(.*)</value>$' or MultiLine Open '^[ \t]*<value>(.*)$' on line ` + strconv.Itoa(rowCount) + `: ` + line)
+						options.Log.Println(options.Warnbox + `ERROR - Expected Detail Value SingleLine '^[ \t]*<value>(.*)</value>$' or MultiLine Open '^[ \t]*<value>(.*)$' on line ` + strconv.Itoa(rowCount) + `: ` + line)
 						return
 					}
 					record += "  <" + field_name + ">" + m2[1] + "\n"
@@ -664,7 +662,7 @@ func GoAuditEventSplitter_Start(options Options) {
 					//regDetailClose   := regexp.MustCompile(`^[ \t]*</detail>$`)                             //   </detail>
 					m := regDetailClose.FindStringSubmatch(line)
 					if len(m) == 0 {
-						fmt.Println(options.Warnbox + `ERROR - Expected Detail Close Tag '^[ \t]*</detail>$' on line ` + strconv.Itoa(rowCount) + `: ` + line)
+						options.Log.Println(options.Warnbox + `ERROR - Expected Detail Close Tag '^[ \t]*</detail>$' on line ` + strconv.Itoa(rowCount) + `: ` + line)
 						return
 					}
 					state = STATE_EXPECTING_DETAILOPEN_OR_DETAILSCLOSE
@@ -676,7 +674,7 @@ func GoAuditEventSplitter_Start(options Options) {
 					//regEventClose    := regexp.MustCompile(`^[ \t]*</eventItem>$`)                          // </eventItem>
 					m := regEventClose.FindStringSubmatch(line)
 					if len(m) == 0 {
-						fmt.Println(options.Warnbox + `ERROR - Expected Event Close Tag '^[ \t]*</eventItem>$' on line ` + strconv.Itoa(rowCount) + `: ` + line)
+						options.Log.Println(options.Warnbox + `ERROR - Expected Event Close Tag '^[ \t]*</eventItem>$' on line ` + strconv.Itoa(rowCount) + `: ` + line)
 						return
 					}
 
@@ -691,9 +689,10 @@ func GoAuditEventSplitter_Start(options Options) {
 			//Create the split files
 			for auditType, records := range splitEventFiles {
 				outputFilePath := splitFileNameStart + auditType + "Item.xml"
-				outputFile, err_c := os.Create(outputFilePath)
+				outputFilePathTemp := TempOutputPath(options, outputFilePath)
+				outputFile, err_c := CreateOutputFile(options, outputFilePathTemp)
 				if err_c != nil {
-					fmt.Println(options.Warnbox + "ERROR - Could not create split file '" + outputFilePath + "'.")
+					options.Log.Println(options.Warnbox + "ERROR - Could not create split file '" + outputFilePathTemp + "'.")
 					log.Fatal(err_c)
 				}
 
@@ -704,6 +703,10 @@ func GoAuditEventSplitter_Start(options Options) {
 				outputFile.WriteString("</itemList>")
 				outputFile.Sync()
 				outputFile.Close()
+				if err_r := os.Rename(outputFilePathTemp, outputFilePath); err_r != nil {
+					options.Log.Println(options.Warnbox + "ERROR - Could not rename temp file '" + outputFilePathTemp + "' to split file '" + outputFilePath + "'.")
+					log.Fatal(err_r)
+				}
 			}
 		}
 	}
@@ -730,3 +733,64 @@ func NewGUID() string {
 
 	return guid
 }
+
+//SplitEventAuditType returns the audit type an item of a '-ebs' file is parsed as, and its event type,
+//so "DnsLookupEventItem" is parsed as "EventItem_DnsLookupEvent" like the eventbuffer audit it was split from
+func SplitEventAuditType(itemName string) (string, string) {
+	eventType := strings.TrimSuffix(itemName, "Item")
+	return "EventItem_" + eventType, eventType
+}
+
+//RestoreSplitEventHeaders renames the columns of a parsed '-ebs' file back to those of its original audit, so the CSV matches
+//parsing the original and the timeline config applies to it. The uid and created time the splitter made up for each item are dropped
+func RestoreSplitEventHeaders(eventType string, headers map[string]int, rows []map[int]*strings.Builder) map[string]int {
+	delete(headers, "Audit UID")
+	delete(headers, "FireEyeGeneratedTime")
+	renames := map[string]string{
+		"GeneratedTime":                   "EventBufferTime_" + eventType,
+		"Md5sum":                          "Md5",
+		"Hostname" + duplicateHeaderSuffix: "DNSHostname",
+	}
+	for header, renamed := range renames {
+		colID, found := headers[header]
+		if _, exists := headers[renamed]; found && !exists {
+			delete(headers, header)
+			headers[renamed] = colID
+		}
+	}
+	nextColID := 0
+	for _, colID := range headers {
+		if colID >= nextColID {
+			nextColID = colID + 1
+		}
+	}
+	headers["EventBufferType"] = nextColID
+	for _, row := range rows {
+		row[nextColID] = &strings.Builder{}
+		row[nextColID].WriteString(eventType)
+	}
+	return headers
+}
+
+//RemoveSplitEventDuplicates removes '-ebs' files whose original eventbuffer or stateagentinspector audit is also in the input,
+//since parsing the original writes the same CSV files. Returns the remaining files and the number removed
+func RemoveSplitEventDuplicates(files []os.FileInfo) ([]os.FileInfo, int) {
+	names := map[string]bool{}
+	for _, file := range files {
+		names[file.Name()] = true
+	}
+	removed := 0
+	for i := 0; i < len(files); i++ {
+		name := files[i].Name()
+		if !strings.HasSuffix(name, "Item.xml") || !strings.Contains(name, "-") {
+			continue
+		}
+		prefix := name[0 : strings.LastIndex(name, "-")+1]
+		if names[prefix+"eventbuffer.xml"] || names[prefix+"stateagentinspector.xml"] {
+			files = append(files[:i], files[i+1:]...)
+			i--
+			removed++
+		}
+	}
+	return files, removed
+}
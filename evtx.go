@@ -0,0 +1,866 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+//Sizes of the EVTX file header and of each chunk of event records
+const (
+	evtxHeaderSize = 4096
+	evtxChunkSize  = 65536
+)
+
+//Embedded BinXML fragments of substitution values nest no deeper than this
+const evtxMaxDepth = 32
+
+//Templates and fragments which instantiate each other can expand a corrupt record exponentially,
+//so a record renders no more than this many elements and template instances
+const evtxMaxElements = 100000
+
+//Keywords of Security audit events
+const (
+	evtxKeywordAuditFailure = 0x10000000000000
+	evtxKeywordAuditSuccess = 0x20000000000000
+)
+
+//"Security.evtx", or "..._Security.evtx_" as acquired files are named with '-eff <int>'
+var regEVTXFileName = regexp.MustCompile(`(?i)\.evtx_?$`)
+
+//IsEVTXFile returns true if an acquired file is a Windows event log by its name and "ElfFile" signature
+func IsEVTXFile(path string) bool {
+	if !regEVTXFileName.MatchString(path) {
+		return false
+	}
+	file, err_o := os.Open(path)
+	if err_o != nil {
+		return false
+	}
+	defer file.Close()
+	signature := make([]byte, 8)
+	if _, err_r := io.ReadFull(file, signature); err_r != nil {
+		return false
+	}
+	return string(signature) == "ElfFile\x00"
+}
+
+//evtxElement is an XML element of an event record rendered from BinXML
+type evtxElement struct {
+	name     string
+	attrs    [][2]string
+	children []*evtxElement
+	text     strings.Builder
+}
+
+//attr returns the value of an attribute, "" if the element is nil or does not have it
+func (el *evtxElement) attr(name string) string {
+	if el == nil {
+		return ""
+	}
+	for _, attr := range el.attrs {
+		if attr[0] == name {
+			return attr[1]
+		}
+	}
+	return ""
+}
+
+//child returns the first child element with the name, or nil
+func (el *evtxElement) child(name string) *evtxElement {
+	if el == nil {
+		return nil
+	}
+	for _, child := range el.children {
+		if child.name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+//value returns the text of the element, "" if it is nil
+func (el *evtxElement) value() string {
+	if el == nil {
+		return ""
+	}
+	return strings.TrimSpace(el.text.String())
+}
+
+//evtxValue is a substitution value of a template instance, data is a slice of the chunk at offset
+type evtxValue struct {
+	vtype  byte
+	offset int
+	data   []byte
+}
+
+//evtxParser reads the BinXML of one chunk. Names and templates are referenced by their offset in the chunk,
+//so pos is always an offset in the chunk, also for fragments embedded in substitution values
+type evtxParser struct {
+	chunk    []byte
+	pos      int
+	end      int
+	values   []evtxValue
+	embedded bool //Fragment of a substitution value, whose elements have no dependency identifier
+	depth    int
+	current  [2]int //Start and end of the template definition being rendered
+	budget   *int   //Elements and template instances the record may still render, shared with nested parsers
+	err      error
+}
+
+func (p *evtxParser) fail(msg string) {
+	if p.err == nil {
+		p.err = errors.New(msg + " at chunk offset " + strconv.Itoa(p.pos))
+	}
+}
+
+//spend returns true if the record may render one more element or template instance
+func (p *evtxParser) spend() bool {
+	if p.err != nil {
+		return false
+	}
+	if *p.budget <= 0 {
+		p.fail("BinXML expands to more than " + strconv.Itoa(evtxMaxElements) + " elements")
+		return false
+	}
+	*p.budget--
+	return true
+}
+
+//need returns true if n more bytes can be read before the end
+func (p *evtxParser) need(n int) bool {
+	if p.err != nil {
+		return false
+	}
+	if n < 0 || p.pos+n > p.end {
+		p.fail("BinXML is cut off")
+		return false
+	}
+	return true
+}
+
+func (p *evtxParser) peek() byte {
+	if !p.need(1) {
+		return 0
+	}
+	return p.chunk[p.pos]
+}
+
+func (p *evtxParser) u8() byte {
+	if !p.need(1) {
+		return 0
+	}
+	p.pos++
+	return p.chunk[p.pos-1]
+}
+
+func (p *evtxParser) u16() int {
+	if !p.need(2) {
+		return 0
+	}
+	p.pos += 2
+	return int(binary.LittleEndian.Uint16(p.chunk[p.pos-2:]))
+}
+
+func (p *evtxParser) u32() int {
+	if !p.need(4) {
+		return 0
+	}
+	p.pos += 4
+	return int(binary.LittleEndian.Uint32(p.chunk[p.pos-4:]))
+}
+
+func (p *evtxParser) skip(n int) {
+	if p.need(n) {
+		p.pos += n
+	}
+}
+
+//utf16 reads count UTF-16 characters
+func (p *evtxParser) utf16(count int) string {
+	if !p.need(count * 2) {
+		return ""
+	}
+	s := evtxUTF16(p.chunk[p.pos : p.pos+count*2])
+	p.pos += count * 2
+	return s
+}
+
+//nameAt returns the name stored at an offset of the chunk, skipping over it if it is stored right here
+func (p *evtxParser) nameAt(offset int) string {
+	if p.err != nil {
+		return ""
+	}
+	if offset+8 > len(p.chunk) {
+		p.fail("name offset " + strconv.Itoa(offset) + " is outside of the chunk")
+		return ""
+	}
+	count := int(binary.LittleEndian.Uint16(p.chunk[offset+6:]))
+	if offset+8+count*2 > len(p.chunk) {
+		p.fail("name at offset " + strconv.Itoa(offset) + " is cut off")
+		return ""
+	}
+	name := evtxUTF16(p.chunk[offset+8 : offset+8+count*2])
+	if offset == p.pos {
+		p.skip(8 + count*2 + 2) //Next offset, hash, count, characters, null terminator
+	}
+	return name
+}
+
+//name reads the offset of a name and returns the name
+func (p *evtxParser) name() string {
+	return p.nameAt(p.u32())
+}
+
+//fragment reads elements and template instances up to the end of stream token
+func (p *evtxParser) fragment() []*evtxElement {
+	elements := []*evtxElement{}
+	for p.err == nil && p.pos < p.end {
+		switch p.peek() {
+		case 0x00:
+			p.pos++
+			return elements
+		case 0x0f:
+			p.skip(4) //Fragment header, major and minor version, flags
+		case 0x0c:
+			elements = append(elements, p.template()...)
+		case 0x01, 0x41:
+			elements = append(elements, p.element())
+		default:
+			p.fail("unexpected BinXML token 0x" + strconv.FormatInt(int64(p.peek()), 16))
+		}
+	}
+	return elements
+}
+
+//template reads a template instance and renders its template definition with the substitution values
+func (p *evtxParser) template() []*evtxElement {
+	p.skip(2) //Token, unknown
+	p.skip(4) //Template identifier
+	definition := p.u32()
+	if p.err != nil {
+		return nil
+	}
+	if p.depth >= evtxMaxDepth {
+		p.fail("BinXML is nested too deep")
+		return nil
+	}
+	if !p.spend() {
+		return nil
+	}
+	//A corrupt template which instantiates itself would never finish rendering
+	if definition >= p.current[0] && definition < p.current[1] {
+		p.fail("template at offset " + strconv.Itoa(definition) + " instantiates itself")
+		return nil
+	}
+	if definition+24 > len(p.chunk) {
+		p.fail("template offset " + strconv.Itoa(definition) + " is outside of the chunk")
+		return nil
+	}
+	size := int(binary.LittleEndian.Uint32(p.chunk[definition+20:]))
+	if definition+24+size > len(p.chunk) {
+		p.fail("template at offset " + strconv.Itoa(definition) + " is cut off")
+		return nil
+	}
+	//Templates are stored in the first record which uses them
+	if definition == p.pos {
+		p.skip(24 + size)
+	}
+
+	count := p.u32()
+	if !p.need(count * 4) {
+		return nil
+	}
+	//Value descriptors of size and type, followed by the values
+	values := make([]evtxValue, count)
+	lengths := make([]int, count)
+	for i := range values {
+		lengths[i] = p.u16()
+		values[i].vtype = p.u8()
+		p.skip(1)
+	}
+	for i := range values {
+		if !p.need(lengths[i]) {
+			return nil
+		}
+		values[i].offset = p.pos
+		values[i].data = p.chunk[p.pos : p.pos+lengths[i]]
+		p.pos += lengths[i]
+	}
+
+	t := &evtxParser{chunk: p.chunk, pos: definition + 24, end: definition + 24 + size, values: values, depth: p.depth + 1, current: [2]int{definition, definition + 24 + size}, budget: p.budget}
+	elements := t.fragment()
+	if t.err != nil {
+		p.err = t.err
+	}
+	return elements
+}
+
+//element reads an element with its attributes and content
+func (p *evtxParser) element() *evtxElement {
+	if !p.spend() {
+		return &evtxElement{}
+	}
+	token := p.u8()
+	if !p.embedded {
+		p.skip(2) //Dependency identifier
+	}
+	p.skip(4) //Data size
+	nameOffset := p.u32()
+	if token&0x40 != 0 {
+		p.skip(4) //Attribute list size
+	}
+	//A name stored right here comes after the attribute list size
+	el := &evtxElement{name: p.nameAt(nameOffset)}
+
+	for p.err == nil && p.peek()&0xbf == 0x06 {
+		p.u8()
+		attrName := p.name()
+		var value strings.Builder
+		present := true
+		for p.err == nil && evtxValueToken(p.peek()) {
+			text, ok := p.content(nil)
+			value.WriteString(text)
+			present = present && ok
+		}
+		if present {
+			el.attrs = append(el.attrs, [2]string{attrName, value.String()})
+		}
+	}
+
+	switch p.u8() {
+	case 0x03:
+		return el
+	case 0x02:
+	default:
+		p.fail("element '" + el.name + "' has no close start element token")
+		return el
+	}
+	for p.err == nil {
+		switch token := p.peek(); {
+		case token == 0x04:
+			p.pos++
+			return el
+		case token == 0x00:
+			return el
+		case token&0xbf == 0x01:
+			el.children = append(el.children, p.element())
+		case token == 0x0c:
+			el.children = append(el.children, p.template()...)
+		case token&0xbf == 0x0a:
+			p.u8()
+			p.name()
+		case token&0xbf == 0x0b:
+			p.u8()
+			p.utf16(p.u16())
+		case token&0xbf == 0x07:
+			p.u8()
+			el.text.WriteString(p.utf16(p.u16()))
+		case evtxValueToken(token):
+			text, _ := p.content(el)
+			el.text.WriteString(text)
+		default:
+			p.fail("unexpected BinXML token 0x" + strconv.FormatInt(int64(token), 16) + " in element '" + el.name + "'")
+		}
+	}
+	return el
+}
+
+//evtxValueToken returns true for the tokens of text content: values, substitutions, and references
+func evtxValueToken(token byte) bool {
+	switch token & 0xbf {
+	case 0x05, 0x08, 0x09, 0x0d, 0x0e:
+		return true
+	}
+	return false
+}
+
+//content reads a value, substitution, or reference and returns its text. Substituted BinXML fragments are added
+//as children of parent. Returns false for optional substitutions without a value, whose attributes are left out
+func (p *evtxParser) content(parent *evtxElement) (string, bool) {
+	switch token := p.u8(); token & 0xbf {
+	case 0x05:
+		p.skip(1) //Value type, always a string
+		return p.utf16(p.u16()), true
+	case 0x08:
+		return string(rune(p.u16())), true
+	case 0x09:
+		return evtxEntity(p.name()), true
+	case 0x0d, 0x0e:
+		id := p.u16()
+		p.skip(1) //Value type, also given by the value
+		if p.err != nil {
+			return "", false
+		}
+		if id >= len(p.values) {
+			p.fail("substitution " + strconv.Itoa(id) + " of " + strconv.Itoa(len(p.values)) + " values")
+			return "", false
+		}
+		value := p.values[id]
+		if token&0xbf == 0x0e && (value.vtype == 0x00 || len(value.data) == 0) {
+			return "", false
+		}
+		if value.vtype == 0x21 {
+			if p.depth >= evtxMaxDepth {
+				p.fail("BinXML is nested too deep")
+				return "", false
+			}
+			embedded := &evtxParser{chunk: p.chunk, pos: value.offset, end: value.offset + len(value.data), embedded: true, depth: p.depth + 1, current: p.current, budget: p.budget}
+			elements := embedded.fragment()
+			if embedded.err != nil {
+				p.err = embedded.err
+			}
+			if parent != nil {
+				parent.children = append(parent.children, elements...)
+			}
+			return "", true
+		}
+		return evtxFormatValue(value.vtype, value.data), true
+	}
+	p.fail("unexpected BinXML value token")
+	return "", false
+}
+
+//evtxEntity returns the character of an XML entity reference such as "amp"
+func evtxEntity(name string) string {
+	switch name {
+	case "amp":
+		return "&"
+	case "lt":
+		return "<"
+	case "gt":
+		return ">"
+	case "quot":
+		return "\""
+	case "apos":
+		return "'"
+	}
+	return "&" + name + ";"
+}
+
+//evtxUTF16 decodes little-endian UTF-16 up to the first null character
+func evtxUTF16(b []byte) string {
+	chars := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			break
+		}
+		chars = append(chars, c)
+	}
+	return string(utf16.Decode(chars))
+}
+
+//evtxFileTime converts a FILETIME, 100 nanosecond intervals since 1601, to a time in UTC
+func evtxFileTime(filetime uint64) time.Time {
+	const epochDifference = 116444736000000000 //Intervals between 1601 and 1970
+	if filetime < epochDifference {
+		return time.Unix(0, 0).UTC()
+	}
+	intervals := filetime - epochDifference
+	return time.Unix(int64(intervals/10000000), int64(intervals%10000000)*100).UTC()
+}
+
+//evtxFormatValue renders a substitution value as the Windows event viewer writes it in the XML of an event
+func evtxFormatValue(vtype byte, data []byte) string {
+	if vtype&0x80 != 0 {
+		return evtxFormatArray(vtype&0x7f, data)
+	}
+	size := len(data)
+	switch {
+	case vtype == 0x00:
+		return ""
+	case vtype == 0x01:
+		return evtxUTF16(data)
+	case vtype == 0x02:
+		return string(bytes.TrimRight(data, "\x00"))
+	case vtype == 0x03 && size >= 1:
+		return strconv.Itoa(int(int8(data[0])))
+	case vtype == 0x04 && size >= 1:
+		return strconv.Itoa(int(data[0]))
+	case vtype == 0x05 && size >= 2:
+		return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(data))))
+	case vtype == 0x06 && size >= 2:
+		return strconv.Itoa(int(binary.LittleEndian.Uint16(data)))
+	case vtype == 0x07 && size >= 4:
+		return strconv.Itoa(int(int32(binary.LittleEndian.Uint32(data))))
+	case vtype == 0x08 && size >= 4:
+		return strconv.FormatUint(uint64(binary.LittleEndian.Uint32(data)), 10)
+	case vtype == 0x09 && size >= 8:
+		return strconv.FormatInt(int64(binary.LittleEndian.Uint64(data)), 10)
+	case vtype == 0x0a && size >= 8:
+		return strconv.FormatUint(binary.LittleEndian.Uint64(data), 10)
+	case vtype == 0x0b && size >= 4:
+		return strconv.FormatFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(data))), 'g', -1, 32)
+	case vtype == 0x0c && size >= 8:
+		return strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(data)), 'g', -1, 64)
+	case vtype == 0x0d && size >= 4:
+		return strconv.FormatBool(binary.LittleEndian.Uint32(data) != 0)
+	case vtype == 0x0e:
+		return strings.ToUpper(hex.EncodeToString(data))
+	case vtype == 0x0f && size >= 16:
+		return fmt.Sprintf("{%08X-%04X-%04X-%X-%X}", binary.LittleEndian.Uint32(data), binary.LittleEndian.Uint16(data[4:]), binary.LittleEndian.Uint16(data[6:]), data[8:10], data[10:16])
+	case vtype == 0x10 && size == 4, vtype == 0x14 && size >= 4:
+		return fmt.Sprintf("0x%x", binary.LittleEndian.Uint32(data))
+	case vtype == 0x10 && size >= 8, vtype == 0x15 && size >= 8:
+		return fmt.Sprintf("0x%x", binary.LittleEndian.Uint64(data))
+	case vtype == 0x11 && size >= 8:
+		return evtxFileTime(binary.LittleEndian.Uint64(data)).Format("2006-01-02T15:04:05.0000000Z")
+	case vtype == 0x12 && size >= 16:
+		field := func(i int) int { return int(binary.LittleEndian.Uint16(data[i*2:])) }
+		return fmt.Sprintf("%04d-%02d-%02dT%02d:%02d:%02d.%03dZ", field(0), field(1), field(3), field(4), field(5), field(6), field(7))
+	case vtype == 0x13 && size >= 8:
+		return evtxSID(data)
+	}
+	return strings.ToUpper(hex.EncodeToString(data))
+}
+
+//evtxFormatArray renders an array value with its items separated by commas
+func evtxFormatArray(vtype byte, data []byte) string {
+	items := []string{}
+	if vtype == 0x01 {
+		for len(data) >= 2 {
+			end := 0
+			for end+1 < len(data) && binary.LittleEndian.Uint16(data[end:]) != 0 {
+				end += 2
+			}
+			items = append(items, evtxUTF16(data[:end]))
+			if end+2 >= len(data) {
+				break
+			}
+			data = data[end+2:]
+		}
+		return strings.Join(items, ",")
+	}
+	size := map[byte]int{0x03: 1, 0x04: 1, 0x05: 2, 0x06: 2, 0x07: 4, 0x08: 4, 0x09: 8, 0x0a: 8, 0x0b: 4, 0x0c: 8, 0x0d: 4, 0x0f: 16, 0x11: 8, 0x12: 16, 0x14: 4, 0x15: 8}[vtype]
+	if size == 0 {
+		return strings.ToUpper(hex.EncodeToString(data))
+	}
+	for len(data) >= size {
+		items = append(items, evtxFormatValue(vtype, data[:size]))
+		data = data[size:]
+	}
+	return strings.Join(items, ",")
+}
+
+//evtxSID renders a security identifier such as "S-1-5-18"
+func evtxSID(data []byte) string {
+	count := int(data[1])
+	if 8+count*4 > len(data) {
+		return strings.ToUpper(hex.EncodeToString(data))
+	}
+	authority := uint64(0)
+	for _, b := range data[2:8] {
+		authority = authority<<8 | uint64(b)
+	}
+	sid := "S-" + strconv.Itoa(int(data[0])) + "-" + strconv.FormatUint(authority, 10)
+	for i := 0; i < count; i++ {
+		sid += "-" + strconv.FormatUint(uint64(binary.LittleEndian.Uint32(data[8+i*4:])), 10)
+	}
+	return sid
+}
+
+//evtxEventType returns the EventLogItem "type" of an event by its level and keywords
+func evtxEventType(level string, keywords string) string {
+	if k, err_p := strconv.ParseUint(strings.TrimPrefix(keywords, "0x"), 16, 64); err_p == nil {
+		if k&evtxKeywordAuditSuccess != 0 {
+			return "Success Audit"
+		}
+		if k&evtxKeywordAuditFailure != 0 {
+			return "Failure Audit"
+		}
+	}
+	switch level {
+	case "1":
+		return "Critical"
+	case "2":
+		return "Error"
+	case "3":
+		return "Warning"
+	case "5":
+		return "Verbose"
+	}
+	return "Information"
+}
+
+//evtxEventData returns the names and values of the EventData or UserData of an event in order
+//Values without a name, such as those of classic events, get an empty name
+func evtxEventData(event *evtxElement) [][2]string {
+	data := [][2]string{}
+	if eventData := event.child("EventData"); eventData != nil {
+		for _, child := range eventData.children {
+			if child.name == "Binary" {
+				continue
+			}
+			data = append(data, [2]string{child.attr("Name"), child.value()})
+		}
+		return data
+	}
+	//UserData holds one element of the provider, whose leaf elements are the values
+	var walk func(el *evtxElement)
+	walk = func(el *evtxElement) {
+		for _, child := range el.children {
+			if len(child.children) == 0 {
+				data = append(data, [2]string{child.name, child.value()})
+			} else {
+				walk(child)
+			}
+		}
+	}
+	if userData := event.child("UserData"); userData != nil {
+		walk(userData)
+	}
+	return data
+}
+
+//evtxEventFields returns the EventLogItem fields of an event record in the order they are added as columns
+func evtxEventFields(event *evtxElement, written time.Time, separator string) [][2]string {
+	system := event.child("System")
+	provider := system.child("Provider")
+	source := provider.attr("Name")
+	if source == "" {
+		source = provider.attr("EventSourceName")
+	}
+	eventID := system.child("EventID")
+	correlation := system.child("Correlation")
+	execution := system.child("Execution")
+
+	category := system.child("Task").value()
+	if category == "0" {
+		category = ""
+	}
+
+	data := evtxEventData(event)
+	messageLines := []string{}
+	values := []string{}
+	for _, d := range data {
+		values = append(values, d[1])
+		if d[0] != "" {
+			messageLines = append(messageLines, d[0]+": "+d[1])
+		} else {
+			messageLines = append(messageLines, d[1])
+		}
+	}
+
+	return [][2]string{
+		{"genTime", AuditTimeSeconds(system.child("TimeCreated").attr("SystemTime"))},
+		{"writeTime", written.Format("2006-01-02T15:04:05Z")},
+		{"log", system.child("Channel").value()},
+		{"source", source},
+		{"EID", eventID.value()},
+		{"type", evtxEventType(system.child("Level").value(), system.child("Keywords").value())},
+		{"message", strings.Join(messageLines, "\n")},
+		{"user", system.child("Security").attr("UserID")},
+		{"index", system.child("EventRecordID").value()},
+		{"machine", system.child("Computer").value()},
+		{"category", category},
+		{"CorrelationActivityId", correlation.attr("ActivityID")},
+		{"CorrelationRelatedActivityId", correlation.attr("RelatedActivityID")},
+		{"ExecutionProcessId", execution.attr("ProcessID")},
+		{"ExecutionThreadId", execution.attr("ThreadID")},
+		{"unformattedMessage.string", strings.Join(values, separator)},
+	}
+}
+
+//ReadEVTX reads the event records of an EVTX file and calls onEvent with the EventLogItem fields of each one
+//Records which can't be read, such as those of chunks overwritten while the log was copied, are counted and skipped
+//Returns the number of events read and skipped
+func ReadEVTX(path string, separator string, onEvent func(fields [][2]string)) (int, int, error) {
+	file, err_o := os.Open(path)
+	if err_o != nil {
+		return 0, 0, err_o
+	}
+	defer file.Close()
+
+	header := make([]byte, evtxHeaderSize)
+	if _, err_r := io.ReadFull(file, header); err_r != nil {
+		return 0, 0, errors.New("file is too small to be an EVTX file")
+	}
+	if string(header[0:8]) != "ElfFile\x00" {
+		return 0, 0, errors.New("file does not start with the EVTX signature")
+	}
+
+	events, skipped := 0, 0
+	chunk := make([]byte, evtxChunkSize)
+	for {
+		n, err_r := io.ReadFull(file, chunk)
+		if err_r == io.EOF {
+			break
+		} else if err_r != nil && err_r != io.ErrUnexpectedEOF {
+			return events, skipped, err_r
+		}
+		//The records of a chunk cut off at the end of the file, such as of a log copied while it was written, are still read
+		//Unused chunks have no records, and the record a chunk was cut off in is counted as skipped
+		chunkEvents, chunkSkipped, _ := ParseEVTXChunk(chunk[:n], separator, onEvent)
+		events += chunkEvents
+		skipped += chunkSkipped
+		if n < evtxChunkSize {
+			break
+		}
+	}
+	return events, skipped, nil
+}
+
+//Chunks which were allocated but never written to start without the "ElfChnk" signature
+var errEVTXUnusedChunk = errors.New("chunk does not start with the EVTX chunk signature")
+
+//ParseEVTXChunk reads the event records of one 64 KB chunk of an EVTX file and calls onEvent with the EventLogItem
+//fields of each one. Records which can't be read are counted and skipped. Returns the number of events read and
+//skipped, and an error if the chunk is unused or cut off, after the events of the records which fit in it
+func ParseEVTXChunk(chunk []byte, separator string, onEvent func(fields [][2]string)) (int, int, error) {
+	if len(chunk) >= 8 && string(chunk[0:8]) != "ElfChnk\x00" {
+		return 0, 0, errEVTXUnusedChunk
+	}
+	if len(chunk) < 512 {
+		return 0, 0, errors.New("chunk header is cut off after " + strconv.Itoa(len(chunk)) + " bytes")
+	}
+	end := int(binary.LittleEndian.Uint32(chunk[48:]))
+	if end < 512 || end > evtxChunkSize {
+		end = evtxChunkSize
+	}
+	var err_c error
+	if len(chunk) < evtxChunkSize {
+		err_c = errors.New("chunk is cut off after " + strconv.Itoa(len(chunk)) + " of " + strconv.Itoa(evtxChunkSize) + " bytes")
+	}
+	if end > len(chunk) {
+		end = len(chunk)
+	}
+	events, skipped := 0, 0
+	for pos := 512; pos+24 <= end; {
+		if string(chunk[pos:pos+4]) != "**\x00\x00" {
+			break
+		}
+		size := int(binary.LittleEndian.Uint32(chunk[pos+4:]))
+		if size < 28 || pos+size > end {
+			skipped++
+			break
+		}
+		written := evtxFileTime(binary.LittleEndian.Uint64(chunk[pos+16:]))
+		budget := evtxMaxElements
+		p := &evtxParser{chunk: chunk[:end], pos: pos + 24, end: pos + size - 4, budget: &budget}
+		elements := p.fragment()
+		if p.err != nil || len(elements) == 0 || elements[0].name != "Event" {
+			skipped++
+		} else {
+			onEvent(evtxEventFields(elements[0], written, separator))
+			events++
+		}
+		pos += size
+	}
+	return events, skipped, err_c
+}
+
+//ConvertEVTXFile converts an acquired EVTX file to an EventLogItem CSV file of the host it was acquired from,
+//"<hostname>-<agentid>-<payload>-EventLogItem.csv", with the columns of EventLogItem audits and an "EVTXFile" column
+//Returns the path written, the number of rows, and the number of records skipped
+func ConvertEVTXFile(options Options, file ExtractedFile) (string, int, int, error) {
+	evtxFile := file.OriginalPath
+	if evtxFile == "" {
+		evtxFile = filepath.Base(file.Path)
+	}
+
+	//Rows are built like the rows of parsed EventLogItem audits, so they get the same columns and enrichments
+	headers := map[string]int{}
+	rows := []map[int]*strings.Builder{}
+	separator := GetMultiValueSeparator(options)
+	events, skipped, err_r := ReadEVTX(file.Path, separator, func(fields [][2]string) {
+		row := map[int]*strings.Builder{}
+		for _, field := range append(fields, [2]string{"EVTXFile", evtxFile}) {
+			if field[1] == "" {
+				continue
+			}
+			col, exists := headers[field[0]]
+			if !exists {
+				col = len(headers)
+				headers[field[0]] = col
+			}
+			value := &strings.Builder{}
+			value.WriteString(normalize_value_normal(field[1], options))
+			row[col] = value
+		}
+		rows = append(rows, row)
+	})
+	if err_r != nil {
+		return "", events, skipped, err_r
+	}
+
+	hostname := NormalizeHostname(file.Hostname, options)
+	//'-redact' rules of the "Hostname" column redact the hostname of the output files as well
+	originalHostname := options.Redaction.Hostname(file.Hostname)
+	hostname = options.Redaction.Hostname(hostname)
+	csvHeaders := normalAuditCSVHeaders(options, "EventLogItem", headers)
+	csvHeaders, csvRows := normalAuditCSVRows(options, "EventLogItem", hostname, originalHostname, file.AgentID, NewValuePool(), csvHeaders, headers, rows, nil)
+
+	//Payloads of acquired files may be paths, which can't be part of the file name
+	payload := regexp.MustCompile(`[^A-Za-z0-9_]`).ReplaceAllString(file.Payload, "_")
+	prefix := hostname + "-" + file.AgentID + "-" + payload
+	path := filepath.Join(AuditOutputDir(options, "EventLogItem"), prefix+"-EventLogItem"+OutputFileExtension(options))
+	msg := WriteCSVOutput(options, CSVWriteOutput{
+		Headers:     csvHeaders,
+		Desc:        GetFieldDescriptionsRow(options, "EventLogItem", csvHeaders),
+		Rows:        csvRows,
+		TempPath:    TempOutputPath(options, path),
+		Path:        path,
+		SplitPrefix: prefix,
+		SplitSuffix: "EventLogItem",
+		Source:      filepath.Base(file.Path),
+	})
+	if msg != "" {
+		return path, events, skipped, errors.New(strings.TrimPrefix(msg, "ERROR - "))
+	}
+	return path, events, skipped, nil
+}
+
+//GoAuditExtract_EVTX converts the EVTX files among the acquired files with '-evtx', so acquired event logs
+//are parsed and timelined like the EventLogItem audits of the same hosts
+func GoAuditExtract_EVTX(options Options, files []ExtractedFile) {
+	if !options.ExtractEVTX {
+		return
+	}
+	converted, rows, skipped := 0, 0, 0
+	for _, file := range files {
+		if !IsEVTXFile(file.Path) {
+			continue
+		}
+		path, events, bad, err_c := ConvertEVTXFile(options, file)
+		if err_c != nil {
+			options.Log.Println(options.Warnbox + "WARNING - Could not convert EVTX file '" + filepath.Base(file.Path) + "'. " + err_c.Error())
+			continue
+		}
+		converted++
+		rows += events
+		skipped += bad
+		if options.Verbose > 0 {
+			options.Log.Println(options.Box + "- " + filepath.Base(file.Path) + " -> " + filepath.Base(path) + " (" + strconv.Itoa(events) + " event(s), " + strconv.Itoa(bad) + " skipped)")
+		}
+	}
+	if converted == 0 {
+		return
+	}
+	msg := "Converted " + strconv.Itoa(converted) + " acquired EVTX file(s) to EventLogItem files with " + strconv.Itoa(rows) + " event(s)."
+	if skipped > 0 {
+		msg += " Skipped " + strconv.Itoa(skipped) + " unreadable record(s)."
+	}
+	options.Log.Println(options.Box + msg)
+}
@@ -0,0 +1,153 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+
+package goauditparser
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+//Security log with three 4624 logon events in one chunk, which share the templates of the first event
+const evtxTestFile = "testdata/Security.evtx"
+
+//Offsets in the chunk of the second and third records of the test file, and of the free space after them
+const (
+	evtxTestSecondRecord = 2392
+	evtxTestThirdRecord  = 2677
+	evtxTestFreeOffset   = 3028
+)
+
+var evtxTestEvents = []map[string]string{
+	{
+		"genTime":                      "2020-01-07T12:00:00Z",
+		"writeTime":                    "2020-01-07T12:00:01Z",
+		"log":                          "Security",
+		"source":                       "Microsoft-Windows-Security-Auditing",
+		"EID":                          "4624",
+		"type":                         "Success Audit",
+		"message":                      "SubjectUserSid: S-1-5-18\nTargetUserName: jsmith\nTargetDomainName: CORP\nLogonType: 3\nIpAddress: 10.1.2.3",
+		"user":                         "",
+		"index":                        "1",
+		"machine":                      "WKS001.corp.local",
+		"category":                     "12544",
+		"CorrelationActivityId":        "{0D0E0F10-1112-1314-1516-1718191A1B1C}",
+		"CorrelationRelatedActivityId": "",
+		"ExecutionProcessId":           "716",
+		"ExecutionThreadId":            "4120",
+		"unformattedMessage.string":    "S-1-5-18 | jsmith | CORP | 3 | 10.1.2.3",
+	},
+	{
+		"genTime":                   "2020-01-07T12:05:30Z",
+		"index":                     "2",
+		"EID":                       "4624",
+		"message":                   "SubjectUserSid: S-1-5-18\nTargetUserName: svc_backup\nTargetDomainName: CORP\nLogonType: 5\nIpAddress: -",
+		"CorrelationActivityId":     "",
+		"ExecutionThreadId":         "4188",
+		"unformattedMessage.string": "S-1-5-18 | svc_backup | CORP | 5 | -",
+	},
+	{
+		"genTime":               "2020-01-07T12:10:00Z",
+		"index":                 "3",
+		"type":                  "Success Audit",
+		"message":               "SubjectUserSid: S-1-5-21-3623811015-3361044348-30300820-1013\nTargetUserName: Administrator\nTargetDomainName: WKS001\nLogonType: 10\nIpAddress: 192.168.56.20",
+		"machine":               "WKS001.corp.local",
+		"CorrelationActivityId": "{0D0E0F10-1112-1314-1516-1718191A1B1D}",
+	},
+}
+
+//Returns the first chunk of the test file
+func readEVTXTestChunk(t testing.TB) []byte {
+	b, err_r := ioutil.ReadFile(evtxTestFile)
+	if err_r != nil {
+		t.Fatal(err_r)
+	}
+	return b[evtxHeaderSize : evtxHeaderSize+evtxChunkSize]
+}
+
+func TestReadEVTX(t *testing.T) {
+	read := []map[string]string{}
+	events, skipped, err_r := ReadEVTX(evtxTestFile, " | ", func(fields [][2]string) {
+		event := map[string]string{}
+		for _, field := range fields {
+			event[field[0]] = field[1]
+		}
+		read = append(read, event)
+	})
+	if err_r != nil {
+		t.Fatal(err_r)
+	}
+	if events != len(evtxTestEvents) || skipped != 0 || len(read) != len(evtxTestEvents) {
+		t.Fatalf("read %d events and skipped %d, want %d and 0", events, skipped, len(evtxTestEvents))
+	}
+	for i, want := range evtxTestEvents {
+		for field, value := range want {
+			if got, exists := read[i][field]; !exists || got != value {
+				t.Errorf("event %d field %q = %q, want %q", i+1, field, got, value)
+			}
+		}
+	}
+}
+
+func TestParseEVTXChunkTruncated(t *testing.T) {
+	chunk := readEVTXTestChunk(t)
+	tests := []struct {
+		length int
+		events int
+	}{
+		{0, 0},
+		{7, 0},
+		{100, 0},
+		{511, 0},
+		{512, 0},
+		{700, 0},
+		{evtxTestSecondRecord - 1, 0},
+		{evtxTestSecondRecord, 1},
+		{evtxTestThirdRecord + 100, 2},
+		{evtxTestFreeOffset - 1, 2},
+		{evtxTestFreeOffset, 3},
+		{evtxChunkSize - 1, 3},
+	}
+	for _, test := range tests {
+		events, _, err_p := ParseEVTXChunk(chunk[:test.length], " | ", func(fields [][2]string) {})
+		if err_p == nil {
+			t.Errorf("ParseEVTXChunk of %d bytes returned no error", test.length)
+		}
+		if events != test.events {
+			t.Errorf("ParseEVTXChunk of %d bytes read %d events, want %d", test.length, events, test.events)
+		}
+	}
+	if events, skipped, err_p := ParseEVTXChunk(chunk, " | ", func(fields [][2]string) {}); err_p != nil || events != 3 || skipped != 0 {
+		t.Errorf("ParseEVTXChunk = %d, %d, %v, want 3, 0, <nil>", events, skipped, err_p)
+	}
+	if _, _, err_p := ParseEVTXChunk(make([]byte, evtxChunkSize), " | ", func(fields [][2]string) {}); err_p == nil {
+		t.Error("ParseEVTXChunk of an unused chunk returned no error")
+	}
+}
+
+func FuzzParseEvtxChunk(f *testing.F) {
+	chunk := readEVTXTestChunk(f)
+	for _, length := range []int{0, 512, evtxTestSecondRecord, evtxTestThirdRecord + 100, evtxTestFreeOffset, evtxChunkSize} {
+		f.Add(chunk[:length])
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		calls := 0
+		events, skipped, err_p := ParseEVTXChunk(data, " | ", func(fields [][2]string) {
+			calls++
+		})
+		if events != calls || events < 0 || skipped < 0 {
+			t.Fatalf("ParseEVTXChunk read %d events with %d calls and skipped %d", events, calls, skipped)
+		}
+		if len(data) < evtxChunkSize && err_p == nil {
+			t.Fatalf("ParseEVTXChunk of %d bytes returned no error", len(data))
+		}
+	})
+}
@@ -0,0 +1,324 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//ExtractedFile is an acquired file extracted from an archive, with the original timestamps of the file when they are known
+type ExtractedFile struct {
+	Archive      string `json:"archive"`
+	Hostname     string `json:"hostname"`
+	AgentID      string `json:"agentid"`
+	Payload      string `json:"payload"`
+	OriginalPath string `json:"original_path,omitempty"`
+	Path         string `json:"path"`
+	Created      string `json:"created,omitempty"`
+	Modified     string `json:"modified,omitempty"`
+	Accessed     string `json:"accessed,omitempty"`
+	Changed      string `json:"changed,omitempty"`
+	TimeSource   string `json:"time_source"` //"manifest.json", "zip", or "none"
+	Size         int64  `json:"size,omitempty"`
+	MD5          string `json:"md5,omitempty"` //Hashes are only computed with '-eh'
+	SHA1         string `json:"sha1,omitempty"`
+	SHA256       string `json:"sha256,omitempty"`
+	Hashed       string `json:"hashed,omitempty"`
+}
+
+//Name of the '-eh' chain of custody listing of the extracted acquired files and their hashes
+const ExtractedFilesManifestFileName = "_ExtractedFilesManifest.csv"
+
+var extractedFilesManifestHeaders = []string{"Archive", "Hostname", "AgentID", "Payload", "OriginalPath", "ExtractedName", "ExtractedPath", "Size", "MD5", "SHA1", "SHA256", "Hashed"}
+
+//ExtractedFileHasher hashes an acquired file while it is copied out of its archive for '-eh', so it only has to be read once
+//A nil ExtractedFileHasher does nothing, so files can be copied the same way whether or not '-eh' was used
+type ExtractedFileHasher struct {
+	md5    hash.Hash
+	sha1   hash.Hash
+	sha256 hash.Hash
+	size   int64
+}
+
+//NewExtractedFileHasher returns a hasher for one acquired file, or nil if '-eh' was not used
+func NewExtractedFileHasher(options Options) *ExtractedFileHasher {
+	if !options.ExtractHashes {
+		return nil
+	}
+	return &ExtractedFileHasher{md5: md5.New(), sha1: sha1.New(), sha256: sha256.New()}
+}
+
+func (h *ExtractedFileHasher) Write(p []byte) (int, error) {
+	h.md5.Write(p)
+	h.sha1.Write(p)
+	h.sha256.Write(p)
+	h.size += int64(len(p))
+	return len(p), nil
+}
+
+//Reader returns src, hashing everything read from it
+func (h *ExtractedFileHasher) Reader(src io.Reader) io.Reader {
+	if h == nil {
+		return src
+	}
+	return io.TeeReader(src, h)
+}
+
+//Set records the size and hashes of everything read through Reader on the extracted file
+func (h *ExtractedFileHasher) Set(file *ExtractedFile) {
+	if h == nil {
+		return
+	}
+	file.Size = h.size
+	file.MD5 = hex.EncodeToString(h.md5.Sum(nil))
+	file.SHA1 = hex.EncodeToString(h.sha1.Sum(nil))
+	file.SHA256 = hex.EncodeToString(h.sha256.Sum(nil))
+	file.Hashed = time.Now().UTC().Format("2006-01-02 15:04:05")
+}
+
+//AcquisitionTimeField returns "Created", "Modified", "Accessed", or "Changed" for a "mandiant/mir/agent/..." manifest metadata name, or ""
+func AcquisitionTimeField(metadataName string) string {
+	name := strings.ToLower(metadataName)
+	if !strings.HasPrefix(name, "mandiant/mir/agent/") {
+		return ""
+	}
+	for _, field := range []string{"Created", "Modified", "Accessed", "Changed"} {
+		if strings.HasSuffix(name, strings.ToLower(field)) {
+			return field
+		}
+	}
+	return ""
+}
+
+//ParseAcquisitionTime reads a manifest.json timestamp such as "2019-12-19T11:11:45.299Z" or "2019-12-19 11:11:45"
+func ParseAcquisitionTime(value string) (time.Time, bool) {
+	t, err_t := ParseTime(value)
+	return t, err_t == nil
+}
+
+//SetTimes sets the access and modification times of the extracted file from the manifest.json times of its payload,
+//or the ZIP entry time if the manifest has none. Creation times can't be set portably so they are only recorded
+func (file *ExtractedFile) SetTimes(manifestTimes map[string]time.Time, zipTime time.Time) error {
+	format := func(t time.Time) string {
+		return t.UTC().Format("2006-01-02 15:04:05")
+	}
+	modified, hasModified := manifestTimes["Modified"]
+	accessed, hasAccessed := manifestTimes["Accessed"]
+	if len(manifestTimes) > 0 {
+		file.TimeSource = "manifest.json"
+		if t, exists := manifestTimes["Created"]; exists {
+			file.Created = format(t)
+		}
+		if t, exists := manifestTimes["Changed"]; exists {
+			file.Changed = format(t)
+		}
+	} else if zipTime.Year() > 1980 {
+		//ZIP entries without a time have the MS-DOS epoch
+		file.TimeSource = "zip"
+		modified, hasModified = zipTime, true
+	} else {
+		file.TimeSource = "none"
+		return nil
+	}
+	if !hasModified {
+		return nil
+	}
+	if !hasAccessed {
+		accessed = modified
+	}
+	file.Modified = format(modified)
+	if hasAccessed {
+		file.Accessed = format(accessed)
+	}
+	return os.Chtimes(file.Path, accessed, modified)
+}
+
+//GoAuditExtract_Manifest records extracted acquisition files and their original timestamps in "_GAPExtractionManifest.json"
+func GoAuditExtract_Manifest(options Options, files []ExtractedFile) {
+	if len(files) == 0 {
+		return
+	}
+	outputDir := InputScratchDir(options)
+	if len(options.ExtractionOutputDir) > 0 {
+		outputDir = options.ExtractionOutputDir
+	}
+
+	//Keep files recorded by previous runs, replacing any that were extracted again
+	manifestPath := filepath.Join(outputDir, "_GAPExtractionManifest.json")
+	manifest := []ExtractedFile{}
+	if b, err_r := ioutil.ReadFile(manifestPath); err_r == nil {
+		json.Unmarshal(b, &manifest)
+	}
+	preserved := 0
+	for _, file := range files {
+		if file.TimeSource != "none" {
+			preserved++
+		}
+		replaced := false
+		for j, existing := range manifest {
+			if existing.Path == file.Path {
+				manifest[j] = file
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			manifest = append(manifest, file)
+		}
+	}
+	b, _ := json.MarshalIndent(manifest, "", "    ")
+	err_w := WriteOutputFile(options, manifestPath, b, 0644)
+	if err_w != nil {
+		options.Log.Println(options.Warnbox + "WARNING - Could not write extraction manifest '" + manifestPath + "'. " + err_w.Error())
+		return
+	}
+	if options.Verbose > 0 {
+		options.Log.Println(options.Box + "Preserved original timestamps of " + strconv.Itoa(preserved) + "/" + strconv.Itoa(len(files)) + " acquired file(s) in '" + manifestPath + "'.")
+	}
+}
+
+//GoAuditExtract_HashManifest lists the extracted acquired files with their original paths, sizes, and hashes in
+//"_ExtractedFilesManifest.csv" for '-eh'. Files listed by previous runs are kept, unless they were extracted again
+func GoAuditExtract_HashManifest(options Options, files []ExtractedFile) {
+	if !options.ExtractHashes || len(files) == 0 {
+		return
+	}
+	outputDir := InputScratchDir(options)
+	if len(options.ExtractionOutputDir) > 0 {
+		outputDir = options.ExtractionOutputDir
+	}
+	manifestPath := filepath.Join(outputDir, ExtractedFilesManifestFileName)
+
+	extracted := map[string]bool{}
+	for _, file := range files {
+		extracted[file.Path] = true
+	}
+	rows := [][]string{extractedFilesManifestHeaders}
+	if f, err_o := os.Open(manifestPath); err_o == nil {
+		previous, err_r := csv.NewReader(f).ReadAll()
+		f.Close()
+		if err_r == nil && len(previous) > 0 && strings.Join(previous[0], ",") == strings.Join(extractedFilesManifestHeaders, ",") {
+			pathIndex := 6 //"ExtractedPath"
+			for _, row := range previous[1:] {
+				if len(row) == len(extractedFilesManifestHeaders) && !extracted[row[pathIndex]] {
+					rows = append(rows, row)
+				}
+			}
+		}
+	}
+	for _, file := range files {
+		rows = append(rows, []string{file.Archive, NormalizeHostname(file.Hostname, options), file.AgentID, file.Payload, file.OriginalPath, filepath.Base(file.Path), file.Path, strconv.FormatInt(file.Size, 10), file.MD5, file.SHA1, file.SHA256, file.Hashed})
+	}
+
+	csvFile, err_c := CreateOutputFile(options, manifestPath)
+	if err_c != nil {
+		options.Log.Println(options.Warnbox + "WARNING - Could not write extracted files manifest '" + manifestPath + "'. " + err_c.Error())
+		return
+	}
+	writer := csv.NewWriter(csvFile)
+	writer.WriteAll(rows)
+	csvFile.Close()
+	if err_w := writer.Error(); err_w != nil {
+		options.Log.Println(options.Warnbox + "WARNING - Could not write extracted files manifest '" + manifestPath + "'. " + err_w.Error())
+		return
+	}
+	options.Log.Println(options.Box + "Hashed " + strconv.Itoa(len(files)) + " extracted acquired file(s) into '" + manifestPath + "'.")
+}
+
+//ManifestValue reads the value of a '"value": ...' line of manifest.json, quoted or not
+func ManifestValue(line string) string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimSpace(strings.TrimPrefix(line, `"value":`))
+	line = strings.TrimSuffix(line, ",")
+	var value interface{}
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+	if err_j := decoder.Decode(&value); err_j != nil {
+		return strings.Trim(line, `"`)
+	}
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+//WriteMultiFileAcquisitionCSV lists the files collected by "multifile" acquisitions with their manifest.json metadata
+//in "<hostname>-<agentid>-<payload>-MultiFileAcquisition.csv", so they are documented even if they are not extracted
+func WriteMultiFileAcquisitionCSV(options Options, dir string, archive string, hostname string, agentid string, payloads []string, metadata map[string]map[string]string) (string, error) {
+	headers := []string{"Tag", "Notes", "Hostname", "AgentID", "Archive", "Payload", "FullPath", "FileName", "FilePath", "Created", "Modified", "Accessed", "Changed"}
+	known := map[string]bool{}
+	for _, header := range headers {
+		known[header] = true
+	}
+	extraHeaders := []string{}
+	for _, payload := range payloads {
+		for header := range metadata[payload] {
+			if !known[header] {
+				known[header] = true
+				extraHeaders = append(extraHeaders, header)
+			}
+		}
+	}
+	sort.Strings(extraHeaders)
+	headers = append(headers, extraHeaders...)
+
+	rowHostname, fileHostname := RedactedSidecarHostname(options, hostname)
+	archive = RedactedArchiveName(options, archive, hostname)
+	redactColumns := options.Redaction.RedactionColumns("MultiFileAcquisition", headers)
+	rows := [][]string{headers}
+	for _, payload := range payloads {
+		values := metadata[payload]
+		row := make([]string, len(headers))
+		for i, header := range headers {
+			switch header {
+			case "Hostname":
+				row[i] = rowHostname
+			case "AgentID":
+				row[i] = agentid
+			case "Archive":
+				row[i] = archive
+			case "Payload":
+				row[i] = payload
+			case "FullPath":
+				row[i] = values["FilePath"] + values["FileName"]
+			default:
+				row[i] = values[header]
+			}
+		}
+		options.Redaction.RedactRow(redactColumns, row, GetMultiValueSeparator(options))
+		rows = append(rows, row)
+	}
+
+	csvPath := filepath.Join(dir, fileHostname+"-"+agentid+"-"+payloads[0]+"-MultiFileAcquisition.csv")
+	csvFile, err_c := CreateOutputFile(options, csvPath)
+	if err_c != nil {
+		return csvPath, err_c
+	}
+	writer := csv.NewWriter(csvFile)
+	writer.WriteAll(rows)
+	csvFile.Close()
+	return csvPath, writer.Error()
+}
@@ -32,9 +32,106 @@ type ThreadReturnExtract struct {
 	zipfile   string
 	message   string
 	xmlfiles  []os.FileInfo
+	memimages []MemoryImage
+	extracted []ExtractedFile
+	//Audits of script.xml or manifest.json which did not produce an audit
+	mismatches []AuditMismatch
 }
 
-func GoAuditExtract_Start(options Options, files []os.FileInfo, config Parse_Config_JSON, configOutDirIndex int) []os.FileInfo {
+//"acquisition.part1.zip", "acquisition.part2.zip", ...
+var regMultipartZip = regexp.MustCompile(`(?i)^(.+)\.part(\d+)\.zip$`)
+
+//GoAuditExtract_JoinMultipart concatenates multi-part archives in order into "<name>.zip" so they extract as one archive
+//Returns the files with parts replaced by joined archives, the parts of each joined archive, and messages for parts that could not be joined
+func GoAuditExtract_JoinMultipart(options Options, files []os.FileInfo) ([]os.FileInfo, map[string][]os.FileInfo, []string) {
+	groups := map[string]map[int]os.FileInfo{}
+	groupOrder := []string{}
+	remaining := []os.FileInfo{}
+	for _, file := range files {
+		m := regMultipartZip.FindStringSubmatch(filepath.Base(file.Name()))
+		if len(m) <= 2 {
+			remaining = append(remaining, file)
+			continue
+		}
+		partNum, _ := strconv.Atoi(m[2])
+		if _, exists := groups[m[1]]; !exists {
+			groups[m[1]] = map[int]os.FileInfo{}
+			groupOrder = append(groupOrder, m[1])
+		}
+		groups[m[1]][partNum] = file
+	}
+
+	multiparts := map[string][]os.FileInfo{}
+	failures := []string{}
+	for _, name := range groupOrder {
+		group := groups[name]
+		joinedName := name + ".zip"
+		joinedPath := filepath.Join(InputScratchDir(options), joinedName)
+
+		parts := []os.FileInfo{}
+		missing := []string{}
+		maxPart := 0
+		for partNum := range group {
+			if partNum > maxPart {
+				maxPart = partNum
+			}
+		}
+		firstPart := 1
+		if _, exists := group[0]; exists {
+			firstPart = 0
+		}
+		for i := firstPart; i <= maxPart; i++ {
+			if part, exists := group[i]; exists {
+				parts = append(parts, part)
+			} else {
+				missing = append(missing, strconv.Itoa(i))
+			}
+		}
+		if len(missing) > 0 {
+			failures = append(failures, options.Warnbox+`WARNING - Failed to unarchive multi-part archive '`+joinedName+`'. Missing part(s) `+strings.Join(missing, ", ")+`.`)
+			continue
+		}
+		if _, err_s := os.Stat(joinedPath); !os.IsNotExist(err_s) {
+			failures = append(failures, options.Warnbox+`WARNING - Failed to unarchive multi-part archive '`+joinedName+`'. File already exists in the input directory.`)
+			continue
+		}
+
+		joinedFile, err_c := CreateOutputFile(options, joinedPath)
+		if err_c != nil {
+			failures = append(failures, options.Warnbox+`WARNING - Failed to unarchive multi-part archive '`+joinedName+`'. Could not create joined archive: `+err_c.Error())
+			continue
+		}
+		err_j := error(nil)
+		for _, part := range parts {
+			partFile, err_o := os.Open(filepath.Join(options.InputPath, filepath.Base(part.Name())))
+			if err_o != nil {
+				err_j = err_o
+				break
+			}
+			_, err_j = io.Copy(joinedFile, partFile)
+			partFile.Close()
+			if err_j != nil {
+				break
+			}
+		}
+		joinedFile.Close()
+		if err_j != nil {
+			os.Remove(joinedPath)
+			failures = append(failures, options.Warnbox+`WARNING - Failed to unarchive multi-part archive '`+joinedName+`'. Could not join parts: `+err_j.Error())
+			continue
+		}
+
+		joined, _ := os.Stat(joinedPath)
+		multiparts[joined.Name()] = parts
+		remaining = append(remaining, joined)
+		if options.Verbose > 0 {
+			options.Log.Println(options.Box + "Joined " + strconv.Itoa(len(parts)) + " part(s) into multi-part archive '" + joinedName + "'.")
+		}
+	}
+	return remaining, multiparts, failures
+}
+
+func GoAuditExtract_Start(options Options, files []os.FileInfo, config Parse_Config_JSON, configOutDirIndex int) ([]os.FileInfo, []AuditMismatch) {
 
 	c_Success := 0
 	c_Cached := 0
@@ -58,17 +155,49 @@ func GoAuditExtract_Start(options Options, files []os.FileInfo, config Parse_Con
 		}
 	}
 
+	//Join multi-part archives, remembering their parts for the parse cache and report
+	files, multiparts, multipartFailures := GoAuditExtract_JoinMultipart(options, files)
+	for _, msg := range multipartFailures {
+		options.Log.Println(msg)
+		c_Failed++
+	}
+	defer func() {
+		for joinedName := range multiparts {
+			os.Remove(filepath.Join(InputScratchDir(options), joinedName))
+		}
+	}()
+	archiveParts := func(file os.FileInfo) []os.FileInfo {
+		if parts, exists := multiparts[file.Name()]; exists {
+			return parts
+		}
+		return []os.FileInfo{file}
+	}
+	archiveMessage := func(done ThreadReturnExtract) string {
+		parts, exists := multiparts[done.zipfile]
+		if !exists {
+			return done.message
+		}
+		names := []string{}
+		for _, part := range parts {
+			names = append(names, filepath.Base(part.Name()))
+		}
+		return done.message + "\n" + options.Box + "- Multi-part archive joined from " + strconv.Itoa(len(parts)) + " part(s): " + strings.Join(names, ", ")
+	}
+
 	if len(files) == 0 {
-		fmt.Println(options.Box + "All identified archive file(s) already extracted.")
-		return []os.FileInfo{}
+		options.Log.Println(options.Box + "All identified archive file(s) already extracted.")
+		return []os.FileInfo{}, nil
 	}
 
+	//Ask for the passwords of encrypted archives before the extraction threads start
+	PromptExtractionPasswords(options, files)
+
 	// Make output directory if it does not exist
 	if len(options.ExtractionOutputDir) > 0 {
 		if _, err := os.Stat(options.ExtractionOutputDir); os.IsNotExist(err) {
-			if err = os.MkdirAll(options.ExtractionOutputDir, os.ModePerm); err != nil {
-				fmt.Println(options.Warnbox + "ERROR - Could not create output directory '" + options.ExtractionOutputDir + "'.")
-				return nil
+			if err = MkdirAllOutput(options, options.ExtractionOutputDir); err != nil {
+				options.Log.Println(options.Warnbox + "ERROR - Could not create output directory '" + options.ExtractionOutputDir + "'.")
+				return nil, nil
 			}
 		}
 	}
@@ -82,7 +211,6 @@ func GoAuditExtract_Start(options Options, files []os.FileInfo, config Parse_Con
 	}
 
 	c := make(chan ThreadReturnExtract)
-	c_tqdm := make(chan bool)
 	c_debug := make(chan map[int]string)
 	if options.Threads < 1 {
 		options.Threads = 1
@@ -91,15 +219,19 @@ func GoAuditExtract_Start(options Options, files []os.FileInfo, config Parse_Con
 		options.Threads = len(files)
 	}
 
+	var bar *ProgressBar
 	if options.Verbose == 0 {
-		go TQDM(len(files), options, options.Box+"Extracting archives", c_tqdm)
+		bar = NewProgressBar(options, options.Box+"Extracting archives", len(files))
 	} else {
-		fmt.Println(options.Box + "Extracting archives...")
+		options.Log.Println(options.Box + "Extracting archives...")
 		go Debug(options, c_debug)
 	}
 
 	threadMessages := []string{}
 	xmlFiles := []os.FileInfo{}
+	memImages := []MemoryImage{}
+	extractedFiles := []ExtractedFile{}
+	mismatches := []AuditMismatch{}
 
 	threadindex := 0
 	threadtotal := len(files)
@@ -108,25 +240,32 @@ func GoAuditExtract_Start(options Options, files []os.FileInfo, config Parse_Con
 
 	//Start time of timer
 	start := time.Now()
+	options.Progress.Stage(ProgressStageExtract, len(files))
+	options.Log.StageStarted(ProgressStageExtract, len(files))
 
 	//Start threads
 	for i := 0; i < len(files); i++ {
 		if i >= options.Threads {
 			done := <-c
 			delete(threadbuffer, done.threadnum)
-			if options.Verbose == 0 {
-				c_tqdm <- true
-			} else {
+			options.Progress.Finish(done.threadnum)
+			bar.Add(1)
+			if options.Verbose > 0 {
 				c_debug <- threadbuffer
 			}
 			debug.FreeOSMemory()
-			threadMessages = append(threadMessages, done.message)
+			threadMessages = append(threadMessages, archiveMessage(done))
 			xmlFiles = append(xmlFiles, done.xmlfiles...)
+			memImages = append(memImages, done.memimages...)
+			extractedFiles = append(extractedFiles, done.extracted...)
+			mismatches = append(mismatches, done.mismatches...)
 			if !extractionOnly {
-				config = ParseConfigUpdateArchive(configOutDirIndex, files[done.threadnum], done.message, config)
+				for _, part := range archiveParts(files[done.threadnum]) {
+					config = ParseConfigUpdateArchive(configOutDirIndex, part, done.message, config)
+				}
 				err_s := ParseConfigSave(config, options)
 				if err_s != nil {
-					fmt.Println(options.Warnbox + "WARNING - Could not update '_GAPInputConfig.json'. " + err_s.Error())
+					options.Log.Println(options.Warnbox + "WARNING - Could not update '_GAPInputConfig.json'. " + err_s.Error())
 				}
 			}
 		}
@@ -136,6 +275,7 @@ func GoAuditExtract_Start(options Options, files []os.FileInfo, config Parse_Con
 			c_debug <- threadbuffer
 			fmt.Printf(options.Box+"Extracting %"+strconv.Itoa(threadpadding)+"d/%"+strconv.Itoa(threadpadding)+"d %6.2f%% "+filepath.Base(files[i].Name())+"...\n", threadindex, threadtotal, (float32(threadindex)/float32(threadtotal))*100.0)
 		}
+		options.Progress.Start(i, files[i].Name())
 		go GoAuditExtract_Thread(files[i], options, i, c)
 	}
 
@@ -143,38 +283,45 @@ func GoAuditExtract_Start(options Options, files []os.FileInfo, config Parse_Con
 	for i := 0; i < options.Threads; i++ {
 		done := <-c
 		delete(threadbuffer, done.threadnum)
-		if options.Verbose == 0 {
-			c_tqdm <- true
-		} else {
+		options.Progress.Finish(done.threadnum)
+		bar.Add(1)
+		if options.Verbose > 0 {
 			c_debug <- threadbuffer
 		}
 		debug.FreeOSMemory()
-		threadMessages = append(threadMessages, done.message)
+		threadMessages = append(threadMessages, archiveMessage(done))
 		xmlFiles = append(xmlFiles, done.xmlfiles...)
+		memImages = append(memImages, done.memimages...)
+		extractedFiles = append(extractedFiles, done.extracted...)
+		mismatches = append(mismatches, done.mismatches...)
 		if !extractionOnly {
-			config = ParseConfigUpdateArchive(configOutDirIndex, files[done.threadnum], done.message, config)
+			for _, part := range archiveParts(files[done.threadnum]) {
+				config = ParseConfigUpdateArchive(configOutDirIndex, part, done.message, config)
+			}
 			err_s := ParseConfigSave(config, options)
 			if err_s != nil {
-				fmt.Println(options.Warnbox + "WARNING - Could not update '_GAPInputConfig.json'. " + err_s.Error())
+				options.Log.Println(options.Warnbox + "WARNING - Could not update '_GAPInputConfig.json'. " + err_s.Error())
 			}
 		}
 	}
+	bar.Close()
+	options.Log.StageFinished(ProgressStageExtract, len(files))
 
 	for _, msg := range threadMessages {
 		if strings.Contains(msg, "unarchived with issues") {
 			c_Partial++
-			fmt.Println(msg)
+			options.Log.Println(msg)
 		} else if strings.Contains(msg, "unarchived successfully") {
 			c_Success++
 			if options.Verbose > 0 {
-				fmt.Println(msg)
+				options.Log.Println(msg)
 			}
 		} else if strings.Contains(msg, "Failed to unarchive") {
 			c_Failed++
-			fmt.Println(msg)
+			options.Log.Println(msg)
 		} else {
 			if options.Verbose > 0 {
-				fmt.Println(msg)
+				options.Log.Println(msg)
 			}
 		}
 	}
@@ -182,25 +329,61 @@ func GoAuditExtract_Start(options Options, files []os.FileInfo, config Parse_Con
 	elapsed := time.Since(start)
 	time.Sleep(10 * time.Millisecond)
 
-	fmt.Println(options.Box + "Archive Extraction Statistics:")
+	sortAuditMismatches(mismatches)
+	for _, mismatch := range mismatches {
+		options.Log.Println(options.Warnbox + "NOTICE - Audit '" + mismatch.Audit + "' of '" + mismatch.Archive + "' was " + mismatch.Problem + ".")
+	}
+
+	GoAuditExtract_MemoryImages(options, memImages)
+	GoAuditExtract_Manifest(options, extractedFiles)
+	GoAuditExtract_HashManifest(options, extractedFiles)
+	GoAuditExtract_EVTX(options, extractedFiles)
+	options.MemoryPayloads.Report(options)
+
+	options.Log.Println(options.Box + "Archive Extraction Statistics:")
 	fmt.Println(options.Box+" - Success: ", c_Success)
 	fmt.Println(options.Box+" - Partial: ", c_Partial)
 	fmt.Println(options.Box+" - Failed:  ", c_Failed)
 	fmt.Println(options.Box+" - Cached:  ", c_Cached)
+	extractCounts := map[string]int{
+		"extracted": c_Success,
+		"partial":   c_Partial,
+		"failed":    c_Failed,
+		"cached":    c_Cached,
+	}
+	options.Log.Statistics(ProgressStageExtract, extractCounts)
+	options.Notifier.Statistics(ProgressStageExtract, extractCounts)
 
 	fmt.Printf(options.Box+"Extracted %d file(s) in %s.", len(xmlFiles), elapsed.Truncate(time.Millisecond).String())
 	if !options.MinimizedOutput {
 		fmt.Printf("\n")
 	}
 
-	return xmlFiles
+	return xmlFiles, mismatches
 }
 
 func GoAuditExtract_Thread(file os.FileInfo, options Options, threadNum int, c chan ThreadReturnExtract) {
 
 	xmlfiles := []os.FileInfo{}
+	memimages := []MemoryImage{}
 	fileName := filepath.Base(file.Name())
 	filePath := filepath.Join(options.InputPath, fileName)
+	//Multi-part archives are joined in the scratch directory of '-readonly-input'
+	if _, err_s := os.Stat(filePath); os.IsNotExist(err_s) && options.ReadOnlyInput {
+		filePath = filepath.Join(InputScratchDir(options), fileName)
+	}
+
+	//Redline sessions are not ZIP files like HX triage packages
+	if strings.ToLower(filepath.Ext(fileName)) == ".mans" && IsRedlineSession(filePath) {
+		GoAuditExtract_RedlineThread(file, options, threadNum, c)
+		return
+	}
+	//Audits of manual collection scripts are in host-named folders
+	if file.IsDir() {
+		GoAuditExtract_ManualThread(file, options, threadNum, c)
+		return
+	}
+
 	reg_OtherFormat := regexp.MustCompile("-[A-Za-z0-9]{22}[.]zip")
 
 	//=== OPEN ZIP FILE CONTENTS IN MEMORY ===//
@@ -210,34 +393,58 @@ func GoAuditExtract_Thread(file os.FileInfo, options Options, threadNum int, c c
 		File        io.ReadCloser
 	}
 	zipFileContents := map[string]ZipFileContent{}
+	zipFileTimes := map[string]time.Time{}
 	var zipFile *zip.ReadCloser
 
 	var err_z error
 	zipFile, err_z = zip.OpenReader(filePath)
 	if err_z != nil {
-		c <- ThreadReturnExtract{threadNum, fileName, options.Warnbox + `WARNING - Failed to unarchive '` + fileName + `'. Could not open as a ZIP file: ` + err_z.Error(), xmlfiles}
+		c <- ThreadReturnExtract{threadNum, fileName, options.Warnbox + `WARNING - Failed to unarchive '` + fileName + `'. Could not open as a ZIP file: ` + err_z.Error(), xmlfiles, nil, nil, nil}
 		return
 	}
 
 	warningMessages := []string{}
+	password := ExtractionPasswordFor(options, fileName)
+	encryptedSkipped := 0
+	wrongPassword := false
 	for _, innerFile := range zipFile.File {
 		if innerFile.IsEncrypted() {
-			innerFile.SetPassword(options.ExtractionPassword)
+			//Partially encrypted archives still have their unencrypted files extracted without a password
+			if password == "" {
+				encryptedSkipped++
+				continue
+			}
+			innerFile.SetPassword(password)
 		}
 		rc, err_o := innerFile.Open()
 		if err_o != nil {
+			wrongPassword = wrongPassword || (innerFile.IsEncrypted() && IsPasswordError(err_o))
 			warningMessages = append(warningMessages, "Could not read archive file '"+innerFile.Name+"': "+err_o.Error())
-			rc.Close()
 			continue
 		}
 		zipFileContents[innerFile.Name] = ZipFileContent{false, rc}
+		zipFileTimes[innerFile.Name] = innerFile.ModTime()
+	}
+
+	//Encrypted archives get a precise status in the parse cache so they are retried once the password is provided
+	passwordMessage := ""
+	if encryptedSkipped > 0 {
+		passwordMessage = options.Warnbox + `WARNING - Failed to unarchive '` + fileName + `'. Archive needs password for ` + strconv.Itoa(encryptedSkipped) + ` encrypted file(s) (try '-ep <password>' or '-ep-file <file>').`
+	} else if wrongPassword {
+		passwordMessage = options.Warnbox + `WARNING - Failed to unarchive '` + fileName + `'. Archive password is incorrect.`
+	}
+	if _, exists := zipFileContents["manifest.json"]; !exists && passwordMessage != "" {
+		zipFile.Close()
+		c <- ThreadReturnExtract{threadNum, fileName, passwordMessage, xmlfiles, nil, nil, nil}
+		return
 	}
 
 	//=== GET HOSTNAME + AGENT ID  ===//
 	//Get Hostname and Agent ID from metadata.json for triage packages
 	hostname := "0"
 	agentid := "0000000000000000000000"
-	baseFileName := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	baseFileName := NormalizeAgentIDFileName(strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName)))
+	var metadataContents []byte
 
 	//Try getting Hostname + Agent ID from metadata.json
 	if _, exists := zipFileContents["metadata.json"]; exists {
@@ -246,10 +453,14 @@ func GoAuditExtract_Thread(file os.FileInfo, options Options, threadNum int, c c
 		zipFileContents["metadata.json"] = metaFile
 		//scanner := bufio.NewScanner(zipFileContents["metadata.json"].File)
 		bytes, err_r := ioutil.ReadAll(metaFile.File)
-		if err_r != nil {
-			c <- ThreadReturnExtract{threadNum, fileName, options.Warnbox + `WARNING - Failed to unarchive '` + fileName + `'. File is likely encrypted (try '-ep <password>'). Could not read contents of 'metadata.json': ` + err_r.Error(), xmlfiles}
+		if err_r != nil && IsPasswordError(err_r) {
+			c <- ThreadReturnExtract{threadNum, fileName, options.Warnbox + `WARNING - Failed to unarchive '` + fileName + `'. Archive password is incorrect. Could not read contents of 'metadata.json': ` + err_r.Error(), xmlfiles, nil, nil, nil}
+			return
+		} else if err_r != nil {
+			c <- ThreadReturnExtract{threadNum, fileName, options.Warnbox + `WARNING - Failed to unarchive '` + fileName + `'. File is likely encrypted (try '-ep <password>'). Could not read contents of 'metadata.json': ` + err_r.Error(), xmlfiles, nil, nil, nil}
 			return
 		}
+		metadataContents = bytes
 		contents := string(bytes)
 		for _, line := range strings.Split(contents, "\n") {
 			if strings.Contains(line, `"hostname": "`) {
@@ -269,36 +480,75 @@ func GoAuditExtract_Thread(file os.FileInfo, options Options, threadNum int, c c
 		hostname = strings.Join(parts[0:len(parts)-1], "-")
 		agentid = strings.Join(parts[len(parts)-1:], "-")[0:22]
 
+		//Get Hostname + Agent ID based on other naming scheme with a GUID agent ID (Ex. "<HOSTNAME>-<GUID>.zip")
+	} else if parts := strings.Split(baseFileName, "-"); len(parts) >= 2 && agentIDGUIDHexRegex.MatchString(parts[len(parts)-1]) {
+		hostname = strings.Join(parts[0:len(parts)-1], "-")
+		agentid = parts[len(parts)-1]
+
 		//Get Hostname + Agent ID based on usual naming scheme (Ex. "<HOSTNAME>-<AGENTID>-<OTHER>-<AUDITTYPE>.zip")
 	} else if len(strings.Split(baseFileName, "-")) >= 4 {
 		parts := strings.Split(baseFileName, "-")
 		if len(strings.Join(parts[len(parts)-3:len(parts)-2], "-")) == 22 {
 			hostname = strings.Join(parts[0:len(parts)-3], "-")
 			agentid = strings.Join(parts[len(parts)-3:len(parts)-2], "-")[0:22]
+		} else if agentIDGUIDHexRegex.MatchString(parts[len(parts)-3]) {
+			hostname = strings.Join(parts[0:len(parts)-3], "-")
+			agentid = parts[len(parts)-3]
 		}
 	}
+	agentid = options.AgentIDs.Normalize(options, agentid, fileName)
 
 	// === RENAME THE FILES TO PROPER NAMES === //
 
 	//Open manifest.json
 	manifestFile, exists := zipFileContents["manifest.json"]
 	if !exists {
-		c <- ThreadReturnExtract{threadNum, fileName, options.Warnbox + `WARNING - Failed to unarchive '` + fileName + `'. Could not find of 'manifest.json'.`, xmlfiles}
+		c <- ThreadReturnExtract{threadNum, fileName, options.Warnbox + `WARNING - Failed to unarchive '` + fileName + `'. Could not find of 'manifest.json'.`, xmlfiles, nil, nil, nil}
 		return
 	}
 	manifestFile.IsExtracted = true
 	zipFileContents["manifest.json"] = manifestFile
 	scanner := bufio.NewScanner(manifestFile.File)
 	var generator = ""
+	var manifestAudit = "" //Generator as requested by script.xml, before it is made safe for file names
 	var payload = ""
 	var ptype = ""
 	var filename = ""
 
-	var outputDir = options.InputPath
+	var outputDir = InputScratchDir(options)
 	if len(options.ExtractionOutputDir) > 0 {
 		outputDir = options.ExtractionOutputDir
 	}
 
+	//Acquired files get their original timestamps once the whole manifest has been read
+	extracted := []ExtractedFile{}
+	manifestTimes := map[string]map[string]time.Time{} //map[payload]map["Modified"]time
+
+	//Files collected by "multifile" acquisitions are listed in a CSV file with their metadata
+	multifilePayloads := []string{}
+	multifileMetadata := map[string]map[string]string{} //map[payload]map["FileName"]value
+
+	//Payloads of the audits, so parsed rows can be matched to the collection times of metadata.json
+	auditPayloads := []string{}
+
+	//Audits of manifest.json, true if they have results other than issues, and audits which did not produce an audit
+	manifestAudits := map[string]bool{}
+	mismatches := []AuditMismatch{}
+	addMismatch := func(audit string, problem string) {
+		redacted, _ := RedactedSidecarHostname(options, hostname)
+		mismatches = append(mismatches, AuditMismatch{RedactedArchiveName(options, filepath.Base(fileName), hostname), redacted, agentid, audit, problem})
+	}
+	addMultifileMetadata := func(name string, value string) {
+		if !strings.Contains(generator, "multifile") || payload == "" {
+			return
+		}
+		if _, exists := multifileMetadata[payload]; !exists {
+			multifileMetadata[payload] = map[string]string{}
+			multifilePayloads = append(multifilePayloads, payload)
+		}
+		multifileMetadata[payload][name] = value
+	}
+
 	//Iterate manifest.json line by line
 	for scanner.Scan() {
 		var line = scanner.Text()
@@ -306,11 +556,18 @@ func GoAuditExtract_Thread(file os.FileInfo, options Options, threadNum int, c c
 		if strings.Contains(line, "\"generator\"") {
 			line = strings.TrimSpace(line)
 			generator = line[14 : len(line)-2]
+			manifestAudit = generator
+			if _, exists := manifestAudits[manifestAudit]; !exists {
+				manifestAudits[manifestAudit] = false
+			}
 		} else if strings.Contains(line, "\"payload\"") {
 			line = strings.TrimSpace(line)
 			payload = line[12 : len(line)-2]
 		} else if strings.Contains(line, "\"type\": \"application/") {
 
+			if !strings.Contains(line, "issue") {
+				manifestAudits[manifestAudit] = true
+			}
 			ptype = ""
 			if strings.Contains(line, "issue") {
 				ptype = ".issues"
@@ -334,14 +591,20 @@ func GoAuditExtract_Thread(file os.FileInfo, options Options, threadNum int, c c
 			new_name = hostname + "-" + agentid + "-" + payload + "-" + generator + ptype
 
 			oldFile, exists := zipFileContents[old_name]
-			if ptype == ".issues" {
-				oldFile.File.Close()
-				oldFile.IsExtracted = true
-				zipFileContents[old_name] = oldFile
+			//Issues files are only parsed with '-pi'
+			if ptype == ".issues" && !options.ParseIssues {
+				if exists {
+					oldFile.File.Close()
+					oldFile.IsExtracted = true
+					zipFileContents[old_name] = oldFile
+				}
 				continue
 			}
 			if !exists {
 				warningMessages = append(warningMessages, "Could not find file '"+old_name+"' to rename into '"+new_name+"'.")
+				if ptype == ".xml" {
+					addMismatch(manifestAudit, "listed in manifest.json with payload '"+old_name+"', which is not in the archive")
+				}
 				continue
 			}
 			oldFile.IsExtracted = true
@@ -352,12 +615,33 @@ func GoAuditExtract_Thread(file os.FileInfo, options Options, threadNum int, c c
 			}
 
 			outFilePath := filepath.Join(outputDir, new_name)
-			outFile, err_o := os.Create(outFilePath)
+
+			//XML audits under '-emem <int>' MB are handed to the parse workers in memory, bigger ones are written to disk
+			var payloadReader io.Reader = oldFile.File
+			if ptype == ".xml" || ptype == ".issues" {
+				xmlfile, spill, kept, err_k := options.MemoryPayloads.Keep(outFilePath, oldFile.File)
+				if err_k != nil {
+					oldFile.File.Close()
+					warningMessages = append(warningMessages, "Could not read contents of '"+old_name+"' for destination file '"+new_name+"'. "+err_k.Error())
+					continue
+				}
+				if kept {
+					oldFile.File.Close()
+					xmlfiles = append(xmlfiles, xmlfile)
+					if ptype == ".xml" {
+						auditPayloads = append(auditPayloads, old_name)
+					}
+					continue
+				}
+				payloadReader = spill
+			}
+
+			outFile, err_o := CreateOutputFile(options, outFilePath)
 			if err_o != nil {
 				warningMessages = append(warningMessages, "Could not create destination file '"+new_name+"'. "+err_o.Error())
 				continue
 			}
-			_, err_c := io.Copy(outFile, oldFile.File)
+			_, err_c := io.Copy(outFile, payloadReader)
 			if err_c != nil {
 				warningMessages = append(warningMessages, "Could not copy contents to destination file '"+new_name+"'. "+err_c.Error())
 				continue
@@ -366,10 +650,13 @@ func GoAuditExtract_Thread(file os.FileInfo, options Options, threadNum int, c c
 			oldFile.File.Close()
 			outFile.Close()
 
-			if ptype == ".xml" {
+			if ptype == ".xml" || ptype == ".issues" {
 				xmlfile, _ := os.Stat(outFilePath)
 				xmlfiles = append(xmlfiles, xmlfile)
 			}
+			if ptype == ".xml" {
+				auditPayloads = append(auditPayloads, old_name)
+			}
 
 			//Files from acquisition
 		} else if strings.Contains(line, "\"name\": \"mandiant/mir/agent/FileName\"") {
@@ -377,11 +664,14 @@ func GoAuditExtract_Thread(file os.FileInfo, options Options, threadNum int, c c
 			line = scanner.Text()
 			line = strings.TrimSpace(line)
 			filename = line[10 : len(line)-1]
+			addMultifileMetadata("FileName", ManifestValue(line))
 		} else if strings.Contains(line, "\"name\": \"mandiant/mir/agent/FilePath\"") {
 			scanner.Scan()
 			line = scanner.Text()
 			line = strings.TrimSpace(line)
 			path := line[10 : len(line)-1]
+			originalPath := strings.Replace(path, "\\\\", "\\", -1)
+			addMultifileMetadata("FilePath", ManifestValue(line))
 			path = strings.Replace(path, "\\\\", "_", -1)
 			path = strings.Replace(path, "\\", "_", -1)
 			path = strings.Replace(path, "/", "_", -1)
@@ -410,12 +700,23 @@ func GoAuditExtract_Thread(file os.FileInfo, options Options, threadNum int, c c
 			}
 
 			outFilePath := filepath.Join(outputDir, new_name)
-			outFile, err_o := os.Create(outFilePath)
+			outFile, err_o := CreateOutputFile(options, outFilePath)
 			if err_o != nil {
 				warningMessages = append(warningMessages, "Could not create destination file '"+new_name+"'. "+err_o.Error())
 				continue
 			}
-			_, err_c := io.Copy(outFile, oldFile.File)
+			var err_c error
+			hasher := NewExtractedFileHasher(options)
+			src := hasher.Reader(oldFile.File)
+			if IsMemoryImage(filename, generator) {
+				image := MemoryImage{Archive: fileName, Hostname: hostname, AgentID: agentid, Name: filename, Path: outFilePath}
+				err_c = CopyMemoryImage(outFile, src, &image)
+				if err_c == nil {
+					memimages = append(memimages, image)
+				}
+			} else {
+				_, err_c = io.Copy(outFile, src)
+			}
 			if err_c != nil {
 				warningMessages = append(warningMessages, "Could not copy contents to destination file '"+new_name+"'. "+err_c.Error())
 				continue
@@ -423,41 +724,132 @@ func GoAuditExtract_Thread(file os.FileInfo, options Options, threadNum int, c c
 
 			oldFile.File.Close()
 			outFile.Close()
+			extractedFile := ExtractedFile{Archive: fileName, Hostname: hostname, AgentID: agentid, Payload: old_name, OriginalPath: originalPath + filename, Path: outFilePath}
+			hasher.Set(&extractedFile)
+			extracted = append(extracted, extractedFile)
+		} else if strings.Contains(line, "\"name\": \"mandiant/mir/agent/") {
+			//Other metadata such as the original file times "mandiant/mir/agent/FileModified"
+			line = strings.TrimSpace(line)
+			name := strings.TrimSuffix(strings.TrimSuffix(line[9:], ","), "\"")
+			scanner.Scan()
+			value := ManifestValue(scanner.Text())
+			field := AcquisitionTimeField(name)
+			if field == "" {
+				addMultifileMetadata(strings.TrimPrefix(name, "mandiant/mir/agent/"), value)
+				continue
+			}
+			if t, ok := ParseAcquisitionTime(value); ok {
+				if _, exists := manifestTimes[payload]; !exists {
+					manifestTimes[payload] = map[string]time.Time{}
+				}
+				manifestTimes[payload][field] = t
+				addMultifileMetadata(field, t.Format("2006-01-02 15:04:05"))
+			}
 		}
 	}
 	manifestFile.File.Close()
 	if err_s := scanner.Err(); err_s != nil {
-		c <- ThreadReturnExtract{threadNum, fileName, options.Warnbox + `WARNING - Failed to unarchive '` + fileName + `'. An error occurred while reading 'manifest.json.'. ` + err_s.Error(), xmlfiles}
+		c <- ThreadReturnExtract{threadNum, fileName, options.Warnbox + `WARNING - Failed to unarchive '` + fileName + `'. An error occurred while reading 'manifest.json.'. ` + err_s.Error(), xmlfiles, nil, nil, nil}
 		return
 	}
 
+	//Audits script.xml requested which have no results in manifest.json
+	requested := []string{}
+	if scriptFile, exists := zipFileContents["script.xml"]; exists {
+		modules, err_r := ScriptModules(scriptFile.File)
+		if err_r != nil {
+			warningMessages = append(warningMessages, "Could not read contents of 'script.xml'. "+err_r.Error())
+		}
+		requested = modules
+	}
+	problems := ManifestAuditProblems(requested, manifestAudits)
+	for audit, problem := range problems {
+		addMismatch(audit, problem)
+	}
+
+	if len(multifilePayloads) > 0 {
+		//The CSV file goes with the parsed audits, unless only extracting
+		csvDir := options.OutputPath
+		if len(options.ExtractionOutputDir) > 0 {
+			csvDir = outputDir
+		}
+		csvPath, err_w := WriteMultiFileAcquisitionCSV(options, csvDir, fileName, hostname, agentid, multifilePayloads, multifileMetadata)
+		if err_w != nil {
+			warningMessages = append(warningMessages, "Could not write multi-file acquisition listing '"+csvPath+"'. "+err_w.Error())
+		}
+	}
+
+	//Record when the triage package was collected for '-pcm'
+	if metadataContents != nil && options.ParseCollectionMetadata {
+		requestTime, completeTime := ReadCollectionMetadataTimes(metadataContents)
+		if requestTime != "" || completeTime != "" {
+			csvDir := options.OutputPath
+			if len(options.ExtractionOutputDir) > 0 {
+				csvDir = outputDir
+			}
+			metadata := CollectionMetadata{filepath.Base(fileName), hostname, agentid, auditPayloads, requestTime, completeTime}
+			csvPath, err_w := WriteCollectionMetadataCSV(options, csvDir, metadata)
+			if err_w != nil {
+				warningMessages = append(warningMessages, "Could not write collection metadata '"+csvPath+"'. "+err_w.Error())
+			}
+		}
+	}
+
 	//Extract any remaining files that have not yet been extracted
 	for filename, file := range zipFileContents {
 		if !file.IsExtracted {
 			if filename == "script.xml" {
 				continue
 			}
-			outFile, err_o := os.Create(filepath.Join(outputDir, filename))
+			outFilePath := filepath.Join(outputDir, filename)
+			outFile, err_o := CreateOutputFile(options, outFilePath)
 			if err_o != nil {
 				warningMessages = append(warningMessages, "Could not create destination file '"+filename+"'. "+err_o.Error())
 				continue
 			}
-			_, err_c := io.Copy(outFile, file.File)
+			var err_c error
+			hasher := NewExtractedFileHasher(options)
+			src := hasher.Reader(file.File)
+			if IsMemoryImage(filename, "") {
+				image := MemoryImage{Archive: fileName, Hostname: hostname, AgentID: agentid, Name: filename, Path: outFilePath}
+				err_c = CopyMemoryImage(outFile, src, &image)
+				if err_c == nil {
+					memimages = append(memimages, image)
+				}
+			} else {
+				_, err_c = io.Copy(outFile, src)
+			}
 			if err_c != nil {
 				warningMessages = append(warningMessages, "Could not copy contents to destination file '"+filename+"'.")
 				continue
 			}
 			file.File.Close()
 			outFile.Close()
+			extractedFile := ExtractedFile{Archive: fileName, Hostname: hostname, AgentID: agentid, Payload: filename, Path: outFilePath}
+			hasher.Set(&extractedFile)
+			extracted = append(extracted, extractedFile)
+		}
+	}
+
+	//Preserve original timestamps of acquired files
+	for i, file := range extracted {
+		err_t := extracted[i].SetTimes(manifestTimes[file.Payload], zipFileTimes[file.Payload])
+		if err_t != nil {
+			warningMessages = append(warningMessages, "Could not set the original timestamps of '"+filepath.Base(file.Path)+"'. "+err_t.Error())
 		}
 	}
 
 	zipFile.Close()
 
-	if len(warningMessages) > 0 {
-		c <- ThreadReturnExtract{threadNum, fileName, options.Warnbox + `WARNING - File '` + fileName + `' unarchived with issues.` + "\n" + strings.Join(warningMessages, "\n"+options.Warnbox+"- "), xmlfiles}
+	if passwordMessage != "" {
+		if len(warningMessages) > 0 {
+			passwordMessage += "\n" + options.Warnbox + "- " + strings.Join(warningMessages, "\n"+options.Warnbox+"- ")
+		}
+		c <- ThreadReturnExtract{threadNum, fileName, passwordMessage, xmlfiles, memimages, extracted, mismatches}
+	} else if len(warningMessages) > 0 {
+		c <- ThreadReturnExtract{threadNum, fileName, options.Warnbox + `WARNING - File '` + fileName + `' unarchived with issues.` + "\n" + strings.Join(warningMessages, "\n"+options.Warnbox+"- "), xmlfiles, memimages, extracted, mismatches}
 	} else {
-		c <- ThreadReturnExtract{threadNum, fileName, options.Box + `NOTICE - File '` + fileName + `' unarchived successfully.`, xmlfiles}
+		c <- ThreadReturnExtract{threadNum, fileName, options.Box + `NOTICE - File '` + fileName + `' unarchived successfully.`, xmlfiles, memimages, extracted, mismatches}
 	}
 }
 
@@ -0,0 +1,133 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/yeka/zip"
+)
+
+//ReadExtractionPasswordFile reads a '-ep-file' of "<archive name>=<password>" lines
+//"*=<password>" is used for archives which are not listed, and lines starting with "#" are ignored
+func ReadExtractionPasswordFile(path string) (map[string]string, error) {
+	file, err_o := os.Open(path)
+	if err_o != nil {
+		return nil, err_o
+	}
+	defer file.Close()
+	passwords := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, errors.New("line " + strconv.Itoa(lineNum) + " is not formatted as '<archive name>=<password>'")
+		}
+		passwords[strings.ToLower(filepath.Base(strings.TrimSpace(parts[0])))] = parts[1]
+	}
+	return passwords, scanner.Err()
+}
+
+//ExtractionPasswordFor returns the password for an archive from '-ep-file', then '-ep', then the "*" line of '-ep-file'
+func ExtractionPasswordFor(options Options, archiveName string) string {
+	if password, exists := options.ExtractionPasswords[strings.ToLower(filepath.Base(archiveName))]; exists {
+		return password
+	}
+	if options.ExtractionPassword != "" {
+		return options.ExtractionPassword
+	}
+	return options.ExtractionPasswords["*"]
+}
+
+//ArchiveEncryptedFiles returns the number of encrypted files in a ZIP archive
+func ArchiveEncryptedFiles(path string) int {
+	zipFile, err_z := zip.OpenReader(path)
+	if err_z != nil {
+		return 0
+	}
+	defer zipFile.Close()
+	count := 0
+	for _, innerFile := range zipFile.File {
+		if innerFile.IsEncrypted() {
+			count++
+		}
+	}
+	return count
+}
+
+//IsPasswordError reports whether reading an encrypted archive file failed because of its password
+func IsPasswordError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "password") || strings.Contains(msg, "decryption") || strings.Contains(msg, "authentication")
+}
+
+//PromptExtractionPasswords asks for the password of each encrypted archive without one when run from a terminal
+//The passwords are kept in options.ExtractionPasswords for the extraction threads
+func PromptExtractionPasswords(options Options, files []os.FileInfo) {
+	if options.AssumeYes || options.ExtractionPasswords == nil {
+		return
+	}
+	if stat, err_s := os.Stdin.Stat(); err_s != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		return
+	}
+	reader := bufio.NewReader(os.Stdin)
+	for _, file := range files {
+		fileName := filepath.Base(file.Name())
+		if ExtractionPasswordFor(options, fileName) != "" || strings.ToLower(filepath.Ext(fileName)) != ".zip" {
+			continue
+		}
+		encrypted := ArchiveEncryptedFiles(filepath.Join(options.InputPath, fileName))
+		if encrypted == 0 {
+			continue
+		}
+		options.Log.Println(options.Box + "Archive '" + fileName + "' has " + strconv.Itoa(encrypted) + " encrypted file(s). Enter its password, or nothing to skip:")
+		fmt.Print("> ")
+		password := readPassword(reader)
+		fmt.Println()
+		if password != "" {
+			options.ExtractionPasswords[strings.ToLower(fileName)] = password
+		}
+	}
+}
+
+//Read a line without echoing it where 'stty' is available
+func readPassword(reader *bufio.Reader) string {
+	if runtime.GOOS != "windows" {
+		echoOff := exec.Command("stty", "-echo")
+		echoOff.Stdin = os.Stdin
+		if echoOff.Run() == nil {
+			defer func() {
+				echoOn := exec.Command("stty", "echo")
+				echoOn.Stdin = os.Stdin
+				echoOn.Run()
+			}()
+		}
+	}
+	text, _ := reader.ReadString('\n')
+	return strings.TrimRight(text, "\r\n")
+}
@@ -0,0 +1,248 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//FieldDescriptionsMarker is the "Tag" value of the optional descriptions row written under the CSV headers ('-pdesc')
+const FieldDescriptionsMarker = "(Field Descriptions)"
+
+//auditFieldDictionary maps "<AuditType>.<Field>" to the forensic meaning of the field, "*" applies to every audit type
+var auditFieldDictionary = map[string]string{
+	//Added by GoAuditParser
+	"*.Tag":                  "Empty column for analysts to tag rows of interest.",
+	"*.Notes":                "Empty column for analyst notes.",
+	"*.Hostname":             "Hostname of the system the audit was collected from, taken from the audit filename.",
+	"*.OriginalHostname":     "Hostname before '-hs'/'-hl' normalization was applied.",
+	"*.RawXML":               "Original XML of the audit item for rows noted by '-notes' ('-praw').",
+	"*.ProcessKey":           "Hostname, pid, and start time of the process, the same in every audit the process appears in ('-plink').",
+	"*.AgentID":              "22 character FireEye agent ID, or 32 hex digit GUID, of the system the audit was collected from.",
+	"*.FireEyeGeneratedTime": "Time the agent generated this item (the 'created' attribute), not a file system time.",
+	"*.Audit UID":            "Unique ID of the audit item assigned by the agent.",
+	"*.UID":                  "Unique ID of the event assigned by the agent.",
+	"*.Sequence Number":      "Sequence number of the event within the agent's event buffer.",
+	"*.EventBufferType":      "Type of event recorded by the agent's real-time event buffer.",
+	"*.UnixActivity":         "Type of sudo, su, SSH, or cron activity identified by GoAuditParser.",
+	"*.UnixActivityDetail":   "Details of the sudo, su, SSH, or cron activity identified by GoAuditParser.",
+
+	//FileItem
+	"FileItem.FullPath":         "Full path of the file.",
+	"FileItem.Created":          "$STANDARD_INFORMATION creation time (NTFS) or birth time. Easily modified by timestomping.",
+	"FileItem.Modified":         "$STANDARD_INFORMATION content modification time. Easily modified by timestomping.",
+	"FileItem.Accessed":         "$STANDARD_INFORMATION last access time. Often not updated on modern Windows.",
+	"FileItem.Changed":          "$STANDARD_INFORMATION MFT entry change time (metadata change / ctime).",
+	"FileItem.FilenameCreated":  "$FILE_NAME creation time. Harder to timestomp than 'Created', so a mismatch may indicate timestomping.",
+	"FileItem.FilenameModified": "$FILE_NAME modification time, updated when the file is created, moved, or renamed.",
+	"FileItem.FilenameAccessed": "$FILE_NAME access time, updated when the file is created, moved, or renamed.",
+	"FileItem.FilenameChanged":  "$FILE_NAME MFT entry change time, updated when the file is created, moved, or renamed.",
+	"FileItem.SizeInBytes":      "Size of the file in bytes.",
+	"FileItem.Md5sum":           "MD5 hash of the file contents.",
+	"FileItem.Username":         "Owner of the file.",
+	"FileItem.SecurityID":       "SID of the file owner.",
+	"FileItem.FileAttributes":   "File attributes such as Hidden, System, or Archive.",
+	"FileItem.INode":            "MFT record number (Windows) or inode number (Linux/macOS).",
+	"FileItem.DevicePath":       "Device path of the volume the file is on.",
+	"FileItem.PEInfo":           "Portable Executable metadata such as compile time, signature, imports, and exports.",
+	"FileItem.StreamList":       "Alternate data streams of the file.",
+	"FileItem.Signer1":          "Subject of the certificate which signed the file, from the PEInfo signature chain. Added by GoAuditParser.",
+	"FileItem.Issuer1":          "Issuer of the certificate which signed the file. Added by GoAuditParser.",
+	"FileItem.Signer2":          "Subject of the next certificate of the signature chain. Added by GoAuditParser.",
+	"FileItem.Issuer2":          "Issuer of the next certificate of the signature chain. Added by GoAuditParser.",
+	"FileItem.Signer3":          "Subject of the third certificate of the signature chain. Added by GoAuditParser.",
+	"FileItem.Issuer3":          "Issuer of the third certificate of the signature chain. Added by GoAuditParser.",
+	"FileItem.SignatureChain":   "Whole PEInfo signature chain as a JSON list of Subject and Issuer pairs, from the signer towards the root. Added by GoAuditParser.",
+
+	//ProcessItem
+	"ProcessItem.pid":          "Process ID.",
+	"ProcessItem.parentpid":    "Process ID of the parent process. Parent PIDs may have been reused.",
+	"ProcessItem.path":         "Directory of the process executable.",
+	"ProcessItem.name":         "Name of the process executable.",
+	"ProcessItem.arguments":    "Full command line of the process.",
+	"ProcessItem.Username":     "User account the process is running as.",
+	"ProcessItem.SecurityID":   "SID of the user account the process is running as.",
+	"ProcessItem.startTime":    "Time the process started.",
+	"ProcessItem.kernelTime":   "Time the process spent executing in kernel mode.",
+	"ProcessItem.userTime":     "Time the process spent executing in user mode.",
+	"ProcessItem.SecurityType": "Type of the SID the process is running as.",
+
+	//RegistryItem
+	"RegistryItem.Path":      "Full registry path of the key or value.",
+	"RegistryItem.Modified":  "Last write time of the registry key. Applies to the key, not the individual value.",
+	"RegistryItem.Hive":      "Registry hive the key was read from.",
+	"RegistryItem.KeyPath":   "Registry key path without the value name.",
+	"RegistryItem.ValueName": "Name of the registry value.",
+	"RegistryItem.Type":      "Data type of the registry value (REG_SZ, REG_DWORD, ...).",
+	"RegistryItem.Text":      "Registry value data as text.",
+	"RegistryItem.Username":  "User whose hive contains the key (for NTUSER.DAT and UsrClass.dat).",
+
+	//ServiceItem
+	"ServiceItem.name":                  "Service name.",
+	"ServiceItem.descriptiveName":       "Display name of the service.",
+	"ServiceItem.mode":                  "Start mode of the service (Auto, Manual, Disabled, ...).",
+	"ServiceItem.startedAs":             "Account the service runs as.",
+	"ServiceItem.path":                  "Path of the service executable.",
+	"ServiceItem.arguments":             "Command line of the service.",
+	"ServiceItem.pathmd5sum":            "MD5 hash of the service executable.",
+	"ServiceItem.pathSignatureVerified": "Whether the digital signature of the service executable is valid.",
+	"ServiceItem.serviceDLL":            "ServiceDll of svchost-hosted services. A common persistence location.",
+	"ServiceItem.status":                "Whether the service was running when the audit was collected.",
+
+	//TaskItem
+	"TaskItem.Name":              "Name of the scheduled task.",
+	"TaskItem.CreationDate":      "Creation date recorded in the task definition. Can be set by the task author.",
+	"TaskItem.Creator":           "Author recorded in the task definition.",
+	"TaskItem.AccountName":       "Account the task runs as.",
+	"TaskItem.MostRecentRunTime": "Last time the task ran.",
+	"TaskItem.NextRunTime":       "Next scheduled time the task will run.",
+
+	//PrefetchItem
+	"PrefetchItem.ApplicationFileName": "Name of the executable the prefetch file was created for.",
+	"PrefetchItem.ApplicationFullPath": "Full path of the executable the prefetch file was created for.",
+	"PrefetchItem.Created":             "Creation time of the prefetch file, approximately the first execution.",
+	"PrefetchItem.LastRun":             "Last execution time of the application.",
+	"PrefetchItem.TimesExecuted":       "Number of times the application was executed.",
+	"PrefetchItem.PrefetchHash":        "Hash of the executable path used in the prefetch filename.",
+
+	//PersistenceItem
+	"PersistenceItem.PersistenceType": "Persistence mechanism (Registry, Service, Task, StartupFolder, ...).",
+	"PersistenceItem.RegPath":         "Registry path of the persistence entry.",
+	"PersistenceItem.RegModified":     "Last write time of the registry key of the persistence entry.",
+	"PersistenceItem.FilePath":        "File executed by the persistence entry.",
+	"PersistenceItem.md5sum":          "MD5 hash of the file executed by the persistence entry.",
+	"PersistenceItem.FileCreated":     "Creation time of the file executed by the persistence entry.",
+
+	//EventLogItem
+	"EventLogItem.genTime":   "Time the event was generated.",
+	"EventLogItem.writeTime": "Time the event was written to the event log.",
+	"EventLogItem.log":       "Event log the event was read from (Security, System, ...).",
+	"EventLogItem.source":    "Provider that logged the event.",
+	"EventLogItem.EID":       "Event ID. Combine with 'source' to identify the event.",
+	"EventLogItem.message":   "Rendered event message.",
+	"EventLogItem.user":      "User associated with the event.",
+	"EventLogItem.machine":   "Computer name recorded in the event.",
+
+	//Network
+	"PortItem.pid":                 "Process ID that owns the socket.",
+	"PortItem.process":             "Name of the process that owns the socket.",
+	"PortItem.state":               "TCP state of the socket (LISTEN, ESTABLISHED, ...).",
+	"PortItem.localIP":             "Local IP address of the socket.",
+	"PortItem.remoteIP":            "Remote IP address of the socket.",
+	"PortItem.localPort":           "Local port of the socket.",
+	"PortItem.remotePort":          "Remote port of the socket.",
+	"DnsEntryItem.Host":            "Hostname cached in the DNS resolver cache.",
+	"DnsEntryItem.RecordName":      "Record name cached in the DNS resolver cache.",
+	"ArpEntryItem.IPv4Address":     "IP address in the ARP cache.",
+	"ArpEntryItem.PhysicalAddress": "MAC address in the ARP cache.",
+
+	//Browser history
+	"UrlHistoryItem.URL":                      "Visited URL.",
+	"UrlHistoryItem.LastVisitDate":            "Last time the URL was visited.",
+	"UrlHistoryItem.VisitCount":               "Number of times the URL was visited.",
+	"UrlHistoryItem.Typed":                    "Whether the URL was typed into the address bar.",
+	"FileDownloadHistoryItem.SourceURL":       "URL the file was downloaded from.",
+	"FileDownloadHistoryItem.TargetDirectory": "Path the file was downloaded to.",
+	"FileDownloadHistoryItem.StartDate":       "Time the download started.",
+
+	//Unix
+	"ShellHistoryItem.Command":  "Command entered in the shell. Shell history has no timestamp unless the shell was configured to record one.",
+	"ShellHistoryItem.UserName": "User whose shell history file the command was read from.",
+	"ShellHistoryItem.Shell":    "Shell the history file belongs to.",
+	"Syslog.Time":               "Time of the syslog message. Syslog formats often omit the year.",
+	"Syslog.Sender":             "Program that logged the message.",
+	"Syslog.Message":            "Syslog message text.",
+
+	//Quarantine
+	"QuarantineListItem.QuarId":            "ID the agent assigned to the quarantined file, also used to name its acquired payload.",
+	"QuarantineListItem.QuarantineTime":    "Time the file was quarantined.",
+	"QuarantineListItem.FileState":         "State of the quarantined file (quarantined, restored, deleted, ...).",
+	"QuarantineListItem.Final":             "Whether the quarantine verdict is final.",
+	"QuarantineListItem.QuarantinePayload": "Filename of the acquired quarantine payload in the input directory, matched by QuarId or by FileSize and FileMD5. Added by GoAuditParser.",
+
+	//Event buffer
+	"EventItem_ProcessEvent.ProcessCmdLine":       "Command line of the process.",
+	"EventItem_ProcessEvent.EventType":            "Whether the process started or ended.",
+	"EventItem_ProcessEvent.ParentProcessPath":    "Path of the parent process.",
+	"EventItem_FileWriteEvent.FullPath":           "Path of the file written.",
+	"EventItem_FileWriteEvent.TextAtLowestOffset": "Sample of the bytes written, useful to identify file types.",
+	"EventItem_Ipv4NetworkEvent.RemoteIP":         "Remote IP address of the connection.",
+	"EventItem_DnsLookupEvent.DNSHostname":        "Hostname that was looked up.",
+	"EventItem_RegKeyEvent.EventType":             "Type of registry change (created, value set, deleted, ...).",
+	"EventItem_UrlMonitorEvent.RequestUrl":        "Requested URL of the HTTP request.",
+	"EventItem_Hits.Timestamp":                    "Time of the event which hit, the same as its \"EventBufferTime_<EventType>\" column.",
+	"EventItem_Hits.Hit":                          "Position of the hit in the hits of the event, starting at 1.",
+	"EventItem_Hits.Indicator":                    "GUID of the indicator the event hit. Rows link to their event by UID. Added by GoAuditParser ('-phits').",
+	"EventItem_Hits.Other GUIDs":                  "Remaining GUIDs of the hit, comma delimited.",
+	"Hits.File":                                   "Eventbuffer or stateagentinspector XML file of the event which hit. The other columns are those of EventItem_Hits ('-phits').",
+}
+
+//GetAuditFieldDescription returns the description of a CSV header for an audit type, or "" if unknown
+func GetAuditFieldDescription(auditType string, header string) string {
+	if description, exists := auditFieldDictionary[auditType+"."+header]; exists {
+		return description
+	}
+	if strings.HasPrefix(header, "EventBufferTime_") {
+		return "Time the agent recorded the event."
+	}
+	return auditFieldDictionary["*."+header]
+}
+
+//GetFieldDescriptionsRow returns the descriptions row for the CSV headers if '-pdesc' was used, otherwise nil
+//The first cell is replaced with FieldDescriptionsMarker so the row can be told apart from audit data
+func GetFieldDescriptionsRow(options Options, auditType string, headers []string) []string {
+	if !options.ParseFieldDescriptions || len(headers) == 0 {
+		return nil
+	}
+	row := make([]string, len(headers))
+	for i, header := range headers {
+		row[i] = GetAuditFieldDescription(auditType, header)
+	}
+	row[0] = FieldDescriptionsMarker
+	return row
+}
+
+//DescribeAuditFields returns "<AuditType>.<Field>" keys matching the query, case-insensitively
+//"FileItem.Created" matches one field, "FileItem" matches every field of FileItem, and "Created" matches the field in every audit type
+func DescribeAuditFields(query string) []string {
+	query = strings.ToLower(query)
+	matches := []string{}
+	for key := range auditFieldDictionary {
+		lkey := strings.ToLower(key)
+		parts := strings.SplitN(lkey, ".", 2)
+		if lkey == query || parts[0] == query || parts[1] == query || "*."+query == lkey {
+			matches = append(matches, key)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+//GoAuditDescribe_Start prints the descriptions of the queried audit fields for the 'describe' subcommand
+func GoAuditDescribe_Start(queries []string) {
+	if len(queries) == 0 {
+		fmt.Println("Usage: goauditparser describe <AuditType>[.<Field>] ...")
+		fmt.Println("   Ex: goauditparser describe FileItem.FilenameCreated")
+		return
+	}
+	for _, query := range queries {
+		matches := DescribeAuditFields(query)
+		if len(matches) == 0 {
+			fmt.Println("[!] No description found for '" + query + "'.")
+			continue
+		}
+		for _, key := range matches {
+			fmt.Println("[+] " + key + "\n      " + auditFieldDictionary[key])
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//Name of the per-engagement file of default flags, looked for in the input directory and then the working directory
+const FlagFileName = ".gapflags"
+
+//Flags a ".gapflags" file can't set, with why. Anyone who can write to an input directory could otherwise make every
+//run delete files without asking, send data or results elsewhere, or run the command of another config
+var flagFileForbiddenFlags = map[string]string{
+	"wo":          "deletes output files",
+	"y":           "skips confirmations",
+	"retention":   "deletes output files",
+	"prune-cache": "deletes parse cache entries",
+	"gu":          "overwrites golden files",
+	"notify":      "sends notifications",
+	"notify-smtp": "sends notifications",
+	"notify-host": "sends notifications",
+	"dq":          "shares work through another directory",
+	"o":           "chooses where results are written",
+	"logfile":     "chooses where the log is written",
+	"ep":          "holds an archive password",
+	"ep-file":     "reads archive passwords",
+	"c":           "loads a main config, which may run a memory image command",
+}
+
+//FindFlagFile returns the path of the ".gapflags" file applied to this run, or "" if there is none
+//Each comma delimited input path is checked in order (the directory of an input file), then the working directory
+func FindFlagFile(inputPath string) string {
+	dirs := []string{}
+	for _, path := range strings.Split(inputPath, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if info, err_s := os.Stat(path); err_s == nil && !info.IsDir() {
+			path = filepath.Dir(path)
+		}
+		dirs = append(dirs, path)
+	}
+	dirs = append(dirs, ".")
+	for _, dir := range dirs {
+		path := filepath.Join(dir, FlagFileName)
+		if info, err_s := os.Stat(path); err_s == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+//ReadFlagFile returns the flags of a ".gapflags" file, which are written like on the command line
+//Flags may span several lines, lines starting with "#" are comments, and values with spaces need quotes
+func ReadFlagFile(path string) ([]string, error) {
+	data, err_r := ioutil.ReadFile(path)
+	if err_r != nil {
+		return nil, err_r
+	}
+	args := []string{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields, err_s := splitFlagFileLine(line)
+		if err_s != nil {
+			return nil, errors.New("line " + strconv.Itoa(i+1) + ": " + err_s.Error())
+		}
+		args = append(args, fields...)
+	}
+	return args, nil
+}
+
+//Splits a line on spaces, keeping quoted values such as "my dir" or 'my dir' together
+func splitFlagFileLine(line string) ([]string, error) {
+	fields := []string{}
+	var field strings.Builder
+	inField := false
+	quote := rune(0)
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			field.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inField = true
+		case r == ' ' || r == '\t' || r == '\r':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("missing closing quote")
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+//ApplyFlagFile sets the flags of a ".gapflags" file, then sets the command line flags again so they override them
+//Returns the names of the flags the file set, or an error if it sets one of flagFileForbiddenFlags
+func ApplyFlagFile(args []string) (map[string]bool, error) {
+	//A flag set sharing the values of the command line flags, which reports errors instead of exiting
+	fileFlags := flag.NewFlagSet(FlagFileName, flag.ContinueOnError)
+	fileFlags.SetOutput(ioutil.Discard)
+	fileFlags.Usage = func() {}
+	flag.VisitAll(func(f *flag.Flag) {
+		fileFlags.Var(f.Value, f.Name, f.Usage)
+	})
+	if err_p := fileFlags.Parse(args); err_p != nil {
+		return nil, err_p
+	}
+	if fileFlags.NArg() > 0 {
+		return nil, errors.New("unexpected argument(s) '" + strings.Join(fileFlags.Args(), "' '") + "'")
+	}
+	set := map[string]bool{}
+	forbidden := []string{}
+	fileFlags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+		if reason, exists := flagFileForbiddenFlags[f.Name]; exists {
+			forbidden = append(forbidden, "'-"+f.Name+"' ("+reason+")")
+		}
+	})
+	if len(forbidden) > 0 {
+		return nil, errors.New("Only the command line can set " + strings.Join(forbidden, ", ") + ".")
+	}
+	//The command line was already parsed once, so it has no errors
+	flag.CommandLine.Parse(os.Args[1:])
+	return set, nil
+}
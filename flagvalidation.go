@@ -0,0 +1,374 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+//Exit code for conflicting or incomplete flags, the same as the flag package uses for unknown flags
+const FlagConflictExitCode = 2
+
+//Flags which only change how timelines are made
+var timelineOnlyFlags = []string{"tld", "tlout", "tlf", "tlcf", "tlmmap", "tlbucket", "tlfmt", "tlhost", "tlagent", "tlaudit"}
+
+//ValidateFlags returns a message for every combination of the explicitly set flags which can't work together
+//set holds the names of the flags given on the command line, args the arguments left after them
+func ValidateFlags(options Options, set map[string]bool, args []string) []string {
+	conflicts := []string{}
+	conflict := func(msg string) {
+		conflicts = append(conflicts, msg)
+	}
+	timeline := set["tl"] || set["tlsod"] || set["tlverify"] || set["tlstream"] || set["tlmem"] || set["tlanom"]
+
+	if len(args) > 0 {
+		conflict("Unexpected argument(s) '" + strings.Join(args, "' '") + "'. Flags must come before them, and paths with spaces need quotes. Ex: -i \"my dir\"")
+	}
+
+	//Modes which do not parse
+	noParseModes := []struct {
+		flag string
+		what string
+	}{
+		{"efo", "only extracts acquired files"},
+		{"eo", "only extracts archives"},
+		{"xso", "only splits XML files"},
+		{"ebs", "only splits event buffer XML files"},
+	}
+	modes := []string{}
+	for _, mode := range noParseModes {
+		if !set[mode.flag] {
+			continue
+		}
+		if mode.flag == "eo" && set["efo"] {
+			continue //'-efo' uses '-eo' as its output directory
+		}
+		modes = append(modes, "-"+mode.flag)
+		if timeline || set["tlo"] {
+			conflict("'-" + mode.flag + "' " + mode.what + " and does not parse audits, so there is nothing to timeline. Remove the timeline flags, or run '-tlo' on parsed CSV files afterwards.")
+		}
+		if set["evtx"] {
+			conflict("'-" + mode.flag + "' " + mode.what + " and does not parse audits, so acquired event logs are not converted. Remove '-evtx', or remove '-" + mode.flag + "' to parse.")
+		}
+		if set["o"] {
+			conflict("'-" + mode.flag + "' " + mode.what + " and does not parse audits, so '-o <dir>' would not be used. Remove '-o', or remove '-" + mode.flag + "' to parse into it.")
+		}
+		if set["snapshot"] {
+			conflict("'-" + mode.flag + "' " + mode.what + ", so there is no CSV output for '-snapshot'. Remove '-snapshot'.")
+		}
+		if set["readme"] {
+			conflict("'-" + mode.flag + "' " + mode.what + ", so there is no output directory for '-readme' to describe. Remove '-readme'.")
+		}
+		if set["xlsx"] {
+			conflict("'-" + mode.flag + "' " + mode.what + ", so there are no parsed files for '-xlsx <str>'. Remove '-xlsx'.")
+		}
+		if set["obs"] {
+			conflict("'-" + mode.flag + "' " + mode.what + ", so there are no parsed files for '-obs <str>'. Remove '-obs'.")
+		}
+		if set["redact"] {
+			conflict("'-" + mode.flag + "' " + mode.what + ", so there are no parsed files for '-redact <file>'. Remove '-redact'.")
+		}
+		if set["emem"] {
+			conflict("'-" + mode.flag + "' " + mode.what + ", so extracted XML audits must be written to disk. Remove '-emem'.")
+		}
+	}
+	if len(modes) > 1 {
+		conflict("Only one of " + strings.Join(modes, ", ") + " can be used at a time. Run them one after another.")
+	}
+
+	//Timelining
+	if set["tlo"] {
+		if !set["o"] && !set["i"] {
+			conflict("'-tlo' timelines CSV files which were already parsed. Provide their directory with '-o <csv_dir>'.")
+		}
+		if set["wo"] {
+			conflict("'-tlo' does not parse, so '-wo' would not wipe anything. Remove '-wo'.")
+		}
+		if set["redact"] {
+			conflict("'-redact <file>' redacts values while parsing, but '-tlo' does not parse. Parse with '-redact' and '-tl' to timeline the redacted files.")
+		}
+		if set["evtx"] {
+			conflict("'-evtx' converts event logs acquired in archives, but '-tlo' does not extract archives. Parse with '-evtx' and '-tl' to timeline them.")
+		}
+		if set["eh"] {
+			conflict("'-eh' hashes files acquired in archives while extracting them, but '-tlo' does not extract archives. Remove '-eh'.")
+		}
+	} else if !timeline {
+		for _, name := range timelineOnlyFlags {
+			if set[name] && !(name == "tlcf" && set["validate"]) {
+				conflict("'-" + name + "' only applies to timelines. Add '-tl' to parse and timeline, or '-tlo' to timeline already parsed CSV files.")
+			}
+		}
+	}
+
+	if set["tlverify"] && set["tlfmt"] && !strings.EqualFold(strings.TrimSpace(options.TimelineFormat), TimelineFormatCSV) {
+		conflict("'-tlverify <int>' reads back CSV timelines and can't verify '-tlfmt " + options.TimelineFormat + "'. Remove one of them, or verify a CSV timeline.")
+	}
+
+	//Merging reads CSV files which were already parsed
+	if set["merge"] {
+		if set["i"] {
+			conflict("'-merge <dir>' merges CSV files which were already parsed and does not parse audits. Remove '-i', and provide the CSV directory with '-o <csv_dir>'.")
+		}
+		if timeline || set["tlo"] {
+			conflict("'-merge <dir>' does not timeline. Run '-tlo -o <dir>' on the merged CSV files afterwards.")
+		}
+		others := append([]string{}, modes...)
+		for _, name := range []string{"wo", "snapshot", "golden", "dq", "readme", "xlsx", "obs", "redact"} {
+			if set[name] {
+				others = append(others, "-"+name)
+			}
+		}
+		if len(others) > 0 {
+			conflict("'-merge <dir>' only merges parsed CSV files and can't be used with " + strings.Join(others, ", ") + ".")
+		}
+		if filepath.Clean(options.MergeOutputDir) == filepath.Clean(options.OutputPath) {
+			conflict("'-merge <dir>' must be a different directory than '-o <csv_dir>', so merged files are not merged again.")
+		}
+	}
+
+	//Retention only deletes old output files
+	if set["retention"] {
+		if options.RetentionDays < 1 {
+			conflict("'-retention <int>' is the number of days output files are kept, and must be at least 1.")
+		}
+		others := append([]string{}, modes...)
+		if timeline {
+			others = append(others, "-tl")
+		}
+		for _, name := range []string{"i", "tlo", "merge", "wo", "snapshot", "golden", "dq", "readme", "xlsx", "obs", "redact", "prune-cache"} {
+			if set[name] {
+				others = append(others, "-"+name)
+			}
+		}
+		if len(others) > 0 {
+			conflict("'-retention <int>' only deletes old output files and can't be used with " + strings.Join(others, ", ") + ". Run it on its own with '-o <dir>', or with the 'Retention_Roots' of the main config.")
+		}
+	}
+
+	//Validation only reads the configs and the parsed CSV headers
+	if set["validate"] {
+		others := append([]string{}, modes...)
+		if timeline {
+			others = append(others, "-tl")
+		}
+		for _, name := range []string{"i", "tlo", "merge", "wo", "snapshot", "golden", "dq", "readme", "xlsx", "obs", "redact", "prune-cache", "retention"} {
+			if set[name] {
+				others = append(others, "-"+name)
+			}
+		}
+		if len(others) > 0 {
+			conflict("'-validate' only checks the timeline config and can't be used with " + strings.Join(others, ", ") + ". Run it on its own with '-o <dir>', and '-tlcf <file>' if needed.")
+		}
+	}
+
+	//Watching parses the input directory again whenever files land in it
+	if set["watch"] {
+		if !set["i"] {
+			conflict("'-watch' parses the files which land in the input directory. Provide it with '-i <dir>'.")
+		}
+		if options.WatchIntervalSeconds < 1 {
+			conflict("'-watch-interval <int>' is the number of seconds between checks of the input directory, and must be at least 1.")
+		}
+		others := append([]string{}, modes...)
+		for _, name := range []string{"tlo", "merge", "snapshot", "golden", "prune-cache", "retention", "validate"} {
+			if set[name] {
+				others = append(others, "-"+name)
+			}
+		}
+		if len(others) > 0 {
+			conflict("'-watch' keeps parsing the input directory into '-o <dir>' and can't be used with " + strings.Join(others, ", ") + ".")
+		}
+	}
+
+	//Golden verification parses into a temporary directory and compares it
+	if set["golden"] {
+		if timeline || set["tlo"] {
+			conflict("'-golden <dir>' only compares parsed CSV files, timelines are not verified. Remove the timeline flags.")
+		}
+		if set["o"] || set["wo"] || set["snapshot"] || set["readme"] {
+			conflict("'-golden <dir>' parses into a temporary directory, so '-o', '-wo', '-snapshot', and '-readme' would not be used. Remove them.")
+		}
+		if len(modes) > 0 {
+			conflict("'-golden <dir>' cannot be used with " + strings.Join(modes, ", ") + ".")
+		}
+		if strings.EqualFold(strings.TrimSpace(options.ParseAnomalyPolicy), ParseAnomalyPolicyLenient) {
+			conflict("'-golden <dir>' verifies the parser, so parse anomalies must fail it. Remove '-pap lenient'.")
+		}
+		if set["redact"] {
+			conflict("'-golden <dir>' compares parsed values with the expected ones, which '-redact <file>' would change. Remove '-redact'.")
+		}
+	} else if set["gu"] || set["gro"] {
+		conflict("'-gu' and '-gro' change how output is verified. Provide the golden directory with 'goauditparser verify -golden <dir>'.")
+	}
+
+	//JSON output is not read by the timeliner or golden verification
+	jsonFlag := ""
+	if set["pjson"] {
+		jsonFlag = "-pjson"
+		if set["of"] && !strings.EqualFold(strings.TrimSpace(options.OutputFormat), OutputFormatNested) {
+			conflict("'-pjson' is the same as '-of nested' and can't be used with '-of " + options.OutputFormat + "'. Remove one of them.")
+		}
+	} else if set["of"] && !strings.EqualFold(strings.TrimSpace(options.OutputFormat), OutputFormatCSV) {
+		jsonFlag = "-of " + options.OutputFormat
+	}
+	if jsonFlag != "" {
+		if timeline {
+			conflict("'" + jsonFlag + "' writes JSON Lines files which can't be timelined. Remove the timeline flags, or parse to CSV for the timeline.")
+		}
+		if set["golden"] {
+			conflict("'-golden <dir>' compares CSV files. Remove '" + jsonFlag + "'.")
+		}
+		if set["pdesc"] {
+			conflict("'-pdesc' writes field descriptions under the CSV headers, which '" + jsonFlag + "' does not write. Remove '-pdesc'.")
+		}
+		if strings.EqualFold(strings.TrimSpace(options.ParseProvenance), ProvenanceComment) {
+			conflict("'-pprov comment' writes a comment line above the CSV headers, which JSON Lines files can't have. Use '-pprov sidecar' with '" + jsonFlag + "'.")
+		}
+		if set["xlsx"] {
+			conflict("'-xlsx <str>' writes workbooks from the parsed CSV files, which '" + jsonFlag + "' does not write. Remove one of them.")
+		}
+		if set["obs"] {
+			conflict("'-obs <str>' exports observables from the parsed CSV files, which '" + jsonFlag + "' does not write. Remove one of them.")
+		}
+	}
+
+	//Streamed files are written batch by batch while they are parsed
+	if set["pstream"] {
+		if set["pdd"] {
+			conflict("'-pdd' collapses identical rows across a whole file, but '-pstream <int>' writes rows before the file is parsed. Remove one of them.")
+		}
+		if set["praw"] {
+			conflict("'-praw' reads the XML of noted rows after a file is parsed, but '-pstream <int>' writes rows before the file is parsed. Remove one of them.")
+		}
+		if set["pck"] {
+			conflict("'-pck <int>' resumes a file from the rows parsed before a crash, but '-pstream <int>' already wrote them. Remove one of them.")
+		}
+		if set["plink"] {
+			conflict("'-plink' adds keys once a whole file is parsed, but '-pstream <int>' writes rows before the file is parsed. Remove one of them.")
+		}
+		if set["of"] && strings.EqualFold(strings.TrimSpace(options.OutputFormat), OutputFormatJSON) {
+			conflict("'-of json' types each column from every row of a file, but '-pstream <int>' writes rows before the file is parsed. Use '-of nested' or CSV.")
+		}
+	}
+
+	//Extracted XML audits held in memory only exist for the parse workers of this run
+	if set["emem"] {
+		if options.ExtractMemoryMB < 1 {
+			conflict("'-emem <int>' must be at least 1 MB.")
+		} else if options.ExtractMemoryMaxMB < options.ExtractMemoryMB {
+			conflict("'-emem-max <int>' must be at least '-emem <int>', or no XML audit fits in memory.")
+		}
+		if set["tlo"] {
+			conflict("'-tlo' only timelines parsed CSV files, so no archives are extracted. Remove '-emem'.")
+		}
+		if set["dq"] {
+			conflict("'-emem <int>' cannot be used with '-dq <dir>' since other workers could not claim XML audits held in memory. Remove '-emem'.")
+		}
+		if set["pck"] {
+			conflict("'-pck <int>' resumes XML files from disk after a crash, but '-emem <int>' does not write them to disk. Remove one of them.")
+		}
+	}
+
+	if set["pprov"] {
+		switch strings.ToLower(strings.TrimSpace(options.ParseProvenance)) {
+		case ProvenanceComment, ProvenanceSidecar:
+		default:
+			conflict("Unknown '-pprov <str>' value '" + options.ParseProvenance + "'. Use \"" + ProvenanceComment + "\" or \"" + ProvenanceSidecar + "\".")
+		}
+	}
+	if set["tlmem"] && options.TimelineMemoryMB < 1 {
+		conflict("'-tlmem <int>' must be at least 1 MB.")
+	}
+
+	//Other flags which need another one
+	if set["emem-max"] && !set["emem"] {
+		conflict("'-emem-max <int>' limits the XML audits held in memory. Provide the size of the XML audits to keep in memory with '-emem <int>'.")
+	}
+	if set["ala"] && !set["al"] {
+		conflict("'-ala <str>' selects the audits checked against an allowlist. Provide the allowlist files with '-al <files>'.")
+	}
+	if set["praw"] && set["redact"] {
+		conflict("'-praw' adds the original XML of noted rows, which would give away the values '-redact <file>' redacts. Remove '-praw'.")
+	}
+	if set["praw"] && !set["notes"] && !set["tag"] {
+		conflict("'-praw' adds the XML of rows noted by analyst notes or tags. Provide the notes file with '-notes <file>' or the tag file with '-tag <file>'.")
+	}
+	if set["tlsodprev"] && !set["tlsod"] {
+		conflict("'-tlsodprev <str>' compares the SOD timeline to a prior SOD export. Add '-tlsod' to write the timeline in SOD format.")
+	}
+	if set["watch-interval"] && !set["watch"] {
+		conflict("'-watch-interval <int>' is how often '-watch' checks the input directory. Add '-watch' to keep parsing new files.")
+	}
+	if set["retention-dry"] && !set["retention"] {
+		conflict("'-retention-dry' lists the files '-retention <int>' would delete. Provide the number of days with '-retention <int>'.")
+	}
+	if set["dqid"] && !set["dq"] {
+		conflict("'-dqid <str>' names a distributed worker. Provide the shared queue directory with '-dq <dir>'.")
+	}
+	if (set["notify-smtp"] || set["notify-host"]) && !set["notify"] {
+		conflict("'-notify-smtp <str>' and '-notify-host' configure notifications. Provide the webhook URLs or \"mailto:\" addresses to notify with '-notify <str>'.")
+	}
+	if set["notify-host"] && !set["hg"] {
+		conflict("'-notify-host' notifies as each host finishes, which is only known when hosts are parsed together. Add '-hg <int>'.")
+	}
+	if set["prune-cache"] && (set["dq"] || set["wo"] || set["tl"] || set["tlo"] || set["snapshot"] || set["golden"] || set["readme"] || len(modes) > 0) {
+		conflict("'-prune-cache' only removes entries of deleted XML files from the parse cache and exits. Run it on its own with '-i <dir>', and '-r' if needed.")
+	}
+	if set["readonly-input"] {
+		outputDirs := []struct {
+			flag string
+			path string
+		}{
+			{"o", options.OutputPath},
+			{"eo", options.ExtractionOutputDir},
+			{"xso", options.XMLSplitOutputDir},
+			{"ebs", options.EventBufferSplitDir},
+		}
+		for _, dir := range outputDirs {
+			if dir.path != "" && !set["tlo"] && PathWithinInput(options.InputPath, dir.path) {
+				conflict("'-readonly-input' does not write to the input directory, but '-" + dir.flag + "' directory '" + dir.path + "' is inside of it. Use a directory outside of the input.")
+			}
+		}
+	}
+	if set["xlsx"] {
+		if set["tlo"] {
+			conflict("'-tlo' only timelines. Write the workbooks of the parsed CSV files with '-o <csv_dir> -xlsx <str>' on its own.")
+		}
+		if set["dq"] {
+			conflict("'-xlsx <str>' cannot be used with '-dq <dir>' since every worker would write the workbooks. Run '-o <csv_dir> -xlsx <str>' once all workers have finished.")
+		}
+		if set["golden"] {
+			conflict("'-golden <dir>' only compares parsed CSV files. Remove '-xlsx'.")
+		}
+	}
+	if set["obs"] {
+		if set["tlo"] {
+			conflict("'-tlo' only timelines. Export the observables of the parsed CSV files with '-o <csv_dir> -obs <str>' on its own.")
+		}
+		if set["dq"] {
+			conflict("'-obs <str>' cannot be used with '-dq <dir>' since every worker would export the observables. Run '-o <csv_dir> -obs <str>' once all workers have finished.")
+		}
+		if set["golden"] {
+			conflict("'-golden <dir>' only compares parsed CSV files. Remove '-obs'.")
+		}
+	} else if set["obsa"] {
+		conflict("'-obsa <str>' selects the audits observables are exported from. Provide the format with '-obs <str>'.")
+	}
+	if set["dq"] && set["wo"] {
+		conflict("'-wo' cannot be used with '-dq <dir>' since every worker would wipe the shared output directory.")
+	}
+	if set["dq"] && set["snapshot"] && !set["tlo"] {
+		conflict("'-snapshot' cannot be used with '-dq <dir>' since every worker would write its own snapshot.")
+	}
+	return conflicts
+}
@@ -0,0 +1,519 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yeka/zip"
+)
+
+//TestDataOptions controls the synthetic triage packages written by 'goauditparser gen-testdata'
+type TestDataOptions struct {
+	OutputDir string
+	Hosts     int
+	Items     int //Items of every normal audit
+	Events    int //Events of the eventbuffer audit
+	MsgLines  int //Lines of every event log message, to benchmark huge multi-line fields
+	Format    string
+	Password  string
+	Seed      int64
+}
+
+//Start of the synthetic activity, every timestamp falls within the 7 days after it
+var testDataStart = time.Date(2020, 1, 6, 8, 0, 0, 0, time.UTC)
+
+var testDataUsers = []string{"SYSTEM", "NETWORK SERVICE", "LOCAL SERVICE", "jsmith", "adoe", "svc_backup", "administrator"}
+var testDataPrograms = []struct {
+	Path string
+	Name string
+	Args string
+}{
+	{`C:\Windows\System32`, "svchost.exe", "-k netsvcs -p"},
+	{`C:\Windows\System32`, "lsass.exe", ""},
+	{`C:\Windows\System32`, "services.exe", ""},
+	{`C:\Windows\System32`, "cmd.exe", `/c whoami /all`},
+	{`C:\Windows\System32\WindowsPowerShell\v1.0`, "powershell.exe", `-NoProfile -ExecutionPolicy Bypass -File C:\Scripts\inventory.ps1`},
+	{`C:\Windows`, "explorer.exe", ""},
+	{`C:\Program Files\Google\Chrome\Application`, "chrome.exe", `--type=renderer --lang=en-US`},
+	{`C:\Program Files\Microsoft Office\root\Office16`, "OUTLOOK.EXE", ""},
+	{`C:\Users\Public\Downloads`, "update_helper.exe", `-silent -connect 203.0.113.45:443`},
+	{`C:\Windows\System32`, "schtasks.exe", `/create /tn "Updater" /tr C:\Users\Public\Downloads\update_helper.exe /sc onlogon`},
+}
+var testDataDomains = []string{"www.example.com", "login.example.net", "cdn.example.org", "updates.example.com", "files.example.net"}
+var testDataExtensions = []string{"dll", "exe", "txt", "log", "docx", "xlsx", "ps1", "tmp"}
+var testDataServices = []struct {
+	Name        string
+	Description string
+	Path        string
+}{
+	{"Dhcp", "DHCP Client", `C:\Windows\system32\svchost.exe -k LocalServiceNetworkRestricted -p`},
+	{"EventLog", "Windows Event Log", `C:\Windows\System32\svchost.exe -k LocalServiceNetworkRestricted -p`},
+	{"Spooler", "Print Spooler", `C:\Windows\System32\spoolsv.exe`},
+	{"WinDefend", "Microsoft Defender Antivirus Service", `"C:\ProgramData\Microsoft\Windows Defender\platform\4.18.2001.10-0\MsMpEng.exe"`},
+	{"UpdaterSvc", "Updater Service", `C:\Users\Public\Downloads\update_helper.exe -service`},
+}
+var testDataEvents = []struct {
+	Log     string
+	Source  string
+	EID     string
+	Type    string
+	Message string
+}{
+	{"Security", "Microsoft-Windows-Security-Auditing", "4624", "Success Audit", "An account was successfully logged on.\nLogon Type:\t%d\nAccount Name:\t%s"},
+	{"Security", "Microsoft-Windows-Security-Auditing", "4625", "Failure Audit", "An account failed to log on.\nLogon Type:\t%d\nAccount Name:\t%s"},
+	{"Security", "Microsoft-Windows-Security-Auditing", "4688", "Success Audit", "A new process has been created.\nToken Elevation Type:\t%d\nAccount Name:\t%s"},
+	{"System", "Service Control Manager", "7045", "Information", "A service was installed in the system.\nStart Type:\t%d\nService Account:\t%s"},
+	{"System", "Service Control Manager", "7036", "Information", "The service entered the running state.\nState:\t%d\nUser:\t%s"},
+	{"Security", "Microsoft-Windows-Eventlog", "1102", "Information", "The audit log was cleared.\nCount:\t%d\nAccount Name:\t%s"},
+}
+
+//Characters of the 22 character agent IDs
+const testDataIDCharacters = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+var testDataXMLEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+//GoAuditGenTestData_Start writes synthetic triage packages for 'goauditparser gen-testdata'
+func GoAuditGenTestData_Start(args []string) int {
+	flags := flag.NewFlagSet("gen-testdata", flag.ContinueOnError)
+	flags.SetOutput(os.Stdout)
+	flags.Usage = func() {
+		fmt.Println("Usage: goauditparser gen-testdata -o <out_dir> [-hosts <int>] [-items <int>] [-events <int>] [-msglines <int>] [-format mans|zip] [-ep <password>] [-seed <int>]")
+		fmt.Println("   Ex: goauditparser gen-testdata -o testdata -hosts 20 -items 50000")
+	}
+	testOptions := TestDataOptions{}
+	flags.StringVar(&testOptions.OutputDir, "o", "", "")
+	flags.IntVar(&testOptions.Hosts, "hosts", 1, "")
+	flags.IntVar(&testOptions.Items, "items", 1000, "")
+	flags.IntVar(&testOptions.Events, "events", 1000, "")
+	flags.IntVar(&testOptions.MsgLines, "msglines", 0, "")
+	flags.StringVar(&testOptions.Format, "format", "mans", "")
+	flags.StringVar(&testOptions.Password, "ep", "", "")
+	flags.Int64Var(&testOptions.Seed, "seed", 1, "")
+	if err_p := flags.Parse(args); err_p != nil {
+		return FlagConflictExitCode
+	}
+	if testOptions.OutputDir == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return FlagConflictExitCode
+	}
+	testOptions.Format = strings.TrimPrefix(strings.ToLower(testOptions.Format), ".")
+	if testOptions.Format != "mans" && testOptions.Format != "zip" {
+		fmt.Println("[!] ERROR - Unknown archive format '" + testOptions.Format + "'. Use \"mans\" or \"zip\".")
+		return FlagConflictExitCode
+	}
+	if testOptions.Hosts < 1 || testOptions.Items < 0 || testOptions.Events < 0 || testOptions.MsgLines < 0 {
+		fmt.Println("[!] ERROR - '-hosts' must be at least 1, and '-items', '-events', and '-msglines' can't be negative.")
+		return FlagConflictExitCode
+	}
+
+	if err_m := os.MkdirAll(testOptions.OutputDir, 0755); err_m != nil {
+		fmt.Println("[!] ERROR - Could not create output directory '" + testOptions.OutputDir + "'. " + err_m.Error())
+		return 1
+	}
+	r := rand.New(rand.NewSource(testOptions.Seed))
+	start := time.Now()
+	var total int64
+	for i := 0; i < testOptions.Hosts; i++ {
+		hostname := fmt.Sprintf("GAPTEST-WKS%03d", i+1)
+		path, size, err_w := WriteTestDataPackage(testOptions, r, hostname)
+		if err_w != nil {
+			fmt.Println("[!] ERROR - Could not write triage package '" + path + "'. " + err_w.Error())
+			return 1
+		}
+		total += size
+		fmt.Println("[+] Wrote '" + path + "' (" + strconv.FormatInt(size/1024, 10) + " KB).")
+	}
+	fmt.Println("[+] Wrote " + strconv.Itoa(testOptions.Hosts) + " synthetic triage package(s) of " + strconv.FormatInt(total/1024, 10) + " KB in " + time.Since(start).Truncate(time.Millisecond).String() + ".")
+	fmt.Println("[+] Parse them with: goauditparser -i " + testOptions.OutputDir + " -o <csv_dir>")
+	return 0
+}
+
+//testDataManifest is the part of a triage package's manifest.json the extractor reads
+type testDataManifest struct {
+	Audits []testDataManifestAudit `json:"audits"`
+}
+
+type testDataManifestAudit struct {
+	Generator string                   `json:"generator"`
+	Results   []testDataManifestResult `json:"results"`
+}
+
+type testDataManifestResult struct {
+	Payload string `json:"payload"`
+	Type    string `json:"type"`
+}
+
+//testDataMetadata is the metadata.json of a triage package, the extractor reads "_id" and "hostname" line by line
+type testDataMetadata struct {
+	AgentID     string `json:"_id"`
+	Hostname    string `json:"hostname"`
+	Domain      string `json:"domain"`
+	Platform    string `json:"platform"`
+	RequestTime string `json:"req_timestamp"`
+	FinishTime  string `json:"finish_time"`
+}
+
+//WriteTestDataPackage writes one synthetic triage package to "<out_dir>/<hostname>-<agentid>.<format>"
+//Returns its path and size
+func WriteTestDataPackage(testOptions TestDataOptions, r *rand.Rand, hostname string) (string, int64, error) {
+	agentid := testDataID(r, 22, testDataIDCharacters)
+	path := filepath.Join(testOptions.OutputDir, hostname+"-"+agentid+"."+testOptions.Format)
+	file, err_c := os.Create(path)
+	if err_c != nil {
+		return path, 0, err_c
+	}
+	archive := zip.NewWriter(file)
+	create := func(name string) (io.Writer, error) {
+		if testOptions.Password != "" {
+			return archive.Encrypt(name, testOptions.Password, zip.AES256Encryption)
+		}
+		return archive.Create(name)
+	}
+
+	writers := []struct {
+		generator string
+		write     func(w *bufio.Writer, r *rand.Rand, hostname string, count int)
+		count     int
+	}{
+		{"w32processes-memory", writeTestDataProcesses, testOptions.Items},
+		{"w32rawfiles", writeTestDataFiles, testOptions.Items},
+		{"w32eventlogs", func(w *bufio.Writer, r *rand.Rand, hostname string, count int) {
+			writeTestDataEventLogs(w, r, hostname, count, testOptions.MsgLines)
+		}, testOptions.Items},
+		{"w32services", writeTestDataServices, testOptions.Items},
+		{"w32ports", writeTestDataPorts, testOptions.Items},
+		{"eventbuffer", writeTestDataEventBuffer, testOptions.Events},
+	}
+	manifest := testDataManifest{}
+	for _, writer := range writers {
+		payload := testDataID(r, 32, "0123456789abcdef")
+		w, err_e := create(payload)
+		if err_e != nil {
+			file.Close()
+			return path, 0, err_e
+		}
+		buffer := bufio.NewWriter(w)
+		writer.write(buffer, r, hostname, writer.count)
+		if err_f := buffer.Flush(); err_f != nil {
+			file.Close()
+			return path, 0, err_f
+		}
+		manifest.Audits = append(manifest.Audits, testDataManifestAudit{writer.generator, []testDataManifestResult{{payload, "application/xml"}}})
+	}
+
+	requested := testDataStart.Add(7 * 24 * time.Hour)
+	metadata := testDataMetadata{agentid, hostname, "EXAMPLE", "win", requested.Format("2006-01-02T15:04:05.000Z"), requested.Add(time.Duration(10+r.Intn(50)) * time.Minute).Format("2006-01-02T15:04:05.000Z")}
+	for _, entry := range []struct {
+		name  string
+		value interface{}
+	}{{"manifest.json", manifest}, {"metadata.json", metadata}} {
+		b, _ := json.MarshalIndent(entry.value, "", "    ")
+		w, err_e := create(entry.name)
+		if err_e != nil {
+			file.Close()
+			return path, 0, err_e
+		}
+		if _, err_w := w.Write(b); err_w != nil {
+			file.Close()
+			return path, 0, err_w
+		}
+	}
+
+	//script.xml lists the audit modules the agent was asked to run
+	var script strings.Builder
+	script.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<script xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" chaining="implicit">` + "\n<commands>\n")
+	for _, writer := range writers {
+		script.WriteString(`<command xsi:type="ExecuteModuleCommand">` + "\n" + `<module name="` + writer.generator + `" version="1.0.0.0" />` + "\n</command>\n")
+	}
+	script.WriteString("</commands>\n</script>\n")
+	w, err_e := create("script.xml")
+	if err_e != nil {
+		file.Close()
+		return path, 0, err_e
+	}
+	if _, err_w := w.Write([]byte(script.String())); err_w != nil {
+		file.Close()
+		return path, 0, err_w
+	}
+
+	if err_z := archive.Close(); err_z != nil {
+		file.Close()
+		return path, 0, err_z
+	}
+	stat, _ := file.Stat()
+	if err_f := file.Close(); err_f != nil {
+		return path, 0, err_f
+	}
+	return path, stat.Size(), nil
+}
+
+func testDataID(r *rand.Rand, length int, characters string) string {
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = characters[r.Intn(len(characters))]
+	}
+	return string(b)
+}
+
+//Returns a random time within the synthetic week
+func testDataTime(r *rand.Rand) string {
+	return testDataStart.Add(time.Duration(r.Int63n(int64(7 * 24 * time.Hour)))).Format("2006-01-02T15:04:05Z")
+}
+
+func testDataMD5(r *rand.Rand) string {
+	b := make([]byte, md5.Size)
+	r.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func testDataIP(r *rand.Rand, internal bool) string {
+	if internal {
+		return fmt.Sprintf("10.%d.%d.%d", r.Intn(4), r.Intn(256), 1+r.Intn(254))
+	}
+	return fmt.Sprintf("203.0.113.%d", 1+r.Intn(254))
+}
+
+//Writes the XML declaration and item list line every audit starts with
+func writeTestDataHeader(w *bufio.Writer, generator string) {
+	w.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	w.WriteString(`<itemList generator="` + generator + `" generatorVersion="32.30.12">` + "\n")
+}
+
+//Writes one audit item from its fields in order, fields without a value are written as closed elements
+func writeTestDataItem(w *bufio.Writer, r *rand.Rand, itemType string, uid int, fields [][2]string) {
+	w.WriteString(`<` + itemType + ` created="` + testDataTime(r) + `" uid="` + strconv.Itoa(uid) + `">` + "\n")
+	for _, field := range fields {
+		if field[1] == "" {
+			w.WriteString(`<` + field[0] + ` />` + "\n")
+			continue
+		}
+		w.WriteString(`<` + field[0] + `>` + testDataXMLEscaper.Replace(field[1]) + `</` + field[0] + `>` + "\n")
+	}
+	w.WriteString(`</` + itemType + `>` + "\n")
+}
+
+func writeTestDataProcesses(w *bufio.Writer, r *rand.Rand, hostname string, count int) {
+	writeTestDataHeader(w, "w32processes-memory")
+	for i := 0; i < count; i++ {
+		program := testDataPrograms[r.Intn(len(testDataPrograms))]
+		writeTestDataItem(w, r, "ProcessItem", i, [][2]string{
+			{"pid", strconv.Itoa(4 * (1 + r.Intn(5000)))},
+			{"parentpid", strconv.Itoa(4 * (1 + r.Intn(5000)))},
+			{"path", program.Path},
+			{"name", program.Name},
+			{"arguments", strings.TrimSpace(program.Name + " " + program.Args)},
+			{"Username", testDataUsers[r.Intn(len(testDataUsers))]},
+			{"startTime", testDataTime(r)},
+			{"kernelTime", strconv.Itoa(r.Intn(100000))},
+			{"userTime", strconv.Itoa(r.Intn(100000))},
+		})
+	}
+	w.WriteString("</itemList>\n")
+}
+
+func writeTestDataFiles(w *bufio.Writer, r *rand.Rand, hostname string, count int) {
+	writeTestDataHeader(w, "w32rawfiles")
+	for i := 0; i < count; i++ {
+		dir := []string{`C:\Windows\System32`, `C:\Users\jsmith\AppData\Local\Temp`, `C:\Users\Public\Downloads`, `C:\ProgramData\Updater`, `C:\Users\adoe\Documents`}[r.Intn(5)]
+		extension := testDataExtensions[r.Intn(len(testDataExtensions))]
+		name := "file" + strconv.Itoa(i) + "." + extension
+		created := testDataTime(r)
+		writeTestDataItem(w, r, "FileItem", i, [][2]string{
+			{"DevicePath", `\Device\HarddiskVolume2`},
+			{"FullPath", dir + `\` + name},
+			{"Drive", "C:"},
+			{"FilePath", strings.TrimPrefix(dir, `C:\`)},
+			{"FileName", name},
+			{"FileExtension", "." + extension},
+			{"SizeInBytes", strconv.Itoa(r.Intn(10000000))},
+			{"Created", created},
+			{"Modified", testDataTime(r)},
+			{"Accessed", testDataTime(r)},
+			{"Changed", testDataTime(r)},
+			{"FilenameCreated", created},
+			{"FilenameModified", created},
+			{"FilenameAccessed", created},
+			{"FilenameChanged", created},
+			{"Username", testDataUsers[r.Intn(len(testDataUsers))]},
+			{"Md5sum", testDataMD5(r)},
+		})
+	}
+	w.WriteString("</itemList>\n")
+}
+
+//Messages are padded with detail lines to at least msgLines lines
+func writeTestDataEventLogs(w *bufio.Writer, r *rand.Rand, hostname string, count int, msgLines int) {
+	writeTestDataHeader(w, "w32eventlogs")
+	for i := 0; i < count; i++ {
+		event := testDataEvents[r.Intn(len(testDataEvents))]
+		genTime := testDataTime(r)
+		message := fmt.Sprintf(event.Message, 2+r.Intn(9), testDataUsers[r.Intn(len(testDataUsers))])
+		if lines := strings.Count(message, "\n") + 1; lines < msgLines {
+			var padded strings.Builder
+			padded.WriteString(message)
+			for j := lines; j < msgLines; j++ {
+				padded.WriteString("\nDetail " + strconv.Itoa(j) + ":\t" + hostname + ".example.local/record/" + strconv.Itoa(100000+i))
+			}
+			message = padded.String()
+		}
+		writeTestDataItem(w, r, "EventLogItem", i, [][2]string{
+			{"log", event.Log},
+			{"index", strconv.Itoa(100000 + i)},
+			{"EID", event.EID},
+			{"source", event.Source},
+			{"type", event.Type},
+			{"genTime", genTime},
+			{"writeTime", genTime},
+			{"machine", hostname + ".example.local"},
+			{"message", message},
+			{"user", testDataUsers[r.Intn(len(testDataUsers))]},
+		})
+	}
+	w.WriteString("</itemList>\n")
+}
+
+func writeTestDataServices(w *bufio.Writer, r *rand.Rand, hostname string, count int) {
+	writeTestDataHeader(w, "w32services")
+	for i := 0; i < count; i++ {
+		service := testDataServices[r.Intn(len(testDataServices))]
+		name := service.Name
+		if i >= len(testDataServices) {
+			name += strconv.Itoa(i)
+		}
+		writeTestDataItem(w, r, "ServiceItem", i, [][2]string{
+			{"name", name},
+			{"descriptiveName", service.Description},
+			{"mode", []string{"SERVICE_AUTO_START", "SERVICE_DEMAND_START", "SERVICE_DISABLED"}[r.Intn(3)]},
+			{"startedAs", []string{"LocalSystem", `NT AUTHORITY\LocalService`}[r.Intn(2)]},
+			{"path", service.Path},
+			{"pathmd5sum", testDataMD5(r)},
+			{"status", []string{"SERVICE_RUNNING", "SERVICE_STOPPED"}[r.Intn(2)]},
+			{"pid", strconv.Itoa(4 * r.Intn(5000))},
+			{"type", "SERVICE_WIN32_OWN_PROCESS"},
+		})
+	}
+	w.WriteString("</itemList>\n")
+}
+
+func writeTestDataPorts(w *bufio.Writer, r *rand.Rand, hostname string, count int) {
+	writeTestDataHeader(w, "w32ports")
+	for i := 0; i < count; i++ {
+		program := testDataPrograms[r.Intn(len(testDataPrograms))]
+		listening := r.Intn(3) == 0
+		fields := [][2]string{
+			{"pid", strconv.Itoa(4 * (1 + r.Intn(5000)))},
+			{"process", program.Name},
+			{"path", program.Path + `\` + program.Name},
+			{"state", "ESTABLISHED"},
+			{"localIP", testDataIP(r, true)},
+			{"remoteIP", testDataIP(r, false)},
+			{"localPort", strconv.Itoa(49152 + r.Intn(16384))},
+			{"remotePort", []string{"443", "80", "445", "3389"}[r.Intn(4)]},
+			{"protocol", "TCP"},
+		}
+		if listening {
+			fields[3][1], fields[5][1], fields[6][1], fields[7][1] = "LISTEN", "0.0.0.0", []string{"135", "445", "3389", "5985"}[r.Intn(4)], "0"
+		}
+		writeTestDataItem(w, r, "PortItem", i, fields)
+	}
+	w.WriteString("</itemList>\n")
+}
+
+//Writes eventItem elements of the process, DNS lookup, URL monitor, and file write event types
+func writeTestDataEventBuffer(w *bufio.Writer, r *rand.Rand, hostname string, count int) {
+	w.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	w.WriteString(`<itemList generator="eventbuffer" generatorVersion="32.30.12" itemSchemaLocation="http://schemas.mandiant.com/2013/11/stateagentinspectoritem.xsd">` + "\n")
+	for i := 0; i < count; i++ {
+		program := testDataPrograms[r.Intn(len(testDataPrograms))]
+		pid := strconv.Itoa(4 * (1 + r.Intn(5000)))
+		var eventType string
+		var fields [][2]string
+		switch r.Intn(4) {
+		case 0:
+			parent := testDataPrograms[r.Intn(len(testDataPrograms))]
+			eventType = "processEvent"
+			fields = [][2]string{
+				{"timestamp", testDataTime(r)},
+				{"processPath", program.Path + `\` + program.Name},
+				{"process", program.Name},
+				{"processCmdLine", strings.TrimSpace(`"` + program.Path + `\` + program.Name + `" ` + program.Args)},
+				{"md5", testDataMD5(r)},
+				{"parentProcessPath", parent.Path + `\` + parent.Name},
+				{"parentProcess", parent.Name},
+				{"eventType", []string{"start", "end"}[r.Intn(2)]},
+				{"pid", pid},
+				{"parentPid", strconv.Itoa(4 * (1 + r.Intn(5000)))},
+				{"startTime", testDataTime(r)},
+			}
+		case 1:
+			eventType = "dnsLookupEvent"
+			fields = [][2]string{
+				{"timestamp", testDataTime(r)},
+				{"processPath", program.Path + `\` + program.Name},
+				{"process", program.Name},
+				{"hostname", testDataDomains[r.Intn(len(testDataDomains))]},
+				{"pid", pid},
+			}
+		case 2:
+			domain := testDataDomains[r.Intn(len(testDataDomains))]
+			eventType = "urlMonitorEvent"
+			fields = [][2]string{
+				{"timestamp", testDataTime(r)},
+				{"processPath", program.Path + `\` + program.Name},
+				{"process", program.Name},
+				{"hostname", domain},
+				{"requestUrl", "/" + testDataID(r, 8, "abcdefghijklmnopqrstuvwxyz") + "/index.html"},
+				{"remoteIpAddress", testDataIP(r, false)},
+				{"localPort", strconv.Itoa(49152 + r.Intn(16384))},
+				{"remotePort", "443"},
+				{"urlMethod", []string{"GET", "POST"}[r.Intn(2)]},
+				{"userAgent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64)"},
+				{"pid", pid},
+			}
+		default:
+			eventType = "fileWriteEvent"
+			extension := testDataExtensions[r.Intn(len(testDataExtensions))]
+			fields = [][2]string{
+				{"timestamp", testDataTime(r)},
+				{"processPath", program.Path + `\` + program.Name},
+				{"process", program.Name},
+				{"fullPath", `C:\Users\jsmith\AppData\Local\Temp\write` + strconv.Itoa(i) + "." + extension},
+				{"devicePath", `\Device\HarddiskVolume2`},
+				{"md5", testDataMD5(r)},
+				{"pid", pid},
+				{"closed", "true"},
+				{"writes", strconv.Itoa(1 + r.Intn(20))},
+				{"size", strconv.Itoa(r.Intn(1000000))},
+			}
+		}
+		w.WriteString(`<eventItem sequence_num="` + strconv.Itoa(1000000+i) + `" uid="` + strconv.Itoa(i) + `">` + "\n")
+		w.WriteString(`<` + eventType + `>` + "\n")
+		for _, field := range fields {
+			w.WriteString(`<` + field[0] + `>` + testDataXMLEscaper.Replace(field[1]) + `</` + field[0] + `>` + "\n")
+		}
+		w.WriteString(`</` + eventType + `>` + "\n")
+		w.WriteString("</eventItem>\n")
+	}
+	w.WriteString("</itemList>\n")
+}
@@ -0,0 +1,286 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Number of differing rows printed for each file
+const goldenExampleRows = 3
+
+//GoAuditVerify_Start parses the reference audits of a golden directory and compares the CSV output against the stored golden copy
+//"<golden_dir>/input/" holds the reference XML audits and "<golden_dir>/expected/" the CSV files written by a trusted version
+//Returns the exit code, 1 if the output differs
+func GoAuditVerify_Start(options Options) int {
+	inputDir := options.InputPath
+	if inputDir == "" {
+		inputDir = filepath.Join(options.GoldenDir, "input")
+	}
+	expectedDir := filepath.Join(options.GoldenDir, "expected")
+	if _, err_s := os.Stat(inputDir); err_s != nil {
+		options.Log.Println(options.Warnbox + "ERROR - Could not read golden input directory '" + inputDir + "'. " + err_s.Error())
+		return 1
+	}
+
+	//Parse into a scratch directory so nothing of the golden copy is overwritten
+	tempDir, err_t := ioutil.TempDir("", "goauditparser_verify")
+	if err_t != nil {
+		options.Log.Println(options.Warnbox + "ERROR - Could not create temporary output directory. " + err_t.Error())
+		return 1
+	}
+	defer os.RemoveAll(tempDir)
+	options.InputPath = inputDir
+	options.OutputPath = tempDir
+	options.ForceReparse = true
+	options.WipeOutput = false
+	options.Timeline = false
+	GoAuditParser_Start(options)
+	fmt.Println()
+
+	actual := goldenCSVFiles(tempDir)
+	if options.GoldenUpdate {
+		if err_m := MkdirAllOutput(options, expectedDir); err_m != nil {
+			options.Log.Println(options.Warnbox + "ERROR - Could not create golden directory '" + expectedDir + "'. " + err_m.Error())
+			return 1
+		}
+		for _, filename := range goldenCSVFiles(expectedDir) {
+			os.Remove(filepath.Join(expectedDir, filename))
+		}
+		for _, filename := range actual {
+			b, err_r := ioutil.ReadFile(filepath.Join(tempDir, filename))
+			if err_r == nil {
+				err_r = WriteOutputFile(options, filepath.Join(expectedDir, filename), b, 0644)
+			}
+			if err_r != nil {
+				options.Log.Println(options.Warnbox + "ERROR - Could not update golden file '" + filename + "'. " + err_r.Error())
+				return 1
+			}
+		}
+		options.Log.Println(options.Box + "Updated golden copy '" + expectedDir + "' with " + strconv.Itoa(len(actual)) + " CSV file(s).")
+		return 0
+	}
+
+	expected := goldenCSVFiles(expectedDir)
+	if len(expected) == 0 {
+		options.Log.Println(options.Warnbox + "ERROR - No golden CSV files in '" + expectedDir + "'. Use '-gu' to create them with this version.")
+		return 1
+	}
+	inActual := map[string]bool{}
+	for _, filename := range actual {
+		inActual[filename] = true
+	}
+
+	matching, differing, missing := 0, 0, 0
+	for _, filename := range expected {
+		if !inActual[filename] {
+			missing++
+			options.Log.Println(options.Warnbox + "MISSING - '" + filename + "' was not written by this version.")
+			continue
+		}
+		delete(inActual, filename)
+		diffs, err_c := CompareGoldenCSV(filepath.Join(expectedDir, filename), filepath.Join(tempDir, filename), options.GoldenRowOrder)
+		if err_c != nil {
+			differing++
+			options.Log.Println(options.Warnbox + "DIFF - '" + filename + "' could not be compared. " + err_c.Error())
+		} else if len(diffs) > 0 {
+			differing++
+			options.Log.Println(options.Warnbox + "DIFF - '" + filename + "':")
+			for _, diff := range diffs {
+				options.Log.Println(options.Warnbox + "    " + diff)
+			}
+		} else {
+			matching++
+			if options.Verbose > 0 {
+				options.Log.Println(options.Box + "MATCH - '" + filename + "'.")
+			}
+		}
+	}
+	unexpected := []string{}
+	for filename := range inActual {
+		unexpected = append(unexpected, filename)
+	}
+	sort.Strings(unexpected)
+	for _, filename := range unexpected {
+		options.Log.Println(options.Warnbox + "UNEXPECTED - '" + filename + "' is not in the golden copy.")
+	}
+
+	options.Log.Println(options.Box + "Golden Verification:")
+	fmt.Println(options.Box+" - Matching:   ", matching)
+	fmt.Println(options.Box+" - Differing:  ", differing)
+	fmt.Println(options.Box+" - Missing:    ", missing)
+	fmt.Println(options.Box+" - Unexpected: ", len(unexpected))
+	if differing+missing+len(unexpected) > 0 {
+		options.Log.Println(options.Warnbox + "Output differs from the golden copy in '" + expectedDir + "'.")
+		return 1
+	}
+	options.Log.Println(options.Box + "Output matches the golden copy in '" + expectedDir + "'.")
+	return 0
+}
+
+//Names of the CSV files GoAuditParser writes in a directory
+func goldenCSVFiles(dir string) []string {
+	files, _ := ioutil.ReadDir(dir)
+	filenames := []string{}
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".csv") && IsGoAuditParserOutputFile(file.Name()) {
+			filenames = append(filenames, file.Name())
+		}
+	}
+	return filenames
+}
+
+//CompareGoldenCSV returns the differences between a golden CSV file and the same file written by this version
+//Columns are matched by header so their order may change, and rows are compared in order only if ordered is set
+func CompareGoldenCSV(goldenPath string, actualPath string, ordered bool) ([]string, error) {
+	goldenHeaders, goldenRows, err_g := readGoldenCSV(goldenPath)
+	if err_g != nil {
+		return nil, err_g
+	}
+	actualHeaders, actualRows, err_a := readGoldenCSV(actualPath)
+	if err_a != nil {
+		return nil, err_a
+	}
+
+	diffs := []string{}
+	actualIndex := map[string]int{}
+	for i, header := range actualHeaders {
+		actualIndex[header] = i
+	}
+	goldenIndex := map[string]int{}
+	common := []string{}
+	for i, header := range goldenHeaders {
+		goldenIndex[header] = i
+		if _, exists := actualIndex[header]; exists {
+			common = append(common, header)
+		} else {
+			diffs = append(diffs, "Column '"+header+"' is missing.")
+		}
+	}
+	for _, header := range actualHeaders {
+		if _, exists := goldenIndex[header]; !exists {
+			diffs = append(diffs, "Column '"+header+"' is new.")
+		}
+	}
+	if len(goldenRows) != len(actualRows) {
+		diffs = append(diffs, "Row count changed from "+strconv.Itoa(len(goldenRows))+" to "+strconv.Itoa(len(actualRows))+".")
+	}
+
+	//Compare rows by the values of the columns both files have
+	key := func(row []string, index map[string]int) string {
+		values := make([]string, len(common))
+		for i, header := range common {
+			if j := index[header]; j < len(row) {
+				values[i] = row[j]
+			}
+		}
+		return strings.Join(values, "\x00")
+	}
+	describe := func(k string) string {
+		values := strings.Split(k, "\x00")
+		parts := []string{}
+		for i, header := range common {
+			if values[i] != "" {
+				parts = append(parts, header+"="+strconv.Quote(values[i]))
+			}
+		}
+		row := strings.Join(parts, ", ")
+		if len(row) > 200 {
+			row = row[:200] + "..."
+		}
+		return row
+	}
+
+	if ordered {
+		changed := 0
+		for i := 0; i < len(goldenRows) && i < len(actualRows); i++ {
+			g := key(goldenRows[i], goldenIndex)
+			a := key(actualRows[i], actualIndex)
+			if g == a {
+				continue
+			}
+			changed++
+			if changed <= goldenExampleRows {
+				diffs = append(diffs, "Row "+strconv.Itoa(i+2)+" was: "+describe(g))
+				diffs = append(diffs, "Row "+strconv.Itoa(i+2)+" is:  "+describe(a))
+			}
+		}
+		if changed > 0 {
+			diffs = append(diffs, strconv.Itoa(changed)+" row(s) changed.")
+		}
+		return diffs, nil
+	}
+
+	counts := map[string]int{}
+	for _, row := range goldenRows {
+		counts[key(row, goldenIndex)]++
+	}
+	added := []string{}
+	for _, row := range actualRows {
+		k := key(row, actualIndex)
+		if counts[k] > 0 {
+			counts[k]--
+		} else {
+			added = append(added, k)
+		}
+	}
+	removed := []string{}
+	for _, row := range goldenRows {
+		k := key(row, goldenIndex)
+		if counts[k] > 0 {
+			counts[k]--
+			removed = append(removed, k)
+		}
+	}
+	for i, k := range removed {
+		if i == goldenExampleRows {
+			break
+		}
+		diffs = append(diffs, "Only in golden: "+describe(k))
+	}
+	for i, k := range added {
+		if i == goldenExampleRows {
+			break
+		}
+		diffs = append(diffs, "Only in output: "+describe(k))
+	}
+	if len(removed) > 0 || len(added) > 0 {
+		diffs = append(diffs, strconv.Itoa(len(removed))+" row(s) only in golden, "+strconv.Itoa(len(added))+" row(s) only in output.")
+	}
+	return diffs, nil
+}
+
+func readGoldenCSV(path string) ([]string, [][]string, error) {
+	file, err_o := os.Open(path)
+	if err_o != nil {
+		return nil, nil, err_o
+	}
+	defer file.Close()
+	reader, _ := NewDialectCSVReader(file)
+	headers, err_r := reader.Read()
+	if err_r == io.EOF {
+		return []string{}, [][]string{}, nil
+	} else if err_r != nil {
+		return nil, nil, err_r
+	}
+	rows, err_r := reader.ReadAll()
+	if err_r != nil {
+		return nil, nil, err_r
+	}
+	return headers, rows, nil
+}
@@ -0,0 +1,213 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//Brief descriptions of the audit types GoAuditParser writes CSV files for, shown by 'goauditparser help audits'
+var auditTypeDescriptions = map[string]string{
+	"AgentInfo":                  "Details of the agent that collected the audits.",
+	"ArpEntryItem":               "ARP cache entries mapping IP addresses to MAC addresses.",
+	"AuditDebug":                 "Debug messages of the audits, such as registry keys which were not found.",
+	"CollectionMetadata":         "When a triage package was requested and collected, from the archive's metadata.json.",
+	"CookieHistoryItem":          "Browser cookies.",
+	"DiskItem":                   "Physical disks and their partitions.",
+	"DnsEntryItem":               "DNS cache entries.",
+	"DriverItem":                 "Loaded kernel drivers.",
+	"EventItem_DnsLookupEvent":   "Event buffer: DNS lookups.",
+	"EventItem_FileWriteEvent":   "Event buffer: file writes.",
+	"EventItem_Hits":             "Event buffer: indicator hits of the events, one row per hit ('-phits').",
+	"EventItem_ImageLoadEvent":   "Event buffer: DLL and image loads.",
+	"EventItem_Ipv4NetworkEvent": "Event buffer: IPv4 network connections.",
+	"EventItem_ProcessEvent":     "Event buffer: process starts and ends.",
+	"EventItem_RegKeyEvent":      "Event buffer: registry key and value changes.",
+	"EventItem_UrlMonitorEvent":  "Event buffer: HTTP requests.",
+	"EventLogItem":               "Windows event log entries.",
+	"FileDownloadHistoryItem":    "Browser file download history.",
+	"FileItem":                   "File system listing with MFT timestamps and hashes.",
+	"FormHistoryItem":            "Browser form autofill history.",
+	"GroupItem":                  "Local user groups and their members.",
+	"Hits":                       "Indicator hits of every event file of a host in one file sorted by time ('-phits').",
+	"HiveItem":                   "Registry hives.",
+	"HookItem":                   "Hooked functions found in memory.",
+	"LoginHistoryItem":           "User logons (wtmp, btmp, and lastlog).",
+	"ModuleItem":                 "Loaded modules of each process.",
+	"MultiFileAcquisition":       "Files collected by multi-file acquisitions, listed from the archive's manifest.json.",
+	"PersistenceItem":            "Persistence mechanisms such as Run keys, services, and startup files.",
+	"PortItem":                   "Listening ports and network connections.",
+	"PrefetchItem":               "Windows Prefetch files with run counts and last run times.",
+	"ProcessItem":                "Running processes.",
+	"QuarantineEventItem":        "macOS quarantine events of downloaded files.",
+	"QuarantineListItem":         "Files quarantined by the agent.",
+	"RegistryItem":               "Registry keys and values.",
+	"RouteEntryItem":             "Network routing table.",
+	"ScanSummary":                "Results of an agent scan.",
+	"ServiceItem":                "Windows services and Unix daemons.",
+	"ShellHistoryItem":           "Unix shell command history.",
+	"SudoLogItem":                "Unix sudo log entries.",
+	"Syslog":                     "Unix syslog entries.",
+	"SystemInfoItem":             "Operating system, hardware, and network configuration of the host.",
+	"SystemRestoreItem":          "Windows System Restore points.",
+	"TaskItem":                   "Scheduled tasks, cron jobs, and launchd items.",
+	"UrlHistoryItem":             "Browser URL history.",
+	"UserItem":                   "Local user accounts.",
+	"VolumeItem":                 "Mounted volumes.",
+	"issues":                     "Collection failures of the audits, from their issues files ('-pi').",
+}
+
+//AuditTypes returns the sorted names of the audit types GoAuditParser has configurations for
+func AuditTypes() []string {
+	auditTypes := []string{}
+	for auditType := range auditTypeDescriptions {
+		auditTypes = append(auditTypes, auditType)
+	}
+	sort.Strings(auditTypes)
+	return auditTypes
+}
+
+//HelpMenuFlags returns the flags documented in the help menu, so completions can't drift from it
+func HelpMenuFlags() []string {
+	flags := []string{}
+	seen := map[string]bool{}
+	for _, match := range regexp.MustCompile(`(?m)^  (-[a-z0-9-]+)`).FindAllStringSubmatch(GetHelpMenu(), -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			flags = append(flags, match[1])
+		}
+	}
+	return flags
+}
+
+//GoAuditHelp_Start prints the help menu, or the audit types for 'goauditparser help audits [<AuditType>...]'
+func GoAuditHelp_Start(args []string) {
+	if len(args) == 0 || args[0] != "audits" {
+		fmt.Println(GetHelpExamples())
+		fmt.Println(GetHelpMenu())
+		return
+	}
+	if len(args) == 1 {
+		auditTypes := AuditTypes()
+		width := 0
+		for _, auditType := range auditTypes {
+			if len(auditType) > width {
+				width = len(auditType)
+			}
+		}
+		fmt.Println("[+] Supported audit types:")
+		for _, auditType := range auditTypes {
+			fmt.Printf("      %-*s  %s\n", width, auditType, auditTypeDescriptions[auditType])
+		}
+		fmt.Println("[+] Use \"goauditparser help audits <AuditType>\" for the documented fields of an audit type.")
+		return
+	}
+	for _, query := range args[1:] {
+		auditType := ""
+		for _, name := range AuditTypes() {
+			if strings.EqualFold(name, query) {
+				auditType = name
+				break
+			}
+		}
+		if auditType == "" {
+			fmt.Println("[!] Unknown audit type '" + query + "'. Use \"goauditparser help audits\" to list them.")
+			continue
+		}
+		fmt.Println("[+] " + auditType + "\n      " + auditTypeDescriptions[auditType])
+		for _, key := range DescribeAuditFields(auditType) {
+			fmt.Println("      - " + strings.SplitN(key, ".", 2)[1] + ": " + auditFieldDictionary[key])
+		}
+	}
+}
+
+//GoAuditCompletion_Start prints the shell completion script for 'goauditparser completion <bash|zsh|powershell>'
+func GoAuditCompletion_Start(args []string) {
+	shell := ""
+	if len(args) > 0 {
+		shell = strings.ToLower(args[0])
+	}
+	switch shell {
+	case "bash":
+		fmt.Print(GetBashCompletion())
+	case "zsh":
+		fmt.Print("#compdef goauditparser\nautoload -U +X bashcompinit && bashcompinit\n" + GetBashCompletion())
+	case "powershell", "pwsh":
+		fmt.Print(GetPowerShellCompletion())
+	default:
+		fmt.Println("Usage: goauditparser completion <bash|zsh|powershell>")
+		fmt.Println("   Ex: source <(goauditparser completion bash)")
+		fmt.Println("   Ex: goauditparser completion powershell | Out-String | Invoke-Expression")
+	}
+}
+
+//GetBashCompletion returns the bash completion script, which zsh loads through bashcompinit
+func GetBashCompletion() string {
+	return `# goauditparser bash completion
+_goauditparser() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local flags="` + strings.Join(HelpMenuFlags(), " ") + `"
+    local audits="` + strings.Join(AuditTypes(), " ") + `"
+    local subcommand=""
+    [ "$COMP_CWORD" -gt 1 ] && subcommand="${COMP_WORDS[1]}"
+    COMPREPLY=()
+    case "$subcommand" in
+        describe)
+            COMPREPLY=( $(compgen -W "$audits" -- "$cur") )
+            return ;;
+        help)
+            if [ "$COMP_CWORD" -eq 2 ]; then
+                COMPREPLY=( $(compgen -W "audits" -- "$cur") )
+            else
+                COMPREPLY=( $(compgen -W "$audits" -- "$cur") )
+            fi
+            return ;;
+        completion)
+            COMPREPLY=( $(compgen -W "bash zsh powershell" -- "$cur") )
+            return ;;
+    esac
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=( $(compgen -W "$flags" -- "$cur") )
+    elif [ "$COMP_CWORD" -eq 1 ]; then
+        COMPREPLY=( $(compgen -W "describe help completion verify gen-testdata verify-outputs preview rerun submit jobs work serve" -- "$cur") )
+    fi
+}
+complete -o default -F _goauditparser goauditparser
+`
+}
+
+//GetPowerShellCompletion returns the PowerShell argument completer script
+func GetPowerShellCompletion() string {
+	return `# goauditparser PowerShell completion
+Register-ArgumentCompleter -Native -CommandName goauditparser, goauditparser.exe -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $flags = @('` + strings.Join(HelpMenuFlags(), "', '") + `')
+    $audits = @('` + strings.Join(AuditTypes(), "', '") + `')
+    $words = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })
+    $subcommand = if ($words.Count -gt 1 -and $words[1] -ne $wordToComplete) { $words[1] } else { '' }
+    $candidates = switch ($subcommand) {
+        'describe'   { $audits }
+        'help'       { @('audits') + $audits }
+        'completion' { @('bash', 'zsh', 'powershell') }
+        default {
+            if ($wordToComplete.StartsWith('-')) { $flags }
+            elseif ($words.Count -le 2) { @('describe', 'help', 'completion', 'verify', 'gen-testdata', 'verify-outputs', 'preview', 'rerun', 'submit', 'jobs', 'work', 'serve') }
+        }
+    }
+    $candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`
+}
@@ -0,0 +1,58 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+//XMLFileHostname returns the hostname of an XML audit from its filename, the same way the parse threads name their output
+//Files with non-standardized names all return "" since their hostname comes from the input directory
+func XMLFileHostname(options Options, filename string) string {
+	if len(options.ParseAltHostname) > 0 {
+		return NormalizeHostname(options.ParseAltHostname, options)
+	}
+	basefilename := strings.TrimSuffix(filename, ".xml")
+	parts := strings.Split(basefilename, "-")
+	if strings.Contains(basefilename, ".urn_uuid_") || len(parts) < 4 {
+		return ""
+	}
+	return NormalizeHostname(strings.Join(parts[0:len(parts)-3], "-"), options)
+}
+
+//GroupFilesByHost orders the files so the audits of each host are next to each other
+//Hosts keep the order of their first file, and the files of a host keep their order
+func GroupFilesByHost(options Options, files []os.FileInfo) ([]os.FileInfo, []string) {
+	first := map[string]int{}
+	hosts := make([]string, len(files))
+	for i, file := range files {
+		hosts[i] = XMLFileHostname(options, file.Name())
+		if _, exists := first[hosts[i]]; !exists {
+			first[hosts[i]] = i
+		}
+	}
+	order := make([]int, len(files))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return first[hosts[order[a]]] < first[hosts[order[b]]]
+	})
+	grouped := make([]os.FileInfo, len(files))
+	groupedHosts := make([]string, len(files))
+	for i, j := range order {
+		grouped[i] = files[j]
+		groupedHosts[i] = hosts[j]
+	}
+	return grouped, groupedHosts
+}
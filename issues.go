@@ -0,0 +1,252 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//Columns every row of "<hostname>-<agentid>-issues.csv" starts with, followed by the attributes and fields of the issues
+//"AuditType" is the generator of the issues file and "File" the issues file the row came from
+var issuesHeaders = []string{"Tag", "Notes", "Hostname", "AgentID", "AuditType", "File"}
+
+const issuesFileColumn = 5
+
+//Columns of the issues, in the order they are written when present
+var issuesColumnOrder = []string{"number", "level", "summary", "context"}
+
+//Issue is a problem an audit reported while collecting, such as a file or registry key it could not open
+//Fields holds the attributes and the fields of the "<issue>" element by name, nested fields are joined with "."
+type Issue struct {
+	Fields map[string]string
+}
+
+//ReadIssuesFile reads the issues of an "<issuelist>" XML file for '-pi'
+//Returns the generator of the issues file and its issues
+func ReadIssuesFile(options Options, xmlFilePath string) (string, []Issue, error) {
+	file, err_o := options.MemoryPayloads.Open(xmlFilePath)
+	if err_o != nil {
+		return "", nil, err_o
+	}
+	defer file.Close()
+
+	separator := GetMultiValueSeparator(options)
+	generator := ""
+	issues := []Issue{}
+	var issue *Issue
+	path := []string{}
+	var text strings.Builder
+	decoder := xml.NewDecoder(file)
+	decoder.Strict = false
+	for {
+		token, err_t := decoder.Token()
+		if err_t == io.EOF {
+			break
+		}
+		if err_t != nil {
+			return generator, nil, err_t
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name.Local)
+			text.Reset()
+			if len(path) == 1 {
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "generator" {
+						generator = attr.Value
+					}
+				}
+			} else if len(path) == 2 {
+				issue = &Issue{Fields: map[string]string{}}
+				for _, attr := range t.Attr {
+					issue.Fields[attr.Name.Local] = attr.Value
+				}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if issue != nil && len(path) > 2 {
+				name := strings.Join(path[2:], ".")
+				if value := strings.TrimSpace(text.String()); value != "" {
+					if existing, exists := issue.Fields[name]; exists && existing != "" {
+						value = existing + separator + value
+					}
+					issue.Fields[name] = value
+				}
+			}
+			if issue != nil && len(path) == 2 {
+				issues = append(issues, *issue)
+				issue = nil
+			}
+			text.Reset()
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		}
+	}
+	return generator, issues, nil
+}
+
+//Issue rows of one host by issues file, each row a map of column to value
+type issuesHost struct {
+	hostname string
+	agentid  string
+	files    map[string][]map[string]string
+}
+
+//IssuesLog collects the issues of every issues file of a run by host for '-pi'
+type IssuesLog struct {
+	mu    sync.Mutex
+	hosts map[string]*issuesHost
+}
+
+//Add records the issues of a parsed issues file, also when there are none so rows of an earlier parse are replaced
+//A nil log is ignored
+func (log *IssuesLog) Add(options Options, hostname string, agentid string, auditType string, xmlFileName string, issues []Issue) {
+	if log == nil {
+		return
+	}
+	rows := []map[string]string{}
+	for _, issue := range issues {
+		row := map[string]string{"Hostname": hostname, "AgentID": agentid, "AuditType": auditType, "File": xmlFileName}
+		for name, value := range issue.Fields {
+			if options.ReplaceNewLineFeeds {
+				value = strings.Replace(value, "\n", "|", -1)
+			}
+			if _, reserved := row[name]; !reserved {
+				row[name] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if log.hosts == nil {
+		log.hosts = map[string]*issuesHost{}
+	}
+	key := hostname + "-" + agentid
+	if _, exists := log.hosts[key]; !exists {
+		log.hosts[key] = &issuesHost{hostname, agentid, map[string][]map[string]string{}}
+	}
+	log.hosts[key].files[xmlFileName] = rows
+}
+
+//Save writes the issues of each host to "<hostname>-<agentid>-issues.csv" in the output directory
+//Rows of issues files which were not parsed in this run, such as cached ones, are kept from the existing file
+//Returns the number of issue rows written
+func (log *IssuesLog) Save(options Options) (int, error) {
+	if log == nil {
+		return 0, nil
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	written := 0
+	for _, host := range log.hosts {
+		csvDir := AuditOutputDir(options, "issues")
+		csvPath := filepath.Join(csvDir, host.hostname+"-"+host.agentid+"-issues.csv")
+		files := map[string][]map[string]string{}
+		if csvFile, err_o := os.Open(csvPath); err_o == nil {
+			records, _ := csv.NewReader(csvFile).ReadAll()
+			csvFile.Close()
+			for i, record := range records {
+				if i == 0 || len(record) != len(records[0]) || len(record) <= issuesFileColumn {
+					continue
+				}
+				if _, parsed := host.files[record[issuesFileColumn]]; parsed {
+					continue
+				}
+				row := map[string]string{}
+				for j, header := range records[0] {
+					if record[j] != "" {
+						row[header] = record[j]
+					}
+				}
+				files[record[issuesFileColumn]] = append(files[record[issuesFileColumn]], row)
+			}
+		}
+		for name, rows := range host.files {
+			if len(rows) > 0 {
+				files[name] = rows
+			}
+		}
+		if len(files) == 0 {
+			os.Remove(csvPath)
+			continue
+		}
+
+		names := []string{}
+		for name := range files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		headers := issuesCSVHeaders(files)
+		if err_m := MkdirAllOutput(options, csvDir); err_m != nil {
+			return written, err_m
+		}
+		csvFile, err_c := CreateOutputFile(options, csvPath)
+		if err_c != nil {
+			return written, err_c
+		}
+		writer := csv.NewWriter(csvFile)
+		writer.Write(headers)
+		for _, name := range names {
+			for _, row := range files[name] {
+				record := make([]string, len(headers))
+				for i, header := range headers {
+					record[i] = row[header]
+				}
+				writer.Write(record)
+				written++
+			}
+		}
+		writer.Flush()
+		csvFile.Close()
+		if err_w := writer.Error(); err_w != nil {
+			return written, err_w
+		}
+	}
+	return written, nil
+}
+
+//Returns the fixed columns, the usual issue columns found, then the other columns found sorted by name
+func issuesCSVHeaders(files map[string][]map[string]string) []string {
+	found := map[string]bool{}
+	for _, rows := range files {
+		for _, row := range rows {
+			for header := range row {
+				found[header] = true
+			}
+		}
+	}
+	headers := append([]string{}, issuesHeaders...)
+	for _, header := range issuesHeaders {
+		delete(found, header)
+	}
+	for _, header := range issuesColumnOrder {
+		if found[header] {
+			headers = append(headers, header)
+			delete(found, header)
+		}
+	}
+	others := []string{}
+	for header := range found {
+		others = append(others, header)
+	}
+	sort.Strings(others)
+	return append(headers, others...)
+}
@@ -0,0 +1,414 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+//The job queue lets long parses run in the background of a machine, independent of the terminal they were submitted
+//from. Jobs are directories "<jobs_dir>/<id>/" holding "job.json" with the flags and status of the job, and
+//"output.log" with its output. 'goauditparser submit' and 'goauditparser serve' add jobs, and the workers of
+//'goauditparser work' claim queued jobs by atomically creating "<id>/claim" and run each one as a separate process.
+
+//Statuses of a job
+const (
+	JobQueued   = "queued"
+	JobRunning  = "running"
+	JobFinished = "finished"
+	JobFailed   = "failed"
+	JobCanceled = "canceled"
+)
+
+const (
+	jobFileName        = "job.json"
+	jobClaimFileName   = "claim"
+	jobCancelFileName  = "cancel"
+	JobLogFileName     = "output.log"
+	jobHeartbeat       = 10 * time.Second //Running jobs are touched this often by their worker
+	jobStaleAfter      = 60 * time.Second //Running jobs without a heartbeat this long lost their worker and are queued again
+	jobTimestampFormat = "2006-01-02 15:04:05"
+)
+
+//Subcommands which can't be run as a job
+var jobSubcommands = map[string]bool{"serve": true, "work": true, "submit": true, "jobs": true}
+
+//Flags a job may use, the flags of parsing and timelining, and whether each takes a value
+//Flags which load a main config that may run a command, delete files, write files or send data elsewhere than the
+//output, or run without end, such as '-c', '-wo', '-retention', '-notify', and '-watch', can't be used by a job, as
+//anyone with the token of 'goauditparser serve' can submit one
+var jobAllowedFlags = map[string]bool{
+	//Input, output, and threads
+	"i": true, "o": true, "t": true, "tw": true, "hg": true, "y": false, "min": false, "progress": true, "log": true,
+	"manifest": false, "readme": false, "snapshot": false, "readonly-input": false, "r": false,
+	"v": false, "vv": false, "vvv": false, "vvvv": false,
+	//Extracting
+	"eo": true, "xso": true, "ebs": true, "efo": false, "ep": true, "eff": true, "exf": true, "emem": true,
+	"emem-max": true, "evtx": false, "eh": false, "xsb": true, "xsc": true,
+	//Parsing
+	"rn": false, "f": false, "raw": false, "fast": false, "pcf": true, "pah": true, "paa": true, "plb": true,
+	"pfw": true, "pck": true, "pstream": true, "pap": true, "pdesc": false, "pdd": false, "pjson": false,
+	"of": true, "xlsx": true, "obs": true, "obsa": true, "pmeta": false, "pprov": true, "pdq": false, "pcm": false,
+	"pi": false, "pnafail": false, "pek": false, "ekp": true, "ekf": true, "notes": true, "tag": true,
+	"praw": false, "phits": false, "phcap": true, "plink": false, "al": true, "ala": true, "redact": true,
+	"mvs": true, "hs": false, "hl": false, "perm": true, "dirperm": true, "group": true,
+	//Timelining
+	"tl": false, "tld": false, "tlstream": false, "tlmem": true, "tlmmap": false, "tlbucket": true, "tlfmt": true,
+	"tlsod": false, "tlsodprev": true, "tlo": false, "tlout": true, "tlf": true, "tlhost": true, "tlagent": true,
+	"tlaudit": true, "tlverify": true, "tlanom": false,
+}
+
+var regJobID = regexp.MustCompile(`^[0-9]{8}-[0-9]{6}\.[0-9]{3}-[0-9a-f]{4}$`)
+
+var jobIDRandom = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+//Job is "<jobs_dir>/<id>/job.json"
+type Job struct {
+	ID        string   `json:"id"`
+	Args      []string `json:"args"`
+	Status    string   `json:"status"`
+	Submitted string   `json:"submitted"`
+	Started   string   `json:"started,omitempty"`
+	Finished  string   `json:"finished,omitempty"`
+	Heartbeat string   `json:"heartbeat,omitempty"`
+	Worker    string   `json:"worker,omitempty"`
+	PID       int      `json:"pid,omitempty"`
+	Attempts  int      `json:"attempts"`
+	ExitCode  int      `json:"exit_code"`
+	Error     string   `json:"error,omitempty"`
+}
+
+//Redacted returns a copy of the job with archive passwords in its flags redacted, to show it to users
+func (job Job) Redacted() Job {
+	job.Args = redactRunArgs(job.Args)
+	return job
+}
+
+//JobQueue is a job queue directory
+type JobQueue struct {
+	Dir string
+}
+
+//OpenJobQueue creates the job queue directory if needed
+func OpenJobQueue(dir string) (JobQueue, error) {
+	if dir == "" {
+		return JobQueue{}, errors.New("no job queue directory")
+	}
+	if err_m := os.MkdirAll(dir, 0700); err_m != nil {
+		return JobQueue{}, err_m
+	}
+	return JobQueue{Dir: dir}, nil
+}
+
+func (queue JobQueue) jobPath(id string, name string) string {
+	return filepath.Join(queue.Dir, id, name)
+}
+
+//LogPath returns the output log of a job
+func (queue JobQueue) LogPath(id string) string {
+	return queue.jobPath(id, JobLogFileName)
+}
+
+//ValidateJobArgs checks that the flags of a job can be run by a worker, which only runs the flags of jobAllowedFlags
+func ValidateJobArgs(args []string) error {
+	if len(args) == 0 {
+		return errors.New("the job has no flags")
+	}
+	if jobSubcommands[args[0]] {
+		return errors.New("'" + args[0] + "' can't be run as a job")
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return errors.New("'--' is not a flag of a job")
+		}
+		if !strings.HasPrefix(arg, "-") || strings.Trim(arg, "-") == "" {
+			return errors.New("'" + arg + "' is not a flag of a job")
+		}
+		//Flags are "-name", "--name", "-name=value", or "-name value"
+		name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		hasValue := false
+		if j := strings.Index(name, "="); j != -1 {
+			name, hasValue = name[:j], true
+		}
+		takesValue, allowed := jobAllowedFlags[name]
+		if !allowed {
+			return errors.New("'-" + name + "' can't be used by a job")
+		}
+		if takesValue && !hasValue {
+			if i+1 >= len(args) {
+				return errors.New("'-" + name + "' needs a value")
+			}
+			i++
+		}
+	}
+	return nil
+}
+
+//Submit adds a queued job with the flags of a parse, such as ["-i", "<in_dir>", "-o", "<csv_dir>", "-tl"]
+//Relative paths in the flags are resolved against the working directory of the worker
+func (queue JobQueue) Submit(args []string) (Job, error) {
+	if err_v := ValidateJobArgs(args); err_v != nil {
+		return Job{}, err_v
+	}
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		//IDs sort in the order jobs were submitted, which is the order workers run them
+		id := now.Format("20060102-150405.000") + fmt.Sprintf("-%04x", jobIDRandom.Intn(0x10000))
+		//The job directory is only created by its submitter, so IDs are never reused
+		if err_m := os.Mkdir(filepath.Join(queue.Dir, id), 0700); err_m != nil {
+			if os.IsExist(err_m) {
+				continue
+			}
+			return Job{}, err_m
+		}
+		job := Job{ID: id, Args: args, Status: JobQueued, Submitted: now.UTC().Format(jobTimestampFormat), ExitCode: -1}
+		return job, queue.save(job)
+	}
+	return Job{}, errors.New("could not create a unique job ID")
+}
+
+//Get reads a job
+func (queue JobQueue) Get(id string) (Job, error) {
+	if !regJobID.MatchString(id) {
+		return Job{}, errors.New("invalid job ID '" + id + "'")
+	}
+	b, err_r := ioutil.ReadFile(queue.jobPath(id, jobFileName))
+	if err_r != nil {
+		if os.IsNotExist(err_r) {
+			return Job{}, errors.New("job '" + id + "' does not exist")
+		}
+		return Job{}, err_r
+	}
+	var job Job
+	if err_j := json.Unmarshal(b, &job); err_j != nil {
+		return Job{}, errors.New("could not parse '" + queue.jobPath(id, jobFileName) + "'. " + err_j.Error())
+	}
+	return job, nil
+}
+
+//List reads every job, oldest first
+func (queue JobQueue) List() ([]Job, error) {
+	entries, err_r := ioutil.ReadDir(queue.Dir)
+	if err_r != nil {
+		return nil, err_r
+	}
+	jobs := []Job{}
+	for _, entry := range entries {
+		if !entry.IsDir() || !regJobID.MatchString(entry.Name()) {
+			continue
+		}
+		//Jobs being submitted have no "job.json" yet
+		if job, err_g := queue.Get(entry.Name()); err_g == nil {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.SliceStable(jobs, func(a, b int) bool { return jobs[a].ID < jobs[b].ID })
+	return jobs, nil
+}
+
+//save writes "job.json" through a temp file, so readers never see a partly written job
+func (queue JobQueue) save(job Job) error {
+	b, err_m := json.MarshalIndent(job, "", "  ")
+	if err_m != nil {
+		return err_m
+	}
+	path := queue.jobPath(job.ID, jobFileName)
+	tempPath := path + "." + NewRunID() + TempFileSuffix
+	if err_w := ioutil.WriteFile(tempPath, b, 0600); err_w != nil {
+		return err_w
+	}
+	if err_n := os.Rename(tempPath, path); err_n != nil {
+		os.Remove(tempPath)
+		return err_n
+	}
+	return nil
+}
+
+//Cancel cancels a job. Queued jobs are canceled at once, running jobs are stopped by their worker within a few seconds
+func (queue JobQueue) Cancel(id string) (Job, error) {
+	job, err_g := queue.Get(id)
+	if err_g != nil {
+		return job, err_g
+	}
+	switch job.Status {
+	case JobFinished, JobFailed, JobCanceled:
+		return job, errors.New("job '" + id + "' already " + job.Status)
+	}
+	if err_w := ioutil.WriteFile(queue.jobPath(id, jobCancelFileName), []byte(time.Now().UTC().Format(jobTimestampFormat)+"\n"), 0600); err_w != nil {
+		return job, err_w
+	}
+	//A queued job is canceled by whoever claims it first, the canceler or a worker
+	if job.Status == JobQueued && queue.claim(id, "cancel") {
+		job.Status = JobCanceled
+		job.Finished = time.Now().UTC().Format(jobTimestampFormat)
+		return job, queue.save(job)
+	}
+	return queue.Get(id)
+}
+
+//canceled returns true if the job was asked to be canceled
+func (queue JobQueue) canceled(id string) bool {
+	_, err_s := os.Stat(queue.jobPath(id, jobCancelFileName))
+	return err_s == nil
+}
+
+//claim atomically claims a queued job, returning false if it was already claimed
+func (queue JobQueue) claim(id string, worker string) bool {
+	f, err_c := os.OpenFile(queue.jobPath(id, jobClaimFileName), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err_c != nil {
+		return false
+	}
+	f.WriteString(worker + "\t" + time.Now().UTC().Format(jobTimestampFormat) + "\n")
+	f.Close()
+	return true
+}
+
+//requeueStale queues running jobs again whose worker stopped sending heartbeats, such as after a reboot
+func (queue JobQueue) requeueStale(job Job) (Job, bool) {
+	if job.Status != JobRunning {
+		return job, false
+	}
+	heartbeat, err_t := time.Parse(jobTimestampFormat, job.Heartbeat)
+	if err_t == nil && time.Since(heartbeat) < jobStaleAfter {
+		return job, false
+	}
+	job.Status = JobQueued
+	job.Worker = ""
+	job.PID = 0
+	job.Heartbeat = ""
+	job.Error = "worker stopped responding, queued again"
+	if queue.save(job) != nil || os.Remove(queue.jobPath(job.ID, jobClaimFileName)) != nil {
+		return job, false
+	}
+	return job, true
+}
+
+//PrintJob prints a job as a "<id>  <status>  <submitted>  <flags>" line
+func PrintJob(job Job) {
+	job = job.Redacted()
+	status := job.Status
+	if job.Status == JobFailed {
+		status += fmt.Sprintf(" (%d)", job.ExitCode)
+	}
+	fmt.Printf("%s  %-13s  %s  %s\n", job.ID, status, job.Submitted, strings.Join(job.Args, " "))
+}
+
+//GoAuditSubmit_Start adds a job with the flags after "-jobs <dir>" to the job queue, for 'goauditparser work' to run
+func GoAuditSubmit_Start(args []string) int {
+	flags := flag.NewFlagSet("submit", flag.ContinueOnError)
+	flags.SetOutput(os.Stdout)
+	flags.Usage = func() {
+		fmt.Println("Usage: goauditparser submit -jobs <jobs_dir> <parse flags>")
+		fmt.Println("   Ex: goauditparser submit -jobs /cases/jobs -i /cases/triage -o /cases/parsed -tl")
+	}
+	jobsDir := ""
+	flags.StringVar(&jobsDir, "jobs", "", "")
+	//The parse flags of the job are not flags of 'submit', so stop at the first of them
+	if len(args) < 2 || (args[0] != "-jobs" && args[0] != "--jobs") {
+		flags.Usage()
+		return FlagConflictExitCode
+	}
+	if err_p := flags.Parse(args[:2]); err_p != nil {
+		return FlagConflictExitCode
+	}
+	queue, err_o := OpenJobQueue(jobsDir)
+	if err_o != nil {
+		fmt.Println("[!] ERROR - Could not open job queue '" + jobsDir + "'. " + err_o.Error())
+		return 1
+	}
+	job, err_s := queue.Submit(args[2:])
+	if err_s != nil {
+		fmt.Println("[!] ERROR - Could not submit the job. " + err_s.Error())
+		return FlagConflictExitCode
+	}
+	fmt.Println("[+] Submitted job '" + job.ID + "'. Check it with 'goauditparser jobs -jobs " + jobsDir + " " + job.ID + "'.")
+	return 0
+}
+
+//GoAuditJobs_Start lists the jobs of the job queue, or shows, prints the log of, or cancels one job
+func GoAuditJobs_Start(args []string) int {
+	flags := flag.NewFlagSet("jobs", flag.ContinueOnError)
+	flags.SetOutput(os.Stdout)
+	flags.Usage = func() {
+		fmt.Println("Usage: goauditparser jobs -jobs <jobs_dir> [-log | -cancel] [<id>]")
+		fmt.Println("   Ex: goauditparser jobs -jobs /cases/jobs -log 20201001-120000.000-1a2b")
+	}
+	jobsDir := ""
+	showLog := false
+	cancel := false
+	flags.StringVar(&jobsDir, "jobs", "", "")
+	flags.BoolVar(&showLog, "log", false, "")
+	flags.BoolVar(&cancel, "cancel", false, "")
+	if err_p := flags.Parse(args); err_p != nil {
+		return FlagConflictExitCode
+	}
+	if jobsDir == "" || flags.NArg() > 1 || ((showLog || cancel) && flags.NArg() == 0) || (showLog && cancel) {
+		flags.Usage()
+		return FlagConflictExitCode
+	}
+	queue, err_o := OpenJobQueue(jobsDir)
+	if err_o != nil {
+		fmt.Println("[!] ERROR - Could not open job queue '" + jobsDir + "'. " + err_o.Error())
+		return 1
+	}
+
+	if flags.NArg() == 0 {
+		jobs, err_l := queue.List()
+		if err_l != nil {
+			fmt.Println("[!] ERROR - Could not read job queue '" + jobsDir + "'. " + err_l.Error())
+			return 1
+		}
+		if len(jobs) == 0 {
+			fmt.Println("[+] No jobs in '" + jobsDir + "'.")
+		}
+		for _, job := range jobs {
+			PrintJob(job)
+		}
+		return 0
+	}
+
+	id := flags.Arg(0)
+	var job Job
+	var err_j error
+	if cancel {
+		job, err_j = queue.Cancel(id)
+	} else {
+		job, err_j = queue.Get(id)
+	}
+	if err_j != nil {
+		fmt.Println("[!] ERROR - " + err_j.Error() + ".")
+		return 1
+	}
+	if showLog {
+		b, err_r := ioutil.ReadFile(queue.LogPath(id))
+		if err_r != nil && !os.IsNotExist(err_r) {
+			fmt.Println("[!] ERROR - Could not read the log of job '" + id + "'. " + err_r.Error())
+			return 1
+		}
+		os.Stdout.Write(b)
+		return 0
+	}
+	b, _ := json.MarshalIndent(job.Redacted(), "", "  ")
+	fmt.Println(string(b))
+	return 0
+}
@@ -0,0 +1,79 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestValidateJobArgs(t *testing.T) {
+	tests := []struct {
+		args  []string
+		valid bool
+	}{
+		{[]string{"-i", "/cases/triage", "-o", "/cases/parsed", "-tl", "-y"}, true},
+		{[]string{"-i=/cases/triage", "--o", "/cases/parsed", "-t=4", "-pcm"}, true},
+		{[]string{"-i", "in", "-tlout", "timeline.csv", "-tlf", "ProcessItem"}, true},
+		{[]string{}, false},
+		{[]string{"serve", "-jobs", "/cases/jobs"}, false},
+		{[]string{"-i", "in", "-c", "config.json"}, false},
+		{[]string{"-i", "in", "-c=config.json"}, false},
+		{[]string{"-i", "in", "-tlcf", "timeline.json"}, false},
+		{[]string{"-i", "in", "-o", "/", "-wo", "-y"}, false},
+		{[]string{"-i", "in", "-retention", "30"}, false},
+		{[]string{"-i", "in", "-prune-cache"}, false},
+		{[]string{"-i", "in", "-notify", "http://127.0.0.1/hook"}, false},
+		{[]string{"-i", "in", "-logfile", "/etc/cron.d/gap"}, false},
+		{[]string{"-i", "in", "-ep-file", "/root/.ssh/id_rsa"}, false},
+		{[]string{"-i", "in", "-gu"}, false},
+		{[]string{"-i", "in", "-watch"}, false},
+		{[]string{"-i", "in", "--", "-c", "config.json"}, false},
+		{[]string{"-i", "in", "extra"}, false},
+		{[]string{"-i", "in", "-"}, false},
+		{[]string{"-i"}, false},
+		{[]string{"-i", "in", "-unknown"}, false},
+	}
+	for _, test := range tests {
+		err_v := ValidateJobArgs(test.args)
+		if test.valid && err_v != nil {
+			t.Errorf("ValidateJobArgs(%q) = %v, want no error", test.args, err_v)
+		} else if !test.valid && err_v == nil {
+			t.Errorf("ValidateJobArgs(%q) = nil, want an error", test.args)
+		}
+	}
+}
+
+func TestSubmitRefusesForbiddenFlags(t *testing.T) {
+	queue, err_o := OpenJobQueue(t.TempDir())
+	if err_o != nil {
+		t.Fatal(err_o)
+	}
+	if _, err_s := queue.Submit([]string{"-i", "in", "-c", "config.json"}); err_s == nil {
+		t.Fatal("Submit queued a job with '-c'")
+	}
+	if _, err_s := queue.Submit([]string{"-i", "in", "-o", "out", "-tl"}); err_s != nil {
+		t.Fatal(err_s)
+	}
+	entries, err_r := ioutil.ReadDir(queue.Dir)
+	if err_r != nil {
+		t.Fatal(err_r)
+	}
+	jobs := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			jobs++
+		}
+	}
+	if jobs != 1 {
+		t.Errorf("job queue has %d jobs, want 1", jobs)
+	}
+}
@@ -0,0 +1,243 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//Token of 'goauditparser serve' generated in the job queue directory when none is given
+const jobServerTokenFileName = "serve.token"
+
+//jobServer is the HTTP API of 'goauditparser serve' over a job queue
+//   GET    /jobs               list jobs
+//   POST   /jobs               submit a job, {"args": ["-i", "<in_dir>", "-o", "<csv_dir>"]}
+//   GET    /jobs/<id>          show a job
+//   DELETE /jobs/<id>          cancel a job, same as POST /jobs/<id>/cancel
+//   GET    /jobs/<id>/log      output of a job
+type jobServer struct {
+	queue JobQueue
+	token string
+}
+
+type jobSubmitRequest struct {
+	Args []string `json:"args"`
+}
+
+func (server *jobServer) reply(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	b, _ := json.MarshalIndent(v, "", "  ")
+	w.Write(append(b, '\n'))
+}
+
+func (server *jobServer) replyError(w http.ResponseWriter, status int, message string) {
+	server.reply(w, status, map[string]string{"error": message})
+}
+
+func (server *jobServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	//Browsers send an Origin with requests web pages make, which must not be able to submit jobs
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err_u := url.Parse(origin); err_u != nil || !strings.EqualFold(u.Host, r.Host) {
+			server.replyError(w, http.StatusForbidden, "cross-origin requests are not allowed")
+			return
+		}
+	}
+	auth := r.Header.Get("Authorization")
+	if server.token == "" || subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+server.token)) != 1 {
+		server.replyError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+		return
+	}
+	//Forms and "text/plain" bodies can be sent without a preflight, so only JSON is read
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		if mediaType, _, err_m := mime.ParseMediaType(r.Header.Get("Content-Type")); r.ContentLength != 0 && (err_m != nil || mediaType != "application/json") {
+			server.replyError(w, http.StatusUnsupportedMediaType, "expected a Content-Type of 'application/json'")
+			return
+		}
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "jobs" || len(parts) > 3 {
+		server.replyError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			jobs, err_l := server.queue.List()
+			if err_l != nil {
+				server.replyError(w, http.StatusInternalServerError, err_l.Error())
+				return
+			}
+			for i := range jobs {
+				jobs[i] = jobs[i].Redacted()
+			}
+			server.reply(w, http.StatusOK, jobs)
+		case http.MethodPost:
+			var req jobSubmitRequest
+			if err_j := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err_j != nil {
+				server.replyError(w, http.StatusBadRequest, "could not parse the request. "+err_j.Error())
+				return
+			}
+			if err_v := ValidateJobArgs(req.Args); err_v != nil {
+				server.replyError(w, http.StatusBadRequest, err_v.Error())
+				return
+			}
+			job, err_s := server.queue.Submit(req.Args)
+			if err_s != nil {
+				server.replyError(w, http.StatusInternalServerError, err_s.Error())
+				return
+			}
+			fmt.Println(time.Now().Format(jobTimestampFormat) + " [+] Submitted job '" + job.ID + "' from " + r.RemoteAddr + ".")
+			server.reply(w, http.StatusCreated, job.Redacted())
+		default:
+			server.replyError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+
+	id := parts[1]
+	if !regJobID.MatchString(id) {
+		server.replyError(w, http.StatusNotFound, "invalid job ID '"+id+"'")
+		return
+	}
+	job, err_g := server.queue.Get(id)
+	if err_g != nil {
+		server.replyError(w, http.StatusNotFound, err_g.Error())
+		return
+	}
+	action := ""
+	if len(parts) == 3 {
+		action = parts[2]
+	}
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		server.reply(w, http.StatusOK, job.Redacted())
+	case (action == "" && r.Method == http.MethodDelete) || (action == "cancel" && r.Method == http.MethodPost):
+		job, err_c := server.queue.Cancel(id)
+		if err_c != nil {
+			server.replyError(w, http.StatusConflict, err_c.Error())
+			return
+		}
+		fmt.Println(time.Now().Format(jobTimestampFormat) + " [+] Canceled job '" + id + "' from " + r.RemoteAddr + ".")
+		server.reply(w, http.StatusOK, job.Redacted())
+	case action == "log" && r.Method == http.MethodGet:
+		b, err_r := ioutil.ReadFile(server.queue.LogPath(id))
+		if err_r != nil && !os.IsNotExist(err_r) {
+			server.replyError(w, http.StatusInternalServerError, err_r.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(b)
+	case action == "" || action == "cancel" || action == "log":
+		server.replyError(w, http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		server.replyError(w, http.StatusNotFound, "not found")
+	}
+}
+
+//GoAuditServe_Start serves the HTTP API of a job queue, so jobs can be submitted, checked, and canceled remotely
+func GoAuditServe_Start(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.SetOutput(os.Stdout)
+	flags.Usage = func() {
+		fmt.Println("Usage: goauditparser serve -jobs <jobs_dir> [-listen <host:port>] [-token <token>] [-d]")
+		fmt.Println("   Ex: goauditparser serve -jobs /cases/jobs -listen 127.0.0.1:8640 -d")
+	}
+	jobsDir := ""
+	listen := ""
+	token := ""
+	detach := false
+	flags.StringVar(&jobsDir, "jobs", "", "")
+	flags.StringVar(&listen, "listen", "127.0.0.1:8640", "")
+	flags.StringVar(&token, "token", "", "")
+	flags.BoolVar(&detach, "d", false, "")
+	if err_p := flags.Parse(args); err_p != nil {
+		return FlagConflictExitCode
+	}
+	if jobsDir == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return FlagConflictExitCode
+	}
+	//The token can also come from the environment, so it is not shown in process listings
+	if token == "" {
+		token = os.Getenv("GAP_TOKEN")
+	}
+	queue, err_o := OpenJobQueue(jobsDir)
+	if err_o != nil {
+		fmt.Println("[!] ERROR - Could not open job queue '" + jobsDir + "'. " + err_o.Error())
+		return 1
+	}
+	if _, _, err_h := net.SplitHostPort(listen); err_h != nil {
+		fmt.Println("[!] ERROR - Invalid listen address '" + listen + "'. " + err_h.Error())
+		return FlagConflictExitCode
+	}
+	//Every request needs the token, even on localhost, since any local process or web page can reach it
+	if token == "" {
+		tokenPath := filepath.Join(jobsDir, jobServerTokenFileName)
+		var err_t error
+		if token, err_t = jobServerToken(tokenPath); err_t != nil {
+			fmt.Println("[!] ERROR - Could not read or create the token '" + tokenPath + "'. " + err_t.Error())
+			return 1
+		}
+		fmt.Println("[+] Requests need 'Authorization: Bearer <token>' with the token in '" + tokenPath + "'.")
+	}
+	if detach {
+		return DetachSubcommand("serve", args, jobsDir)
+	}
+
+	listener, err_l := net.Listen("tcp", listen)
+	if err_l != nil {
+		fmt.Println("[!] ERROR - Could not listen on '" + listen + "'. " + err_l.Error())
+		return 1
+	}
+	fmt.Println(time.Now().Format(jobTimestampFormat) + " [+] Serving job queue '" + jobsDir + "' on http://" + listener.Addr().String() + "/jobs.")
+	httpServer := &http.Server{Handler: &jobServer{queue: queue, token: token}, ReadHeaderTimeout: 10 * time.Second}
+	if err_s := httpServer.Serve(listener); err_s != nil {
+		fmt.Println("[!] ERROR - " + err_s.Error())
+		return 1
+	}
+	return 0
+}
+
+//jobServerToken reads the token of 'goauditparser serve' from path, or generates one there readable only by this user
+func jobServerToken(path string) (string, error) {
+	if b, err_r := ioutil.ReadFile(path); err_r == nil {
+		if token := strings.TrimSpace(string(b)); token != "" {
+			return token, nil
+		}
+	} else if !os.IsNotExist(err_r) {
+		return "", err_r
+	}
+	random := make([]byte, 32)
+	if _, err_g := rand.Read(random); err_g != nil {
+		return "", err_g
+	}
+	token := hex.EncodeToString(random)
+	if err_w := ioutil.WriteFile(path, []byte(token+"\n"), 0600); err_w != nil {
+		return "", err_w
+	}
+	return token, os.Chmod(path, 0600)
+}
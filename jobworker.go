@@ -0,0 +1,280 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//How often workers look for queued jobs and running jobs look for cancellation
+const jobPollInterval = 2 * time.Second
+
+//DetachSubcommand starts the subcommand again in the background, without '-d', with its output appended to
+//"<jobs_dir>/<name>.log". The background process is not stopped when the terminal or SSH session closes
+func DetachSubcommand(name string, args []string, jobsDir string) int {
+	exe, err_e := os.Executable()
+	if err_e != nil {
+		fmt.Println("[!] ERROR - Could not find the GoAuditParser executable. " + err_e.Error())
+		return 1
+	}
+	childArgs := []string{name}
+	for _, arg := range args {
+		if arg != "-d" && arg != "--d" {
+			childArgs = append(childArgs, arg)
+		}
+	}
+	logPath := filepath.Join(jobsDir, name+".log")
+	logFile, err_o := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err_o != nil {
+		fmt.Println("[!] ERROR - Could not open log '" + logPath + "'. " + err_o.Error())
+		return 1
+	}
+	defer logFile.Close()
+	cmd := exec.Command(exe, childArgs...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	detachProcess(cmd)
+	if err_s := cmd.Start(); err_s != nil {
+		fmt.Println("[!] ERROR - Could not start '" + name + "' in the background. " + err_s.Error())
+		return 1
+	}
+	fmt.Println("[+] Started '" + name + "' in the background with PID " + strconv.Itoa(cmd.Process.Pid) + ", logging to '" + logPath + "'.")
+	cmd.Process.Release()
+	return 0
+}
+
+//jobWorker runs the jobs of a job queue, at most 'slots' at a time
+type jobWorker struct {
+	queue    JobQueue
+	id       string
+	exe      string
+	slots    int
+	mu       sync.Mutex
+	running  map[string]*exec.Cmd
+	stopping bool
+	wg       sync.WaitGroup
+}
+
+func (worker *jobWorker) log(line string) {
+	fmt.Println(time.Now().Format(jobTimestampFormat) + " " + line)
+}
+
+//poll queues stale jobs again and starts queued jobs while slots are free
+func (worker *jobWorker) poll() {
+	jobs, err_l := worker.queue.List()
+	if err_l != nil {
+		worker.log("[!] ERROR - Could not read job queue '" + worker.queue.Dir + "'. " + err_l.Error())
+		return
+	}
+	for _, job := range jobs {
+		if requeued, ok := worker.queue.requeueStale(job); ok {
+			worker.log("[!] WARNING - Job '" + job.ID + "' of worker '" + job.Worker + "' stopped responding and was queued again.")
+			job = requeued
+		}
+		if job.Status != JobQueued {
+			continue
+		}
+		worker.mu.Lock()
+		full := worker.stopping || len(worker.running) >= worker.slots
+		worker.mu.Unlock()
+		if full {
+			return
+		}
+		if !worker.queue.claim(job.ID, worker.id) {
+			continue
+		}
+		worker.start(job)
+	}
+}
+
+//start runs a claimed job in a separate process with its output appended to "<id>/output.log"
+func (worker *jobWorker) start(job Job) {
+	now := time.Now().UTC().Format(jobTimestampFormat)
+	job.Status = JobRunning
+	job.Started = now
+	job.Heartbeat = now
+	job.Finished = ""
+	job.Worker = worker.id
+	job.Attempts++
+	job.Error = ""
+	if worker.queue.canceled(job.ID) {
+		worker.finish(job, JobCanceled, -1, "")
+		return
+	}
+
+	logFile, err_o := os.OpenFile(worker.queue.LogPath(job.ID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err_o != nil {
+		worker.finish(job, JobFailed, -1, "could not open the log. "+err_o.Error())
+		return
+	}
+	fmt.Fprintf(logFile, "[+] Job '%s' attempt %d started by worker '%s' at %s UTC: goauditparser %s\n", job.ID, job.Attempts, worker.id, now, strings.Join(job.Redacted().Args, " "))
+	cmd := exec.Command(worker.exe, job.Args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err_s := cmd.Start(); err_s != nil {
+		logFile.Close()
+		worker.finish(job, JobFailed, -1, "could not start the job. "+err_s.Error())
+		return
+	}
+	job.PID = cmd.Process.Pid
+	worker.queue.save(job)
+	worker.log("[+] Started job '" + job.ID + "' with PID " + strconv.Itoa(job.PID) + ".")
+
+	worker.mu.Lock()
+	worker.running[job.ID] = cmd
+	worker.mu.Unlock()
+	worker.wg.Add(1)
+	go func() {
+		defer worker.wg.Done()
+		defer logFile.Close()
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		ticker := time.NewTicker(jobPollInterval)
+		defer ticker.Stop()
+		lastHeartbeat := time.Now()
+		canceled := false
+		for {
+			select {
+			case err_w := <-done:
+				worker.mu.Lock()
+				delete(worker.running, job.ID)
+				stopping := worker.stopping
+				worker.mu.Unlock()
+				exitCode := cmd.ProcessState.ExitCode()
+				switch {
+				case canceled:
+					fmt.Fprintf(logFile, "[!] Job '%s' was canceled.\n", job.ID)
+					worker.finish(job, JobCanceled, exitCode, "")
+				case stopping:
+					//Stopped with the worker, another worker or the restarted worker runs it again
+					fmt.Fprintf(logFile, "[!] Job '%s' was stopped with worker '%s' and queued again.\n", job.ID, worker.id)
+					job.Status = JobQueued
+					job.Worker = ""
+					job.PID = 0
+					job.Heartbeat = ""
+					job.Error = "stopped with its worker, queued again"
+					worker.queue.save(job)
+					os.Remove(worker.queue.jobPath(job.ID, jobClaimFileName))
+					worker.log("[!] Job '" + job.ID + "' was stopped and queued again.")
+				case err_w != nil && exitCode != 0:
+					worker.finish(job, JobFailed, exitCode, "exited with code "+strconv.Itoa(exitCode))
+				default:
+					worker.finish(job, JobFinished, exitCode, "")
+				}
+				return
+			case <-ticker.C:
+				if !canceled && worker.queue.canceled(job.ID) {
+					canceled = true
+					cmd.Process.Kill()
+				}
+				if time.Since(lastHeartbeat) >= jobHeartbeat {
+					lastHeartbeat = time.Now()
+					job.Heartbeat = lastHeartbeat.UTC().Format(jobTimestampFormat)
+					worker.queue.save(job)
+				}
+			}
+		}
+	}()
+}
+
+//finish records the final status of a job
+func (worker *jobWorker) finish(job Job, status string, exitCode int, message string) {
+	job.Status = status
+	job.ExitCode = exitCode
+	job.Error = message
+	job.Finished = time.Now().UTC().Format(jobTimestampFormat)
+	if err_s := worker.queue.save(job); err_s != nil {
+		worker.log("[!] ERROR - Could not record the status of job '" + job.ID + "'. " + err_s.Error())
+	}
+	if message != "" {
+		worker.log("[!] Job '" + job.ID + "' " + status + ", " + message + ".")
+	} else {
+		worker.log("[+] Job '" + job.ID + "' " + status + ".")
+	}
+}
+
+//GoAuditWork_Start runs the jobs of a job queue until it is stopped. Running jobs are stopped with the worker and
+//queued again, and jobs of workers which stopped responding are queued again after a minute
+func GoAuditWork_Start(args []string) int {
+	flags := flag.NewFlagSet("work", flag.ContinueOnError)
+	flags.SetOutput(os.Stdout)
+	flags.Usage = func() {
+		fmt.Println("Usage: goauditparser work -jobs <jobs_dir> [-n <int>] [-d]")
+		fmt.Println("   Ex: goauditparser work -jobs /cases/jobs -n 2 -d")
+	}
+	jobsDir := ""
+	slots := 1
+	detach := false
+	flags.StringVar(&jobsDir, "jobs", "", "")
+	flags.IntVar(&slots, "n", 1, "")
+	flags.BoolVar(&detach, "d", false, "")
+	if err_p := flags.Parse(args); err_p != nil {
+		return FlagConflictExitCode
+	}
+	if jobsDir == "" || flags.NArg() > 0 || slots < 1 {
+		flags.Usage()
+		return FlagConflictExitCode
+	}
+	queue, err_o := OpenJobQueue(jobsDir)
+	if err_o != nil {
+		fmt.Println("[!] ERROR - Could not open job queue '" + jobsDir + "'. " + err_o.Error())
+		return 1
+	}
+	if detach {
+		return DetachSubcommand("work", args, jobsDir)
+	}
+	exe, err_e := os.Executable()
+	if err_e != nil {
+		fmt.Println("[!] ERROR - Could not find the GoAuditParser executable. " + err_e.Error())
+		return 1
+	}
+	hostname, _ := os.Hostname()
+	worker := &jobWorker{
+		queue:   queue,
+		id:      hostname + "_" + strconv.Itoa(os.Getpid()),
+		exe:     exe,
+		slots:   slots,
+		running: map[string]*exec.Cmd{},
+	}
+	worker.log("[+] Worker '" + worker.id + "' is running up to " + strconv.Itoa(slots) + " job(s) at a time from '" + jobsDir + "'.")
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+	worker.poll()
+	for {
+		select {
+		case <-ticker.C:
+			worker.poll()
+		case <-stop:
+			worker.mu.Lock()
+			worker.stopping = true
+			for _, cmd := range worker.running {
+				cmd.Process.Kill()
+			}
+			worker.mu.Unlock()
+			worker.wg.Wait()
+			worker.log("[+] Worker '" + worker.id + "' stopped.")
+			return 0
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"sort"
+	"strings"
+)
+
+//Column '-plink' adds to the rows of processes and of the events they caused
+const ProcessKeyHeader = "ProcessKey"
+
+//Audits which record the start time of their processes, with their pid and start time columns
+var processKeyColumns = map[string][2]string{
+	"ProcessItem":            {"pid", "startTime"},
+	"EventItem_ProcessEvent": {"Pid", "StartTime"},
+}
+
+//ProcessKey identifies a process across audits as "<hostname>|<pid>|<start time>", since pids are reused
+func ProcessKey(hostname string, pid string, startTime string) string {
+	return hostname + "|" + pid + "|" + startTime
+}
+
+func outputColumnIndex(headers []string, header string) int {
+	for i, h := range headers {
+		if h == header {
+			return i
+		}
+	}
+	return -1
+}
+
+//AddProcessKeyColumns adds a "ProcessKey" column to the outputs of an XML file which have a pid for '-plink'
+//Processes use their own start time. Events of an eventbuffer use the start time of the latest ProcessEvent
+//of their pid which started before them, and get an empty key if the process started before the buffer.
+func AddProcessKeyColumns(options Options, outputs []CSVWriteOutput) {
+	//Start times of each pid of the host, from the ProcessEvents of the same eventbuffer
+	starts := map[string][]string{}
+	for _, output := range outputs {
+		if output.SplitSuffix != "EventItem_ProcessEvent" {
+			continue
+		}
+		col_index_pid := outputColumnIndex(output.Headers, "Pid")
+		col_index_start := outputColumnIndex(output.Headers, "StartTime")
+		if col_index_pid == -1 || col_index_start == -1 {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, row := range output.Rows {
+			pid, start := row[col_index_pid], row[col_index_start]
+			if pid == "" || start == "" || seen[pid+"|"+start] {
+				continue
+			}
+			seen[pid+"|"+start] = true
+			starts[pid] = append(starts[pid], start)
+		}
+	}
+	for pid := range starts {
+		sort.Strings(starts[pid])
+	}
+
+	for i, output := range outputs {
+		if output.Streamed != nil {
+			continue
+		}
+		col_index_hostname := outputColumnIndex(output.Headers, "Hostname")
+		if col_index_hostname == -1 {
+			continue
+		}
+		var key func(row []string) string
+		if columns, exists := processKeyColumns[output.SplitSuffix]; exists {
+			col_index_pid := outputColumnIndex(output.Headers, columns[0])
+			col_index_start := outputColumnIndex(output.Headers, columns[1])
+			if col_index_pid == -1 || col_index_start == -1 {
+				continue
+			}
+			key = func(row []string) string {
+				if row[col_index_pid] == "" || row[col_index_start] == "" {
+					return ""
+				}
+				return ProcessKey(row[col_index_hostname], row[col_index_pid], row[col_index_start])
+			}
+		} else if strings.HasPrefix(output.SplitSuffix, "EventItem_") {
+			col_index_pid := outputColumnIndex(output.Headers, "Pid")
+			col_index_time := outputColumnIndex(output.Headers, "EventBufferTime_"+strings.TrimPrefix(output.SplitSuffix, "EventItem_"))
+			if col_index_pid == -1 || col_index_time == -1 {
+				continue
+			}
+			key = func(row []string) string {
+				pidStarts := starts[row[col_index_pid]]
+				//Timestamps of the same format sort by time
+				j := sort.Search(len(pidStarts), func(j int) bool { return pidStarts[j] > row[col_index_time] })
+				if j == 0 || row[col_index_time] == "" {
+					return ""
+				}
+				return ProcessKey(row[col_index_hostname], row[col_index_pid], pidStarts[j-1])
+			}
+		} else {
+			continue
+		}
+
+		for j, row := range output.Rows {
+			output.Rows[j] = append(row, key(row))
+		}
+		outputs[i].Headers = append(append([]string{}, output.Headers...), ProcessKeyHeader)
+		outputs[i].Desc = GetFieldDescriptionsRow(options, output.SplitSuffix, outputs[i].Headers)
+	}
+}
@@ -27,9 +27,107 @@ import (
 
 func main() {
 
+    //Subcommands which do not use the normal flags
+    if len(os.Args) > 1 && os.Args[1] == "describe" {
+        goauditparser.GoAuditDescribe_Start(os.Args[2:])
+        return
+    }
+    if len(os.Args) > 1 && os.Args[1] == "help" {
+        goauditparser.GoAuditHelp_Start(os.Args[2:])
+        return
+    }
+    if len(os.Args) > 1 && os.Args[1] == "completion" {
+        goauditparser.GoAuditCompletion_Start(os.Args[2:])
+        return
+    }
+    if len(os.Args) > 1 && os.Args[1] == "gen-testdata" {
+        os.Exit(goauditparser.GoAuditGenTestData_Start(os.Args[2:]))
+    }
+    if len(os.Args) > 1 && os.Args[1] == "verify-outputs" {
+        os.Exit(goauditparser.GoAuditVerifyOutputs_Start(os.Args[2:]))
+    }
+    if len(os.Args) > 1 && os.Args[1] == "preview" {
+        os.Exit(goauditparser.GoAuditPreview_Start(os.Args[2:]))
+    }
+    //Background jobs, which keep running after the terminal or SSH session that submitted them closes
+    if len(os.Args) > 1 && os.Args[1] == "submit" {
+        os.Exit(goauditparser.GoAuditSubmit_Start(os.Args[2:]))
+    }
+    if len(os.Args) > 1 && os.Args[1] == "jobs" {
+        os.Exit(goauditparser.GoAuditJobs_Start(os.Args[2:]))
+    }
+    if len(os.Args) > 1 && os.Args[1] == "work" {
+        os.Exit(goauditparser.GoAuditWork_Start(os.Args[2:]))
+    }
+    if len(os.Args) > 1 && os.Args[1] == "serve" {
+        os.Exit(goauditparser.GoAuditServe_Start(os.Args[2:]))
+    }
+    //Repeat a run recorded with '-manifest' using its flags, once its configs and inputs are checked
+    if len(os.Args) > 1 && os.Args[1] == "rerun" {
+        args, exitCode := goauditparser.GoAuditRerun_Prepare(os.Args[2:])
+        if exitCode != 0 {
+            os.Exit(exitCode)
+        }
+        os.Args = append(os.Args[:1], args...)
+    }
+    verify := false
+    if len(os.Args) > 1 && os.Args[1] == "verify" {
+        verify = true
+        os.Args = append(os.Args[:1], os.Args[2:]...)
+    }
+
     //Parse input flags, read config file, determine what to do
     options := goauditparser.Setup()
     if options.ErrorDuringSetup {
+        options.Log.Close()
+        os.Exit(1)
+    }
+    //Record the end of the run in the '-log' log
+    defer options.Log.Close()
+
+    if options.RetentionDays > 0 {
+        goauditparser.GoAuditRetention_Start(options)
+        return
+    }
+    if options.Validate {
+        exitCode := goauditparser.GoAuditValidate_Start(options)
+        options.Log.Close()
+        os.Exit(exitCode)
+    }
+
+    //Clean up temp files left behind by crashed or killed runs in the directories this run writes to
+    tempDirs := []string{options.OutputPath, options.EventBufferSplitDir, options.XMLSplitOutputDir, options.MergeOutputDir}
+    if options.TimelineOnly && options.OutputPath == "" {
+        tempDirs = append(tempDirs, options.InputPath)
+    } else if options.InputPath != "" && options.EventBufferSplitDir == "" && options.XMLSplitOutputDir == "" {
+        tempDirs = append(tempDirs, goauditparser.XMLSplitDir(options))
+    }
+    goauditparser.CleanupOrphanedTempFiles(options, tempDirs)
+
+    if verify || options.GoldenDir != "" {
+        if options.GoldenDir == "" {
+            fmt.Println("Usage: goauditparser verify -golden <golden_dir> [-gu] [-gro] [<parse flags>]")
+            fmt.Println("   Ex: goauditparser verify -golden tests/golden -rn")
+            os.Exit(1)
+        }
+        exitCode := goauditparser.GoAuditVerify_Start(options)
+        options.Log.Close()
+        os.Exit(exitCode)
+    }
+
+    if options.MergeOutputDir != "" {
+        goauditparser.GoAuditMerge_Start(options)
+        return
+    }
+
+    //Without an input directory, only write the workbooks of CSV files which were already parsed
+    if options.XLSXMode != "" && options.InputPath == "" && !options.TimelineOnly {
+        goauditparser.GoAuditXLSX_Start(options)
+        return
+    }
+    //Without an input directory, only export the observables of CSV files which were already parsed
+    if options.ObservablesFormat != "" && options.InputPath == "" && !options.TimelineOnly {
+        goauditparser.GoAuditObservables_Start(options)
         return
     }
 
@@ -38,7 +136,15 @@ func main() {
         if options.OutputPath == "" && options.InputPath != "" {
             options.OutputPath = options.InputPath
         }
+        if options.Snapshot {
+            options.OutputPath = filepath.Join(options.OutputPath, goauditparser.SnapshotLatestName)
+        }
+        options.Progress = goauditparser.NewRunProgress(options, goauditparser.TimelineCases(options.OutputPath)[0].Path)
         goauditparser.GoAuditTimeliner_Start(options)
+        options.Progress.Close()
+        saveRunManifest(options)
+        saveRunReadme(options)
+        options.Notifier.RunFinished(options)
         return
     }
 
@@ -62,11 +168,11 @@ func main() {
         //Read input directory
         files, err_r := ioutil.ReadDir(options.InputPath)
         if err_r != nil {
-            fmt.Println(options.Warnbox + "ERROR - Could not read input directory '" + options.InputPath + "'.")
+            options.Log.Println(options.Warnbox + "ERROR - Could not read input directory '" + options.InputPath + "'.")
             log.Fatal(err_r)
         }
         if len(files) == 0 {
-            fmt.Println(options.Warnbox + "ERROR - Could not identify any files in input directory '" + options.InputPath + "'.")
+            options.Log.Println(options.Warnbox + "ERROR - Could not identify any files in input directory '" + options.InputPath + "'.")
             return
         }
 
@@ -75,7 +181,7 @@ func main() {
         for i := 0; i < len(files); i++ {
             filename := filepath.Base(files[i].Name())
 
-            if strings.ToLower(filepath.Ext(filename)) == ".zip" || strings.ToLower(filepath.Ext(filename)) == ".mans" {
+            if strings.ToLower(filepath.Ext(filename)) == ".zip" || strings.ToLower(filepath.Ext(filename)) == ".mans" || goauditparser.IsManualCollection(options, filepath.Join(options.InputPath, filename)) {
                 archives = append(archives, files[i])
                 files = append(files[:i], files[i+1:]...)
                 i--
@@ -88,19 +194,33 @@ func main() {
         }
         //Unarchive any files
         if len(archives) > 0 {
+            options.Progress = goauditparser.NewRunProgress(options, options.ExtractionOutputDir)
             goauditparser.GoAuditExtract_Start(options, archives, goauditparser.Parse_Config_JSON{}, -1)
+            options.Progress.Close()
+            options.Notifier.RunFinished(options)
         } else {
-            fmt.Println(options.Warnbox + "ERROR - Could not identify any archive files in input directory '" + options.InputPath + "'.")
+            options.Log.Println(options.Warnbox + "ERROR - Could not identify any archive files in input directory '" + options.InputPath + "'.")
         }
         return
     }
 
+    //Keep parsing the files which land in the input directory
+    if options.Watch {
+        exitCode := goauditparser.GoAuditWatch_Start(options, parseInput)
+        options.Log.Close()
+        os.Exit(exitCode)
+    }
+    parseInput(options)
+}
+
+//Parses the input directories into the output directory, then timelines, writes workbooks, and exports observables
+func parseInput(options goauditparser.Options) {
     //Get number of input directories
     inputArray := strings.Split(options.InputPath, ",")
     if len(inputArray) > 1 {
         fmt.Println(options.Box+"Provided", len(inputArray), "input directories:")
         for i, inputPath := range inputArray {
-            fmt.Println(options.Box + strconv.Itoa(i+1) + ". " + inputPath)
+            options.Log.Println(options.Box + strconv.Itoa(i+1) + ". " + inputPath)
         }
     }
 
@@ -113,11 +233,15 @@ func main() {
                 if err != nil {
                     return err
                 }
+                //The XML of a Redline session is extracted with the session, not parsed again
+                if info.IsDir() && goauditparser.IsRedlineAuditsDir(path) {
+                    return filepath.SkipDir
+                }
                 if (info.IsDir() && info.Name() != "xmlsplit")  {inputMap[path] = true}
                 return nil
             })
             if err != nil {
-                fmt.Println(options.Warnbox + "ERROR - Could not recursively explore the directory '" + inputPath + "'.")
+                options.Log.Println(options.Warnbox + "ERROR - Could not recursively explore the directory '" + inputPath + "'.")
                 break;
             }
         }
@@ -128,41 +252,46 @@ func main() {
         }
         sort.Strings(inputArray)
         for i, inputPath := range inputArray {
-            fmt.Println(options.Box + strconv.Itoa(i+1) + ". " + inputPath)
+            options.Log.Println(options.Box + strconv.Itoa(i+1) + ". " + inputPath)
         }
         
     }
     
+    //Multiple output directories are only used for composite timelines
+    if len(goauditparser.TimelineCases(options.OutputPath)) > 1 {
+        options.Log.Println(options.Warnbox + "ERROR - Multiple output directories '" + options.OutputPath + "' can only be timelined with '-tlo'.")
+        return
+    }
+
+    //Each snapshot is written to its own directory, "latest" only moves once the run finishes
+    snapshotBase := ""
+    if options.Snapshot {
+        snapshotBase = options.OutputPath
+        options.OutputPath = goauditparser.NewSnapshotPath(snapshotBase)
+        options.Log.Println(options.Box + "Writing output snapshot '" + options.OutputPath + "'...")
+    }
+
     // Make output directory if it does not exist
-    if _, err := os.Stat(options.OutputPath); os.IsNotExist(err) {
-        if err = os.MkdirAll(options.OutputPath, os.ModePerm); err != nil {
-            fmt.Println(options.Warnbox + "ERROR - Could not create output directory '" + options.OutputPath + "'.")
+    if _, err := os.Stat(options.OutputPath); os.IsNotExist(err) && !options.PruneCache {
+        if err = goauditparser.MkdirAllOutput(options, options.OutputPath); err != nil {
+            options.Log.Println(options.Warnbox + "ERROR - Could not create output directory '" + options.OutputPath + "'.")
             log.Fatal(err)
         }
     } else {
         // Remove all
         if options.WipeOutput {
-            outputfiles, _ := ioutil.ReadDir(options.OutputPath)
-            if len(outputfiles) > 0 {
-                fmt.Println(options.Box + "Deleting all pre-existing CSV files in the output directory '" + options.OutputPath + "' as specified with the '-wo' flag.")
-                for _, file := range outputfiles {
-                    var filename = file.Name()
-                    if strings.HasSuffix(filename, ".csv") {
-                        if options.Verbose > 0 {
-                            fmt.Println(options.Box + "Removing pre-existing CSV file '" + filename + "'...")
-                        }
-                        os.Remove(filepath.Join(options.OutputPath, filename))
-                    }
-                }
-            }
+            goauditparser.WipeOutputDirectory(options, options.OutputPath, goauditparser.OutputFileExtension(options))
         }
     }
 
+    //Progress file for dashboards and automation ('-progress')
+    options.Progress = goauditparser.NewRunProgress(options, options.OutputPath)
+
     //Iterate through each input directory
     for _, inputPath := range inputArray {
 
         if len(inputArray) != 1 {
-            fmt.Println(options.Box + "Starting process for input '" + inputPath + "' into output '" + options.OutputPath + "'...")
+            options.Log.Println(options.Box + "Starting process for input '" + inputPath + "' into output '" + options.OutputPath + "'...")
         }
 
         // SET ORIGINALS
@@ -185,6 +314,50 @@ func main() {
     if options.Timeline {
         goauditparser.GoAuditTimeliner_Start(options)
     }
+
+    // WRITE WORKBOOKS
+    if options.XLSXMode != "" {
+        goauditparser.GoAuditXLSX_Start(options)
+    }
+
+    // EXPORT OBSERVABLES
+    if options.ObservablesFormat != "" {
+        goauditparser.GoAuditObservables_Start(options)
+    }
+    options.Progress.Close()
+    saveRunManifest(options)
+    saveRunReadme(options)
+
+    // UPDATE LATEST SNAPSHOT
+    if snapshotBase != "" {
+        if err := goauditparser.UpdateLatestSnapshot(snapshotBase, options.OutputPath); err != nil {
+            options.Log.Println(options.Warnbox + "WARNING - Could not point '" + filepath.Join(snapshotBase, goauditparser.SnapshotLatestName) + "' at snapshot '" + options.OutputPath + "'. " + err.Error())
+        } else if options.Verbose > 0 {
+            options.Log.Println(options.Box + "Updated '" + filepath.Join(snapshotBase, goauditparser.SnapshotLatestName) + "' to snapshot '" + filepath.Base(options.OutputPath) + "'.")
+        }
+    }
+
+    // NOTIFY
+    options.Notifier.RunFinished(options)
+}
+
+//Writes the '-manifest' file of the run to the output directory
+func saveRunManifest(options goauditparser.Options) {
+    if err := options.RunManifest.Save(options); err != nil {
+        options.Log.Println(options.Warnbox + "WARNING - Could not write '" + goauditparser.RunManifestFileName + "'. " + err.Error())
+    } else if options.RunManifest != nil {
+        options.Log.Println(options.Box + "Recorded the run in '" + filepath.Join(goauditparser.TimelineCases(options.OutputPath)[0].Path, goauditparser.RunManifestFileName) + "'. Repeat it with 'goauditparser rerun <manifest>'.")
+    }
+}
+
+//Writes the '-readme' file of the run to the output directory
+func saveRunReadme(options goauditparser.Options) {
+    if path, err := options.RunReadme.Save(options); err != nil {
+        options.Log.Println(options.Warnbox + "WARNING - Could not write '" + goauditparser.RunReadmeFileName(options) + "'. " + err.Error())
+    } else if path != "" {
+        options.Log.Println(options.Box + "Described the output in '" + path + "'.")
+        options.Notifier.AddOutputs(path)
+    }
 }
 
 func MD5Hash(filepath string) string {
@@ -0,0 +1,154 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//Directories below a manual collection directory which are searched for audits, such as "<collection>/<hostname>/<audit>.xml"
+const manualCollectionDepth = 3
+
+//ManualCollectionAudit returns the audit type of a raw audit filename of a manual collection, such as "w32apifiles"
+//for "files-api.xml", from the "Manual_Collection_Audits" table of the main config. Names are matched ignoring case
+func ManualCollectionAudit(options Options, fileName string) (string, bool) {
+	if strings.ToLower(filepath.Ext(fileName)) != ".xml" {
+		return "", false
+	}
+	baseName := strings.ToLower(strings.TrimSuffix(fileName, filepath.Ext(fileName)))
+	for name, auditType := range options.Config.ManualCollectionAudits {
+		if strings.ToLower(name) == baseName {
+			return auditType, true
+		}
+	}
+	return "", false
+}
+
+//IsManualCollection returns true if the directory holds audits of a manual collection script, such as those of air-gapped
+//hosts, which are placed in host-named folders without a manifest.json and named after their audit, such as "processes.xml"
+func IsManualCollection(options Options, dirPath string) bool {
+	if st, err_s := os.Stat(dirPath); err_s != nil || !st.IsDir() || filepath.Base(dirPath) == "xmlsplit" || filepath.Base(dirPath) == InputScratchDirName {
+		return false
+	}
+	if _, err_s := os.Stat(filepath.Join(dirPath, "manifest.json")); err_s == nil {
+		return false
+	}
+	if IsRedlineSession(dirPath) {
+		return false
+	}
+	found := false
+	filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || found {
+			return filepath.SkipDir
+		}
+		rel, _ := filepath.Rel(dirPath, path)
+		if info.IsDir() && rel != "." && strings.Count(filepath.ToSlash(rel), "/") >= manualCollectionDepth-1 {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() {
+			_, found = ManualCollectionAudit(options, info.Name())
+		}
+		return nil
+	})
+	return found
+}
+
+//GoAuditExtract_ManualThread copies the audit XML of a manual collection directory into standard
+//"<hostname>-<agentid>-<payload>-<audittype>.xml" names. The hostname is the name of the folder holding each audit
+func GoAuditExtract_ManualThread(file os.FileInfo, options Options, threadNum int, c chan ThreadReturnExtract) {
+	xmlfiles := []os.FileInfo{}
+	fileName := filepath.Base(file.Name())
+	collectionDir := filepath.Join(options.InputPath, fileName)
+
+	var outputDir = InputScratchDir(options)
+	if len(options.ExtractionOutputDir) > 0 {
+		outputDir = options.ExtractionOutputDir
+	}
+
+	warningMessages := []string{}
+	err_w := filepath.Walk(collectionDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			warningMessages = append(warningMessages, "Could not read '"+path+"': "+err.Error())
+			return nil
+		}
+		rel, _ := filepath.Rel(collectionDir, path)
+		if info.IsDir() {
+			if rel != "." && strings.Count(filepath.ToSlash(rel), "/") >= manualCollectionDepth-1 {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.ToLower(filepath.Ext(info.Name())) != ".xml" {
+			return nil
+		}
+		auditType, mapped := ManualCollectionAudit(options, info.Name())
+		if !mapped {
+			warningMessages = append(warningMessages, "No audit type for '"+rel+"'. Add its name to 'Manual_Collection_Audits' of the main config to parse it.")
+			return nil
+		}
+
+		hostname := filepath.Base(filepath.Dir(path))
+		agentid := "0000000000000000000000"
+		if options.ParseAltHostname != "" {
+			hostname = options.ParseAltHostname
+		}
+		if options.ParseAltAgentID != "" {
+			agentid = options.ParseAltAgentID
+		}
+		baseName := strings.TrimSuffix(info.Name(), filepath.Ext(info.Name()))
+		payload := strings.NewReplacer("-", "", "_", "", " ", "").Replace(baseName)
+		if options.ExtractXMLFormat == 2 {
+			payload = "0"
+		}
+		new_name := hostname + "-" + agentid + "-" + payload + "-" + strings.Replace(auditType, "-", "_", -1) + ".xml"
+
+		if options.ExtractFilesOnly {
+			return nil
+		}
+
+		inFile, err_o := os.Open(path)
+		if err_o != nil {
+			warningMessages = append(warningMessages, "Could not open audit file '"+rel+"'. "+err_o.Error())
+			return nil
+		}
+		defer inFile.Close()
+		outFilePath := filepath.Join(outputDir, new_name)
+		outFile, err_c := CreateOutputFile(options, outFilePath)
+		if err_c != nil {
+			warningMessages = append(warningMessages, "Could not create destination file '"+new_name+"'. "+err_c.Error())
+			return nil
+		}
+		_, err_cp := io.Copy(outFile, inFile)
+		outFile.Close()
+		if err_cp != nil {
+			warningMessages = append(warningMessages, "Could not copy contents to destination file '"+new_name+"'. "+err_cp.Error())
+			return nil
+		}
+
+		xmlfile, _ := os.Stat(outFilePath)
+		xmlfiles = append(xmlfiles, xmlfile)
+		return nil
+	})
+	if err_w != nil {
+		warningMessages = append(warningMessages, "Could not walk manual collection directory: "+err_w.Error())
+	}
+
+	if len(xmlfiles) == 0 && !options.ExtractFilesOnly {
+		c <- ThreadReturnExtract{threadNum, fileName, options.Warnbox + `WARNING - Failed to unarchive '` + fileName + `'. No mapped audit XML files found in manual collection directory '` + collectionDir + `'.`, xmlfiles, nil, nil, nil}
+	} else if len(warningMessages) > 0 {
+		c <- ThreadReturnExtract{threadNum, fileName, options.Warnbox + `WARNING - Manual collection '` + fileName + `' unarchived with issues.` + "\n" + strings.Join(warningMessages, "\n"+options.Warnbox+"- "), xmlfiles, nil, nil, nil}
+	} else {
+		c <- ThreadReturnExtract{threadNum, fileName, options.Box + `NOTICE - Manual collection '` + fileName + `' unarchived successfully.`, xmlfiles, nil, nil, nil}
+	}
+}
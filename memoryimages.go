@@ -0,0 +1,136 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//MemoryImage is a memory acquisition payload (hiberfil, pagefile, or raw memory) found while extracting an archive
+type MemoryImage struct {
+	Archive     string `json:"archive"`
+	Hostname    string `json:"hostname"`
+	AgentID     string `json:"agentid"`
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	MD5         string `json:"md5"`
+	SHA256      string `json:"sha256"`
+	HookCommand string `json:"hook_command,omitempty"`
+	HookOutput  string `json:"hook_output,omitempty"`
+	HookStatus  string `json:"hook_status,omitempty"`
+}
+
+//"hiberfil.sys", "pagefile.sys", "swapfile.sys", "memory.raw", "host.dmp", etc. Extracted names may end with "_"
+var regMemoryImage = regexp.MustCompile(`(?i)((^|[_\\/])(hiberfil|pagefile|swapfile)\.sys|\.(raw|mem|dmp|vmem|lime|aff4|crash))_?$`)
+
+//IsMemoryImage returns true if an acquired file looks like a memory image by its name or acquisition generator
+func IsMemoryImage(filename string, generator string) bool {
+	generator = strings.ToLower(strings.Replace(generator, "-", "_", -1))
+	if strings.Contains(generator, "memory_acquisition") || strings.Contains(generator, "memoryacquisition") {
+		return true
+	}
+	return regMemoryImage.MatchString(filename)
+}
+
+//CopyMemoryImage copies a memory image while hashing it so it only has to be read once
+func CopyMemoryImage(dst io.Writer, src io.Reader, image *MemoryImage) error {
+	hashMD5 := md5.New()
+	hashSHA256 := sha256.New()
+	size, err_c := io.Copy(io.MultiWriter(dst, hashMD5, hashSHA256), src)
+	if err_c != nil {
+		return err_c
+	}
+	image.Size = size
+	image.MD5 = hex.EncodeToString(hashMD5.Sum(nil))
+	image.SHA256 = hex.EncodeToString(hashSHA256.Sum(nil))
+	return nil
+}
+
+//GoAuditExtract_MemoryImages runs the memory image hook from the main config on each image and records them in "_GAPMemoryImages.json"
+func GoAuditExtract_MemoryImages(options Options, images []MemoryImage) {
+	if len(images) == 0 {
+		return
+	}
+	outputDir := InputScratchDir(options)
+	if len(options.ExtractionOutputDir) > 0 {
+		outputDir = options.ExtractionOutputDir
+	}
+	options.Log.Println(options.Box + "Identified " + strconv.Itoa(len(images)) + " memory image(s) in extracted archives.")
+
+	hook := options.Config.MemoryImageHook
+	for i, image := range images {
+		if options.Verbose > 0 {
+			options.Log.Println(options.Box + "- " + image.Path + " (" + strconv.FormatInt(image.Size, 10) + " bytes, MD5 " + image.MD5 + ")")
+		}
+		if hook.Command == "" {
+			continue
+		}
+		args := []string{}
+		for _, arg := range hook.Arguments {
+			arg = strings.ReplaceAll(arg, "<IMAGE>", image.Path)
+			arg = strings.ReplaceAll(arg, "<HOSTNAME>", image.Hostname)
+			arg = strings.ReplaceAll(arg, "<AGENTID>", image.AgentID)
+			arg = strings.ReplaceAll(arg, "<OUTDIR>", outputDir)
+			args = append(args, arg)
+		}
+		images[i].HookCommand = strings.Join(append([]string{hook.Command}, args...), " ")
+		images[i].HookOutput = image.Path + ".hook.txt"
+		if options.Verbose > 0 {
+			options.Log.Println(options.Box + "Running memory image hook '" + images[i].HookCommand + "'...")
+		}
+		output, err_e := exec.Command(hook.Command, args...).CombinedOutput()
+		WriteOutputFile(options, images[i].HookOutput, output, 0644)
+		if err_e != nil {
+			images[i].HookStatus = "failed: " + err_e.Error()
+			options.Log.Println(options.Warnbox + "WARNING - Memory image hook failed for '" + filepath.Base(image.Path) + "'. " + err_e.Error())
+		} else {
+			images[i].HookStatus = "success"
+		}
+	}
+
+	//Keep images recorded by previous runs, replacing any that were extracted again
+	reportPath := filepath.Join(outputDir, "_GAPMemoryImages.json")
+	report := []MemoryImage{}
+	if b, err_r := ioutil.ReadFile(reportPath); err_r == nil {
+		json.Unmarshal(b, &report)
+	}
+	for _, image := range images {
+		replaced := false
+		for j, existing := range report {
+			if existing.Path == image.Path {
+				report[j] = image
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			report = append(report, image)
+		}
+	}
+	b, _ := json.MarshalIndent(report, "", "    ")
+	err_w := WriteOutputFile(options, reportPath, b, 0644)
+	if err_w != nil {
+		options.Log.Println(options.Warnbox + "WARNING - Could not write memory image report '" + reportPath + "'. " + err_w.Error())
+		return
+	}
+	options.Log.Println(options.Box + "Memory image report: " + reportPath)
+}
@@ -0,0 +1,224 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//Default of '-emem-max <int>', the megabytes of extracted XML audits held in memory at once
+const MemoryPayloadsDefaultMaxMB = 2048
+
+//XMLInput is an XML file opened for parsing, from disk or from the payloads held in memory by '-emem <int>'
+type XMLInput interface {
+	io.ReadSeeker
+	io.Closer
+	Stat() (os.FileInfo, error)
+}
+
+//MemoryPayloads are the XML audits extracted from archives into memory with '-emem <int>', so parse workers read them
+//without writing them to the input directory and reading them back. Payloads are keyed by the path they would have on disk
+//Payloads over '-emem <int>' MB, or which would take the payloads held over '-emem-max <int>' MB, are written to disk as before
+type MemoryPayloads struct {
+	mu       sync.Mutex
+	payloads map[string][]byte
+	infos    map[string]memoryPayloadInfo
+	maxSize  int64
+	maxTotal int64
+	size     int64 //Bytes of the payloads held now
+	Kept     int
+	KeptSize int64
+	Spilled  int
+}
+
+//memoryPayloadInfo is the os.FileInfo of a payload held in memory
+type memoryPayloadInfo struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (info memoryPayloadInfo) Name() string       { return filepath.Base(info.path) }
+func (info memoryPayloadInfo) Size() int64        { return info.size }
+func (info memoryPayloadInfo) Mode() os.FileMode  { return 0444 }
+func (info memoryPayloadInfo) ModTime() time.Time { return info.modTime }
+func (info memoryPayloadInfo) IsDir() bool        { return false }
+func (info memoryPayloadInfo) Sys() interface{}   { return nil }
+
+//memoryXMLInput reads a payload held in memory, each parse worker gets its own reader of the shared bytes
+type memoryXMLInput struct {
+	*bytes.Reader
+	info memoryPayloadInfo
+}
+
+func (input memoryXMLInput) Close() error               { return nil }
+func (input memoryXMLInput) Stat() (os.FileInfo, error) { return input.info, nil }
+
+//IsMemoryPayload returns true if the file is an XML audit held in memory by '-emem <int>'
+func IsMemoryPayload(file os.FileInfo) bool {
+	_, isMemory := file.(memoryPayloadInfo)
+	return isMemory
+}
+
+func NewMemoryPayloads(maxMB int, maxTotalMB int) *MemoryPayloads {
+	return &MemoryPayloads{
+		payloads: map[string][]byte{},
+		infos:    map[string]memoryPayloadInfo{},
+		maxSize:  int64(maxMB) * 1024 * 1024,
+		maxTotal: int64(maxTotalMB) * 1024 * 1024,
+	}
+}
+
+//Keep reads a payload which would be extracted to path into memory and returns its file info
+//If it is over the size limits, it returns false and a reader of the whole payload, including what was already read,
+//which is written to disk instead
+func (payloads *MemoryPayloads) Keep(path string, r io.Reader) (os.FileInfo, io.Reader, bool, error) {
+	if payloads == nil {
+		return nil, r, false, nil
+	}
+	buf := &bytes.Buffer{}
+	n, err_r := io.CopyN(buf, r, payloads.maxSize+1)
+	if err_r != nil && err_r != io.EOF {
+		return nil, nil, false, err_r
+	}
+	payloads.mu.Lock()
+	defer payloads.mu.Unlock()
+	if n > payloads.maxSize || payloads.size+n > payloads.maxTotal {
+		payloads.Spilled++
+		return nil, io.MultiReader(bytes.NewReader(buf.Bytes()), r), false, nil
+	}
+	info := memoryPayloadInfo{filepath.Clean(path), n, time.Now()}
+	payloads.payloads[info.path] = buf.Bytes()
+	payloads.infos[info.path] = info
+	payloads.size += n
+	payloads.Kept++
+	payloads.KeptSize += n
+	return info, nil, true, nil
+}
+
+func (payloads *MemoryPayloads) lookup(path string) ([]byte, memoryPayloadInfo, bool) {
+	if payloads == nil {
+		return nil, memoryPayloadInfo{}, false
+	}
+	payloads.mu.Lock()
+	defer payloads.mu.Unlock()
+	data, exists := payloads.payloads[filepath.Clean(path)]
+	return data, payloads.infos[filepath.Clean(path)], exists
+}
+
+//Stat returns the file info of a payload held in memory, or of the file on disk
+func (payloads *MemoryPayloads) Stat(path string) (os.FileInfo, error) {
+	if _, info, exists := payloads.lookup(path); exists {
+		return info, nil
+	}
+	return os.Stat(path)
+}
+
+//Open opens a payload held in memory, or the file on disk
+func (payloads *MemoryPayloads) Open(path string) (XMLInput, error) {
+	if data, info, exists := payloads.lookup(path); exists {
+		return memoryXMLInput{bytes.NewReader(data), info}, nil
+	}
+	file, err_o := os.Open(path)
+	if err_o != nil {
+		return nil, err_o
+	}
+	return file, nil
+}
+
+//Release frees a payload once it is parsed
+func (payloads *MemoryPayloads) Release(file os.FileInfo) {
+	info, isMemory := file.(memoryPayloadInfo)
+	if payloads == nil || !isMemory {
+		return
+	}
+	payloads.mu.Lock()
+	defer payloads.mu.Unlock()
+	if _, exists := payloads.payloads[info.path]; exists {
+		payloads.size -= info.size
+		delete(payloads.payloads, info.path)
+		delete(payloads.infos, info.path)
+	}
+}
+
+//Spill writes a payload held in memory to the path it would have been extracted to, for the steps which need the file
+//on disk, such as splitting, and for files which failed so they can be parsed again. It returns the file info on disk
+func (payloads *MemoryPayloads) Spill(options Options, file os.FileInfo) (os.FileInfo, error) {
+	info, isMemory := file.(memoryPayloadInfo)
+	if !isMemory {
+		return file, nil
+	}
+	data, _, exists := payloads.lookup(info.path)
+	if !exists {
+		return payloads.Stat(info.path)
+	}
+	outFile, err_c := CreateOutputFile(options, info.path)
+	if err_c != nil {
+		return file, err_c
+	}
+	_, err_w := outFile.Write(data)
+	outFile.Close()
+	if err_w != nil {
+		os.Remove(info.path)
+		return file, err_w
+	}
+	payloads.Release(file)
+	return os.Stat(info.path)
+}
+
+//Finish frees a parsed payload, and writes one which failed or was not parsed to disk so the next run parses it again
+func (payloads *MemoryPayloads) Finish(options Options, file os.FileInfo, status string) {
+	if !IsMemoryPayload(file) {
+		return
+	}
+	switch status {
+	case "parsed", "cached", "issues", "empty", "skipped":
+		payloads.Release(file)
+		return
+	}
+	if _, err_s := payloads.Spill(options, file); err_s != nil {
+		options.Log.Println(options.Warnbox + "WARNING - Could not write XML file '" + file.Name() + "' held in memory to disk. Run again with '-f' to extract it again. " + err_s.Error())
+	}
+}
+
+//SpillAll writes the payloads which are still held in memory, because they were not parsed, to disk
+func (payloads *MemoryPayloads) SpillAll(options Options) {
+	if payloads == nil {
+		return
+	}
+	payloads.mu.Lock()
+	infos := []memoryPayloadInfo{}
+	for _, info := range payloads.infos {
+		infos = append(infos, info)
+	}
+	payloads.mu.Unlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].path < infos[j].path })
+	for _, info := range infos {
+		if _, err_s := payloads.Spill(options, info); err_s != nil {
+			options.Log.Println(options.Warnbox + "WARNING - Could not write XML file '" + info.Name() + "' held in memory to disk. Run again with '-f' to extract it again. " + err_s.Error())
+		}
+	}
+}
+
+//Report logs how many extracted XML files are parsed from memory instead of being written to disk
+func (payloads *MemoryPayloads) Report(options Options) {
+	if payloads == nil || payloads.Kept+payloads.Spilled == 0 {
+		return
+	}
+	options.Log.Println(options.Box + "Kept " + strconv.Itoa(payloads.Kept) + " extracted XML file(s), " + strconv.FormatFloat(float64(payloads.KeptSize)/1024/1024, 'f', 1, 64) + " MB, in memory for parsing. " + strconv.Itoa(payloads.Spilled) + " file(s) over the '-emem' or '-emem-max' limits were written to disk.")
+}
@@ -0,0 +1,303 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Payload written in place of the payload ID of merged files, "<hostname>-<agentid>-merged-<audittype>.csv"
+const MergedPayload = "merged"
+
+//Columns which differ between collections of the same data, so they are not compared when merging rows
+var mergeIgnoredHeaders = map[string]bool{
+	"AgentID":                 true,
+	"FireEyeGeneratedTime":    true,
+	"ScriptRequestTime":       true,
+	"AcquisitionCompleteTime": true,
+}
+
+//MergeGroup is the parsed CSV files of one hostname and audit type from any number of collections
+type MergeGroup struct {
+	Hostname  string
+	AuditType string
+	Files     []string //Relative to the CSV directory, may include the "Output_Routes" subdirectory
+}
+
+//GroupFilesForMerge groups the parsed CSV files "<hostname>-<agentid>-<payload>-<audittype>.csv" of a directory by
+//hostname and audit type, ignoring case. Groups are sorted by hostname and audit type, and their files by name
+func GroupFilesForMerge(files []string) []MergeGroup {
+	groups := []MergeGroup{}
+	index := map[string]int{}
+	for _, name := range files {
+		base := filepath.Base(name)
+		if !strings.HasSuffix(base, ".csv") || strings.HasPrefix(base, "_") || !IsGoAuditParserOutputFile(base) {
+			continue
+		}
+		parts := strings.Split(strings.TrimSuffix(base, ".csv"), "-")
+		hostname := strings.Join(parts[0:len(parts)-3], "-")
+		auditType := parts[len(parts)-1]
+		key := strings.ToLower(hostname) + "\x00" + strings.ToLower(auditType)
+		i, exists := index[key]
+		if !exists {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, MergeGroup{Hostname: hostname, AuditType: auditType})
+		}
+		groups[i].Files = append(groups[i].Files, name)
+	}
+	for i := range groups {
+		sort.Strings(groups[i].Files)
+	}
+	sort.SliceStable(groups, func(a, b int) bool {
+		if !strings.EqualFold(groups[a].Hostname, groups[b].Hostname) {
+			return strings.ToLower(groups[a].Hostname) < strings.ToLower(groups[b].Hostname)
+		}
+		return strings.ToLower(groups[a].AuditType) < strings.ToLower(groups[b].AuditType)
+	})
+	return groups
+}
+
+//readMergeCSV reads the headers, field descriptions row ('-pdesc') if any, and rows of a parsed CSV file
+func readMergeCSV(path string) ([]string, []string, [][]string, error) {
+	file, err_o := os.Open(path)
+	if err_o != nil {
+		return nil, nil, nil, err_o
+	}
+	defer file.Close()
+	reader, _ := NewDialectCSVReader(file)
+	headers, err_h := reader.Read()
+	if err_h == io.EOF {
+		return nil, nil, nil, nil
+	} else if err_h != nil {
+		return nil, nil, nil, err_h
+	}
+	var desc []string
+	rows := [][]string{}
+	for {
+		row, err_r := reader.Read()
+		if err_r == io.EOF {
+			break
+		} else if err_r != nil {
+			return nil, nil, nil, err_r
+		}
+		if desc == nil && len(rows) == 0 && len(row) > 0 && row[0] == FieldDescriptionsMarker {
+			desc = row
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return headers, desc, rows, nil
+}
+
+//MergeCSVFiles reads the parsed CSV files of a group and merges their rows under the union of their headers
+//Rows which are identical other than the columns of mergeIgnoredHeaders and deduplicateIgnoredHeaders are kept once,
+//as the copy with the newest "FireEyeGeneratedTime", in the position of the first copy.
+//Returns the headers, field descriptions (nil if no file has them), rows, and the number of rows removed
+func MergeCSVFiles(dir string, group MergeGroup) ([]string, []string, [][]string, int, error) {
+	headers := []string{}
+	headerIndex := map[string]int{}
+	descs := map[string]string{}
+	rows := [][]string{}
+	total := 0
+	for _, name := range group.Files {
+		fileHeaders, fileDesc, fileRows, err_r := readMergeCSV(filepath.Join(dir, name))
+		if err_r != nil {
+			return nil, nil, nil, 0, fmt.Errorf("could not read '%s'. %s", name, err_r.Error())
+		}
+		//Columns of this file in the merged headers
+		cols := make([]int, len(fileHeaders))
+		for i, header := range fileHeaders {
+			j, exists := headerIndex[header]
+			if !exists {
+				j = len(headers)
+				headerIndex[header] = j
+				headers = append(headers, header)
+			}
+			cols[i] = j
+			if i > 0 && i < len(fileDesc) && fileDesc[i] != "" && descs[header] == "" {
+				descs[header] = fileDesc[i]
+			}
+		}
+		for _, row := range fileRows {
+			merged := make([]string, len(headers))
+			for i, value := range row {
+				if i < len(cols) {
+					merged[cols[i]] = value
+				}
+			}
+			rows = append(rows, merged)
+		}
+		total += len(fileRows)
+	}
+
+	compared := []int{}
+	col_index_time := -1
+	for i, header := range headers {
+		if header == "FireEyeGeneratedTime" {
+			col_index_time = i
+		}
+		if !mergeIgnoredHeaders[header] && !deduplicateIgnoredHeaders[header] {
+			compared = append(compared, i)
+		}
+	}
+	value := func(row []string, i int) string {
+		if i >= 0 && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	uniqueRows := [][]string{}
+	index := map[[sha1.Size]byte]int{}
+	var key strings.Builder
+	for _, row := range rows {
+		key.Reset()
+		for _, i := range compared {
+			key.WriteString(value(row, i))
+			key.WriteByte(0)
+		}
+		hash := sha1.Sum([]byte(key.String()))
+		if j, exists := index[hash]; exists {
+			//Timestamps are normalized to "YYYY-MM-DD HH:MM:SS" so they compare as strings
+			if value(row, col_index_time) > value(uniqueRows[j], col_index_time) {
+				uniqueRows[j] = row
+			}
+			continue
+		}
+		index[hash] = len(uniqueRows)
+		uniqueRows = append(uniqueRows, row)
+	}
+	for j := range uniqueRows {
+		for len(uniqueRows[j]) < len(headers) {
+			uniqueRows[j] = append(uniqueRows[j], "")
+		}
+	}
+
+	var desc []string
+	if len(descs) > 0 {
+		desc = make([]string, len(headers))
+		for i, header := range headers {
+			desc[i] = descs[header]
+		}
+		desc[0] = FieldDescriptionsMarker
+	}
+	return headers, desc, uniqueRows, total - len(uniqueRows), nil
+}
+
+//mergedAgentID returns the agent ID of the newest row of a merged group, which names its merged file
+func mergedAgentID(headers []string, rows [][]string) string {
+	col_index_agent, col_index_time := -1, -1
+	for i, header := range headers {
+		if header == "AgentID" {
+			col_index_agent = i
+		} else if header == "FireEyeGeneratedTime" {
+			col_index_time = i
+		}
+	}
+	agentID, newest := "", ""
+	for _, row := range rows {
+		if col_index_agent == -1 || row[col_index_agent] == "" {
+			continue
+		}
+		if agentID == "" || (col_index_time != -1 && row[col_index_time] > newest) {
+			agentID = row[col_index_agent]
+			if col_index_time != -1 {
+				newest = row[col_index_time]
+			}
+		}
+	}
+	return agentID
+}
+
+//GoAuditMerge_Start merges the parsed CSV files in "-o <csv_dir>" of hosts collected more than once into one file per
+//hostname and audit type in the '-merge <dir>' directory
+func GoAuditMerge_Start(options Options) {
+	csvDir := options.OutputPath
+	files, err_r := ReadOutputDir(options, csvDir)
+	if err_r != nil {
+		options.Log.Println(options.Warnbox + "ERROR - Could not read CSV directory '" + csvDir + "'. " + err_r.Error())
+		return
+	}
+	groups := GroupFilesForMerge(files)
+	if len(groups) == 0 {
+		options.Log.Println(options.Warnbox + "ERROR - Could not identify any parsed CSV files in '" + csvDir + "'.")
+		return
+	}
+
+	//Merged files are written like parsed files, with the merge directory as the output directory
+	options.OutputPath = options.MergeOutputDir
+	if err_m := MkdirAllOutput(options, options.OutputPath); err_m != nil {
+		options.Log.Println(options.Warnbox + "ERROR - Could not create merge directory '" + options.OutputPath + "'. " + err_m.Error())
+		return
+	}
+	count := 0
+	for _, group := range groups {
+		count += len(group.Files)
+	}
+	options.Log.Println(options.Box + "Merging " + strconv.Itoa(count) + " file(s) from '" + csvDir + "' into '" + options.OutputPath + "'...")
+
+	hosts := map[string]bool{}
+	written, failed, mergedFiles, removed := 0, 0, 0, 0
+	for _, group := range groups {
+		headers, desc, rows, dupes, err_m := MergeCSVFiles(csvDir, group)
+		if err_m != nil {
+			options.Log.Println(options.Warnbox + "ERROR - Could not merge " + group.AuditType + " of host '" + group.Hostname + "', " + err_m.Error())
+			failed++
+			continue
+		}
+		if len(headers) == 0 {
+			continue
+		}
+		agentID := mergedAgentID(headers, rows)
+		if agentID == "" {
+			agentID = "0"
+		}
+		prefix := group.Hostname + "-" + agentID + "-" + MergedPayload
+		path := filepath.Join(AuditOutputDir(options, group.AuditType), prefix+"-"+group.AuditType+OutputFileExtension(options))
+		msg := WriteCSVOutput(options, CSVWriteOutput{
+			Headers:     headers,
+			Desc:        desc,
+			Rows:        rows,
+			TempPath:    TempOutputPath(options, path),
+			Path:        path,
+			SplitPrefix: prefix,
+			SplitSuffix: group.AuditType,
+			Source:      strings.Join(group.Files, ","),
+		})
+		if msg != "" {
+			options.Log.Println(options.Warnbox + msg)
+			failed++
+			continue
+		}
+		if options.Verbose > 0 {
+			options.Log.Println(options.Box + "Merged " + strconv.Itoa(len(group.Files)) + " file(s) of " + group.AuditType + " of host '" + group.Hostname + "' into " + strconv.Itoa(len(rows)) + " row(s), removing " + strconv.Itoa(dupes) + " duplicate row(s).")
+		}
+		hosts[strings.ToLower(group.Hostname)] = true
+		written++
+		if len(group.Files) > 1 {
+			mergedFiles++
+		}
+		removed += dupes
+	}
+
+	options.Log.Println(options.Box + "Wrote " + strconv.Itoa(written) + " file(s) for " + strconv.Itoa(len(hosts)) + " host(s), " + strconv.Itoa(mergedFiles) + " of them merged from multiple collections. Removed " + strconv.Itoa(removed) + " duplicate row(s).")
+	if failed > 0 {
+		options.Log.Println(options.Warnbox + "ERROR - " + strconv.Itoa(failed) + " file(s) could not be merged.")
+	}
+}
@@ -17,6 +17,7 @@ import (
     "fmt"
     "io/ioutil"
     "log"
+    "net"
     "os"
     "os/user"
     "path/filepath"
@@ -55,6 +56,21 @@ func GetHelpExamples() string {
 | Extract Audits    | goauditparser -i <in_dir> -eo <out_dir>                     |
 | Extract File Acqs | goauditparser -i <in_dir> -efo <out_dir> -ep <password>     |
 | Raw Parse         | goauditparser -i <in_dir> -o <csv_dir> -raw                 |
+| Fast Parse        | goauditparser -i <in_dir> -o <csv_dir> -fast                |
+| Describe Field    | goauditparser describe <AuditType>.<Field>                  |
+| List Audit Types  | goauditparser help audits [<AuditType>]                     |
+| Shell Completion  | goauditparser completion <bash|zsh|powershell>              |
+| Verify Upgrade    | goauditparser verify -golden <golden_dir>                   |
+| Test Data         | goauditparser gen-testdata -o <out_dir> [-hosts <int>]      |
+| Verify Outputs    | goauditparser verify-outputs -o <csv_dir> [-level <str>]    |
+| Preview an Audit  | goauditparser preview -i <file> [-n <int>]                  |
+| Repeat a Run      | goauditparser rerun [-o <out_dir>] <manifest>               |
+| Merge Collections | goauditparser -o <csv_dir> -merge <out_dir>                 |
+| Background Job    | goauditparser submit -jobs <jobs_dir> <parse flags>         |
+| Job Worker        | goauditparser work -jobs <jobs_dir> [-n <int>] [-d]         |
+| List Jobs         | goauditparser jobs -jobs <jobs_dir> [-log|-cancel] [<id>]   |
+| Retention Cleanup | goauditparser -o <out_dir> -retention <int> -retention-dry  |
+| Watch & Parse     | goauditparser -i <in_dir> -o <csv_dir> -watch [-tl]         |
 +-------------------+-------------------------------------------------------------+
 `
 }
@@ -72,6 +88,9 @@ func GetHelpMenu() string {
     3) PARSE      Parse XML data to CSV                                     YES
     4) TIMELINE   Timeline CSV data into an output file                     NO, needs '-tl'
 
+# Default flags shared by everyone on an engagement, such as "-rn -tl -tlsod -t 8", can be kept in a ".gapflags" file
+#   in the input directory or the working directory. Flags on the command line override them. Flags which delete files
+#   or send data elsewhere, such as '-wo', '-y', '-notify', '-retention', and '-ep', can't be set in it.
 
 ===== [REQUIRED] =================================  ===== [NOTES] ====================================================
   -i <str>     Directory Input                      ! REQUIRED - (except when '-tlo' used)
@@ -81,6 +100,11 @@ func GetHelpMenu() string {
 
 ===== [EXTRACTING] ===============================  ==================================================================
 # Extract and rename files from triages packages (.mans), bulk data collections (.zip), and file acquisitions (.zip).
+# Multi-part archives ("<name>.part1.zip", "<name>.part2.zip", ...) are joined in order and extracted as one archive.
+# Folders of manual collections without a manifest.json, such as "<collection>/<hostname>/processes.xml", are extracted
+#   using the audit types of "Manual_Collection_Audits" in the main config.
+# Memory images (hiberfil, pagefile, raw memory) are hashed and listed in "<out_dir>/_GAPMemoryImages.json".
+# Acquired files keep their original modified/accessed times, which are listed in "<out_dir>/_GAPExtractionManifest.json".
 # The standardized naming scheme for XML files is as follows:
 #   <hostname>-<agentid>-<EXTRADATA>-<audittype>.xml
 
@@ -90,6 +114,10 @@ func GetHelpMenu() string {
                                                             if this flag is not used.
   -ep <str>    Archive Password                     Provide a password for encrypted archives.
                                                         Required to extract from file acquisition archives.
+                                                        Asked for when an encrypted archive is found without one
+                                                            if run from a terminal (unless "-y" is used).
+  -ep-file <str> Archive Password File              File of "<archive name>=<password>" lines, one per archive.
+                                                        "*=<password>" is used for archives not listed.
   -efo         Extract File Acquisitions Only       Extract acquired files from archives only, no XML audits.
                                                         Defaults '-eo' flag to "files" if not specified.
                                                         Does not parse audits if used.
@@ -104,29 +132,83 @@ func GetHelpMenu() string {
   -exf <int>   Extract XML Format                   Change how filenames for acquired files are formatted.
                                                         1: <hostname>-<agentid>-<payloadid>-<audittype>.xml  (default)
                                                         2: <hostname>-<agentid>-0-<audittype>.xml
+  -emem <int>  Extract XML To Memory                Hand XML audits up to <int> MB extracted from archives to the
+                                                        parse workers in memory, instead of writing them to the input
+                                                        directory and reading them back. Bigger ones are written to disk.
+                                                        XML audits which fail to parse are written to disk for the next run.
+                                                        Can't be used with "-eo", "-efo", "-dq", or "-pck".
+  -emem-max <int> Extract XML Memory Max            Megabytes of XML audits held in memory at once with "-emem".
+                                                        Default value is "2048". Further XML audits are written to disk.
+  -evtx        Extract EVTX To EventLogItem         Convert acquired Windows event logs (".evtx") to EventLogItem files of
+                                                        the host they were acquired from, with the columns of EventLogItem
+                                                        audits and an "EVTXFile" column of the original path. Messages
+                                                        list the event data, since message files are not acquired.
+  -eh          Extract Hashes                       Compute the MD5, SHA1, and SHA256 of every extracted acquired file while
+                                                        extracting it, and list the files with their archive, original path,
+                                                        new name, and size in "<out_dir>/_ExtractedFilesManifest.csv".
 
 ===== [SPLITTING] ================================  ==================================================================
 # Split XML files. This step is automatically included if parsing.
 
-  -xso <str>   XML Split Output Directory Only      Split XML audits into chunks. Use with '-xsb <int>' if desired.
+  -xso <str>   XML Split Output Directory Only      Split XML audits into chunks. Use with '-xsb <int>' or '-xsc <int>' if desired.
                                                         XML files are automatically split to "<inputdir>/xmlsplit/".
                                                         Does not parse audits if a different path is specified.
                                                         Appends "_spxml#" to payload of filename.
   -xsb <int>   XML Split Byte Size                  Default value is "300000000" (300 MB). Not required for '-xso'.
+  -xsc <int>   XML Split Item Count                 Also split XML audits into chunks of at most <int> items, so chunks
+                                                        take a similar time to parse. Files are split at whichever of
+                                                        '-xsb' and '-xsc' is reached first. Disabled by default.
   -ebs <str>   Event Buffer Split Output Directory  Split "eventbuffer" and "stateagentinspector" XML by event types.
                                                         Provide an output directory.
                                                         Does not parse audits if used.
 
 ===== [PARSING] ==================================  ==================================================================
 # Parse XML audit data to CSV format.
+# Debug messages of the audits, such as registry keys which were not found, are written to
+#   "<out_dir>/<hostname>-<agentid>-0-AuditDebug.csv".
 
   -o <str>     CSV Directory Output                 -REQUIRED- Parse XML to CSV. Defaults to "./parsed".
   -r           Recursive Input                      Recursively dive into directories for parsing files.
   -f           Force                                Force any previously extracted, parsed, or timelined
                                                         files to be reprocessed.
+  -prune-cache Prune Parse Cache                    Remove the parse cache entries of XML files which no longer exist in the
+                                                        input directory, then exit without parsing. Parsed files whose CSV
+                                                        output is also gone are listed. Works with "-r".
+                                                        Entries of missing XML files are also pruned before every parse.
+  -readonly-input Read-Only Input                   Never write to the input directories. Their parse cache, checkpoints, split
+                                                        XML files, and extracted archives go to "<out_dir>/_GAPInput/" instead.
+                                                        Output directories inside of the input are rejected.
+  -watch       Watch Input                          Keep running after parsing, and extract, split, and parse the new .zip,
+                                                        .mans, and .xml files which land in the input directories. Files
+                                                        are parsed once they stopped changing for "-watch-interval <int>".
+                                                        Timelines, workbooks, and observables are written again after
+                                                        each parse. Press Ctrl+C to stop.
+  -watch-interval <int> Watch Interval              Seconds between checks of the input directories. Default is 10.
+                                                        The directories are polled rather than watched for file system
+                                                        events, which are not raised on network shares for files written
+                                                        by other machines.
   -rn          Replace New-Line Chars with '|'      Useful when grepping through audits like event log messages.
-  -wo          Wipe Output Directory                Delete all files in output directory before parsing.
+  -mvs <str>   Multi-Value Separator                Join multiple values of one cell with <str> instead of a new-line
+                                                        (or '|' with "-rn"). Escapes such as "\u241F" and "\t" are accepted.
+                                                        Ex: -mvs "; "
+  -wo          Wipe Output Directory                Delete GoAuditParser output files in output directory before parsing.
+                                                        Only "<hostname>-<agentid>-<payload>-<AuditType>" files with an
+                                                        agent ID and a known audit type are deleted, others are kept.
+                                                        Per-host "-issues", "-Hits", and "-CollectionMetadata" files,
+                                                        "_GAPRunSummary.json", and "_GAPParseCache.json" are deleted too.
+                                                        Asks for confirmation unless "-y" is used.
+                                                        Deleted files are logged to "<out_dir>/_GAPWipeLog.txt".
                                                         Also enables "-f" flag for parsing/timelining only.
+  -snapshot    Snapshot Output                      Write each run into a new "<out_dir>/<yyyy-mm-dd_hhmmss>/" directory
+                                                        and point "<out_dir>/latest" at it once the run finishes.
+                                                        Earlier snapshots are never modified.
+                                                        With "-tlo", timelines "<out_dir>/latest".
+  -manifest    Record Run Manifest                  Write "<out_dir>/_GAPRunManifest.json" with the version, flags, and
+                                                        SHA256 of the configs and every input file, hashed before parsing.
+                                                        Repeat the run with "goauditparser rerun <manifest>".
+  -readme      Write Output README                  Write "<out_dir>/_README_<runid>.md" once the run finishes, describing the
+                                                        parsed files of each host and audit type, the other files, the flags
+                                                        used, and links to the timelines, for handing off the output.
   -c <str>     Configuration File                   Contains a static order of headers for parsed CSV files.
                                                         Defaults to "~/.MandiantTools/GoAuditParser/config.json".
   -pcf <int>   Parsed CSV Format                    Change how filenames for acquired files are formatted.
@@ -134,6 +216,135 @@ func GetHelpMenu() string {
                                                         2: <hostname>-<agentid>-0-<audittype>.csv
   -pah <str>   Alternate Hostname                   Overwrite Hostname to provided string.
   -paa <str>   Alternate AgentID                    Overwrite AgentID to provided string.
+  -plb <int>   Parse Line Buffer Byte Size          Maximum size of a single XML line held in memory while parsing.
+                                                        XML files are always streamed line by line.
+                                                        Default value is "20971520" (20 MB).
+  -pfw <int>   Parse File Workers                   Parse XML files over 16 MB with this many goroutines each,
+                                                        splitting them between audit items. Default value is "1".
+                                                        Multiplies with "-t", so lower "-t" when raising it.
+  -pck <int>   Parse Checkpoint Minutes             Save the progress of each XML file every <int> minutes so a crashed
+                                                        run resumes the file near where it stopped. Not used with "-pfw".
+                                                        Checkpoints are kept in "<in_dir>/_GAPCheckpoints/".
+  -pstream <int> Parse Stream Megabytes             Write the rows of XML files over <int> MB to their output file while
+                                                        parsing, holding about <int> MB of rows in memory per file instead
+                                                        of every row. A first pass over the file finds its headers.
+                                                        Streamed files are parsed by one goroutine and are not measured by
+                                                        "-pdq". Can't be used with "-pdd", "-praw", "-pck", "-plink", or "-of json".
+  -pap <str>   Parse Anomaly Policy                 How unexpected tags, unknown parser states, and lines over "-plb"
+                                                        are handled. Default value is "strict".
+                                                        strict: Fail the XML file. Use for validation runs.
+                                                        lenient: Skip the rest of the audit item, or truncate the line, and
+                                                            continue. Anomalies are listed in "<out_dir>/_GAPParseAnomalies.csv".
+  -pdesc       Parse Field Descriptions             Write a second row of field descriptions under the CSV headers.
+                                                        Use "goauditparser describe <AuditType>.<Field>" to look up fields.
+  -pdd         Parse Deduplicate Rows               Collapse identical rows of each CSV file into one with a "Count" column.
+                                                        Useful for audits like DnsEntryItem and RouteEntryItem.
+                                                        "UID" and "Sequence Number" are ignored when comparing rows.
+  -of <str>    Output Format                        Format of the parsed files, "csv" (default), "json", or "nested".
+                                                        json: Write "<hostname>-<agentid>-<payload>-<audittype>.jsonl" files
+                                                            with one flat JSON object per row keyed by the CSV headers, for
+                                                            Elasticsearch or Splunk. Multi-value cells become arrays, and columns
+                                                            of only integers or true/false are written as numbers or booleans.
+                                                            Empty values are left out. Can't be timelined.
+                                                        nested: The same as "-pjson".
+  -pjson       Parse Nested JSON                    Write "<hostname>-<agentid>-<payload>-<audittype>.jsonl" files instead of CSV
+                                                        files, with one nested JSON object per item rebuilt from the dotted
+                                                        headers. Multi-value cells become arrays, and repeated elements such as
+                                                        "CertificateChain.ChainElement" become arrays of objects.
+                                                        Empty values are left out. Can't be timelined.
+  -xlsx <str>  Excel Workbook Output                Also write the parsed files to .xlsx workbooks in "<out_dir>/xlsx/" with
+                                                        bold, frozen headers and autofilters. Cells are cut to 32k chars.
+                                                        host: "<hostname>.xlsx" with a sheet per audit type.
+                                                        audit: "<audittype>.xlsx" with a sheet per host.
+                                                        Sheets over 1mil rows continue on another sheet. Without "-i", writes
+                                                            the workbooks of the CSV files already in "-o <csv_dir>".
+  -obs <str>   Observables Export                   Also export the MD5/SHA1/SHA256 hashes, IPs, domains, URLs, and file paths
+                                                        of the parsed files, deduplicated with their hosts and audits, to
+                                                        "<out_dir>/_Observables.csv" ("csv"), "<out_dir>/_Observables_STIX.json"
+                                                        as a STIX 2.1 bundle of indicators ("stix"), or both ("csv,stix").
+                                                        Without "-i", exports the CSV files already in "-o <csv_dir>".
+  -obsa <str>  Observables Audit Types              Comma-separated audit types to export observables from, such as
+                                                        "FileItem,PortItem". Defaults to every audit type with observables.
+  -pmeta       Parse Output Metadata                Write a "<file>.meta.json" sidecar next to each parsed file with its row count,
+                                                        column count, source XML file, and SHA256. Check copied output with
+                                                        "goauditparser verify-outputs -o <csv_dir>".
+  -pprov <str> Parse Provenance                     Record the GoAuditParser version, source XML file, and generation time
+                                                        of each parsed file so it keeps its provenance outside the output
+                                                        directory. "comment" writes a "# GoAuditParser ..." line above the
+                                                        CSV headers, which GoAuditParser skips when reading the file back.
+                                                        "sidecar" writes the "<file>.meta.json" sidecar of "-pmeta".
+  -pdq         Parse Data Quality                   Write "<out_dir>/_GAPDataQuality.csv" with the empty rate, longest value,
+                                                        and timestamp normalization failures of each column of each file.
+                                                        Files with a timestamp column of which over 90% failed normalization
+                                                        are always warned about, with or without "-pdq".
+  -pcm         Parse Collection Metadata            Add "ScriptRequestTime" and "AcquisitionCompleteTime" columns to every row
+                                                        from the metadata.json of the host's triage package, which is also
+                                                        written to "<hostname>-<agentid>-<archive>-CollectionMetadata.csv".
+                                                        The times are its "req_timestamp" and "finish_time". The file is only
+                                                        written when the archive is extracted with "-pcm".
+  -pi          Parse Issues                         Parse issues files ("<issuelist>") of collection failures, which are
+                                                        otherwise ignored, into "<out_dir>/<hostname>-<agentid>-issues.csv".
+  -pnafail     Parse Non-Audit XML as Failures      Report XML files without an "<itemList>" root, such as tool exports and
+                                                        reports, as failed files. They are skipped and counted as "Skipped"
+                                                        otherwise, and the parse cache skips them on later runs.
+  -pek         Parse Event Knowledge                Add "EventSeverity", "EventCategory", and "EventDescription" columns
+                                                        to EventLogItem audits from a built-in list of event source/EIDs.
+  -ekp <str>   Event Knowledge Pack                 JSON array of {"Source","EID","Severity","Category","Description"}
+                                                        entries which extend or override the built-in list. Implies "-pek".
+  -ekf <str>   Event Knowledge Filter               Keep only EventLogItem rows of the provided categories. Implies "-pek".
+                                                        Applied when parsing and timelining. Other audits are not filtered.
+                                                        Categories: Authentication, Remote Access, Account Management,
+                                                            Process Creation, Process Exit, Service Install, Service Change,
+                                                            Scheduled Task, Log Cleared, Policy Change, PowerShell, Antivirus
+                                                        Ex: -ekf "auth,service install"
+  -notes <str> Analyst Notes File                   CSV file of "Hostname,AuditType,Match,Note" rows. The note is written to
+                                                        the "Notes" column of matching rows when parsing and timelining.
+                                                        Hostname and AuditType may be "*". Match is "*" or conditions
+                                                        joined with " && ": "<Column>=<value>" or "<Column>~<regex>".
+                                                        Ex: HOST1,ProcessItem,name=evil.exe && pid=4512,"Beacon, see ticket 42"
+  -tag <str>   Tag File                             File of IOC and keyword rules, one per line. The tags of matching rules
+                                                        are written to the "Tag" column and the columns they matched to the
+                                                        "Notes" column when parsing, and both are timelined.
+                                                        Rules are a keyword matched in any column ignoring case, a /regex/,
+                                                        "<AuditType>.<Column>=<value>", or "<AuditType>.<Column>~<regex>".
+                                                        End a rule with " => <tag>" to name its tag. '#' starts a comment.
+                                                        End the tag with " [<id>]" to name the rule ID, "L<line>" otherwise.
+                                                        Tags are written as "<tag> [<rule IDs>]" joined with " || ", and the
+                                                            hits of each rule to "<out_dir>/_GAPTagRuleHits.csv".
+                                                        Start a rule with "i/" to ignore case in regexes, "c/" to match case,
+                                                            or "a/" to ignore accents such as "é", combined like "ia/".
+                                                        Ex: FileItem.Md5sum=e2fc714c4727ee9395f324cd2e7f331f => APT Dropper [IOC-1042]
+  -praw        Parse Raw XML of Noted Rows          Add a "RawXML" column with the original XML of the audit item to rows which
+                                                        got a note from '-notes' or '-tag', so reviewers see exactly what the agent
+                                                        reported. The column is empty for other rows.
+  -phits       Parse Indicator Hits                 Write the "hits" of eventbuffer events to "<hostname>-<agentid>-<payload>-
+                                                        EventItem_Hits.csv" with one row per hit linking the event UID to
+                                                        its indicator GUID, and add a "HitCount" column to the event rows.
+                                                        The hits of all event files of a host, with the event type, sequence
+                                                        number, and timestamp, are also written to "<hostname>-<agentid>-
+                                                        Hits.csv" sorted by time, so IOC hits can be reviewed separately.
+  -phcap <int> Parse Hits Cap                       Keep only the first <int> hits in the "Extra" cells of event rows, for
+                                                        events which hit hundreds of indicators. Adds the "HitCount" column.
+                                                        Use with "-phits" to keep every hit.
+  -plink       Parse Link Keys                      Add a "ProcessKey" column ("<hostname>|<pid>|<start time>") to ProcessItem
+                                                        and eventbuffer rows, so processes join with the network, file, and
+                                                        other events they caused across CSV files. Events use the latest
+                                                        ProcessEvent of their pid in the same eventbuffer that started
+                                                        before them, and get an empty key without one.
+  -al <str>    Allowlist Files                      Comma delimited files of known-good MD5s, SHA256s, and paths, one per
+                                                        line. Paths ignore case and may end in "*". Rows whose hashes are
+                                                        all allowlisted, or without hashes whose file paths all are, get
+                                                        "Suppressed" set to "true". Inventory CSV exports can be used as is.
+  -ala <str>   Allowlist Audits                     Audits checked with '-al' as "<AuditType>[=mark|exclude]". "exclude"
+                                                        drops the rows instead of marking them.
+                                                        Defaults to "FileItem,PersistenceItem,EventItem_ProcessEvent".
+                                                        Ex: -ala "FileItem=exclude,PersistenceItem"
+  -redact <str> Redaction Config                    JSON file of rules hashing or masking values such as usernames, hostnames,
+                                                        and IPs while parsing, to share parsed files without client identities.
+                                                        Hashed values get consistent pseudonyms like "user-1a2b3c4d5e", listed
+                                                        with their original values in "<out_dir>_GAPRedactionMap.csv" next
+                                                        to the output directory, so it is not shared with it.
+                                                        Rules redacting "Hostname" also redact output file names.
 
 ===== [TIMELINING] ===============================  ==================================================================
 # Convert parsed CSV audit data in the output directory into a timeline.
@@ -144,8 +355,28 @@ func GetHelpMenu() string {
   -tlo         Timeline Only (don't parse)          Only perform timelining with specified CSV directory.
                                                         Needs output CSV directory specified with "-o <csv_dir>".
                                                         Does NOT need an input XML directory specified.
+                                                        Comma delimited CSV directories are timelined together
+                                                        with a "Case" column, e.g. "-o caseA/parsed,caseB/parsed".
   -tld         Timeline Deduplicate                 Deduplicate timeline lines by entire row.
+  -tlstream    Timeline Stream (low memory)         Spill timeline rows to sorted JSON Lines shards in the output directory
+                                                        and merge them into the timeline instead of holding every row in memory.
+                                                        With "-tld", duplicates are dropped without re-sorting the timeline.
+  -tlmem <int> Timeline Memory Budget               Spill timeline rows with "-tlstream" once they take up about <int> MB
+                                                        of memory instead of every 100,000 rows. Large shard counts are
+                                                        merged in passes of 64 shards. Implies "-tlstream".
+  -tlmmap      Timeline Memory-Mapped Reading       Read parsed CSV files through memory-mapped I/O instead of file reads.
+                                                        Can be faster on multi-GB output directories. Not used on Windows.
+  -tlbucket <str> Timeline Bucket                   Truncate timestamps to "1m", "1h", or any "<int><s|m|h|d>" and merge
+                                                        the events of each bucket with the same summary into one row.
+                                                        Adds "Exact Timestamp" (first - last) and "Count" columns.
+                                                        Ex: -tlbucket 1h
   -tlout <str> Timeline Output Filepath             Defaults to "<csv_dir>/_Timeline_<DATE>_<TIME>.csv".
+                                                        Multiple CSV directories default to "./_Timeline_Cases_<DATE>_<TIME>.csv".
+  -tlfmt <str> Timeline Format                      Write the timeline as "csv", "jsonl" (one JSON object per row), or
+                                                        "sqlite" (a "timeline" table with an indexed timestamp column).
+                                                        JSON Lines and SQLite timelines are never split at 1mil rows.
+                                                        "sqlite" needs GoAuditParser built with "-tags sqlite".
+                                                        Defaults to "csv". The default file extension follows the format.
   -tlf <str>   Timeline Filter                      Include only events which match the provided filter(s).
                                                         Time Filter formats:
                                                             "YYYY-MM-DD HH:MM:SS - YYYY-MM-DD HH:MM:SS"
@@ -154,8 +385,70 @@ func GetHelpMenu() string {
                                                             "YYYY-MM-DD +-5m"
                                                         Can provide multiple comma delimited filters:
                                                             Ex: -tlf "2019-01-01 - 2020-01-01,2015-01-01 +-3d"
+  -tlhost <str> Timeline Host Filter                Timeline only the parsed files of the provided hostname(s).
+                                                        Can provide multiple comma delimited hostnames, "*" and "?" wildcards
+                                                        are supported and case is ignored.
+                                                            Ex: -tlhost "WKS-0*,DC01"
+  -tlagent <str> Timeline Agent ID Filter           Timeline only the parsed files of the provided agent ID(s).
+                                                        Can provide multiple comma delimited agent IDs with wildcards.
+  -tlaudit <str> Timeline Audit Type Filter         Timeline only the parsed files of the provided audit type(s).
+                                                        Can provide multiple comma delimited audit types with wildcards.
+                                                            Ex: -tlaudit "FileItem,EventLogItem,EventItem_*"
   -tlsod       Output IIMS/SOD format               Overwrites default timeline config to match IIMS/SOD format.
+  -tlsodprev <str> Prior SOD Export                 Compare the "-tlsod" timeline to prior SOD exports, comma delimited, and
+                                                        add a "Row Status" column of "New", "Existing", or "Changed: <columns>",
+                                                        so only new rows need to be pasted into a living SOD document. Rows
+                                                        match by timestamp, description, hostname, and event description,
+                                                        and existing rows keep their "Date Added". Keep the timestamps as text
+                                                        when saving the export from Excel.
   -tlcf <str>  Timeline Config Filepath             Defaults to "~/.MandiantTools/GoAuditParser/timeline.json".
+  -validate    Validate Timeline Config             Check the timeline config against 'Audit_Header_Configs' of the main
+                                                        config and the headers of the parsed CSV files in '-o <dir>', listing
+                                                        Timestamp_Fields, Summary_Fields, and Extra_Fields no audit has,
+                                                        and Filename_Suffix values which match no audit. Exits with 1 if any
+                                                        are found. Use with '-tlcf <str>' to check another timeline config.
+  -ekf <str>   Event Knowledge Filter               Timeline only EventLogItem rows of the provided categories.
+                                                        Works on CSV files parsed without "-pek".
+  -notes <str> Analyst Notes File                   Add the notes of matching rows to the "Notes" column of the timeline.
+  -tlverify <int> Timeline Verify                   Sample <int> random timeline rows and re-locate them in the source
+                                                        CSV files by Source, Timestamp, and Summary fields. Reports mismatches.
+  -tlanom      Timeline Anomalies                   Count the events of each host per hour and write unusual spikes, gaps
+                                                        of 24+ silent hours, and log clearing (such as EID 1102) to
+                                                        "<timeline>_Anomalies.csv" next to the timeline.
+
+===== [MERGING] ==================================  ==================================================================
+# Merge the parsed CSV files of hosts which were collected more than once into one CSV file per host and audit type.
+
+  -merge <str> Merge Output Directory               Merge the parsed CSV files of "-o <csv_dir>" by hostname and audit type
+                                                        into "<str>/<hostname>-<agentid>-merged-<audittype>.csv".
+                                                        Rows found in more than one collection are kept once, with the newest
+                                                        "FireEyeGeneratedTime". "AgentID", "UID", "Sequence Number", and the
+                                                        "-pcm" columns are ignored when comparing rows.
+                                                        Does not parse audits. Does NOT need an input XML directory specified.
+
+===== [VERIFYING] ================================  ==================================================================
+# Check a new version against the output of a trusted version with "goauditparser verify -golden <golden_dir>".
+# Reference XML audits go in "<golden_dir>/input/" and the CSV files of the trusted version in "<golden_dir>/expected/".
+
+  -golden <str> Golden Directory                    Parse the reference audits into a temporary directory and report
+                                                        missing, unexpected, and differing CSV files. Columns are matched
+                                                        by header and rows are compared in any order.
+                                                        Use the parse flags the golden copy was made with, such as "-rn".
+                                                        Exits with code 1 if the output differs.
+  -gu          Golden Update                        Replace the golden CSV files with the output of this version.
+  -gro         Golden Row Order                     Also report rows which moved.
+
+===== [RETENTION] ================================  ==================================================================
+# Delete parsed output older than the evidence retention policy from the output directories of a shared processing server.
+
+  -retention <int> Retention Days                   Delete GoAuditParser output files last modified more than <int> days ago
+                                                        from "-o <dir>", or else from every "Retention_Roots" directory of the
+                                                        main config, including snapshots, routes, and workbook subdirectories.
+                                                        Files not matching GoAuditParser naming are kept, and directories left
+                                                        empty are removed. Asks for confirmation unless "-y" is used.
+                                                        Deleted files are logged to "<dir>/_GAPRetentionLog.txt".
+                                                        Does not parse audits. Does NOT need an input XML directory specified.
+  -retention-dry Retention Dry Run                  List the files "-retention <int>" would delete without deleting them.
 
 ===== [OTHER] ====================================  =================================================================
   -c <str>     Configuration File                   Defaults to "~/.MandiantTools/GoAuditParser/config.json".
@@ -163,7 +456,48 @@ func GetHelpMenu() string {
                                                         1. Truncating cells to 32k chars
                                                         2. Split CSV files by 1mil rows
                                                             Appends "_spcsv#" to payload of filename.
+  -fast        Fast Mode                            Output for programmatic processing rather than Excel. Implies "-raw" and
+                                                        disables "-rn" and timestamp normalization, leaving raw values
+                                                        such as "2019-12-19T11:11:45.299Z". Timestamps are still
+                                                        normalized when timelining since the timeliner expects them.
   -t <int>     Thread Count                         Defaults to number of existing CPUs.
+                                                        Also the number of CSV files timelined at once.
+  -tw <int>    CSV Writer Thread Count              Threads writing parsed CSV files while parsing continues. Defaults to "1".
+                                                        Use "0" to write CSV files from the parsing threads instead.
+  -hg <int>    Host Grouping                        Parse the audits of at most <int> hosts at once, so each host's CSV
+                                                        files are complete before the next hosts start. "1" finishes one
+                                                        host at a time. Disabled by default, which parses files in any order.
+  -hs          Short Hostnames                      Strip the domain from FQDN hostnames ("host.corp.local" -> "host").
+                                                        Applied when parsing and timelining.
+                                                        The original hostname is kept in the "OriginalHostname" column.
+  -hl          Lowercase Hostnames                  Lowercase all hostnames. Applied when parsing and timelining.
+                                                        The original hostname is kept in the "OriginalHostname" column.
+  -y           Assume Yes                           Skip confirmation prompts such as the ones for "-wo" and deleting incomplete files.
+  -progress <int> Progress File Seconds             Rewrite "<out_dir>/_GAPProgress.json" every <int> seconds with the stage,
+                                                        files done/total, current files, and ETA of the run, for dashboards
+                                                        and automation to poll. Its "status" is "finished" once the run ends.
+  -log <str>   Log Format                           Copy the output of the run to stderr or "-logfile" as "text", or as
+                                                        "json" events (run/stage/file started and finished, file parsed/failed,
+                                                        statistics, messages), one JSON object per line, for pipelines to read.
+  -logfile <file> Log File                          Append the "-log" log to <file> instead of stderr. Defaults "-log" to "text".
+  -notify <str> Notify When Finished                Comma delimited webhook URLs and "mailto:<address>" targets told when the
+                                                        run finishes, with its statistics and output paths. Slack incoming
+                                                        webhook URLs get a text message, other URLs a POST of the JSON summary.
+  -notify-smtp <str> Notify Mail Server             "<host>:<port>" of the mail server for "mailto:" targets. Set GAP_SMTP_USER
+                                                        and GAP_SMTP_PASSWORD to log in, and GAP_SMTP_FROM for the sender.
+  -notify-host Notify Each Host                     Also notify as the audits of each host finish parsing with '-hg <int>'.
+  -dq <str>    Distributed Queue Directory          Share work with other GoAuditParser instances using a directory
+                                                        all machines can access. Each archive/XML file is claimed by one
+                                                        worker, and worker parse caches are merged when each finishes.
+                                                        Failed files are released for other workers to retry, and files
+                                                        of a worker which stopped are taken over after 60 seconds.
+  -dqid <str>  Distributed Worker ID                Defaults to "<hostname>_<pid>".
+  -perm <str>  Output File Permissions              Octal permissions for every file written, such as "0640".
+                                                        Defaults to "Output_Permissions.File" in the main config.
+  -dirperm <str> Output Directory Permissions       Octal permissions for every directory created, such as "0750".
+                                                        Defaults to "Output_Permissions.Directory" in the main config.
+  -group <str> Output Group                         Group name or ID given to every file and directory written.
+                                                        Defaults to "Output_Permissions.Group" in the main config.
   -v[vvv]      Verbose
   -min         Minimized Output Mode
   --help       Show this Help Menu
@@ -180,35 +514,146 @@ type Options struct {
     ForceReparse        bool
     ParseAltHostname    string
     ParseAltAgentID     string
+    AgentIDs            *AgentIDs
     ExcelFriendly       bool
+    FastMode            bool
+    ParseRawTimestamps  bool
     MinimizedOutput     bool
     Threads             int
+    WriterThreads       int
+    HostGroups          int
     Timeline            bool
     TimelineOutputFile  string
     TimelineOnly        bool
     TimelineSOD         bool
+    TimelineSODPrevious string
+    TimelineSODDiff     *SODDiff
     TimelineFilter      string
     TimelineFilters     [][]time.Time
     TimelineFilterEmpty bool
+    TimelineHosts       string
+    TimelineAgents      string
+    TimelineAudits      string
+    TimelineSources     TimelineSourceFilter
     TimelineConfigFile  string
+    MergeOutputDir      string
     TimelineDeduplicate bool
+    TimelineStream      bool
+    TimelineMemoryMB    int
+    TimelineMmap        bool
+    TimelineBucket      string
+    TimelineBucketSize  time.Duration
+    TimelineFormat      string
+    TimelineVerify      int
+    TimelineAnomalies   bool
     EventBufferSplitDir string
     WipeOutput          bool
+    Snapshot            bool
+    WriteRunManifest    bool
+    RunManifest         *RunManifest
+    WriteRunReadme      bool
+    RunReadme           *RunReadme
+    AssumeYes           bool
+    ProgressSeconds     int
+    Progress            *RunProgress
+    LogFormat           string
+    LogFile             string
+    Log                 *RunLog
+    NotifyTargets       string
+    NotifySMTP          string
+    NotifyHosts         bool
+    Notifier            *RunNotifier
+    DistributedQueueDir string
+    DistributedWorkerID string
+    DistributedClaims   *DistributedClaims
+    GoldenDir           string
+    GoldenUpdate        bool
+    GoldenRowOrder      bool
     Help                bool
     AlternateParse      bool
     XMLSplitOutputDir   string
     XMLSplitByteSize    int
+    XMLSplitItemCount   int
     RemoveNewlines      string
     ExtractionPassword  string
+    ExtractionPasswordFile string
+    ExtractionPasswords map[string]string
     ExtractionOutputDir string
     ExtractFilesOnly    bool
     ExtractFileFormat   int
     ExtractXMLFormat    int
+    ExtractMemoryMB     int
+    ExtractMemoryMaxMB  int
+    ExtractEVTX         bool
+    ExtractHashes       bool
+    MemoryPayloads      *MemoryPayloads
     ParseCSVFormat      int
+    ParseLineBufferSize int
+    ParseFileWorkers    int
+    ParseCheckpointMinutes int
+    ParseStreamMB       int
+    ParseAnomalyPolicy  string
+    ParseAnomalyLog     *ParseAnomalyLog
+    AuditDebugLog       *AuditDebugLog
+    ParseIssues         bool
+    ParseNonAuditFail   bool
+    IssuesLog           *IssuesLog
+    HitsLog             *HitsLog
+    PruneCache          bool
+    RetentionDays       int
+    RetentionDryRun     bool
+    RetentionRoots      []string
+    Validate            bool
+    Watch               bool
+    WatchIntervalSeconds int
+    ReadOnlyInput       bool
+    InputScratchRoot    string
+    ParseFieldDescriptions bool
+    ParseDeduplicate    bool
+    ParseNestedJSON     bool
+    OutputFormat        string
+    XLSXMode            string
+    ObservablesFormat   string
+    ObservablesAudits   string
+    ParseInMemory       bool
+    ParseOutputMeta     bool
+    ParseProvenance     string
+    ParseDataQuality    bool
+    DataQualityLog      *DataQualityLog
+    ParseCollectionMetadata bool
+    CollectionMetadata  map[string][]CollectionMetadata
+    EventKnowledge      bool
+    EventKnowledgePackFile string
+    EventKnowledgeFilter string
+    EventKnowledgePack  map[string]EventKnowledge
+    AnalystNotesFile    string
+    ParseRawXML         bool
+    ParseHits           bool
+    ParseHitsCap        int
+    ParseLinkKeys       bool
+    AllowlistFiles      string
+    AllowlistAudits     string
+    Allowlist           *Allowlist
+    AnalystNotes        []AnalystNote
+    TagFile             string
+    TagRules            []TagRule
+    TagRuleHits         *TagRuleHitLog
+    RedactConfig        string
+    Redaction           *Redaction
+    MultiValueSeparator string
     SubTaskFiles        []os.FileInfo
     Recursive           bool
+    HostnameShort       bool
+    HostnameLowercase   bool
+    FilePermissions     string
+    DirPermissions      string
+    OutputGroup         string
+    FileMode            os.FileMode
+    DirMode             os.FileMode
+    OutputGroupID       string
 
     Verbose int
+    RunID   string //Names the temp files of this run
 
     Box     string
     Warnbox string
@@ -238,28 +683,107 @@ func Setup() Options {
     flag.BoolVar(&options.ReplaceNewLineFeeds, "rn", false, "")
     flag.BoolVar(&options.ForceReparse, "f", false, "")
     flag.BoolVar(&raw, "raw", false, "")
+    flag.BoolVar(&options.FastMode, "fast", false, "")
     flag.BoolVar(&options.MinimizedOutput, "min", false, "")
     flag.IntVar(&options.Threads, "t", -1, "")
+    flag.IntVar(&options.WriterThreads, "tw", 1, "")
+    flag.IntVar(&options.HostGroups, "hg", 0, "")
     flag.BoolVar(&options.Timeline, "tl", false, "")
     flag.BoolVar(&options.TimelineDeduplicate, "tld", false, "")
+    flag.BoolVar(&options.TimelineStream, "tlstream", false, "")
+    flag.IntVar(&options.TimelineMemoryMB, "tlmem", 0, "")
+    flag.BoolVar(&options.TimelineMmap, "tlmmap", false, "")
+    flag.StringVar(&options.TimelineBucket, "tlbucket", "", "")
+    flag.StringVar(&options.TimelineFormat, "tlfmt", TimelineFormatCSV, "")
     flag.BoolVar(&options.TimelineSOD, "tlsod", false, "")
+    flag.StringVar(&options.TimelineSODPrevious, "tlsodprev", "", "")
     flag.BoolVar(&options.TimelineOnly, "tlo", false, "")
     flag.StringVar(&options.TimelineOutputFile, "tlout", "", "")
     flag.StringVar(&options.TimelineFilter, "tlf", "", "")
+    flag.StringVar(&options.TimelineHosts, "tlhost", "", "")
+    flag.StringVar(&options.TimelineAgents, "tlagent", "", "")
+    flag.StringVar(&options.TimelineAudits, "tlaudit", "", "")
     flag.StringVar(&options.TimelineConfigFile, "tlcf", "", "")
+    flag.StringVar(&options.MergeOutputDir, "merge", "", "")
+    flag.IntVar(&options.TimelineVerify, "tlverify", 0, "")
+    flag.BoolVar(&options.TimelineAnomalies, "tlanom", false, "")
     flag.StringVar(&options.EventBufferSplitDir, "ebs", "", "")
     flag.BoolVar(&options.WipeOutput, "wo", false, "")
+    flag.BoolVar(&options.WriteRunManifest, "manifest", false, "")
+    flag.BoolVar(&options.WriteRunReadme, "readme", false, "")
+    flag.BoolVar(&options.Snapshot, "snapshot", false, "")
+    flag.BoolVar(&options.AssumeYes, "y", false, "")
+    flag.IntVar(&options.ProgressSeconds, "progress", 0, "")
+    flag.StringVar(&options.NotifyTargets, "notify", "", "")
+    flag.StringVar(&options.NotifySMTP, "notify-smtp", "", "")
+    flag.BoolVar(&options.NotifyHosts, "notify-host", false, "")
+    flag.StringVar(&options.LogFormat, "log", "", "")
+    flag.StringVar(&options.LogFile, "logfile", "", "")
+    flag.StringVar(&options.DistributedQueueDir, "dq", "", "")
+    flag.StringVar(&options.DistributedWorkerID, "dqid", "", "")
+    flag.StringVar(&options.GoldenDir, "golden", "", "")
+    flag.BoolVar(&options.GoldenUpdate, "gu", false, "")
+    flag.BoolVar(&options.GoldenRowOrder, "gro", false, "")
     flag.StringVar(&options.XMLSplitOutputDir, "xso", "", "")
     flag.StringVar(&options.ExtractionOutputDir, "eo", "", "")
     flag.BoolVar(&options.ExtractFilesOnly, "efo", false, "")
     flag.StringVar(&options.ExtractionPassword, "ep", "", "")
+    flag.StringVar(&options.ExtractionPasswordFile, "ep-file", "", "")
     flag.IntVar(&options.ExtractFileFormat, "eff", 1, "")
     flag.IntVar(&options.ExtractXMLFormat, "exf", 1, "")
+    flag.IntVar(&options.ExtractMemoryMB, "emem", 0, "")
+    flag.IntVar(&options.ExtractMemoryMaxMB, "emem-max", MemoryPayloadsDefaultMaxMB, "")
+    flag.BoolVar(&options.ExtractEVTX, "evtx", false, "")
+    flag.BoolVar(&options.ExtractHashes, "eh", false, "")
     flag.IntVar(&options.ParseCSVFormat, "pcf", 1, "")
     flag.IntVar(&options.XMLSplitByteSize, "xsb", 300000000, "")
+    flag.IntVar(&options.XMLSplitItemCount, "xsc", 0, "")
     flag.StringVar(&options.ParseAltHostname, "pah", "", "")
     flag.StringVar(&options.ParseAltAgentID, "paa", "", "")
+    flag.IntVar(&options.ParseLineBufferSize, "plb", 1024*1024*20, "")
+    flag.IntVar(&options.ParseFileWorkers, "pfw", 1, "")
+    flag.IntVar(&options.ParseCheckpointMinutes, "pck", 0, "")
+    flag.IntVar(&options.ParseStreamMB, "pstream", 0, "")
+    flag.StringVar(&options.ParseAnomalyPolicy, "pap", ParseAnomalyPolicyStrict, "")
+    flag.BoolVar(&options.PruneCache, "prune-cache", false, "")
+    flag.IntVar(&options.RetentionDays, "retention", 0, "")
+    flag.BoolVar(&options.RetentionDryRun, "retention-dry", false, "")
+    flag.BoolVar(&options.Validate, "validate", false, "")
+    flag.BoolVar(&options.Watch, "watch", false, "")
+    flag.IntVar(&options.WatchIntervalSeconds, "watch-interval", WatchDefaultIntervalSeconds, "")
+    flag.BoolVar(&options.ReadOnlyInput, "readonly-input", false, "")
+    flag.BoolVar(&options.ParseFieldDescriptions, "pdesc", false, "")
+    flag.BoolVar(&options.ParseDeduplicate, "pdd", false, "")
+    flag.BoolVar(&options.ParseNestedJSON, "pjson", false, "")
+    flag.StringVar(&options.OutputFormat, "of", OutputFormatCSV, "")
+    flag.StringVar(&options.XLSXMode, "xlsx", "", "")
+    flag.StringVar(&options.ObservablesFormat, "obs", "", "")
+    flag.StringVar(&options.ObservablesAudits, "obsa", "", "")
+    flag.BoolVar(&options.ParseOutputMeta, "pmeta", false, "")
+    flag.StringVar(&options.ParseProvenance, "pprov", "", "")
+    flag.BoolVar(&options.ParseDataQuality, "pdq", false, "")
+    flag.BoolVar(&options.ParseCollectionMetadata, "pcm", false, "")
+    flag.BoolVar(&options.ParseIssues, "pi", false, "")
+    flag.BoolVar(&options.ParseNonAuditFail, "pnafail", false, "")
+    flag.BoolVar(&options.EventKnowledge, "pek", false, "")
+    flag.StringVar(&options.EventKnowledgePackFile, "ekp", "", "")
+    flag.StringVar(&options.EventKnowledgeFilter, "ekf", "", "")
+    flag.StringVar(&options.AnalystNotesFile, "notes", "", "")
+    flag.StringVar(&options.TagFile, "tag", "", "")
+    flag.BoolVar(&options.ParseRawXML, "praw", false, "")
+    flag.BoolVar(&options.ParseHits, "phits", false, "")
+    flag.IntVar(&options.ParseHitsCap, "phcap", 0, "")
+    flag.BoolVar(&options.ParseLinkKeys, "plink", false, "")
+    flag.StringVar(&options.AllowlistFiles, "al", "", "")
+    flag.StringVar(&options.AllowlistAudits, "ala", "", "")
+    flag.StringVar(&options.RedactConfig, "redact", "", "")
+    flag.StringVar(&options.MultiValueSeparator, "mvs", "", "")
     flag.BoolVar(&options.Recursive, "r", false, "")
+    flag.BoolVar(&options.HostnameShort, "hs", false, "")
+    flag.BoolVar(&options.HostnameLowercase, "hl", false, "")
+    flag.StringVar(&options.FilePermissions, "perm", "", "")
+    flag.StringVar(&options.DirPermissions, "dirperm", "", "")
+    flag.StringVar(&options.OutputGroup, "group", "", "")
 
     flag.BoolVar(&v1, "v", false, "")
     flag.BoolVar(&v2, "vv", false, "")
@@ -268,6 +792,36 @@ func Setup() Options {
 
     flag.Parse()
 
+    //Default flags of the engagement from ".gapflags", overridden by the command line
+    //Golden verification runs only use the flags they are given
+    //The file and the flags it set are printed on every run, as the file is easily forgotten or unnoticed
+    flagFile, flagFileNotice := "", ""
+    fileFlags := map[string]bool{}
+    if path := FindFlagFile(options.InputPath); path != "" && options.GoldenDir == "" {
+        if abs, err_a := filepath.Abs(path); err_a == nil {
+            path = abs
+        }
+        args, err_r := ReadFlagFile(path)
+        if err_r == nil {
+            fileFlags, err_r = ApplyFlagFile(args)
+        }
+        if err_r != nil {
+            fmt.Println("[!] ERROR - Could not apply default flags file '" + path + "'. " + err_r.Error())
+            os.Exit(FlagConflictExitCode)
+        }
+        flagFile = path
+        flagFileNotice = "Using default flags '" + strings.Join(args, " ") + "' from '" + path + "'."
+        overridden := []string{}
+        flag.Visit(func(f *flag.Flag) {
+            if fileFlags[f.Name] {
+                overridden = append(overridden, "-"+f.Name)
+            }
+        })
+        if len(overridden) > 0 {
+            flagFileNotice += " Overridden on the command line: " + strings.Join(overridden, " ")
+        }
+    }
+
     //Update some flags based on other flags
     options.Verbose = 0
     if v1 {
@@ -283,6 +837,14 @@ func Setup() Options {
         options.Verbose = 4
     }
     options.ExcelFriendly = !raw
+    options.RunID = NewRunID()
+    options.AuditDebugLog = &AuditDebugLog{}
+    if options.ParseIssues {
+        options.IssuesLog = &IssuesLog{}
+    }
+    if options.ParseHits {
+        options.HitsLog = &HitsLog{}
+    }
     if options.ExtractFilesOnly && options.ExtractionOutputDir == "" {
         options.ExtractionOutputDir = "files"
     }
@@ -292,24 +854,212 @@ func Setup() Options {
     if options.ExtractXMLFormat <= 0 || options.ExtractXMLFormat >= 3 {
         options.ExtractXMLFormat = 1
     }
+    if options.ExtractMemoryMB > 0 {
+        options.MemoryPayloads = NewMemoryPayloads(options.ExtractMemoryMB, options.ExtractMemoryMaxMB)
+    }
     if options.ParseCSVFormat <= 0 || options.ParseCSVFormat >= 3 {
         options.ParseCSVFormat = 1
     }
+    if options.ParseLineBufferSize <= 0 {
+        options.ParseLineBufferSize = 1024 * 1024 * 20
+    }
 
-    if options.TimelineSOD {
+    if options.TimelineMemoryMB > 0 {
+        options.TimelineStream = true
+    }
+    if options.TimelineSOD || options.TimelineVerify > 0 || options.TimelineStream || options.TimelineAnomalies {
         options.Timeline = true
     }
+    options.ParseProvenance = strings.ToLower(strings.TrimSpace(options.ParseProvenance))
+    if options.ParseProvenance == ProvenanceSidecar {
+        options.ParseOutputMeta = true
+    }
+    //JSON is not opened in Excel, so values are not truncated and files are not split
+    options.OutputFormat = strings.ToLower(strings.TrimSpace(options.OutputFormat))
+    if options.ParseNestedJSON || options.OutputFormat != OutputFormatCSV {
+        options.ExcelFriendly = false
+    }
+    if options.FastMode {
+        options.ExcelFriendly = false
+        options.ReplaceNewLineFeeds = false
+        options.ParseRawTimestamps = !options.Timeline && !options.TimelineOnly
+    }
 
     options.Box = "[+] "
     options.Warnbox = "[!] "
     if options.MinimizedOutput {
         options.Box = "[#] "
     }
+    var err_l error
+    if options.Log, err_l = NewRunLog(options); err_l != nil {
+        if flagFileNotice != "" {
+            options.Log.Println(options.Box + flagFileNotice)
+        }
+        options.Log.Println(options.Warnbox + "ERROR - Could not open the log. " + err_l.Error())
+        options.ErrorDuringSetup = true
+        return options
+    }
     if !options.MinimizedOutput {
         fmt.Println(GetASCIIArt())
     } else {
-        fmt.Println(options.Box + "- GoAuditParser v" + version + " -")
-        fmt.Println(options.Box + "Copyright (C) 2020, FireEye, Inc.")
+        options.Log.Println(options.Box + "- GoAuditParser v" + version + " -")
+        options.Log.Println(options.Box + "Copyright (C) 2020, FireEye, Inc.")
+    }
+
+    if flagFileNotice != "" {
+        options.Log.Println(options.Box + flagFileNotice)
+    }
+
+    //Fail fast on flags which can't work together instead of doing part of the work
+    setFlags := fileFlags
+    flag.Visit(func(f *flag.Flag) {
+        setFlags[f.Name] = true
+    })
+    if conflicts := ValidateFlags(options, setFlags, flag.Args()); len(conflicts) > 0 {
+        for _, msg := range conflicts {
+            options.Log.Println(options.Warnbox + "ERROR - " + msg)
+        }
+        options.Log.Println(options.Warnbox + "Use '--help' to see the available flags.")
+        os.Exit(FlagConflictExitCode)
+    }
+    //With '-tlo', '-i <csv_dir>' is accepted in place of '-o <csv_dir>'
+    if options.TimelineOnly && setFlags["i"] && !setFlags["o"] {
+        options.OutputPath = options.InputPath
+    }
+    //The parse cache, split XML files, and extracted archives are kept out of read-only input directories
+    if options.ReadOnlyInput {
+        options.InputScratchRoot = filepath.Join(options.OutputPath, InputScratchDirName)
+    }
+
+    //Distributed processing
+    if options.DistributedQueueDir != "" {
+        if options.DistributedWorkerID == "" {
+            hostname, _ := os.Hostname()
+            options.DistributedWorkerID = hostname + "_" + strconv.Itoa(os.Getpid())
+        }
+        options.DistributedClaims = NewDistributedClaims()
+        if options.Timeline && !options.TimelineOnly {
+            options.Log.Println(options.Warnbox + "NOTICE - Timelining is disabled with '-dq <dir>'. Run '-tlo' once all workers have finished.")
+            options.Timeline = false
+        }
+        if options.Verbose > 0 {
+            options.Log.Println(options.Box + "Distributed worker '" + options.DistributedWorkerID + "' using queue directory '" + options.DistributedQueueDir + "'.")
+        }
+    }
+
+    //Multi-value separator may contain escapes such as "\u241F"
+    if options.MultiValueSeparator != "" {
+        separator, err_u := strconv.Unquote(`"` + strings.ReplaceAll(options.MultiValueSeparator, `"`, `\"`) + `"`)
+        if err_u != nil {
+            options.Log.Println(options.Warnbox + "ERROR - Could not read multi-value separator '" + options.MultiValueSeparator + "'. " + err_u.Error())
+            options.ErrorDuringSetup = true
+            return options
+        }
+        options.MultiValueSeparator = separator
+    }
+
+    //Anomaly policy, lenient runs collect the anomalies of every file for "_GAPParseAnomalies.csv"
+    options.ParseAnomalyPolicy = strings.ToLower(strings.TrimSpace(options.ParseAnomalyPolicy))
+    switch options.ParseAnomalyPolicy {
+    case ParseAnomalyPolicyStrict:
+    case ParseAnomalyPolicyLenient:
+        options.ParseAnomalyLog = &ParseAnomalyLog{}
+    default:
+        options.Log.Println(options.Warnbox + "ERROR - Could not read parse anomaly policy '" + options.ParseAnomalyPolicy + "', expected 'strict' or 'lenient'.")
+        options.ErrorDuringSetup = true
+        return options
+    }
+
+    //Workbooks of the parsed files, one per host or one per audit type
+    if options.XLSXMode != "" {
+        options.XLSXMode = strings.ToLower(strings.TrimSpace(options.XLSXMode))
+        if options.XLSXMode != XLSXByHost && options.XLSXMode != XLSXByAudit {
+            options.Log.Println(options.Warnbox + "ERROR - Could not read workbook mode '" + options.XLSXMode + "', expected 'host' or 'audit'.")
+            options.ErrorDuringSetup = true
+            return options
+        }
+    }
+
+    //Observables export formats
+    if options.ObservablesFormat != "" {
+        options.ObservablesFormat = strings.ToLower(strings.ReplaceAll(options.ObservablesFormat, " ", ""))
+        for _, format := range strings.Split(options.ObservablesFormat, ",") {
+            if format != ObservablesFormatCSV && format != ObservablesFormatSTIX {
+                options.Log.Println(options.Warnbox + "ERROR - Could not read observables format '" + format + "', expected 'csv', 'stix', or 'csv,stix'.")
+                options.ErrorDuringSetup = true
+                return options
+            }
+        }
+    }
+
+    //Output format, '-pjson' is the same as '-of nested'
+    if options.ParseNestedJSON {
+        options.OutputFormat = OutputFormatNested
+    }
+    if _, known := outputFormats[options.OutputFormat]; !known {
+        options.Log.Println(options.Warnbox + "ERROR - Could not read output format '" + options.OutputFormat + "', expected '" + strings.Join(OutputFormatNames(), "', '") + "'.")
+        options.ErrorDuringSetup = true
+        return options
+    }
+
+    //Column metrics of every parsed file for "_GAPDataQuality.csv"
+    if options.ParseDataQuality {
+        options.DataQualityLog = &DataQualityLog{}
+    }
+
+    if options.ProgressSeconds < 0 {
+        options.Log.Println(options.Warnbox + "ERROR - Could not use progress file interval '" + strconv.Itoa(options.ProgressSeconds) + "', expected a number of seconds.")
+        options.ErrorDuringSetup = true
+        return options
+    }
+
+    //Webhook, Slack, and email notifications when the run or a host finishes
+    var err_n error
+    if options.Notifier, err_n = NewRunNotifier(options); err_n != nil {
+        options.Log.Println(options.Warnbox + "ERROR - Could not use '-notify', " + err_n.Error() + ".")
+        options.ErrorDuringSetup = true
+        return options
+    }
+
+    //Timestamp granularity of the timeline
+    if options.TimelineBucket != "" {
+        size, err_b := ParseTimelineBucket(options.TimelineBucket)
+        if err_b != nil {
+            options.Log.Println(options.Warnbox + "ERROR - Could not read timeline bucket '" + options.TimelineBucket + "', " + err_b.Error() + ".")
+            options.ErrorDuringSetup = true
+            return options
+        }
+        options.TimelineBucketSize = size
+    }
+
+    //Timeline file format
+    options.TimelineFormat = strings.ToLower(strings.TrimSpace(options.TimelineFormat))
+    if _, known := timelineFormatExtensions[options.TimelineFormat]; !known && options.TimelineFormat == TimelineFormatSQLite {
+        options.Log.Println(options.Warnbox + "ERROR - SQLite timelines need GoAuditParser built with \"-tags sqlite\", expected '" + strings.Join(TimelineFormatNames(), "', '") + "'.")
+        options.ErrorDuringSetup = true
+        return options
+    } else if !known {
+        options.Log.Println(options.Warnbox + "ERROR - Could not read timeline format '" + options.TimelineFormat + "', expected '" + strings.Join(TimelineFormatNames(), "', '") + "'.")
+        options.ErrorDuringSetup = true
+        return options
+    }
+
+    //Hosts, agents, and audit types to timeline
+    for _, sourceFilter := range []struct {
+        flag     string
+        value    string
+        patterns *[]string
+    }{
+        {"tlhost", options.TimelineHosts, &options.TimelineSources.Hosts},
+        {"tlagent", options.TimelineAgents, &options.TimelineSources.Agents},
+        {"tlaudit", options.TimelineAudits, &options.TimelineSources.Audits},
+    } {
+        var err_p error
+        if *sourceFilter.patterns, err_p = ParseTimelineSourcePatterns(sourceFilter.value); err_p != nil {
+            options.Log.Println(options.Warnbox + "ERROR - Could not read '-" + sourceFilter.flag + "' filter, " + err_p.Error() + ".")
+            options.ErrorDuringSetup = true
+            return options
+        }
     }
 
     //Parse time filter
@@ -332,12 +1082,12 @@ func Setup() Options {
                     matches := timeParse1.FindStringSubmatch(timelineFilter)
                     t1, err_t1 := time.Parse("2006-01-02 15:04:05", matches[1])
                     if err_t1 != nil {
-                        fmt.Println(options.Warnbox + "Could not parse '" + matches[1] + "' in format 'yyyy-mm-dd hh:mm:ss'.")
+                        options.Log.Println(options.Warnbox + "Could not parse '" + matches[1] + "' in format 'yyyy-mm-dd hh:mm:ss'.")
                         log.Fatal(err_t1)
                     }
                     t2, err_t2 := time.Parse("2006-01-02 15:04:05", matches[2])
                     if err_t2 != nil {
-                        fmt.Println(options.Warnbox + "Could not parse '" + matches[2] + "' in format 'yyyy-mm-dd hh:mm:ss'.")
+                        options.Log.Println(options.Warnbox + "Could not parse '" + matches[2] + "' in format 'yyyy-mm-dd hh:mm:ss'.")
                         log.Fatal(err_t2)
                     }
                     timeStart = t1
@@ -346,13 +1096,13 @@ func Setup() Options {
                     matches := timeParse2.FindStringSubmatch(timelineFilter)
                     t1, err_t1 := time.Parse("2006-01-02", matches[1])
                     if err_t1 != nil {
-                        fmt.Println(options.Warnbox + "Could not parse '" + matches[1] + "' in format 'yyyy-mm-dd'.")
+                        options.Log.Println(options.Warnbox + "Could not parse '" + matches[1] + "' in format 'yyyy-mm-dd'.")
                         log.Fatal(err_t1)
                     }
                     t2, err_t2 := time.Parse("2006-01-02", matches[2])
                     t2 = t2.Add(time.Hour*23 + time.Minute*59 + time.Minute*59)
                     if err_t2 != nil {
-                        fmt.Println(options.Warnbox + "Could not parse '" + matches[2] + "' in format 'yyyy-mm-dd'.")
+                        options.Log.Println(options.Warnbox + "Could not parse '" + matches[2] + "' in format 'yyyy-mm-dd'.")
                         log.Fatal(err_t2)
                     }
                     timeStart = t1
@@ -367,7 +1117,7 @@ func Setup() Options {
                     matches = timeParse3.FindStringSubmatch(timelineFilter)
                     t1, err_t1 := time.Parse("2006-01-02 15:04:05", matches[1])
                     if err_t1 != nil {
-                        fmt.Println(options.Warnbox + "Could not parse '" + matches[1] + "' in format 'yyyy-mm-dd hh:mm:ss'.")
+                        options.Log.Println(options.Warnbox + "Could not parse '" + matches[1] + "' in format 'yyyy-mm-dd hh:mm:ss'.")
                         log.Fatal(err_t1)
                     }
                     t = t1
@@ -375,14 +1125,14 @@ func Setup() Options {
                     matches = timeParse4.FindStringSubmatch(timelineFilter)
                     t1, err_t1 := time.Parse("2006-01-02", matches[1])
                     if err_t1 != nil {
-                        fmt.Println(options.Warnbox + "Could not parse '" + matches[1] + "' in format 'yyyy-mm-dd'.")
+                        options.Log.Println(options.Warnbox + "Could not parse '" + matches[1] + "' in format 'yyyy-mm-dd'.")
                         log.Fatal(err_t1)
                     }
                     t = t1
                 }
                 durNum, err_i := strconv.Atoi(matches[3])
                 if err_i != nil {
-                    fmt.Println(options.Warnbox + "Could not convert '" + matches[3] + "' to an integer.")
+                    options.Log.Println(options.Warnbox + "Could not convert '" + matches[3] + "' to an integer.")
                     log.Fatal(err_i)
                 }
                 durName := matches[4]
@@ -409,8 +1159,8 @@ func Setup() Options {
                     timeEnd = t
                 }
             } else {
-                fmt.Println(options.Warnbox + "ERROR - Could not parse provided timeline filter '" + timelineFilter + "'.")
-                fmt.Println(options.Warnbox + "Formats: 'YYYY-MM-DD HH:MM:SS - YYYY-MM-DD HH:MM:SS' OR 'YYYY-MM-DD HH:MM:SS +-5m'")
+                options.Log.Println(options.Warnbox + "ERROR - Could not parse provided timeline filter '" + timelineFilter + "'.")
+                options.Log.Println(options.Warnbox + "Formats: 'YYYY-MM-DD HH:MM:SS - YYYY-MM-DD HH:MM:SS' OR 'YYYY-MM-DD HH:MM:SS +-5m'")
                 options.ErrorDuringSetup = true
                 return options
             }
@@ -429,16 +1179,16 @@ func Setup() Options {
         options.ConfigPath = filepath.Join(dataDir, "config.json")
     }
     if options.Verbose > 0 {
-        fmt.Println(options.Box + "Reading main config file '" + options.ConfigPath + "'...")
+        options.Log.Println(options.Box + "Reading main config file '" + options.ConfigPath + "'...")
     }
     _, err_s := os.Stat(options.ConfigPath)
     //If config file exists, create the file
     if os.IsNotExist(err_s) {
         //Create config file
-        fmt.Println(options.Warnbox + "NOTICE - Main config file '" + options.ConfigPath + "' does not exist. Creating...")
+        options.Log.Println(options.Warnbox + "NOTICE - Main config file '" + options.ConfigPath + "' does not exist. Creating...")
         file, err_c := os.Create(options.ConfigPath)
         if err_c != nil {
-            fmt.Println(options.Box + "ERROR - Could not create main config file '" + options.ConfigPath + "'.")
+            options.Log.Println(options.Box + "ERROR - Could not create main config file '" + options.ConfigPath + "'.")
             log.Fatal(err_c)
         }
         var newconfig Main_Config_JSON
@@ -447,7 +1197,7 @@ func Setup() Options {
             if options.Verbose > 2 {
                 fmt.Println(GetMainConfigTemplate(options))
             }
-            fmt.Println(options.Warnbox + "ERROR - Could not parse pre-made JSON for main config file. Please contact the developer.")
+            options.Log.Println(options.Warnbox + "ERROR - Could not parse pre-made JSON for main config file. Please contact the developer.")
             log.Fatal(err_j)
         }
         file.WriteString(GetMainConfigTemplate(options))
@@ -457,27 +1207,27 @@ func Setup() Options {
     //Read JSON from config file
     file, err_o := os.Open(options.ConfigPath)
     if err_o != nil {
-        fmt.Println(options.Warnbox + "ERROR - Could not open main config file '" + options.ConfigPath + "'.")
+        options.Log.Println(options.Warnbox + "ERROR - Could not open main config file '" + options.ConfigPath + "'.")
         log.Fatal(err_o)
     }
     b, err_i := ioutil.ReadAll(file)
     if err_i != nil {
-        fmt.Println(options.Warnbox + "ERROR - Could not read contents from main config '" + options.ConfigPath + "'.")
+        options.Log.Println(options.Warnbox + "ERROR - Could not read contents from main config '" + options.ConfigPath + "'.")
         log.Fatal(err_i)
     }
     var config Main_Config_JSON
     err_j := json.Unmarshal(b, &config)
     file.Close()
     if err_j != nil {
-        fmt.Println(options.Warnbox + "ERROR - Could not parse JSON from main config file '" + options.ConfigPath + "': " + err_j.Error())
+        options.Log.Println(options.Warnbox + "ERROR - Could not parse JSON from main config file '" + options.ConfigPath + "': " + err_j.Error())
         reader := bufio.NewReader(os.Stdin)
-        fmt.Println(options.Box + "Would you like to overwrite the previous main config file with a new one? [Y/N]")
+        options.Log.Println(options.Box + "Would you like to overwrite the previous main config file with a new one? [Y/N]")
         fmt.Print("> ")
         text, _ := reader.ReadString('\n')
         if strings.HasPrefix(strings.TrimSpace(strings.ToLower(text)), "y") {
             file, err_c := os.Create(options.ConfigPath)
             if err_c != nil {
-                fmt.Println(options.Box + "ERROR - Could not create main config file '" + options.ConfigPath + "'.")
+                options.Log.Println(options.Box + "ERROR - Could not create main config file '" + options.ConfigPath + "'.")
                 log.Fatal(err_c)
             }
             var newconfig Main_Config_JSON
@@ -486,13 +1236,13 @@ func Setup() Options {
                 if options.Verbose > 2 {
                     fmt.Println(GetMainConfigTemplate(options))
                 }
-                fmt.Println(options.Warnbox + "ERROR - Could not parse pre-made JSON for main config file. Please contact the developer.")
+                options.Log.Println(options.Warnbox + "ERROR - Could not parse pre-made JSON for main config file. Please contact the developer.")
                 log.Fatal(err_j)
             }
             file.WriteString(GetMainConfigTemplate(options))
             file.Close()
         } else {
-            fmt.Println(options.Warnbox + "Please fix the main config file manually.")
+            options.Log.Println(options.Warnbox + "Please fix the main config file manually.")
             options.ErrorDuringSetup = true
             return options
         }
@@ -502,51 +1252,245 @@ func Setup() Options {
     updateConig := false
     if config.Version != version {
         if !config.DontOverwrite {
-            fmt.Println(options.Box + "Updating old config v" + config.Version + " to v" + version + "...")
+            options.Log.Println(options.Box + "Updating old config v" + config.Version + " to v" + version + "...")
             //Update config
             updateConig = true
             var newconfig Main_Config_JSON
             err_j := json.Unmarshal([]byte(GetMainConfigTemplate(options)), &newconfig)
             if err_j != nil {
-                fmt.Println(options.Warnbox + "ERROR - Could not parse pre-made JSON for main config file. Please contact the developer.")
+                options.Log.Println(options.Warnbox + "ERROR - Could not parse pre-made JSON for main config file. Please contact the developer.")
                 log.Fatal(err_j)
             }
             //Keep some old settings
             newconfig.OmitUnlisted = config.OmitUnlisted
+            newconfig.MemoryImageHook = config.MemoryImageHook
+            newconfig.OutputPermissions = config.OutputPermissions
+            newconfig.OutputRoutes = config.OutputRoutes
+            newconfig.AgentIDAliases = config.AgentIDAliases
+            newconfig.RetentionRoots = config.RetentionRoots
+            for name, auditType := range config.ManualCollectionAudits {
+                newconfig.ManualCollectionAudits[name] = auditType
+            }
             if !strings.HasPrefix(config.Version, "0.") {
                 newconfig.AutoSplitFiles = config.AutoSplitFiles
                 newconfig.AutoExtract = config.AutoExtract
             }
             config = newconfig
         } else {
-            fmt.Println(options.Warnbox + "NOTICE - New main config file version is available, but the JSON property 'Dont_Overwrite_With_New_Update' is set to 'true'.")
+            options.Log.Println(options.Warnbox + "NOTICE - New main config file version is available, but the JSON property 'Dont_Overwrite_With_New_Update' is set to 'true'.")
             time.Sleep(time.Second * 1)
         }
     }
 
     //Update the main config file
     if updateConig {
-        fmt.Println(options.Box + "Updating config file...")
+        options.Log.Println(options.Box + "Updating config file...")
         //Write new JSON to timeline file
         newFile, err_c := os.Create(options.ConfigPath)
         config.Version = version
         if err_c != nil {
-            fmt.Println(options.Warnbox + "ERROR - Could not create new version of main config file '" + options.ConfigPath + "'")
+            options.Log.Println(options.Warnbox + "ERROR - Could not create new version of main config file '" + options.ConfigPath + "'")
             log.Fatal(err_c)
         }
         b, _ := json.MarshalIndent(config, "", "    ")
         newFile.Write(b)
         newFile.Close()
     }
+    //Config files written before manual collections were supported use the default table
+    if config.ManualCollectionAudits == nil {
+        var template Main_Config_JSON
+        json.Unmarshal([]byte(GetMainConfigTemplate(options)), &template)
+        config.ManualCollectionAudits = template.ManualCollectionAudits
+    }
     options.Config = config
 
+    //Output permissions, flags override the main config
+    if options.FilePermissions == "" {
+        options.FilePermissions = config.OutputPermissions.File
+    }
+    if options.DirPermissions == "" {
+        options.DirPermissions = config.OutputPermissions.Directory
+    }
+    if options.OutputGroup == "" {
+        options.OutputGroup = config.OutputPermissions.Group
+    }
+    var err_p error
+    if options.FileMode, err_p = ParseOutputPermissions(options.FilePermissions); err_p != nil {
+        options.Log.Println(options.Warnbox + "ERROR - Could not read output file permissions. " + err_p.Error())
+        options.ErrorDuringSetup = true
+        return options
+    }
+    if options.DirMode, err_p = ParseOutputPermissions(options.DirPermissions); err_p != nil {
+        options.Log.Println(options.Warnbox + "ERROR - Could not read output directory permissions. " + err_p.Error())
+        options.ErrorDuringSetup = true
+        return options
+    }
+    if options.OutputGroupID, err_p = LookupOutputGroup(options.OutputGroup); err_p != nil {
+        options.Log.Println(options.Warnbox + "ERROR - Could not find output group '" + options.OutputGroup + "'. " + err_p.Error())
+        options.ErrorDuringSetup = true
+        return options
+    }
+    if err_p = options.Log.ApplyOutputPermissions(options); err_p != nil {
+        options.Log.Println(options.Warnbox + "ERROR - Could not set the permissions of log file '" + options.LogFile + "'. " + err_p.Error())
+        options.ErrorDuringSetup = true
+        return options
+    }
+
+    //Output routes of audit types to subdirectories
+    if err_r := ValidateOutputRoutes(config.OutputRoutes); err_r != nil {
+        options.Log.Println(options.Warnbox + "ERROR - Could not read 'Output_Routes' of main config file '" + options.ConfigPath + "', " + err_r.Error() + ".")
+        options.ErrorDuringSetup = true
+        return options
+    }
+
+    //Canonical agent IDs, so every source of an agent names its files the same way
+    var err_a error
+    if options.AgentIDs, err_a = NewAgentIDs(config.AgentIDAliases); err_a != nil {
+        options.Log.Println(options.Warnbox + "ERROR - Could not read 'AgentID_Aliases' of main config file '" + options.ConfigPath + "', " + err_a.Error() + ".")
+        options.ErrorDuringSetup = true
+        return options
+    }
+    if options.ParseAltAgentID != "" {
+        options.ParseAltAgentID = options.AgentIDs.Normalize(options, options.ParseAltAgentID, "-paa")
+    }
+
+    //Output directories '-retention <int>' deletes old output files from, '-o <dir>' or those of the main config
+    if options.RetentionDays > 0 {
+        if setFlags["o"] {
+            options.RetentionRoots = []string{options.OutputPath}
+        } else {
+            options.RetentionRoots = config.RetentionRoots
+        }
+        if len(options.RetentionRoots) == 0 {
+            options.Log.Println(options.Warnbox + "ERROR - '-retention <int>' needs the output directories to delete old output files from. Provide one with '-o <dir>', or list them in 'Retention_Roots' of main config file '" + options.ConfigPath + "'.")
+            options.ErrorDuringSetup = true
+            return options
+        }
+    }
+
+    //Archive passwords, which may also be entered when an encrypted archive is found
+    //Event log knowledge pack
+    if options.EventKnowledgePackFile != "" || options.EventKnowledgeFilter != "" {
+        options.EventKnowledge = true
+    }
+    if options.EventKnowledge {
+        var err_k error
+        if options.EventKnowledgePack, err_k = LoadEventKnowledge(options.EventKnowledgePackFile); err_k != nil {
+            options.Log.Println(options.Warnbox + "ERROR - Could not read event knowledge pack '" + options.EventKnowledgePackFile + "'. " + err_k.Error())
+            options.ErrorDuringSetup = true
+            return options
+        }
+        for _, filter := range strings.Split(options.EventKnowledgeFilter, ",") {
+            matched := false
+            for _, category := range EventKnowledgeCategories(options.EventKnowledgePack) {
+                matched = matched || EventKnowledgeMatches(filter, category)
+            }
+            if strings.TrimSpace(filter) != "" && !matched {
+                options.Log.Println(options.Warnbox + "ERROR - Event knowledge filter '" + strings.TrimSpace(filter) + "' does not match any category: " + strings.Join(EventKnowledgeCategories(options.EventKnowledgePack), ", ") + ".")
+                options.ErrorDuringSetup = true
+                return options
+            }
+        }
+    }
+
+    //Prior SOD export the SOD timeline is compared to
+    if options.TimelineSODPrevious != "" {
+        var err_s error
+        if options.TimelineSODDiff, err_s = ReadSODExport(strings.Split(options.TimelineSODPrevious, ",")); err_s != nil {
+            options.Log.Println(options.Warnbox + "ERROR - Could not read prior SOD export " + err_s.Error() + ".")
+            options.ErrorDuringSetup = true
+            return options
+        }
+    }
+
+    //Analyst notes
+    if options.AnalystNotesFile != "" {
+        var err_n error
+        if options.AnalystNotes, err_n = ReadAnalystNotes(options.AnalystNotesFile); err_n != nil {
+            options.Log.Println(options.Warnbox + "ERROR - Could not read analyst notes file '" + options.AnalystNotesFile + "'. " + err_n.Error())
+            options.ErrorDuringSetup = true
+            return options
+        }
+        if options.Verbose > 0 {
+            options.Log.Println(options.Box + "Read " + strconv.Itoa(len(options.AnalystNotes)) + " analyst note(s) from '" + options.AnalystNotesFile + "'.")
+        }
+    }
+
+    //IOC and keyword tags
+    if options.TagFile != "" {
+        var err_t error
+        if options.TagRules, err_t = ReadTagRules(options.TagFile); err_t != nil {
+            options.Log.Println(options.Warnbox + "ERROR - Could not read tag file '" + options.TagFile + "'. " + err_t.Error())
+            options.ErrorDuringSetup = true
+            return options
+        }
+        if options.Verbose > 0 {
+            options.Log.Println(options.Box + "Read " + strconv.Itoa(len(options.TagRules)) + " tag rule(s) from '" + options.TagFile + "'.")
+        }
+        options.TagRuleHits = NewTagRuleHitLog(options.TagRules)
+    }
+
+    //Known-good allowlists
+    if options.AllowlistFiles != "" {
+        var err_a error
+        if options.Allowlist, err_a = ReadAllowlist(options.AllowlistFiles, options.AllowlistAudits); err_a != nil {
+            options.Log.Println(options.Warnbox + "ERROR - Could not read allowlist '" + options.AllowlistFiles + "'. " + err_a.Error())
+            options.ErrorDuringSetup = true
+            return options
+        }
+        if options.Verbose > 0 {
+            options.Log.Println(options.Box + "Read " + strconv.Itoa(options.Allowlist.Size()) + " allowlisted hash(es) and path(s) from '" + options.AllowlistFiles + "'.")
+        }
+    }
+
+    //Hashed or masked usernames, hostnames, and IPs for sharing parsed files
+    if options.RedactConfig != "" {
+        var err_r error
+        if options.Redaction, err_r = ReadRedactionConfig(options.RedactConfig, options.OutputPath); err_r != nil {
+            options.Log.Println(options.Warnbox + "ERROR - Could not read redaction config '" + options.RedactConfig + "'. " + err_r.Error())
+            options.ErrorDuringSetup = true
+            return options
+        }
+        if options.Verbose > 0 {
+            options.Log.Println(options.Box + "Read " + strconv.Itoa(len(options.Redaction.rules)) + " redaction rule(s) from '" + options.RedactConfig + "'.")
+        }
+    }
+
+    options.ExtractionPasswords = map[string]string{}
+    if options.ExtractionPasswordFile != "" {
+        if options.ExtractionPasswords, err_p = ReadExtractionPasswordFile(options.ExtractionPasswordFile); err_p != nil {
+            options.Log.Println(options.Warnbox + "ERROR - Could not read archive password file '" + options.ExtractionPasswordFile + "'. " + err_p.Error())
+            options.ErrorDuringSetup = true
+            return options
+        }
+    }
+
+    //Hash the configs and inputs before anything is extracted into or split in the input directory
+    if options.WriteRunManifest {
+        if options.Verbose > 0 {
+            options.Log.Println(options.Box + "Hashing configs and input files for '" + RunManifestFileName + "'...")
+        }
+        if options.RunManifest, err_p = NewRunManifest(options, setFlags, flagFile); err_p != nil {
+            options.Log.Println(options.Warnbox + "ERROR - Could not record the run manifest. " + err_p.Error())
+            options.ErrorDuringSetup = true
+            return options
+        }
+    }
+    if options.WriteRunReadme {
+        options.RunReadme = NewRunReadme(setFlags, flagFile)
+    }
+
     //Set thread count
     if options.Threads <= 0 {
         options.Threads = runtime.NumCPU()
     }
+    if options.WriterThreads < 0 {
+        options.WriterThreads = 0
+    }
     if options.Verbose > 2 {
-        fmt.Println(options.Warnbox + "NOTICE - Verbosity set to DEBUG state. Multi-threading is disabled.")
+        options.Log.Println(options.Warnbox + "NOTICE - Verbosity set to DEBUG state. Multi-threading is disabled.")
         options.Threads = 1
+        options.WriterThreads = 0
     }
 
     return options
@@ -572,12 +1516,173 @@ func GetDataDir(options Options) string {
     return dataPath
 }
 
+//GetMultiValueSeparator returns the string joining multiple values of one cell
+func GetMultiValueSeparator(options Options) string {
+    if options.MultiValueSeparator != "" {
+        return options.MultiValueSeparator
+    }
+    if options.ReplaceNewLineFeeds {
+        return "|"
+    }
+    return "\r\n"
+}
+
+//NormalizeHostname strips the domain and/or lowercases a hostname as requested by the '-hs' and '-hl' flags
+func NormalizeHostname(hostname string, options Options) string {
+    if hostname == "HOSTNAMEPLACEHOLDER" {
+        return hostname
+    }
+    if options.HostnameShort && net.ParseIP(hostname) == nil {
+        if i := strings.Index(hostname, "."); i > 0 {
+            hostname = hostname[:i]
+        }
+    }
+    if options.HostnameLowercase {
+        hostname = strings.ToLower(hostname)
+    }
+    return hostname
+}
+
+//HostnameNormalizationEnabled returns true if any hostname normalization flag is set
+func HostnameNormalizationEnabled(options Options) bool {
+    return options.HostnameShort || options.HostnameLowercase
+}
+
+//"<hostname>-<agentid>-<payload>-<audittype>.<ext>" as written by the parser and splitters, with a 22 character agent ID
+//or a GUID agent ID written as 32 hex digits, so names such as "2024-01-15-report.csv" are not taken for output files
+var gapOutputFileRegex = regexp.MustCompile(`^.+-([A-Za-z0-9]{22}|[0-9a-f]{32})-([^-]+)-([A-Za-z0-9_]+)\.(csv|jsonl|xml)$`)
+
+//"<hostname>-<agentid>-<AuditType>.<ext>" files written once per host, "-issues" of '-pi' and "-Hits" of '-phits'
+var gapHostOutputFileRegex = regexp.MustCompile(`^.+-([A-Za-z0-9]{22}|[0-9a-f]{32})-(issues|` + HostHitsAuditType + `|CollectionMetadata)\.(csv|jsonl)$`)
+
+//Payloads of the XML files '-sxml' writes, the payload ID of an audit copied as is or "<payload>_spxml<count>" of a split one
+var gapSplitXMLPayloadRegex = regexp.MustCompile(`(^[0-9a-f]{32}|_spxml[0-9]+)$`)
+
+//IsGoAuditParserOutputFile returns true if the filename matches a file GoAuditParser writes to an output directory, or its temp file
+//Parsed files must end with a known audit type, and XML files must be named like those '-sxml' and '-ebs' write
+func IsGoAuditParserOutputFile(filename string) bool {
+    filename = TempFileFinalName(filename)
+    if strings.HasPrefix(filename, "_Timeline_") && strings.HasSuffix(filename, ".csv") {
+        return true
+    }
+    if gapHostOutputFileRegex.MatchString(filename) {
+        return true
+    }
+    match := gapOutputFileRegex.FindStringSubmatch(filename)
+    if match == nil {
+        return false
+    }
+    payload, auditType, ext := match[2], match[3], match[4]
+    if ext == "xml" {
+        //"-eventbuffer.xml" is split into "-<EventType>Item.xml" files by '-ebs'
+        return gapSplitXMLPayloadRegex.MatchString(payload) || (strings.HasSuffix(auditType, "Item") && auditType != "Item")
+    }
+    return IsKnownAuditType(auditType)
+}
+
+//IsGoAuditParserRunFile returns true if the filename is one GoAuditParser writes once per run to an output directory and
+//rewrites on the next run, "_GAPRunSummary.json" and the parse caches "_GAPParseCache.json" and "_GAPParseCache_<workerid>.json"
+func IsGoAuditParserRunFile(filename string) bool {
+    filename = TempFileFinalName(filename)
+    return filename == "_GAPRunSummary.json" || (strings.HasPrefix(filename, "_GAPParseCache") && strings.HasSuffix(filename, ".json"))
+}
+
+//IsKnownAuditType returns true if GoAuditParser writes files of the audit type, which is the item name of the audit
+//or one of the audit types of 'goauditparser help audits'
+func IsKnownAuditType(auditType string) bool {
+    if _, exists := auditTypeDescriptions[auditType]; exists {
+        return true
+    }
+    return strings.HasPrefix(auditType, "EventItem_") || (strings.HasSuffix(auditType, "Item") && auditType != "Item")
+}
+
+//WipeOutputDirectory deletes GoAuditParser output files with the extension from a directory as specified with the '-wo' flag
+//Other files are left alone, the user is asked to confirm unless '-y' is used, and deletions are logged to "_GAPWipeLog.txt"
+//Files in the "Output_Routes" subdirectories of the main config are included
+func WipeOutputDirectory(options Options, dir string, ext string) {
+    outputfiles, _ := ReadOutputDir(options, dir)
+    targets := []string{}
+    skipped := 0
+    for _, filename := range outputfiles {
+        if IsGoAuditParserRunFile(filepath.Base(filename)) {
+            targets = append(targets, filename)
+            continue
+        }
+        if !strings.HasSuffix(TempFileFinalName(filename), ext) {
+            continue
+        }
+        if !IsGoAuditParserOutputFile(filepath.Base(filename)) {
+            skipped++
+            if options.Verbose > 0 {
+                options.Log.Println(options.Box + "Keeping file '" + filename + "' which does not match GoAuditParser naming.")
+            }
+            continue
+        }
+        targets = append(targets, filename)
+    }
+    if skipped > 0 {
+        options.Log.Println(options.Box + "NOTICE - " + strconv.Itoa(skipped) + " " + strings.ToUpper(strings.TrimPrefix(ext, ".")) + " file(s) in '" + dir + "' do not match GoAuditParser naming and will not be deleted.")
+    }
+    if len(targets) == 0 {
+        return
+    }
+
+    if !options.AssumeYes {
+        reader := bufio.NewReader(os.Stdin)
+        options.Log.Println(options.Box + "The '-wo' flag will delete " + strconv.Itoa(len(targets)) + " GoAuditParser " + strings.ToUpper(strings.TrimPrefix(ext, ".")) + " file(s) in '" + dir + "'. Continue? [Y/N]")
+        fmt.Print("> ")
+        text, _ := reader.ReadString('\n')
+        if !strings.HasPrefix(strings.TrimSpace(strings.ToLower(text)), "y") {
+            options.Log.Println(options.Box + "NOTICE - Not deleting any files in '" + dir + "'.")
+            return
+        }
+    }
+
+    logPath := filepath.Join(dir, "_GAPWipeLog.txt")
+    logFile, err_o := OpenOutputFile(options, logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+    if err_o != nil {
+        options.Log.Println(options.Warnbox + "ERROR - Could not open deletion log '" + logPath + "'. No files were deleted.")
+        log.Fatal(err_o)
+    }
+    defer logFile.Close()
+
+    options.Log.Println(options.Box + "Deleting " + strconv.Itoa(len(targets)) + " pre-existing " + strings.ToUpper(strings.TrimPrefix(ext, ".")) + " file(s) in the output directory '" + dir + "' as specified with the '-wo' flag.")
+    for _, filename := range targets {
+        if options.Verbose > 0 {
+            options.Log.Println(options.Box + "Removing pre-existing file '" + filename + "'...")
+        }
+        status := "DELETED"
+        if err_r := os.Remove(filepath.Join(dir, filename)); err_r != nil {
+            status = "FAILED (" + err_r.Error() + ")"
+            options.Log.Println(options.Warnbox + "WARNING - Could not delete file '" + filename + "'. " + err_r.Error())
+        } else {
+            //The '-pmeta' sidecar of the file
+            os.Remove(filepath.Join(dir, filename) + OutputMetaSuffix)
+        }
+        logFile.WriteString(time.Now().UTC().Format("2006-01-02 15:04:05") + "\t" + status + "\t" + filepath.Join(dir, filename) + "\n")
+    }
+    options.Log.Println(options.Box + "Deletions logged to '" + logPath + "'.")
+}
+
 type Main_Config_JSON struct {
     Version            string   `json:"Version"`
     DontOverwrite      bool     `json:"Dont_Overwrite_With_New_Update"`
     AutoSplitFiles     bool     `json:"Automatically_Split_Big_XML"`
     AutoExtract        bool     `json:"Automatically_Extract_Archives"`
     OmitUnlisted       bool     `json:"Omit_Nonordered_Headers"`
+    MemoryImageHook    struct {
+        Command   string   `json:"Command"`
+        Arguments []string `json:"Arguments"`
+    } `json:"Memory_Image_Hook"`
+    OutputPermissions  struct {
+        File      string `json:"File"`
+        Directory string `json:"Directory"`
+        Group     string `json:"Group"`
+    } `json:"Output_Permissions"`
+    OutputRoutes       []OutputRoute `json:"Output_Routes"`
+    ManualCollectionAudits map[string]string `json:"Manual_Collection_Audits"`
+    AgentIDAliases     map[string]string `json:"AgentID_Aliases"`
+    RetentionRoots     []string `json:"Retention_Roots"`
     HeadersMandatory   []string `json:"Mandatory_Headers"`
     HeadersOptional    []string `json:"Optional_Headers"`
     AuditHeaderConfigs []struct {
@@ -595,6 +1700,42 @@ func GetMainConfigTemplate(options Options) string {
     "Automatically_Split_Big_XML": true,
     "Automatically_Extract_Archives": true,
     "Omit_Nonordered_Headers": false,
+    "Memory_Image_Hook": {
+        "Command": "",
+        "Arguments": ["-f", "<IMAGE>", "windows.info"]
+    },
+    "Output_Permissions": {
+        "File": "",
+        "Directory": "",
+        "Group": ""
+    },
+    "Output_Routes": [],
+    "AgentID_Aliases": {},
+    "Retention_Roots": [],
+    "Manual_Collection_Audits": {
+        "files-api": "w32apifiles",
+        "files-raw": "w32rawfiles",
+        "processes": "w32processes",
+        "processes-memory": "w32processes-memory",
+        "services": "w32services",
+        "ports": "w32ports",
+        "eventlogs": "w32eventlogs",
+        "registry": "w32registryraw",
+        "tasks": "w32tasks",
+        "prefetch": "w32prefetch",
+        "drivers": "w32drivers-modulelist",
+        "users": "w32useraccounts",
+        "system": "w32system",
+        "disks": "w32disks",
+        "volumes": "w32volumes",
+        "persistence": "w32scripting-persistence",
+        "network-dns": "w32network-dns",
+        "network-arp": "w32network-arp",
+        "network-route": "w32network-route",
+        "urlhistory": "urlhistory",
+        "eventbuffer": "eventbuffer",
+        "stateagentinspector": "stateagentinspector"
+    },
     "Mandatory_Headers": [
         "Tag",
         "Notes",
@@ -1410,6 +2551,7 @@ type Parse_Config_XMLFile struct {
     InputFileName string `json:"Name"`
     InputFileSize int64  `json:"Size"`
     Status        string `json:"Status"`
+    InMemory      bool   `json:"InMemory,omitempty"` //Parsed from memory with '-emem <int>', so never written to disk
 }
 
 type Parse_Config_ArchiveFile struct {
@@ -1419,8 +2561,8 @@ type Parse_Config_ArchiveFile struct {
 }
 
 func ParseConfigSave(config Parse_Config_JSON, options Options) error {
-    inputConfigFile := filepath.Join(options.InputPath, "_GAPParseCache.json")
-    file, err_c := os.Create(inputConfigFile)
+    inputConfigFile := ParseCachePath(options)
+    file, err_c := CreateOutputFile(options, inputConfigFile)
     if err_c != nil {
         return err_c
     }
@@ -1458,10 +2600,16 @@ func ParseConfigUpdateXMLParse(dirIndex int, xmlfile os.FileInfo, msg string, ex
     }
     if strings.Contains(msg, "Issues file") {
         status = "ignored/issues"
+        if strings.Contains(msg, "issue(s) written") {
+            status = "parsed/issues"
+        }
     }
     if strings.Contains(msg, "is empty") {
         status = "ignored/empty"
     }
+    if strings.Contains(msg, "is not an audit") {
+        status = "skipped/notaudit"
+    }
     if strings.Contains(msg, "not rename") {
         status = "failed/rename"
     }
@@ -1475,6 +2623,7 @@ func ParseConfigUpdateXMLParse(dirIndex int, xmlfile os.FileInfo, msg string, ex
         status = "split"
     }
     config.OutputDirectories[dirIndex].XMLFiles[xmlFileIndex].Status = status
+    config.OutputDirectories[dirIndex].XMLFiles[xmlFileIndex].InMemory = IsMemoryPayload(xmlfile)
     return config
 }
 
@@ -1568,6 +2717,12 @@ func ParseConfigUpdateArchive(dirIndex int, archivefile os.FileInfo, msg string,
     if strings.Contains(msg, "Failed to unarchive") {
         status = "failed"
     }
+    if strings.Contains(msg, "Archive needs password") {
+        status = "needs password"
+    }
+    if strings.Contains(msg, "Archive password is incorrect") {
+        status = "wrong password"
+    }
     config.OutputDirectories[dirIndex].ArchiveFiles[archiveFileIndex].Status = status
     return config
 }
@@ -1635,10 +2790,40 @@ func GetTimelineConfigTemplate() string {
     "Include_Summary_Headers": true,
     "Unique_Row_Per_Timestamp": false,
     "Include_Timestampless_Audits": true,
-    "Extra_Fields_Order": ["Tag","Notes","Hostname","AgentID","MD5","Size","User","SignatureExists","SignatureVerified","SubAuditType","Extra1","Extra2","Extra3"],
+    "Extra_Fields_Order": ["Tag","Notes","Hostname","AgentID","MD5","Size","User","SignatureExists","SignatureVerified","SubAuditType","Extra1","Extra2","Extra3","Extra4"],
     "Audit_Timeline_Configs":
     [`
     template_audits := `
+        {
+            "Name": "AuditDebug",
+            "Filename_Suffix": "AuditDebug",
+            "Timestamp_Fields": [
+                "Created"
+            ],
+            "Summary_Fields": [
+                "Message"
+            ],
+            "Extra_Fields": [
+                "Hostname",
+                "AgentID",
+                "AuditType>Extra1"
+            ]
+        },
+        {
+            "Name": "CollectionMetadata",
+            "Filename_Suffix": "CollectionMetadata",
+            "Timestamp_Fields": [
+                "ScriptRequestTime",
+                "AcquisitionCompleteTime"
+            ],
+            "Summary_Fields": [
+                "Archive"
+            ],
+            "Extra_Fields": [
+                "Hostname",
+                "AgentID"
+            ]
+        },
         {   
             "Name": "CookieHistoryItem",
             "Filename_Suffix": "CookieHistoryItem",
@@ -1912,6 +3097,7 @@ func GetTimelineConfigTemplate() string {
             ],
             "Summary_Fields": [
                 "EID",
+                "EventDescription",
                 "index",
                 "log",
                 "source",
@@ -2048,6 +3234,25 @@ func GetTimelineConfigTemplate() string {
                 "AgentID"
             ]
         },
+        {
+            "Name": "MultiFileAcquisition",
+            "Filename_Suffix": "MultiFileAcquisition",
+            "Timestamp_Fields": [
+                "Created",
+                "Modified",
+                "Accessed",
+                "Changed"
+            ],
+            "Summary_Fields": [
+                "FullPath"
+            ],
+            "Extra_Fields": [
+                "Hostname",
+                "AgentID",
+                "Payload>Extra1",
+                "Archive>Extra2"
+            ]
+        },
         {
             "Name": "PersistenceType",
             "Filename_Suffix": "PersistenceItem",
@@ -2181,7 +3386,30 @@ func GetTimelineConfigTemplate() string {
             "Extra_Fields": [
                 "User",
                 "Hostname",
-                "AgentID"
+                "AgentID",
+                "AgentBundleIdentifier>Extra1",
+                "TypeNumber>Extra2",
+                "EventIdentifier>Extra3"
+            ]
+        },
+        {
+            "Name": "QuarantineListItem",
+            "Filename_Suffix": "QuarantineListItem",
+            "Timestamp_Fields": [
+                "QuarantineTime"
+            ],
+            "Summary_Fields": [
+                "FilePath",
+                "ObjectType"
+            ],
+            "Extra_Fields": [
+                "Hostname",
+                "AgentID",
+                "FileMD5>MD5",
+                "FileSize>Size",
+                "FileState||Final>Extra1",
+                "QuarantinePayload>Extra2",
+                "QuarId>Extra3"
             ]
         },
         {
@@ -2249,11 +3477,31 @@ func GetTimelineConfigTemplate() string {
             "Extra_Fields": [
                 "Shell>Extra1",
                 "FileOrder>Extra2",
+                "UnixActivity>Extra3",
+                "UnixActivityDetail>Extra4",
                 "UserName>User",
                 "Hostname",
                 "AgentID"
             ]
         },
+        {
+            "Name": "Syslog",
+            "Filename_Suffix": "Syslog",
+            "Timestamp_Fields": [
+                "Time"
+            ],
+            "Summary_Fields": [
+                "Message"
+            ],
+            "Extra_Fields": [
+                "Sender>Extra1",
+                "Facility||Level>Extra2",
+                "UnixActivity>Extra3",
+                "UnixActivityDetail>Extra4",
+                "Hostname",
+                "AgentID"
+            ]
+        },
         {
             "Name": "SystemInfoItem",
             "Filename_Suffix": "SystemInfoItem",
@@ -0,0 +1,67 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+
+package goauditparser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWipeOutputDirectory(t *testing.T) {
+	dir := t.TempDir()
+	deleted := []string{
+		"HOST-01-bPlNFGdSC2wd8f2QnFhk5A-82fbf86758bf5c97d2d2a313e4f95957-ProcessItem.csv",
+		"HOST-01-bPlNFGdSC2wd8f2QnFhk5A-82fbf86758bf5c97d2d2a313e4f95957-ProcessItem.csv" + OutputMetaSuffix,
+		"HOST-01-bPlNFGdSC2wd8f2QnFhk5A-3ab439e73270ce54c3125a76987daa9f-EventItem_ProcessEvent.csv",
+		"HOST-01-bPlNFGdSC2wd8f2QnFhk5A-HOST_01_bPlNFGdSC2wd8f2QnFhk5A-CollectionMetadata.csv",
+		"HOST-01-bPlNFGdSC2wd8f2QnFhk5A-issues.csv",
+		"HOST-01-bPlNFGdSC2wd8f2QnFhk5A-Hits.csv",
+		"_GAPRunSummary.json",
+		"_GAPParseCache.json",
+		"_GAPParseCache_worker1.json",
+		"_Timeline_2020-01-07_1200.csv",
+	}
+	kept := []string{
+		"report.csv",
+		"2024-01-15-report.csv",
+		"HOST-01-notes-issues.csv",
+		"HOST-01-bPlNFGdSC2wd8f2QnFhk5A-82fbf86758bf5c97d2d2a313e4f95957-Unknown.csv",
+		"HOST-01-bPlNFGdSC2wd8f2QnFhk5A-82fbf86758bf5c97d2d2a313e4f95957-ProcessItem.xml",
+		"_GAPRedactionMap.csv",
+		RunManifestFileName,
+		"notes.txt",
+	}
+	for _, name := range append(append([]string{}, deleted...), kept...) {
+		if err_w := ioutil.WriteFile(filepath.Join(dir, name), []byte("data"), 0644); err_w != nil {
+			t.Fatal(err_w)
+		}
+	}
+	options, err_l := NewLibraryOptions(LibraryOptions{})
+	if err_l != nil {
+		t.Fatal(err_l)
+	}
+	options.AssumeYes = true
+	WipeOutputDirectory(options, dir, ".csv")
+
+	for _, name := range deleted {
+		if _, err_s := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err_s) {
+			t.Errorf("'%s' was not deleted", name)
+		}
+	}
+	for _, name := range append(kept, "_GAPWipeLog.txt") {
+		if _, err_s := os.Stat(filepath.Join(dir, name)); err_s != nil {
+			t.Errorf("'%s' was deleted: %v", name, err_s)
+		}
+	}
+}
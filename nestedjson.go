@@ -0,0 +1,178 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+//nestedJSONObject is a JSON object which keeps its keys in header order
+type nestedJSONObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (object *nestedJSONObject) set(key string, value interface{}) {
+	if _, exists := object.values[key]; !exists {
+		object.keys = append(object.keys, key)
+	}
+	object.values[key] = value
+}
+
+//MarshalJSON writes the keys in the order they were set
+func (object *nestedJSONObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range object.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := marshalNestedJSON(key)
+		b.Write(k)
+		b.WriteByte(':')
+		v, err_m := marshalNestedJSON(object.values[key])
+		if err_m != nil {
+			return nil, err_m
+		}
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+//A cell of a row below the current level of the dotted header path
+type nestedJSONField struct {
+	path   []string
+	values []string
+}
+
+//NestedJSONItem rebuilds the nested structure of an audit item from its dotted headers, such as
+//"PEInfo.DigitalSignature.SignatureExists", and returns it as one JSON object
+//Multi-value cells become arrays, and fields below the same element with the same number of values
+//become an array of objects, so "ChainElement.Subject" and "ChainElement.Issuer" pair up again
+//Empty cells are left out
+func NestedJSONItem(options Options, headers []string, row []string) ([]byte, error) {
+	sep := GetMultiValueSeparator(options)
+	fields := make([]nestedJSONField, 0, len(headers))
+	for i, header := range headers {
+		if i >= len(row) || row[i] == "" {
+			continue
+		}
+		fields = append(fields, nestedJSONField{strings.Split(header, "."), strings.Split(row[i], sep)})
+	}
+	return marshalNestedJSON(buildNestedJSONObject(fields))
+}
+
+//Marshals without escaping "<", ">", and "&", which are common in paths and command lines
+func marshalNestedJSON(value interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	if err_e := encoder.Encode(value); err_e != nil {
+		return nil, err_e
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+//Builds the object of one level of the dotted paths, grouping fields by their next path element in header order
+func buildNestedJSONObject(fields []nestedJSONField) *nestedJSONObject {
+	object := &nestedJSONObject{values: map[string]interface{}{}}
+	keys := []string{}
+	groups := map[string][]nestedJSONField{}
+	for _, field := range fields {
+		key := field.path[0]
+		if _, exists := groups[key]; !exists {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], nestedJSONField{field.path[1:], field.values})
+	}
+
+	for _, key := range keys {
+		leaves := []nestedJSONField{}
+		children := []nestedJSONField{}
+		for _, field := range groups[key] {
+			if len(field.path) == 0 {
+				leaves = append(leaves, field)
+			} else {
+				children = append(children, field)
+			}
+		}
+		if len(children) == 0 {
+			object.set(key, nestedJSONValue(leaves[0].values))
+			continue
+		}
+		var value interface{} = buildNestedJSONObject(children)
+		if count := nestedJSONArrayLength(children); count > 1 && len(leaves) == 0 {
+			elements := make([]*nestedJSONObject, count)
+			for i := 0; i < count; i++ {
+				element := make([]nestedJSONField, len(children))
+				for j, child := range children {
+					element[j] = nestedJSONField{child.path, child.values[i : i+1]}
+				}
+				elements[i] = buildNestedJSONObject(element)
+			}
+			value = elements
+		}
+		//An element with both a value and child elements keeps its value as "#text"
+		if len(leaves) > 0 {
+			if inner, isObject := value.(*nestedJSONObject); isObject {
+				inner.keys = append([]string{"#text"}, inner.keys...)
+				inner.values["#text"] = nestedJSONValue(leaves[0].values)
+			}
+		}
+		object.set(key, value)
+	}
+	return object
+}
+
+//Returns how many times a repeated element occurred, or 0 unless every field below it has that many values
+//Elements with a single child element are not repeated themselves, the array goes on the deepest element which differs
+func nestedJSONArrayLength(fields []nestedJSONField) int {
+	count := len(fields[0].values)
+	distinct := false
+	for _, field := range fields[1:] {
+		if len(field.values) != count {
+			return 0
+		}
+		if field.path[0] != fields[0].path[0] {
+			distinct = true
+		}
+	}
+	if !distinct {
+		return 0
+	}
+	return count
+}
+
+func nestedJSONValue(values []string) interface{} {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
+
+//WriteNestedJSONLines writes each row as a nested JSON object on its own line
+func WriteNestedJSONLines(options Options, w io.Writer, headers []string, rows [][]string) error {
+	writer := bufio.NewWriter(w)
+	for _, row := range rows {
+		b, err_m := NestedJSONItem(options, headers, row)
+		if err_m != nil {
+			return err_m
+		}
+		writer.Write(b)
+		writer.WriteString("\n")
+	}
+	return writer.Flush()
+}
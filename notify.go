@@ -0,0 +1,352 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Events of the '-notify' notifications
+const (
+	NotifyEventRunFinished  = "run_finished"
+	NotifyEventHostFinished = "host_finished"
+)
+
+//Kinds of '-notify' targets
+const (
+	notifyWebhook = "webhook" //http(s) URL, POSTed the RunNotification as JSON
+	notifySlack   = "slack"   //Slack incoming webhook URL, POSTed {"text": "..."}
+	notifyEmail   = "email"   //"mailto:<address>", sent through '-notify-smtp <host:port>'
+)
+
+//Time allowed for each notification to be delivered
+const notifyTimeout = 30 * time.Second
+
+//RunNotification is POSTed as JSON to '-notify' webhooks when a run or a host finishes
+type RunNotification struct {
+	Event          string                    `json:"event"`
+	Version        string                    `json:"version"`
+	RunID          string                    `json:"run_id"`
+	Machine        string                    `json:"machine"`
+	Started        string                    `json:"started"`
+	Finished       string                    `json:"finished"`
+	ElapsedSeconds float64                   `json:"elapsed_seconds"`
+	Host           string                    `json:"host,omitempty"`
+	HostCounts     *ParseStatCounts          `json:"host_counts,omitempty"`
+	Statistics     map[string]map[string]int `json:"statistics,omitempty"` //Counts of each stage, such as "parse": {"parsed": 10}
+	OutputPath     string                    `json:"output_path,omitempty"`
+	Outputs        []string                  `json:"outputs,omitempty"` //Timelines, workbooks, and other files written by the run
+}
+
+type notifyTarget struct {
+	kind    string
+	address string //URL, or email address
+}
+
+//RunNotifier sends the '-notify' notifications of a run
+//A nil RunNotifier ignores every call, so stages can report to it whether or not '-notify' was used
+type RunNotifier struct {
+	mu         sync.Mutex
+	wg         sync.WaitGroup
+	options    Options
+	targets    []notifyTarget
+	machine    string
+	started    time.Time
+	statistics map[string]map[string]int
+	outputs    []string
+}
+
+//NewRunNotifier reads the '-notify <str>' targets, returns nil if '-notify' was not used
+func NewRunNotifier(options Options) (*RunNotifier, error) {
+	if options.NotifyTargets == "" {
+		return nil, nil
+	}
+	n := &RunNotifier{
+		options:    options,
+		started:    time.Now(),
+		statistics: map[string]map[string]int{},
+	}
+	n.machine, _ = os.Hostname()
+	for _, target := range strings.Split(options.NotifyTargets, ",") {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+		u, err_u := url.Parse(target)
+		if err_u != nil {
+			return nil, errors.New("could not read notification target '" + target + "'. " + err_u.Error())
+		}
+		switch strings.ToLower(u.Scheme) {
+		case "http", "https":
+			kind := notifyWebhook
+			if strings.EqualFold(u.Hostname(), "hooks.slack.com") {
+				kind = notifySlack
+			}
+			n.targets = append(n.targets, notifyTarget{kind, target})
+		case "mailto":
+			if u.Opaque == "" || !strings.Contains(u.Opaque, "@") {
+				return nil, errors.New("could not read email address of notification target '" + target + "'")
+			}
+			if options.NotifySMTP == "" {
+				return nil, errors.New("notification target '" + target + "' needs a mail server. Provide it with '-notify-smtp <host:port>'")
+			}
+			n.targets = append(n.targets, notifyTarget{notifyEmail, u.Opaque})
+		default:
+			return nil, errors.New("unknown notification target '" + target + "', expected an http(s) webhook URL or 'mailto:<address>'")
+		}
+	}
+	if len(n.targets) == 0 {
+		return nil, errors.New("no notification targets in '" + options.NotifyTargets + "'")
+	}
+	return n, nil
+}
+
+//Statistics records the counts of a stage for the run notification
+//Stages which run once per input directory add up
+func (n *RunNotifier) Statistics(stage string, counts map[string]int) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.statistics[stage] == nil {
+		n.statistics[stage] = map[string]int{}
+	}
+	for name, count := range counts {
+		n.statistics[stage][name] += count
+	}
+}
+
+//AddOutputs records files written by the run, such as timelines, for the run notification
+func (n *RunNotifier) AddOutputs(paths ...string) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, path := range paths {
+		if abs, err_a := filepath.Abs(path); err_a == nil {
+			path = abs
+		}
+		n.outputs = append(n.outputs, path)
+	}
+}
+
+//HostFinished notifies '-notify-host' targets that every audit of a host is parsed, with the counts of its files
+//The notification is sent in the background, RunFinished waits for it
+func (n *RunNotifier) HostFinished(options Options, host string, results []ThreadReturn_Parse) {
+	if n == nil || !options.NotifyHosts || host == "" {
+		return
+	}
+	summary := NewParseRunSummary(options)
+	for _, done := range results {
+		summary.Add(options, done, ParseResultStatus(done.message))
+	}
+	counts := ParseStatCounts{}
+	for _, c := range summary.ByHost {
+		counts.Parsed += c.Parsed
+		counts.Failed += c.Failed
+		counts.Cached += c.Cached
+		counts.Empty += c.Empty
+		counts.Issues += c.Issues
+		counts.Skipped += c.Skipped
+		counts.Rows += c.Rows
+	}
+	notification := n.notification(NotifyEventHostFinished)
+	notification.Host = host
+	notification.HostCounts = &counts
+	notification.OutputPath = notifyOutputPath(options)
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		n.send(notification)
+	}()
+}
+
+//RunFinished notifies every target that the run into the output directory of options finished, with its statistics
+//and outputs, and waits for the notifications of the run to be delivered. The statistics and outputs start over for
+//the next run of '-watch'
+func (n *RunNotifier) RunFinished(options Options) {
+	if n == nil {
+		return
+	}
+	notification := n.notification(NotifyEventRunFinished)
+	notification.OutputPath = notifyOutputPath(options)
+	n.mu.Lock()
+	notification.Statistics = n.statistics
+	notification.Outputs = n.outputs
+	n.statistics = map[string]map[string]int{}
+	n.outputs = nil
+	n.mu.Unlock()
+	n.send(notification)
+	n.wg.Wait()
+	n.started = time.Now()
+}
+
+func (n *RunNotifier) notification(event string) RunNotification {
+	now := time.Now()
+	return RunNotification{
+		Event:          event,
+		Version:        version,
+		RunID:          n.options.RunID,
+		Machine:        n.machine,
+		Started:        n.started.UTC().Format(NormalizedTimeLayout),
+		Finished:       now.UTC().Format(NormalizedTimeLayout),
+		ElapsedSeconds: now.Sub(n.started).Seconds(),
+	}
+}
+
+//notifyOutputPath returns the absolute output directory of a run, or its extraction directory with '-eo'
+func notifyOutputPath(options Options) string {
+	path := options.OutputPath
+	if path == "" || options.ExtractionOutputDir != "" {
+		path = options.ExtractionOutputDir
+	}
+	if abs, err_a := filepath.Abs(path); err_a == nil && path != "" {
+		return abs
+	}
+	return path
+}
+
+//send delivers a notification to every target, failures are warnings since the output is already written
+func (n *RunNotifier) send(notification RunNotification) {
+	for _, target := range n.targets {
+		var err_s error
+		switch target.kind {
+		case notifyWebhook:
+			err_s = notifyPost(target.address, notification)
+		case notifySlack:
+			err_s = notifyPost(target.address, map[string]string{"text": notification.Text()})
+		case notifyEmail:
+			err_s = notifyEmailSend(n.options.NotifySMTP, target.address, notification)
+		}
+		name := target.address
+		if u, err_u := url.Parse(target.address); err_u == nil && u.Host != "" {
+			name = u.Scheme + "://" + u.Host //Webhook paths are secrets
+		}
+		if err_s != nil {
+			n.options.Log.Println(n.options.Warnbox + "WARNING - Could not send the '" + notification.Event + "' notification to '" + name + "'. " + err_s.Error())
+		} else if n.options.Verbose > 0 {
+			n.options.Log.Println(n.options.Box + "Sent the '" + notification.Event + "' notification to '" + name + "'.")
+		}
+	}
+}
+
+//Subject returns the one-line summary of a notification, used as the email subject
+func (notification RunNotification) Subject() string {
+	elapsed := (time.Duration(notification.ElapsedSeconds * float64(time.Second))).Truncate(time.Second).String()
+	if notification.Event == NotifyEventHostFinished {
+		return "GoAuditParser finished host '" + notification.Host + "' on " + notification.Machine + " after " + elapsed
+	}
+	return "GoAuditParser run " + notification.RunID + " finished on " + notification.Machine + " in " + elapsed
+}
+
+//Text returns the notification as plain text for Slack and email
+func (notification RunNotification) Text() string {
+	lines := []string{notification.Subject() + "."}
+	if c := notification.HostCounts; c != nil {
+		lines = append(lines, fmt.Sprintf("parse: parsed=%d failed=%d cached=%d empty=%d issues=%d skipped=%d rows=%d", c.Parsed, c.Failed, c.Cached, c.Empty, c.Issues, c.Skipped, c.Rows))
+	}
+	stages := []string{}
+	for stage := range notification.Statistics {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		names := []string{}
+		for name := range notification.Statistics[stage] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		counts := []string{}
+		for _, name := range names {
+			counts = append(counts, name+"="+strconv.Itoa(notification.Statistics[stage][name]))
+		}
+		lines = append(lines, stage+": "+strings.Join(counts, " "))
+	}
+	if notification.OutputPath != "" {
+		lines = append(lines, "Output directory: "+notification.OutputPath)
+	}
+	for _, output := range notification.Outputs {
+		lines = append(lines, "Output: "+output)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func notifyPost(address string, v interface{}) error {
+	b, err_j := json.Marshal(v)
+	if err_j != nil {
+		return err_j
+	}
+	client := http.Client{Timeout: notifyTimeout}
+	resp, err_p := client.Post(address, "application/json", bytes.NewReader(b))
+	if err_p != nil {
+		return err_p
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("the server replied '" + resp.Status + "'")
+	}
+	return nil
+}
+
+//notifyEmailSend mails a notification through server, authenticating with GAP_SMTP_USER and GAP_SMTP_PASSWORD if set
+//The sender is GAP_SMTP_FROM, or GAP_SMTP_USER if it is an address, or "goauditparser@<machine>"
+func notifyEmailSend(server string, to string, notification RunNotification) error {
+	host := server
+	if i := strings.LastIndex(server, ":"); i >= 0 {
+		host = server[:i]
+	} else {
+		server += ":25"
+	}
+	var auth smtp.Auth
+	user := os.Getenv("GAP_SMTP_USER")
+	if user != "" {
+		auth = smtp.PlainAuth("", user, os.Getenv("GAP_SMTP_PASSWORD"), host)
+	}
+	from := os.Getenv("GAP_SMTP_FROM")
+	if from == "" && strings.Contains(user, "@") {
+		from = user
+	} else if from == "" {
+		from = "goauditparser@" + notification.Machine
+	}
+	msg := "From: " + from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + notification.Subject() + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		strings.ReplaceAll(notification.Text(), "\n", "\r\n") + "\r\n"
+
+	c := make(chan error, 1)
+	go func() {
+		c <- smtp.SendMail(server, auth, from, []string{to}, []byte(msg))
+	}()
+	select {
+	case err_m := <-c:
+		return err_m
+	case <-time.After(notifyTimeout):
+		return errors.New("timed out after " + notifyTimeout.String())
+	}
+}
@@ -0,0 +1,435 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Formats of '-obs <str>'
+const (
+	ObservablesFormatCSV  = "csv"
+	ObservablesFormatSTIX = "stix"
+)
+
+//Files written by '-obs <str>' to the output directory
+const (
+	ObservablesCSVFileName  = "_Observables.csv"
+	ObservablesSTIXFileName = "_Observables_STIX.json"
+)
+
+//Types of observables
+const (
+	ObservableMD5    = "md5"
+	ObservableSHA1   = "sha1"
+	ObservableSHA256 = "sha256"
+	ObservableIPv4   = "ipv4"
+	ObservableIPv6   = "ipv6"
+	ObservableIP     = "ip" //IPv4 or IPv6, decided by the value
+	ObservableDomain = "domain"
+	ObservableURL    = "url"
+	ObservablePath   = "file_path"
+)
+
+//Columns of each audit type which hold observables, with their type
+var observableColumns = map[string]map[string]string{
+	"FileItem": {
+		"Md5sum":    ObservableMD5,
+		"Sha1sum":   ObservableSHA1,
+		"Sha256sum": ObservableSHA256,
+		"FullPath":  ObservablePath,
+	},
+	"ServiceItem": {
+		"pathmd5sum":       ObservableMD5,
+		"serviceDLLmd5sum": ObservableMD5,
+		"path":             ObservablePath,
+		"serviceDLL":       ObservablePath,
+	},
+	"PortItem": {
+		"remoteIP": ObservableIP,
+		"path":     ObservablePath,
+	},
+	"EventItem_DnsLookupEvent": {
+		"DNSHostname": ObservableDomain,
+	},
+	"EventItem_UrlMonitorEvent": {
+		"DNSHostname":     ObservableDomain,
+		"RemoteIpAddress": ObservableIP,
+		"RequestUrl":      ObservableURL,
+	},
+	"EventItem_IPv4NetworkEvent": {
+		"RemoteIP": ObservableIPv4,
+	},
+	"EventItem_FileWriteEvent": {
+		"FullPath": ObservablePath,
+		"Md5":      ObservableMD5,
+	},
+	"EventItem_ProcessEvent": {
+		"ProcessPath": ObservablePath,
+		"Md5":         ObservableMD5,
+	},
+}
+
+var (
+	observableHashRegexes = map[string]*regexp.Regexp{
+		ObservableMD5:    regexp.MustCompile(`^[0-9a-fA-F]{32}$`),
+		ObservableSHA1:   regexp.MustCompile(`^[0-9a-fA-F]{40}$`),
+		ObservableSHA256: regexp.MustCompile(`^[0-9a-fA-F]{64}$`),
+	}
+	observableDomainRegex = regexp.MustCompile(`^([a-z0-9_]([a-z0-9_-]{0,61}[a-z0-9_])?\.)+[a-z][a-z0-9-]{0,62}$`)
+)
+
+//Observable is a deduplicated value of the observables export, with the hosts and audits it was seen in
+type Observable struct {
+	Type    string
+	Value   string
+	Count   int
+	Hosts   map[string]bool
+	Sources map[string]bool //"<audittype>.<column>"
+}
+
+//ObservableValue checks and normalizes a value of an observable column, returning its type and value, or false if it
+//is not a shareable observable. Hashes and domains are lowercased, loopback and unspecified IPs are skipped,
+//only absolute URLs are kept since requests often only record the path, and quotes around paths are removed
+func ObservableValue(observableType string, value string) (string, string, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "-" {
+		return "", "", false
+	}
+	switch observableType {
+	case ObservableMD5, ObservableSHA1, ObservableSHA256:
+		if !observableHashRegexes[observableType].MatchString(value) || strings.Trim(value, "0") == "" {
+			return "", "", false
+		}
+		return observableType, strings.ToLower(value), true
+	case ObservableIP, ObservableIPv4, ObservableIPv6:
+		ip := net.ParseIP(strings.Trim(value, "[]"))
+		if ip == nil || ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsMulticast() {
+			return "", "", false
+		}
+		if ip.To4() != nil {
+			return ObservableIPv4, ip.String(), true
+		}
+		return ObservableIPv6, ip.String(), true
+	case ObservableDomain:
+		value = strings.TrimSuffix(strings.ToLower(value), ".")
+		if net.ParseIP(value) != nil || !observableDomainRegex.MatchString(value) {
+			return "", "", false
+		}
+		return ObservableDomain, value, true
+	case ObservableURL:
+		lower := strings.ToLower(value)
+		if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+			return "", "", false
+		}
+		return ObservableURL, value, true
+	case ObservablePath:
+		//Service image paths are often quoted
+		if value = strings.Trim(value, `"`); value == "" {
+			return "", "", false
+		}
+		return ObservablePath, value, true
+	}
+	return "", "", false
+}
+
+//observableKey deduplicates observables, Windows paths are compared without case
+func observableKey(observableType string, value string) string {
+	if observableType == ObservablePath {
+		value = strings.ToLower(value)
+	}
+	return observableType + "|" + value
+}
+
+//ObservablesAudits returns the audit types of '-obsa <str>', or every audit type with observable columns
+func ObservablesAudits(options Options) map[string]bool {
+	audits := map[string]bool{}
+	if strings.TrimSpace(options.ObservablesAudits) == "" {
+		for audit := range observableColumns {
+			audits[audit] = true
+		}
+		return audits
+	}
+	for _, audit := range strings.Split(options.ObservablesAudits, ",") {
+		if audit = strings.TrimSpace(audit); audit != "" {
+			audits[audit] = true
+		}
+	}
+	return audits
+}
+
+//ReadObservables reads the observables of the parsed CSV files of a group into observables, keyed by observableKey
+func ReadObservables(dir string, group MergeGroup, columns map[string]string, observables map[string]*Observable) error {
+	for _, name := range group.Files {
+		file, err_o := os.Open(filepath.Join(dir, name))
+		if err_o != nil {
+			return err_o
+		}
+		reader, _ := NewDialectCSVReader(file)
+		headers, err_r := reader.Read()
+		col_index_hostname := outputColumnIndex(headers, "Hostname")
+		for iRow := 0; err_r == nil; iRow++ {
+			var row []string
+			row, err_r = reader.Read()
+			if err_r != nil {
+				break
+			}
+			//The '-pdesc' field descriptions row is not data
+			if iRow == 0 && len(row) > 0 && row[0] == FieldDescriptionsMarker {
+				continue
+			}
+			hostname := group.Hostname
+			if col_index_hostname != -1 && col_index_hostname < len(row) && row[col_index_hostname] != "" {
+				hostname = row[col_index_hostname]
+			}
+			for i, header := range headers {
+				observableType, exists := columns[header]
+				if !exists || i >= len(row) {
+					continue
+				}
+				//Multi-value cells have one value per line
+				for _, value := range strings.Split(row[i], "\n") {
+					valueType, value, ok := ObservableValue(observableType, value)
+					if !ok {
+						continue
+					}
+					key := observableKey(valueType, value)
+					observable, seen := observables[key]
+					if !seen {
+						observable = &Observable{Type: valueType, Value: value, Hosts: map[string]bool{}, Sources: map[string]bool{}}
+						observables[key] = observable
+					}
+					observable.Count++
+					observable.Hosts[hostname] = true
+					observable.Sources[group.AuditType+"."+header] = true
+				}
+			}
+		}
+		file.Close()
+		if err_r != io.EOF {
+			return fmt.Errorf("could not read '%s'. %s", name, err_r.Error())
+		}
+	}
+	return nil
+}
+
+func sortedObservableKeys(set map[string]bool) []string {
+	keys := []string{}
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//ObservablesCSV returns the observables as a CSV file with a row per observable
+func ObservablesCSV(observables []*Observable) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"Type", "Value", "Count", "HostCount", "Hosts", "Sources"})
+	for _, observable := range observables {
+		hosts := sortedObservableKeys(observable.Hosts)
+		writer.Write([]string{
+			observable.Type,
+			observable.Value,
+			strconv.Itoa(observable.Count),
+			strconv.Itoa(len(hosts)),
+			strings.Join(hosts, ","),
+			strings.Join(sortedObservableKeys(observable.Sources), ","),
+		})
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+//stixID returns a STIX 2.1 identifier of an object type with a UUID derived from name, so rerunning an export gives
+//the same indicators the same IDs
+func stixID(objectType string, name string) string {
+	hash := sha1.Sum([]byte(objectType + "|" + name))
+	hash[6] = (hash[6] & 0x0f) | 0x50
+	hash[8] = (hash[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%s--%x-%x-%x-%x-%x", objectType, hash[0:4], hash[4:6], hash[6:8], hash[8:10], hash[10:16])
+}
+
+//stixString quotes a value for a STIX pattern
+func stixString(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+//stixPattern returns the STIX pattern matching an observable
+func stixPattern(observable *Observable) string {
+	value := stixString(observable.Value)
+	switch observable.Type {
+	case ObservableMD5:
+		return "[file:hashes.MD5 = " + value + "]"
+	case ObservableSHA1:
+		return "[file:hashes.'SHA-1' = " + value + "]"
+	case ObservableSHA256:
+		return "[file:hashes.'SHA-256' = " + value + "]"
+	case ObservableIPv4:
+		return "[ipv4-addr:value = " + value + "]"
+	case ObservableIPv6:
+		return "[ipv6-addr:value = " + value + "]"
+	case ObservableDomain:
+		return "[domain-name:value = " + value + "]"
+	case ObservableURL:
+		return "[url:value = " + value + "]"
+	}
+	//Windows and Unix paths
+	sep := strings.LastIndexAny(observable.Value, `\/`)
+	if sep <= 0 {
+		return "[file:name = " + value + "]"
+	}
+	return "[file:name = " + stixString(observable.Value[sep+1:]) + " AND file:parent_directory_ref.path = " + stixString(observable.Value[:sep]) + "]"
+}
+
+//STIXIndicator is an indicator of a STIX 2.1 bundle
+type STIXIndicator struct {
+	Type        string   `json:"type"`
+	SpecVersion string   `json:"spec_version"`
+	ID          string   `json:"id"`
+	Created     string   `json:"created"`
+	Modified    string   `json:"modified"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Pattern     string   `json:"pattern"`
+	PatternType string   `json:"pattern_type"`
+	ValidFrom   string   `json:"valid_from"`
+	Labels      []string `json:"labels,omitempty"`
+}
+
+//STIXBundle is a STIX 2.1 bundle of indicators
+type STIXBundle struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id"`
+	Objects []STIXIndicator `json:"objects"`
+}
+
+//ObservablesSTIX returns the observables as a STIX 2.1 bundle with an indicator per observable
+func ObservablesSTIX(options Options, observables []*Observable) ([]byte, error) {
+	now := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+	bundle := STIXBundle{Type: "bundle", ID: stixID("bundle", options.RunID), Objects: []STIXIndicator{}}
+	for _, observable := range observables {
+		hosts := sortedObservableKeys(observable.Hosts)
+		bundle.Objects = append(bundle.Objects, STIXIndicator{
+			Type:        "indicator",
+			SpecVersion: "2.1",
+			ID:          stixID("indicator", observableKey(observable.Type, observable.Value)),
+			Created:     now,
+			Modified:    now,
+			Name:        observable.Type + ": " + observable.Value,
+			Description: "Seen " + strconv.Itoa(observable.Count) + " time(s) on " + strconv.Itoa(len(hosts)) + " host(s) (" + strings.Join(hosts, ", ") + ") in " + strings.Join(sortedObservableKeys(observable.Sources), ", ") + ".",
+			Pattern:     stixPattern(observable),
+			PatternType: "stix",
+			ValidFrom:   now,
+			Labels:      []string{observable.Type},
+		})
+	}
+	return json.MarshalIndent(bundle, "", "  ")
+}
+
+//GoAuditObservables_Start exports the observables of the parsed CSV files in "-o <csv_dir>" of the '-obsa <str>' audit
+//types to "_Observables.csv" and/or "_Observables_STIX.json" in the same directory with '-obs <str>'
+func GoAuditObservables_Start(options Options) {
+	csvDir := options.OutputPath
+	files, err_r := ReadOutputDir(options, csvDir)
+	if err_r != nil {
+		options.Log.Println(options.Warnbox + "ERROR - Could not read CSV directory '" + csvDir + "'. " + err_r.Error())
+		return
+	}
+	audits := ObservablesAudits(options)
+	groups := []MergeGroup{}
+	for _, group := range GroupFilesForMerge(files) {
+		if audits[group.AuditType] && observableColumns[group.AuditType] != nil {
+			groups = append(groups, group)
+		}
+	}
+	for _, audit := range sortedObservableKeys(audits) {
+		if observableColumns[audit] == nil {
+			options.Log.Println(options.Warnbox + "WARNING - Audit type '" + audit + "' of '-obsa' has no observable columns and is not exported.")
+		}
+	}
+	if len(groups) == 0 {
+		options.Log.Println(options.Warnbox + "ERROR - Could not identify any parsed CSV files with observables in '" + csvDir + "'.")
+		return
+	}
+
+	fileCount := 0
+	for _, group := range groups {
+		fileCount += len(group.Files)
+	}
+	options.Log.Println(options.Box + "Exporting observables from " + strconv.Itoa(fileCount) + " file(s) in '" + csvDir + "'...")
+	byKey := map[string]*Observable{}
+	for _, group := range groups {
+		if err_o := ReadObservables(csvDir, group, observableColumns[group.AuditType], byKey); err_o != nil {
+			options.Log.Println(options.Warnbox + "ERROR - Could not read observables of " + group.AuditType + " of host '" + group.Hostname + "', " + err_o.Error())
+		}
+	}
+	observables := []*Observable{}
+	counts := map[string]int{}
+	for _, observable := range byKey {
+		observables = append(observables, observable)
+		counts[observable.Type]++
+	}
+	sort.Slice(observables, func(a, b int) bool {
+		if observables[a].Type != observables[b].Type {
+			return observables[a].Type < observables[b].Type
+		}
+		return observables[a].Value < observables[b].Value
+	})
+
+	for _, format := range strings.Split(options.ObservablesFormat, ",") {
+		var data []byte
+		var err_f error
+		var path string
+		switch strings.TrimSpace(format) {
+		case ObservablesFormatCSV:
+			path = filepath.Join(csvDir, ObservablesCSVFileName)
+			data, err_f = ObservablesCSV(observables)
+		case ObservablesFormatSTIX:
+			path = filepath.Join(csvDir, ObservablesSTIXFileName)
+			data, err_f = ObservablesSTIX(options, observables)
+		default:
+			continue
+		}
+		if err_f == nil {
+			err_f = WriteOutputFile(options, path, data, 0644)
+		}
+		if err_f != nil {
+			options.Log.Println(options.Warnbox + "ERROR - Could not write observables to '" + path + "'. " + err_f.Error())
+			continue
+		}
+		options.Log.Println(options.Box + "Wrote " + strconv.Itoa(len(observables)) + " observable(s) to '" + path + "'.")
+		options.Notifier.AddOutputs(path)
+	}
+	if len(observables) > 0 {
+		summary := []string{}
+		for _, observableType := range []string{ObservableMD5, ObservableSHA1, ObservableSHA256, ObservableIPv4, ObservableIPv6, ObservableDomain, ObservableURL, ObservablePath} {
+			if counts[observableType] > 0 {
+				summary = append(summary, observableType+": "+strconv.Itoa(counts[observableType]))
+			}
+		}
+		options.Log.Println(options.Box + "Observables by type - " + strings.Join(summary, ", ") + ".")
+	}
+}
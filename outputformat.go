@@ -0,0 +1,216 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Values of '-of <str>'
+const (
+	OutputFormatCSV    = "csv"
+	OutputFormatJSON   = "json"
+	OutputFormatNested = "nested"
+)
+
+//OutputFormatWriter writes the parsed rows of an audit table to a file in one output format
+type OutputFormatWriter interface {
+	//Extension returns the extension of the parsed files, such as ".csv"
+	Extension() string
+	//Write writes the rows and returns the number of lines written above them, such as the CSV headers
+	//desc is the '-pdesc' field descriptions row, or nil
+	Write(options Options, w io.Writer, headers []string, desc []string, rows [][]string) (int, error)
+	//WriteRows writes more rows of a table Write already started, for '-pstream'
+	WriteRows(options Options, w io.Writer, headers []string, rows [][]string) error
+}
+
+//Output formats of '-of <str>', '-pjson' is the same as "nested"
+var outputFormats = map[string]OutputFormatWriter{
+	OutputFormatCSV:    csvOutputFormat{},
+	OutputFormatJSON:   jsonOutputFormat{},
+	OutputFormatNested: nestedJSONOutputFormat{},
+}
+
+//GetOutputFormat returns the writer of the '-of <str>' output format, CSV if none was chosen
+func GetOutputFormat(options Options) OutputFormatWriter {
+	if format, exists := outputFormats[options.OutputFormat]; exists {
+		return format
+	}
+	return outputFormats[OutputFormatCSV]
+}
+
+//OutputFormatNames returns the names accepted by '-of <str>'
+func OutputFormatNames() []string {
+	names := []string{}
+	for name := range outputFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//OutputFileExtension returns the extension of parsed audit files, ".jsonl" for the JSON formats and ".csv" otherwise
+func OutputFileExtension(options Options) string {
+	return GetOutputFormat(options).Extension()
+}
+
+type csvOutputFormat struct{}
+
+func (csvOutputFormat) Extension() string {
+	return ".csv"
+}
+
+func (csvOutputFormat) Write(options Options, w io.Writer, headers []string, desc []string, rows [][]string) (int, error) {
+	csvout := csv.NewWriter(w)
+	csvout.Write(headers)
+	headerRows := 1
+	if desc != nil {
+		csvout.Write(desc)
+		headerRows++
+	}
+	csvout.WriteAll(rows)
+	csvout.Flush()
+	return headerRows, csvout.Error()
+}
+
+func (csvOutputFormat) WriteRows(options Options, w io.Writer, headers []string, rows [][]string) error {
+	csvout := csv.NewWriter(w)
+	csvout.WriteAll(rows)
+	csvout.Flush()
+	return csvout.Error()
+}
+
+//Field descriptions are only written to CSV files
+type nestedJSONOutputFormat struct{}
+
+func (nestedJSONOutputFormat) Extension() string {
+	return ".jsonl"
+}
+
+func (nestedJSONOutputFormat) Write(options Options, w io.Writer, headers []string, desc []string, rows [][]string) (int, error) {
+	return 0, WriteNestedJSONLines(options, w, headers, rows)
+}
+
+func (nestedJSONOutputFormat) WriteRows(options Options, w io.Writer, headers []string, rows [][]string) error {
+	return WriteNestedJSONLines(options, w, headers, rows)
+}
+
+type jsonOutputFormat struct{}
+
+func (jsonOutputFormat) Extension() string {
+	return ".jsonl"
+}
+
+func (jsonOutputFormat) Write(options Options, w io.Writer, headers []string, desc []string, rows [][]string) (int, error) {
+	return 0, WriteJSONLines(options, w, headers, rows)
+}
+
+//The column types of the later rows are not known, so '-pstream' does not allow this format
+func (jsonOutputFormat) WriteRows(options Options, w io.Writer, headers []string, rows [][]string) error {
+	return WriteJSONLines(options, w, headers, rows)
+}
+
+//JSON types of the columns of a table
+const (
+	jsonColumnString = iota
+	jsonColumnNumber
+	jsonColumnBool
+)
+
+//Returns true for integers written the same way JSON writes them back, so IDs such as "0012" stay strings
+func isJSONInteger(value string) bool {
+	n, err_p := strconv.ParseInt(value, 10, 64)
+	return err_p == nil && strconv.FormatInt(n, 10) == value
+}
+
+//Returns the JSON type of each column, a column is a number or bool only if every value of it in the table is one
+//so a field keeps the same type in every object of the file
+func jsonColumnTypes(options Options, headers []string, rows [][]string) []int {
+	sep := GetMultiValueSeparator(options)
+	types := make([]int, len(headers))
+	for i := range headers {
+		isNumber, isBool, seen := true, true, false
+		for _, row := range rows {
+			if i >= len(row) || row[i] == "" {
+				continue
+			}
+			for _, value := range strings.Split(row[i], sep) {
+				seen = true
+				isNumber = isNumber && isJSONInteger(value)
+				isBool = isBool && (value == "true" || value == "false")
+			}
+			if !isNumber && !isBool {
+				break
+			}
+		}
+		if seen && isNumber {
+			types[i] = jsonColumnNumber
+		} else if seen && isBool {
+			types[i] = jsonColumnBool
+		}
+	}
+	return types
+}
+
+//Returns a value as the JSON type of its column
+func jsonTypedValue(value string, columnType int) interface{} {
+	switch columnType {
+	case jsonColumnNumber:
+		n, _ := strconv.ParseInt(value, 10, 64)
+		return n
+	case jsonColumnBool:
+		return value == "true"
+	}
+	return value
+}
+
+//JSONItem returns a row as one flat JSON object keyed by the headers in their order
+//Multi-value cells become arrays and empty cells are left out. types are the column types of jsonColumnTypes
+func JSONItem(options Options, headers []string, types []int, row []string) ([]byte, error) {
+	sep := GetMultiValueSeparator(options)
+	object := &nestedJSONObject{values: map[string]interface{}{}}
+	for i, header := range headers {
+		if i >= len(row) || row[i] == "" {
+			continue
+		}
+		values := strings.Split(row[i], sep)
+		if len(values) == 1 {
+			object.set(header, jsonTypedValue(values[0], types[i]))
+			continue
+		}
+		array := make([]interface{}, len(values))
+		for j, value := range values {
+			array[j] = jsonTypedValue(value, types[i])
+		}
+		object.set(header, array)
+	}
+	return marshalNestedJSON(object)
+}
+
+//WriteJSONLines writes each row as a flat JSON object on its own line
+func WriteJSONLines(options Options, w io.Writer, headers []string, rows [][]string) error {
+	types := jsonColumnTypes(options, headers, rows)
+	writer := bufio.NewWriter(w)
+	for _, row := range rows {
+		b, err_m := JSONItem(options, headers, types, row)
+		if err_m != nil {
+			return err_m
+		}
+		writer.Write(b)
+		writer.WriteString("\n")
+	}
+	return writer.Flush()
+}
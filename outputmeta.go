@@ -0,0 +1,285 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//OutputMetaSuffix is appended to the name of a parsed file for its '-pmeta' sidecar
+const OutputMetaSuffix = ".meta.json"
+
+//Levels of 'goauditparser verify-outputs -level <str>', each also checks the ones before it
+const (
+	OutputVerifySize = "size"
+	OutputVerifyRows = "rows"
+	OutputVerifyFull = "full"
+)
+
+//OutputMeta is the "<file>.meta.json" sidecar of a parsed file, used to check the file after it was copied to another system
+//Rows do not include the header row, or the field descriptions row of '-pdesc' which HeaderRows counts. Neither counts
+//the provenance line of '-pprov comment'. Generated is when the file was written, "2020-06-01 12:00:00 UTC"
+type OutputMeta struct {
+	File       string `json:"file"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"`
+	Rows       int    `json:"rows"`
+	Columns    int    `json:"columns"`
+	HeaderRows int    `json:"header_rows"`
+	Source     string `json:"source"` //Input file, its hostname replaced by the pseudonym of '-redact'
+	Version    string `json:"version"`
+	Generated  string `json:"generated,omitempty"`
+}
+
+//NewOutputMetaHash returns the hash a parsed file is written through for its sidecar, or nil if '-pmeta' was not used
+func NewOutputMetaHash(options Options) hash.Hash {
+	if !options.ParseOutputMeta {
+		return nil
+	}
+	return sha256.New()
+}
+
+//OutputMetaWriter returns w, writing through h as well if it is not nil
+func OutputMetaWriter(w io.Writer, h hash.Hash) io.Writer {
+	if h == nil {
+		return w
+	}
+	return io.MultiWriter(w, h)
+}
+
+//WriteOutputMeta writes the sidecar of a parsed file once it has its final name
+//Without '-pmeta' (h is nil) the sidecar of an earlier run is removed instead, since it no longer matches the file
+func WriteOutputMeta(options Options, path string, h hash.Hash, source string, headers []string, headerRows int, rows int) error {
+	metaPath := path + OutputMetaSuffix
+	if h == nil {
+		os.Remove(metaPath)
+		return nil
+	}
+	info, err_s := os.Stat(path)
+	if err_s != nil {
+		return err_s
+	}
+	meta := OutputMeta{
+		File:       filepath.Base(path),
+		Size:       info.Size(),
+		SHA256:     hex.EncodeToString(h.Sum(nil)),
+		Rows:       rows,
+		Columns:    len(headers),
+		HeaderRows: headerRows,
+		Source:     RedactedInputPath(options, source),
+		Version:    version,
+		Generated:  time.Now().UTC().Format(NormalizedTimeLayout) + " UTC",
+	}
+	b, err_m := json.MarshalIndent(meta, "", "  ")
+	if err_m != nil {
+		return err_m
+	}
+	if err_w := WriteOutputFile(options, TempOutputPath(options, metaPath), b, 0644); err_w != nil {
+		os.Remove(TempOutputPath(options, metaPath))
+		return err_w
+	}
+	return os.Rename(TempOutputPath(options, metaPath), metaPath)
+}
+
+//VerifyOutputMeta checks a parsed file against its sidecar up to the level and returns the differences
+func VerifyOutputMeta(path string, meta OutputMeta, level string) ([]string, error) {
+	info, err_s := os.Stat(path)
+	if err_s != nil {
+		return nil, err_s
+	}
+	problems := []string{}
+	if info.Size() != meta.Size {
+		problems = append(problems, "size is "+strconv.FormatInt(info.Size(), 10)+" bytes, expected "+strconv.FormatInt(meta.Size, 10))
+	}
+	if level == OutputVerifySize || len(problems) > 0 {
+		return problems, nil
+	}
+
+	file, err_o := os.Open(path)
+	if err_o != nil {
+		return nil, err_o
+	}
+	defer file.Close()
+	h := sha256.New()
+	reader := bufio.NewReader(io.TeeReader(bufio.NewReaderSize(file, 1024*1024), h))
+	//The '-pprov comment' line is not a header row
+	skipProvenanceComment(reader)
+	rows, columns := 0, meta.Columns
+	if strings.HasSuffix(path, ".jsonl") {
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024*1024)
+		for scanner.Scan() {
+			if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+				rows++
+			}
+		}
+		if err_r := scanner.Err(); err_r != nil {
+			return append(problems, "could not be read: "+err_r.Error()), nil
+		}
+	} else {
+		records := csv.NewReader(reader)
+		records.ReuseRecord = true
+		for i := 0; ; i++ {
+			record, err_r := records.Read()
+			if err_r == io.EOF {
+				break
+			}
+			if err_r != nil {
+				return append(problems, "could not be read: "+err_r.Error()), nil
+			}
+			if i == 0 {
+				columns = len(record)
+			}
+			if i >= meta.HeaderRows {
+				rows++
+			}
+		}
+	}
+	if rows != meta.Rows {
+		problems = append(problems, "has "+strconv.Itoa(rows)+" rows, expected "+strconv.Itoa(meta.Rows))
+	}
+	if columns != meta.Columns {
+		problems = append(problems, "has "+strconv.Itoa(columns)+" columns, expected "+strconv.Itoa(meta.Columns))
+	}
+	if level == OutputVerifyRows {
+		return problems, nil
+	}
+
+	//Reads whatever the row count did not
+	io.Copy(ioutil.Discard, reader)
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != meta.SHA256 {
+		problems = append(problems, "SHA256 is "+sum+", expected "+meta.SHA256)
+	}
+	return problems, nil
+}
+
+//GoAuditVerifyOutputs_Start checks the parsed files of an output directory against their '-pmeta' sidecars
+//Returns 0 if every file matches, 1 if any file is missing or differs
+func GoAuditVerifyOutputs_Start(args []string) int {
+	flags := flag.NewFlagSet("verify-outputs", flag.ContinueOnError)
+	flags.SetOutput(os.Stdout)
+	flags.Usage = func() {
+		fmt.Println("Usage: goauditparser verify-outputs -o <csv_dir> [-level size|rows|full] [-v]")
+		fmt.Println("   Ex: goauditparser verify-outputs -o parsed -level rows")
+	}
+	outputDir := ""
+	level := ""
+	verbose := false
+	flags.StringVar(&outputDir, "o", "", "")
+	flags.StringVar(&level, "level", OutputVerifyFull, "")
+	flags.BoolVar(&verbose, "v", false, "")
+	if err_p := flags.Parse(args); err_p != nil {
+		return FlagConflictExitCode
+	}
+	if outputDir == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return FlagConflictExitCode
+	}
+	level = strings.ToLower(strings.TrimSpace(level))
+	if level != OutputVerifySize && level != OutputVerifyRows && level != OutputVerifyFull {
+		fmt.Println("[!] ERROR - Unknown verification level '" + level + "'. Use \"size\", \"rows\", or \"full\".")
+		return FlagConflictExitCode
+	}
+
+	files, err_r := ioutil.ReadDir(outputDir)
+	if err_r != nil {
+		fmt.Println("[!] ERROR - Could not read output directory '" + outputDir + "'. " + err_r.Error())
+		return 1
+	}
+	sidecars := map[string]bool{}
+	unverified := 0
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, OutputMetaSuffix) {
+			sidecars[name] = true
+		}
+	}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || strings.HasSuffix(name, TempFileSuffix) || sidecars[name+OutputMetaSuffix] {
+			continue
+		}
+		if (strings.HasSuffix(name, ".csv") || strings.HasSuffix(name, ".jsonl")) && IsGoAuditParserOutputFile(name) {
+			unverified++
+			if verbose {
+				fmt.Println("[+] NOTICE - File '" + name + "' has no sidecar and was not verified.")
+			}
+		}
+	}
+
+	names := []string{}
+	for name := range sidecars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	matched, differed, missing := 0, 0, 0
+	for _, name := range names {
+		metaPath := filepath.Join(outputDir, name)
+		path := strings.TrimSuffix(metaPath, OutputMetaSuffix)
+		meta := OutputMeta{}
+		b, err_o := ioutil.ReadFile(metaPath)
+		if err_o == nil {
+			err_o = json.Unmarshal(b, &meta)
+		}
+		if err_o != nil {
+			fmt.Println("[!] ERROR - Could not read sidecar '" + metaPath + "'. " + err_o.Error())
+			differed++
+			continue
+		}
+		problems, err_v := VerifyOutputMeta(path, meta, level)
+		if os.IsNotExist(err_v) {
+			fmt.Println("[!] MISSING - File '" + filepath.Base(path) + "' of sidecar '" + name + "' does not exist.")
+			missing++
+			continue
+		} else if err_v != nil {
+			fmt.Println("[!] ERROR - Could not verify file '" + path + "'. " + err_v.Error())
+			differed++
+			continue
+		}
+		if len(problems) > 0 {
+			fmt.Println("[!] DIFFERS - File '" + filepath.Base(path) + "' " + strings.Join(problems, ", ") + ".")
+			differed++
+			continue
+		}
+		matched++
+		if verbose {
+			fmt.Println("[+] OK - File '" + filepath.Base(path) + "' matches its sidecar.")
+		}
+	}
+
+	fmt.Println("[+] Verified " + strconv.Itoa(len(names)) + " file(s) in '" + outputDir + "' at level '" + level + "': " + strconv.Itoa(matched) + " matched, " + strconv.Itoa(differed) + " differed, " + strconv.Itoa(missing) + " missing.")
+	if unverified > 0 {
+		fmt.Println("[+] NOTICE - " + strconv.Itoa(unverified) + " output file(s) have no sidecar and were not verified, use '-v' to list them.")
+	}
+	if differed > 0 || missing > 0 {
+		return 1
+	}
+	return 0
+}
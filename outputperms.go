@@ -0,0 +1,127 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+//ParseOutputPermissions reads an octal permission string like "0640", "" means the default permissions
+func ParseOutputPermissions(perm string) (os.FileMode, error) {
+	if perm == "" {
+		return 0, nil
+	}
+	mode, err_p := strconv.ParseUint(perm, 8, 32)
+	if err_p != nil || mode > 0777 {
+		return 0, errors.New("'" + perm + "' is not an octal permission like '0640'")
+	}
+	return os.FileMode(mode), nil
+}
+
+//LookupOutputGroup returns the numeric ID of a group name or ID, "" means the default group
+func LookupOutputGroup(group string) (string, error) {
+	if group == "" {
+		return "", nil
+	}
+	if _, err_a := strconv.Atoi(group); err_a == nil {
+		return group, nil
+	}
+	g, err_l := user.LookupGroup(group)
+	if err_l != nil {
+		return "", err_l
+	}
+	return g.Gid, nil
+}
+
+//Chmod even though the file was created with the mode, since the umask may have removed bits
+func applyOutputPermissions(options Options, path string, mode os.FileMode) error {
+	if mode != 0 {
+		if err_c := os.Chmod(path, mode); err_c != nil {
+			return err_c
+		}
+	}
+	if options.OutputGroupID != "" {
+		gid, _ := strconv.Atoi(options.OutputGroupID)
+		if err_c := os.Chown(path, -1, gid); err_c != nil {
+			return err_c
+		}
+	}
+	return nil
+}
+
+//CreateOutputFile creates or truncates a file like os.Create, applying the '-perm' and '-group' output permissions
+func CreateOutputFile(options Options, path string) (*os.File, error) {
+	return OpenOutputFile(options, path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+//OpenOutputFile opens a file like os.OpenFile, perm is only used if '-perm' was not set
+func OpenOutputFile(options Options, path string, flag int, perm os.FileMode) (*os.File, error) {
+	if options.FileMode != 0 {
+		perm = options.FileMode
+	}
+	file, err_o := os.OpenFile(path, flag, perm)
+	if err_o != nil {
+		return nil, err_o
+	}
+	if flag&os.O_CREATE != 0 {
+		if err_a := applyOutputPermissions(options, path, options.FileMode); err_a != nil {
+			file.Close()
+			return nil, err_a
+		}
+	}
+	return file, nil
+}
+
+//WriteOutputFile writes a file like ioutil.WriteFile, perm is only used if '-perm' was not set
+func WriteOutputFile(options Options, path string, data []byte, perm os.FileMode) error {
+	if options.FileMode != 0 {
+		perm = options.FileMode
+	}
+	if err_w := ioutil.WriteFile(path, data, perm); err_w != nil {
+		return err_w
+	}
+	return applyOutputPermissions(options, path, options.FileMode)
+}
+
+//MkdirAllOutput creates a directory and its parents like os.MkdirAll, applying the '-dirperm' and '-group' output permissions to the directories it creates
+func MkdirAllOutput(options Options, path string) error {
+	if options.DirMode == 0 && options.OutputGroupID == "" {
+		return os.MkdirAll(path, os.ModePerm)
+	}
+	missing := []string{}
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, err_s := os.Stat(dir); err_s == nil {
+			break
+		}
+		missing = append(missing, dir)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	mode := options.DirMode
+	if mode == 0 {
+		mode = os.ModePerm
+	}
+	if err_m := os.MkdirAll(path, mode); err_m != nil {
+		return err_m
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err_a := applyOutputPermissions(options, missing[i], options.DirMode); err_a != nil {
+			return err_a
+		}
+	}
+	return nil
+}
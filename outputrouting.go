@@ -0,0 +1,98 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+//OutputRoute sends the parsed files of matching audit types to a subdirectory of the output directory
+//Audit types may use "*" and "?" wildcards, such as "EventItem_*", and are matched ignoring case
+type OutputRoute struct {
+	AuditTypes []string `json:"Audit_Types"`
+	Directory  string   `json:"Directory"`
+}
+
+//AuditOutputDir returns the directory the parsed files of an audit type are written to
+//This is the output directory unless an "Output_Routes" entry of the main config matches, the first match is used
+func AuditOutputDir(options Options, auditType string) string {
+	for _, route := range options.Config.OutputRoutes {
+		for _, pattern := range route.AuditTypes {
+			if matched, _ := path.Match(strings.ToLower(pattern), strings.ToLower(auditType)); matched {
+				return filepath.Join(options.OutputPath, filepath.FromSlash(route.Directory))
+			}
+		}
+	}
+	return options.OutputPath
+}
+
+//OutputRouteDirs returns the output directory and the relative path of each of its "Output_Routes" subdirectories
+//which readers of the parsed files, such as the timeliner, look in. The output directory itself is ""
+func OutputRouteDirs(options Options) []string {
+	dirs := []string{""}
+	seen := map[string]bool{"": true}
+	for _, route := range options.Config.OutputRoutes {
+		dir := filepath.Clean(filepath.FromSlash(route.Directory))
+		if dir == "." || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+//ReadOutputDir returns the files of an output directory and of its "Output_Routes" subdirectories
+//Names are relative to the directory, such as "realtime/<hostname>-<agentid>-0-EventItem_process.csv"
+//Subdirectories which do not exist are skipped, an error is only returned if the directory can't be read
+func ReadOutputDir(options Options, dir string) ([]string, error) {
+	names := []string{}
+	for _, sub := range OutputRouteDirs(options) {
+		files, err_r := ioutil.ReadDir(filepath.Join(dir, sub))
+		if err_r != nil {
+			if sub != "" && os.IsNotExist(err_r) {
+				continue
+			}
+			return nil, err_r
+		}
+		for _, file := range files {
+			if !file.IsDir() {
+				names = append(names, filepath.Join(sub, file.Name()))
+			}
+		}
+	}
+	return names, nil
+}
+
+//ValidateOutputRoutes returns an error for an "Output_Routes" entry which could not be used
+//Directories must be relative and stay inside of the output directory
+func ValidateOutputRoutes(routes []OutputRoute) error {
+	for _, route := range routes {
+		dir := filepath.Clean(filepath.FromSlash(route.Directory))
+		if strings.TrimSpace(route.Directory) == "" || filepath.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, ".."+string(filepath.Separator)) {
+			return errors.New("directory '" + route.Directory + "' must be a subdirectory of the output directory, such as \"realtime\"")
+		}
+		if len(route.AuditTypes) == 0 {
+			return errors.New("directory '" + route.Directory + "' has no 'Audit_Types'")
+		}
+		for _, pattern := range route.AuditTypes {
+			if _, err_m := path.Match(pattern, ""); err_m != nil {
+				return errors.New("audit type '" + pattern + "' of directory '" + route.Directory + "' is not a valid pattern")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//PrunedParseCacheFile is a parse cache entry removed because its XML file no longer exists
+type PrunedParseCacheFile struct {
+	OutputDirectory string
+	File            Parse_Config_XMLFile
+	CSVMissing      bool //Only set by '-prune-cache', true if no CSV file of the XML file is left in the output directory
+}
+
+//ReconcileParseCache removes the XML file entries of every output directory whose file is in neither
+//the input directory, its "xmlsplit" directory, nor its '-readonly-input' scratch directory, such as XML files deleted after parsing to save space
+//Entries of XML files which exist with a different size are kept, they are only matched by name and size
+func ReconcileParseCache(options Options, config Parse_Config_JSON) (Parse_Config_JSON, []PrunedParseCacheFile) {
+	pruned := []PrunedParseCacheFile{}
+	exists := map[string]bool{}
+	sourceExists := func(name string) bool {
+		if found, checked := exists[name]; checked {
+			return found
+		}
+		found := false
+		for _, dir := range []string{options.InputPath, XMLSplitDir(options), InputScratchDir(options)} {
+			if _, err_s := os.Stat(filepath.Join(dir, name)); err_s == nil {
+				found = true
+				break
+			}
+		}
+		exists[name] = found
+		return found
+	}
+	for i, outdir := range config.OutputDirectories {
+		kept := outdir.XMLFiles[:0]
+		for _, xmlFile := range outdir.XMLFiles {
+			//XML files parsed from memory with '-emem <int>' were never on disk, their archives are cached instead
+			if xmlFile.InMemory || sourceExists(xmlFile.InputFileName) {
+				kept = append(kept, xmlFile)
+				continue
+			}
+			pruned = append(pruned, PrunedParseCacheFile{OutputDirectory: outdir.OutputDirectory, File: xmlFile})
+		}
+		config.OutputDirectories[i].XMLFiles = kept
+	}
+	return config, pruned
+}
+
+//ConfirmPrunedCSVs sets CSVMissing for pruned XML files which were parsed but have no CSV file left in their output directory
+//Only standard "<hostname>-<agentid>-<payload>-<generator>.xml" names can be matched to their CSV files
+//CSV files in the "Output_Routes" subdirectories of the main config are included
+func ConfirmPrunedCSVs(options Options, pruned []PrunedParseCacheFile) []PrunedParseCacheFile {
+	csvFiles := map[string][]string{}
+	for i, p := range pruned {
+		if p.File.Status != "parsed" {
+			continue
+		}
+		parts := strings.Split(strings.TrimSuffix(p.File.InputFileName, filepath.Ext(p.File.InputFileName)), "-")
+		if len(parts) < 4 {
+			continue
+		}
+		if _, read := csvFiles[p.OutputDirectory]; !read {
+			files, _ := ReadOutputDir(options, p.OutputDirectory)
+			names := []string{}
+			for _, name := range files {
+				if strings.HasSuffix(name, ".csv") {
+					names = append(names, filepath.Base(name))
+				}
+			}
+			csvFiles[p.OutputDirectory] = names
+		}
+		//The hostname may have been normalized, so match the Agent ID and payload, or the "0" payload of '-pcf 2'
+		agentid, payload := parts[len(parts)-3], parts[len(parts)-2]
+		format2 := "0"
+		if indx := strings.Index(payload, "_spxml"); indx != -1 {
+			format2 = "0" + payload[indx:]
+		}
+		found := false
+		for _, name := range csvFiles[p.OutputDirectory] {
+			if strings.Contains(name, "-"+agentid+"-"+payload+"-") || strings.Contains(name, "-"+agentid+"-"+format2+"-") {
+				found = true
+				break
+			}
+		}
+		pruned[i].CSVMissing = !found
+	}
+	return pruned
+}
+
+//PrintPrunedParseCache reports the entries '-prune-cache' removed from the parse cache of the input directory
+func PrintPrunedParseCache(options Options, pruned []PrunedParseCacheFile) {
+	missing := 0
+	for _, p := range pruned {
+		if p.CSVMissing {
+			missing++
+			options.Log.Println(options.Warnbox + "WARNING - XML file '" + p.File.InputFileName + "' and its CSV output in '" + p.OutputDirectory + "' no longer exist.")
+		} else if options.Verbose > 0 {
+			options.Log.Println(options.Box + "Pruned '" + p.File.InputFileName + "' (" + p.File.Status + ") from output directory '" + p.OutputDirectory + "'.")
+		}
+	}
+	msg := options.Box + "Pruned " + strconv.Itoa(len(pruned)) + " parse cache entries of XML files which no longer exist in '" + options.InputPath + "'."
+	if missing > 0 {
+		msg += " " + strconv.Itoa(missing) + " of them have no CSV output left either."
+	}
+	fmt.Println(msg)
+}
@@ -0,0 +1,193 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+//Values of '-pap'
+const (
+	ParseAnomalyPolicyStrict  = "strict"
+	ParseAnomalyPolicyLenient = "lenient"
+)
+
+//Kinds of parse anomalies
+const (
+	ParseAnomalyUnexpectedTag  = "UnexpectedTag"
+	ParseAnomalyUnknownState   = "UnknownState"
+	ParseAnomalyOversizedValue = "OversizedValue"
+)
+
+//Bytes kept from the end of a line which did not fit in the read buffer, enough for the closing tags after an oversized value
+const truncatedLineTail = 4096
+
+//ParseAnomaly is an oddity in an XML file, such as a tag the parser did not expect
+type ParseAnomaly struct {
+	File    string
+	Line    int
+	Kind    string
+	Message string
+}
+
+//ParseAnomalies decides how the parser treats the anomalies of one XML file
+//With the strict policy every anomaly fails the file. With the lenient policy the audit item is skipped,
+//oversized lines are truncated, and parsing continues with the anomaly recorded
+type ParseAnomalies struct {
+	Lenient   bool
+	File      string
+	Anomalies []ParseAnomaly
+	truncated int //Length of the last line the read buffer truncated, recorded once the parser knows its line number
+}
+
+//NewParseAnomalies returns the anomaly policy of '-pap' for an XML file
+func NewParseAnomalies(options Options, xmlFileName string) *ParseAnomalies {
+	return &ParseAnomalies{Lenient: options.ParseAnomalyPolicy == ParseAnomalyPolicyLenient, File: RedactedInputName(options, xmlFileName)}
+}
+
+//Continue records an anomaly and returns true if the parser should skip the rest of the audit item
+//A nil or strict policy returns false, so the file fails with ParseAnomalyError like before
+func (a *ParseAnomalies) Continue(line int, kind string, message string) bool {
+	if a == nil || !a.Lenient {
+		return false
+	}
+	a.Anomalies = append(a.Anomalies, ParseAnomaly{a.File, line, kind, message})
+	return true
+}
+
+//RecordTruncation records the line just read if the read buffer truncated it
+func (a *ParseAnomalies) RecordTruncation(line int) {
+	if a == nil || a.truncated == 0 {
+		return
+	}
+	a.Anomalies = append(a.Anomalies, ParseAnomaly{a.File, line, ParseAnomalyOversizedValue, "Line of " + strconv.Itoa(a.truncated) + " bytes was truncated to fit '-plb <int>'."})
+	a.truncated = 0
+}
+
+//ScanLines returns the split function of the XML line scanner
+//With the lenient policy, a line which does not fit in the read buffer keeps its first bytes and its last
+//4 KB instead of stopping the scanner, so the tags around an oversized value still match
+func (a *ParseAnomalies) ScanLines(bufferSize int) bufio.SplitFunc {
+	if a == nil || !a.Lenient {
+		return bufio.ScanLines
+	}
+	keep := bufferSize - truncatedLineTail
+	if keep < 1 {
+		keep = bufferSize / 2
+	}
+	var head, tail []byte
+	length := 0
+	discarding := false
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if !discarding {
+			advance, token, err := bufio.ScanLines(data, atEOF)
+			if advance > 0 || token != nil || err != nil || len(data) < bufferSize {
+				return advance, token, err
+			}
+			//The read buffer is full without a line break
+			head = append([]byte{}, data[:keep]...)
+			tail = append([]byte{}, data[keep:]...)
+			length = len(data)
+			discarding = true
+			return len(data), nil, nil
+		}
+		i := bytes.IndexByte(data, '\n')
+		if i == -1 && !atEOF {
+			tail = append(tail, data...)
+			if len(tail) > truncatedLineTail {
+				tail = append([]byte{}, tail[len(tail)-truncatedLineTail:]...)
+			}
+			length += len(data)
+			return len(data), nil, nil
+		}
+		advance := i + 1
+		if i == -1 {
+			i = len(data)
+			advance = len(data)
+		}
+		tail = append(tail, data[:i]...)
+		length += i
+		if len(tail) > truncatedLineTail {
+			tail = tail[len(tail)-truncatedLineTail:]
+		}
+		token := append(head, bytes.TrimSuffix(tail, []byte("\r"))...)
+		a.truncated = length
+		head, tail, discarding = nil, nil, false
+		return advance, token, nil
+	}
+}
+
+//Note returns the warning appended to the success message of a file parsed past anomalies
+func (a *ParseAnomalies) Note() string {
+	if a == nil || len(a.Anomalies) == 0 {
+		return ""
+	}
+	first := a.Anomalies[0]
+	return ` WARNING - Continued past ` + strconv.Itoa(len(a.Anomalies)) + ` parse anomalies, first on line ` + strconv.Itoa(first.Line) + `: ` + first.Message
+}
+
+//ParseAnomalyError returns the error message of an anomaly which fails the file
+func ParseAnomalyError(options Options, kind string, xmlFileName string, message string) string {
+	if kind == ParseAnomalyUnknownState {
+		return options.Warnbox + `INTERNAL ERROR - Could not parse file '` + xmlFileName + `'. ` + message
+	}
+	return options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. ` + message
+}
+
+//ParseAnomalyLog collects the anomalies of every XML file of a run for "_GAPParseAnomalies.csv"
+type ParseAnomalyLog struct {
+	mu        sync.Mutex
+	anomalies []ParseAnomaly
+}
+
+//Add records the anomalies of a parsed file, a nil log is ignored
+func (log *ParseAnomalyLog) Add(a *ParseAnomalies) {
+	if log == nil || a == nil || len(a.Anomalies) == 0 {
+		return
+	}
+	log.mu.Lock()
+	log.anomalies = append(log.anomalies, a.Anomalies...)
+	log.mu.Unlock()
+}
+
+//Len returns the number of anomalies recorded
+func (log *ParseAnomalyLog) Len() int {
+	if log == nil {
+		return 0
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return len(log.anomalies)
+}
+
+//Save writes the anomalies of this run to "_GAPParseAnomalies.csv" in the output directory
+func (log *ParseAnomalyLog) Save(options Options) (string, error) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	csvPath := filepath.Join(options.OutputPath, "_GAPParseAnomalies.csv")
+	csvFile, err_c := CreateOutputFile(options, csvPath)
+	if err_c != nil {
+		return csvPath, err_c
+	}
+	writer := csv.NewWriter(csvFile)
+	writer.Write([]string{"File", "Line", "Kind", "Message"})
+	for _, anomaly := range log.anomalies {
+		writer.Write([]string{anomaly.File, strconv.Itoa(anomaly.Line), anomaly.Kind, anomaly.Message})
+	}
+	writer.Flush()
+	csvFile.Close()
+	return csvPath, writer.Error()
+}
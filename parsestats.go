@@ -0,0 +1,272 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//ParseAuditStat is the number of rows parsed into one audit table of an XML file
+type ParseAuditStat struct {
+	Hostname  string
+	AuditType string
+	Rows      int
+}
+
+//ParseStatCounts holds the file statuses and row counts of one host or audit type
+type ParseStatCounts struct {
+	Parsed  int `json:"parsed"`
+	Failed  int `json:"failed"`
+	Cached  int `json:"cached"`
+	Empty   int `json:"empty"`
+	Issues  int `json:"issues"`
+	Skipped int `json:"skipped"` //XML files which are not audits
+	Rows    int `json:"rows"`
+}
+
+//ParseRunSummary is written to "_GAPRunSummary.json" in the output directory after parsing
+type ParseRunSummary struct {
+	Version     string                     `json:"version"`
+	Finished    string                     `json:"finished"`
+	Elapsed     string                     `json:"elapsed"`
+	InputPath   string                     `json:"input_path"`
+	OutputPath  string                     `json:"output_path"`
+	Files       int                        `json:"files"`
+	Totals      ParseStatCounts            `json:"totals"`
+	ByHost      map[string]ParseStatCounts `json:"by_host"`
+	ByAuditType map[string]ParseStatCounts `json:"by_audit_type"`
+	FileStatus  map[string]string          `json:"file_status,omitempty"`
+	//Audits requested by script.xml or listed in manifest.json of the extracted archives without an audit to parse
+	AuditMismatches []AuditMismatch `json:"audit_mismatches,omitempty"`
+	options         Options         //Redacts the hostnames of file names with '-redact'
+}
+
+//ParseRunDiff holds the XML files whose status changed since the previous run over the same input
+type ParseRunDiff struct {
+	New         []string //Files the previous run did not see
+	Parsed      []string //Files parsed in this run instead of being cached
+	NewlyFailed []string //Files which failed in this run but not in the previous one
+	Recovered   []string //Files which failed in the previous run but not in this one
+	Removed     []string //Files of the previous run which are no longer in the input
+}
+
+//SplitPrefixIdentity returns the hostname and agent ID of a "<hostname>-<agentid>-<payload>" prefix, hostnames may contain dashes
+func SplitPrefixIdentity(prefix string) (string, string) {
+	parts := strings.Split(prefix, "-")
+	if len(parts) < 3 {
+		return "", ""
+	}
+	return strings.Join(parts[0:len(parts)-2], "-"), parts[len(parts)-2]
+}
+
+//NewParseRunSummary creates an empty run summary for the parse options
+func NewParseRunSummary(options Options) ParseRunSummary {
+	return ParseRunSummary{
+		Version:     version,
+		InputPath:   RedactedInputPath(options, options.InputPath),
+		OutputPath:  options.OutputPath,
+		ByHost:      map[string]ParseStatCounts{},
+		ByAuditType: map[string]ParseStatCounts{},
+		FileStatus:  map[string]string{},
+		options:     options,
+	}
+}
+
+//SetFileStatus records the status of an XML file which did not go through Add, such as one skipped by the parse cache
+func (summary *ParseRunSummary) SetFileStatus(xmlFileName string, status string) {
+	if status != "" {
+		summary.FileStatus[RedactedInputName(summary.options, xmlFileName)] = status
+	}
+}
+
+//Add records the final status of one XML file
+//Files that did not produce CSV output are attributed to the hostname and audit type in their filename
+func (summary *ParseRunSummary) Add(options Options, done ThreadReturn_Parse, status string) {
+	summary.Files++
+	summary.SetFileStatus(done.xmlfile, status)
+	if status == "parsed" && len(done.audits) > 0 {
+		for i, audit := range done.audits {
+			hostname := audit.Hostname
+			if hostname == "" {
+				hostname = "Unknown"
+			}
+			auditType := audit.AuditType
+			if auditType == "" {
+				auditType = "Unknown"
+			}
+			//Eventbuffer audits have a table per event type but only count as one parsed file per host
+			summary.addCounts(hostname, auditType, status, i == 0, audit.Rows)
+		}
+		return
+	}
+	hostname, auditType := parseStatsFileIdentity(options, done.xmlfile)
+	summary.addCounts(hostname, auditType, status, true, 0)
+}
+
+func (summary *ParseRunSummary) addCounts(hostname string, auditType string, status string, countHost bool, rows int) {
+	host := summary.ByHost[hostname]
+	audit := summary.ByAuditType[auditType]
+	if countHost {
+		parseStatsIncrement(&host, status)
+		parseStatsIncrement(&summary.Totals, status)
+	}
+	parseStatsIncrement(&audit, status)
+	host.Rows += rows
+	audit.Rows += rows
+	summary.Totals.Rows += rows
+	summary.ByHost[hostname] = host
+	summary.ByAuditType[auditType] = audit
+}
+
+func parseStatsIncrement(counts *ParseStatCounts, status string) {
+	switch status {
+	case "parsed":
+		counts.Parsed++
+	case "failed":
+		counts.Failed++
+	case "cached":
+		counts.Cached++
+	case "empty":
+		counts.Empty++
+	case "issues":
+		counts.Issues++
+	case "skipped":
+		counts.Skipped++
+	}
+}
+
+//"<hostname>-<agentid>-<payload>-<audittype>.xml", anything else is attributed to the alternate hostname or "Unknown"
+func parseStatsFileIdentity(options Options, xmlFileName string) (string, string) {
+	hostname := "Unknown"
+	auditType := "Unknown"
+	basefilename := strings.TrimSuffix(filepath.Base(xmlFileName), ".xml")
+	parts := strings.Split(basefilename, "-")
+	if !strings.Contains(basefilename, ".urn_uuid_") && len(parts) >= 4 {
+		hostname = strings.Join(parts[0:len(parts)-3], "-")
+		auditType = parts[len(parts)-1]
+	}
+	if len(options.ParseAltHostname) > 0 {
+		hostname = options.ParseAltHostname
+	}
+	if hostname != "Unknown" {
+		hostname, _ = RedactedSidecarHostname(options, hostname)
+	}
+	return hostname, auditType
+}
+
+//Print shows the per audit type table, and the per host table if verbose or there are only a few hosts
+func (summary ParseRunSummary) Print(options Options) {
+	printParseStatsTable(options, "Audit Type", summary.ByAuditType)
+	if options.Verbose > 0 || len(summary.ByHost) <= 20 {
+		printParseStatsTable(options, "Hostname", summary.ByHost)
+	} else {
+		options.Log.Println(options.Box + "Parse statistics for " + strconv.Itoa(len(summary.ByHost)) + " hosts are in '" + filepath.Join(options.OutputPath, "_GAPRunSummary.json") + "'. Use '-v' to print them.")
+	}
+}
+
+func printParseStatsTable(options Options, title string, counts map[string]ParseStatCounts) {
+	keys := []string{}
+	width := len(title)
+	for key := range counts {
+		keys = append(keys, key)
+		if len(key) > width {
+			width = len(key)
+		}
+	}
+	sort.Strings(keys)
+
+	format := options.Box + "%-" + strconv.Itoa(width) + "s %8s %8s %8s %8s %8s %8s %10s\n"
+	options.Log.Println(options.Box + "Parse Statistics by " + title + ":")
+	fmt.Printf(format, title, "Parsed", "Failed", "Cached", "Empty", "Issues", "Skipped", "Rows")
+	for _, key := range keys {
+		c := counts[key]
+		fmt.Printf(format, key, strconv.Itoa(c.Parsed), strconv.Itoa(c.Failed), strconv.Itoa(c.Cached), strconv.Itoa(c.Empty), strconv.Itoa(c.Issues), strconv.Itoa(c.Skipped), strconv.Itoa(c.Rows))
+	}
+}
+
+//Save writes the run summary to "_GAPRunSummary.json" in the output directory
+func (summary ParseRunSummary) Save(options Options, elapsed time.Duration) error {
+	summary.Finished = time.Now().UTC().Format("2006-01-02 15:04:05")
+	summary.Elapsed = elapsed.Truncate(time.Millisecond).String()
+	b, err_m := json.MarshalIndent(summary, "", "  ")
+	if err_m != nil {
+		return err_m
+	}
+	return WriteOutputFile(options, filepath.Join(options.OutputPath, "_GAPRunSummary.json"), b, 0644)
+}
+
+//LoadParseRunSummary reads the "_GAPRunSummary.json" of the previous run from the output directory
+func LoadParseRunSummary(options Options) (ParseRunSummary, error) {
+	summary := ParseRunSummary{}
+	b, err_r := ioutil.ReadFile(filepath.Join(options.OutputPath, "_GAPRunSummary.json"))
+	if err_r != nil {
+		return summary, err_r
+	}
+	err_j := json.Unmarshal(b, &summary)
+	return summary, err_j
+}
+
+//Diff compares the file statuses of this run against a previous run, both must have file statuses
+//Split pieces ("_spxml") of the previous run are not reported as removed since they are not input files
+func (summary ParseRunSummary) Diff(previous ParseRunSummary) ParseRunDiff {
+	diff := ParseRunDiff{}
+	for name, status := range summary.FileStatus {
+		before, seen := previous.FileStatus[name]
+		if !seen {
+			diff.New = append(diff.New, name)
+		}
+		if status == "parsed" {
+			diff.Parsed = append(diff.Parsed, name)
+		}
+		if status == "failed" && before != "failed" {
+			diff.NewlyFailed = append(diff.NewlyFailed, name)
+		} else if status != "failed" && before == "failed" {
+			diff.Recovered = append(diff.Recovered, name)
+		}
+	}
+	for name := range previous.FileStatus {
+		if _, exists := summary.FileStatus[name]; !exists && !strings.Contains(name, "_spxml") {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+	for _, names := range [][]string{diff.New, diff.Parsed, diff.NewlyFailed, diff.Recovered, diff.Removed} {
+		sort.Strings(names)
+	}
+	return diff
+}
+
+//Print shows the changes since the previous run, listing up to 10 files of each change unless verbose
+func (diff ParseRunDiff) Print(options Options, previous ParseRunSummary) {
+	options.Log.Println(options.Box + "Changes since the previous run (" + previous.Finished + " UTC): " + strconv.Itoa(len(diff.New)) + " new, " + strconv.Itoa(len(diff.Parsed)) + " parsed, " + strconv.Itoa(len(diff.NewlyFailed)) + " newly failed, " + strconv.Itoa(len(diff.Recovered)) + " no longer failing, " + strconv.Itoa(len(diff.Removed)) + " no longer present.")
+	printParseRunDiffFiles(options, "Newly failed", diff.NewlyFailed)
+	printParseRunDiffFiles(options, "No longer failing", diff.Recovered)
+	printParseRunDiffFiles(options, "No longer present", diff.Removed)
+	if options.Verbose > 0 {
+		printParseRunDiffFiles(options, "New", diff.New)
+	}
+}
+
+func printParseRunDiffFiles(options Options, title string, names []string) {
+	for i, name := range names {
+		if i == 10 && options.Verbose == 0 {
+			options.Log.Println(options.Box + "  ... and " + strconv.Itoa(len(names)-i) + " more, use '-v' to list them.")
+			return
+		}
+		options.Log.Println(options.Box + "  " + title + ": " + name)
+	}
+}
@@ -0,0 +1,194 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+//Line breaks and tabs of values would break the rows of the preview table
+var previewCellReplacer = strings.NewReplacer("\r\n", `\n`, "\n", `\n`, "\r", `\n`, "\t", " ")
+
+//WriteXMLSample copies the header and the first items of an XML audit to samplePath, followed by the closing </itemList>
+//Returns the number of items copied, which is less than items if the audit has fewer
+func WriteXMLSample(options Options, path string, samplePath string, items int) (int, error) {
+	file, err_o := os.Open(path)
+	if err_o != nil {
+		return 0, err_o
+	}
+	defer file.Close()
+	sampleFile, err_c := CreateOutputFile(options, samplePath)
+	if err_c != nil {
+		return 0, err_c
+	}
+	defer sampleFile.Close()
+
+	scanner := bufio.NewScanner(file)
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 1024*1024*1024)
+	writer := bufio.NewWriter(sampleFile)
+	regAuditType := regexp.MustCompile(`<([^ ^>]+)[ >]`)
+	rowCount := 0
+	closeTag := ""
+	count := 0
+	for scanner.Scan() {
+		rowCount++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if rowCount == 1 && !strings.HasPrefix(trimmed, "<?xml ") {
+			return 0, errors.New("unexpected 1st line '" + line + "'")
+		} else if rowCount == 2 && !strings.HasPrefix(trimmed, "<itemList") {
+			return 0, errors.New("unexpected 2nd line '" + line + "'")
+		} else if rowCount == 3 && trimmed != "</itemList>" {
+			m := regAuditType.FindStringSubmatch(trimmed)
+			if len(m) <= 1 {
+				return 0, errors.New("could not identify AuditType from '" + line + "'")
+			}
+			closeTag = "</" + m[1] + ">"
+		}
+		if count == items || trimmed == "</itemList>" {
+			break
+		}
+		writer.WriteString(line + "\n")
+		//An empty audit is "<itemList ... />"
+		if rowCount == 2 && strings.HasSuffix(trimmed, "/>") {
+			return 0, writer.Flush()
+		}
+		if rowCount >= 3 && trimmed == closeTag {
+			count++
+		}
+	}
+	if err_s := scanner.Err(); err_s != nil {
+		return count, err_s
+	}
+	if rowCount < 2 {
+		return 0, errors.New("file has no <itemList>")
+	}
+	writer.WriteString("</itemList>\n")
+	return count, writer.Flush()
+}
+
+//previewCell returns a value on one line, cut off after width characters if width is above 0
+func previewCell(value string, width int) string {
+	value = previewCellReplacer.Replace(value)
+	if width > 0 && utf8.RuneCountInString(value) > width {
+		runes := []rune(value)
+		if width > 3 {
+			return string(runes[:width-3]) + "..."
+		}
+		return string(runes[:width])
+	}
+	return value
+}
+
+//GoAuditPreview_Start parses the first items of an XML audit for 'goauditparser preview' and prints a table of each output
+//Returns 0 if the audit was parsed, 1 if it could not be
+func GoAuditPreview_Start(args []string) int {
+	flags := flag.NewFlagSet("preview", flag.ContinueOnError)
+	flags.SetOutput(os.Stdout)
+	flags.Usage = func() {
+		fmt.Println("Usage: goauditparser preview -i <file> [-n <int>] [-w <int>] [-c <file>] [-raw]")
+		fmt.Println("   Ex: goauditparser preview -i HOST-AGENTID-PAYLOAD-w32processes-memory.xml -n 5")
+	}
+	inputPath := ""
+	items := 0
+	width := 0
+	configPath := ""
+	raw := false
+	flags.StringVar(&inputPath, "i", "", "")
+	flags.IntVar(&items, "n", 10, "")
+	flags.IntVar(&width, "w", 40, "")
+	flags.StringVar(&configPath, "c", "", "")
+	flags.BoolVar(&raw, "raw", false, "")
+	if err_p := flags.Parse(args); err_p != nil {
+		return FlagConflictExitCode
+	}
+	if inputPath == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return FlagConflictExitCode
+	}
+	if items < 1 || width < 0 {
+		fmt.Println("[!] ERROR - '-n' must be at least 1, and '-w' can't be negative.")
+		return FlagConflictExitCode
+	}
+	st, err_s := os.Stat(inputPath)
+	if err_s != nil || st.IsDir() {
+		fmt.Println("[!] ERROR - Could not read input file '" + inputPath + "'.")
+		return 1
+	}
+
+	//Preview with the main config a parse would use, so its header orders can be checked
+	if configPath == "" {
+		userConfig := filepath.Join(GetDataDir(Options{Box: "[+] "}), "config.json")
+		if _, err_c := os.Stat(userConfig); err_c == nil {
+			configPath = userConfig
+		}
+	}
+	parser, err_l := NewParser(ParserOptions{LibraryOptions: LibraryOptions{Raw: raw, ConfigPath: configPath}})
+	if err_l != nil {
+		fmt.Println("[!] ERROR - " + err_l.Error())
+		return 1
+	}
+
+	//The sample keeps the name of the audit, which its hostname, agent ID, and audit type are read from
+	sampleDir, err_t := ioutil.TempDir("", "GAPPreview")
+	if err_t != nil {
+		fmt.Println("[!] ERROR - Could not create temp directory for the sample. " + err_t.Error())
+		return 1
+	}
+	defer os.RemoveAll(sampleDir)
+	samplePath := filepath.Join(sampleDir, st.Name())
+	sampled, err_w := WriteXMLSample(parser.Options(), inputPath, samplePath, items)
+	if err_w != nil {
+		fmt.Println("[!] ERROR - Could not sample input file '" + inputPath + "'. " + err_w.Error())
+		return 1
+	}
+	audits, err_a := parser.ParseFileTables(samplePath)
+	if err_a != nil {
+		fmt.Println("[!] ERROR - Could not parse input file '" + inputPath + "'. " + err_a.Error())
+		return 1
+	}
+	if len(audits) == 0 {
+		fmt.Println("[+] The first " + strconv.Itoa(sampled) + " item(s) of '" + st.Name() + "' produced no rows.")
+		return 0
+	}
+
+	for _, audit := range audits {
+		fmt.Println("[+] " + audit.AuditType + " - " + strconv.Itoa(len(audit.Rows)) + " row(s) and " + strconv.Itoa(len(audit.Headers)) + " column(s) from the first " + strconv.Itoa(sampled) + " item(s) of '" + st.Name() + "'")
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		cells := []string{}
+		for _, header := range audit.Headers {
+			cells = append(cells, previewCell(header, width))
+		}
+		fmt.Fprintln(table, strings.Join(cells, "\t"))
+		for _, row := range audit.Rows {
+			cells = cells[:0]
+			for _, value := range row {
+				cells = append(cells, previewCell(value, width))
+			}
+			fmt.Fprintln(table, strings.Join(cells, "\t"))
+		}
+		table.Flush()
+		fmt.Println()
+	}
+	return 0
+}
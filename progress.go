@@ -0,0 +1,217 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+//Stages of a run in "_GAPProgress.json"
+const (
+	ProgressStageExtract  = "extract"
+	ProgressStageSplit    = "split"
+	ProgressStageParse    = "parse"
+	ProgressStageTimeline = "timeline"
+)
+
+//RunProgressStatus is written to "_GAPProgress.json" for dashboards and automation to poll
+//ETASeconds is -1 until the first file of the stage finishes
+type RunProgressStatus struct {
+	Version      string   `json:"version"`
+	RunID        string   `json:"run_id"`
+	Status       string   `json:"status"`
+	Stage        string   `json:"stage"`
+	FilesDone    int      `json:"files_done"`
+	FilesTotal   int      `json:"files_total"`
+	Percent      float64  `json:"percent"`
+	CurrentFiles []string `json:"current_files"`
+	Started      string   `json:"started"`
+	StageStarted string   `json:"stage_started"`
+	Updated      string   `json:"updated"`
+	ETASeconds   int64    `json:"eta_seconds"`
+	ETA          string   `json:"eta"`
+}
+
+//RunProgress tracks the stage and files of a run and rewrites "_GAPProgress.json" every '-progress <int>' seconds
+//A nil RunProgress ignores every call, so stages can report progress whether or not '-progress' was used
+type RunProgress struct {
+	mu           sync.Mutex
+	options      Options
+	path         string
+	started      time.Time
+	stageStarted time.Time
+	status       string
+	stage        string
+	done         int
+	total        int
+	current      map[int]string
+	stop         chan bool
+	stopped      chan bool
+}
+
+//NewRunProgress starts writing "_GAPProgress.json" to dir, returns nil if '-progress' was not used
+func NewRunProgress(options Options, dir string) *RunProgress {
+	if options.ProgressSeconds <= 0 {
+		return nil
+	}
+	now := time.Now()
+	p := &RunProgress{
+		options:      options,
+		path:         filepath.Join(dir, "_GAPProgress.json"),
+		started:      now,
+		stageStarted: now,
+		status:       "running",
+		current:      map[int]string{},
+		stop:         make(chan bool),
+		stopped:      make(chan bool),
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(options.ProgressSeconds) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.mu.Lock()
+				p.save()
+				p.mu.Unlock()
+			case <-p.stop:
+				close(p.stopped)
+				return
+			}
+		}
+	}()
+	return p
+}
+
+//Stage starts a new stage of total files and writes the progress file right away
+func (p *RunProgress) Stage(stage string, total int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stage = stage
+	p.stageStarted = time.Now()
+	p.done = 0
+	p.total = total
+	p.current = map[int]string{}
+	p.save()
+}
+
+//Start records that a thread began working on a file
+func (p *RunProgress) Start(id int, name string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.current[id] = filepath.Base(name)
+	p.mu.Unlock()
+}
+
+//Finish records that a file of the stage is done
+func (p *RunProgress) Finish(id int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	delete(p.current, id)
+	p.done++
+	p.mu.Unlock()
+}
+
+//SetPosition records the progress of a stage which works through its files one at a time
+//An empty name means no file is being worked on
+func (p *RunProgress) SetPosition(done int, name string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.done = done
+	p.current = map[int]string{}
+	if name != "" {
+		p.current[0] = filepath.Base(name)
+	}
+	p.mu.Unlock()
+}
+
+//Close stops the periodic writes and writes the final progress with the "finished" status
+func (p *RunProgress) Close() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.stopped
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status = "finished"
+	p.current = map[int]string{}
+	p.save()
+}
+
+//Returns the current progress, the lock must be held
+func (p *RunProgress) currentStatus() RunProgressStatus {
+	now := time.Now()
+	status := RunProgressStatus{
+		Version:      version,
+		RunID:        p.options.RunID,
+		Status:       p.status,
+		Stage:        p.stage,
+		FilesDone:    p.done,
+		FilesTotal:   p.total,
+		CurrentFiles: []string{},
+		Started:      p.started.UTC().Format("2006-01-02 15:04:05"),
+		StageStarted: p.stageStarted.UTC().Format("2006-01-02 15:04:05"),
+		Updated:      now.UTC().Format("2006-01-02 15:04:05"),
+		ETASeconds:   -1,
+	}
+	ids := []int{}
+	for id := range p.current {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		status.CurrentFiles = append(status.CurrentFiles, p.current[id])
+	}
+	if p.total > 0 {
+		status.Percent = float64(int(float64(p.done)/float64(p.total)*10000)) / 100
+	}
+	if p.status == "finished" || (p.total > 0 && p.done >= p.total) {
+		status.ETASeconds = 0
+	} else if p.done > 0 {
+		elapsed := now.Sub(p.stageStarted)
+		remaining := time.Duration(float64(elapsed) / float64(p.done) * float64(p.total-p.done))
+		status.ETASeconds = int64(remaining.Seconds())
+		status.ETA = now.Add(remaining).UTC().Format("2006-01-02 15:04:05")
+	}
+	return status
+}
+
+//Writes the progress file through a temp file so readers never see a partial file
+//Write errors are ignored, the next write tries again
+func (p *RunProgress) save() {
+	b, err_m := json.MarshalIndent(p.currentStatus(), "", "  ")
+	if err_m != nil {
+		return
+	}
+	tempPath := TempOutputPath(p.options, p.path)
+	if err_w := WriteOutputFile(p.options, tempPath, b, 0644); err_w != nil {
+		os.Remove(tempPath)
+		return
+	}
+	if err_r := os.Rename(tempPath, p.path); err_r != nil {
+		os.Remove(tempPath)
+	}
+}
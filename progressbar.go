@@ -0,0 +1,337 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	progressBarWidth       = 25                     //Characters between the brackets of a bar
+	progressRedrawInterval = 100 * time.Millisecond //Bars are redrawn at most this often while counting
+	progressPartialLine    = 100 * time.Millisecond //Text without a new-line, such as a prompt, is written after this long
+)
+
+//ProgressBar is the progress of one stage of a run, such as extracting or parsing. Bars of stages which overlap are
+//drawn together under the other output of the run. All methods are safe for concurrent use and a nil bar does nothing
+type ProgressBar struct {
+	message string
+	total   int
+	count   int
+	start   time.Time
+	minimal bool //'-min' draws a single line which is overwritten by the next line
+}
+
+//progressConsole draws the active bars on the terminal. While bars are active, standard output is read through a pipe
+//so lines printed by any goroutine are written above the bars instead of through them
+type progressConsole struct {
+	lock     sync.Mutex
+	out      *os.File //Standard output of the process while it is captured
+	pipe     *os.File
+	done     chan bool
+	bars     []*ProgressBar
+	lines    int       //Lines of bars on screen below the cursor position of the output
+	held     bool      //The output ends without a new-line, so the bars are drawn after its next line
+	lastDraw time.Time //Time the bars were last drawn
+	terminal bool
+	width    int
+}
+
+var progress = newProgressConsole()
+
+func newProgressConsole() *progressConsole {
+	console := &progressConsole{width: 120}
+	if stat, err_s := os.Stdout.Stat(); err_s == nil && stat.Mode()&os.ModeCharDevice != 0 {
+		console.terminal = enableConsoleEscapes()
+	}
+	if columns, err_c := strconv.Atoi(os.Getenv("COLUMNS")); err_c == nil && columns > 40 {
+		console.width = columns
+	}
+	return console
+}
+
+//NewProgressBar starts the bar of a stage with a total number of steps. Bars are animated only when standard output is a
+//terminal, otherwise a single line is written when the bar is closed
+func NewProgressBar(options Options, message string, total int) *ProgressBar {
+	bar := &ProgressBar{message: message, total: total, start: time.Now(), minimal: options.MinimizedOutput}
+	progress.lock.Lock()
+	defer progress.lock.Unlock()
+	if !progress.terminal {
+		return bar
+	}
+	if bar.minimal {
+		progress.drawMinimal(bar)
+		return bar
+	}
+	if len(progress.bars) == 0 {
+		progress.capture()
+	}
+	progress.clear()
+	progress.bars = append(progress.bars, bar)
+	progress.draw()
+	return bar
+}
+
+//Add counts finished steps of the bar
+func (bar *ProgressBar) Add(n int) {
+	if bar == nil {
+		return
+	}
+	progress.lock.Lock()
+	defer progress.lock.Unlock()
+	bar.count += n
+	progress.redraw(bar)
+}
+
+//AddTotal adds steps to the bar, for stages whose work is only known while they run
+func (bar *ProgressBar) AddTotal(n int) {
+	if bar == nil {
+		return
+	}
+	progress.lock.Lock()
+	defer progress.lock.Unlock()
+	bar.total += n
+	progress.redraw(bar)
+}
+
+//Close finishes the bar, leaving its final line in the output
+func (bar *ProgressBar) Close() {
+	if bar == nil {
+		return
+	}
+	progress.lock.Lock()
+	if !progress.terminal {
+		if bar.minimal {
+			progress.write("\r")
+		}
+		progress.write(bar.render(false) + "\n")
+		progress.lock.Unlock()
+		return
+	}
+	if bar.minimal {
+		progress.drawMinimal(bar)
+		progress.write("\n")
+		progress.lock.Unlock()
+		return
+	}
+	active := []*ProgressBar{}
+	for _, b := range progress.bars {
+		if b != bar {
+			active = append(active, b)
+		}
+	}
+	if len(active) == len(progress.bars) {
+		progress.lock.Unlock()
+		return
+	}
+	progress.clear()
+	progress.bars = active
+	progress.write(bar.render(false) + "\n")
+	progress.draw()
+	if len(progress.bars) > 0 {
+		progress.lock.Unlock()
+		return
+	}
+	done := progress.release()
+	progress.lock.Unlock()
+	<-done
+}
+
+//render returns the line of the bar, "<message>: 45%|#####     | 9/20 [3s<4s, 2.9/s]"
+func (bar *ProgressBar) render(animated bool) string {
+	elapsed := time.Since(bar.start)
+	//A bar without any steps is empty while it is drawn and full once closed
+	percent, filled := 0, 0
+	if !animated {
+		percent, filled = 100, progressBarWidth
+	}
+	if bar.total > 0 {
+		count := bar.count
+		if count > bar.total {
+			count = bar.total
+		}
+		percent = count * 100 / bar.total
+		filled = count * progressBarWidth / bar.total
+	}
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(bar.count) / elapsed.Seconds()
+	}
+	timing := fmtProgressDuration(elapsed)
+	if animated && bar.count < bar.total && rate > 0 {
+		timing += "<" + fmtProgressDuration(time.Duration(float64(bar.total-bar.count)/rate*float64(time.Second)))
+	}
+	return fmt.Sprintf("%s: %3d%%|%s%s| %d/%d [%s, %.1f/s]", bar.message, percent, strings.Repeat("#", filled), strings.Repeat(" ", progressBarWidth-filled), bar.count, bar.total, timing, rate)
+}
+
+func fmtProgressDuration(d time.Duration) string {
+	if d < time.Minute {
+		return d.Truncate(time.Second).String()
+	}
+	return fmtDuration(d)
+}
+
+//fit shortens a line of a bar to the width of the terminal, keeping its counts at the end
+func (console *progressConsole) fit(line string) string {
+	runes := []rune(line)
+	if len(runes) < console.width {
+		return line
+	}
+	cut := len(runes) - console.width + 4
+	sep := strings.Index(line, ": ")
+	if sep == -1 || cut > len([]rune(line[:sep])) {
+		return string(runes[:console.width-1])
+	}
+	message := []rune(line[:sep])
+	return string(message[:len(message)-cut]) + "..." + line[sep:]
+}
+
+//redraw draws the bars after a bar changed, at most every progressRedrawInterval until the bar is full
+func (console *progressConsole) redraw(bar *ProgressBar) {
+	if !console.terminal || (time.Since(console.lastDraw) < progressRedrawInterval && bar.count < bar.total) {
+		return
+	}
+	if bar.minimal {
+		console.drawMinimal(bar)
+		return
+	}
+	console.clear()
+	console.draw()
+}
+
+func (console *progressConsole) drawMinimal(bar *ProgressBar) {
+	console.write("\r\033[K" + console.fit(bar.render(true)))
+	console.lastDraw = time.Now()
+}
+
+//draw writes the bars below the output, the caller holds the lock
+func (console *progressConsole) draw() {
+	if console.held || len(console.bars) == 0 {
+		return
+	}
+	var lines strings.Builder
+	for _, bar := range console.bars {
+		lines.WriteString(console.fit(bar.render(true)) + "\n")
+	}
+	console.write(lines.String())
+	console.lines = len(console.bars)
+	console.lastDraw = time.Now()
+}
+
+//clear removes the bars from the screen, the caller holds the lock
+func (console *progressConsole) clear() {
+	if console.lines == 0 {
+		return
+	}
+	console.write("\r\033[" + strconv.Itoa(console.lines) + "A\033[J")
+	console.lines = 0
+}
+
+func (console *progressConsole) write(text string) {
+	out := console.out
+	if out == nil {
+		out = os.Stdout
+	}
+	out.WriteString(text)
+}
+
+//capture redirects standard output through a pipe while bars are drawn, the caller holds the lock
+func (console *progressConsole) capture() {
+	reader, writer, err_p := os.Pipe()
+	if err_p != nil {
+		return
+	}
+	console.out = os.Stdout
+	console.pipe = writer
+	console.done = make(chan bool)
+	os.Stdout = writer
+	go console.forward(reader)
+}
+
+//release restores standard output after the last bar is closed, the caller holds the lock and waits for the returned
+//channel after releasing it so the remaining output is written first
+func (console *progressConsole) release() chan bool {
+	done := console.done
+	if console.pipe == nil {
+		done = make(chan bool)
+		close(done)
+		return done
+	}
+	os.Stdout = console.out
+	console.pipe.Close()
+	console.pipe = nil
+	return done
+}
+
+//forward writes the captured output above the bars. Complete lines are written as soon as they are read, and text
+//without a new-line, such as a prompt, after progressPartialLine
+func (console *progressConsole) forward(reader *os.File) {
+	chunks := make(chan []byte)
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err_r := reader.Read(buf)
+			if n > 0 {
+				chunks <- append([]byte{}, buf[:n]...)
+			}
+			if err_r != nil {
+				close(chunks)
+				return
+			}
+		}
+	}()
+
+	pending := []byte{}
+	for {
+		var partial <-chan time.Time
+		if len(pending) > 0 {
+			partial = time.After(progressPartialLine)
+		}
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				console.lock.Lock()
+				if len(pending) > 0 {
+					console.write(string(pending))
+				}
+				console.out = nil
+				console.held = false
+				console.lock.Unlock()
+				reader.Close()
+				close(console.done)
+				return
+			}
+			pending = append(pending, chunk...)
+			if i := bytes.LastIndexByte(pending, '\n'); i != -1 {
+				console.lock.Lock()
+				console.clear()
+				console.write(string(pending[:i+1]))
+				console.held = false
+				console.draw()
+				console.lock.Unlock()
+				pending = append([]byte{}, pending[i+1:]...)
+			}
+		case <-partial:
+			console.lock.Lock()
+			console.clear()
+			console.write(string(pending))
+			console.held = true
+			console.lock.Unlock()
+			pending = pending[:0]
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//Values of '-pprov <str>', where the provenance of each parsed file is recorded
+const (
+	ProvenanceComment = "comment" //"# GoAuditParser ..." line above the CSV headers
+	ProvenanceSidecar = "sidecar" //"<file>.meta.json" sidecar of '-pmeta'
+)
+
+//ProvenanceCommentPrefix starts the provenance line of '-pprov comment', which readers of parsed files skip
+const ProvenanceCommentPrefix = "# GoAuditParser "
+
+//ProvenanceLine returns the provenance line of a parsed file, such as
+//"# GoAuditParser 1.0.0 | Source: host-agentid-FileItem.xml | Generated: 2020-06-01 12:00:00 UTC"
+func ProvenanceLine(source string, generated time.Time) string {
+	return ProvenanceCommentPrefix + version + " | Source: " + filepath.Base(source) + " | Generated: " + generated.UTC().Format(NormalizedTimeLayout) + " UTC"
+}
+
+//WriteProvenanceComment writes the provenance line above the headers of a parsed file with '-pprov comment'
+//The hostname of the source is replaced by its pseudonym with '-redact', like the name of the parsed file
+func WriteProvenanceComment(options Options, w io.Writer, source string) error {
+	if options.ParseProvenance != ProvenanceComment {
+		return nil
+	}
+	_, err_w := io.WriteString(w, ProvenanceLine(RedactedInputName(options, filepath.Base(source)), time.Now())+"\n")
+	return err_w
+}
+
+//skipProvenanceComment discards the provenance line at the start of a parsed file, if it has one
+func skipProvenanceComment(r *bufio.Reader) {
+	prefix, _ := r.Peek(len(ProvenanceCommentPrefix))
+	if strings.HasPrefix(string(prefix), ProvenanceCommentPrefix) {
+		r.ReadString('\n')
+	}
+}
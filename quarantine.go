@@ -0,0 +1,146 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//quarantinePayloads indexes files extracted into an input directory that may be acquired quarantine payloads
+type quarantinePayloads struct {
+	bySize map[int64][]string
+	names  []string
+	md5s   map[string]string
+	mutex  sync.Mutex
+}
+
+var quarantinePayloadIndexes = map[string]*quarantinePayloads{}
+var quarantinePayloadIndexesMutex sync.Mutex
+
+//Audits, archives, and GoAuditParser files are never quarantine payloads
+func quarantinePayloadCandidate(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == ".xml" || ext == ".zip" || ext == ".mans" || ext == ".json" || ext == ".issues" || ext == ".csv" {
+		return false
+	}
+	return !strings.HasPrefix(name, "_GAP")
+}
+
+//Index the input directory once, since every parse thread shares it
+func getQuarantinePayloads(dir string) *quarantinePayloads {
+	quarantinePayloadIndexesMutex.Lock()
+	defer quarantinePayloadIndexesMutex.Unlock()
+	if index, exists := quarantinePayloadIndexes[dir]; exists {
+		return index
+	}
+	index := &quarantinePayloads{bySize: map[int64][]string{}, md5s: map[string]string{}}
+	files, _ := ioutil.ReadDir(dir)
+	for _, file := range files {
+		if file.IsDir() || !quarantinePayloadCandidate(file.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		index.bySize[file.Size()] = append(index.bySize[file.Size()], path)
+		index.names = append(index.names, path)
+	}
+	quarantinePayloadIndexes[dir] = index
+	return index
+}
+
+//Find an extracted payload by the quarantine ID in its filename, or by size and MD5
+func (index *quarantinePayloads) find(quarID string, fileMD5 string, fileSize string) string {
+	if len(quarID) > 0 {
+		lowerID := strings.ToLower(quarID)
+		for _, path := range index.names {
+			if strings.Contains(strings.ToLower(filepath.Base(path)), lowerID) {
+				return path
+			}
+		}
+	}
+	size, err_i := strconv.ParseInt(fileSize, 10, 64)
+	if err_i != nil || len(fileMD5) == 0 {
+		return ""
+	}
+	for _, path := range index.bySize[size] {
+		if strings.EqualFold(index.md5(path), fileMD5) {
+			return path
+		}
+	}
+	return ""
+}
+
+func (index *quarantinePayloads) md5(path string) string {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	if hash, exists := index.md5s[path]; exists {
+		return hash
+	}
+	hash := ""
+	if f, err_o := os.Open(path); err_o == nil {
+		h := md5.New()
+		if _, err_c := io.Copy(h, f); err_c == nil {
+			hash = hex.EncodeToString(h.Sum(nil))
+		}
+		f.Close()
+	}
+	index.md5s[path] = hash
+	return hash
+}
+
+//EnrichQuarantine adds a "QuarantinePayload" column to QuarantineListItem audits naming the extracted payload
+//of each quarantined file, matched by the QuarId in the payload filename or by FileSize and FileMD5
+func EnrichQuarantine(options Options, auditType string, csvHeaders []string, csvRows [][]string) ([]string, [][]string) {
+	if strings.ToLower(auditType) != "quarantinelistitem" {
+		return csvHeaders, csvRows
+	}
+	col_quarid, col_md5, col_size := -1, -1, -1
+	for i, header := range csvHeaders {
+		if header == "QuarId" {
+			col_quarid = i
+		} else if header == "FileMD5" {
+			col_md5 = i
+		} else if header == "FileSize" {
+			col_size = i
+		}
+	}
+	if col_quarid == -1 && col_md5 == -1 {
+		return csvHeaders, csvRows
+	}
+
+	index := getQuarantinePayloads(options.InputPath)
+	csvHeaders = append(csvHeaders, "QuarantinePayload")
+	for i := 0; i < len(csvRows); i++ {
+		quarID, fileMD5, fileSize := "", "", ""
+		if col_quarid != -1 {
+			quarID = csvRows[i][col_quarid]
+		}
+		if col_md5 != -1 {
+			fileMD5 = csvRows[i][col_md5]
+		}
+		if col_size != -1 {
+			fileSize = csvRows[i][col_size]
+		}
+		payload := index.find(quarID, fileMD5, fileSize)
+		if payload != "" {
+			payload = filepath.Base(payload)
+		}
+		csvRows[i] = append(csvRows[i], payload)
+	}
+	return csvHeaders, csvRows
+}
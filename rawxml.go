@@ -0,0 +1,117 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+)
+
+//RawXMLHeader is the column of '-praw' holding the original XML of rows noted by a '-notes' rule
+const RawXMLHeader = "RawXML"
+
+//AddRawXMLColumn adds the "RawXML" column to the end of a table, holding the line of each row's audit item in the XML file
+//until ResolveRawXML replaces it. itemLines holds the line of each row, 0 if it is not known
+func AddRawXMLColumn(csvHeaders []string, csvRows [][]string, itemLines []int) ([]string, [][]string) {
+	csvHeaders = append(csvHeaders, RawXMLHeader)
+	for j := range csvRows {
+		value := ""
+		if j < len(itemLines) && itemLines[j] > 0 {
+			value = strconv.Itoa(itemLines[j])
+		}
+		csvRows[j] = append(csvRows[j], value)
+	}
+	return csvHeaders, csvRows
+}
+
+//A "RawXML" cell waiting for the XML of the audit item starting on its line
+type rawXMLCell struct {
+	row []string
+	col int
+}
+
+//ResolveRawXML replaces the line numbers of the "RawXML" column with the XML of the audit item for rows with notes,
+//and clears the column of every other row. itemTag is the element of one audit item, such as "ProcessItem" or "eventItem"
+//The XML file is only read again if a row was noted. Returns the number of rows given their XML
+func ResolveRawXML(options Options, xmlFilePath string, itemTag string, outputs []CSVWriteOutput) int {
+	wanted := map[int][]rawXMLCell{}
+	for _, output := range outputs {
+		col_index_raw, col_index_notes := -1, -1
+		for i, header := range output.Headers {
+			if header == RawXMLHeader {
+				col_index_raw = i
+			} else if header == "Notes" {
+				col_index_notes = i
+			}
+		}
+		if col_index_raw == -1 {
+			continue
+		}
+		for _, row := range output.Rows {
+			if col_index_raw >= len(row) {
+				continue
+			}
+			line, err_a := strconv.Atoi(row[col_index_raw])
+			row[col_index_raw] = ""
+			if err_a != nil || col_index_notes == -1 || col_index_notes >= len(row) || row[col_index_notes] == "" {
+				continue
+			}
+			wanted[line] = append(wanted[line], rawXMLCell{row, col_index_raw})
+		}
+	}
+	if len(wanted) == 0 {
+		return 0
+	}
+
+	file, err_o := options.MemoryPayloads.Open(xmlFilePath)
+	if err_o != nil {
+		return 0
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(newLineBuffer(options.ParseLineBufferSize), options.ParseLineBufferSize)
+	closeTag := "</" + itemTag + ">"
+	resolved := 0
+	lineCount := 0
+	var cells []rawXMLCell
+	snippet := []string{}
+	for (len(wanted) > 0 || cells != nil) && scanner.Scan() {
+		lineCount++
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if cells == nil {
+			var found bool
+			if cells, found = wanted[lineCount]; !found {
+				continue
+			}
+			delete(wanted, lineCount)
+		}
+		snippet = append(snippet, line)
+		if !strings.Contains(line, closeTag) && !(len(snippet) == 1 && strings.HasSuffix(strings.TrimSpace(line), "/>")) {
+			continue
+		}
+
+		value := strings.Join(snippet, "\n")
+		if options.ReplaceNewLineFeeds {
+			value = strings.Replace(value, "\n", "|", -1)
+		}
+		if options.ExcelFriendly && len(value) > 32000 {
+			value = value[0:32000] + "..."
+		}
+		for _, cell := range cells {
+			cell.row[cell.col] = value
+		}
+		resolved += len(cells)
+		cells = nil
+		snippet = []string{}
+	}
+	return resolved
+}
@@ -0,0 +1,71 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+//InputScratchDirName is the directory of the output directory holding what '-readonly-input' keeps out of the input directories
+const InputScratchDirName = "_GAPInput"
+
+var regScratchUnsafe = regexp.MustCompile(`[^-_.A-Za-z0-9]`)
+
+//InputScratchDir returns the directory of the parse cache, checkpoints, split XML files, and extracted archives of the input directory
+//This is the input directory itself, or with '-readonly-input' a directory of "<out_dir>/_GAPInput/" named after it
+func InputScratchDir(options Options) string {
+	if !options.ReadOnlyInput {
+		return options.InputPath
+	}
+	abs, err_a := filepath.Abs(options.InputPath)
+	if err_a != nil {
+		abs = options.InputPath
+	}
+	//The same directory name can be used by many input directories with '-r', so the full path is hashed as well
+	sum := sha1.Sum([]byte(abs))
+	name := regScratchUnsafe.ReplaceAllString(filepath.Base(abs), "_") + "_" + hex.EncodeToString(sum[:])[0:8]
+	return filepath.Join(options.InputScratchRoot, name)
+}
+
+//XMLSplitDir returns the directory big XML files of the input directory are automatically split into
+func XMLSplitDir(options Options) string {
+	return filepath.Join(InputScratchDir(options), "xmlsplit")
+}
+
+//PathWithinInput returns true if path is one of the comma separated input directories or inside of one
+//An input file stands for the directory it is in
+func PathWithinInput(inputPaths string, path string) bool {
+	absPath, err_a := filepath.Abs(path)
+	if err_a != nil {
+		return false
+	}
+	for _, inputPath := range strings.Split(inputPaths, ",") {
+		if strings.TrimSpace(inputPath) == "" {
+			continue
+		}
+		absInput, err_i := filepath.Abs(strings.TrimSpace(inputPath))
+		if err_i != nil {
+			continue
+		}
+		if st, err_s := os.Stat(absInput); err_s == nil && !st.IsDir() {
+			absInput = filepath.Dir(absInput)
+		}
+		if rel, err_r := filepath.Rel(absInput, absPath); err_r == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,442 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//Actions of '-redact' rules
+const (
+	RedactActionHash = "hash" //Consistent pseudonym "<type>-<10 hex>", listed in the redaction map
+	RedactActionMask = "mask" //"REDACTED"
+)
+
+const (
+	RedactMaskValue        = "REDACTED"
+	RedactionMapFileName   = "_GAPRedactionMap.csv"
+	redactPseudonymHexSize = 10
+)
+
+//Redaction_Config_JSON is the '-redact <config>' file
+//  {
+//    "Key": "<secret>",
+//    "Rules": [
+//      {"Type": "host", "Columns": ["Hostname", "OriginalHostname", "hostname", "machine"]},
+//      {"Type": "user", "Columns": ["Username", "*User", "owner"]},
+//      {"Type": "user", "Regex": "(?i)\\\\Users\\\\([^\\\\]+)"},
+//      {"Type": "ip", "Action": "mask", "Regex": "\\b(?:[0-9]{1,3}\\.){3}[0-9]{1,3}\\b"}
+//    ]
+//  }
+type Redaction_Config_JSON struct {
+	Key     string                `json:"Key"`      //Secret of the pseudonyms, so the same value gets the same pseudonym in every run
+	MapFile string                `json:"Map_File"` //Defaults to "<out_dir>_GAPRedactionMap.csv" next to the output directory
+	Rules   []Redaction_Rule_JSON `json:"Rules"`
+}
+
+//Redaction_Rule_JSON is a rule of the '-redact' config
+//Columns redacts whole values of the columns, Regex the matches in the columns, or in every column without Columns
+//If Regex has a group, only the first group of each match is redacted
+type Redaction_Rule_JSON struct {
+	Type    string   `json:"Type"`    //Names the pseudonyms, such as "user" for "user-1a2b3c4d5e"
+	Action  string   `json:"Action"`  //"hash" (default) or "mask"
+	Audits  string   `json:"Audits"`  //Audit type pattern with "*" and "?" wildcards, defaults to every audit type
+	Columns []string `json:"Columns"` //Column patterns with "*" and "?" wildcards, ignoring case
+	Regex   string   `json:"Regex"`
+}
+
+//RedactionRule is a checked rule of the '-redact' config
+type RedactionRule struct {
+	Type    string
+	Action  string
+	Audits  string //Lowercase pattern
+	Columns []string
+	Regex   *regexp.Regexp
+}
+
+//Redaction hashes or masks the values of the '-redact' rules while parsing, and collects the pseudonyms of the
+//run for the redaction map, which the analyst keeps to look up the original values
+type Redaction struct {
+	rules   []RedactionRule
+	key     []byte
+	MapFile string
+	mu      sync.Mutex
+	mapping map[string]RedactionMapEntry //Type and lowercase value -> entry
+}
+
+//RedactionMapEntry is a row of the redaction map
+type RedactionMapEntry struct {
+	Type     string
+	Value    string
+	Redacted string
+}
+
+//ReadRedactionConfig reads and checks a '-redact' config
+//Without a "Key", a random key is used, so pseudonyms differ between runs
+func ReadRedactionConfig(configPath string, outputPath string) (*Redaction, error) {
+	b, err_r := ioutil.ReadFile(configPath)
+	if err_r != nil {
+		return nil, err_r
+	}
+	var config Redaction_Config_JSON
+	if err_j := json.Unmarshal(b, &config); err_j != nil {
+		return nil, err_j
+	}
+	if len(config.Rules) == 0 {
+		return nil, errors.New("no \"Rules\"")
+	}
+	redaction := &Redaction{MapFile: config.MapFile, mapping: map[string]RedactionMapEntry{}}
+	//The map holds the original values, so it is kept out of the output directory which is shared
+	if redaction.MapFile == "" {
+		absOutput, err_a := filepath.Abs(outputPath)
+		if err_a != nil {
+			return nil, err_a
+		}
+		redaction.MapFile = filepath.Join(filepath.Dir(absOutput), filepath.Base(absOutput)+RedactionMapFileName)
+	} else if PathWithinInput(outputPath, redaction.MapFile) {
+		return nil, errors.New("\"Map_File\" '" + config.MapFile + "' is inside of the output directory, which is meant to be shared. Use a path outside of it")
+	}
+	if config.Key != "" {
+		redaction.key = []byte(config.Key)
+	} else {
+		redaction.key = make([]byte, 32)
+		if _, err_k := rand.Read(redaction.key); err_k != nil {
+			return nil, err_k
+		}
+	}
+	for i, r := range config.Rules {
+		name := "rule " + strconv.Itoa(i+1)
+		rule := RedactionRule{Type: strings.TrimSpace(r.Type), Action: strings.ToLower(r.Action), Audits: strings.ToLower(r.Audits)}
+		if rule.Type == "" {
+			return nil, errors.New(name + " has no \"Type\"")
+		}
+		if strings.ContainsAny(rule.Type, "-,\"") {
+			return nil, errors.New(name + " has a \"Type\" with '-', ',', or '\"'")
+		}
+		if rule.Action == "" {
+			rule.Action = RedactActionHash
+		}
+		if rule.Action != RedactActionHash && rule.Action != RedactActionMask {
+			return nil, errors.New(name + " has unknown \"Action\" '" + r.Action + "', expected '" + RedactActionHash + "' or '" + RedactActionMask + "'")
+		}
+		if rule.Audits == "" {
+			rule.Audits = "*"
+		}
+		if _, err_m := path.Match(rule.Audits, ""); err_m != nil {
+			return nil, errors.New(name + " has an invalid \"Audits\" pattern '" + r.Audits + "'")
+		}
+		for _, column := range r.Columns {
+			column = strings.ToLower(strings.TrimSpace(column))
+			if _, err_m := path.Match(column, ""); err_m != nil || column == "" {
+				return nil, errors.New(name + " has an invalid column pattern '" + column + "'")
+			}
+			rule.Columns = append(rule.Columns, column)
+		}
+		if r.Regex != "" {
+			regex, err_c := regexp.Compile(r.Regex)
+			if err_c != nil {
+				return nil, errors.New(name + " has an invalid \"Regex\". " + err_c.Error())
+			}
+			rule.Regex = regex
+		}
+		if len(rule.Columns) == 0 && rule.Regex == nil {
+			return nil, errors.New(name + " has neither \"Columns\" nor \"Regex\"")
+		}
+		redaction.rules = append(redaction.rules, rule)
+	}
+	return redaction, nil
+}
+
+func (rule RedactionRule) matchesAudit(auditType string) bool {
+	matched, _ := path.Match(rule.Audits, strings.ToLower(auditType))
+	return matched
+}
+
+func (rule RedactionRule) matchesColumn(column string) bool {
+	if len(rule.Columns) == 0 {
+		return true
+	}
+	column = strings.ToLower(column)
+	for _, pattern := range rule.Columns {
+		if matched, _ := path.Match(pattern, column); matched {
+			return true
+		}
+	}
+	return false
+}
+
+//Pseudonym returns the redacted form of a value, recording hashed values in the redaction map
+//Values are hashed ignoring case, so "HOST1" and "host1" get the same pseudonym
+func (redaction *Redaction) Pseudonym(ruleType string, action string, value string) string {
+	if action == RedactActionMask {
+		return RedactMaskValue
+	}
+	folded := strings.ToLower(value)
+	mac := hmac.New(sha256.New, redaction.key)
+	mac.Write([]byte(ruleType + "\x00" + folded))
+	pseudonym := ruleType + "-" + hex.EncodeToString(mac.Sum(nil))[:redactPseudonymHexSize]
+	key := ruleType + "\x00" + folded
+	redaction.mu.Lock()
+	if _, exists := redaction.mapping[key]; !exists {
+		redaction.mapping[key] = RedactionMapEntry{ruleType, value, pseudonym}
+	}
+	redaction.mu.Unlock()
+	return pseudonym
+}
+
+//Hostname redacts the hostname of the output files with the first rule redacting the "Hostname" column of every audit
+//type, so file names do not give the hostname away. The rows' "Hostname" and "OriginalHostname" columns use it as well
+func (redaction *Redaction) Hostname(hostname string) string {
+	if redaction == nil || hostname == "" || hostname == "HOSTNAMEPLACEHOLDER" {
+		return hostname
+	}
+	for _, rule := range redaction.rules {
+		if rule.Audits == "*" && rule.Regex == nil && len(rule.Columns) > 0 && rule.matchesColumn("Hostname") {
+			return redaction.Pseudonym(rule.Type, rule.Action, hostname)
+		}
+	}
+	return hostname
+}
+
+//RedactedSidecarHostname returns the hostname for the Hostname column and for the file name of a CSV file written
+//next to the parsed files while extracting. With '-redact', both are the pseudonym of the normalized hostname
+func RedactedSidecarHostname(options Options, hostname string) (string, string) {
+	normalized := NormalizeHostname(hostname, options)
+	if redacted := options.Redaction.Hostname(normalized); redacted != normalized {
+		return redacted, redacted
+	}
+	return normalized, hostname
+}
+
+//RedactedArchiveName replaces the hostname in an archive name such as "<hostname>-<agentid>.mans" with its pseudonym
+func RedactedArchiveName(options Options, archive string, hostname string) string {
+	redacted, _ := RedactedSidecarHostname(options, hostname)
+	if hostname == "" || redacted == NormalizeHostname(hostname, options) {
+		return archive
+	}
+	return regexp.MustCompile(`(?i)(^|[-_.])`+regexp.QuoteMeta(hostname)+`($|[-_.])`).ReplaceAllString(archive, "${1}"+redacted+"${2}")
+}
+
+var regRedactAgentIDDir = regexp.MustCompile(`^([A-Za-z0-9]{22})_(.+)$`)
+
+//RedactedInputName replaces the hostname of an input file name with its pseudonym, so the names of the files a run
+//parsed can be written to the output directory. Audits are named "<hostname>-<agentid>-<payload>-<audittype>.xml"
+//and archives "<hostname>-<agentid>.mans", other names are returned unchanged
+func RedactedInputName(options Options, name string) string {
+	if options.Redaction == nil {
+		return name
+	}
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	parts := strings.Split(base, "-")
+	hostParts := 0
+	if !strings.Contains(base, ".urn_uuid_") && len(parts) >= 4 {
+		hostParts = len(parts) - 3
+	} else if len(parts) >= 2 && agentIDRegex.MatchString(parts[len(parts)-1]) {
+		hostParts = len(parts) - 1
+	}
+	if hostParts == 0 {
+		//Directories of audits with other names, "<agentid>_<hostname>"
+		if m := regRedactAgentIDDir.FindStringSubmatch(name); m != nil {
+			if redacted, _ := RedactedSidecarHostname(options, m[2]); redacted != NormalizeHostname(m[2], options) {
+				return m[1] + "_" + redacted
+			}
+		}
+		return name
+	}
+	hostname := strings.Join(parts[:hostParts], "-")
+	redacted, _ := RedactedSidecarHostname(options, hostname)
+	if redacted == NormalizeHostname(hostname, options) {
+		return name
+	}
+	return redacted + name[len(hostname):]
+}
+
+//RedactedInputPath replaces the hostnames of the file and directory names of a path like RedactedInputName
+func RedactedInputPath(options Options, path string) string {
+	if options.Redaction == nil {
+		return path
+	}
+	elements := strings.Split(filepath.ToSlash(path), "/")
+	for i, element := range elements {
+		elements[i] = RedactedInputName(options, element)
+	}
+	return filepath.FromSlash(strings.Join(elements, "/"))
+}
+
+//RedactionColumns returns the rules of each column of an audit type's CSV headers, nil if no rule applies to any
+//"Hostname", "OriginalHostname", and "AgentID" are filled in by the parser and are not included
+func (redaction *Redaction) RedactionColumns(auditType string, headers []string) [][]RedactionRule {
+	if redaction == nil {
+		return nil
+	}
+	var columns [][]RedactionRule
+	for i, header := range headers {
+		if header == "Hostname" || header == "OriginalHostname" || header == "AgentID" {
+			continue
+		}
+		for _, rule := range redaction.rules {
+			if rule.matchesAudit(auditType) && rule.matchesColumn(header) {
+				if columns == nil {
+					columns = make([][]RedactionRule, len(headers))
+				}
+				columns[i] = append(columns[i], rule)
+			}
+		}
+	}
+	return columns
+}
+
+//RedactValue applies the rules of a column to a value. Whole values are redacted line by line, so each value of a
+//multi-value cell gets its own pseudonym
+func (redaction *Redaction) RedactValue(rules []RedactionRule, value string, separator string) string {
+	if value == "" {
+		return value
+	}
+	for _, rule := range rules {
+		if rule.Regex == nil {
+			parts := strings.Split(value, separator)
+			for i, part := range parts {
+				if part != "" {
+					parts[i] = redaction.Pseudonym(rule.Type, rule.Action, part)
+				}
+			}
+			value = strings.Join(parts, separator)
+			continue
+		}
+		value = redaction.redactMatches(rule, value)
+	}
+	return value
+}
+
+//redactMatches replaces the matches of the rule's regex, or their first group
+func (redaction *Redaction) redactMatches(rule RedactionRule, value string) string {
+	matches := rule.Regex.FindAllStringSubmatchIndex(value, -1)
+	if len(matches) == 0 {
+		return value
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		if start < last || start == end {
+			continue
+		}
+		b.WriteString(value[last:start])
+		b.WriteString(redaction.Pseudonym(rule.Type, rule.Action, value[start:end]))
+		last = end
+	}
+	b.WriteString(value[last:])
+	return b.String()
+}
+
+//RedactRow redacts the cells of a CSV row with the rules of its columns from RedactionColumns
+func (redaction *Redaction) RedactRow(columns [][]RedactionRule, row []string, separator string) {
+	for i, rules := range columns {
+		if len(rules) > 0 && i < len(row) {
+			row[i] = redaction.RedactValue(rules, row[i], separator)
+		}
+	}
+}
+
+//Len returns the number of pseudonyms of this run
+func (redaction *Redaction) Len() int {
+	if redaction == nil {
+		return 0
+	}
+	redaction.mu.Lock()
+	defer redaction.mu.Unlock()
+	return len(redaction.mapping)
+}
+
+//Save adds the pseudonyms of this run to the redaction map "Type,Value,Redacted", keeping the rows of earlier runs
+//The map holds the original values, so it is only readable by its owner and must not be shared with the parsed files
+func (redaction *Redaction) Save(options Options) (int, error) {
+	if redaction == nil {
+		return 0, nil
+	}
+	redaction.mu.Lock()
+	defer redaction.mu.Unlock()
+	rows := map[string][]string{}
+	if file, err_o := os.Open(redaction.MapFile); err_o == nil {
+		reader := csv.NewReader(file)
+		reader.FieldsPerRecord = 3
+		for first := true; ; first = false {
+			record, err_r := reader.Read()
+			if err_r == io.EOF {
+				break
+			}
+			if err_r != nil {
+				file.Close()
+				return 0, errors.New("could not read '" + redaction.MapFile + "'. " + err_r.Error())
+			}
+			if !first {
+				rows[record[0]+"\x00"+record[2]] = record
+			}
+		}
+		file.Close()
+	}
+	added := 0
+	for _, entry := range redaction.mapping {
+		key := entry.Type + "\x00" + entry.Redacted
+		if _, exists := rows[key]; !exists {
+			rows[key] = []string{entry.Type, entry.Value, entry.Redacted}
+			added++
+		}
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	sorted := [][]string{}
+	for _, row := range rows {
+		sorted = append(sorted, row)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i][0] != sorted[j][0] {
+			return sorted[i][0] < sorted[j][0]
+		}
+		return strings.ToLower(sorted[i][1]) < strings.ToLower(sorted[j][1])
+	})
+	var b strings.Builder
+	writer := csv.NewWriter(&b)
+	writer.Write([]string{"Type", "Value", "Redacted"})
+	writer.WriteAll(sorted)
+	if err_w := writer.Error(); err_w != nil {
+		return 0, err_w
+	}
+	tempPath := redaction.MapFile + "." + options.RunID + TempFileSuffix
+	if err_w := ioutil.WriteFile(tempPath, []byte(b.String()), 0600); err_w != nil {
+		return 0, err_w
+	}
+	if err_n := os.Rename(tempPath, redaction.MapFile); err_n != nil {
+		os.Remove(tempPath)
+		return 0, err_n
+	}
+	return added, nil
+}
@@ -0,0 +1,148 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//Redaction config of the test, whose "machine" column of event logs holds the fully qualified hostname
+const redactionTestConfig = `{"Key": "test", "Rules": [{"Type": "host", "Columns": ["Hostname", "OriginalHostname", "machine"]}]}`
+
+//Parses triage packages of the hostnames with '-redact' and the outputs which record input files, returns the options
+func parseRedactionTestPackages(t *testing.T, hostnames []string) Options {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input")
+	if err_m := os.Mkdir(input, 0755); err_m != nil {
+		t.Fatal(err_m)
+	}
+	r := rand.New(rand.NewSource(1))
+	for _, hostname := range hostnames {
+		if _, _, err_w := WriteTestDataPackage(TestDataOptions{OutputDir: input, Items: 3, Events: 3, MsgLines: 1, Format: "mans"}, r, hostname); err_w != nil {
+			t.Fatal(err_w)
+		}
+	}
+	configPath := filepath.Join(dir, "redact.json")
+	if err_w := ioutil.WriteFile(configPath, []byte(redactionTestConfig), 0644); err_w != nil {
+		t.Fatal(err_w)
+	}
+
+	options, err_l := NewLibraryOptions(LibraryOptions{})
+	if err_l != nil {
+		t.Fatal(err_l)
+	}
+	options.InputPath = input
+	options.OutputPath = filepath.Join(dir, "output")
+	options.MinimizedOutput = true
+	options.ParseOutputMeta = true
+	options.ParseProvenance = ProvenanceComment
+	options.ParseDataQuality = true
+	options.DataQualityLog = &DataQualityLog{}
+	options.ParseIssues = true
+	options.IssuesLog = &IssuesLog{}
+	if options.Redaction, err_l = ReadRedactionConfig(configPath, options.OutputPath); err_l != nil {
+		t.Fatal(err_l)
+	}
+	if options.RunManifest, err_l = NewRunManifest(options, map[string]bool{}, ""); err_l != nil {
+		t.Fatal(err_l)
+	}
+	GoAuditParser_Start(options)
+	if err_s := options.RunManifest.Save(options); err_s != nil {
+		t.Fatal(err_s)
+	}
+	return options
+}
+
+func TestRedactionOutputHasNoHostnames(t *testing.T) {
+	hostnames := []string{"GAPTEST-WKS001", "GAPTEST-WKS002"}
+	options := parseRedactionTestPackages(t, hostnames)
+
+	csvs := 0
+	err_w := filepath.Walk(options.OutputPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if strings.HasSuffix(path, ".csv") {
+			csvs++
+		}
+		b, err_r := ioutil.ReadFile(path)
+		if err_r != nil {
+			return err_r
+		}
+		if strings.HasSuffix(path, ".csv") && !strings.HasPrefix(info.Name(), "_") && !strings.HasPrefix(string(b), ProvenanceCommentPrefix) {
+			t.Errorf("parsed file '%s' has no provenance line", info.Name())
+		}
+		for _, hostname := range hostnames {
+			if strings.Contains(strings.ToLower(info.Name()), strings.ToLower(hostname)) {
+				t.Errorf("output file name '%s' contains hostname '%s'", info.Name(), hostname)
+			}
+			if strings.Contains(strings.ToLower(string(b)), strings.ToLower(hostname)) {
+				t.Errorf("output file '%s' contains hostname '%s'", info.Name(), hostname)
+			}
+		}
+		return nil
+	})
+	if err_w != nil {
+		t.Fatal(err_w)
+	}
+	if csvs == 0 {
+		t.Fatal("no CSV files were parsed")
+	}
+	for _, name := range []string{"_GAPRunSummary.json", RunManifestFileName, "_GAPDataQuality.csv"} {
+		if _, err_s := os.Stat(filepath.Join(options.OutputPath, name)); err_s != nil {
+			t.Errorf("'%s' was not written: %v", name, err_s)
+		}
+	}
+}
+
+func TestRedactedInputName(t *testing.T) {
+	options := Options{}
+	redaction, err_r := readRedactionTestConfig(t, redactionTestConfig)
+	if err_r != nil {
+		t.Fatal(err_r)
+	}
+	options.Redaction = redaction
+	pseudonym := options.Redaction.Hostname("HOST-01")
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"HOST-01-bPlNFGdSC2wd8f2QnFhk5A-39e73270ce54c3125a76987daa9f5089-w32ports.xml", pseudonym + "-bPlNFGdSC2wd8f2QnFhk5A-39e73270ce54c3125a76987daa9f5089-w32ports.xml"},
+		{"HOST-01-bPlNFGdSC2wd8f2QnFhk5A.mans", pseudonym + "-bPlNFGdSC2wd8f2QnFhk5A.mans"},
+		{"bPlNFGdSC2wd8f2QnFhk5A_HOST-01", "bPlNFGdSC2wd8f2QnFhk5A_" + pseudonym},
+		{"HOSTNAMEPLACEHOLDER-AGENTIDPLACEHOLDER0000-0_spxml1-ProcessItem.xml", "HOSTNAMEPLACEHOLDER-AGENTIDPLACEHOLDER0000-0_spxml1-ProcessItem.xml"},
+		{"w32processes.xml", "w32processes.xml"},
+		{"report.csv", "report.csv"},
+	}
+	for _, test := range tests {
+		if got := RedactedInputName(options, test.name); got != test.want {
+			t.Errorf("RedactedInputName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+	if got := RedactedInputName(Options{}, tests[0].name); got != tests[0].name {
+		t.Errorf("RedactedInputName without '-redact' = %q, want %q", got, tests[0].name)
+	}
+}
+
+//Reads a redaction config from its JSON, with the map next to a temporary output directory
+func readRedactionTestConfig(t *testing.T, config string) (*Redaction, error) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "redact.json")
+	if err_w := ioutil.WriteFile(configPath, []byte(config), 0644); err_w != nil {
+		return nil, err_w
+	}
+	return ReadRedactionConfig(configPath, filepath.Join(dir, "output"))
+}
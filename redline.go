@@ -0,0 +1,179 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+//IsRedlineSession returns true if the file is a Redline analysis session database or session directory rather than an HX triage ZIP
+func IsRedlineSession(filePath string) bool {
+	if st, err_s := os.Stat(filePath); err_s == nil && st.IsDir() {
+		st, err_s = os.Stat(filepath.Join(filePath, "Audits"))
+		return err_s == nil && st.IsDir()
+	}
+	f, err_o := os.Open(filePath)
+	if err_o != nil {
+		return false
+	}
+	defer f.Close()
+	magic := make([]byte, 16)
+	if _, err_r := io.ReadFull(f, magic); err_r != nil {
+		return false
+	}
+	return string(magic) == "SQLite format 3\x00"
+}
+
+//IsRedlineAuditsDir returns true if the directory is the "Audits" directory of a Redline session, next to its session
+//database or inside its session directory, whose XML is extracted with the session rather than parsed again with '-r'
+func IsRedlineAuditsDir(dirPath string) bool {
+	if filepath.Base(dirPath) != "Audits" {
+		return false
+	}
+	sessionDir := filepath.Dir(dirPath)
+	if strings.ToLower(filepath.Ext(sessionDir)) == ".mans" && IsRedlineSession(sessionDir) {
+		return true
+	}
+	files, err_r := ioutil.ReadDir(sessionDir)
+	if err_r != nil {
+		return false
+	}
+	for _, file := range files {
+		if !file.IsDir() && strings.ToLower(filepath.Ext(file.Name())) == ".mans" && IsRedlineSession(filepath.Join(sessionDir, file.Name())) {
+			return true
+		}
+	}
+	return false
+}
+
+//Returns the hostname of an audit file from its path in the "Audits" directory, "<hostname>/<timestamp>/<audit>.xml"
+//when the collector created it, or "" for other layouts such as "<audit>.xml"
+func redlineAuditHostname(rel string) string {
+	relParts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(relParts) < 3 {
+		return ""
+	}
+	return relParts[len(relParts)-3]
+}
+
+//GoAuditExtract_RedlineThread copies the audit XML of a Redline session into standard "<hostname>-<agentid>-<payload>-<audittype>.xml" names
+//Redline keeps the raw collected XML next to the session database (or inside a session directory) in "Audits/[<hostname>/<timestamp>/]"
+func GoAuditExtract_RedlineThread(file os.FileInfo, options Options, threadNum int, c chan ThreadReturnExtract) {
+	xmlfiles := []os.FileInfo{}
+	fileName := filepath.Base(file.Name())
+	filePath := filepath.Join(options.InputPath, fileName)
+
+	auditsDir := filepath.Join(filepath.Dir(filePath), "Audits")
+	if file.IsDir() {
+		auditsDir = filepath.Join(filePath, "Audits")
+	}
+	if st, err_s := os.Stat(auditsDir); err_s != nil || !st.IsDir() {
+		c <- ThreadReturnExtract{threadNum, fileName, options.Warnbox + `WARNING - Failed to unarchive '` + fileName + `'. Redline session has no 'Audits' directory next to it.`, xmlfiles, nil, nil, nil}
+		return
+	}
+
+	var outputDir = InputScratchDir(options)
+	if len(options.ExtractionOutputDir) > 0 {
+		outputDir = options.ExtractionOutputDir
+	}
+
+	//"w32processes-memory.urn_uuid_0f1e2d3c-....xml"
+	reg_URN := regexp.MustCompile(`^(.+)\.urn_uuid_(.+)$`)
+
+	warningMessages := []string{}
+	warnedHostname := false
+	err_w := filepath.Walk(auditsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			warningMessages = append(warningMessages, "Could not read '"+path+"': "+err.Error())
+			return nil
+		}
+		if info.IsDir() || strings.ToLower(filepath.Ext(info.Name())) != ".xml" {
+			return nil
+		}
+		baseName := strings.TrimSuffix(info.Name(), filepath.Ext(info.Name()))
+		if strings.ToLower(baseName) == "script" || strings.ToLower(baseName) == "platform" {
+			return nil
+		}
+
+		//Hostname comes from "Audits/<hostname>/<timestamp>/" when the collector created it
+		hostname := "0"
+		agentid := PlaceholderAgentID
+		rel, _ := filepath.Rel(auditsDir, path)
+		if relHostname := redlineAuditHostname(rel); relHostname != "" {
+			hostname = relHostname
+		} else if options.ParseAltHostname == "" && !warnedHostname {
+			warningMessages = append(warningMessages, "Could not identify the hostname of '"+rel+"' outside of 'Audits/<hostname>/<timestamp>/', so its files are named with hostname '0'. Use '-pah <str>' to name the host.")
+			warnedHostname = true
+		}
+		if options.ParseAltHostname != "" {
+			hostname = options.ParseAltHostname
+		}
+		if options.ParseAltAgentID != "" {
+			agentid = options.ParseAltAgentID
+		}
+
+		generator := baseName
+		payload := baseName
+		if m := reg_URN.FindStringSubmatch(baseName); len(m) > 2 {
+			generator = m[1]
+			payload = m[2]
+		}
+		generator = strings.Replace(generator, "-", "_", -1)
+		payload = strings.Replace(payload, "-", "", -1)
+		if options.ExtractXMLFormat == 2 {
+			payload = "0"
+		}
+		new_name := hostname + "-" + agentid + "-" + payload + "-" + generator + ".xml"
+
+		if options.ExtractFilesOnly {
+			return nil
+		}
+
+		inFile, err_o := os.Open(path)
+		if err_o != nil {
+			warningMessages = append(warningMessages, "Could not open audit file '"+rel+"'. "+err_o.Error())
+			return nil
+		}
+		defer inFile.Close()
+		outFilePath := filepath.Join(outputDir, new_name)
+		outFile, err_c := CreateOutputFile(options, outFilePath)
+		if err_c != nil {
+			warningMessages = append(warningMessages, "Could not create destination file '"+new_name+"'. "+err_c.Error())
+			return nil
+		}
+		_, err_cp := io.Copy(outFile, inFile)
+		outFile.Close()
+		if err_cp != nil {
+			warningMessages = append(warningMessages, "Could not copy contents to destination file '"+new_name+"'. "+err_cp.Error())
+			return nil
+		}
+
+		xmlfile, _ := os.Stat(outFilePath)
+		xmlfiles = append(xmlfiles, xmlfile)
+		return nil
+	})
+	if err_w != nil {
+		warningMessages = append(warningMessages, "Could not walk Redline 'Audits' directory: "+err_w.Error())
+	}
+
+	if len(xmlfiles) == 0 && !options.ExtractFilesOnly {
+		c <- ThreadReturnExtract{threadNum, fileName, options.Warnbox + `WARNING - Failed to unarchive '` + fileName + `'. No audit XML files found in Redline session directory '` + auditsDir + `'.`, xmlfiles, nil, nil, nil}
+	} else if len(warningMessages) > 0 {
+		c <- ThreadReturnExtract{threadNum, fileName, options.Warnbox + `WARNING - Redline session '` + fileName + `' unarchived with issues.` + "\n" + strings.Join(warningMessages, "\n"+options.Warnbox+"- "), xmlfiles, nil, nil, nil}
+	} else {
+		c <- ThreadReturnExtract{threadNum, fileName, options.Box + `NOTICE - Redline session '` + fileName + `' unarchived successfully.`, xmlfiles, nil, nil, nil}
+	}
+}
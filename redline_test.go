@@ -0,0 +1,128 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+
+package goauditparser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//Writes a Redline session database "<dir>/<name>" and its audit files, by their paths in the "Audits" directory next to it
+func writeRedlineTestSession(t *testing.T, dir string, name string, audits []string) {
+	if err_w := ioutil.WriteFile(filepath.Join(dir, name), []byte("SQLite format 3\x00session"), 0644); err_w != nil {
+		t.Fatal(err_w)
+	}
+	for _, audit := range audits {
+		path := filepath.Join(dir, "Audits", filepath.FromSlash(audit))
+		if err_m := os.MkdirAll(filepath.Dir(path), 0755); err_m != nil {
+			t.Fatal(err_m)
+		}
+		if err_w := ioutil.WriteFile(path, []byte("<itemList></itemList>"), 0644); err_w != nil {
+			t.Fatal(err_w)
+		}
+	}
+}
+
+func TestRedlineAuditHostname(t *testing.T) {
+	tests := []struct {
+		rel  string
+		want string
+	}{
+		{"HOST-01/20200107120000/w32processes.xml", "HOST-01"},
+		{"HOST-01/20200107120000/w32processes-memory.urn_uuid_0f1e2d3c.xml", "HOST-01"},
+		{"Collector/HOST-01/20200107120000/w32processes.xml", "HOST-01"},
+		{"20200107120000/w32processes.xml", ""},
+		{"w32processes.xml", ""},
+	}
+	for _, test := range tests {
+		if got := redlineAuditHostname(filepath.FromSlash(test.rel)); got != test.want {
+			t.Errorf("redlineAuditHostname(%q) = %q, want %q", test.rel, got, test.want)
+		}
+	}
+}
+
+func TestIsRedlineAuditsDir(t *testing.T) {
+	dir := t.TempDir()
+	writeRedlineTestSession(t, dir, "case.mans", []string{"HOST-01/20200107120000/w32processes.xml"})
+	sessionDir := filepath.Join(dir, "session.mans")
+	if err_m := os.MkdirAll(filepath.Join(sessionDir, "Audits"), 0755); err_m != nil {
+		t.Fatal(err_m)
+	}
+	plain := filepath.Join(dir, "plain")
+	if err_m := os.MkdirAll(filepath.Join(plain, "Audits"), 0755); err_m != nil {
+		t.Fatal(err_m)
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{filepath.Join(dir, "Audits"), true},
+		{filepath.Join(sessionDir, "Audits"), true},
+		{filepath.Join(dir, "Audits", "HOST-01"), false},
+		{filepath.Join(plain, "Audits"), false},
+		{plain, false},
+	}
+	for _, test := range tests {
+		if got := IsRedlineAuditsDir(test.path); got != test.want {
+			t.Errorf("IsRedlineAuditsDir(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+//Extracts a Redline session, returns the names of its extracted files and the message of the extraction
+func extractRedlineTestSession(t *testing.T, audits []string) ([]string, string) {
+	dir := t.TempDir()
+	writeRedlineTestSession(t, dir, "case.mans", audits)
+	options, err_l := NewLibraryOptions(LibraryOptions{})
+	if err_l != nil {
+		t.Fatal(err_l)
+	}
+	options.InputPath = dir
+	options.ExtractionOutputDir = filepath.Join(dir, "extracted")
+	if err_m := os.Mkdir(options.ExtractionOutputDir, 0755); err_m != nil {
+		t.Fatal(err_m)
+	}
+	file, err_s := os.Stat(filepath.Join(dir, "case.mans"))
+	if err_s != nil {
+		t.Fatal(err_s)
+	}
+	c := make(chan ThreadReturnExtract, 1)
+	GoAuditExtract_RedlineThread(file, options, 0, c)
+	result := <-c
+	names := []string{}
+	for _, xmlfile := range result.xmlfiles {
+		names = append(names, xmlfile.Name())
+	}
+	return names, result.message
+}
+
+func TestRedlineExtractHostnames(t *testing.T) {
+	names, message := extractRedlineTestSession(t, []string{"HOST-01/20200107120000/w32processes.xml"})
+	want := "HOST-01-" + PlaceholderAgentID + "-w32processes-w32processes.xml"
+	if len(names) != 1 || names[0] != want {
+		t.Errorf("extracted %q, want [%q]", names, want)
+	}
+	if strings.Contains(message, "WARNING") {
+		t.Errorf("extraction warned: %s", message)
+	}
+
+	names, message = extractRedlineTestSession(t, []string{"w32processes.xml", "w32services.xml"})
+	if len(names) != 2 || !strings.HasPrefix(names[0], "0-"+PlaceholderAgentID+"-") {
+		t.Errorf("extracted %q from a flat 'Audits' directory, want hostname '0'", names)
+	}
+	if !strings.Contains(message, "-pah <str>") || strings.Count(message, "-pah <str>") != 1 {
+		t.Errorf("flat 'Audits' directory warned %q, want one '-pah <str>' warning", message)
+	}
+}
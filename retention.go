@@ -0,0 +1,220 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//RetentionLogFileName is the log of the files deleted from an output directory by '-retention <int>'
+const RetentionLogFileName = "_GAPRetentionLog.txt"
+
+//retentionFile is an output file older than the retention policy
+type retentionFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+//retentionRoot is an output directory and its output files older than the retention policy
+type retentionRoot struct {
+	dir      string
+	files    []retentionFile
+	dirs     []string //Subdirectories, parents first
+	symlinks []string //"latest" snapshot symlinks
+	size     int64
+}
+
+//IsRetentionArtifact returns true if the file is one GoAuditParser writes to an output directory, which '-retention <int>' may delete
+//Files still being written are left to the cleanup of incomplete files, and deletion logs are kept
+func IsRetentionArtifact(path string) bool {
+	name := filepath.Base(path)
+	if _, isTemp := TempFileRunID(name); isTemp {
+		return false
+	}
+	switch {
+	case name == RetentionLogFileName || name == "_GAPWipeLog.txt":
+		return false
+	case strings.HasPrefix(name, "_GAP") || strings.HasPrefix(name, "_Timeline_") || strings.HasPrefix(name, "_Observables"):
+		return true
+	case strings.HasSuffix(name, OutputMetaSuffix):
+		return IsGoAuditParserOutputFile(strings.TrimSuffix(name, OutputMetaSuffix))
+	case strings.EqualFold(filepath.Ext(name), ".xlsx"):
+		return filepath.Base(filepath.Dir(path)) == XLSXDirName
+	}
+	return IsGoAuditParserOutputFile(name)
+}
+
+//scanRetentionRoot finds the output files of a directory and its subdirectories last modified before the cutoff, in path order
+//Symlinks are not followed, so snapshots are only scanned once and nothing outside of the directory is deleted
+func scanRetentionRoot(dir string, cutoff time.Time) (retentionRoot, error) {
+	root := retentionRoot{dir: dir}
+	var err_w error
+	filepath.Walk(dir, func(path string, info os.FileInfo, err_p error) error {
+		//Unreadable directories are skipped, the rest is still scanned
+		if err_p != nil {
+			if err_w == nil {
+				err_w = err_p
+			}
+			return nil
+		}
+		switch {
+		case path == dir:
+		case info.Mode()&os.ModeSymlink != 0:
+			if info.Name() == SnapshotLatestName {
+				root.symlinks = append(root.symlinks, path)
+			}
+		case info.IsDir():
+			root.dirs = append(root.dirs, path)
+		case info.Mode().IsRegular() && info.ModTime().Before(cutoff) && IsRetentionArtifact(path):
+			root.files = append(root.files, retentionFile{path, info.ModTime(), info.Size()})
+			root.size += info.Size()
+		}
+		return nil
+	})
+	return root, err_w
+}
+
+//delete deletes the output files of the directory, logging each one to "_GAPRetentionLog.txt", then removes the
+//subdirectories and "latest" snapshot symlinks this left empty or dangling. It returns the number of files deleted
+func (root *retentionRoot) delete(options Options, days int) (int, error) {
+	logPath := filepath.Join(root.dir, RetentionLogFileName)
+	logFile, err_o := OpenOutputFile(options, logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err_o != nil {
+		return 0, err_o
+	}
+	defer logFile.Close()
+	writeLog := func(status string, path string, modTime string) {
+		logFile.WriteString(time.Now().UTC().Format("2006-01-02 15:04:05") + "\t" + status + "\t" + path + "\t" + modTime + "\t" + strconv.Itoa(days) + " days\n")
+	}
+
+	deleted := 0
+	emptied := map[string]bool{}
+	for _, file := range root.files {
+		if options.Verbose > 0 {
+			options.Log.Println(options.Box + "Removing file '" + file.path + "'...")
+		}
+		status := "DELETED"
+		if err_r := os.Remove(file.path); err_r != nil {
+			status = "FAILED (" + err_r.Error() + ")"
+			options.Log.Println(options.Warnbox + "WARNING - Could not delete file '" + file.path + "'. " + err_r.Error())
+		} else {
+			deleted++
+			emptied[filepath.Dir(file.path)] = true
+		}
+		writeLog(status, file.path, file.modTime.UTC().Format("2006-01-02 15:04:05"))
+	}
+
+	//Children come after their parents, so they are removed first
+	for i := len(root.dirs) - 1; i >= 0; i-- {
+		dir := root.dirs[i]
+		if !emptied[dir] {
+			continue
+		}
+		if entries, err_r := ioutil.ReadDir(dir); err_r != nil || len(entries) > 0 {
+			continue
+		}
+		if os.Remove(dir) == nil {
+			writeLog("DELETED EMPTY DIRECTORY", dir, "")
+			emptied[filepath.Dir(dir)] = true
+		}
+	}
+	for _, symlink := range root.symlinks {
+		if _, err_s := os.Stat(symlink); os.IsNotExist(err_s) && os.Remove(symlink) == nil {
+			writeLog("DELETED DANGLING SYMLINK", symlink, "")
+		}
+	}
+	return deleted, nil
+}
+
+//retentionSize returns the size in a readable unit
+func retentionSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	return strconv.FormatFloat(value, 'f', 1, 64) + " " + units[i]
+}
+
+//GoAuditRetention_Start deletes the GoAuditParser output files older than '-retention <int>' days from the output directories,
+//which are '-o <dir>' or the "Retention_Roots" of the main config. With '-retention-dry', the files are only listed
+func GoAuditRetention_Start(options Options) {
+	cutoff := time.Now().AddDate(0, 0, -options.RetentionDays)
+	options.Log.Println(options.Box + "Looking for output files last modified before " + cutoff.Format("2006-01-02 15:04:05") + " (" + strconv.Itoa(options.RetentionDays) + " days ago) in " + strconv.Itoa(len(options.RetentionRoots)) + " output director(y/ies).")
+
+	roots := []retentionRoot{}
+	count := 0
+	var size int64
+	for _, dir := range options.RetentionRoots {
+		if info, err_s := os.Stat(dir); err_s != nil || !info.IsDir() {
+			options.Log.Println(options.Warnbox + "WARNING - Output directory '" + dir + "' does not exist or is not a directory. Skipping it.")
+			continue
+		}
+		root, err_w := scanRetentionRoot(dir, cutoff)
+		if err_w != nil {
+			options.Log.Println(options.Warnbox + "WARNING - Could not read all of output directory '" + dir + "'. " + err_w.Error())
+		}
+		options.Log.Println(options.Box + "  " + dir + ": " + strconv.Itoa(len(root.files)) + " file(s), " + retentionSize(root.size))
+		if len(root.files) == 0 {
+			continue
+		}
+		roots = append(roots, root)
+		count += len(root.files)
+		size += root.size
+	}
+	if count == 0 {
+		options.Log.Println(options.Box + "No output files are older than " + strconv.Itoa(options.RetentionDays) + " days.")
+		return
+	}
+
+	if options.RetentionDryRun {
+		for _, root := range roots {
+			for _, file := range root.files {
+				options.Log.Println(options.Box + "  " + file.modTime.Format("2006-01-02 15:04:05") + "  " + file.path)
+			}
+		}
+		options.Log.Println(options.Box + "NOTICE - '-retention-dry' is set. " + strconv.Itoa(count) + " file(s), " + retentionSize(size) + ", would be deleted. Remove '-retention-dry' to delete them.")
+		return
+	}
+
+	if !options.AssumeYes {
+		reader := bufio.NewReader(os.Stdin)
+		options.Log.Println(options.Box + "The '-retention' flag will delete " + strconv.Itoa(count) + " GoAuditParser output file(s), " + retentionSize(size) + ". Continue? [Y/N]")
+		fmt.Print("> ")
+		text, _ := reader.ReadString('\n')
+		if !strings.HasPrefix(strings.TrimSpace(strings.ToLower(text)), "y") {
+			options.Log.Println(options.Box + "NOTICE - Not deleting any files.")
+			return
+		}
+	}
+
+	deleted := 0
+	for i := range roots {
+		n, err_d := roots[i].delete(options, options.RetentionDays)
+		if err_d != nil {
+			options.Log.Println(options.Warnbox + "ERROR - Could not open deletion log '" + filepath.Join(roots[i].dir, RetentionLogFileName) + "'. No files were deleted in '" + roots[i].dir + "'. " + err_d.Error())
+			continue
+		}
+		deleted += n
+		options.Log.Println(options.Box + "Deleted " + strconv.Itoa(n) + " file(s) in '" + roots[i].dir + "'. Deletions logged to '" + filepath.Join(roots[i].dir, RetentionLogFileName) + "'.")
+	}
+	options.Log.Println(options.Box + "Deleted " + strconv.Itoa(deleted) + " of " + strconv.Itoa(count) + " output file(s) older than " + strconv.Itoa(options.RetentionDays) + " days.")
+}
@@ -0,0 +1,139 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+
+package goauditparser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const retentionTestOutput = "HOST-01-bPlNFGdSC2wd8f2QnFhk5A-82fbf86758bf5c97d2d2a313e4f95957-ProcessItem.csv"
+
+//Writes a file last modified the number of days ago, creating its directory
+func writeRetentionTestFile(t *testing.T, path string, days int) {
+	if err_m := os.MkdirAll(filepath.Dir(path), 0755); err_m != nil {
+		t.Fatal(err_m)
+	}
+	if err_w := ioutil.WriteFile(path, []byte("data"), 0644); err_w != nil {
+		t.Fatal(err_w)
+	}
+	modTime := time.Now().AddDate(0, 0, -days)
+	if err_c := os.Chtimes(path, modTime, modTime); err_c != nil {
+		t.Fatal(err_c)
+	}
+}
+
+//Returns options which delete the output files of the directories older than the number of days without asking
+func retentionTestOptions(t *testing.T, days int, dirs ...string) Options {
+	options, err_l := NewLibraryOptions(LibraryOptions{})
+	if err_l != nil {
+		t.Fatal(err_l)
+	}
+	options.RetentionDays = days
+	options.RetentionRoots = dirs
+	options.AssumeYes = true
+	return options
+}
+
+func assertRetentionFiles(t *testing.T, exist bool, paths ...string) {
+	t.Helper()
+	for _, path := range paths {
+		_, err_s := os.Lstat(path)
+		if exist && err_s != nil {
+			t.Errorf("'%s' was deleted: %v", path, err_s)
+		} else if !exist && !os.IsNotExist(err_s) {
+			t.Errorf("'%s' was not deleted", path)
+		}
+	}
+}
+
+func TestIsRetentionArtifact(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{retentionTestOutput, true},
+		{retentionTestOutput + OutputMetaSuffix, true},
+		{"HOST-01-bPlNFGdSC2wd8f2QnFhk5A-issues.csv", true},
+		{"HOST-01-bPlNFGdSC2wd8f2QnFhk5A-Hits.csv", true},
+		{"_Timeline_2020-01-07_1200.csv", true},
+		{"_GAPRunSummary.json", true},
+		{filepath.Join(XLSXDirName, "HOST-01.xlsx"), true},
+		{"report.csv", false},
+		{"2024-01-15-report.csv", false},
+		{"notes.txt", false},
+		{"HOST-01-bPlNFGdSC2wd8f2QnFhk5A-82fbf86758bf5c97d2d2a313e4f95957-Unknown.csv", false},
+		{"report.csv" + OutputMetaSuffix, false},
+		{"HOST-01.xlsx", false},
+		{RetentionLogFileName, false},
+		{"_GAPWipeLog.txt", false},
+	}
+	for _, test := range tests {
+		if got := IsRetentionArtifact(test.path); got != test.want {
+			t.Errorf("IsRetentionArtifact(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestRetentionAgeCutoff(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, retentionTestOutput)
+	oldRouted := filepath.Join(dir, "realtime", retentionTestOutput)
+	recent := filepath.Join(dir, "HOST-02-bPlNFGdSC2wd8f2QnFhk5A-82fbf86758bf5c97d2d2a313e4f95957-ProcessItem.csv")
+	oldOther := filepath.Join(dir, "report.csv")
+	writeRetentionTestFile(t, old, 40)
+	writeRetentionTestFile(t, oldRouted, 40)
+	writeRetentionTestFile(t, recent, 20)
+	writeRetentionTestFile(t, oldOther, 40)
+
+	GoAuditRetention_Start(retentionTestOptions(t, 30, dir))
+	assertRetentionFiles(t, false, old, oldRouted, filepath.Dir(oldRouted))
+	assertRetentionFiles(t, true, recent, oldOther, filepath.Join(dir, RetentionLogFileName))
+}
+
+func TestRetentionDryRun(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, retentionTestOutput)
+	writeRetentionTestFile(t, old, 40)
+
+	options := retentionTestOptions(t, 30, dir)
+	options.RetentionDryRun = true
+	GoAuditRetention_Start(options)
+	assertRetentionFiles(t, true, old)
+	assertRetentionFiles(t, false, filepath.Join(dir, RetentionLogFileName))
+}
+
+func TestRetentionSkipsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "outside")
+	outsideFile := filepath.Join(outside, retentionTestOutput)
+	writeRetentionTestFile(t, outsideFile, 40)
+	snapshot := filepath.Join(dir, "snapshots", "2020-01-07_120000")
+	writeRetentionTestFile(t, filepath.Join(snapshot, retentionTestOutput), 40)
+	//A directory and an output file outside of the output directory, and the "latest" snapshot
+	linkedDir := filepath.Join(dir, "linked")
+	linkedFile := filepath.Join(dir, "HOST-03-bPlNFGdSC2wd8f2QnFhk5A-82fbf86758bf5c97d2d2a313e4f95957-ProcessItem.csv")
+	latest := filepath.Join(dir, "snapshots", SnapshotLatestName)
+	for link, target := range map[string]string{linkedDir: outside, linkedFile: outsideFile, latest: snapshot} {
+		if err_l := os.Symlink(target, link); err_l != nil {
+			t.Skip("symlinks are not supported: " + err_l.Error())
+		}
+	}
+
+	GoAuditRetention_Start(retentionTestOptions(t, 30, dir))
+	assertRetentionFiles(t, true, outsideFile, linkedDir, linkedFile)
+	//The snapshot was emptied, so it and the "latest" symlink to it are removed
+	assertRetentionFiles(t, false, snapshot, latest)
+}
@@ -0,0 +1,260 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Formats of the '-log' log
+const (
+	RunLogFormatText = "text"
+	RunLogFormatJSON = "json"
+)
+
+//Levels of log events, taken from the "ERROR - ", "WARNING - ", and "NOTICE - " prefixes of output lines
+const (
+	RunLogLevelInfo    = "info"
+	RunLogLevelNotice  = "notice"
+	RunLogLevelWarning = "warning"
+	RunLogLevelError   = "error"
+)
+
+//Events of the '-log json' log, besides "file_<status>" events of each parsed file
+const (
+	RunLogEventRunStarted    = "run_started"
+	RunLogEventRunFinished   = "run_finished"
+	RunLogEventStageStarted  = "stage_started"
+	RunLogEventStageFinished = "stage_finished"
+	RunLogEventFileStarted   = "file_started"
+	RunLogEventStatistics    = "statistics"
+	RunLogEventMessage       = "message"
+)
+
+//RunLogEvent is one line of the '-log json' log
+type RunLogEvent struct {
+	Time    string                 `json:"time"`
+	RunID   string                 `json:"run_id"`
+	Level   string                 `json:"level"`
+	Event   string                 `json:"event"`
+	Message string                 `json:"message,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+//RunLog copies the output of a run to '-logfile <file>' or stderr, as text or as JSON events for pipelines to read
+//A nil RunLog only prints output lines, so output can be logged whether or not '-log' was used
+type RunLog struct {
+	mu           sync.Mutex
+	format       string
+	runID        string
+	out          io.Writer
+	file         *os.File
+	boxes        []string
+	started      time.Time
+	stageStarted map[string]time.Time
+	errors       int
+	warnings     int
+}
+
+//NewRunLog opens the '-log <format>' log, returns nil if neither '-log' nor '-logfile' was used
+func NewRunLog(options Options) (*RunLog, error) {
+	if options.LogFormat == "" && options.LogFile == "" {
+		return nil, nil
+	}
+	format := strings.ToLower(options.LogFormat)
+	if format == "" {
+		format = RunLogFormatText
+	}
+	if format != RunLogFormatText && format != RunLogFormatJSON {
+		return nil, fmt.Errorf("unknown log format '%s', expected '%s' or '%s'", options.LogFormat, RunLogFormatText, RunLogFormatJSON)
+	}
+	l := &RunLog{
+		format:       format,
+		runID:        options.RunID,
+		out:          os.Stderr,
+		boxes:        []string{options.Warnbox, options.Box, "[+] ", "[!] ", "[#] "},
+		started:      time.Now(),
+		stageStarted: map[string]time.Time{},
+	}
+	if options.LogFile != "" {
+		//Appended to, so the runs of a pipeline can share one log
+		file, err_o := OpenOutputFile(options, options.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err_o != nil {
+			return nil, err_o
+		}
+		l.file = file
+		l.out = file
+	}
+	l.Event(RunLogLevelInfo, RunLogEventRunStarted, "GoAuditParser v"+version, map[string]interface{}{
+		"version": version,
+		"args":    redactRunArgs(os.Args[1:]),
+	})
+	return l, nil
+}
+
+//ApplyOutputPermissions applies the '-perm' and '-group' output permissions to '-logfile <file>'
+//The log is opened before the main config, which may set them, is read
+func (l *RunLog) ApplyOutputPermissions(options Options) error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	return applyOutputPermissions(options, l.file.Name(), options.FileMode)
+}
+
+//runLogLevel returns the level and message of an output line without its box and level prefix
+func (l *RunLog) runLogLevel(line string) (string, string) {
+	for _, box := range l.boxes {
+		if box != "" && strings.HasPrefix(line, box) {
+			line = strings.TrimPrefix(line, box)
+			break
+		}
+	}
+	for _, level := range []string{RunLogLevelError, RunLogLevelWarning, RunLogLevelNotice} {
+		if prefix := strings.ToUpper(level) + " - "; strings.HasPrefix(line, prefix) {
+			return level, strings.TrimPrefix(line, prefix)
+		}
+	}
+	return RunLogLevelInfo, line
+}
+
+//Println prints a line of output and records it as a "message" event with the level of its prefix
+func (l *RunLog) Println(line string) {
+	fmt.Println(line)
+	if l == nil {
+		return
+	}
+	level, message := l.runLogLevel(line)
+	l.Event(level, RunLogEventMessage, message, nil)
+}
+
+//Event records an event. Text logs only keep its message, JSON logs keep the event, its level, and its fields
+func (l *RunLog) Event(level string, event string, message string, fields map[string]interface{}) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch level {
+	case RunLogLevelError:
+		l.errors++
+	case RunLogLevelWarning:
+		l.warnings++
+	}
+	now := time.Now()
+	if l.format == RunLogFormatText {
+		if message == "" {
+			return
+		}
+		if level != RunLogLevelInfo {
+			message = strings.ToUpper(level) + " - " + message
+		}
+		fmt.Fprintln(l.out, now.Format("2006-01-02 15:04:05")+" "+message)
+		return
+	}
+	data, err_j := json.Marshal(RunLogEvent{
+		Time:    now.UTC().Format(time.RFC3339Nano),
+		RunID:   l.runID,
+		Level:   level,
+		Event:   event,
+		Message: message,
+		Fields:  fields,
+	})
+	if err_j != nil {
+		return
+	}
+	l.out.Write(append(data, '\n'))
+}
+
+//StageStarted records the start of a stage of the run with its number of files
+func (l *RunLog) StageStarted(stage string, files int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.stageStarted[stage] = time.Now()
+	l.mu.Unlock()
+	l.Event(RunLogLevelInfo, RunLogEventStageStarted, "", map[string]interface{}{"stage": stage, "files": files})
+}
+
+//StageFinished records the end of a stage of the run with its elapsed time
+func (l *RunLog) StageFinished(stage string, files int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	elapsed := time.Since(l.stageStarted[stage])
+	l.mu.Unlock()
+	l.Event(RunLogLevelInfo, RunLogEventStageFinished, "", map[string]interface{}{"stage": stage, "files": files, "elapsed_seconds": elapsed.Seconds()})
+}
+
+//FileStarted records that a stage started on a file
+func (l *RunLog) FileStarted(stage string, file string) {
+	l.Event(RunLogLevelInfo, RunLogEventFileStarted, "", map[string]interface{}{"stage": stage, "file": file})
+}
+
+//FileFinished records the status of a file as a "file_<status>" event, such as "file_parsed" or "file_failed"
+func (l *RunLog) FileFinished(stage string, file string, status string, message string) {
+	if l == nil {
+		return
+	}
+	level := RunLogLevelInfo
+	if status == "failed" {
+		level = RunLogLevelError
+	} else if status == "" {
+		status = "finished"
+	}
+	_, message = l.runLogLevel(strings.TrimSpace(message))
+	l.Event(level, "file_"+status, message, map[string]interface{}{"stage": stage, "file": file, "status": status})
+}
+
+//Statistics records the counts of a stage, such as the number of parsed and failed files
+func (l *RunLog) Statistics(stage string, counts map[string]int) {
+	if l == nil {
+		return
+	}
+	fields := map[string]interface{}{"stage": stage}
+	names := []string{}
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	summary := []string{}
+	for _, name := range names {
+		fields[name] = counts[name]
+		summary = append(summary, fmt.Sprintf("%s=%d", name, counts[name]))
+	}
+	l.Event(RunLogLevelInfo, RunLogEventStatistics, stage+" "+strings.Join(summary, " "), fields)
+}
+
+//Close records the end of the run with its number of errors and warnings, and closes '-logfile'
+func (l *RunLog) Close() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	errors, warnings := l.errors, l.warnings
+	l.mu.Unlock()
+	l.Event(RunLogLevelInfo, RunLogEventRunFinished, "", map[string]interface{}{
+		"elapsed_seconds": time.Since(l.started).Seconds(),
+		"errors":          errors,
+		"warnings":        warnings,
+	})
+	if l.file != nil {
+		l.file.Close()
+	}
+}
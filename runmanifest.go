@@ -0,0 +1,377 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Name of the '-manifest' file written to the output directory
+const RunManifestFileName = "_GAPRunManifest.json"
+
+//Written in place of archive passwords, which are given again to 'goauditparser rerun'
+const runManifestRedacted = "REDACTED"
+
+//RunManifest records everything needed to repeat a run with 'goauditparser rerun <manifest>'
+type RunManifest struct {
+	Version    string            `json:"version"`
+	RunID      string            `json:"run_id"`
+	Started    string            `json:"started"`
+	Finished   string            `json:"finished,omitempty"`
+	WorkingDir string            `json:"working_dir"`
+	Args       []string          `json:"args"`  //Command line of the run, archive passwords are redacted
+	Flags      map[string]string `json:"flags"` //Every flag set on the command line or by ".gapflags", and its value
+	Configs    []RunManifestFile `json:"configs"`
+	Inputs     []RunManifestFile `json:"inputs"`
+}
+
+//RunManifestFile is a config or input file of a run with its hash
+//Role is the flag the file was given with, such as "c" or "notes", or "input" for input files
+type RunManifestFile struct {
+	Role   string `json:"role"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+//NewRunManifest records the flags, configs, and input files of a run for '-manifest', before anything is parsed
+//setFlags holds the names of the flags set on the command line or by flagFile, the ".gapflags" file applied or ""
+func NewRunManifest(options Options, setFlags map[string]bool, flagFile string) (*RunManifest, error) {
+	workingDir, err_w := os.Getwd()
+	if err_w != nil {
+		return nil, err_w
+	}
+	manifest := &RunManifest{
+		Version:    version,
+		RunID:      options.RunID,
+		Started:    time.Now().UTC().Format("2006-01-02 15:04:05"),
+		WorkingDir: workingDir,
+		Args:       redactRunArgs(os.Args[1:]),
+		Flags:      map[string]string{},
+	}
+	for name := range setFlags {
+		if f := flag.Lookup(name); f != nil {
+			manifest.Flags[name] = f.Value.String()
+		}
+	}
+	if _, exists := manifest.Flags["ep"]; exists {
+		manifest.Flags["ep"] = runManifestRedacted
+	}
+
+	//Config files and the files given to flags
+	configs := [][2]string{{"c", options.ConfigPath}, {"gapflags", flagFile}, {"ep-file", options.ExtractionPasswordFile}, {"ekp", options.EventKnowledgePackFile}, {"notes", options.AnalystNotesFile}, {"tag", options.TagFile}}
+	if options.Timeline || options.TimelineOnly {
+		configs = append(configs, [2]string{"tlcf", options.TimelineConfigFile})
+	}
+	for _, path := range strings.Split(options.AllowlistFiles, ",") {
+		configs = append(configs, [2]string{"al", strings.TrimSpace(path)})
+	}
+	for _, config := range configs {
+		if config[1] == "" {
+			continue
+		}
+		//A timeline config which does not exist yet is created from the template of this version
+		file, err_h := hashRunManifestFile(config[0], config[1], config[1])
+		if os.IsNotExist(err_h) && config[0] == "tlcf" {
+			continue
+		} else if err_h != nil {
+			return nil, err_h
+		}
+		manifest.Configs = append(manifest.Configs, file)
+	}
+
+	inputs, err_i := runManifestInputs(options)
+	if err_i != nil {
+		return nil, err_i
+	}
+	manifest.Inputs = inputs
+	return manifest, nil
+}
+
+//Returns the arguments with the values of '-ep' replaced
+func redactRunArgs(args []string) []string {
+	redacted := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := strings.TrimLeft(arg, "-")
+		if name == "ep" && strings.HasPrefix(arg, "-") && i+1 < len(args) {
+			redacted = append(redacted, arg, runManifestRedacted)
+			i++
+			continue
+		}
+		if strings.HasPrefix(name, "ep=") && strings.HasPrefix(arg, "-") {
+			arg = arg[:strings.Index(arg, "=")+1] + runManifestRedacted
+		}
+		redacted = append(redacted, arg)
+	}
+	return redacted
+}
+
+//Returns the hashed files of the input directories, or of the CSV directories for '-tlo'
+//Files GoAuditParser writes to the input directory itself, such as the parse cache and split XML files, are left out
+//With '-redact', hostnames in the paths are replaced by their pseudonyms
+func runManifestInputs(options Options) ([]RunManifestFile, error) {
+	roots := options.InputPath
+	if options.TimelineOnly {
+		roots = options.OutputPath
+	}
+	inputs := []RunManifestFile{}
+	for _, root := range strings.Split(roots, ",") {
+		root = strings.TrimSpace(root)
+		if root == "" {
+			continue
+		}
+		err_w := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name := info.Name()
+			if info.IsDir() {
+				if path != root && (name == "xmlsplit" || name == InputScratchDirName) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasPrefix(name, "_GAP") || name == FlagFileName || (options.TimelineOnly && (strings.HasPrefix(name, "_Timeline_") || !strings.HasSuffix(name, ".csv"))) {
+				return nil
+			}
+			file, err_h := hashRunManifestFile("input", RedactedInputPath(options, path), path)
+			if err_h != nil {
+				return err_h
+			}
+			inputs = append(inputs, file)
+			return nil
+		})
+		if err_w != nil {
+			return nil, err_w
+		}
+	}
+	sort.Slice(inputs, func(i, j int) bool {
+		return inputs[i].Path < inputs[j].Path
+	})
+	return inputs, nil
+}
+
+//Returns the size and SHA256 of the file at path, recorded as name
+func hashRunManifestFile(role string, name string, path string) (RunManifestFile, error) {
+	file, err_o := os.Open(path)
+	if err_o != nil {
+		return RunManifestFile{}, err_o
+	}
+	defer file.Close()
+	h := sha256.New()
+	size, err_c := io.Copy(h, file)
+	if err_c != nil {
+		return RunManifestFile{}, err_c
+	}
+	return RunManifestFile{role, filepath.ToSlash(name), size, hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+//Save writes the manifest to "_GAPRunManifest.json" in the output directory once the run finishes
+//A nil manifest is ignored
+func (manifest *RunManifest) Save(options Options) error {
+	if manifest == nil {
+		return nil
+	}
+	manifest.Finished = time.Now().UTC().Format("2006-01-02 15:04:05")
+	b, err_m := json.MarshalIndent(manifest, "", "  ")
+	if err_m != nil {
+		return err_m
+	}
+	outputDir := TimelineCases(options.OutputPath)[0].Path
+	if err_d := MkdirAllOutput(options, outputDir); err_d != nil {
+		return err_d
+	}
+	return WriteOutputFile(options, filepath.Join(outputDir, RunManifestFileName), b, 0644)
+}
+
+//Changed returns a message for every recorded file which is missing or differs now, and for new input files
+//Paths are relative to the working directory of the run
+func (manifest *RunManifest) Changed(options Options) []string {
+	changes := []string{}
+	for _, recorded := range manifest.Configs {
+		current, err_h := hashRunManifestFile(recorded.Role, recorded.Path, filepath.FromSlash(recorded.Path))
+		if err_h != nil {
+			changes = append(changes, "'-"+recorded.Role+"' file '"+recorded.Path+"' could not be read: "+err_h.Error())
+		} else if current.SHA256 != recorded.SHA256 {
+			changes = append(changes, "'-"+recorded.Role+"' file '"+recorded.Path+"' changed.")
+		}
+	}
+
+	flagFile := ""
+	for _, recorded := range manifest.Configs {
+		if recorded.Role == "gapflags" {
+			flagFile = recorded.Path
+		}
+	}
+	if path := FindFlagFile(options.InputPath); path != "" && flagFile == "" && !options.TimelineOnly {
+		changes = append(changes, "Default flags file '"+path+"' was added.")
+	}
+
+	current, err_i := runManifestInputs(options)
+	if err_i != nil {
+		return append(changes, "Input could not be read: "+err_i.Error())
+	}
+	currentByPath := map[string]RunManifestFile{}
+	for _, file := range current {
+		currentByPath[file.Path] = file
+	}
+	for _, recorded := range manifest.Inputs {
+		file, exists := currentByPath[recorded.Path]
+		if !exists {
+			changes = append(changes, "Input file '"+recorded.Path+"' is missing.")
+		} else if file.SHA256 != recorded.SHA256 {
+			changes = append(changes, "Input file '"+recorded.Path+"' changed.")
+		}
+		delete(currentByPath, recorded.Path)
+	}
+	//Audits extracted into the input directory from recorded archives, named "<hostname>-<agentid>-<payload>-<audit>.xml"
+	archives := []string{}
+	for _, recorded := range manifest.Inputs {
+		if ext := strings.ToLower(filepath.Ext(recorded.Path)); ext == ".mans" || ext == ".zip" {
+			archives = append(archives, strings.TrimSuffix(recorded.Path, filepath.Ext(recorded.Path))+"-")
+		}
+	}
+	added := []string{}
+	for path := range currentByPath {
+		extracted := false
+		for _, prefix := range archives {
+			extracted = extracted || strings.HasPrefix(path, prefix)
+		}
+		if !extracted {
+			added = append(added, path)
+		}
+	}
+	sort.Strings(added)
+	for _, path := range added {
+		changes = append(changes, "Input file '"+path+"' was added.")
+	}
+	return changes
+}
+
+//GoAuditRerun_Prepare checks the manifest of 'goauditparser rerun <manifest>' and returns the arguments to repeat the run with
+//The working directory is changed to the one of the recorded run. exitCode is not 0 if the run can't be repeated
+func GoAuditRerun_Prepare(args []string) ([]string, int) {
+	flags := flag.NewFlagSet("rerun", flag.ContinueOnError)
+	flags.SetOutput(os.Stdout)
+	flags.Usage = func() {
+		fmt.Println("Usage: goauditparser rerun [-o <out_dir>] [-ep <password>] [-f] <manifest>")
+		fmt.Println("   Ex: goauditparser rerun -o parsed_rerun parsed/" + RunManifestFileName)
+	}
+	outputDir := ""
+	password := ""
+	force := false
+	flags.StringVar(&outputDir, "o", "", "")
+	flags.StringVar(&password, "ep", "", "")
+	flags.BoolVar(&force, "f", false, "")
+	if err_p := flags.Parse(args); err_p != nil {
+		return nil, FlagConflictExitCode
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return nil, FlagConflictExitCode
+	}
+	manifestPath := flags.Arg(0)
+	if outputDir != "" {
+		if abs, err_a := filepath.Abs(outputDir); err_a == nil {
+			outputDir = abs
+		}
+	}
+
+	b, err_r := ioutil.ReadFile(manifestPath)
+	if err_r != nil {
+		fmt.Println("[!] ERROR - Could not read run manifest '" + manifestPath + "'. " + err_r.Error())
+		return nil, 1
+	}
+	manifest := RunManifest{}
+	if err_j := json.Unmarshal(b, &manifest); err_j != nil {
+		fmt.Println("[!] ERROR - Could not parse JSON from run manifest '" + manifestPath + "'. " + err_j.Error())
+		return nil, 1
+	}
+	fmt.Println("[+] Repeating run '" + manifest.RunID + "' of GoAuditParser v" + manifest.Version + " started " + manifest.Started + " UTC in '" + manifest.WorkingDir + "'.")
+
+	problems := []string{}
+	if manifest.Version != version {
+		problems = append(problems, "The run was made with GoAuditParser v"+manifest.Version+", this is v"+version+".")
+	}
+	if err_c := os.Chdir(manifest.WorkingDir); err_c != nil {
+		fmt.Println("[!] ERROR - Could not change to the working directory of the run '" + manifest.WorkingDir + "'. " + err_c.Error())
+		return nil, 1
+	}
+
+	//The recorded flags tell where the inputs and configs were
+	options := Options{InputPath: manifest.Flags["i"], OutputPath: "parsed", AllowlistFiles: manifest.Flags["al"]}
+	if path, exists := manifest.Flags["o"]; exists {
+		options.OutputPath = path
+	}
+	_, options.TimelineOnly = manifest.Flags["tlo"]
+	if options.TimelineOnly && options.InputPath != "" && manifest.Flags["o"] == "" {
+		options.OutputPath = options.InputPath
+	}
+	//Paths of redacted runs hold pseudonyms, which the "Key" of the redaction config gives again
+	if path, exists := manifest.Flags["redact"]; exists {
+		redaction, err_r := ReadRedactionConfig(path, options.OutputPath)
+		if err_r != nil {
+			fmt.Println("[!] ERROR - Could not read redaction config '" + path + "'. " + err_r.Error())
+			return nil, 1
+		}
+		options.Redaction = redaction
+		options.HostnameShort = manifest.Flags["hs"] == "true"
+	}
+	problems = append(problems, manifest.Changed(options)...)
+
+	rerunArgs := []string{}
+	for i, arg := range manifest.Args {
+		if arg != runManifestRedacted && !strings.HasSuffix(arg, "="+runManifestRedacted) {
+			rerunArgs = append(rerunArgs, arg)
+			continue
+		}
+		if password == "" {
+			fmt.Println("[!] ERROR - The run used an archive password, which is not recorded. Provide it with 'goauditparser rerun -ep <password> " + manifestPath + "'.")
+			return nil, FlagConflictExitCode
+		}
+		if arg == runManifestRedacted && i > 0 {
+			rerunArgs = append(rerunArgs, password)
+		} else {
+			rerunArgs = append(rerunArgs, strings.TrimSuffix(arg, runManifestRedacted)+password)
+		}
+	}
+	if outputDir != "" {
+		rerunArgs = append(rerunArgs, "-o", outputDir)
+	}
+
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Println("[!] - " + problem)
+		}
+		if !force {
+			fmt.Println("[!] ERROR - The run can't be repeated identically, " + strconv.Itoa(len(problems)) + " difference(s) found. Use '-f' to repeat it anyway.")
+			return nil, 1
+		}
+		fmt.Println("[!] WARNING - Repeating the run with " + strconv.Itoa(len(problems)) + " difference(s) because of '-f'.")
+	} else {
+		fmt.Println("[+] Version, configs, and " + strconv.Itoa(len(manifest.Inputs)) + " input file(s) match the manifest.")
+	}
+	fmt.Println("[+] Running: goauditparser " + strings.Join(redactRunArgs(rerunArgs), " "))
+	return rerunArgs, 0
+}
@@ -0,0 +1,319 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Descriptions of the files GoAuditParser writes next to the parsed files, for the '-readme' file
+var runReadmeFileDescriptions = map[string]string{
+	"_GAPRunManifest.json":        "Version, flags, and SHA256 of the configs and input files of the run ('-manifest'). Repeat the run with \"goauditparser rerun <manifest>\".",
+	"_GAPRunSummary.json":         "Parse statistics of the last parse by host and audit type, and the status of every XML file.",
+	"_GAPDataQuality.csv":         "Empty rate, longest value, and timestamp normalization failures of each column of each file ('-pdq').",
+	"_GAPParseAnomalies.csv":      "Unexpected tags and lines skipped or truncated while parsing ('-pap lenient').",
+	TagRuleHitsFileName:           "Rows, hosts, and audit types each '-tag' rule matched in the last parse, including rules which matched nothing.",
+	"_GAPWipeLog.txt":             "Files deleted from this directory by '-wo'.",
+	"_GAPRetentionLog.txt":        "Files deleted from this directory by '-retention <int>'.",
+	"_GAPProgress.json":           "Progress of the last run for dashboards and automation ('-progress').",
+	"_GAPMemoryImages.json":       "Hashes of the extracted memory images.",
+	"_GAPExtractionManifest.json": "Extracted acquired files and their original timestamps.",
+	"_ExtractedFilesManifest.csv": "Extracted acquired files with their original paths, sizes, and MD5/SHA1/SHA256 hashes ('-eh').",
+	ObservablesCSVFileName:        "Hashes, IPs, domains, URLs, and file paths of the parsed files with their hosts and audits ('-obs').",
+	ObservablesSTIXFileName:       "The observables of the parsed files as a STIX 2.1 bundle of indicators ('-obs').",
+	XLSXDirName:                   "Excel workbooks of the parsed files ('-xlsx').",
+	InputScratchDirName:           "Parse cache, checkpoints, split XML files, and extracted archives of read-only input ('-readonly-input').",
+}
+
+//"  -<flag> [<type>]  <Name>  <description>" lines of the help menu
+var helpMenuFlagLineRegex = regexp.MustCompile(`(?m)^  -([a-z0-9-]+)(?: <[a-z]+>)?\s+(\S.*?)\s{2,}`)
+
+//RunReadme describes the output directory of a run in "_README_<runid>.md" ('-readme')
+type RunReadme struct {
+	Started  time.Time
+	Args     []string          //Command line of the run, archive passwords are redacted
+	Flags    map[string]string //Every flag set on the command line or by ".gapflags", and its value
+	FlagFile string            //".gapflags" file applied, or ""
+}
+
+//NewRunReadme records the flags of a run for '-readme' before it starts
+//setFlags holds the names of the flags set on the command line or by flagFile, the ".gapflags" file applied or ""
+func NewRunReadme(setFlags map[string]bool, flagFile string) *RunReadme {
+	readme := &RunReadme{
+		Started:  time.Now(),
+		Args:     redactRunArgs(os.Args[1:]),
+		Flags:    map[string]string{},
+		FlagFile: flagFile,
+	}
+	for name := range setFlags {
+		if f := flag.Lookup(name); f != nil {
+			readme.Flags[name] = f.Value.String()
+		}
+	}
+	if _, exists := readme.Flags["ep"]; exists {
+		readme.Flags["ep"] = runManifestRedacted
+	}
+	return readme
+}
+
+//RunReadmeFileName returns the name of the '-readme' file of a run
+func RunReadmeFileName(options Options) string {
+	return "_README_" + options.RunID + ".md"
+}
+
+//Returns the names of the flags from the help menu, such as "Recursive Input" for "r"
+func helpMenuFlagNames() map[string]string {
+	names := map[string]string{}
+	for _, match := range helpMenuFlagLineRegex.FindAllStringSubmatch(GetHelpMenu(), -1) {
+		if _, exists := names[match[1]]; !exists {
+			names[match[1]] = match[2]
+		}
+	}
+	return names
+}
+
+//Escapes a value for a cell of a Markdown table
+func runReadmeCell(value string) string {
+	return strings.NewReplacer("|", `\|`, "\r", " ", "\n", " ").Replace(value)
+}
+
+//Returns a Markdown link to path from the output directory, or the path itself if it can't be made relative
+func runReadmeLink(outputDir string, path string) string {
+	rel, err_r := filepath.Rel(outputDir, path)
+	if err_r != nil {
+		rel = path
+	}
+	return "[" + filepath.Base(path) + "](<" + filepath.ToSlash(rel) + ">)"
+}
+
+//runReadmeGroup counts the parsed files of a hostname or audit type
+type runReadmeGroup struct {
+	Files   int
+	Written int //Files written by this run
+	Names   map[string]bool
+}
+
+func addRunReadmeGroup(groups map[string]*runReadmeGroup, key string, name string, written bool) {
+	group, exists := groups[key]
+	if !exists {
+		group = &runReadmeGroup{Names: map[string]bool{}}
+		groups[key] = group
+	}
+	group.Files++
+	if written {
+		group.Written++
+	}
+	group.Names[name] = true
+}
+
+func sortedRunReadmeKeys(values map[string]bool) []string {
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//Save writes "_README_<runid>.md" to the output directory once the run finishes, describing each file in it, the hosts
+//and audit types covered, the flags used, and the timelines written. Returns the path written
+//A nil readme is ignored
+func (readme *RunReadme) Save(options Options) (string, error) {
+	if readme == nil {
+		return "", nil
+	}
+	cases := TimelineCases(options.OutputPath)
+	outputDir := cases[0].Path
+	if err_d := MkdirAllOutput(options, outputDir); err_d != nil {
+		return "", err_d
+	}
+	files, err_r := ReadOutputDir(options, outputDir)
+	if err_r != nil {
+		return "", err_r
+	}
+	sort.Strings(files)
+
+	//Parsed files by hostname and audit type, other files by what they are
+	hosts := map[string]*runReadmeGroup{}
+	audits := map[string]*runReadmeGroup{}
+	timelines := []string{}
+	others := [][2]string{}
+	sidecars := 0
+	for _, name := range files {
+		base := filepath.Base(name)
+		info, err_s := os.Stat(filepath.Join(outputDir, name))
+		if err_s != nil || strings.HasSuffix(base, TempFileSuffix) {
+			continue
+		}
+		written := !info.ModTime().Before(readme.Started)
+		switch {
+		case strings.HasSuffix(base, OutputMetaSuffix):
+			sidecars++
+		case strings.HasPrefix(base, "_Timeline_"):
+			if written {
+				timelines = append(timelines, filepath.Join(outputDir, name))
+			}
+			description := "Timeline."
+			if strings.HasSuffix(base, "_Anomalies.csv") {
+				description = "Hourly event spikes, gaps, and log clearing of the timeline ('-tlanom')."
+			}
+			others = append(others, [2]string{name, description})
+		case strings.HasPrefix(base, "_README_") && strings.HasSuffix(base, ".md"):
+			others = append(others, [2]string{name, "Description of the output directory after an earlier run ('-readme')."})
+		case IsGoAuditParserOutputFile(base):
+			parts := strings.Split(strings.TrimSuffix(base, filepath.Ext(base)), "-")
+			hostname := strings.Join(parts[0:len(parts)-3], "-")
+			agentID := parts[len(parts)-3]
+			auditType := parts[len(parts)-1]
+			addRunReadmeGroup(hosts, hostname, agentID, written)
+			addRunReadmeGroup(audits, auditType, hostname, written)
+		default:
+			others = append(others, [2]string{name, runReadmeFileDescriptions[base]})
+		}
+	}
+	for _, dir := range []string{XLSXDirName, InputScratchDirName} {
+		if _, err_s := os.Stat(filepath.Join(outputDir, dir)); err_s == nil {
+			others = append(others, [2]string{dir + "/", runReadmeFileDescriptions[dir]})
+		}
+	}
+	//Timelines written outside of the output directory
+	if options.TimelineOutputFile != "" {
+		if info, err_s := os.Stat(options.TimelineOutputFile); err_s == nil && !info.ModTime().Before(readme.Started) && !PathWithinInput(outputDir, options.TimelineOutputFile) {
+			timelines = append(timelines, options.TimelineOutputFile)
+		}
+	} else if len(cases) > 1 {
+		caseTimelines, _ := filepath.Glob("_Timeline_Cases_*")
+		for _, path := range caseTimelines {
+			if info, err_s := os.Stat(path); err_s == nil && !info.ModTime().Before(readme.Started) {
+				abs, _ := filepath.Abs(path)
+				timelines = append(timelines, abs)
+			}
+		}
+	}
+
+	var md strings.Builder
+	line := func(text string) {
+		md.WriteString(text + "\n")
+	}
+	finished := time.Now()
+	line("# GoAuditParser Output")
+	line("")
+	line("Written by GoAuditParser " + version + " for run `" + options.RunID + "`, which ran from " + readme.Started.UTC().Format("2006-01-02 15:04:05") + " to " + finished.UTC().Format("2006-01-02 15:04:05") + " UTC.")
+	line("")
+	if options.TimelineOnly {
+		line("This run timelined the CSV files which were already parsed into `" + options.OutputPath + "`.")
+	} else {
+		line("This run parsed the audits of `" + options.InputPath + "` into this directory. Parsed files are named `<hostname>-<agentid>-<payload>-<audittype>.csv`.")
+	}
+	line("")
+
+	line("## Timelines")
+	line("")
+	if len(timelines) == 0 {
+		line("No timeline was written by this run.")
+	}
+	for _, path := range timelines {
+		line("- " + runReadmeLink(outputDir, path))
+	}
+	line("")
+
+	hostnames := []string{}
+	for hostname := range hosts {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Slice(hostnames, func(i, j int) bool {
+		return strings.ToLower(hostnames[i]) < strings.ToLower(hostnames[j])
+	})
+	line("## Hosts")
+	line("")
+	line(strconv.Itoa(len(hostnames)) + " host(s) have parsed files in this directory.")
+	line("")
+	if len(hostnames) > 0 {
+		line("| Hostname | Agent IDs | Files | Written by this run |")
+		line("|---|---|---|---|")
+		for _, hostname := range hostnames {
+			group := hosts[hostname]
+			line("| " + runReadmeCell(hostname) + " | " + runReadmeCell(strings.Join(sortedRunReadmeKeys(group.Names), ", ")) + " | " + strconv.Itoa(group.Files) + " | " + strconv.Itoa(group.Written) + " |")
+		}
+		line("")
+	}
+
+	auditTypes := []string{}
+	for auditType := range audits {
+		auditTypes = append(auditTypes, auditType)
+	}
+	sort.Strings(auditTypes)
+	line("## Audit Types")
+	line("")
+	if len(auditTypes) > 0 {
+		line("| Audit Type | Description | Hosts | Files | Written by this run |")
+		line("|---|---|---|---|---|")
+		for _, auditType := range auditTypes {
+			group := audits[auditType]
+			line("| " + runReadmeCell(auditType) + " | " + runReadmeCell(auditTypeDescriptions[auditType]) + " | " + strconv.Itoa(len(group.Names)) + " | " + strconv.Itoa(group.Files) + " | " + strconv.Itoa(group.Written) + " |")
+		}
+	} else {
+		line("No parsed files are in this directory.")
+	}
+	line("")
+
+	line("## Other Files")
+	line("")
+	if sidecars > 0 {
+		line(strconv.Itoa(sidecars) + " `" + OutputMetaSuffix + "` sidecar(s) record the row count and SHA256 of a parsed file ('-pmeta'). Check them with `goauditparser verify-outputs -o <csv_dir>`.")
+		line("")
+	}
+	if len(others) > 0 {
+		line("| File | Description |")
+		line("|---|---|")
+		for _, other := range others {
+			line("| " + runReadmeLink(outputDir, filepath.Join(outputDir, other[0])) + " | " + runReadmeCell(other[1]) + " |")
+		}
+	} else if sidecars == 0 {
+		line("None.")
+	}
+	line("")
+
+	line("## Flags")
+	line("")
+	line("```")
+	line("goauditparser " + strings.Join(readme.Args, " "))
+	line("```")
+	line("")
+	if readme.FlagFile != "" {
+		line("Default flags were read from `" + readme.FlagFile + "`.")
+		line("")
+	}
+	if len(readme.Flags) > 0 {
+		names := helpMenuFlagNames()
+		line("| Flag | Name | Value |")
+		line("|---|---|---|")
+		flags := []string{}
+		for name := range readme.Flags {
+			flags = append(flags, name)
+		}
+		sort.Strings(flags)
+		for _, name := range flags {
+			line("| -" + name + " | " + runReadmeCell(names[name]) + " | " + runReadmeCell(readme.Flags[name]) + " |")
+		}
+		line("")
+	}
+
+	path := filepath.Join(outputDir, RunReadmeFileName(options))
+	return path, WriteOutputFile(options, path, []byte(md.String()), 0644)
+}
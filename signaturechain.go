@@ -0,0 +1,148 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Number of "Signer<n>" and "Issuer<n>" column pairs, the whole chain is always in "SignatureChain"
+const signatureChainColumns = 3
+
+//SignatureChainLink is one certificate of a signature chain, from the signer towards the root
+type SignatureChainLink struct {
+	Subject string `json:"Subject"`
+	Issuer  string `json:"Issuer"`
+}
+
+//Subject/issuer column pair of one level of the nested PEInfo signature columns
+type signatureChainColumnPair struct {
+	prefix  string
+	subject int
+	issuer  int
+}
+
+//Returns the dotted path of a PEInfo certificate subject or issuer column and whether it is the subject
+func signatureChainColumn(header string) (string, bool, bool) {
+	if !strings.HasPrefix(header, "PEInfo.") || !strings.Contains(header, "Signature") {
+		return "", false, false
+	}
+	i := strings.LastIndex(header, ".")
+	name := header[i+1:]
+	switch name {
+	case "CertificateSubject", "Subject":
+		return header[:i], true, true
+	case "CertificateIssuer", "Issuer":
+		return header[:i], false, true
+	}
+	return "", false, false
+}
+
+//EnrichSignatureChains adds "Signer1", "Issuer1", ... and a "SignatureChain" JSON column to FileItem audits,
+//flattening the certificate subjects and issuers of the nested PEInfo signature columns in chain order
+//Each level of the chain holds one value per certificate, split with the multi-value separator
+func EnrichSignatureChains(options Options, auditType string, csvHeaders []string, csvRows [][]string) ([]string, [][]string) {
+	if strings.ToLower(auditType) != "fileitem" {
+		return csvHeaders, csvRows
+	}
+	levels := map[string]*signatureChainColumnPair{}
+	for i, header := range csvHeaders {
+		prefix, isSubject, ok := signatureChainColumn(header)
+		if !ok {
+			continue
+		}
+		if _, exists := levels[prefix]; !exists {
+			levels[prefix] = &signatureChainColumnPair{prefix, -1, -1}
+		}
+		if isSubject {
+			levels[prefix].subject = i
+		} else {
+			levels[prefix].issuer = i
+		}
+	}
+	if len(levels) == 0 {
+		return csvHeaders, csvRows
+	}
+	//The signer of the file comes first, then the certificates nested below it
+	pairs := []*signatureChainColumnPair{}
+	for _, pair := range levels {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(a, b int) bool {
+		depthA, depthB := strings.Count(pairs[a].prefix, "."), strings.Count(pairs[b].prefix, ".")
+		if depthA != depthB {
+			return depthA < depthB
+		}
+		return pairs[a].prefix < pairs[b].prefix
+	})
+
+	sep := GetMultiValueSeparator(options)
+	if sep == "\r\n" {
+		sep = "\n"
+	}
+	split := func(row []string, col int) []string {
+		if col == -1 || row[col] == "" {
+			return nil
+		}
+		values := strings.Split(row[col], sep)
+		for i := range values {
+			values[i] = strings.TrimSuffix(values[i], "\r")
+		}
+		return values
+	}
+
+	for i := 1; i <= signatureChainColumns; i++ {
+		csvHeaders = append(csvHeaders, "Signer"+strconv.Itoa(i), "Issuer"+strconv.Itoa(i))
+	}
+	csvHeaders = append(csvHeaders, "SignatureChain")
+	for i := range csvRows {
+		chain := []SignatureChainLink{}
+		seen := map[SignatureChainLink]bool{}
+		for _, pair := range pairs {
+			subjects := split(csvRows[i], pair.subject)
+			issuers := split(csvRows[i], pair.issuer)
+			for j := 0; j < len(subjects) || j < len(issuers); j++ {
+				link := SignatureChainLink{}
+				if j < len(subjects) {
+					link.Subject = subjects[j]
+				}
+				if j < len(issuers) {
+					link.Issuer = issuers[j]
+				}
+				//The signer is often repeated as the first certificate of the chain
+				if (link.Subject == "" && link.Issuer == "") || seen[link] {
+					continue
+				}
+				seen[link] = true
+				chain = append(chain, link)
+			}
+		}
+		values := make([]string, 0, 2*signatureChainColumns+1)
+		for j := 0; j < signatureChainColumns; j++ {
+			if j < len(chain) {
+				values = append(values, chain[j].Subject, chain[j].Issuer)
+			} else {
+				values = append(values, "", "")
+			}
+		}
+		if len(chain) > 0 {
+			b, _ := json.Marshal(chain)
+			values = append(values, string(b))
+		} else {
+			values = append(values, "")
+		}
+		csvRows[i] = append(csvRows[i], values...)
+	}
+	return csvHeaders, csvRows
+}
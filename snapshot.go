@@ -0,0 +1,53 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+//SnapshotLatestName is the symlink in the output directory pointing at the last finished snapshot ('-snapshot')
+const SnapshotLatestName = "latest"
+
+//NewSnapshotPath returns a new "<out_dir>/<yyyy-mm-dd_hhmmss>" snapshot directory which does not exist yet
+func NewSnapshotPath(outputPath string) string {
+	name := time.Now().Format("2006-01-02_150405")
+	path := filepath.Join(outputPath, name)
+	for i := 2; ; i++ {
+		if _, err_s := os.Lstat(path); os.IsNotExist(err_s) {
+			return path
+		}
+		path = filepath.Join(outputPath, name+"_"+strconv.Itoa(i))
+	}
+}
+
+//UpdateLatestSnapshot points "<out_dir>/latest" at a finished snapshot directory
+//The new symlink is renamed over the old one so "latest" always points at a complete snapshot
+func UpdateLatestSnapshot(outputPath string, snapshotPath string) error {
+	latest := filepath.Join(outputPath, SnapshotLatestName)
+	tmp := latest + "_" + strconv.Itoa(os.Getpid())
+	os.Remove(tmp)
+	if err_s := os.Symlink(filepath.Base(snapshotPath), tmp); err_s != nil {
+		return err_s
+	}
+	if err_r := os.Rename(tmp, latest); err_r != nil {
+		//Windows can't rename over an existing directory symlink
+		os.Remove(latest)
+		if err_r = os.Rename(tmp, latest); err_r != nil {
+			os.Remove(tmp)
+			return err_r
+		}
+	}
+	return nil
+}
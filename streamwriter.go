@@ -0,0 +1,204 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"hash"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//Rows of one file when ExcelFriendly, like the 1mil row splits of WriteCSVOutput
+const streamedSplitRows = 999999
+
+//Per value overhead of a parsed row held in memory, used to estimate the size of the rows '-pstream' holds
+const streamedValueOverhead = 64
+
+//UseStreamedParsing returns true if '-pstream <int>' writes the rows of a normal audit to its output file while parsing
+//Files smaller than the memory bound are parsed in memory, since their rows fit in it anyway
+func UseStreamedParsing(options Options, xmlFileSize int64) bool {
+	return options.ParseStreamMB > 0 && !options.ParseInMemory && xmlFileSize >= int64(options.ParseStreamMB)*1024*1024
+}
+
+//ScanNormalAuditHeaders is the first pass of '-pstream' over a normal audit, parsing it without keeping its rows
+//Returns the headers in the order the second pass finds them, or a message if the file could not be parsed
+//A line too long for the read buffer ends the scan early, the second pass reports it
+func ScanNormalAuditHeaders(options Options, es1 ExtraStruct1, es2 ExtraStruct2, xmlFilePath string, xmlFileName string, xmlFileSize int64, itemTag string) (map[string]int, string) {
+	file, err_o := os.Open(xmlFilePath)
+	if err_o != nil {
+		return nil, options.Warnbox + `ERROR - Could not parse file '` + xmlFileName + `'. ` + err_o.Error()
+	}
+	defer file.Close()
+	//Anomalies are recorded by the second pass
+	anomalies := NewParseAnomalies(options, xmlFileName)
+	scanner, _ := newOffsetScanner(file, 0, options.ParseLineBufferSize, anomalies.ScanLines(options.ParseLineBufferSize))
+	next := func() (string, bool) {
+		if !scanner.Scan() {
+			return "", false
+		}
+		return scanner.Text(), true
+	}
+	noop := func() string { return "" }
+	discard := func(map[string]int, []map[int]*strings.Builder, int) bool { return true }
+	headers, _, _, errmsg := parseNormalAuditLines(options, es1, es2, next, itemTag, xmlFileName, xmlFilePath, xmlFileSize, normalAuditStart{InHeader: true}, anomalies, noop, discard, nil, nil)
+	return headers, errmsg
+}
+
+//CopyHeaderMap returns a copy of a map of headers to column IDs
+func CopyHeaderMap(headers map[string]int) map[string]int {
+	copied := make(map[string]int, len(headers))
+	for header, colID := range headers {
+		copied[header] = colID
+	}
+	return copied
+}
+
+//StreamedRowsSize estimates the memory held by parsed rows for '-pstream'
+func StreamedRowsSize(rows []map[int]*strings.Builder) int64 {
+	size := int64(0)
+	for _, row := range rows {
+		for _, value := range row {
+			size += int64(value.Len()) + streamedValueOverhead
+		}
+	}
+	return size
+}
+
+//A file StreamedOutput writes, the first one is the temp file of the output and the others are 1mil row splits
+type streamedFile struct {
+	file       *os.File
+	writer     *bufio.Writer
+	hash       hash.Hash
+	tempPath   string
+	headerRows int
+	rows       int
+}
+
+//StreamedOutput is a parsed file '-pstream' writes batch by batch while its XML file is parsed
+//The writer threads finish it by renaming its temp file(s) like any other output, see WriteCSVOutput
+type StreamedOutput struct {
+	Rows    int //Rows written
+	headers []string
+	desc    []string
+	files   []*streamedFile
+}
+
+//NewStreamedOutput returns a streamed output whose first file is the already created temp file of the output
+func NewStreamedOutput(tempFile *os.File, tempPath string) *StreamedOutput {
+	return &StreamedOutput{files: []*streamedFile{{file: tempFile, tempPath: tempPath}}}
+}
+
+//Write writes a batch of rows, starting a new 1mil row split if ExcelFriendly. The headers and field descriptions
+//are written to the top of each file, and must be the same for every batch
+func (s *StreamedOutput) Write(options Options, output CSVWriteOutput, headers []string, desc []string, rows [][]string) error {
+	if s.headers == nil {
+		s.headers, s.desc = headers, desc
+		if err_w := s.start(options, s.files[0], output.Source); err_w != nil {
+			return err_w
+		}
+	}
+	format := GetOutputFormat(options)
+	for len(rows) > 0 {
+		current := s.files[len(s.files)-1]
+		if options.ExcelFriendly && current.rows == streamedSplitRows {
+			tempPath := TempOutputPath(options, CSVSplitPath(options, output, len(s.files)+1))
+			file, err_c := CreateOutputFile(options, tempPath)
+			if err_c != nil {
+				return err_c
+			}
+			current = &streamedFile{file: file, tempPath: tempPath}
+			s.files = append(s.files, current)
+			if err_w := s.start(options, current, output.Source); err_w != nil {
+				return err_w
+			}
+		}
+		n := len(rows)
+		if options.ExcelFriendly && current.rows+n > streamedSplitRows {
+			n = streamedSplitRows - current.rows
+		}
+		if err_w := format.WriteRows(options, current.writer, s.headers, rows[:n]); err_w != nil {
+			return err_w
+		}
+		current.rows += n
+		s.Rows += n
+		rows = rows[n:]
+	}
+	return nil
+}
+
+//Writes the provenance line and headers of a file
+func (s *StreamedOutput) start(options Options, f *streamedFile, source string) error {
+	f.hash = NewOutputMetaHash(options)
+	f.writer = bufio.NewWriterSize(OutputMetaWriter(f.file, f.hash), 1024*1024)
+	if err_w := WriteProvenanceComment(options, f.writer, source); err_w != nil {
+		return err_w
+	}
+	var err_w error
+	f.headerRows, err_w = GetOutputFormat(options).Write(options, f.writer, s.headers, s.desc, nil)
+	return err_w
+}
+
+//Finish renames the temp file(s) to their final names and writes their '-pmeta' sidecars
+//If no batch was written, such as when every row was filtered out, the file only has headers like WriteCSVOutput writes
+//Returns an error message like WriteCSVOutput, or "" if every file was written
+func (s *StreamedOutput) Finish(options Options, output CSVWriteOutput) string {
+	if s.headers == nil {
+		if err_w := s.Write(options, output, output.Headers, output.Desc, nil); err_w != nil {
+			s.Abort()
+			return `ERROR - Could not write file '` + s.files[0].tempPath + `'. ` + err_w.Error()
+		}
+	}
+	for _, f := range s.files {
+		err_w := f.writer.Flush()
+		if err_c := f.file.Close(); err_w == nil {
+			err_w = err_c
+		}
+		if err_w != nil {
+			s.Abort()
+			return `ERROR - Could not write file '` + f.tempPath + `'. ` + err_w.Error()
+		}
+	}
+	for i, f := range s.files {
+		path := output.Path
+		if len(s.files) > 1 {
+			path = CSVSplitPath(options, output, i+1)
+		}
+		if err_r := os.Rename(f.tempPath, path); err_r != nil {
+			return `ERROR - Could not rename temp file '` + filepath.Base(f.tempPath) + `' to normal file '` + filepath.Base(path) + `'. ` + err_r.Error()
+		}
+		if err_m := WriteOutputMeta(options, path, f.hash, output.Source, s.headers, f.headerRows, f.rows); err_m != nil {
+			return `ERROR - Could not write sidecar of file '` + filepath.Base(path) + `'. ` + err_m.Error()
+		}
+	}
+	return ""
+}
+
+//Paths returns the final paths of the files written, once Finish has renamed them
+func (s *StreamedOutput) Paths(options Options, output CSVWriteOutput) []string {
+	if len(s.files) == 1 {
+		return []string{output.Path}
+	}
+	paths := []string{}
+	for i := range s.files {
+		paths = append(paths, CSVSplitPath(options, output, i+1))
+	}
+	return paths
+}
+
+//Abort closes and removes the temp file(s), for files which could not be parsed
+func (s *StreamedOutput) Abort() {
+	for _, f := range s.files {
+		f.file.Close()
+		os.Remove(f.tempPath)
+	}
+}
@@ -0,0 +1,435 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//TagRuleHitsFileName is the per-rule hit summary of the '-tag' rules, written to the output directory after parsing
+const TagRuleHitsFileName = "_GAPTagRuleHits.csv"
+
+//" [<id>]" at the end of the tag of a rule
+var tagRuleIDRegex = regexp.MustCompile(`^(.*?)\s*\[([^\[\]]+)\]$`)
+
+//"<AuditType>.<Column>=<value>" or "<AuditType>.<Column>~<regex>" rules of a '-tag' file
+var tagFieldRuleRegex = regexp.MustCompile(`^([A-Za-z0-9_*?]+)\.([A-Za-z0-9_ ]+?)\s*([=~])\s*(.*)$`)
+
+//"i/", "c/", "a/", or a combination such as "ia/" in front of a rule
+var tagModifierRegex = regexp.MustCompile(`^([ica]+)/`)
+
+//How values are folded before a rule compares them
+const (
+	tagFoldCase    = 1
+	tagFoldAccents = 2
+)
+
+//TagRule is one line of a '-tag' file
+//Keywords and regexes match any column of every audit, field rules only the column of their audit types
+type TagRule struct {
+	ID        string //" [<id>]" after the tag, "L<line>" otherwise
+	Rule      string //The line as written, without its tag
+	Tag       string
+	AuditType string //Lowercase pattern, "" for keywords and regexes
+	Column    string
+	Keyword   string //Keyword or value, folded like the values it is compared to
+	Regex     *regexp.Regexp
+	Fold      int //tagFoldCase and tagFoldAccents applied to values before they are compared
+}
+
+//ReadTagRules reads a '-tag' file with one rule per line and '#' starting a comment:
+//  a keyword, matched in any column ignoring case              Ex: mimikatz
+//  a regex between slashes, matched in any column              Ex: /\\temp\\[a-z]{8}\.exe$/
+//  "<AuditType>.<Column>=<value>", matched ignoring case       Ex: FileItem.Md5sum=e2fc714c4727ee9395f324cd2e7f331f
+//  "<AuditType>.<Column>~<regex>"                              Ex: EventItem_*.RemoteIpAddress~^185\.220\.
+//AuditType may use "*" and "?" wildcards.
+//A rule may start with modifiers followed by "/":
+//  i  ignore case, for regexes since others already do         Ex: i//\\temp\\[a-z]{8}\.exe$/
+//  c  match case of keywords and values                        Ex: c/Invoke-Mimikatz
+//  a  ignore accents such as "é" in the rule and values        Ex: a/resume.pdf.exe
+//A rule may end with " => <tag>" to name its tag, which is the rule itself otherwise, and " [<id>]" to name its rule ID,
+//which is "L<line>" otherwise                                 Ex: evil.exe => Dropper [IOC-1042]
+func ReadTagRules(path string) ([]TagRule, error) {
+	file, err_o := os.Open(path)
+	if err_o != nil {
+		return nil, err_o
+	}
+	defer file.Close()
+	rules := []TagRule{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\uFEFF"))
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		rule, err_p := parseTagRule(text)
+		if err_p != nil {
+			return nil, errors.New("line " + strconv.Itoa(line) + ": " + err_p.Error())
+		}
+		if rule.ID == "" {
+			rule.ID = "L" + strconv.Itoa(line)
+		}
+		rules = append(rules, rule)
+	}
+	if err_s := scanner.Err(); err_s != nil {
+		return nil, err_s
+	}
+	return rules, nil
+}
+
+func parseTagRule(text string) (TagRule, error) {
+	rule := TagRule{}
+	if i := strings.LastIndex(text, " => "); i != -1 {
+		rule.Tag = strings.TrimSpace(text[i+4:])
+		text = strings.TrimSpace(text[:i])
+		if m := tagRuleIDRegex.FindStringSubmatch(rule.Tag); len(m) == 3 {
+			rule.Tag = m[1]
+			rule.ID = strings.TrimSpace(m[2])
+		}
+	}
+	rule.Rule = text
+	if rule.Tag == "" {
+		rule.Tag = text
+	}
+
+	modifiers := ""
+	if m := tagModifierRegex.FindStringSubmatch(text); len(m) == 2 {
+		modifiers = m[1]
+		text = text[len(m[0]):]
+		if strings.Contains(modifiers, "i") && strings.Contains(modifiers, "c") {
+			return rule, errors.New("rule '" + rule.Rule + "' can't both ignore case ('i/') and match case ('c/')")
+		}
+	}
+	//Keywords and values ignore case unless "c/" is used
+	if !strings.Contains(modifiers, "c") {
+		rule.Fold |= tagFoldCase
+	}
+	if strings.Contains(modifiers, "a") {
+		rule.Fold |= tagFoldAccents
+	}
+
+	if m := tagFieldRuleRegex.FindStringSubmatch(text); len(m) == 5 {
+		rule.AuditType = strings.ToLower(m[1])
+		rule.Column = strings.TrimSpace(m[2])
+		if _, err_m := path.Match(rule.AuditType, ""); err_m != nil {
+			return rule, errors.New("audit type '" + m[1] + "' is not a valid pattern")
+		}
+		if m[3] == "=" {
+			rule.Keyword = foldTagValue(m[4], rule.Fold)
+			return rule, nil
+		}
+		text = m[4]
+	} else if len(text) > 2 && strings.HasPrefix(text, "/") && strings.HasSuffix(text, "/") {
+		text = text[1 : len(text)-1]
+	} else {
+		rule.Keyword = foldTagValue(text, rule.Fold)
+		return rule, nil
+	}
+	//Regexes match case unless "i/" is used, values are only folded for "a/"
+	rule.Fold &^= tagFoldCase
+	if rule.Fold&tagFoldAccents != 0 {
+		text = FoldAccents(text)
+	}
+	if strings.Contains(modifiers, "i") {
+		text = "(?i)" + text
+	}
+	regex, err_c := regexp.Compile(text)
+	if err_c != nil {
+		return rule, errors.New("rule '" + rule.Rule + "' has an invalid regex. " + err_c.Error())
+	}
+	rule.Regex = regex
+	return rule, nil
+}
+
+//foldTagValue lowercases a value and removes its accents as the fold of a rule asks
+func foldTagValue(value string, fold int) string {
+	if fold&tagFoldCase != 0 {
+		value = strings.ToLower(value)
+	}
+	if fold&tagFoldAccents != 0 {
+		value = FoldAccents(value)
+	}
+	return value
+}
+
+//matches reports whether a value, already folded with the fold of the rule, matches the rule
+func (rule TagRule) matches(folded string) bool {
+	if rule.Regex != nil {
+		return rule.Regex.MatchString(folded)
+	}
+	if rule.Column != "" {
+		return folded == rule.Keyword
+	}
+	return strings.Contains(folded, rule.Keyword)
+}
+
+//FormatTagValue writes the tags of a row and the IDs of the rules which matched each of them
+//Ex: "APT Dropper [IOC-1042,IOC-1043] || mimikatz [L3]"
+func FormatTagValue(tags []string, ruleIDs map[string][]string) string {
+	values := []string{}
+	for _, tag := range tags {
+		if len(ruleIDs[tag]) == 0 {
+			values = append(values, tag)
+			continue
+		}
+		values = append(values, tag+" ["+strings.Join(ruleIDs[tag], ",")+"]")
+	}
+	return strings.Join(values, " || ")
+}
+
+//SplitTagValue splits a "Tag" column into its tags and the rule IDs of each one, tags written by hand have no rule IDs
+func SplitTagValue(value string) ([]string, map[string][]string) {
+	tags := []string{}
+	ruleIDs := map[string][]string{}
+	for _, entry := range strings.Split(value, " || ") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		tag := entry
+		if m := tagRuleIDRegex.FindStringSubmatch(entry); len(m) == 3 && m[1] != "" {
+			tag = m[1]
+			for _, id := range strings.Split(m[2], ",") {
+				ruleIDs[tag] = appendUniqueTag(ruleIDs[tag], strings.TrimSpace(id))
+			}
+		}
+		tags = appendUniqueTag(tags, tag)
+	}
+	return tags, ruleIDs
+}
+
+func appendUniqueTag(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+func sortedTagKeys(set map[string]bool) []string {
+	keys := []string{}
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//ApplyTagRules writes the tags of matching '-tag' rules with the IDs of the rules into the "Tag" column, and which column
+//each rule matched into the "Notes" column, of the rows of an audit, counting the hits of each rule for "_GAPTagRuleHits.csv"
+//Returns the number of rows tagged
+func ApplyTagRules(options Options, hostname string, auditType string, csvHeaders []string, csvRows [][]string) int {
+	if len(options.TagRules) == 0 {
+		return 0
+	}
+	col_index_tag, col_index_notes, col_index_hostname := -1, -1, -1
+	for i, header := range csvHeaders {
+		if header == "Tag" {
+			col_index_tag = i
+		} else if header == "Notes" {
+			col_index_notes = i
+		} else if header == "Hostname" {
+			col_index_hostname = i
+		}
+	}
+	if col_index_tag == -1 {
+		return 0
+	}
+
+	//Columns each rule of this audit type is checked against, every column but Tag and Notes for keywords and regexes
+	rules := []TagRule{}
+	ruleIndexes := []int{} //Index of each rule in options.TagRules, for the hit counts
+	ruleCols := [][]int{}
+	for r, rule := range options.TagRules {
+		cols := []int{}
+		if rule.AuditType != "" {
+			if matched, _ := path.Match(rule.AuditType, strings.ToLower(auditType)); !matched {
+				continue
+			}
+			for i, header := range csvHeaders {
+				if strings.EqualFold(header, rule.Column) {
+					cols = append(cols, i)
+				}
+			}
+		} else {
+			for i := range csvHeaders {
+				if i != col_index_tag && i != col_index_notes {
+					cols = append(cols, i)
+				}
+			}
+		}
+		if len(cols) > 0 {
+			rules = append(rules, rule)
+			ruleIndexes = append(ruleIndexes, r)
+			ruleCols = append(ruleCols, cols)
+		}
+	}
+	if len(rules) == 0 {
+		return 0
+	}
+	//Only the columns the rules compare are folded, once for each fold used on them
+	const folds = (tagFoldCase | tagFoldAccents) + 1
+	foldCols := [folds][]int{}
+	needsFold := [folds][]bool{}
+	for fold := 1; fold < folds; fold++ {
+		needsFold[fold] = make([]bool, len(csvHeaders))
+	}
+	for j, rule := range rules {
+		for _, i := range ruleCols[j] {
+			if rule.Fold != 0 && !needsFold[rule.Fold][i] {
+				needsFold[rule.Fold][i] = true
+				foldCols[rule.Fold] = append(foldCols[rule.Fold], i)
+			}
+		}
+	}
+
+	tagged := 0
+	hits := map[int]map[string]int{} //Index of the rule -> Hostname -> Rows
+	folded := [folds][]string{}
+	for fold := 1; fold < folds; fold++ {
+		folded[fold] = make([]string, len(csvHeaders))
+	}
+	for _, row := range csvRows {
+		if col_index_tag >= len(row) {
+			continue
+		}
+		folded[0] = row
+		for fold := 1; fold < folds; fold++ {
+			for _, i := range foldCols[fold] {
+				folded[fold][i] = ""
+				if i < len(row) {
+					folded[fold][i] = foldTagValue(row[i], fold)
+				}
+			}
+		}
+		//Tags already in the row, such as written by hand, are kept first
+		tags, ruleIDs := SplitTagValue(row[col_index_tag])
+		notes := []string{}
+		for j, rule := range rules {
+			for _, i := range ruleCols[j] {
+				if i >= len(row) || row[i] == "" || !rule.matches(folded[rule.Fold][i]) {
+					continue
+				}
+				tags = appendUniqueTag(tags, rule.Tag)
+				ruleIDs[rule.Tag] = appendUniqueTag(ruleIDs[rule.Tag], rule.ID)
+				notes = append(notes, "Tag rule "+rule.ID+" '"+rule.Rule+"' matched "+csvHeaders[i])
+				rowHostname := hostname
+				if col_index_hostname != -1 && col_index_hostname < len(row) && row[col_index_hostname] != "" {
+					rowHostname = row[col_index_hostname]
+				}
+				if _, exists := hits[ruleIndexes[j]]; !exists {
+					hits[ruleIndexes[j]] = map[string]int{}
+				}
+				hits[ruleIndexes[j]][rowHostname]++
+				break
+			}
+		}
+		if len(notes) == 0 {
+			continue
+		}
+		row[col_index_tag] = FormatTagValue(tags, ruleIDs)
+		if col_index_notes != -1 && col_index_notes < len(row) {
+			if row[col_index_notes] != "" {
+				notes = append([]string{row[col_index_notes]}, notes...)
+			}
+			row[col_index_notes] = strings.Join(notes, " || ")
+		}
+		tagged++
+	}
+	options.TagRuleHits.Add(auditType, len(csvRows), hits)
+	return tagged
+}
+
+//TagRuleHitLog counts the rows, hosts, and audit types each '-tag' rule matched in a run for "_GAPTagRuleHits.csv",
+//so the owners of the rules see which of them hit and how often
+type TagRuleHitLog struct {
+	mu         sync.Mutex
+	rules      []TagRule
+	rows       []int
+	hosts      []map[string]bool
+	auditTypes []map[string]bool
+	Checked    int //Rows the rules were checked against
+}
+
+func NewTagRuleHitLog(rules []TagRule) *TagRuleHitLog {
+	log := &TagRuleHitLog{rules: rules, rows: make([]int, len(rules))}
+	for range rules {
+		log.hosts = append(log.hosts, map[string]bool{})
+		log.auditTypes = append(log.auditTypes, map[string]bool{})
+	}
+	return log
+}
+
+//Add records the rows of an audit checked against the rules, and the rows each rule matched by hostname, a nil log is ignored
+func (log *TagRuleHitLog) Add(auditType string, checked int, hits map[int]map[string]int) {
+	if log == nil {
+		return
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.Checked += checked
+	for r, hostRows := range hits {
+		for hostname, rows := range hostRows {
+			log.rows[r] += rows
+			log.hosts[r][hostname] = true
+		}
+		log.auditTypes[r][auditType] = true
+	}
+}
+
+//Save writes the hits of every rule, including the rules which matched nothing, to "_GAPTagRuleHits.csv" in the output
+//directory, most rows first. It returns the path and the number of rules which matched at least one row
+func (log *TagRuleHitLog) Save(options Options) (string, int, error) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	csvPath := filepath.Join(options.OutputPath, TagRuleHitsFileName)
+	order := make([]int, len(log.rules))
+	for r := range order {
+		order[r] = r
+	}
+	sort.SliceStable(order, func(i, j int) bool { return log.rows[order[i]] > log.rows[order[j]] })
+	csvFile, err_c := CreateOutputFile(options, csvPath)
+	if err_c != nil {
+		return csvPath, 0, err_c
+	}
+	matched := 0
+	writer := csv.NewWriter(csvFile)
+	writer.Write([]string{"RuleID", "Tag", "Rule", "Rows", "HostCount", "Hosts", "AuditTypes"})
+	for _, r := range order {
+		if log.rows[r] > 0 {
+			matched++
+		}
+		writer.Write([]string{
+			log.rules[r].ID,
+			log.rules[r].Tag,
+			log.rules[r].Rule,
+			strconv.Itoa(log.rows[r]),
+			strconv.Itoa(len(log.hosts[r])),
+			strings.Join(sortedTagKeys(log.hosts[r]), ", "),
+			strings.Join(sortedTagKeys(log.auditTypes[r]), ", "),
+		})
+	}
+	writer.Flush()
+	csvFile.Close()
+	return csvPath, matched, writer.Error()
+}
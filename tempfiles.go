@@ -0,0 +1,171 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//TempFileSuffix ends the name of every file GoAuditParser is still writing
+//Temp files are named "<final name>.<run ID>.incomplete" and renamed to their final name once complete
+const TempFileSuffix = ".incomplete"
+
+//Temp files of runs on other machines sharing a directory are only orphaned once they are this old
+const tempFileOrphanAge = 24 * time.Hour
+
+//"<hostname>_<pid>_<start time>"
+var runIDRegex = regexp.MustCompile(`^([A-Za-z0-9]+)_(\d+)_([a-z0-9]+)$`)
+
+//NewRunID returns the ID of this run, used to name its temp files
+func NewRunID() string {
+	hostname, _ := os.Hostname()
+	hostname = regexp.MustCompile(`[^A-Za-z0-9]+`).ReplaceAllString(hostname, "")
+	if hostname == "" {
+		hostname = "localhost"
+	}
+	return hostname + "_" + strconv.Itoa(os.Getpid()) + "_" + strconv.FormatInt(time.Now().Unix(), 36)
+}
+
+//TempOutputPath returns the temp file path a file is written to before being renamed to path
+func TempOutputPath(options Options, path string) string {
+	if options.RunID == "" {
+		return path + TempFileSuffix
+	}
+	return path + "." + options.RunID + TempFileSuffix
+}
+
+//TempFileRunID returns the run ID of a temp file name, "" for temp files named before run IDs were added
+func TempFileRunID(filename string) (string, bool) {
+	if !strings.HasSuffix(filename, TempFileSuffix) {
+		return "", false
+	}
+	name := strings.TrimSuffix(filename, TempFileSuffix)
+	if runID := strings.TrimPrefix(filepath.Ext(name), "."); runIDRegex.MatchString(runID) {
+		return runID, true
+	}
+	return "", true
+}
+
+//TempFileFinalName returns the name a temp file will have once complete
+func TempFileFinalName(filename string) string {
+	runID, isTemp := TempFileRunID(filename)
+	if !isTemp {
+		return filename
+	}
+	name := strings.TrimSuffix(filename, TempFileSuffix)
+	if runID != "" {
+		name = strings.TrimSuffix(name, "."+runID)
+	}
+	return name
+}
+
+//IsOrphanedTempFile returns true if a temp file was left behind by a run which is no longer running
+func IsOrphanedTempFile(options Options, file os.FileInfo) bool {
+	runID, isTemp := TempFileRunID(file.Name())
+	if !isTemp || file.IsDir() || runID == options.RunID {
+		return false
+	}
+	if runID == "" {
+		return true
+	}
+	m := runIDRegex.FindStringSubmatch(runID)
+	thisHost := runIDRegex.FindStringSubmatch(NewRunID())
+	if m[1] == thisHost[1] {
+		pid, _ := strconv.Atoi(m[2])
+		return !processRunning(pid)
+	}
+	return time.Since(file.ModTime()) > tempFileOrphanAge
+}
+
+//Reports whether a process exists on this machine
+func processRunning(pid int) bool {
+	process, err_f := os.FindProcess(pid)
+	if err_f != nil {
+		return false
+	}
+	//FindProcess opens the process on Windows, so it exists
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	err_s := process.Signal(syscall.Signal(0))
+	return err_s == nil || errors.Is(err_s, syscall.EPERM)
+}
+
+//CleanupOrphanedTempFiles deletes temp files left behind by crashed or killed runs in the directories
+//The user is asked to confirm unless '-y' is used, and deletions are logged to "_GAPWipeLog.txt" of each directory
+func CleanupOrphanedTempFiles(options Options, dirs []string) {
+	orphans := map[string][]string{}
+	count := 0
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		if dir == "" || seen[filepath.Clean(dir)] {
+			continue
+		}
+		seen[filepath.Clean(dir)] = true
+		files, _ := ioutil.ReadDir(dir)
+		for _, file := range files {
+			if IsOrphanedTempFile(options, file) {
+				orphans[dir] = append(orphans[dir], file.Name())
+				count++
+			}
+		}
+	}
+	if count == 0 {
+		return
+	}
+
+	options.Log.Println(options.Warnbox + "NOTICE - Found " + strconv.Itoa(count) + " incomplete file(s) left behind by previous runs:")
+	for dir, filenames := range orphans {
+		for _, filename := range filenames {
+			options.Log.Println(options.Box + "  " + filepath.Join(dir, filename))
+		}
+	}
+	if !options.AssumeYes {
+		reader := bufio.NewReader(os.Stdin)
+		options.Log.Println(options.Box + "Delete them? [Y/N]")
+		fmt.Print("> ")
+		text, _ := reader.ReadString('\n')
+		if !strings.HasPrefix(strings.TrimSpace(strings.ToLower(text)), "y") {
+			options.Log.Println(options.Box + "NOTICE - Not deleting any incomplete files.")
+			return
+		}
+	}
+
+	for dir, filenames := range orphans {
+		logPath := filepath.Join(dir, "_GAPWipeLog.txt")
+		logFile, err_o := OpenOutputFile(options, logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err_o != nil {
+			options.Log.Println(options.Warnbox + "WARNING - Could not open deletion log '" + logPath + "'. Not deleting incomplete files in '" + dir + "'.")
+			continue
+		}
+		for _, filename := range filenames {
+			status := "DELETED INCOMPLETE"
+			if err_r := os.Remove(filepath.Join(dir, filename)); err_r != nil {
+				status = "FAILED (" + err_r.Error() + ")"
+				options.Log.Println(options.Warnbox + "WARNING - Could not delete incomplete file '" + filename + "'. " + err_r.Error())
+			}
+			logFile.WriteString(time.Now().UTC().Format("2006-01-02 15:04:05") + "\t" + status + "\t" + filepath.Join(dir, filename) + "\n")
+		}
+		logFile.Close()
+	}
+	options.Log.Println(options.Box + "Deleted " + strconv.Itoa(count) + " incomplete file(s). Deletions logged to '_GAPWipeLog.txt'.")
+}
@@ -0,0 +1,81 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//Letters of each base letter or letters with accents, such as "é" of "e", for FoldAccents
+var accentFoldGroups = [][2]string{
+	{"A", "ÀÁÂÃÄÅĀĂĄǍȀȂ"}, {"a", "àáâãäåāăąǎȁȃ"},
+	{"C", "ÇĆĈĊČ"}, {"c", "çćĉċč"},
+	{"D", "ĎĐÐ"}, {"d", "ďđð"},
+	{"E", "ÈÉÊËĒĔĖĘĚȄȆ"}, {"e", "èéêëēĕėęěȅȇ"},
+	{"G", "ĜĞĠĢ"}, {"g", "ĝğġģ"},
+	{"H", "ĤĦ"}, {"h", "ĥħ"},
+	{"I", "ÌÍÎÏĨĪĬĮİǏ"}, {"i", "ìíîïĩīĭįıǐ"},
+	{"J", "Ĵ"}, {"j", "ĵ"},
+	{"K", "Ķ"}, {"k", "ķ"},
+	{"L", "ĹĻĽĿŁ"}, {"l", "ĺļľŀł"},
+	{"N", "ÑŃŅŇ"}, {"n", "ñńņň"},
+	{"O", "ÒÓÔÕÖØŌŎŐǑ"}, {"o", "òóôõöøōŏőǒ"},
+	{"R", "ŔŖŘ"}, {"r", "ŕŗř"},
+	{"S", "ŚŜŞŠȘ"}, {"s", "śŝşšș"},
+	{"T", "ŢŤŦȚ"}, {"t", "ţťŧț"},
+	{"U", "ÙÚÛÜŨŪŬŮŰŲǓ"}, {"u", "ùúûüũūŭůűųǔ"},
+	{"W", "Ŵ"}, {"w", "ŵ"},
+	{"Y", "ÝŶŸ"}, {"y", "ýÿŷ"},
+	{"Z", "ŹŻŽ"}, {"z", "źżž"},
+	{"AE", "Æ"}, {"ae", "æ"}, {"OE", "Œ"}, {"oe", "œ"}, {"ss", "ß"}, {"TH", "Þ"}, {"th", "þ"},
+	{"Α", "Ά"}, {"Ε", "Έ"}, {"Η", "Ή"}, {"Ι", "ΊΪ"}, {"Ο", "Ό"}, {"Υ", "ΎΫ"}, {"Ω", "Ώ"},
+	{"α", "ά"}, {"ε", "έ"}, {"η", "ή"}, {"ι", "ίϊΐ"}, {"ο", "ό"}, {"υ", "ύϋΰ"}, {"ω", "ώ"},
+}
+
+var accentFolds = func() map[rune]string {
+	folds := map[rune]string{}
+	for _, group := range accentFoldGroups {
+		for _, r := range group[1] {
+			folds[r] = group[0]
+		}
+	}
+	return folds
+}()
+
+//FoldAccents removes the accents of Latin and Greek letters, such as "Résumé" to "Resume", and combining marks of
+//decomposed text, so localized values match whether or not they were written with accents. Case is kept
+func FoldAccents(value string) string {
+	ascii := true
+	for i := 0; i < len(value); i++ {
+		if value[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return value
+	}
+	var folded strings.Builder
+	folded.Grow(len(value))
+	for _, r := range value {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if base, exists := accentFolds[r]; exists {
+			folded.WriteString(base)
+		} else {
+			folded.WriteRune(r)
+		}
+	}
+	return folded.String()
+}
@@ -0,0 +1,255 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"encoding/csv"
+	"log"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Hours without events between two active hours of a host before they are reported as a gap
+const timelineAnomalyGapHours = 24
+
+//Events an hour needs before it can be reported as a spike
+const timelineAnomalySpikeMinEvents = 20
+
+//Robust z-score (distance from the median in scaled MADs) an hour needs to be reported as a spike
+const timelineAnomalySpikeScore = 6.0
+
+//Event knowledge category of the events which clear a log
+const timelineAnomalyLogCleared = "Log Cleared"
+
+//TimelineDensity counts the events of each host per hour while the timeline is written, for '-tlanom'
+type TimelineDensity struct {
+	knowledge map[string]EventKnowledge
+	hosts     map[timelineDensityHost]*timelineDensityCounts
+	last      time.Time //Last active hour of any host
+}
+
+//Hosts of composite timelines are kept apart by case
+type timelineDensityHost struct {
+	Case     string
+	Hostname string
+}
+
+type timelineDensityCounts struct {
+	hours   map[time.Time]int
+	cleared map[time.Time]int //Log clearing events per hour
+}
+
+//TimelineAnomaly is one row of the anomalies file
+type TimelineAnomaly struct {
+	Host     timelineDensityHost
+	Type     string
+	Start    time.Time
+	End      time.Time //Start of the last hour included
+	Events   int
+	Baseline float64 //Median events of the active hours of the host
+	Details  string
+}
+
+//NewTimelineDensity uses the '-ekp' knowledge pack, or the built-in one, to recognize log clearing events
+func NewTimelineDensity(options Options) *TimelineDensity {
+	knowledge := options.EventKnowledgePack
+	if knowledge == nil {
+		knowledge, _ = LoadEventKnowledge("")
+	}
+	return &TimelineDensity{knowledge: knowledge, hosts: map[timelineDensityHost]*timelineDensityCounts{}}
+}
+
+//timelineDensityHour returns the hour of a timeline timestamp such as "2019-12-19 11:11:45" or "2019-12-19T11:11:45.299Z"
+func timelineDensityHour(timestamp string) (time.Time, bool) {
+	t, err_p := ParseTime(timestamp)
+	return t.Truncate(time.Hour), err_p == nil
+}
+
+//Add counts the events merged into a timeline row, rows without a timestamp are skipped
+func (density *TimelineDensity) Add(tRow *TimelineRow) {
+	hour, ok := timelineDensityHour(tRow.Timestamp)
+	if !ok {
+		return
+	}
+	host := timelineDensityHost{tRow.Case, timelineJoinValues(tRow.ExtraColumns["Hostname"]["Hostname"])}
+	counts, exists := density.hosts[host]
+	if !exists {
+		counts = &timelineDensityCounts{hours: map[time.Time]int{}, cleared: map[time.Time]int{}}
+		density.hosts[host] = counts
+	}
+	counts.hours[hour] += tRow.Count + 1
+	if hour.After(density.last) {
+		density.last = hour
+	}
+
+	if tRow.Source != "EventLogItem" {
+		return
+	}
+	for source, _ := range tRow.SummaryColumns["source"] {
+		for eid, _ := range tRow.SummaryColumns["EID"] {
+			if entry, known := LookupEventKnowledge(density.knowledge, source, eid); known && entry.Category == timelineAnomalyLogCleared {
+				counts.cleared[hour] += tRow.Count + 1
+				return
+			}
+		}
+	}
+}
+
+//timelineMedian returns the median of values, which it sorts
+func timelineMedian(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	middle := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[middle-1] + values[middle]) / 2
+	}
+	return values[middle]
+}
+
+//Anomalies returns the spikes, gaps, and log clearing of every host, sorted by host and time
+//Spikes are hours far above the median of the active hours of their host, measured in median absolute deviations
+//Gaps are runs of at least 24 silent hours between active hours, or after clearing a log until the end of the timeline
+func (density *TimelineDensity) Anomalies() []TimelineAnomaly {
+	anomalies := []TimelineAnomaly{}
+	for host, counts := range density.hosts {
+		hours := []time.Time{}
+		values := []float64{}
+		for hour, count := range counts.hours {
+			hours = append(hours, hour)
+			values = append(values, float64(count))
+		}
+		sort.Slice(hours, func(i, j int) bool { return hours[i].Before(hours[j]) })
+		median := timelineMedian(values)
+		deviations := []float64{}
+		for _, value := range values {
+			deviations = append(deviations, math.Abs(value-median))
+		}
+		//1.4826 scales the MAD to the standard deviation of normally distributed counts
+		scale := 1.4826 * timelineMedian(deviations)
+		if scale < 1 {
+			scale = 1
+		}
+
+		lastCleared := time.Time{}
+		clearedIndex := -1
+		for i, hour := range hours {
+			count := counts.hours[hour]
+			if score := (float64(count) - median) / scale; count >= timelineAnomalySpikeMinEvents && score >= timelineAnomalySpikeScore {
+				anomalies = append(anomalies, TimelineAnomaly{host, "Spike", hour, hour, count, median, "Robust z-score " + strconv.FormatFloat(score, 'f', 1, 64) + "."})
+			}
+			//Logs cleared in consecutive hours are one row
+			if cleared := counts.cleared[hour]; cleared > 0 && clearedIndex >= 0 && lastCleared.Add(time.Hour).Equal(hour) {
+				anomalies[clearedIndex].End = hour
+				anomalies[clearedIndex].Events += cleared
+				anomalies[clearedIndex].Details = strconv.Itoa(anomalies[clearedIndex].Events) + " log clearing event(s)."
+				lastCleared = hour
+			} else if cleared > 0 {
+				clearedIndex = len(anomalies)
+				anomalies = append(anomalies, TimelineAnomaly{host, "Log Cleared", hour, hour, cleared, median, strconv.Itoa(cleared) + " log clearing event(s)."})
+				lastCleared = hour
+			}
+
+			//Silence until the next active hour, or until the end of the timeline after clearing a log
+			next := density.last.Add(time.Hour)
+			if i+1 < len(hours) {
+				next = hours[i+1]
+			} else if lastCleared != hour {
+				continue
+			}
+			silent := int(next.Sub(hour).Hours()) - 1
+			if silent < timelineAnomalyGapHours {
+				continue
+			}
+			details := "No events for " + strconv.Itoa(silent) + " hour(s)"
+			if i+1 == len(hours) {
+				details += " until the end of the timeline"
+			}
+			if lastCleared == hour {
+				details += ", right after clearing a log"
+			}
+			anomalies = append(anomalies, TimelineAnomaly{host, "Gap", hour.Add(time.Hour), next.Add(-time.Hour), 0, median, details + "."})
+		}
+	}
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		if anomalies[i].Host != anomalies[j].Host {
+			if anomalies[i].Host.Case != anomalies[j].Host.Case {
+				return anomalies[i].Host.Case < anomalies[j].Host.Case
+			}
+			return anomalies[i].Host.Hostname < anomalies[j].Host.Hostname
+		}
+		if !anomalies[i].Start.Equal(anomalies[j].Start) {
+			return anomalies[i].Start.Before(anomalies[j].Start)
+		}
+		return anomalies[i].Type < anomalies[j].Type
+	})
+	return anomalies
+}
+
+//TimelineAnomaliesPath returns "<timeline>_Anomalies.csv" next to the timeline file
+func TimelineAnomaliesPath(timelinePath string) string {
+	return strings.TrimSuffix(timelinePath, filepath.Ext(timelinePath)) + "_Anomalies.csv"
+}
+
+//GoAuditTimeliner_WriteAnomalies writes the anomalies of a timeline for '-tlanom' to a CSV file next to it
+func GoAuditTimeliner_WriteAnomalies(options Options, density *TimelineDensity, timelinePath string) {
+	anomalies := density.Anomalies()
+	anomaliesPath := TimelineAnomaliesPath(timelinePath)
+	options.Log.Println(options.Box + "Writing " + strconv.Itoa(len(anomalies)) + " timeline anomalies...")
+	outputFile, err_c := CreateOutputFile(options, anomaliesPath)
+	if err_c != nil {
+		options.Log.Println(options.Warnbox + "ERROR - Could not create timeline anomalies file '" + anomaliesPath + "'.")
+		log.Fatal(err_c)
+	}
+	//Like the timeline, the "Case" column is only added for composite timelines
+	composite := false
+	for host, _ := range density.hosts {
+		composite = composite || host.Case != ""
+	}
+	writer := csv.NewWriter(outputFile)
+	headers := []string{"Hostname", "Type", "Start", "End", "Hours", "Events", "Baseline", "Details"}
+	if composite {
+		headers = append([]string{"Case"}, headers...)
+	}
+	writer.Write(headers)
+	for _, anomaly := range anomalies {
+		row := []string{
+			anomaly.Host.Hostname,
+			anomaly.Type,
+			anomaly.Start.Format("2006-01-02 15:04:05"),
+			anomaly.End.Add(time.Hour - time.Second).Format("2006-01-02 15:04:05"),
+			strconv.Itoa(int(anomaly.End.Sub(anomaly.Start).Hours()) + 1),
+			strconv.Itoa(anomaly.Events),
+			strconv.FormatFloat(anomaly.Baseline, 'f', -1, 64),
+			anomaly.Details,
+		}
+		if composite {
+			row = append([]string{anomaly.Host.Case}, row...)
+		}
+		writer.Write(row)
+	}
+	writer.Flush()
+	outputFile.Close()
+	if err_w := writer.Error(); err_w != nil {
+		options.Log.Println(options.Warnbox + "ERROR - Could not write timeline anomalies file '" + anomaliesPath + "'.")
+		log.Fatal(err_w)
+	}
+
+	ap, _ := filepath.Abs(anomaliesPath)
+	if options.Verbose > 0 || options.MinimizedOutput {
+		options.Log.Println(options.Box + "Timeline anomalies file: " + ap)
+	}
+}
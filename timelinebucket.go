@@ -0,0 +1,52 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var timelineBucketRegex = regexp.MustCompile(`^ *(\d+) *([smhd]) *$`)
+
+//ParseTimelineBucket returns the granularity of a '-tlbucket' value such as "1m", "15m", "1h", or "1d"
+func ParseTimelineBucket(bucket string) (time.Duration, error) {
+	matches := timelineBucketRegex.FindStringSubmatch(bucket)
+	if matches == nil {
+		return 0, errors.New("expected <int><s|m|h|d>, such as \"1m\" or \"1h\"")
+	}
+	amount, _ := strconv.Atoi(matches[1])
+	if amount <= 0 {
+		return 0, errors.New("the granularity must be greater than zero")
+	}
+	unit := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour, "d": 24 * time.Hour}[matches[2]]
+	return time.Duration(amount) * unit, nil
+}
+
+//TimelineBucketTimestamp truncates a parsed timestamp to the start of its bucket
+//Timestamps which can't be parsed, such as "N/A", are returned unchanged
+func TimelineBucketTimestamp(timestamp string, size time.Duration) string {
+	t, err_t := ParseTime(timestamp)
+	if err_t != nil {
+		return timestamp
+	}
+	return t.Truncate(size).Format(NormalizedTimeLayout)
+}
+
+//TimelineExactTimestamp returns the exact time of the events merged into a bucketed row, or their first and last time
+func TimelineExactTimestamp(row *TimelineRow) string {
+	if row.FirstTimestamp == row.LastTimestamp {
+		return row.FirstTimestamp
+	}
+	return row.FirstTimestamp + " - " + row.LastTimestamp
+}
@@ -0,0 +1,81 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//TimelineCase is one output directory of a composite timeline, Name is "" when only one directory is timelined
+type TimelineCase struct {
+	Name string
+	Path string
+}
+
+//timelineCaseFile is a parsed CSV file in the output directory of a case
+type timelineCaseFile struct {
+	Case TimelineCase
+	Name string
+}
+
+//TimelineCases splits a comma separated list of output directories such as "caseA/parsed,caseB/parsed" into cases
+//named by their paths without the directories every case shares at the end, here "caseA" and "caseB"
+func TimelineCases(outputPath string) []TimelineCase {
+	//An existing directory with a comma in its name is still a single output directory
+	if _, err_s := os.Stat(outputPath); err_s == nil || !strings.Contains(outputPath, ",") {
+		return []TimelineCase{{"", outputPath}}
+	}
+	paths := []string{}
+	for _, path := range strings.Split(outputPath, ",") {
+		path = strings.TrimSpace(path)
+		if path != "" {
+			paths = append(paths, filepath.Clean(path))
+		}
+	}
+	if len(paths) == 0 {
+		return []TimelineCase{{"", outputPath}}
+	} else if len(paths) == 1 {
+		return []TimelineCase{{"", paths[0]}}
+	}
+
+	parts := [][]string{}
+	for _, path := range paths {
+		parts = append(parts, strings.Split(filepath.ToSlash(path), "/"))
+	}
+	for {
+		last := parts[0][len(parts[0])-1]
+		shared := true
+		for _, part := range parts {
+			if len(part) < 2 || part[len(part)-1] != last {
+				shared = false
+				break
+			}
+		}
+		if !shared {
+			break
+		}
+		for i, part := range parts {
+			parts[i] = part[:len(part)-1]
+		}
+	}
+
+	cases := []TimelineCase{}
+	for i, path := range paths {
+		name := strings.Join(parts[i], "/")
+		if name == "" {
+			name = path
+		}
+		cases = append(cases, TimelineCase{name, path})
+	}
+	return cases
+}
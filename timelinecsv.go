@@ -0,0 +1,196 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"os"
+	"strings"
+)
+
+//timelineCSVReader reads the rows of a parsed CSV file for the timeliner, reusing one record for every row
+//Rows of files written by GoAuditParser are split without encoding/csv unless they contain quotes,
+//and only the columns passed to KeepColumns are kept, the others are left empty
+type timelineCSVReader struct {
+	lines  *bufio.Reader
+	csv    *csv.Reader //Used instead of lines for CSV files resaved by Excel or edited by hand
+	comma  byte
+	keep   []bool
+	record []string
+}
+
+func newTimelineCSVReader(r io.Reader) (*timelineCSVReader, CSVDialect) {
+	lineReader, dialect := newDialectLineReader(r)
+	reader := &timelineCSVReader{}
+	if dialect.IsDefault() {
+		reader.lines = lineReader
+		reader.comma = byte(dialect.Delimiter)
+	} else {
+		reader.csv = csv.NewReader(lineReader)
+		reader.csv.Comma = dialect.Delimiter
+		reader.csv.FieldsPerRecord = -1
+		reader.csv.LazyQuotes = true
+		reader.csv.ReuseRecord = true
+	}
+	return reader, dialect
+}
+
+//KeepColumns drops the values of every other column from the rows read after it, negative columns are ignored
+func (t *timelineCSVReader) KeepColumns(cols []int) {
+	t.keep = []bool{}
+	for _, col := range cols {
+		if col < 0 {
+			continue
+		}
+		for len(t.keep) <= col {
+			t.keep = append(t.keep, false)
+		}
+		t.keep[col] = true
+	}
+}
+
+func (t *timelineCSVReader) kept(col int) bool {
+	return t.keep == nil || (col < len(t.keep) && t.keep[col])
+}
+
+//Read returns the next row, which is only valid until the next call to Read
+func (t *timelineCSVReader) Read() ([]string, error) {
+	if t.csv != nil {
+		row, err_r := t.csv.Read()
+		if err_r != nil {
+			return nil, err_r
+		}
+		for i := range row {
+			if !t.kept(i) {
+				row[i] = ""
+			}
+		}
+		return row, nil
+	}
+
+	//Skip empty lines like encoding/csv
+	line := ""
+	for line == "" {
+		text, err_r := t.lines.ReadString('\n')
+		if err_r != nil && text == "" {
+			return nil, err_r
+		}
+		line = strings.TrimRight(text, "\r\n")
+	}
+
+	//Quoted values may hold delimiters and new-lines, read the whole row
+	for strings.IndexByte(line, '"') != -1 && !timelineCSVRowComplete(line, t.comma) {
+		text, err_r := t.lines.ReadString('\n')
+		if text == "" && err_r != nil {
+			break
+		}
+		line += "\n" + strings.TrimRight(text, "\r\n")
+	}
+
+	t.record = t.record[:0]
+	for i := 0; ; i++ {
+		value := ""
+		if strings.HasPrefix(line, `"`) {
+			value, line = timelineCSVUnquote(line[1:], t.comma)
+		} else {
+			j := strings.IndexByte(line, t.comma)
+			if j == -1 {
+				value, line = line, ""
+			} else {
+				value, line = line[:j], line[j:]
+			}
+		}
+		if !t.kept(i) {
+			value = ""
+		}
+		t.record = append(t.record, value)
+		if line == "" {
+			break
+		}
+		line = line[1:] //Delimiter
+	}
+	return t.record, nil
+}
+
+//Reports whether a row does not end inside a quoted field
+func timelineCSVRowComplete(line string, comma byte) bool {
+	for {
+		if !strings.HasPrefix(line, `"`) {
+			j := strings.IndexByte(line, comma)
+			if j == -1 {
+				return true
+			}
+			line = line[j+1:]
+			continue
+		}
+		line = line[1:]
+		for {
+			j := strings.IndexByte(line, '"')
+			if j == -1 {
+				return false
+			}
+			line = line[j+1:]
+			if strings.HasPrefix(line, `"`) {
+				line = line[1:]
+			} else if line == "" {
+				return true
+			} else if line[0] == comma {
+				line = line[1:]
+				break
+			}
+		}
+	}
+}
+
+//Return the value of a quoted field, given the text after its opening quote, and the text from the delimiter after it
+//Like encoding/csv with LazyQuotes, a quote not followed by a quote or the delimiter is kept
+func timelineCSVUnquote(text string, comma byte) (string, string) {
+	var b strings.Builder
+	for {
+		j := strings.IndexByte(text, '"')
+		if j == -1 {
+			//Unterminated quote runs to the end of the row
+			b.WriteString(text)
+			return b.String(), ""
+		}
+		if b.Len() == 0 && (j+1 == len(text) || text[j+1] == comma) {
+			return text[:j], text[j+1:]
+		}
+		b.WriteString(text[:j])
+		text = text[j+1:]
+		if strings.HasPrefix(text, `"`) {
+			b.WriteByte('"')
+			text = text[1:]
+		} else if text == "" || text[0] == comma {
+			return b.String(), text
+		} else {
+			b.WriteByte('"')
+		}
+	}
+}
+
+//openTimelineCSV opens a parsed CSV file, memory-mapped with '-tlmmap' where supported
+//The returned function closes the file
+func openTimelineCSV(options Options, path string) (io.Reader, func() error, error) {
+	if options.TimelineMmap {
+		if data, unmap, err_m := mmapFile(path); err_m == nil {
+			return bytes.NewReader(data), unmap, nil
+		}
+	}
+	file, err_o := os.Open(path)
+	if err_o != nil {
+		return nil, nil, err_o
+	}
+	return file, file.Close, nil
+}
@@ -0,0 +1,152 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+//timelineExtraExpression is an Extra_Fields entry computed from other columns of the row, such as "{{concat .Username "@" .Hostname}}>User"
+type timelineExtraExpression struct {
+	Field    string //Extra field the value is written to
+	template *template.Template
+	text     string
+}
+
+var timelineRegexCache = map[string]*regexp.Regexp{}
+var timelineRegexCacheLock sync.Mutex
+
+//Functions available to Extra_Fields expressions in addition to those of Go templates, such as "if", "and", "or", "eq", and "printf"
+var timelineExpressionFuncs = template.FuncMap{
+	//concat joins its values: {{concat .Username "@" .Hostname}}
+	"concat": func(values ...string) string {
+		return strings.Join(values, "")
+	},
+	//coalesce returns the first value which is not empty: {{coalesce .Username .SecurityID "unknown"}}
+	"coalesce": func(values ...string) string {
+		for _, value := range values {
+			if value != "" {
+				return value
+			}
+		}
+		return ""
+	},
+	//substr returns the characters from start of at most length: {{substr .Md5sum 0 8}}
+	"substr": func(value string, start int, length int) string {
+		runes := []rune(value)
+		if start < 0 {
+			start = 0
+		}
+		if start > len(runes) {
+			return ""
+		}
+		end := start + length
+		if length < 0 || end > len(runes) {
+			end = len(runes)
+		}
+		return string(runes[start:end])
+	},
+	//regex returns the first capture group of a regular expression, or the whole match without one: {{regex `\\([^\\]+)$` .path}}
+	"regex": func(expression string, value string) string {
+		timelineRegexCacheLock.Lock()
+		r, exists := timelineRegexCache[expression]
+		if !exists {
+			var err_c error
+			if r, err_c = regexp.Compile(expression); err_c != nil {
+				r = nil
+			}
+			timelineRegexCache[expression] = r
+		}
+		timelineRegexCacheLock.Unlock()
+		if r == nil {
+			return ""
+		}
+		m := r.FindStringSubmatch(value)
+		if len(m) > 1 {
+			return m[1]
+		} else if len(m) == 1 {
+			return m[0]
+		}
+		return ""
+	},
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"trim":    strings.TrimSpace,
+	"replace": func(old string, new string, value string) string { return strings.Replace(value, old, new, -1) },
+	//basename returns the last part of a Windows or Unix path: {{basename .FullPath}}
+	"basename": func(value string) string {
+		return value[strings.LastIndexAny(value, `\/`)+1:]
+	},
+}
+
+//timelineSplitExtraField returns the audit header and the extra field of an Extra_Fields entry such as "Md5sum>MD5"
+//Expressions are split at the last ">" after the template, and "" is returned for their audit header
+func timelineSplitExtraField(extraField string) (string, string) {
+	if strings.Contains(extraField, "{{") {
+		i := strings.LastIndex(extraField, ">")
+		if i == -1 || i < strings.LastIndex(extraField, "}}") {
+			return "", ""
+		}
+		return "", strings.TrimSpace(extraField[i+1:])
+	}
+	if strings.Contains(extraField, ">") {
+		return strings.Split(extraField, ">")[0], strings.Split(extraField, ">")[1]
+	}
+	return extraField, extraField
+}
+
+//Compile the Extra_Fields expressions of each audit once before any CSV files are read
+func timelineCompileExtraExpressions(options Options, config *Timeline_Config_JSON) {
+	for i, audit := range config.Audits {
+		config.Audits[i].extraExpressions = nil
+		for _, extraField := range audit.ExtraFields {
+			if !strings.Contains(extraField, "{{") {
+				continue
+			}
+			_, field := timelineSplitExtraField(extraField)
+			if field == "" {
+				options.Log.Println(options.Warnbox + "ERROR - Extra_Fields expression '" + extraField + "' of '" + audit.Name + "' in '" + options.TimelineConfigFile + "' must end with '>' and the extra field to write, such as '>Extra1'.")
+				log.Fatal("missing extra field")
+			}
+			text := extraField[:strings.LastIndex(extraField, ">")]
+			t, err_t := template.New(audit.FilenameSuffix).Option("missingkey=zero").Funcs(timelineExpressionFuncs).Parse(text)
+			if err_t != nil {
+				options.Log.Println(options.Warnbox + "ERROR - Could not parse the Extra_Fields expression '" + extraField + "' of '" + audit.Name + "' in '" + options.TimelineConfigFile + "'.")
+				log.Fatal(err_t)
+			}
+			config.Audits[i].extraExpressions = append(config.Audits[i].extraExpressions, timelineExtraExpression{field, t, text})
+		}
+	}
+}
+
+//Columns returns the indexes of the CSV headers an expression refers to as ".Header" or "Header" in quotes, such as (index . "Audit UID")
+func (expression timelineExtraExpression) Columns(headers []string) []int {
+	cols := []int{}
+	for iCol, header := range headers {
+		if strings.Contains(expression.text, "."+header) || strings.Contains(expression.text, `"`+header+`"`) {
+			cols = append(cols, iCol)
+		}
+	}
+	return cols
+}
+
+//Evaluate computes the expression for a row, with missing columns as "" and "" if it fails
+func (expression timelineExtraExpression) Evaluate(values map[string]string) string {
+	var b strings.Builder
+	if err_e := expression.template.Execute(&b, values); err_e != nil {
+		return ""
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,137 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"os"
+	"sort"
+)
+
+//Values of '-tlfmt <str>'
+const (
+	TimelineFormatCSV    = "csv"
+	TimelineFormatJSONL  = "jsonl"
+	TimelineFormatSQLite = "sqlite"
+)
+
+//Extensions of the timeline files of each '-tlfmt <str>' format
+//"sqlite" is added by timelineformat_sqlite.go, which is only built with "-tags sqlite"
+var timelineFormatExtensions = map[string]string{
+	TimelineFormatCSV:   ".csv",
+	TimelineFormatJSONL: ".jsonl",
+}
+
+//Starts SQLite timelines, nil unless built with "-tags sqlite"
+var newSQLiteTimelineWriter func(options Options, path string, headers []string) (TimelineWriter, error)
+
+//TimelineWriter writes the rows of a timeline file in one '-tlfmt <str>' format
+type TimelineWriter interface {
+	Write(row []string) error
+	//Close finishes the timeline file, which is incomplete until then
+	Close() error
+}
+
+//TimelineFormatNames returns the names accepted by '-tlfmt <str>'
+func TimelineFormatNames() []string {
+	names := []string{}
+	for name := range timelineFormatExtensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//TimelineFileExtension returns the extension of timeline files, ".csv" if no '-tlfmt <str>' was chosen
+func TimelineFileExtension(options Options) string {
+	if extension, exists := timelineFormatExtensions[options.TimelineFormat]; exists {
+		return extension
+	}
+	return ".csv"
+}
+
+//NewTimelineWriter starts a timeline file with its headers in the '-tlfmt <str>' format
+//outputFile is the created timeline file at path, which SQLite closes and replaces with its database
+func NewTimelineWriter(options Options, outputFile *os.File, path string, headers []string) (TimelineWriter, error) {
+	switch options.TimelineFormat {
+	case TimelineFormatJSONL:
+		return &jsonlTimelineWriter{outputFile, bufio.NewWriter(outputFile), headers}, nil
+	case TimelineFormatSQLite:
+		outputFile.Close()
+		if newSQLiteTimelineWriter == nil {
+			return nil, errors.New("SQLite timelines need GoAuditParser built with \"-tags sqlite\"")
+		}
+		return newSQLiteTimelineWriter(options, path, headers)
+	}
+	writer := csv.NewWriter(outputFile)
+	writer.Write(headers)
+	return &csvTimelineWriter{outputFile, writer}, nil
+}
+
+//WriteTimelineFile writes every row of a timeline to one file
+func WriteTimelineFile(options Options, outputFile *os.File, path string, headers []string, table [][]string) error {
+	writer, err_n := NewTimelineWriter(options, outputFile, path, headers)
+	if err_n != nil {
+		return err_n
+	}
+	for _, row := range table {
+		if err_w := writer.Write(row); err_w != nil {
+			writer.Close()
+			return err_w
+		}
+	}
+	return writer.Close()
+}
+
+type csvTimelineWriter struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+func (w *csvTimelineWriter) Write(row []string) error {
+	return w.writer.Write(row)
+}
+
+func (w *csvTimelineWriter) Close() error {
+	w.writer.Flush()
+	w.file.Close()
+	return w.writer.Error()
+}
+
+//One JSON object per row keyed by the headers in their order, empty cells are left out
+type jsonlTimelineWriter struct {
+	file    *os.File
+	writer  *bufio.Writer
+	headers []string
+}
+
+func (w *jsonlTimelineWriter) Write(row []string) error {
+	object := &nestedJSONObject{values: map[string]interface{}{}}
+	for i, header := range w.headers {
+		if i < len(row) && row[i] != "" {
+			object.set(header, row[i])
+		}
+	}
+	b, err_m := marshalNestedJSON(object)
+	if err_m != nil {
+		return err_m
+	}
+	w.writer.Write(b)
+	return w.writer.WriteByte('\n')
+}
+
+func (w *jsonlTimelineWriter) Close() error {
+	err_f := w.writer.Flush()
+	w.file.Close()
+	return err_f
+}
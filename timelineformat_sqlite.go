@@ -0,0 +1,121 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+//go:build sqlite
+// +build sqlite
+
+package goauditparser
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+//The SQLite timeline format of '-tlfmt sqlite', only built with "-tags sqlite" so other builds don't need modernc.org/sqlite
+
+//Name of the table of SQLite timelines
+const timelineSQLiteTable = "timeline"
+
+func init() {
+	timelineFormatExtensions[TimelineFormatSQLite] = ".sqlite"
+	newSQLiteTimelineWriter = openSQLiteTimelineWriter
+}
+
+//One "timeline" table with a column per header, written in a single transaction
+//The timestamp column is indexed once every row is written, which is faster than updating the index per row
+type sqliteTimelineWriter struct {
+	options Options
+	path    string
+	db      *sql.DB
+	tx      *sql.Tx
+	insert  *sql.Stmt
+	headers []string
+}
+
+//Returns the quoted SQLite name of a column or table, such as "Timestamp Description"
+func sqliteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func openSQLiteTimelineWriter(options Options, path string, headers []string) (TimelineWriter, error) {
+	//Rows are never added to an existing timeline
+	if err_r := os.Remove(path); err_r != nil && !os.IsNotExist(err_r) {
+		return nil, err_r
+	}
+	db, err_o := sql.Open("sqlite", path)
+	if err_o != nil {
+		return nil, err_o
+	}
+	w := &sqliteTimelineWriter{options: options, path: path, db: db, headers: headers}
+	columns := []string{}
+	placeholders := []string{}
+	for _, header := range headers {
+		//"Count" of '-tlbucket' is a number so it can be summed and compared
+		columnType := "TEXT"
+		if header == "Count" {
+			columnType = "INTEGER"
+		}
+		columns = append(columns, sqliteIdentifier(header)+" "+columnType)
+		placeholders = append(placeholders, "?")
+	}
+	if _, err_c := db.Exec("CREATE TABLE " + sqliteIdentifier(timelineSQLiteTable) + " (" + strings.Join(columns, ", ") + ")"); err_c != nil {
+		db.Close()
+		return nil, err_c
+	}
+	var err_b error
+	if w.tx, err_b = db.Begin(); err_b != nil {
+		db.Close()
+		return nil, err_b
+	}
+	if w.insert, err_b = w.tx.Prepare("INSERT INTO " + sqliteIdentifier(timelineSQLiteTable) + " VALUES (" + strings.Join(placeholders, ", ") + ")"); err_b != nil {
+		w.tx.Rollback()
+		db.Close()
+		return nil, err_b
+	}
+	return w, nil
+}
+
+func (w *sqliteTimelineWriter) Write(row []string) error {
+	values := make([]interface{}, len(w.headers))
+	for i := range values {
+		if i < len(row) {
+			values[i] = row[i]
+		} else {
+			values[i] = ""
+		}
+	}
+	_, err_e := w.insert.Exec(values...)
+	return err_e
+}
+
+func (w *sqliteTimelineWriter) Close() error {
+	w.insert.Close()
+	if err_c := w.tx.Commit(); err_c != nil {
+		w.db.Close()
+		return err_c
+	}
+	//"Timestamp (UTC)" with '-tlsod'
+	for _, header := range w.headers {
+		if header == "Timestamp" || header == "Timestamp (UTC)" {
+			if _, err_i := w.db.Exec("CREATE INDEX " + sqliteIdentifier(timelineSQLiteTable+"_timestamp") + " ON " + sqliteIdentifier(timelineSQLiteTable) + " (" + sqliteIdentifier(header) + ")"); err_i != nil {
+				w.db.Close()
+				return err_i
+			}
+			break
+		}
+	}
+	if err_d := w.db.Close(); err_d != nil {
+		return err_d
+	}
+	return applyOutputPermissions(w.options, w.path, w.options.FileMode)
+}
@@ -0,0 +1,44 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+//go:build !windows
+// +build !windows
+
+package goauditparser
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+//Map a file read-only into memory, the returned function unmaps it
+func mmapFile(path string) ([]byte, func() error, error) {
+	file, err_o := os.Open(path)
+	if err_o != nil {
+		return nil, nil, err_o
+	}
+	defer file.Close()
+	stat, err_s := file.Stat()
+	if err_s != nil {
+		return nil, nil, err_s
+	}
+	size := stat.Size()
+	if size <= 0 || int64(int(size)) != size {
+		return nil, nil, errors.New("file size can not be memory-mapped")
+	}
+	data, err_m := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err_m != nil {
+		return nil, nil, err_m
+	}
+	return data, func() error {
+		return syscall.Munmap(data)
+	}, nil
+}
@@ -24,6 +24,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 )
 
@@ -41,74 +43,129 @@ type Timeline_Config_JSON struct {
 		TimestampFields []string `json:"Timestamp_Fields"`
 		SummaryFields   []string `json:"Summary_Fields"`
 		ExtraFields     []string `json:"Extra_Fields"`
+		SummaryTemplate string   `json:"Summary_Template,omitempty"`
+		summaryTemplate *template.Template
+		extraExpressions []timelineExtraExpression
 	} `json:"Audit_Timeline_Configs"`
 }
 
+//TimelineRow is one aggregated timeline event before it is formatted into CSV rows
+type TimelineRow struct {
+	Source               string
+	Timestamp            string
+	TimestampDescription map[string]bool
+	SummaryColumns       map[string]map[string]bool
+	ExtraColumns         map[string]map[string]map[string]bool
+	Count                int
+	Case                 string //Name of the case for a composite timeline, otherwise ""
+	FirstTimestamp       string //Exact times of the events merged into a '-tlbucket' row
+	LastTimestamp        string
+}
+
+//Merge adds the timestamp descriptions of a row with the same sort key
+func (tRow *TimelineRow) Merge(other *TimelineRow) {
+	for description, _ := range other.TimestampDescription {
+		tRow.TimestampDescription[description] = true
+	}
+	tRow.Count += other.Count + 1
+	if other.FirstTimestamp < tRow.FirstTimestamp {
+		tRow.FirstTimestamp = other.FirstTimestamp
+	}
+	if other.LastTimestamp > tRow.LastTimestamp {
+		tRow.LastTimestamp = other.LastTimestamp
+	}
+}
+
 func GoAuditTimeliner_Start(options Options) {
 
 	if options.Verbose > 0 {
-		fmt.Println(options.Box + "Starting timeline of CSV data...")
+		options.Log.Println(options.Box + "Starting timeline of CSV data...")
 	}
 	if !options.TimelineFilterEmpty {
-		fmt.Println(options.Box + "Time Filters: ")
+		options.Log.Println(options.Box + "Time Filters: ")
 		for _, t := range options.TimelineFilters {
-			fmt.Println(options.Box + "  + " + t[0].Format("2006-01-02 15:04:05") + " - " + t[1].Format("2006-01-02 15:04:05"))
+			options.Log.Println(options.Box + "  + " + t[0].Format("2006-01-02 15:04:05") + " - " + t[1].Format("2006-01-02 15:04:05"))
 		}
 	}
 
-	//Read Input Directory
-	files, err_r := ioutil.ReadDir(options.OutputPath)
-	if err_r != nil {
-		fmt.Println(options.Warnbox + "ERROR - Could not read output directory '" + options.OutputPath + "'.")
-		log.Fatal(err_r)
+	//Read Input Directory, or the output directory of each case for a composite timeline
+	cases := TimelineCases(options.OutputPath)
+	if len(cases) > 1 {
+		fmt.Println(options.Box+"Timelining", len(cases), "cases:")
+		for _, c := range cases {
+			options.Log.Println(options.Box + "  + " + c.Name + " ('" + c.Path + "')")
+		}
 	}
+	files := []timelineCaseFile{}
+	skipped := 0
+	for _, c := range cases {
+		caseFiles, err_r := ReadOutputDir(options, c.Path)
+		if err_r != nil {
+			options.Log.Println(options.Warnbox + "ERROR - Could not read output directory '" + c.Path + "'.")
+			log.Fatal(err_r)
+		}
 
-	//Ignore unwanted files
-	for i := 0; i < len(files); i++ {
-		name := filepath.Base(files[i].Name())
-		if strings.HasPrefix(name, "_Timeline_") || !strings.HasSuffix(name, ".csv") {
-			files = append(files[:i], files[i+1:]...)
-			i--
-			continue
+		//Ignore unwanted files, names include the "Output_Routes" subdirectory of the file
+		for _, name := range caseFiles {
+			if strings.HasPrefix(filepath.Base(name), "_Timeline_") || !strings.HasSuffix(name, ".csv") {
+				continue
+			}
+			if !options.TimelineSources.Matches(name) {
+				skipped++
+				continue
+			}
+			files = append(files, timelineCaseFile{c, name})
 		}
 	}
+	if skipped > 0 {
+		options.Log.Println(options.Box + "Skipping " + strconv.Itoa(skipped) + " parsed file(s) which don't match the host, agent ID, and audit type filters.")
+	}
 
-	if len(files) == 0 {
-		fmt.Println(options.Warnbox + "ERROR - Could not identify any files in output directory '" + options.OutputPath + "'.")
+	if len(files) == 0 && skipped > 0 {
+		options.Log.Println(options.Warnbox + "ERROR - No parsed files in output directory '" + options.OutputPath + "' match the host, agent ID, and audit type filters.")
 		return
+	} else if len(files) == 0 {
+		options.Log.Println(options.Warnbox + "ERROR - Could not identify any files in output directory '" + options.OutputPath + "'.")
+		return
+	}
+
+	//JSON Lines and SQLite timelines are not opened in Excel, so values are not truncated and files are not split
+	if options.TimelineFormat != "" && options.TimelineFormat != TimelineFormatCSV {
+		options.ExcelFriendly = false
 	}
 
 	//Create Output File
 	outputFilePath := options.TimelineOutputFile
-	if outputFilePath == "" {
-		outputFilePath = filepath.Join(options.OutputPath, "_Timeline_<DATE>_<TIME>.csv")
+	if outputFilePath == "" && len(cases) > 1 {
+		outputFilePath = "_Timeline_Cases_<DATE>_<TIME>" + TimelineFileExtension(options)
+	} else if outputFilePath == "" {
+		outputFilePath = filepath.Join(options.OutputPath, "_Timeline_<DATE>_<TIME>"+TimelineFileExtension(options))
 	}
 	currentTime := time.Now()
 	outputFilePath = strings.ReplaceAll(outputFilePath, "<DATE>", currentTime.Format("2006-01-02"))
 	outputFilePath = strings.ReplaceAll(outputFilePath, "<TIME>", currentTime.Format("1504"))
 
 	if options.Verbose > 0 {
-		fmt.Println(options.Box + "Creating output timeline file '" + outputFilePath + "'...")
+		options.Log.Println(options.Box + "Creating output timeline file '" + outputFilePath + "'...")
 	}
-	outputFile, err_c := os.Create(outputFilePath)
+	outputFile, err_c := CreateOutputFile(options, outputFilePath)
 	if err_c != nil {
-		fmt.Println(options.Warnbox + "ERROR - Could not create timeline file '" + outputFilePath + "'.")
+		options.Log.Println(options.Warnbox + "ERROR - Could not create timeline file '" + outputFilePath + "'.")
 		log.Fatal(err_c)
 	}
-	writer := csv.NewWriter(outputFile)
 
 	//Check for JSON Config File
 	if options.Verbose > 0 {
-		fmt.Println(options.Box + "Reading timeline config file '" + options.TimelineConfigFile + "'...")
+		options.Log.Println(options.Box + "Reading timeline config file '" + options.TimelineConfigFile + "'...")
 	}
 	_, err_s := os.Stat(options.TimelineConfigFile)
 	//If timelinefile file exists, create the file
 	if os.IsNotExist(err_s) {
 		//Create timeline config file
-		fmt.Println(options.Warnbox + "NOTICE - Timeline config file '" + options.TimelineConfigFile + "' does not exist. Creating new one...")
+		options.Log.Println(options.Warnbox + "NOTICE - Timeline config file '" + options.TimelineConfigFile + "' does not exist. Creating new one...")
 		file, err_c := os.Create(options.TimelineConfigFile)
 		if err_c != nil {
-			fmt.Println(options.Box + "ERROR - Could not create file '" + options.TimelineConfigFile + "'.")
+			options.Log.Println(options.Box + "ERROR - Could not create file '" + options.TimelineConfigFile + "'.")
 			log.Fatal(err_c)
 		}
 		file.WriteString(GetTimelineConfigTemplate())
@@ -118,28 +175,28 @@ func GoAuditTimeliner_Start(options Options) {
 	//Read JSON from timeline config file
 	file, err_o := os.Open(options.TimelineConfigFile)
 	if err_o != nil {
-		fmt.Println(options.Warnbox + "ERROR - Could not open file '" + options.TimelineConfigFile + "'.")
+		options.Log.Println(options.Warnbox + "ERROR - Could not open file '" + options.TimelineConfigFile + "'.")
 		log.Fatal(err_o)
 	}
 	b, err_i := ioutil.ReadAll(file)
 	if err_i != nil {
-		fmt.Println(options.Warnbox + "ERROR - Could not read contents from '" + options.TimelineConfigFile + "'.")
+		options.Log.Println(options.Warnbox + "ERROR - Could not read contents from '" + options.TimelineConfigFile + "'.")
 		log.Fatal(err_i)
 	}
 	var config Timeline_Config_JSON
 	err_j := json.Unmarshal(b, &config)
 	if err_j != nil {
-		fmt.Println(options.Warnbox + "ERROR - Could not read parse JSON from '" + options.TimelineConfigFile + "'.")
+		options.Log.Println(options.Warnbox + "ERROR - Could not read parse JSON from '" + options.TimelineConfigFile + "'.")
 		log.Fatal(err_j)
 	}
 	file.Close()
 	if config.Version != version {
 		if !config.DontOverwrite {
-			fmt.Println(options.Box + "Updating old timeline config v" + config.Version + " to v" + version + "...")
+			options.Log.Println(options.Box + "Updating old timeline config v" + config.Version + " to v" + version + "...")
 			//Write new JSON to timeline file
 			newFile, err_c := os.Create(options.TimelineConfigFile)
 			if err_c != nil {
-				fmt.Println(options.Warnbox + "ERROR - Could not create new version of file '" + options.TimelineConfigFile + "'")
+				options.Log.Println(options.Warnbox + "ERROR - Could not create new version of file '" + options.TimelineConfigFile + "'")
 				log.Fatal(err_c)
 			}
 			newFile.WriteString(GetTimelineConfigTemplate())
@@ -147,11 +204,11 @@ func GoAuditTimeliner_Start(options Options) {
 			//Parse in-memory config file
 			err_j := json.Unmarshal([]byte(GetTimelineConfigTemplate()), &config)
 			if err_j != nil {
-				fmt.Println(options.Warnbox + "ERROR - Could not parse pre-made JSON. Please contact the developer.'")
+				options.Log.Println(options.Warnbox + "ERROR - Could not parse pre-made JSON. Please contact the developer.'")
 				log.Fatal(err_j)
 			}
 		} else {
-			fmt.Println(options.Warnbox + "NOTICE - New timeline configuration version is available, but the JSON property 'Dont_Overwrite_With_New_Update' is set to 'true'.")
+			options.Log.Println(options.Warnbox + "NOTICE - New timeline configuration version is available, but the JSON property 'Dont_Overwrite_With_New_Update' is set to 'true'.")
 			time.Sleep(time.Second * 1)
 		}
 	}
@@ -161,6 +218,8 @@ func GoAuditTimeliner_Start(options Options) {
 		config.UniqueRowPerTimestamp = false
 		config.IncludeTimestamplessAudits = true
 	}
+	timelineCompileSummaryTemplates(options, &config)
+	timelineCompileExtraExpressions(options, &config)
 
 	//Create index map of timeline configs
 	audit2index := map[string]int{}
@@ -173,321 +232,122 @@ func GoAuditTimeliner_Start(options Options) {
 	for i, extraHeader := range config.ExtraFieldsOrder {
 		extra2index[extraHeader] = i
 	}
+	//Hostnames normalized with '-hs'/'-hl' keep the original hostname next to them, as parsing does
+	if _, exists := extra2index["OriginalHostname"]; !exists && HostnameNormalizationEnabled(options) {
+		extra2index["OriginalHostname"] = len(config.ExtraFieldsOrder)
+		config.ExtraFieldsOrder = append(config.ExtraFieldsOrder, "OriginalHostname")
+	}
 
 	//Create headers
 	headers := []string{"Timestamp", "Timestamp Description", "Summary", "Source"}
-	headers = append(headers, config.ExtraFieldsOrder...)
-
-	type TimeRow struct {
-		Source               string
-		Timestamp            string
-		TimestampDescription map[string]bool
-		SummaryColumns       map[string]map[string]bool
-		ExtraColumns         map[string]map[string]map[string]bool
-		Count                int
+	if len(cases) > 1 {
+		headers = append(headers, "Case")
+	}
+	if options.TimelineBucketSize > 0 {
+		headers = append(headers, "Exact Timestamp", "Count")
 	}
+	headers = append(headers, config.ExtraFieldsOrder...)
 
 	//Master table of data
-	rows := map[string]*TimeRow{}
+	rows := map[string]*TimelineRow{}
+	add := func(uniqueStr string, tRow *TimelineRow) {
+		if existing, rowExists := rows[uniqueStr]; rowExists {
+			existing.Merge(tRow)
+		} else {
+			rows[uniqueStr] = tRow
+		}
+	}
+	//Low-memory mode spills rows to sorted shards on disk instead
+	var stream *TimelineStream
+	if options.TimelineStream {
+		stream = NewTimelineStream(options)
+		defer stream.Close()
+		add = stream.Add
+	}
 
 	//Start time of timer
 	start := time.Now()
-	c_tqdm := make(chan bool)
-	go TQDM(len(files), options, options.Box+"Timelining", c_tqdm)
+	bar := NewProgressBar(options, options.Box+"Timelining", len(files))
 
 	threadMessages := []string{}
+	options.Progress.Stage(ProgressStageTimeline, len(files))
+	options.Log.StageStarted(ProgressStageTimeline, len(files))
 
-	//Iterate through files in directory
-	for _, file := range files {
-
-		//Find audit type
-		//fileSplit := strings.Split(file.Name(),"-")
-		auditType := strings.TrimSuffix(file.Name(), ".csv")
-		auditExists := false
-		for k, _ := range audit2index {
-			if strings.HasSuffix(auditType, k) {
-				auditExists = true
-				auditType = k
-				break
-			}
-		}
-		if !auditExists {
-			threadMessages = append(threadMessages, options.Warnbox+"WARNING - No configuration matching the suffix of file '"+file.Name()+"'.")
-			c_tqdm <- true
-			continue
-		}
-		auditConfigIndex, _ := audit2index[auditType]
-		auditConfig := config.Audits[auditConfigIndex]
-		//Open CSV file
-		fullPath := filepath.Join(options.OutputPath, file.Name())
-		opencsvfile, err_o := os.Open(fullPath)
-		if err_o != nil {
-			fmt.Println(options.Warnbox + "ERROR - Could not open file '" + fullPath + "'.")
-			log.Fatal(err_o)
-		}
-		csvreader := csv.NewReader(opencsvfile)
-		headers, err_r := csvreader.Read()
-		if err_r != nil {
-			if err_r == io.EOF {
-				threadMessages = append(threadMessages, options.Warnbox+"WARNING - Could not read data as CSV for file '"+file.Name()+"'.")
-			} else {
-				threadMessages = append(threadMessages, options.Warnbox+"WARNING - Empty CSV file: '"+file.Name()+"'")
-			}
-			c_tqdm <- true
-			continue
-		}
+	//Files are read by up to '-t <int>' threads, which add their rows to the shared table one at a time
+	threads := options.Threads
+	if threads < 1 {
+		threads = 1
+	}
+	if len(files) < threads {
+		threads = len(files)
+	}
+	var addLock sync.Mutex
+	addShared := add
+	add = func(uniqueStr string, tRow *TimelineRow) {
+		addLock.Lock()
+		addShared(uniqueStr, tRow)
+		addLock.Unlock()
+	}
+	c := make(chan ThreadReturn_Timeline)
+	finish := func(done ThreadReturn_Timeline) {
+		options.Progress.Finish(done.threadnum)
+		threadMessages = append(threadMessages, done.messages...)
+		bar.Add(1)
+	}
 
-		//Determine available time headers
-		timeColIndexes := []int{}
-		timeColNames := []string{}
-		for _, timeHeader := range auditConfig.TimestampFields {
-			originalHeader := timeHeader
-			convertedHeader := timeHeader
-			if strings.Contains(timeHeader, ">") {
-				originalHeader = strings.Split(timeHeader, ">")[0]
-				convertedHeader = strings.Split(timeHeader, ">")[1]
-			}
-			for iCol, header := range headers {
-				if originalHeader == header {
-					timeColIndexes = append(timeColIndexes, iCol)
-					parts := strings.Split(convertedHeader, ".") //Make "FileItem.Created" just "Created"
-					lastPart := parts[len(parts)-1]
-					timeColNames = append(timeColNames, lastPart)
-				}
-			}
-		}
-		if options.Verbose > 2 {
-			fmt.Println(options.Box + "- Identified the following Timestamp Headers: \"" + strings.Join(timeColNames, ",") + "\"")
-		}
-		//Determine available summary headers
-		summaryColIndexes := []int{}
-		summaryColNames := []string{}
-		for _, summaryHeader := range auditConfig.SummaryFields {
-			originalHeader := summaryHeader
-			convertedHeader := summaryHeader
-			if strings.Contains(summaryHeader, ">") {
-				originalHeader = strings.Split(summaryHeader, ">")[0]
-				convertedHeader = strings.Split(summaryHeader, ">")[1]
-			}
-			for iCol, header := range headers {
-				if originalHeader == header {
-					summaryColIndexes = append(summaryColIndexes, iCol)
-					summaryColNames = append(summaryColNames, convertedHeader)
-				}
-			}
-		}
-		if options.Verbose > 2 {
-			fmt.Println(options.Box + "- Identified the following Summary Headers: \"" + strings.Join(summaryColNames, ",") + "\"")
-		}
-		//Determine available extra headers
-		extraColIndexes := [][]int{}
-		extraColAllNames := [][]string{} //Name Parts: [["Status", "crontabMinute", "crontabHour", "crontabDayOfMonth"], etc.]
-		extraColNames := []string{}      //Full Name:  ["Status||crontabMinute||crontabHour||crontabDayOfMonth", etc.]
-		for _, extraHeader := range auditConfig.ExtraFields {
-			//"Md5sum>MD5"
-			//"extraHeader>convertedHeader"
-			convertedHeader := extraHeader
-			if strings.Contains(extraHeader, ">") {
-				convertedHeader = strings.Split(extraHeader, ">")[1]
-				extraHeader = strings.Split(extraHeader, ">")[0]
-			}
-			for iCol, header := range headers {
-				found := false
-				cols := []int{}
-				names := []string{}
-				for _, extraHeaderPart := range strings.Split(extraHeader, "||") {
-					if extraHeaderPart == header {
-						cols = append(cols, iCol)
-						names = append(names, extraHeaderPart)
-						found = true
-					}
-				}
-				if found {
-					extraColAllNames = append(extraColAllNames, names)
-					extraColNames = append(extraColNames, convertedHeader)
-					extraColIndexes = append(extraColIndexes, cols)
-				}
-			}
-		}
-		if options.Verbose > 2 {
-			fmt.Println(options.Box + "- Identified the following Extra Headers: \"" + strings.Join(extraColNames, ",") + "\"")
+	//Iterate through files in directory
+	for i, file := range files {
+		if i >= threads {
+			finish(<-c)
 		}
-		//Iterate through the CSV rows
-		iRow := -1
-
-		source := auditType
-		for {
-			//Read row
-			iRow++
-			row, err_r := csvreader.Read()
-			if err_r != nil {
-				if err_r != io.EOF {
-					threadMessages = append(threadMessages, options.Warnbox+"WARNING - Could not read row index "+strconv.Itoa(iRow)+" of file '"+fullPath+"'.", err_r.Error())
-				}
-				break
-			}
-
-			//Identify all timestamps
-			//map[Time]map[Description]true
-			times := map[string]map[string]bool{}
-			//Get Timestamps and Descriptions
-			for i, iCol := range timeColIndexes {
-				timestamp := row[iCol]
-				description := timeColNames[i]
-				//Add event if no time filter
-				if options.TimelineFilterEmpty {
-					if _, exists := times[timestamp]; !exists {
-						times[timestamp] = map[string]bool{}
-					}
-					times[timestamp][description] = true
-					//Check if timestamp is in the provided time filters
-				} else {
-					t, err_t1 := time.Parse("2006-01-02 15:04:05", timestamp)
-					var err_t2 error
-					if err_t1 != nil {
-						t, err_t2 = time.Parse("2006-01-02 15:04:05.000", timestamp)
-					}
-					if err_t2 != nil && options.Verbose > 0 {
-						fmt.Println(options.Warnbox+"WARNING -", err_t1)
-					}
-					for _, f := range options.TimelineFilters {
-						if err_t1 == nil && f[0].Before(t) && f[1].After(t) {
-							if _, exists := times[timestamp]; !exists {
-								times[timestamp] = map[string]bool{}
-							}
-							times[timestamp][description] = true
-							break
-						}
-					}
-				}
-			}
-			if len(times) == 0 {
-				if config.IncludeTimestamplessAudits && options.TimelineFilterEmpty {
-					times["N/A"] = map[string]bool{}
-					times["N/A"]["N/A"] = true
-				} else {
-					continue
-				}
-			}
-
-			//Identify all summary values
-			//map[Header]map[Value]true
-			summaries := map[string]map[string]bool{}
-			//Get Summary Values
-			for i, iCol := range summaryColIndexes {
-				value := row[iCol]
-				if len(value) == 0 {
-					continue
-				}
-				header := summaryColNames[i]
-				if _, exists := summaries[header]; !exists {
-					summaries[header] = map[string]bool{}
-				}
-				summaries[header][value] = true
-			}
-
-			//Identify all extra values
-			//map[Header]map[ActualHeader]map[Value]true
-			//map["Status||crontabMinute||crontabHour"]map["crontabMinute"]map["01"] = true
-			extras := map[string]map[string]map[string]bool{}
-			//Get Extra Values
-			for i, iCols := range extraColIndexes {
-				for _, iCol := range iCols {
-					value := row[iCol]
-					if len(value) == 0 {
-						continue
-					}
-					header := extraColNames[i]
-					for _, actualHeader := range extraColAllNames[i] {
-						if _, exists := extras[header]; !exists {
-							extras[header] = map[string]map[string]bool{}
-						}
-						if _, exists := extras[header][actualHeader]; !exists {
-							extras[header][actualHeader] = map[string]bool{}
-						}
-						extras[header][actualHeader][value] = true
-					}
-				}
-			}
+		options.Progress.Start(i, file.Name)
+		go GoAuditTimeliner_Thread(options, config, audit2index, file, add, i, c)
+	}
 
-			//Create a row for each unique timestamp
-			for timeValue, descriptions := range times {
-				//Create a unique string for hashmap
-				mergedSummary := ""
-				for _, valueMap := range summaries {
-					for value, _ := range valueMap {
-						mergedSummary += value
-					}
-				}
-				mergedExtras := ""
-				for _, valueMap := range extras {
-					for _, valueMap2 := range valueMap {
-						for value, _ := range valueMap2 {
-							mergedExtras += value
-						}
-					}
-				}
-				mergedHostnames := "" //Should only ever be one hostname!
-				valueHostname, exists := extras["Hostname"]
-				if exists {
-					for value, _ := range valueHostname {
-						mergedHostnames += value
-					}
-				}
-				uniqueStr := timeValue + source + mergedSummary + mergedExtras + mergedHostnames
-				//Check if row already exists!
-				tRow, rowExists := rows[uniqueStr]
-				if rowExists {
-					for description, _ := range descriptions {
-						tRow.TimestampDescription[description] = true
-					}
-					tRow.Count++
-					rows[uniqueStr] = tRow
-				} else {
-					tRow = &TimeRow{
-						source,       //Source                  string
-						timeValue,    //Timestamp               string
-						descriptions, //TimestampDescription    map[string]bool
-						summaries,    //SummaryColumns          map[string]map[string]bool
-						extras,       //ExtraColumns            map[string]map[string]bool
-						0,            //Count                   int
-					}
-					rows[uniqueStr] = tRow
-				}
-			}
-		}
-		opencsvfile.Close()
-		threadMessages = append(threadMessages, options.Box+"NOTICE - Successfully timelined file '"+filepath.Base(file.Name())+"'.")
-		c_tqdm <- true
+	//Wait for last few threads
+	for i := 0; i < threads; i++ {
+		finish(<-c)
 	}
+	bar.Close()
+	options.Log.StageFinished(ProgressStageTimeline, len(files))
 
+	options.Progress.SetPosition(len(files), "")
 	time.Sleep(10 * time.Millisecond)
 	for _, msg := range threadMessages {
 		if strings.Contains(msg, "Successfully timelined") {
 			if options.Verbose > 0 {
-				fmt.Println(msg)
+				options.Log.Println(msg)
 			}
 		} else {
-			fmt.Println(msg)
+			options.Log.Println(msg)
 		}
 	}
 
-	fmt.Println(options.Box + "Finalizing timeline...")
+	options.Log.Println(options.Box + "Finalizing timeline...")
+
+	//Hourly event counts of each host for '-tlanom'
+	var density *TimelineDensity
+	if options.TimelineAnomalies {
+		density = NewTimelineDensity(options)
+	}
+
+	if stream != nil {
+		timelineFiles := GoAuditTimeliner_WriteStream(options, config, stream, headers, audit2index, extra2index, outputFile, outputFilePath, density)
+		if timelineFiles != nil {
+			if density != nil {
+				GoAuditTimeliner_WriteAnomalies(options, density, outputFilePath)
+			}
+			timelineFinish(options, config, start, len(files), timelineFiles)
+		}
+		return
+	}
 
 	if options.Verbose > 0 {
 		fmt.Println(options.Box+"- Determined", len(rows), "timeline rows.")
 	}
 	if len(rows) == 0 {
-		writer.Flush()
 		outputFile.Close()
-		fmt.Println(`[!] WARNING - No rows identified for the timeline. Possible reasons:
-    1. The specified audit data does not have any timestamps.
-    2. The specified output path does not contain any audit data.
-    3. The timeline configuration file "` + options.TimelineConfigFile + `" isn't set up properly.`)
-		fmt.Printf(`[!] If the issue persists, please contact the GoAuditParser developer.`)
-		if !options.MinimizedOutput {
-			fmt.Printf("\n")
-		}
+		TimelineNoRowsWarning(options)
 		return
 	}
 
@@ -500,7 +360,7 @@ func GoAuditTimeliner_Start(options Options) {
 	}
 	if !options.TimelineDeduplicate {
 		if options.Verbose > 0 {
-			fmt.Println(options.Box + "Sorting timeline...")
+			options.Log.Println(options.Box + "Sorting timeline...")
 		}
 		sort.Strings(uniqueStrings)
 		debug.FreeOSMemory()
@@ -508,101 +368,13 @@ func GoAuditTimeliner_Start(options Options) {
 
 	//Write each row to file
 	if options.Verbose > 0 {
-		fmt.Println(options.Box + "Assembling timeline...")
+		options.Log.Println(options.Box + "Assembling timeline...")
 	}
 	table := [][]string{}
 	for _, str := range uniqueStrings {
-		row := rows[str]
-		//Source
-		source := row.Source
-		auditConfigIndex, _ := audit2index[source]
-		auditConfig := config.Audits[auditConfigIndex]
-		//Timestamp
-		timestamp := row.Timestamp
-		//Timestamp Description
-		descriptions := []string{}
-		for tdesc, _ := range row.TimestampDescription {
-			descriptions = append(descriptions, tdesc)
-		}
-		sort.Strings(descriptions)
-		description := strings.Join(descriptions, " && ")
-		//Summary
-		summaries := []string{}
-		for _, header := range auditConfig.SummaryFields {
-			convertedHeader := header
-			if strings.Contains(header, ">") {
-				convertedHeader = strings.Split(header, ">")[1]
-			}
-
-			valueMap, exists := row.SummaryColumns[convertedHeader]
-			if !exists {
-				continue
-			}
-			if config.IncludeSummaryHeaders {
-				for value, _ := range valueMap {
-					summaries = append(summaries, convertedHeader+": "+value)
-				}
-			} else {
-				for value, _ := range valueMap {
-					summaries = append(summaries, value)
-				}
-			}
-		}
-		summary := strings.Join(summaries, " || ")
-		//Extras
-		extras := make([]string, len(config.ExtraFieldsOrder))
-		for _, extraHeader := range auditConfig.ExtraFields {
-			//"Md5sum>MD5"
-			//"extraHeader>convertedHeader"
-			convertedHeader := extraHeader
-			if strings.Contains(extraHeader, ">") {
-				convertedHeader = strings.Split(extraHeader, ">")[1]
-				extraHeader = strings.Split(extraHeader, ">")[0]
-			}
-			valueMap, exists := row.ExtraColumns[convertedHeader]
-			if !exists {
-				continue
-			}
-			i := extra2index[convertedHeader]
-
-			//Get sorted array of extra field subheaders
-			actualHeaders := []string{}
-			for actualHeader, _ := range valueMap {
-				actualHeaders = append(actualHeaders, actualHeader)
-			}
-			sort.Strings(actualHeaders)
-
-			extraValue := ""
-			for _, actualHeader := range actualHeaders {
-				actualHeaderMap := valueMap[actualHeader]
-				for value, _ := range actualHeaderMap {
-					valueForField := value
-					if config.IncludeSummaryHeaders && (strings.HasPrefix(convertedHeader, "Extra") || convertedHeader == "SubAuditType") {
-						valueForField = actualHeader + ": " + value
-					}
-					extraValue = strings.Join([]string{extraValue, valueForField}, " || ")
-				}
-			}
-			extraValue = strings.TrimPrefix(extraValue, " || ")
-			extras[i] = extraValue
-		}
-		//If config file tells us to have a unique row per timestamp description
-		if config.UniqueRowPerTimestamp {
-			for _, tdesc := range descriptions {
-				//Write row per timestamp description
-				outRow := append([]string{timestamp, tdesc, summary, source}, extras...)
-				if options.ExcelFriendly {
-					truncate32k(outRow)
-				}
-				table = append(table, outRow)
-			}
-		} else {
-			//Write row per timestamp
-			outRow := append([]string{timestamp, description, summary, source}, extras...)
-			if options.ExcelFriendly {
-				truncate32k(outRow)
-			}
-			table = append(table, outRow)
+		table = append(table, timelineFormatRow(options, config, audit2index, extra2index, rows[str])...)
+		if density != nil {
+			density.Add(rows[str])
 		}
 	}
 
@@ -610,7 +382,7 @@ func GoAuditTimeliner_Start(options Options) {
 
 	if options.TimelineDeduplicate {
 
-		fmt.Println(options.Box + "Deduplicating timeline...")
+		options.Log.Println(options.Box + "Deduplicating timeline...")
 
 		//Deduplicate rows
 		uniqueRows := map[string]bool{}
@@ -636,7 +408,7 @@ func GoAuditTimeliner_Start(options Options) {
 		debug.FreeOSMemory()
 
 		if options.Verbose > 0 {
-			fmt.Println(options.Box + "Sorting timeline...")
+			options.Log.Println(options.Box + "Sorting timeline...")
 		}
 
 		//Sort rows
@@ -657,30 +429,20 @@ func GoAuditTimeliner_Start(options Options) {
 	}
 
 	if options.TimelineSOD {
-		fmt.Println(options.Box + "Converting timeline to SOD format...")
-		for i, _ := range headers {
-			if headers[i] == "Timestamp" {
-				headers[i] = "Timestamp (UTC)"
-			} else if headers[i] == "Summary" {
-				headers[i] = "Event Description"
-			} else if headers[i] == "User" {
-				headers[i] = "Owner / Associated User"
-			} else if headers[i] == "AgentID" {
-				headers[i] = "Agent ID"
-			} else if headers[i] == "MD5" {
-				headers[i] = "Associated MD5"
-			}
-		}
-		desiredorder := []string{"Date Added", "Timestamp (UTC)", "Timestamp Description", "Hostname", "Agent ID", "Attribution", "Event Description", "Notes", "Owner / Associated User", "Associated MD5", "Associated SHA1", "Size", "Source IP", "Source Domain", "Destination IP", "Desintation Domain", "Data Theft", "MD5 HBI"}
-		table, headers = StringTable_SetColumnOrder(headers, desiredorder, table)
+		options.Log.Println(options.Box + "Converting timeline to SOD format...")
+		table, headers = timelineConvertSOD(headers, table)
+		table = options.TimelineSODDiff.Annotate(headers, table)
+		headers = options.TimelineSODDiff.Headers(headers)
 
 		debug.FreeOSMemory()
 	}
 
 	lasttimelinefilename := outputFilePath
+	timelineFiles := []string{outputFilePath}
 	//Split file if we are at 1mil rows for excel friendly mode
 	if options.ExcelFriendly && len(table) > 999999 {
-		fmt.Println(options.Box + "Writing Excel-friendly timeline(s)...")
+		options.Log.Println(options.Box + "Writing Excel-friendly timeline(s)...")
+		writer := csv.NewWriter(outputFile)
 		//lineCount % 1000000 == 0) {
 		for i := 0; i < len(table); i += 999999 {
 			isLastChunk := i+999999 > len(table)
@@ -696,41 +458,701 @@ func GoAuditTimeliner_Start(options Options) {
 
 			ap, _ := filepath.Abs(lasttimelinefilename)
 			if options.Verbose > 0 || options.MinimizedOutput {
-				fmt.Println(options.Box + "Timeline file: " + ap)
+				options.Log.Println(options.Box + "Timeline file: " + ap)
 			}
 			outputFilePathNew := strings.TrimSuffix(outputFilePath, ".csv") + "_" + strconv.Itoa((i/999999)+1) + ".csv"
 			lasttimelinefilename = outputFilePathNew
+			timelineFiles = append(timelineFiles, outputFilePathNew)
 			if options.Verbose > 0 {
-				fmt.Println(options.Box + "Splitting output at " + strconv.Itoa((i/999999)+1) + "mil rows to timeline file '" + outputFilePathNew + "'...")
+				options.Log.Println(options.Box + "Splitting output at " + strconv.Itoa((i/999999)+1) + "mil rows to timeline file '" + outputFilePathNew + "'...")
 			}
 			var err_c error
-			outputFile, err_c = os.Create(outputFilePathNew)
+			outputFile, err_c = CreateOutputFile(options, outputFilePathNew)
 			if err_c != nil {
-				fmt.Println(options.Warnbox + "ERROR - Could not create timeline split file '" + outputFilePathNew + "'.")
+				options.Log.Println(options.Warnbox + "ERROR - Could not create timeline split file '" + outputFilePathNew + "'.")
 				log.Fatal(err_c)
 			}
 			writer = csv.NewWriter(outputFile)
 		}
+		writer.Flush()
+		outputFile.Close()
 	} else {
-		fmt.Println(options.Box + "Writing timeline...")
-		writer.WriteAll(append([][]string{headers}, table...))
+		options.Log.Println(options.Box + "Writing timeline...")
+		if err_w := WriteTimelineFile(options, outputFile, outputFilePath, headers, table); err_w != nil {
+			options.Log.Println(options.Warnbox + "ERROR - Could not write timeline file '" + outputFilePath + "'.")
+			log.Fatal(err_w)
+		}
 	}
 
-	writer.Flush()
-	outputFile.Close()
 	ap, _ := filepath.Abs(lasttimelinefilename)
 	if options.Verbose > 0 || options.MinimizedOutput {
-		fmt.Println(options.Box + "Timeline file: " + ap)
+		options.Log.Println(options.Box + "Timeline file: " + ap)
+	}
+
+	if density != nil {
+		GoAuditTimeliner_WriteAnomalies(options, density, outputFilePath)
+	}
+
+	timelineFinish(options, config, start, len(files), timelineFiles)
+}
+
+type ThreadReturn_Timeline struct {
+	threadnum int
+	messages  []string
+}
+
+//GoAuditTimeliner_Thread adds the timeline rows of one parsed CSV file with add, which may be shared with other threads
+func GoAuditTimeliner_Thread(options Options, config Timeline_Config_JSON, audit2index map[string]int, file timelineCaseFile, add func(uniqueStr string, tRow *TimelineRow), threadNum int, c chan ThreadReturn_Timeline) {
+	//Find audit type
+	//fileSplit := strings.Split(file.Name(),"-")
+	auditType := strings.TrimSuffix(file.Name, ".csv")
+	auditExists := false
+	for k, _ := range audit2index {
+		if strings.HasSuffix(auditType, k) {
+			auditExists = true
+			auditType = k
+			break
+		}
 	}
+	if !auditExists {
+		c <- ThreadReturn_Timeline{threadNum, []string{options.Warnbox + "WARNING - No configuration matching the suffix of file '" + file.Name + "'."}}
+		return
+	}
+	auditConfigIndex, _ := audit2index[auditType]
+	messages, ok := timelineReadCSV(options, config, auditConfigIndex, auditType, file.Case.Name, filepath.Join(file.Case.Path, file.Name), add)
+	if ok {
+		messages = append(messages, options.Box+"NOTICE - Successfully timelined file '"+filepath.Join(file.Case.Path, file.Name)+"'.")
+	}
+	c <- ThreadReturn_Timeline{threadNum, messages}
+}
 
+//Print the timing of a finished timeline and verify it if requested
+func timelineFinish(options Options, config Timeline_Config_JSON, start time.Time, fileCount int, timelineFiles []string) {
 	elapsed := time.Since(start)
 	time.Sleep(10 * time.Millisecond)
 
-	fmt.Printf(options.Box+"Timelined %d file(s) in %s.", len(files), elapsed.Truncate(time.Millisecond).String())
+	options.TimelineSODDiff.Report(options)
+	if options.TimelineVerify > 0 {
+		GoAuditTimelineVerify(options, config, timelineFiles)
+	}
+
+	timelineCounts := map[string]int{"timelined": fileCount, "timelines": len(timelineFiles)}
+	options.Log.Statistics(ProgressStageTimeline, timelineCounts)
+	options.Notifier.Statistics(ProgressStageTimeline, timelineCounts)
+	options.Notifier.AddOutputs(timelineFiles...)
+	fmt.Printf(options.Box+"Timelined %d file(s) in %s.", fileCount, elapsed.Truncate(time.Millisecond).String())
 	if options.Timeline || !options.MinimizedOutput {
 		fmt.Printf("\n")
 	}
+}
 
+//TimelineNoRowsWarning explains why a timeline came out empty
+func TimelineNoRowsWarning(options Options) {
+	fmt.Println(`[!] WARNING - No rows identified for the timeline. Possible reasons:
+    1. The specified audit data does not have any timestamps.
+    2. The specified output path does not contain any audit data.
+    3. The timeline configuration file "` + options.TimelineConfigFile + `" isn't set up properly.`)
+	fmt.Printf(`[!] If the issue persists, please contact the GoAuditParser developer.`)
+	if !options.MinimizedOutput {
+		fmt.Printf("\n")
+	}
+}
+
+//timelineConvertSOD renames and reorders the timeline columns to match the IIMS/SOD format
+func timelineConvertSOD(headers []string, table [][]string) ([][]string, []string) {
+	for i, _ := range headers {
+		if headers[i] == "Timestamp" {
+			headers[i] = "Timestamp (UTC)"
+		} else if headers[i] == "Summary" {
+			headers[i] = "Event Description"
+		} else if headers[i] == "User" {
+			headers[i] = "Owner / Associated User"
+		} else if headers[i] == "AgentID" {
+			headers[i] = "Agent ID"
+		} else if headers[i] == "MD5" {
+			headers[i] = "Associated MD5"
+		}
+	}
+	desiredorder := []string{"Date Added", "Timestamp (UTC)", "Timestamp Description", "Hostname", "Agent ID", "Attribution", "Event Description", "Notes", "Owner / Associated User", "Associated MD5", "Associated SHA1", "Size", "Source IP", "Source Domain", "Destination IP", "Desintation Domain", "Data Theft", "MD5 HBI"}
+	return StringTable_SetColumnOrder(headers, desiredorder, table)
+}
+
+//timelineFormatRow converts an aggregated timeline row into its CSV row(s)
+func timelineFormatRow(options Options, config Timeline_Config_JSON, audit2index map[string]int, extra2index map[string]int, row *TimelineRow) [][]string {
+	outRows := [][]string{}
+	//Source
+	source := row.Source
+	auditConfigIndex, _ := audit2index[source]
+	auditConfig := config.Audits[auditConfigIndex]
+	//Case of a composite timeline
+	caseColumn := []string{}
+	if row.Case != "" {
+		caseColumn = append(caseColumn, row.Case)
+	}
+	//Timestamp
+	timestamp := row.Timestamp
+	//Exact time and number of events merged into a bucket
+	bucketColumns := []string{}
+	if options.TimelineBucketSize > 0 {
+		bucketColumns = append(bucketColumns, TimelineExactTimestamp(row), strconv.Itoa(row.Count+1))
+	}
+	//Timestamp Description
+	descriptions := []string{}
+	for tdesc, _ := range row.TimestampDescription {
+		descriptions = append(descriptions, tdesc)
+	}
+	sort.Strings(descriptions)
+	description := strings.Join(descriptions, " && ")
+	//Summary
+	summaries := []string{}
+	for _, header := range auditConfig.SummaryFields {
+		convertedHeader := header
+		if strings.Contains(header, ">") {
+			convertedHeader = strings.Split(header, ">")[1]
+		}
+
+		valueMap, exists := row.SummaryColumns[convertedHeader]
+		if !exists {
+			continue
+		}
+		if config.IncludeSummaryHeaders {
+			for value, _ := range valueMap {
+				summaries = append(summaries, convertedHeader+": "+value)
+			}
+		} else {
+			for value, _ := range valueMap {
+				summaries = append(summaries, value)
+			}
+		}
+	}
+	summary := strings.Join(summaries, " || ")
+	if auditConfig.summaryTemplate != nil {
+		if templated := timelineExecuteSummaryTemplate(auditConfig.summaryTemplate, row); templated != "" {
+			summary = templated
+		}
+	}
+	//Extras
+	extras := make([]string, len(config.ExtraFieldsOrder))
+	for _, extraHeader := range auditConfig.ExtraFields {
+		//"Md5sum>MD5"
+		//"extraHeader>convertedHeader"
+		_, convertedHeader := timelineSplitExtraField(extraHeader)
+		valueMap, exists := row.ExtraColumns[convertedHeader]
+		if !exists {
+			continue
+		}
+		i := extra2index[convertedHeader]
+
+		//Get sorted array of extra field subheaders
+		actualHeaders := []string{}
+		for actualHeader, _ := range valueMap {
+			actualHeaders = append(actualHeaders, actualHeader)
+		}
+		sort.Strings(actualHeaders)
+
+		extraValue := ""
+		for _, actualHeader := range actualHeaders {
+			actualHeaderMap := valueMap[actualHeader]
+			for value, _ := range actualHeaderMap {
+				valueForField := value
+				//Expressions are named after their extra field, so they get no header
+				if config.IncludeSummaryHeaders && (strings.HasPrefix(convertedHeader, "Extra") || convertedHeader == "SubAuditType") && actualHeader != convertedHeader {
+					valueForField = actualHeader + ": " + value
+				}
+				extraValue = strings.Join([]string{extraValue, valueForField}, " || ")
+			}
+		}
+		extraValue = strings.TrimPrefix(extraValue, " || ")
+		extras[i] = extraValue
+	}
+	//Notes and tags are timelined for every audit, even without "Notes" or "Tag" in its Extra_Fields
+	if i, exists := extra2index["Notes"]; exists && extras[i] == "" {
+		extras[i] = timelineJoinValues(row.ExtraColumns["Notes"]["Notes"])
+	}
+	if i, exists := extra2index["Tag"]; exists && extras[i] == "" {
+		extras[i] = timelineJoinValues(row.ExtraColumns["Tag"]["Tag"])
+	}
+	if i, exists := extra2index["OriginalHostname"]; exists && extras[i] == "" {
+		extras[i] = timelineJoinValues(row.ExtraColumns["OriginalHostname"]["OriginalHostname"])
+	}
+	//If config file tells us to have a unique row per timestamp description
+	if config.UniqueRowPerTimestamp {
+		for _, tdesc := range descriptions {
+			//Write row per timestamp description
+			outRow := append(append(append([]string{timestamp, tdesc, summary, source}, caseColumn...), bucketColumns...), extras...)
+			if options.ExcelFriendly {
+				truncate32k(outRow)
+			}
+			outRows = append(outRows, outRow)
+		}
+	} else {
+		//Write row per timestamp
+		outRow := append(append(append([]string{timestamp, description, summary, source}, caseColumn...), bucketColumns...), extras...)
+		if options.ExcelFriendly {
+			truncate32k(outRow)
+		}
+		outRows = append(outRows, outRow)
+	}
+	return outRows
+}
+
+//timelineReadCSV reads the timeline rows of one parsed CSV file and hands each one to add with its sort key
+//Returns warnings for the file and false if the file could not be read at all
+func timelineReadCSV(options Options, config Timeline_Config_JSON, auditConfigIndex int, source string, caseName string, fullPath string, add func(uniqueStr string, tRow *TimelineRow)) ([]string, bool) {
+	auditConfig := config.Audits[auditConfigIndex]
+	messages := []string{}
+	//Open CSV file
+	opencsvfile, closecsvfile, err_o := openTimelineCSV(options, fullPath)
+	if err_o != nil {
+		options.Log.Println(options.Warnbox + "ERROR - Could not open file '" + fullPath + "'.")
+		log.Fatal(err_o)
+	}
+	//CSV files resaved by Excel or edited by hand may have a BOM, another encoding, or another delimiter
+	csvreader, dialect := newTimelineCSVReader(opencsvfile)
+	if !dialect.IsDefault() && options.Verbose > 0 {
+		messages = append(messages, options.Box+"Reading '"+filepath.Base(fullPath)+"' as "+dialect.String()+".")
+	}
+	headers, err_r := csvreader.Read()
+	if err_r != nil {
+		closecsvfile()
+		if err_r == io.EOF {
+			messages = append(messages, options.Warnbox+"WARNING - Could not read data as CSV for file '"+filepath.Base(fullPath)+"'.")
+		} else {
+			messages = append(messages, options.Warnbox+"WARNING - Empty CSV file: '"+filepath.Base(fullPath)+"'")
+		}
+		return messages, false
+	}
+	//The reader reuses its record for every row
+	headers = append([]string{}, headers...)
+	for i, header := range headers {
+		headers[i] = strings.TrimSpace(header)
+	}
+
+	//Event log entries are filtered by the category of their source and EID
+	eventEIDCol := -1
+	eventSourceCol := -1
+	if options.EventKnowledgeFilter != "" && auditConfig.Name == "EventLogItem" {
+		for iCol, header := range headers {
+			if header == "EID" {
+				eventEIDCol = iCol
+			} else if header == "source" {
+				eventSourceCol = iCol
+			}
+		}
+	}
+
+	//Determine available time headers
+	timeColIndexes := []int{}
+	timeColNames := []string{}
+	for _, timeHeader := range auditConfig.TimestampFields {
+		originalHeader := timeHeader
+		convertedHeader := timeHeader
+		if strings.Contains(timeHeader, ">") {
+			originalHeader = strings.Split(timeHeader, ">")[0]
+			convertedHeader = strings.Split(timeHeader, ">")[1]
+		}
+		for iCol, header := range headers {
+			if originalHeader == header {
+				timeColIndexes = append(timeColIndexes, iCol)
+				parts := strings.Split(convertedHeader, ".") //Make "FileItem.Created" just "Created"
+				lastPart := parts[len(parts)-1]
+				timeColNames = append(timeColNames, lastPart)
+			}
+		}
+	}
+	if options.Verbose > 2 {
+		options.Log.Println(options.Box + "- Identified the following Timestamp Headers: \"" + strings.Join(timeColNames, ",") + "\"")
+	}
+	//Determine available summary headers
+	summaryColIndexes := []int{}
+	summaryColNames := []string{}
+	for _, summaryHeader := range auditConfig.SummaryFields {
+		originalHeader := summaryHeader
+		convertedHeader := summaryHeader
+		if strings.Contains(summaryHeader, ">") {
+			originalHeader = strings.Split(summaryHeader, ">")[0]
+			convertedHeader = strings.Split(summaryHeader, ">")[1]
+		}
+		for iCol, header := range headers {
+			if originalHeader == header {
+				summaryColIndexes = append(summaryColIndexes, iCol)
+				summaryColNames = append(summaryColNames, convertedHeader)
+			}
+		}
+	}
+	if options.Verbose > 2 {
+		options.Log.Println(options.Box + "- Identified the following Summary Headers: \"" + strings.Join(summaryColNames, ",") + "\"")
+	}
+	//Determine available extra headers
+	extraColIndexes := [][]int{}
+	extraColAllNames := [][]string{} //Name Parts: [["Status", "crontabMinute", "crontabHour", "crontabDayOfMonth"], etc.]
+	extraColNames := []string{}      //Full Name:  ["Status||crontabMinute||crontabHour||crontabDayOfMonth", etc.]
+	for _, extraHeader := range auditConfig.ExtraFields {
+		//"Md5sum>MD5"
+		//"extraHeader>convertedHeader"
+		extraHeader, convertedHeader := timelineSplitExtraField(extraHeader)
+		if extraHeader == "" {
+			continue //Expressions are evaluated below
+		}
+		for iCol, header := range headers {
+			found := false
+			cols := []int{}
+			names := []string{}
+			for _, extraHeaderPart := range strings.Split(extraHeader, "||") {
+				if extraHeaderPart == header {
+					cols = append(cols, iCol)
+					names = append(names, extraHeaderPart)
+					found = true
+				}
+			}
+			if found {
+				extraColAllNames = append(extraColAllNames, names)
+				extraColNames = append(extraColNames, convertedHeader)
+				extraColIndexes = append(extraColIndexes, cols)
+			}
+		}
+	}
+	if options.Verbose > 2 {
+		options.Log.Println(options.Box + "- Identified the following Extra Headers: \"" + strings.Join(extraColNames, ",") + "\"")
+	}
+	//Only the columns used by the timeline config are kept from each row
+	keepCols := append(append([]int{0}, timeColIndexes...), summaryColIndexes...)
+	for _, iCols := range extraColIndexes {
+		keepCols = append(keepCols, iCols...)
+	}
+	//Columns of Extra_Fields expressions
+	expressionCols := make([][]int, len(auditConfig.extraExpressions))
+	for i, expression := range auditConfig.extraExpressions {
+		expressionCols[i] = expression.Columns(headers)
+		keepCols = append(keepCols, expressionCols[i]...)
+	}
+	if eventEIDCol != -1 {
+		keepCols = append(keepCols, eventEIDCol, eventSourceCol)
+	}
+	//Analyst notes are matched against any column of the row
+	header2index := map[string]int{}
+	for iCol, header := range headers {
+		header2index[header] = iCol
+	}
+	headerCol := func(header string) int {
+		if iCol, exists := header2index[header]; exists {
+			return iCol
+		}
+		return -1
+	}
+	notesCol := headerCol("Notes")
+	tagCol := headerCol("Tag")
+	hostnameCol := headerCol("Hostname")
+	originalHostnameCol := headerCol("OriginalHostname")
+	keepCols = append(keepCols, notesCol, tagCol, hostnameCol, originalHostnameCol)
+	for _, note := range options.AnalystNotes {
+		for _, condition := range note.Match {
+			keepCols = append(keepCols, headerCol(condition.Column))
+		}
+	}
+	csvreader.KeepColumns(keepCols)
+
+	//Iterate through the CSV rows
+	iRow := -1
+
+	for {
+		//Read row
+		iRow++
+		row, err_r := csvreader.Read()
+		if err_r != nil {
+			if err_r != io.EOF {
+				messages = append(messages, options.Warnbox+"WARNING - Could not read row index "+strconv.Itoa(iRow)+" of file '"+fullPath+"'.", err_r.Error())
+			}
+			break
+		}
+		//Skip the field descriptions row written with '-pdesc'
+		if iRow == 0 && len(row) > 0 && row[0] == FieldDescriptionsMarker {
+			continue
+		}
+		//Hand-edited rows may be missing trailing cells
+		for len(row) < len(headers) {
+			row = append(row, "")
+		}
+		if eventEIDCol != -1 {
+			source := ""
+			if eventSourceCol != -1 {
+				source = row[eventSourceCol]
+			}
+			entry, _ := LookupEventKnowledge(options.EventKnowledgePack, source, row[eventEIDCol])
+			if !EventKnowledgeMatches(options.EventKnowledgeFilter, entry.Category) {
+				continue
+			}
+		}
+
+		//Identify all timestamps
+		//map[Time]map[Description]true
+		times := map[string]map[string]bool{}
+		//Get Timestamps and Descriptions
+		for i, iCol := range timeColIndexes {
+			timestamp := row[iCol]
+			description := timeColNames[i]
+			//Add event if no time filter
+			if options.TimelineFilterEmpty {
+				if _, exists := times[timestamp]; !exists {
+					times[timestamp] = map[string]bool{}
+				}
+				times[timestamp][description] = true
+				//Check if timestamp is in the provided time filters
+			} else {
+				t, err_t := ParseTime(timestamp)
+				if err_t != nil && options.Verbose > 0 {
+					fmt.Println(options.Warnbox+"WARNING -", err_t)
+				}
+				for _, f := range options.TimelineFilters {
+					if err_t == nil && f[0].Before(t) && f[1].After(t) {
+						if _, exists := times[timestamp]; !exists {
+							times[timestamp] = map[string]bool{}
+						}
+						times[timestamp][description] = true
+						break
+					}
+				}
+			}
+		}
+		if len(times) == 0 {
+			if config.IncludeTimestamplessAudits && options.TimelineFilterEmpty {
+				times["N/A"] = map[string]bool{}
+				times["N/A"]["N/A"] = true
+			} else {
+				continue
+			}
+		}
+
+		//Identify all summary values
+		//map[Header]map[Value]true
+		summaries := map[string]map[string]bool{}
+		//Get Summary Values
+		for i, iCol := range summaryColIndexes {
+			value := row[iCol]
+			if len(value) == 0 {
+				continue
+			}
+			header := summaryColNames[i]
+			if _, exists := summaries[header]; !exists {
+				summaries[header] = map[string]bool{}
+			}
+			summaries[header][value] = true
+		}
+
+		//Identify all extra values
+		//map[Header]map[ActualHeader]map[Value]true
+		//map["Status||crontabMinute||crontabHour"]map["crontabMinute"]map["01"] = true
+		extras := map[string]map[string]map[string]bool{}
+		//Hostname before '-hs'/'-hl', from the parsed file or from normalizing its "Hostname" below
+		originalHostname := ""
+		if originalHostnameCol != -1 {
+			originalHostname = row[originalHostnameCol]
+		}
+		//Get Extra Values
+		for i, iCols := range extraColIndexes {
+			for _, iCol := range iCols {
+				value := row[iCol]
+				if len(value) == 0 {
+					continue
+				}
+				//Normalize hostnames from CSV files parsed without the hostname flags
+				if headers[iCol] == "Hostname" {
+					if normalized := NormalizeHostname(value, options); normalized != value {
+						originalHostname, value = value, normalized
+					}
+				}
+				header := extraColNames[i]
+				for _, actualHeader := range extraColAllNames[i] {
+					if _, exists := extras[header]; !exists {
+						extras[header] = map[string]map[string]bool{}
+					}
+					if _, exists := extras[header][actualHeader]; !exists {
+						extras[header][actualHeader] = map[string]bool{}
+					}
+					extras[header][actualHeader][value] = true
+				}
+			}
+		}
+		for i, expression := range auditConfig.extraExpressions {
+			values := map[string]string{}
+			for _, iCol := range expressionCols[i] {
+				values[headers[iCol]] = row[iCol]
+				if headers[iCol] == "Hostname" {
+					if normalized := NormalizeHostname(row[iCol], options); normalized != row[iCol] {
+						originalHostname, values[headers[iCol]] = row[iCol], normalized
+					}
+				}
+			}
+			value := expression.Evaluate(values)
+			if value == "" {
+				continue
+			}
+			if _, exists := extras[expression.Field]; !exists {
+				extras[expression.Field] = map[string]map[string]bool{}
+			}
+			if _, exists := extras[expression.Field][expression.Field]; !exists {
+				extras[expression.Field][expression.Field] = map[string]bool{}
+			}
+			extras[expression.Field][expression.Field][value] = true
+		}
+		if originalHostname != "" && HostnameNormalizationEnabled(options) {
+			extras["OriginalHostname"] = map[string]map[string]bool{"OriginalHostname": {originalHostname: true}}
+		}
+		//Notes written by hand or with '-notes' when parsing, and the notes of matching '-notes' rules
+		notes := []string{}
+		if notesCol != -1 && row[notesCol] != "" {
+			notes = strings.Split(row[notesCol], " || ")
+		}
+		if len(options.AnalystNotes) > 0 {
+			hostname := ""
+			if hostnameCol != -1 {
+				hostname = row[hostnameCol]
+			}
+			notes = append(notes, AnalystNotesFor(options, source, hostname, row, headerCol)...)
+		}
+		for _, note := range notes {
+			if _, exists := extras["Notes"]; !exists {
+				extras["Notes"] = map[string]map[string]bool{}
+			}
+			if _, exists := extras["Notes"]["Notes"]; !exists {
+				extras["Notes"]["Notes"] = map[string]bool{}
+			}
+			extras["Notes"]["Notes"][note] = true
+		}
+		//Tags written by hand or with '-tag' when parsing
+		if tagCol != -1 && row[tagCol] != "" {
+			tags, ruleIDs := SplitTagValue(row[tagCol])
+			for _, tag := range tags {
+				tag = FormatTagValue([]string{tag}, ruleIDs)
+				if _, exists := extras["Tag"]; !exists {
+					extras["Tag"] = map[string]map[string]bool{}
+				}
+				if _, exists := extras["Tag"]["Tag"]; !exists {
+					extras["Tag"]["Tag"] = map[string]bool{}
+				}
+				extras["Tag"]["Tag"][tag] = true
+			}
+		}
+
+		//Truncate timestamps to '-tlbucket' so the events of a bucket are merged, keeping their exact times
+		exactTimes := map[string][2]string{}
+		if options.TimelineBucketSize > 0 {
+			buckets := map[string]map[string]bool{}
+			for timeValue, descriptions := range times {
+				bucket := TimelineBucketTimestamp(timeValue, options.TimelineBucketSize)
+				if _, exists := buckets[bucket]; !exists {
+					buckets[bucket] = map[string]bool{}
+					exactTimes[bucket] = [2]string{timeValue, timeValue}
+				}
+				for description, _ := range descriptions {
+					buckets[bucket][description] = true
+				}
+				exact := exactTimes[bucket]
+				if timeValue < exact[0] {
+					exact[0] = timeValue
+				}
+				if timeValue > exact[1] {
+					exact[1] = timeValue
+				}
+				exactTimes[bucket] = exact
+			}
+			times = buckets
+		}
+
+		//Create a row for each unique timestamp
+		for timeValue, descriptions := range times {
+			//Create a unique string for hashmap
+			//Values are sorted so rows with the same values always get the same key
+			summaryValues := []string{}
+			for _, valueMap := range summaries {
+				for value, _ := range valueMap {
+					summaryValues = append(summaryValues, value)
+				}
+			}
+			sort.Strings(summaryValues)
+			mergedSummary := strings.Join(summaryValues, "")
+			extraValues := []string{}
+			for _, valueMap := range extras {
+				for _, valueMap2 := range valueMap {
+					for value, _ := range valueMap2 {
+						extraValues = append(extraValues, value)
+					}
+				}
+			}
+			sort.Strings(extraValues)
+			mergedExtras := strings.Join(extraValues, "")
+			hostnameValues := []string{} //Should only ever be one hostname!
+			valueHostname, exists := extras["Hostname"]
+			if exists {
+				for value, _ := range valueHostname {
+					hostnameValues = append(hostnameValues, value)
+				}
+			}
+			sort.Strings(hostnameValues)
+			mergedHostnames := strings.Join(hostnameValues, "")
+			uniqueStr := timeValue + source + caseName + mergedSummary + mergedExtras + mergedHostnames
+			exact, bucketed := exactTimes[timeValue]
+			if !bucketed {
+				exact = [2]string{timeValue, timeValue}
+			}
+			add(uniqueStr, &TimelineRow{
+				source,       //Source                  string
+				timeValue,    //Timestamp               string
+				descriptions, //TimestampDescription    map[string]bool
+				summaries,    //SummaryColumns          map[string]map[string]bool
+				extras,       //ExtraColumns            map[string]map[string]bool
+				0,            //Count                   int
+				caseName,     //Case                    string
+				exact[0],     //FirstTimestamp          string
+				exact[1],     //LastTimestamp           string
+			})
+		}
+	}
+	closecsvfile()
+	return messages, true
+}
+
+//Compile each audit's "Summary_Template" once before any rows are formatted
+func timelineCompileSummaryTemplates(options Options, config *Timeline_Config_JSON) {
+	for i, audit := range config.Audits {
+		if audit.SummaryTemplate == "" {
+			continue
+		}
+		t, err_t := template.New(audit.FilenameSuffix).Option("missingkey=zero").Parse(audit.SummaryTemplate)
+		if err_t != nil {
+			options.Log.Println(options.Warnbox + "ERROR - Could not parse the Summary_Template of '" + audit.Name + "' in '" + options.TimelineConfigFile + "'.")
+			log.Fatal(err_t)
+		}
+		config.Audits[i].summaryTemplate = t
+	}
+}
+
+//Fill a summary template with the row's Summary_Fields by their converted names and Extra_Fields by their audit header names
+//Multiple values of one field are joined with " || ", returns "" so the default summary is used if the template fails or is empty
+func timelineExecuteSummaryTemplate(t *template.Template, row *TimelineRow) string {
+	fields := map[string]string{}
+	for _, valueMap := range row.ExtraColumns {
+		for actualHeader, values := range valueMap {
+			fields[actualHeader] = timelineJoinValues(values)
+		}
+	}
+	for header, values := range row.SummaryColumns {
+		fields[header] = timelineJoinValues(values)
+	}
+	var b strings.Builder
+	if err_e := t.Execute(&b, fields); err_e != nil {
+		return ""
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func timelineJoinValues(values map[string]bool) string {
+	joined := []string{}
+	for value, _ := range values {
+		joined = append(joined, value)
+	}
+	sort.Strings(joined)
+	return strings.Join(joined, " || ")
 }
 
 func QuickSort_StringTable_ByColumn_NoHeader(table [][]string, columnIndex int) [][]string {
@@ -0,0 +1,203 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//Column '-tlsodprev <files>' adds to SOD timelines, "New", "Existing", or "Changed: <columns>"
+const SODRowStatusHeader = "Row Status"
+
+const (
+	SODRowNew      = "New"
+	SODRowExisting = "Existing"
+	SODRowChanged  = "Changed: "
+)
+
+//Columns which identify the same event in SOD exports
+var sodKeyHeaders = []string{"Timestamp (UTC)", "Timestamp Description", "Hostname", "Event Description"}
+
+//SOD columns which are not compared, "Date Added" is the day the row was exported and is kept from the prior export
+var sodIgnoredHeaders = map[string]bool{"Date Added": true, SODRowStatusHeader: true}
+
+//SODDiff is a prior SOD export which new SOD timelines are compared to with '-tlsodprev <files>', so rows which
+//are already in a living SOD document don't have to be found by hand
+type SODDiff struct {
+	rows     map[string][]map[string]string //Key of the row -> Rows with the key -> Column -> Value
+	Files    []string
+	New      int
+	Existing int
+	Changed  int
+}
+
+//sodKey returns the key of a row from the values of the key columns, with the timestamp normalized like parsed values
+func sodKey(values []string) string {
+	values = append([]string{}, values...)
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	values[0] = NormalizeTime(values[0])
+	return strings.Join(values, "\x00")
+}
+
+//ReadSODExport reads prior SOD exports, such as a timeline written with '-tlsod' and the files it was split into
+//Excel-saved CSV files are read with the delimiter and encoding Excel used
+func ReadSODExport(paths []string) (*SODDiff, error) {
+	diff := &SODDiff{rows: map[string][]map[string]string{}, Files: paths}
+	for _, path := range paths {
+		if err_r := diff.read(path); err_r != nil {
+			return nil, errors.New("'" + path + "', " + err_r.Error())
+		}
+	}
+	return diff, nil
+}
+
+func (diff *SODDiff) read(path string) error {
+	file, err_o := os.Open(path)
+	if err_o != nil {
+		return err_o
+	}
+	defer file.Close()
+	reader, _ := NewDialectCSVReader(file)
+	reader.FieldsPerRecord = -1
+	headers, err_h := reader.Read()
+	if err_h != nil {
+		return errors.New("could not read its headers. " + err_h.Error())
+	}
+	columns := map[string]int{}
+	for i, header := range headers {
+		columns[strings.TrimSpace(strings.TrimPrefix(header, "\ufeff"))] = i
+	}
+	keyColumns := []int{}
+	for _, header := range sodKeyHeaders {
+		i, exists := columns[header]
+		if !exists {
+			return errors.New("it has no '" + header + "' column. Provide a timeline written with '-tlsod'")
+		}
+		keyColumns = append(keyColumns, i)
+	}
+	for line := 2; ; line++ {
+		record, err_r := reader.Read()
+		if err_r == io.EOF {
+			return nil
+		} else if err_r != nil {
+			return errors.New("could not read line " + strconv.Itoa(line) + ". " + err_r.Error())
+		}
+		keyValues := []string{}
+		for _, i := range keyColumns {
+			value := ""
+			if i < len(record) {
+				value = record[i]
+			}
+			keyValues = append(keyValues, value)
+		}
+		row := map[string]string{}
+		for header, i := range columns {
+			if i < len(record) {
+				row[header] = strings.TrimSpace(record[i])
+			}
+		}
+		key := sodKey(keyValues)
+		diff.rows[key] = append(diff.rows[key], row)
+	}
+}
+
+//Headers returns the headers of an SOD timeline with the "Row Status" column
+func (diff *SODDiff) Headers(headers []string) []string {
+	if diff == nil {
+		return headers
+	}
+	return append(append([]string{}, headers...), SODRowStatusHeader)
+}
+
+//Annotate adds the "Row Status" of each row of an SOD timeline, compared to the prior export
+//Rows of the prior export keep its "Date Added", and are "Changed" if a column this timeline fills has another value
+func (diff *SODDiff) Annotate(headers []string, table [][]string) [][]string {
+	if diff == nil {
+		return table
+	}
+	keyColumns := []int{}
+	for _, header := range sodKeyHeaders {
+		for i, h := range headers {
+			if h == header {
+				keyColumns = append(keyColumns, i)
+				break
+			}
+		}
+	}
+	for r, row := range table {
+		keyValues := []string{}
+		for _, i := range keyColumns {
+			keyValues = append(keyValues, row[i])
+		}
+		priors, exists := diff.rows[sodKey(keyValues)]
+		if !exists {
+			diff.New++
+			table[r] = append(row[:len(row):len(row)], SODRowNew)
+			continue
+		}
+		//Events of the same time and description, such as of several processes, are compared to the closest prior row
+		var prior map[string]string
+		var changed []string
+		for _, candidate := range priors {
+			candidateChanged := sodChangedColumns(headers, row, candidate)
+			if prior == nil || len(candidateChanged) < len(changed) {
+				prior = candidate
+				changed = candidateChanged
+			}
+			if len(changed) == 0 {
+				break
+			}
+		}
+		for i, header := range headers {
+			if header == "Date Added" && prior[header] != "" {
+				row[i] = prior[header]
+			}
+		}
+		if len(changed) > 0 {
+			diff.Changed++
+			table[r] = append(row[:len(row):len(row)], SODRowChanged+strings.Join(changed, ", "))
+		} else {
+			diff.Existing++
+			table[r] = append(row[:len(row):len(row)], SODRowExisting)
+		}
+	}
+	return table
+}
+
+//sodChangedColumns returns the columns this timeline fills which have another value in the prior row
+func sodChangedColumns(headers []string, row []string, prior map[string]string) []string {
+	changed := []string{}
+	for i, header := range headers {
+		value := strings.TrimSpace(row[i])
+		if sodIgnoredHeaders[header] || value == "" {
+			continue
+		}
+		if priorValue, found := prior[header]; found && priorValue != value && NormalizeTime(priorValue) != value {
+			changed = append(changed, header)
+		}
+	}
+	return changed
+}
+
+//Report logs how many rows of the timeline are new, existing, or changed since the prior export, and resets the counts for the next timeline
+func (diff *SODDiff) Report(options Options) {
+	if diff == nil {
+		return
+	}
+	options.Log.Println(options.Box + "Compared to the prior SOD export '" + strings.Join(diff.Files, ",") + "': " + strconv.Itoa(diff.New) + " new, " + strconv.Itoa(diff.Changed) + " changed, and " + strconv.Itoa(diff.Existing) + " existing row(s). Filter the \"" + SODRowStatusHeader + "\" column to paste only the new rows.")
+	diff.New, diff.Existing, diff.Changed = 0, 0, 0
+}
@@ -0,0 +1,77 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+//TimelineSourceFilter selects the parsed files a timeline reads with '-tlhost', '-tlagent', and '-tlaudit'
+//Patterns may use "*" and "?" wildcards, such as "EventItem_*", and are matched ignoring case.
+//A file has to match one pattern of every list which isn't empty
+type TimelineSourceFilter struct {
+	Hosts  []string
+	Agents []string
+	Audits []string
+}
+
+//ParseTimelineSourcePatterns splits a comma delimited list of patterns, returns an error for a pattern which could not be used
+func ParseTimelineSourcePatterns(value string) ([]string, error) {
+	patterns := []string{}
+	for _, pattern := range strings.Split(value, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if _, err_m := path.Match(pattern, ""); err_m != nil {
+			return nil, errors.New("'" + pattern + "' is not a valid pattern")
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+//Empty reports whether the filter selects every file
+func (filter TimelineSourceFilter) Empty() bool {
+	return len(filter.Hosts) == 0 && len(filter.Agents) == 0 && len(filter.Audits) == 0
+}
+
+func timelineSourceMatches(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	value = strings.ToLower(value)
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
+
+//Matches reports whether a parsed file "<hostname>-<agentid>-<payload>-<AuditType>.csv" is selected by the filter
+//Names may include the "Output_Routes" subdirectory of the file. Files not named like this are only kept by an empty filter
+func (filter TimelineSourceFilter) Matches(name string) bool {
+	if filter.Empty() {
+		return true
+	}
+	parts := strings.Split(strings.TrimSuffix(filepath.Base(name), filepath.Ext(name)), "-")
+	if len(parts) < 4 {
+		return false
+	}
+	hostname := strings.Join(parts[0:len(parts)-3], "-")
+	agentid := parts[len(parts)-3]
+	auditType := parts[len(parts)-1]
+	return timelineSourceMatches(filter.Hosts, hostname) && timelineSourceMatches(filter.Agents, agentid) && timelineSourceMatches(filter.Audits, auditType)
+}
@@ -0,0 +1,401 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"bufio"
+	"container/heap"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Rows held in memory before they are sorted and spilled to a shard
+const timelineStreamShardRows = 100000
+
+//Shards merged at once, more shards are first merged into intermediate shards so only this many files are open
+const timelineStreamMergeFanIn = 64
+
+//Estimated bytes of a map entry and its string header, on top of the bytes of the string itself
+const timelineStreamEntryBytes = 48
+
+//Rows formatted before they are converted to SOD format and written
+const timelineStreamChunkRows = 10000
+
+//TimelineStream spills aggregated timeline rows to sorted JSON Lines shards instead of keeping every row in memory
+//Shards are merged by sort key when writing, so the timeline comes out in the same order as the in-memory timeliner
+//With '-tlmem <int>', the buffer is spilled once its rows take up the memory budget instead of after a number of rows
+type TimelineStream struct {
+	options  Options
+	dir      string
+	buffer   map[string]*TimelineRow
+	bytes    int64 //Estimated size of the buffered rows
+	maxBytes int64 //Memory budget of '-tlmem <int>', 0 to spill by rows
+	shards   []string
+	spills   int //Shards spilled from the buffer
+	merges   int //Intermediate shards merged from other shards
+}
+
+//One line of a shard file
+type timelineStreamRecord struct {
+	Key string       `json:"k"`
+	Row *TimelineRow `json:"r"`
+}
+
+//NewTimelineStream creates the shard directory inside the output directory
+func NewTimelineStream(options Options) *TimelineStream {
+	//Composite timelines keep their shards in the first case
+	shardParent := TimelineCases(options.OutputPath)[0].Path
+	dir, err_t := ioutil.TempDir(shardParent, "_GAPTimelineShards_")
+	if err_t != nil {
+		options.Log.Println(options.Warnbox + "ERROR - Could not create timeline shard directory in '" + shardParent + "'.")
+		log.Fatal(err_t)
+	}
+	return &TimelineStream{options: options, dir: dir, buffer: map[string]*TimelineRow{}, maxBytes: int64(options.TimelineMemoryMB) * 1024 * 1024}
+}
+
+//timelineRowBytes estimates the memory a buffered row and its key take up
+func timelineRowBytes(uniqueStr string, tRow *TimelineRow) int64 {
+	size := len(uniqueStr) + len(tRow.Source) + len(tRow.Timestamp) + len(tRow.Case) + len(tRow.FirstTimestamp) + len(tRow.LastTimestamp) + 4*timelineStreamEntryBytes
+	for description, _ := range tRow.TimestampDescription {
+		size += len(description) + timelineStreamEntryBytes
+	}
+	for column, values := range tRow.SummaryColumns {
+		size += len(column) + 2*timelineStreamEntryBytes
+		for value, _ := range values {
+			size += len(value) + timelineStreamEntryBytes
+		}
+	}
+	for column, fields := range tRow.ExtraColumns {
+		size += len(column) + 2*timelineStreamEntryBytes
+		for field, values := range fields {
+			size += len(field) + 2*timelineStreamEntryBytes
+			for value, _ := range values {
+				size += len(value) + timelineStreamEntryBytes
+			}
+		}
+	}
+	return int64(size)
+}
+
+//Add aggregates a timeline row, spilling the buffer to a new shard once it is full
+func (stream *TimelineStream) Add(uniqueStr string, tRow *TimelineRow) {
+	if existing, rowExists := stream.buffer[uniqueStr]; rowExists {
+		existing.Merge(tRow)
+		return
+	}
+	stream.buffer[uniqueStr] = tRow
+	full := len(stream.buffer) >= timelineStreamShardRows
+	if stream.maxBytes > 0 {
+		//Merged rows only add timestamp descriptions, so rows are sized once when they are buffered
+		stream.bytes += timelineRowBytes(uniqueStr, tRow)
+		full = stream.bytes >= stream.maxBytes
+	}
+	if full {
+		err_f := stream.flush()
+		if err_f != nil {
+			fmt.Println(stream.options.Warnbox + "ERROR - Could not write timeline shard to '" + stream.dir + "'.")
+			log.Fatal(err_f)
+		}
+	}
+}
+
+//Write the buffer sorted by key to a new shard
+func (stream *TimelineStream) flush() error {
+	if len(stream.buffer) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(stream.buffer))
+	for key, _ := range stream.buffer {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	shardPath := filepath.Join(stream.dir, "shard_"+strconv.Itoa(stream.spills)+".jsonl")
+	err_w := stream.writeShard(shardPath, func(encoder *json.Encoder) error {
+		for _, key := range keys {
+			err_e := encoder.Encode(timelineStreamRecord{key, stream.buffer[key]})
+			if err_e != nil {
+				return err_e
+			}
+		}
+		return nil
+	})
+	if err_w != nil {
+		return err_w
+	}
+	stream.spills++
+	stream.shards = append(stream.shards, shardPath)
+	stream.buffer = map[string]*TimelineRow{}
+	stream.bytes = 0
+	return nil
+}
+
+//Write a shard through an encoder of its lines
+func (stream *TimelineStream) writeShard(shardPath string, write func(encoder *json.Encoder) error) error {
+	shardFile, err_c := CreateOutputFile(stream.options, shardPath)
+	if err_c != nil {
+		return err_c
+	}
+	writer := bufio.NewWriter(shardFile)
+	err_e := write(json.NewEncoder(writer))
+	if err_e != nil {
+		shardFile.Close()
+		return err_e
+	}
+	err_w := writer.Flush()
+	shardFile.Close()
+	return err_w
+}
+
+//Close removes the shard directory
+func (stream *TimelineStream) Close() {
+	os.RemoveAll(stream.dir)
+}
+
+//Merge reads every shard in key order and calls emit once per key, combining rows with the same key
+//Past timelineStreamMergeFanIn shards, the oldest shards are merged into intermediate shards first, one pass at a time
+func (stream *TimelineStream) Merge(emit func(uniqueStr string, tRow *TimelineRow)) error {
+	err_f := stream.flush()
+	if err_f != nil {
+		return err_f
+	}
+
+	for len(stream.shards) > timelineStreamMergeFanIn {
+		inputs := stream.shards[:timelineStreamMergeFanIn]
+		mergedPath := filepath.Join(stream.dir, "merge_"+strconv.Itoa(stream.merges)+".jsonl")
+		err_w := stream.writeShard(mergedPath, func(encoder *json.Encoder) error {
+			var err_e error
+			err_m := mergeTimelineShards(inputs, func(uniqueStr string, tRow *TimelineRow) {
+				if err_e == nil {
+					err_e = encoder.Encode(timelineStreamRecord{uniqueStr, tRow})
+				}
+			})
+			if err_m != nil {
+				return err_m
+			}
+			return err_e
+		})
+		if err_w != nil {
+			return err_w
+		}
+		for _, shardPath := range inputs {
+			os.Remove(shardPath)
+		}
+		stream.merges++
+		stream.shards = append(stream.shards[timelineStreamMergeFanIn:], mergedPath)
+	}
+	return mergeTimelineShards(stream.shards, emit)
+}
+
+//mergeTimelineShards reads shards in key order and calls emit once per key, combining rows with the same key
+func mergeTimelineShards(shards []string, emit func(uniqueStr string, tRow *TimelineRow)) error {
+	readers := &timelineShardHeap{}
+	for _, shardPath := range shards {
+		shardFile, err_o := os.Open(shardPath)
+		if err_o != nil {
+			return err_o
+		}
+		defer shardFile.Close()
+		reader := &timelineShardReader{decoder: json.NewDecoder(bufio.NewReader(shardFile))}
+		ok, err_r := reader.next()
+		if err_r != nil {
+			return err_r
+		}
+		if ok {
+			heap.Push(readers, reader)
+		}
+	}
+
+	var pending *timelineStreamRecord
+	for readers.Len() > 0 {
+		reader := (*readers)[0]
+		record := reader.record
+		if pending != nil && pending.Key == record.Key {
+			pending.Row.Merge(record.Row)
+		} else {
+			if pending != nil {
+				emit(pending.Key, pending.Row)
+			}
+			pending = &record
+		}
+		ok, err_r := reader.next()
+		if err_r != nil {
+			return err_r
+		}
+		if ok {
+			heap.Fix(readers, 0)
+		} else {
+			heap.Pop(readers)
+		}
+	}
+	if pending != nil {
+		emit(pending.Key, pending.Row)
+	}
+	return nil
+}
+
+type timelineShardReader struct {
+	decoder *json.Decoder
+	record  timelineStreamRecord
+}
+
+func (reader *timelineShardReader) next() (bool, error) {
+	reader.record = timelineStreamRecord{}
+	err_d := reader.decoder.Decode(&reader.record)
+	if err_d == io.EOF {
+		return false, nil
+	}
+	return err_d == nil, err_d
+}
+
+//Min-heap of shard readers by their current key
+type timelineShardHeap []*timelineShardReader
+
+func (h timelineShardHeap) Len() int            { return len(h) }
+func (h timelineShardHeap) Less(i, j int) bool  { return h[i].record.Key < h[j].record.Key }
+func (h timelineShardHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *timelineShardHeap) Push(x interface{}) { *h = append(*h, x.(*timelineShardReader)) }
+func (h *timelineShardHeap) Pop() interface{} {
+	old := *h
+	reader := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return reader
+}
+
+//GoAuditTimeliner_WriteStream merges the shards of a streamed timeline and writes it in the '-tlfmt <str>' format, returning the timeline files written
+//Deduplication ('-tld') keeps the first of each identical row without re-sorting, since sorting would need every row in memory
+//Every merged row is also counted by density for '-tlanom' if it is not nil
+func GoAuditTimeliner_WriteStream(options Options, config Timeline_Config_JSON, stream *TimelineStream, headers []string, audit2index map[string]int, extra2index map[string]int, outputFile *os.File, outputFilePath string, density *TimelineDensity) []string {
+	//SOD conversion reorders the columns of each chunk, starting from the default headers every time
+	defaultHeaders := headers
+	sodHeaders := headers
+	if options.TimelineSOD {
+		options.Log.Println(options.Box + "Converting timeline to SOD format...")
+		_, sodHeaders = timelineConvertSOD(append([]string{}, defaultHeaders...), [][]string{})
+		headers = options.TimelineSODDiff.Headers(sodHeaders)
+	}
+
+	options.Log.Println(options.Box + "Writing timeline...")
+	writer, err_n := NewTimelineWriter(options, outputFile, outputFilePath, headers)
+	if err_n != nil {
+		options.Log.Println(options.Warnbox + "ERROR - Could not create timeline file '" + outputFilePath + "'.")
+		log.Fatal(err_n)
+	}
+	timelineFiles := []string{outputFilePath}
+	lasttimelinefilename := outputFilePath
+	rowsInFile := 0
+	rowsTotal := 0
+	records := 0
+
+	//Identical rows have the same timestamp, and keys start with it, so they are merged one after another. Only rows
+	//of the current second are remembered, since keys of one second stay together even with fractional seconds.
+	//Rows without a full timestamp are not grouped by their keys, so they are remembered throughout
+	seen := map[[sha1.Size]byte]bool{}
+	seenSecond := ""
+	seenUngrouped := map[[sha1.Size]byte]bool{}
+	chunk := [][]string{}
+	writeChunk := func() {
+		if options.TimelineSOD {
+			chunk, _ = timelineConvertSOD(append([]string{}, defaultHeaders...), chunk)
+			chunk = options.TimelineSODDiff.Annotate(sodHeaders, chunk)
+		}
+		for _, row := range chunk {
+			//Split file if we are at 1mil rows for excel friendly mode
+			if options.ExcelFriendly && rowsInFile == 999999 {
+				writer.Close()
+				ap, _ := filepath.Abs(lasttimelinefilename)
+				if options.Verbose > 0 || options.MinimizedOutput {
+					options.Log.Println(options.Box + "Timeline file: " + ap)
+				}
+				outputFilePathNew := strings.TrimSuffix(outputFilePath, ".csv") + "_" + strconv.Itoa(len(timelineFiles)) + ".csv"
+				lasttimelinefilename = outputFilePathNew
+				timelineFiles = append(timelineFiles, outputFilePathNew)
+				if options.Verbose > 0 {
+					options.Log.Println(options.Box + "Splitting output at " + strconv.Itoa(len(timelineFiles)-1) + "mil rows to timeline file '" + outputFilePathNew + "'...")
+				}
+				outputFile, err_c := CreateOutputFile(options, outputFilePathNew)
+				if err_c != nil {
+					options.Log.Println(options.Warnbox + "ERROR - Could not create timeline split file '" + outputFilePathNew + "'.")
+					log.Fatal(err_c)
+				}
+				writer, _ = NewTimelineWriter(options, outputFile, outputFilePathNew, headers)
+				rowsInFile = 0
+			}
+			if err_w := writer.Write(row); err_w != nil {
+				options.Log.Println(options.Warnbox + "ERROR - Could not write timeline file '" + lasttimelinefilename + "'.")
+				log.Fatal(err_w)
+			}
+			rowsInFile++
+			rowsTotal++
+		}
+		chunk = [][]string{}
+	}
+
+	err_m := stream.Merge(func(uniqueStr string, tRow *TimelineRow) {
+		records++
+		if density != nil {
+			density.Add(tRow)
+		}
+		rowsSeen := seenUngrouped
+		if len(tRow.Timestamp) >= 19 {
+			if tRow.Timestamp[0:19] != seenSecond {
+				seenSecond = tRow.Timestamp[0:19]
+				seen = map[[sha1.Size]byte]bool{}
+			}
+			rowsSeen = seen
+		}
+		for _, row := range timelineFormatRow(options, config, audit2index, extra2index, tRow) {
+			if options.TimelineDeduplicate {
+				hash := sha1.Sum([]byte(strings.Join(row, "")))
+				if rowsSeen[hash] {
+					continue
+				}
+				rowsSeen[hash] = true
+			}
+			chunk = append(chunk, row)
+			if len(chunk) >= timelineStreamChunkRows {
+				writeChunk()
+			}
+		}
+	})
+	if err_m != nil {
+		options.Log.Println(options.Warnbox + "ERROR - Could not merge timeline shards in '" + stream.dir + "'.")
+		log.Fatal(err_m)
+	}
+	writeChunk()
+	if err_c := writer.Close(); err_c != nil {
+		options.Log.Println(options.Warnbox + "ERROR - Could not write timeline file '" + lasttimelinefilename + "'.")
+		log.Fatal(err_c)
+	}
+
+	if options.Verbose > 0 {
+		fmt.Println(options.Box+"- Determined", records, "timeline rows from", stream.spills, "shard(s) and", stream.merges, "intermediate shard(s).")
+	}
+	if rowsTotal == 0 {
+		TimelineNoRowsWarning(options)
+		return nil
+	}
+
+	ap, _ := filepath.Abs(lasttimelinefilename)
+	if options.Verbose > 0 || options.MinimizedOutput {
+		options.Log.Println(options.Box + "Timeline file: " + ap)
+	}
+	return timelineFiles
+}
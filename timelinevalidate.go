@@ -0,0 +1,292 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//timelineParsedHeaders are the headers of the parsed CSV files of one audit type in the '-o <dir>' directories
+type timelineParsedHeaders struct {
+	files   int
+	headers map[string]bool
+}
+
+//readTimelineParsedHeaders reads the headers of every parsed CSV file in the output directories, by the audit type
+//at the end of the file name, as the timeline would read them
+func readTimelineParsedHeaders(options Options) (map[string]*timelineParsedHeaders, []string) {
+	parsed := map[string]*timelineParsedHeaders{}
+	problems := []string{}
+	for _, c := range TimelineCases(options.OutputPath) {
+		names, err_r := ReadOutputDir(options, c.Path)
+		if err_r != nil {
+			problems = append(problems, "Could not read output directory '"+c.Path+"'. "+err_r.Error())
+			continue
+		}
+		for _, name := range names {
+			base := filepath.Base(name)
+			if strings.HasPrefix(base, "_") || !strings.HasSuffix(base, ".csv") {
+				continue
+			}
+			parts := strings.Split(strings.TrimSuffix(base, ".csv"), "-")
+			auditType := parts[len(parts)-1]
+			file, err_o := os.Open(filepath.Join(c.Path, name))
+			if err_o != nil {
+				problems = append(problems, "Could not open parsed file '"+filepath.Join(c.Path, name)+"'. "+err_o.Error())
+				continue
+			}
+			reader, _ := newTimelineCSVReader(file)
+			headers, err_h := reader.Read()
+			file.Close()
+			if err_h != nil {
+				continue //Empty files have no headers to check
+			}
+			if _, exists := parsed[auditType]; !exists {
+				parsed[auditType] = &timelineParsedHeaders{headers: map[string]bool{}}
+			}
+			parsed[auditType].files++
+			for _, header := range headers {
+				parsed[auditType].headers[strings.TrimSpace(header)] = true
+			}
+		}
+	}
+	return parsed, problems
+}
+
+//timelineFieldHeaders returns the CSV headers a Timestamp_Fields, Summary_Fields, or Extra_Fields entry reads, and the
+//field it is written as. Extra_Fields expressions return no headers, their syntax is checked separately
+func timelineFieldHeaders(field string, extra bool) ([]string, string) {
+	if extra {
+		header, converted := timelineSplitExtraField(field)
+		if header == "" {
+			return nil, converted
+		}
+		return strings.Split(header, "||"), converted
+	}
+	if strings.Contains(field, ">") {
+		return []string{strings.Split(field, ">")[0]}, strings.Split(field, ">")[1]
+	}
+	return []string{field}, field
+}
+
+//timelineBuiltInFields returns the entries of the built-in timeline config by Filename_Suffix. They list fields of every
+//version of an audit, so those missing from some parsed files are expected and only entries edited by hand are checked
+func timelineBuiltInFields() map[string]map[string]bool {
+	var builtIn Timeline_Config_JSON
+	json.Unmarshal([]byte(GetTimelineConfigTemplate()), &builtIn)
+	fields := map[string]map[string]bool{}
+	for _, audit := range builtIn.Audits {
+		if _, exists := fields[audit.FilenameSuffix]; !exists {
+			fields[audit.FilenameSuffix] = map[string]bool{}
+		}
+		for _, list := range [][]string{audit.TimestampFields, audit.SummaryFields, audit.ExtraFields} {
+			for _, field := range list {
+				fields[audit.FilenameSuffix][field] = true
+			}
+		}
+	}
+	return fields
+}
+
+//timelineSimilarHeader returns a known header which only differs from the header by case, such as "Md5Sum" for "md5sum"
+func timelineSimilarHeader(header string, known ...map[string]bool) string {
+	for _, headers := range known {
+		for h := range headers {
+			if strings.EqualFold(h, header) {
+				return h
+			}
+		}
+	}
+	return ""
+}
+
+//ValidateTimelineConfig cross-checks the timeline config against the "Audit_Header_Configs" of the main config and the
+//headers of the parsed CSV files in '-o <dir>', returning a message for every audit or field the timeline would not match
+func ValidateTimelineConfig(options Options, config Timeline_Config_JSON, parsed map[string]*timelineParsedHeaders) []string {
+	problems := []string{}
+	builtIn := timelineBuiltInFields()
+
+	headerConfigs := map[string]map[string]bool{}
+	for _, headerConfig := range options.Config.AuditHeaderConfigs {
+		headers := map[string]bool{}
+		for _, list := range [][]string{options.Config.HeadersMandatory, options.Config.HeadersOptional, headerConfig.HeaderOrder} {
+			for _, header := range list {
+				headers[header] = true
+			}
+		}
+		headerConfigs[headerConfig.Name] = headers
+	}
+	extraOrder := map[string]bool{}
+	for _, extra := range config.ExtraFieldsOrder {
+		extraOrder[extra] = true
+	}
+
+	suffixes := map[string]string{}
+	entries := map[string]string{}
+	for _, audit := range config.Audits {
+		name := "'" + audit.Name + "'"
+		suffix := audit.FilenameSuffix
+		if suffix == "" {
+			problems = append(problems, name+" has no Filename_Suffix, so it matches every parsed file.")
+			continue
+		}
+		entry, _ := json.Marshal(audit)
+		if other, exists := suffixes[suffix]; exists && entries[suffix] != string(entry) {
+			problems = append(problems, name+" has the same Filename_Suffix \""+suffix+"\" as '"+other+"', only the last one is used.")
+		}
+		suffixes[suffix] = audit.Name
+		entries[suffix] = string(entry)
+
+		files := parsed[suffix]
+		headerConfig, hasHeaderConfig := headerConfigs[suffix]
+		if files == nil && !hasHeaderConfig {
+			//Audit types GoAuditParser writes itself, such as "AuditDebug", are only known from their parsed files
+			if _, isBuiltIn := builtIn[suffix]; !isBuiltIn {
+				problems = append(problems, name+" Filename_Suffix \""+suffix+"\" matches no audit of 'Audit_Header_Configs' and no parsed CSV file in '"+options.OutputPath+"'.")
+			}
+			continue
+		}
+
+		fieldLists := []struct {
+			key    string
+			fields []string
+			extra  bool
+		}{
+			{"Timestamp_Fields", audit.TimestampFields, false},
+			{"Summary_Fields", audit.SummaryFields, false},
+			{"Extra_Fields", audit.ExtraFields, true},
+		}
+		for _, list := range fieldLists {
+			for _, field := range list.fields {
+				headers, converted := timelineFieldHeaders(field, list.extra)
+				if list.extra && converted != "" && !extraOrder[converted] {
+					problems = append(problems, name+" Extra_Fields \""+field+"\" writes \""+converted+"\", which is not in Extra_Fields_Order.")
+				}
+				if builtIn[suffix][field] {
+					continue
+				}
+				for _, header := range headers {
+					var fileHeaders map[string]bool
+					if files != nil {
+						fileHeaders = files.headers
+					}
+					problem := ""
+					switch {
+					case files != nil && !files.headers[header]:
+						problem = name + " " + list.key + " \"" + header + "\" is in none of the " + strconv.Itoa(files.files) + " parsed \"" + suffix + "\" CSV file(s) in '" + options.OutputPath + "'."
+					case files == nil && !headerConfig[header]:
+						problem = name + " " + list.key + " \"" + header + "\" is not in the Header_Order of \"" + suffix + "\" in 'Audit_Header_Configs', and there are no parsed \"" + suffix + "\" CSV files to check."
+					case hasHeaderConfig && !headerConfig[header] && options.Config.OmitUnlisted:
+						problem = name + " " + list.key + " \"" + header + "\" is not in the Header_Order of \"" + suffix + "\" in 'Audit_Header_Configs', so 'Omit_Nonordered_Headers' leaves it out of files parsed from now on."
+					}
+					if problem == "" {
+						continue
+					}
+					if similar := timelineSimilarHeader(header, fileHeaders, headerConfig); similar != "" {
+						problem += " Did you mean \"" + similar + "\"?"
+					}
+					problems = append(problems, problem)
+				}
+			}
+		}
+	}
+
+	//The timeline matches a file to any config whose suffix ends its name, so one suffix ending another is ambiguous
+	names := []string{}
+	for suffix := range suffixes {
+		names = append(names, suffix)
+	}
+	sort.Strings(names)
+	for _, suffix := range names {
+		overlaps := []string{}
+		for _, other := range names {
+			if other != suffix && strings.HasSuffix(other, suffix) {
+				overlaps = append(overlaps, other)
+			}
+		}
+		if len(overlaps) > 0 {
+			problems = append(problems, "'"+suffixes[suffix]+"' Filename_Suffix \""+suffix+"\" also ends \""+strings.Join(overlaps, "\", \"")+"\", so their files may be timelined with either config.")
+		}
+	}
+
+	//Parsed audit types which are not timelined at all
+	auditTypes := []string{}
+	for auditType := range parsed {
+		matched := false
+		for suffix := range suffixes {
+			matched = matched || strings.HasSuffix(auditType, suffix)
+		}
+		if !matched {
+			auditTypes = append(auditTypes, auditType)
+		}
+	}
+	sort.Strings(auditTypes)
+	for _, auditType := range auditTypes {
+		problems = append(problems, "Parsed \""+auditType+"\" CSV file(s) in '"+options.OutputPath+"' match no Filename_Suffix, so they are not timelined.")
+	}
+	return problems
+}
+
+//GoAuditValidate_Start checks the timeline config with '-validate' without changing it, and returns the exit code,
+//1 if the timeline config has problems
+func GoAuditValidate_Start(options Options) int {
+	configFile := options.TimelineConfigFile
+	b, err_r := ioutil.ReadFile(configFile)
+	if os.IsNotExist(err_r) {
+		options.Log.Println(options.Box + "NOTICE - Timeline config file '" + configFile + "' does not exist, the first timeline creates it. Validating the built-in timeline config.")
+		b = []byte(GetTimelineConfigTemplate())
+	} else if err_r != nil {
+		options.Log.Println(options.Warnbox + "ERROR - Could not read timeline config file '" + configFile + "'. " + err_r.Error())
+		return 1
+	}
+	if err_v := validateTimelineConfig(b); err_v != nil {
+		options.Log.Println(options.Warnbox + "ERROR - Timeline config file '" + configFile + "' " + err_v.Error())
+		return 1
+	}
+	var config Timeline_Config_JSON
+	json.Unmarshal(b, &config)
+	if config.Version != version && !config.DontOverwrite {
+		options.Log.Println(options.Warnbox + "WARNING - Timeline config file '" + configFile + "' is v" + config.Version + ", the next timeline replaces it with the v" + version + " template. Set 'Dont_Overwrite_With_New_Update' to 'true' to keep changes made by hand.")
+	}
+
+	parsed := map[string]*timelineParsedHeaders{}
+	if _, err_s := os.Stat(options.OutputPath); err_s == nil || strings.Contains(options.OutputPath, ",") {
+		var readProblems []string
+		parsed, readProblems = readTimelineParsedHeaders(options)
+		for _, problem := range readProblems {
+			options.Log.Println(options.Warnbox + "WARNING - " + problem)
+		}
+		fileCount := 0
+		for _, files := range parsed {
+			fileCount += files.files
+		}
+		options.Log.Println(options.Box + "Checking timeline config '" + configFile + "' against 'Audit_Header_Configs' of main config '" + options.ConfigPath + "' and the headers of " + strconv.Itoa(fileCount) + " parsed CSV file(s) in '" + options.OutputPath + "'.")
+	} else {
+		options.Log.Println(options.Box + "Checking timeline config '" + configFile + "' against 'Audit_Header_Configs' of main config '" + options.ConfigPath + "'. Output directory '" + options.OutputPath + "' does not exist, so no parsed CSV headers are checked.")
+	}
+
+	problems := ValidateTimelineConfig(options, config, parsed)
+	for _, problem := range problems {
+		options.Log.Println(options.Warnbox + "  " + problem)
+	}
+	if len(problems) > 0 {
+		options.Log.Println(options.Warnbox + "Found " + strconv.Itoa(len(problems)) + " problem(s) in timeline config '" + configFile + "'.")
+		return 1
+	}
+	options.Log.Println(options.Box + "Timeline config '" + configFile + "' matches the audit header config and the parsed CSV headers.")
+	return 0
+}
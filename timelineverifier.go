@@ -0,0 +1,273 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type timelineVerifySample struct {
+	file      string
+	line      int
+	source    string
+	caseName  string
+	timestamp string
+	summary   string
+	found     bool
+}
+
+//GoAuditTimelineVerify samples rows from the written timeline file(s) and re-locates them in the source CSV files
+func GoAuditTimelineVerify(options Options, config Timeline_Config_JSON, timelineFiles []string) {
+
+	options.Log.Println(options.Box + "Verifying " + strconv.Itoa(options.TimelineVerify) + " random timeline row(s) against the source CSV files...")
+	rand.Seed(time.Now().UnixNano())
+
+	//Reservoir sample rows across all timeline files
+	samples := []*timelineVerifySample{}
+	seen := 0
+	for _, timelineFile := range timelineFiles {
+		file, err_o := os.Open(timelineFile)
+		if err_o != nil {
+			options.Log.Println(options.Warnbox + "ERROR - Could not open timeline file '" + timelineFile + "' to verify. " + err_o.Error())
+			return
+		}
+		reader := csv.NewReader(file)
+		headers, err_r := reader.Read()
+		if err_r != nil {
+			file.Close()
+			options.Log.Println(options.Warnbox + "ERROR - Could not read headers of timeline file '" + timelineFile + "'.")
+			return
+		}
+		iSource, iTimestamp, iSummary, iCase, iExact := -1, -1, -1, -1, -1
+		for i, header := range headers {
+			if header == "Source" {
+				iSource = i
+			} else if header == "Case" {
+				iCase = i
+			} else if header == "Timestamp" || header == "Timestamp (UTC)" {
+				iTimestamp = i
+			} else if header == "Summary" || header == "Event Description" {
+				iSummary = i
+			} else if header == "Exact Timestamp" {
+				iExact = i
+			}
+		}
+		if iSource == -1 || iTimestamp == -1 || iSummary == -1 {
+			file.Close()
+			options.Log.Println(options.Warnbox + "ERROR - Timeline file '" + timelineFile + "' does not have a Source, Timestamp, and Summary column to verify.")
+			return
+		}
+		line := 1
+		for {
+			row, err_r := reader.Read()
+			if err_r != nil {
+				break
+			}
+			line++
+			seen++
+			caseName := ""
+			if iCase != -1 {
+				caseName = row[iCase]
+			}
+			timestamp := row[iTimestamp]
+			//Rows of a '-tlbucket' timeline are found by the time of their first event
+			if iExact != -1 {
+				timestamp = strings.SplitN(row[iExact], " - ", 2)[0]
+			}
+			sample := &timelineVerifySample{filepath.Base(timelineFile), line, row[iSource], caseName, timestamp, row[iSummary], false}
+			if len(samples) < options.TimelineVerify {
+				samples = append(samples, sample)
+			} else if j := rand.Intn(seen); j < options.TimelineVerify {
+				samples[j] = sample
+			}
+		}
+		file.Close()
+	}
+	if len(samples) == 0 {
+		options.Log.Println(options.Warnbox + "WARNING - No timeline rows to verify.")
+		return
+	}
+
+	//Group samples by case and audit type
+	bySource := map[string][]*timelineVerifySample{}
+	for _, sample := range samples {
+		bySource[sample.caseName+"|"+sample.source] = append(bySource[sample.caseName+"|"+sample.source], sample)
+	}
+
+	for _, c := range TimelineCases(options.OutputPath) {
+		files, err_r := ReadOutputDir(options, c.Path)
+		if err_r != nil {
+			options.Log.Println(options.Warnbox + "ERROR - Could not read output directory '" + c.Path + "' to verify.")
+			return
+		}
+
+		for _, auditConfig := range config.Audits {
+			pending, exists := bySource[c.Name+"|"+auditConfig.FilenameSuffix]
+			if !exists {
+				continue
+			}
+			//Summaries built from a "Summary_Template" can't be split back into values, so only their timestamps are verified
+			if auditConfig.SummaryTemplate != "" {
+				for _, sample := range pending {
+					sample.summary = ""
+				}
+			}
+			for _, name := range files {
+				if strings.HasPrefix(filepath.Base(name), "_Timeline_") || !strings.HasSuffix(name, auditConfig.FilenameSuffix+".csv") {
+					continue
+				}
+				verifyTimelineSamplesInCSV(filepath.Join(c.Path, name), auditConfig.TimestampFields, auditConfig.SummaryFields, config.IncludeSummaryHeaders, pending)
+			}
+		}
+	}
+
+	//Report results
+	mismatches := 0
+	for _, sample := range samples {
+		if !sample.found {
+			mismatches++
+			options.Log.Println(options.Warnbox + "MISMATCH - " + sample.file + " line " + strconv.Itoa(sample.line) + ": '" + sample.timestamp + "' '" + sample.source + "' could not be located in the source CSV files. Summary: " + sample.summary)
+		}
+	}
+	options.Log.Println(options.Box + "Timeline Verification Statistics:")
+	fmt.Println(options.Box+" - Sampled:    ", len(samples))
+	fmt.Println(options.Box+" - Verified:   ", len(samples)-mismatches)
+	fmt.Println(options.Box+" - Mismatched: ", mismatches)
+}
+
+//verifyTimelineSamplesInCSV marks the samples which can be rebuilt from a row in the CSV file
+func verifyTimelineSamplesInCSV(csvPath string, timestampFields []string, summaryFields []string, includeSummaryHeaders bool, samples []*timelineVerifySample) {
+	file, err_o := os.Open(csvPath)
+	if err_o != nil {
+		return
+	}
+	defer file.Close()
+	reader, _ := NewDialectCSVReader(file)
+	headers, err_r := reader.Read()
+	if err_r != nil {
+		return
+	}
+	for i, header := range headers {
+		headers[i] = strings.TrimSpace(header)
+	}
+
+	//Map "original>converted" config headers to column indexes
+	timeCols := []int{}
+	for _, timeHeader := range timestampFields {
+		originalHeader := strings.Split(timeHeader, ">")[0]
+		for iCol, header := range headers {
+			if header == originalHeader {
+				timeCols = append(timeCols, iCol)
+			}
+		}
+	}
+	summaryCols := map[string][]int{}
+	for _, summaryHeader := range summaryFields {
+		originalHeader := summaryHeader
+		convertedHeader := summaryHeader
+		if strings.Contains(summaryHeader, ">") {
+			originalHeader = strings.Split(summaryHeader, ">")[0]
+			convertedHeader = strings.Split(summaryHeader, ">")[1]
+		}
+		for iCol, header := range headers {
+			if header == originalHeader {
+				summaryCols[convertedHeader] = append(summaryCols[convertedHeader], iCol)
+			}
+		}
+	}
+
+	for {
+		row, err_r := reader.Read()
+		if err_r == io.EOF {
+			break
+		} else if err_r != nil {
+			continue
+		}
+		for _, sample := range samples {
+			if sample.found {
+				continue
+			}
+			if !timelineVerifyTimestamp(sample.timestamp, row, timeCols) {
+				continue
+			}
+			if timelineVerifySummary(sample.summary, row, summaryCols, includeSummaryHeaders) {
+				sample.found = true
+			}
+		}
+	}
+}
+
+func timelineVerifyTimestamp(timestamp string, row []string, timeCols []int) bool {
+	if timestamp == "N/A" {
+		return true
+	}
+	for _, iCol := range timeCols {
+		if iCol < len(row) && row[iCol] == timestamp {
+			return true
+		}
+	}
+	return false
+}
+
+func timelineVerifySummary(summary string, row []string, summaryCols map[string][]int, includeSummaryHeaders bool) bool {
+	if summary == "" {
+		return true
+	}
+	for _, part := range strings.Split(summary, " || ") {
+		found := false
+		if includeSummaryHeaders {
+			for header, iCols := range summaryCols {
+				if !strings.HasPrefix(part, header+": ") {
+					continue
+				}
+				for _, iCol := range iCols {
+					if iCol < len(row) && timelineVerifyValue(strings.TrimPrefix(part, header+": "), row[iCol]) {
+						found = true
+						break
+					}
+				}
+			}
+		} else {
+			for _, iCols := range summaryCols {
+				for _, iCol := range iCols {
+					if iCol < len(row) && timelineVerifyValue(part, row[iCol]) {
+						found = true
+						break
+					}
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+//timelineVerifyValue compares values while allowing for Excel-friendly 32k truncation
+func timelineVerifyValue(timelineValue string, csvValue string) bool {
+	if timelineValue == csvValue {
+		return true
+	}
+	if strings.HasSuffix(timelineValue, "...") && strings.HasPrefix(csvValue, strings.TrimSuffix(timelineValue, "...")) {
+		return true
+	}
+	//Values containing the " || " separator are split apart in the timeline summary
+	return strings.Contains(csvValue, timelineValue)
+}
@@ -0,0 +1,200 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"errors"
+	"time"
+)
+
+//Layouts of the timestamps GoAuditParser writes to parsed files and timelines
+const (
+	NormalizedTimeLayout       = "2006-01-02 15:04:05"
+	NormalizedTimeLayoutMillis = "2006-01-02 15:04:05.000"
+)
+
+//auditTime is a timestamp split into its parts by splitTime, without allocating
+type auditTime struct {
+	date     string //"2019-12-19"
+	clock    string //"11:11:45"
+	fraction string //Digits after the ".", "" if there are none
+	zone     string //"", "Z", or "+hh:mm", "-hh:mm", "+hhmm", "-hhmm"
+}
+
+//timeDigits returns true if every byte of s[from:to] is an ASCII digit
+func timeDigits(s string, from int, to int) bool {
+	for i := from; i < to; i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+//timeTwoDigits returns the number of the two digits at s[i:i+2], which timeDigits already checked
+func timeTwoDigits(s string, i int) int {
+	return int(s[i]-'0')*10 + int(s[i+1]-'0')
+}
+
+//timeDaysIn returns the number of days of a month
+func timeDaysIn(month int, year int) int {
+	switch month {
+	case 2:
+		if year%4 == 0 && (year%100 != 0 || year%400 == 0) {
+			return 29
+		}
+		return 28
+	case 4, 6, 9, 11:
+		return 30
+	}
+	return 31
+}
+
+//splitTime splits a timestamp such as "2019-12-19T11:11:45.299Z" or "2019-12-19 11:11:45" into its parts
+//Values of another shape, out of range fields such as month 13, or trailing text return false instead of being sliced
+func splitTime(value string) (auditTime, bool) {
+	parts := auditTime{}
+	if len(value) < 19 || len(value) > 40 {
+		return parts, false
+	}
+	if value[4] != '-' || value[7] != '-' || (value[10] != 'T' && value[10] != ' ') || value[13] != ':' || value[16] != ':' {
+		return parts, false
+	}
+	if !timeDigits(value, 0, 4) || !timeDigits(value, 5, 7) || !timeDigits(value, 8, 10) || !timeDigits(value, 11, 13) || !timeDigits(value, 14, 16) || !timeDigits(value, 17, 19) {
+		return parts, false
+	}
+	month, day := timeTwoDigits(value, 5), timeTwoDigits(value, 8)
+	if month < 1 || month > 12 || day < 1 || day > timeDaysIn(month, timeTwoDigits(value, 0)*100+timeTwoDigits(value, 2)) {
+		return parts, false
+	}
+	if timeTwoDigits(value, 11) > 23 || timeTwoDigits(value, 14) > 59 || timeTwoDigits(value, 17) > 59 {
+		return parts, false
+	}
+	parts.date = value[0:10]
+	parts.clock = value[11:19]
+
+	rest := value[19:]
+	if len(rest) > 0 && rest[0] == '.' {
+		end := 1
+		for end < len(rest) && rest[end] >= '0' && rest[end] <= '9' {
+			end++
+		}
+		if end == 1 {
+			return parts, false
+		}
+		parts.fraction = rest[1:end]
+		rest = rest[end:]
+	}
+	switch {
+	case rest == "" || rest == "Z":
+	case (len(rest) == 6 && rest[3] == ':' && timeDigits(rest, 1, 3) && timeDigits(rest, 4, 6)) || (len(rest) == 5 && timeDigits(rest, 1, 5)):
+		if rest[0] != '+' && rest[0] != '-' {
+			return parts, false
+		}
+	default:
+		return parts, false
+	}
+	parts.zone = rest
+	return parts, true
+}
+
+//millis returns the fractional seconds as milliseconds, ".299", padding shorter fractions and cutting off longer ones
+func (parts auditTime) millis() string {
+	switch {
+	case len(parts.fraction) == 3:
+		return "." + parts.fraction
+	case len(parts.fraction) > 3:
+		return "." + parts.fraction[0:3]
+	}
+	return "." + parts.fraction + "000"[len(parts.fraction):]
+}
+
+//utc returns the time of a timestamp with a "+hh:mm" zone, to the millisecond
+func (parts auditTime) utc() (time.Time, error) {
+	zone := parts.zone
+	if len(zone) == 5 {
+		zone = zone[0:3] + ":" + zone[3:5]
+	}
+	t, err_p := time.Parse("2006-01-02 15:04:05.000-07:00", parts.date+" "+parts.clock+parts.millis()+zone)
+	if err_p != nil {
+		return t, err_p
+	}
+	return t.UTC(), nil
+}
+
+//ParseTime reads a timestamp of an audit, "2019-12-19T11:11:45.299Z", or one GoAuditParser wrote, "2019-12-19 11:11:45.299",
+//in UTC. Fractional seconds are optional, as is a "Z" or "+hh:mm" zone. Returns an error for anything else, such as "N/A"
+func ParseTime(value string) (time.Time, error) {
+	parts, ok := splitTime(value)
+	if !ok {
+		return time.Time{}, errors.New("'" + value + "' is not a timestamp such as \"2019-12-19T11:11:45.299Z\" or \"2019-12-19 11:11:45\"")
+	}
+	if parts.zone != "" && parts.zone != "Z" {
+		return parts.utc()
+	}
+	layout := NormalizedTimeLayout
+	clock := parts.clock
+	if parts.fraction != "" {
+		layout = NormalizedTimeLayoutMillis
+		clock += parts.millis()
+	}
+	return time.Parse(layout, parts.date+" "+clock)
+}
+
+//NormalizeTime converts a timestamp of an audit, "2019-12-19T11:11:45.299Z", to the "2019-12-19 11:11:45.299" written
+//to parsed files, or "2019-12-19 11:11:45" without fractional seconds. Fractional seconds are written as milliseconds
+//and "+hh:mm" zones are converted to UTC. Values which are not timestamps are returned unchanged
+func NormalizeTime(value string) string {
+	parts, ok := splitTime(value)
+	if !ok {
+		return value
+	}
+	if parts.zone != "" && parts.zone != "Z" {
+		t, err_p := parts.utc()
+		if err_p != nil {
+			return value
+		}
+		if parts.fraction != "" {
+			return t.Format(NormalizedTimeLayoutMillis)
+		}
+		return t.Format(NormalizedTimeLayout)
+	}
+	if parts.fraction != "" {
+		return parts.date + " " + parts.clock + parts.millis()
+	}
+	return parts.date + " " + parts.clock
+}
+
+//IsNormalizedTime returns true if a value is a timestamp as NormalizeTime writes it, "2019-12-19 11:11:45" or "2019-12-19 11:11:45.299"
+func IsNormalizedTime(value string) bool {
+	parts, ok := splitTime(value)
+	if !ok || parts.zone != "" || value[10] != ' ' {
+		return false
+	}
+	return parts.fraction == "" || len(parts.fraction) == 3
+}
+
+//AuditTimeSeconds cuts the fractional seconds off a timestamp of an audit, "2019-12-19T11:11:45.299Z" is "2019-12-19T11:11:45Z",
+//as event buffer audits are split. Values which are not timestamps, such as empty values, are returned unchanged
+func AuditTimeSeconds(value string) string {
+	parts, ok := splitTime(value)
+	if !ok {
+		return value
+	}
+	if parts.zone != "" && parts.zone != "Z" {
+		t, err_p := parts.utc()
+		if err_p != nil {
+			return value
+		}
+		return t.Format("2006-01-02T15:04:05Z")
+	}
+	return parts.date + "T" + parts.clock + "Z"
+}
@@ -0,0 +1,167 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"testing"
+	"time"
+)
+
+//Timestamps of every accepted layout, and values which must not be taken for timestamps
+var timeParseTests = []struct {
+	value      string
+	ok         bool
+	normalized string //NormalizeTime
+	seconds    string //AuditTimeSeconds
+	utc        string //ParseTime, formatted with NormalizedTimeLayoutMillis
+}{
+	//Audit timestamps
+	{"2019-12-19T11:11:45Z", true, "2019-12-19 11:11:45", "2019-12-19T11:11:45Z", "2019-12-19 11:11:45.000"},
+	{"2019-12-19T11:11:45.299Z", true, "2019-12-19 11:11:45.299", "2019-12-19T11:11:45Z", "2019-12-19 11:11:45.299"},
+	{"2019-12-19T11:11:45.2Z", true, "2019-12-19 11:11:45.200", "2019-12-19T11:11:45Z", "2019-12-19 11:11:45.200"},
+	{"2019-12-19T11:11:45.2999999Z", true, "2019-12-19 11:11:45.299", "2019-12-19T11:11:45Z", "2019-12-19 11:11:45.299"},
+	{"2019-12-19T11:11:45", true, "2019-12-19 11:11:45", "2019-12-19T11:11:45Z", "2019-12-19 11:11:45.000"},
+	//Zones are converted to UTC
+	{"2019-12-19T11:11:45+02:00", true, "2019-12-19 09:11:45", "2019-12-19T09:11:45Z", "2019-12-19 09:11:45.000"},
+	{"2019-12-19T23:11:45.5-01:30", true, "2019-12-20 00:41:45.500", "2019-12-20T00:41:45Z", "2019-12-20 00:41:45.500"},
+	{"2019-12-19T11:11:45+0200", true, "2019-12-19 09:11:45", "2019-12-19T09:11:45Z", "2019-12-19 09:11:45.000"},
+	{"2019-12-31T23:30:00-0100", true, "2020-01-01 00:30:00", "2020-01-01T00:30:00Z", "2020-01-01 00:30:00.000"},
+	//Timestamps GoAuditParser wrote
+	{"2019-12-19 11:11:45", true, "2019-12-19 11:11:45", "2019-12-19T11:11:45Z", "2019-12-19 11:11:45.000"},
+	{"2019-12-19 11:11:45.299", true, "2019-12-19 11:11:45.299", "2019-12-19T11:11:45Z", "2019-12-19 11:11:45.299"},
+	//Leap days
+	{"2020-02-29T00:00:00Z", true, "2020-02-29 00:00:00", "2020-02-29T00:00:00Z", "2020-02-29 00:00:00.000"},
+	{"2000-02-29T00:00:00Z", true, "2000-02-29 00:00:00", "2000-02-29T00:00:00Z", "2000-02-29 00:00:00.000"},
+
+	//Empty, short, and malformed values are returned unchanged
+	{"", false, "", "", ""},
+	{"N/A", false, "N/A", "N/A", ""},
+	{"2019-12-19", false, "2019-12-19", "2019-12-19", ""},
+	{"2019-12-19T11:11", false, "2019-12-19T11:11", "2019-12-19T11:11", ""},
+	{"2019-12-19T11:11:4", false, "2019-12-19T11:11:4", "2019-12-19T11:11:4", ""},
+	{"2019/12/19 11:11:45", false, "2019/12/19 11:11:45", "2019/12/19 11:11:45", ""},
+	{"2019-12-19X11:11:45", false, "2019-12-19X11:11:45", "2019-12-19X11:11:45", ""},
+	{"2019-1a-19T11:11:45Z", false, "2019-1a-19T11:11:45Z", "2019-1a-19T11:11:45Z", ""},
+	{"2019-12-19T11:11:45.Z", false, "2019-12-19T11:11:45.Z", "2019-12-19T11:11:45.Z", ""},
+	{"2019-12-19T11:11:45ZZ", false, "2019-12-19T11:11:45ZZ", "2019-12-19T11:11:45ZZ", ""},
+	{"2019-12-19T11:11:45 UTC", false, "2019-12-19T11:11:45 UTC", "2019-12-19T11:11:45 UTC", ""},
+	{"2019-12-19T11:11:45*02:00", false, "2019-12-19T11:11:45*02:00", "2019-12-19T11:11:45*02:00", ""},
+	{"2019-12-19T11:11:45+2:00", false, "2019-12-19T11:11:45+2:00", "2019-12-19T11:11:45+2:00", ""},
+	{"2019-12-19T11:11:45.123456789012345678901234Z", false, "2019-12-19T11:11:45.123456789012345678901234Z", "2019-12-19T11:11:45.123456789012345678901234Z", ""},
+	//Out of range fields
+	{"2019-13-19T11:11:45Z", false, "2019-13-19T11:11:45Z", "2019-13-19T11:11:45Z", ""},
+	{"2019-00-19T11:11:45Z", false, "2019-00-19T11:11:45Z", "2019-00-19T11:11:45Z", ""},
+	{"2019-02-29T11:11:45Z", false, "2019-02-29T11:11:45Z", "2019-02-29T11:11:45Z", ""},
+	{"1900-02-29T11:11:45Z", false, "1900-02-29T11:11:45Z", "1900-02-29T11:11:45Z", ""},
+	{"2019-04-31T11:11:45Z", false, "2019-04-31T11:11:45Z", "2019-04-31T11:11:45Z", ""},
+	{"2019-12-00T11:11:45Z", false, "2019-12-00T11:11:45Z", "2019-12-00T11:11:45Z", ""},
+	{"2019-12-19T24:11:45Z", false, "2019-12-19T24:11:45Z", "2019-12-19T24:11:45Z", ""},
+	{"2019-12-19T11:60:45Z", false, "2019-12-19T11:60:45Z", "2019-12-19T11:60:45Z", ""},
+	{"2019-12-19T11:11:60Z", false, "2019-12-19T11:11:60Z", "2019-12-19T11:11:60Z", ""},
+}
+
+func TestSplitTime(t *testing.T) {
+	for _, test := range timeParseTests {
+		if _, ok := splitTime(test.value); ok != test.ok {
+			t.Errorf("splitTime(%q) ok = %v, want %v", test.value, ok, test.ok)
+		}
+	}
+	parts, _ := splitTime("2019-12-19T11:11:45.299+02:00")
+	if parts.date != "2019-12-19" || parts.clock != "11:11:45" || parts.fraction != "299" || parts.zone != "+02:00" {
+		t.Errorf("splitTime(%q) = %+v", "2019-12-19T11:11:45.299+02:00", parts)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	for _, test := range timeParseTests {
+		parsed, err_p := ParseTime(test.value)
+		if !test.ok {
+			if err_p == nil {
+				t.Errorf("ParseTime(%q) = %v, want an error", test.value, parsed)
+			}
+			continue
+		}
+		if err_p != nil {
+			t.Errorf("ParseTime(%q) returned error: %v", test.value, err_p)
+			continue
+		}
+		if parsed.Location() != time.UTC {
+			t.Errorf("ParseTime(%q) is in %v, want UTC", test.value, parsed.Location())
+		}
+		if got := parsed.Format(NormalizedTimeLayoutMillis); got != test.utc {
+			t.Errorf("ParseTime(%q) = %q, want %q", test.value, got, test.utc)
+		}
+	}
+}
+
+func TestNormalizeTime(t *testing.T) {
+	for _, test := range timeParseTests {
+		if got := NormalizeTime(test.value); got != test.normalized {
+			t.Errorf("NormalizeTime(%q) = %q, want %q", test.value, got, test.normalized)
+		}
+		if test.ok && !IsNormalizedTime(test.normalized) {
+			t.Errorf("IsNormalizedTime(%q) = false for the output of NormalizeTime(%q)", test.normalized, test.value)
+		}
+	}
+	for _, value := range []string{"2019-12-19T11:11:45Z", "2019-12-19 11:11:45.2", "2019-12-19 11:11:45+02:00", "N/A"} {
+		if IsNormalizedTime(value) {
+			t.Errorf("IsNormalizedTime(%q) = true, want false", value)
+		}
+	}
+}
+
+func TestAuditTimeSeconds(t *testing.T) {
+	for _, test := range timeParseTests {
+		if got := AuditTimeSeconds(test.value); got != test.seconds {
+			t.Errorf("AuditTimeSeconds(%q) = %q, want %q", test.value, got, test.seconds)
+		}
+	}
+}
+
+func FuzzParseTime(f *testing.F) {
+	for _, test := range timeParseTests {
+		f.Add(test.value)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		parsed, err_p := ParseTime(value)
+		if err_p != nil {
+			return
+		}
+		//Parsing the normalized timestamp again gives the same time
+		normalized := NormalizeTime(value)
+		again, err_a := ParseTime(normalized)
+		if err_a != nil {
+			if parsed.Year() < 1 || parsed.Year() > 9999 {
+				return //Zones can move a timestamp out of the years a normalized timestamp can have
+			}
+			t.Fatalf("ParseTime(%q) = %v, but ParseTime(NormalizeTime) = ParseTime(%q) returned error: %v", value, parsed, normalized, err_a)
+		}
+		if !again.Equal(parsed) {
+			t.Fatalf("ParseTime(%q) = %v, but ParseTime(%q) = %v", value, parsed, normalized, again)
+		}
+	})
+}
+
+func FuzzNormalizeTime(f *testing.F) {
+	for _, test := range timeParseTests {
+		f.Add(test.value)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		normalized := NormalizeTime(value)
+		if again := NormalizeTime(normalized); again != normalized {
+			t.Fatalf("NormalizeTime(%q) = %q, but NormalizeTime(%q) = %q", value, normalized, normalized, again)
+		}
+		seconds := AuditTimeSeconds(value)
+		if again := AuditTimeSeconds(seconds); again != seconds {
+			t.Fatalf("AuditTimeSeconds(%q) = %q, but AuditTimeSeconds(%q) = %q", value, seconds, seconds, again)
+		}
+	})
+}
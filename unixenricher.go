@@ -0,0 +1,115 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"regexp"
+	"strings"
+)
+
+//UnixActivityPattern identifies an activity from a Syslog message or ShellHistory command
+type UnixActivityPattern struct {
+	Activity string
+	Regex    *regexp.Regexp
+	Detail   func(m []string) string
+}
+
+var unixSyslogPatterns = []UnixActivityPattern{
+	//Accepted publickey for root from 10.1.2.3 port 52344 ssh2
+	{"SSH Login", regexp.MustCompile(`Accepted (\S+) for (\S+) from (\S+) port`), func(m []string) string {
+		return m[2] + " from " + m[3] + " (" + m[1] + ")"
+	}},
+	//Failed password for invalid user admin from 10.1.2.3 port 52344 ssh2
+	{"SSH Failed Login", regexp.MustCompile(`Failed (\S+) for (?:invalid user )?(\S+) from (\S+) port`), func(m []string) string {
+		return m[2] + " from " + m[3] + " (" + m[1] + ")"
+	}},
+	//  jdoe : TTY=pts/0 ; PWD=/home/jdoe ; USER=root ; COMMAND=/bin/bash
+	{"Sudo", regexp.MustCompile(`^\s*(\S+) : .*USER=(\S+) ; COMMAND=(.*)$`), func(m []string) string {
+		return m[1] + " as " + m[2] + ": " + m[3]
+	}},
+	//Successful su for root by jdoe
+	{"Su", regexp.MustCompile(`^Successful su for (\S+) by (\S+)`), func(m []string) string {
+		return m[2] + " as " + m[1]
+	}},
+	//(jdoe) REPLACE (jdoe)
+	{"Cron Edit", regexp.MustCompile(`^\((\S+)\) (REPLACE|BEGIN EDIT|END EDIT|DELETE|RELOAD) \((\S+)\)`), func(m []string) string {
+		return m[1] + " " + m[2] + " crontab of " + m[3]
+	}},
+	//(root) CMD (/usr/local/bin/backup.sh)
+	{"Cron Job", regexp.MustCompile(`^\((\S+)\) CMD \((.*)\)$`), func(m []string) string {
+		return m[1] + ": " + m[2]
+	}},
+}
+
+var unixShellHistoryPatterns = []UnixActivityPattern{
+	//sudo -u www-data /bin/bash
+	{"Sudo", regexp.MustCompile(`^\s*sudo\s+(.*)$`), func(m []string) string {
+		return m[1]
+	}},
+	//su - root
+	{"Su", regexp.MustCompile(`^\s*su(?:\s+(.*))?$`), func(m []string) string {
+		return strings.TrimSpace(m[1])
+	}},
+	//ssh -i key.pem admin@10.1.2.3
+	{"SSH Outbound", regexp.MustCompile(`^\s*(?:ssh|scp|sftp)\s+(.*)$`), func(m []string) string {
+		return m[1]
+	}},
+	//crontab -e
+	{"Cron Edit", regexp.MustCompile(`^\s*crontab\s+(.*)$`), func(m []string) string {
+		return m[1]
+	}},
+	//vi /etc/crontab
+	{"Cron Edit", regexp.MustCompile(`(?:^|\s)(/etc/cron\S*|/var/spool/cron\S*)`), func(m []string) string {
+		return m[1]
+	}},
+}
+
+//EnrichUnixActivity adds "UnixActivity" and "UnixActivityDetail" columns to Syslog and ShellHistoryItem audits
+func EnrichUnixActivity(auditType string, csvHeaders []string, csvRows [][]string) ([]string, [][]string) {
+	var patterns []UnixActivityPattern
+	var column string
+	if strings.ToLower(auditType) == "syslog" {
+		patterns = unixSyslogPatterns
+		column = "Message"
+	} else if strings.ToLower(auditType) == "shellhistoryitem" {
+		patterns = unixShellHistoryPatterns
+		column = "Command"
+	} else {
+		return csvHeaders, csvRows
+	}
+
+	col_index := -1
+	for i, header := range csvHeaders {
+		if header == column {
+			col_index = i
+			break
+		}
+	}
+	if col_index == -1 {
+		return csvHeaders, csvRows
+	}
+
+	csvHeaders = append(csvHeaders, "UnixActivity", "UnixActivityDetail")
+	for i := 0; i < len(csvRows); i++ {
+		activity := ""
+		detail := ""
+		for _, pattern := range patterns {
+			m := pattern.Regex.FindStringSubmatch(csvRows[i][col_index])
+			if len(m) > 0 {
+				activity = pattern.Activity
+				detail = pattern.Detail(m)
+				break
+			}
+		}
+		csvRows[i] = append(csvRows[i], activity, detail)
+	}
+	return csvHeaders, csvRows
+}
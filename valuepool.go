@@ -0,0 +1,58 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+//Values longer than this, such as command lines and hashes, rarely repeat and are not pooled
+const valuePoolMaxValueLength = 256
+
+//Distinct values a pool keeps, so an audit of unique values does not grow it without bound
+const valuePoolMaxValues = 1 << 16
+
+//ValuePool interns the repeated cell values of one XML file, such as paths, usernames, and "true",
+//so rows share one copy of each value instead of allocating their own
+//A pool is not safe for concurrent use, each thread parsing a file creates its own
+type ValuePool struct {
+	values map[string]string
+}
+
+//NewValuePool returns an empty value pool
+func NewValuePool() *ValuePool {
+	return &ValuePool{values: map[string]string{}}
+}
+
+//Intern returns the pooled copy of a value, adding it to the pool if it is new
+//Pooled values are copied, so they do not keep the XML line they were sliced from in memory
+//A nil pool returns the value unchanged
+func (pool *ValuePool) Intern(value string) string {
+	if pool == nil || value == "" || len(value) > valuePoolMaxValueLength {
+		return value
+	}
+	if pooled, exists := pool.values[value]; exists {
+		return pooled
+	}
+	if len(pool.values) >= valuePoolMaxValues {
+		return value
+	}
+	pooled := string([]byte(value))
+	pool.values[pooled] = pooled
+	return pooled
+}
+
+//NewRowTable returns rowCount rows of columnCount empty cells backed by one allocation instead of one per row
+//Each row is capped at its own cells, so appending to a row copies it rather than overwriting the next one
+func NewRowTable(rowCount int, columnCount int) [][]string {
+	cells := make([]string, rowCount*columnCount)
+	rows := make([][]string, rowCount)
+	for i := range rows {
+		rows[i] = cells[i*columnCount : (i+1)*columnCount : (i+1)*columnCount]
+	}
+	return rows
+}
@@ -0,0 +1,224 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//Default of '-watch-interval <int>', the seconds between scans of the input directory with '-watch'
+const WatchDefaultIntervalSeconds = 10
+
+//watchedFile is the size and modification time of an archive or XML file in the input directory
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+//isWatchedInputFile returns true if '-watch' parses the file when it lands in the input directory
+func isWatchedInputFile(name string) bool {
+	if strings.HasPrefix(name, "_GAP") {
+		return false
+	}
+	if _, isTemp := TempFileRunID(name); isTemp {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".zip", ".mans", ".xml":
+		return true
+	}
+	return false
+}
+
+//watchInputDirs returns the input directories of '-i <dir>', and their subdirectories with '-r'
+func watchInputDirs(options Options) []string {
+	dirs := []string{}
+	for _, inputPath := range strings.Split(options.InputPath, ",") {
+		if !options.Recursive {
+			dirs = append(dirs, inputPath)
+			continue
+		}
+		filepath.Walk(inputPath, func(path string, info os.FileInfo, err_p error) error {
+			//The XML of a Redline session is extracted with the session, not parsed again
+			if err_p == nil && info.IsDir() && IsRedlineAuditsDir(path) {
+				return filepath.SkipDir
+			}
+			if err_p == nil && info.IsDir() && info.Name() != "xmlsplit" {
+				dirs = append(dirs, path)
+			}
+			return nil
+		})
+	}
+	return dirs
+}
+
+//scanWatchedInput lists the archives and XML files of the input directories by path
+func scanWatchedInput(options Options) (map[string]watchedFile, error) {
+	files := map[string]watchedFile{}
+	var err_s error
+	for _, dir := range watchInputDirs(options) {
+		infos, err_r := ioutil.ReadDir(dir)
+		if err_r != nil {
+			err_s = err_r
+			continue
+		}
+		for _, info := range infos {
+			if info.Mode().IsRegular() && isWatchedInputFile(info.Name()) {
+				files[filepath.Join(dir, info.Name())] = watchedFile{info.Size(), info.ModTime()}
+			}
+		}
+	}
+	return files, err_s
+}
+
+//parsedInputFiles returns the sizes of the archives and XML files in the parse caches of the input directories for
+//the output directory, which includes the XML files a parse extracted or split itself
+func parsedInputFiles(options Options) map[string]int64 {
+	parsed := map[string]int64{}
+	absOutputPath, err_a := filepath.Abs(options.OutputPath)
+	if err_a != nil {
+		return parsed
+	}
+	for _, dir := range watchInputDirs(options) {
+		dirOptions := options
+		dirOptions.InputPath = dir
+		b, err_r := ioutil.ReadFile(ParseCachePath(dirOptions))
+		if err_r != nil {
+			continue
+		}
+		var config Parse_Config_JSON
+		if json.Unmarshal(b, &config) != nil {
+			continue
+		}
+		for _, outdir := range config.OutputDirectories {
+			if outdir.OutputDirectory != absOutputPath {
+				continue
+			}
+			for _, xmlFile := range outdir.XMLFiles {
+				parsed[filepath.Join(dir, xmlFile.InputFileName)] = xmlFile.InputFileSize
+			}
+			for _, archiveFile := range outdir.ArchiveFiles {
+				parsed[filepath.Join(dir, archiveFile.InputFileName)] = archiveFile.InputFileSize
+			}
+		}
+	}
+	return parsed
+}
+
+//GoAuditWatch_Start keeps GoAuditParser running with '-watch', parsing the input directory once and again every time
+//new or changed archives and XML files land in it. Files are only parsed once they stopped changing for
+//'-watch-interval <int>' seconds, so archives still being copied are not extracted. The parse cache skips the files
+//which were already parsed, so each parse only extracts, splits, and parses the new files
+//The input directories are polled on purpose instead of using file system notifications such as inotify: those are not
+//raised on SMB and NFS shares for files written by other machines, which is where triage packages usually land, and
+//files still have to be checked again until they stopped changing
+func GoAuditWatch_Start(options Options, parse func(Options)) int {
+	interval := time.Duration(options.WatchIntervalSeconds) * time.Second
+
+	//The first Ctrl+C lets the current parse finish, the second one stops right away
+	stop := make(chan bool)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		options.Log.Println(options.Box + "NOTICE - Stopping '-watch' once the current parse finishes. Press Ctrl+C again to stop now.")
+		close(stop)
+		<-signals
+		options.Log.Close()
+		os.Exit(1)
+	}()
+	stopping := func() bool {
+		select {
+		case <-stop:
+			return true
+		default:
+			return false
+		}
+	}
+
+	watching := func() {
+		if !stopping() {
+			options.Log.Println(options.Box + "Watching '" + options.InputPath + "' for new archives and XML files every " + strconv.Itoa(options.WatchIntervalSeconds) + " second(s). Press Ctrl+C to stop.")
+		}
+	}
+
+	handled := map[string]watchedFile{} //Files parsed, or which failed, with their size and modification time then
+	var previous map[string]watchedFile
+	warned := false
+	for runs, first := 0, true; ; first = false {
+		files, err_s := scanWatchedInput(options)
+		if err_s != nil && !warned {
+			options.Log.Println(options.Warnbox + "WARNING - Could not read all of input directory '" + options.InputPath + "'. " + err_s.Error())
+		}
+		warned = err_s != nil
+
+		//New and changed files, which are parsed once none of them changed since the last scan
+		pending := []string{}
+		settled := true
+		for path, file := range files {
+			if done, exists := handled[path]; exists && done == file {
+				continue
+			}
+			pending = append(pending, path)
+			if last, exists := previous[path]; !exists || last != file {
+				settled = false
+			}
+		}
+		previous = files
+
+		//Files already in the input directory are parsed right away, like without '-watch'
+		if first && len(files) == 0 {
+			watching()
+		} else if first || (len(pending) > 0 && settled) {
+			if !first {
+				sort.Strings(pending)
+				options.Log.Println(options.Box + "Found " + strconv.Itoa(len(pending)) + " new or changed file(s) in '" + options.InputPath + "'.")
+				for _, path := range pending {
+					options.Log.Println(options.Box + "  " + path)
+				}
+			}
+			parse(options)
+			runs++
+			//Wiping and reparsing everything only apply to the first parse
+			options.WipeOutput = false
+			options.ForceReparse = false
+
+			for path, file := range files {
+				handled[path] = file
+			}
+			//Files extracted or split by the parse are in its parse cache, files which landed during it are not
+			after, _ := scanWatchedInput(options)
+			for path, size := range parsedInputFiles(options) {
+				if file, exists := after[path]; exists && file.size == size {
+					handled[path] = file
+				}
+			}
+			previous = after
+			watching()
+		}
+
+		select {
+		case <-stop:
+			options.Log.Println(options.Box + "Stopped watching '" + options.InputPath + "' after " + strconv.Itoa(runs) + " parse(s).")
+			return 0
+		case <-time.After(interval):
+		}
+	}
+}
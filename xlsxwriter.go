@@ -0,0 +1,423 @@
+// ==============================================================
+// Copyright 2020 FireEye, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not use this file except in compliance with the License. You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software distributed under the License is distributed on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the License for the specific language governing permissions and limitations under the License.
+// ==============================================================
+
+package goauditparser
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Values of '-xlsx <str>'
+const (
+	XLSXByHost  = "host"
+	XLSXByAudit = "audit"
+)
+
+//Directory in the output directory the '-xlsx' workbooks are written to
+const XLSXDirName = "xlsx"
+
+//Most rows of an Excel sheet, including the headers. Rows past it continue on a new sheet
+const xlsxMaxSheetRows = 1048576
+
+//Excel sheet names are at most 31 characters and can't contain these
+var xlsxSheetNameReplacer = strings.NewReplacer("[", "(", "]", ")", ":", "_", "*", "_", "?", "_", "/", "_", "\\", "_")
+
+//XLSXWorkbook writes the sheets of an .xlsx workbook one after another, so only the current row is held in memory
+//Cells are written as inline strings, the headers of each sheet are bold, frozen, and have an autofilter
+type XLSXWorkbook struct {
+	zip    *zip.Writer
+	sheets []xlsxSheet
+	names  map[string]bool
+	sheet  *bufio.Writer
+	cells  int //Columns of the current sheet
+}
+
+type xlsxSheet struct {
+	Name string
+	Rows int
+	Cols int
+}
+
+//NewXLSXWorkbook starts a workbook written to w, Close must be called to finish it
+func NewXLSXWorkbook(w io.Writer) *XLSXWorkbook {
+	return &XLSXWorkbook{zip: zip.NewWriter(w), names: map[string]bool{}}
+}
+
+//xlsxColumnName returns the column letters of a zero based column index, such as "A" or "AB"
+func xlsxColumnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+//Returns a sheet name Excel accepts which no other sheet of the workbook has
+func (wb *XLSXWorkbook) sheetName(name string) string {
+	name = strings.TrimSpace(xlsxSheetNameReplacer.Replace(name))
+	if name == "" {
+		name = "Sheet"
+	}
+	truncate := func(value string, length int) string {
+		runes := []rune(value)
+		if len(runes) > length {
+			return string(runes[:length])
+		}
+		return value
+	}
+	unique := truncate(name, 31)
+	for i := 2; wb.names[strings.ToLower(unique)]; i++ {
+		suffix := " (" + strconv.Itoa(i) + ")"
+		unique = truncate(name, 31-len(suffix)) + suffix
+	}
+	wb.names[strings.ToLower(unique)] = true
+	return unique
+}
+
+//StartSheet finishes the current sheet and starts a new one with the headers as its first row
+//The name is changed if it can't be used as is, such as when it is too long or another sheet has it
+func (wb *XLSXWorkbook) StartSheet(name string, headers []string) error {
+	if err_f := wb.finishSheet(); err_f != nil {
+		return err_f
+	}
+	wb.sheets = append(wb.sheets, xlsxSheet{Name: wb.sheetName(name), Cols: len(headers)})
+	entry, err_c := wb.zip.Create("xl/worksheets/sheet" + strconv.Itoa(len(wb.sheets)) + ".xml")
+	if err_c != nil {
+		return err_c
+	}
+	wb.sheet = bufio.NewWriter(entry)
+	wb.cells = len(headers)
+	wb.sheet.WriteString(xml.Header)
+	wb.sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	wb.sheet.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	wb.sheet.WriteString(`<sheetData>`)
+	return wb.writeRow(headers, 1)
+}
+
+//WriteRow writes a row to the current sheet, cells past the headers are left out
+//Returns an error once the sheet is full, callers should start another sheet
+func (wb *XLSXWorkbook) WriteRow(row []string) error {
+	if wb.sheet == nil {
+		return errors.New("no sheet was started")
+	}
+	if wb.sheets[len(wb.sheets)-1].Rows >= xlsxMaxSheetRows {
+		return errors.New("sheet '" + wb.sheets[len(wb.sheets)-1].Name + "' is full")
+	}
+	return wb.writeRow(row, 0)
+}
+
+//SheetFull returns true if the current sheet can't take another row
+func (wb *XLSXWorkbook) SheetFull() bool {
+	return len(wb.sheets) > 0 && wb.sheets[len(wb.sheets)-1].Rows >= xlsxMaxSheetRows
+}
+
+//Writes a row of inline strings, style 1 is the bold header style
+func (wb *XLSXWorkbook) writeRow(row []string, style int) error {
+	sheet := &wb.sheets[len(wb.sheets)-1]
+	sheet.Rows++
+	rowNum := strconv.Itoa(sheet.Rows)
+	wb.sheet.WriteString(`<row r="` + rowNum + `">`)
+	for i, value := range row {
+		if i >= wb.cells {
+			break
+		}
+		if value == "" {
+			continue
+		}
+		//Excel cells hold at most 32,767 characters
+		if len(value) > 32000 {
+			value = value[0:32000] + "..."
+		}
+		wb.sheet.WriteString(`<c r="` + xlsxColumnName(i) + rowNum + `" t="inlineStr"`)
+		if style != 0 {
+			wb.sheet.WriteString(` s="` + strconv.Itoa(style) + `"`)
+		}
+		wb.sheet.WriteString(`><is><t xml:space="preserve">`)
+		if err_e := xml.EscapeText(wb.sheet, []byte(value)); err_e != nil {
+			return err_e
+		}
+		wb.sheet.WriteString(`</t></is></c>`)
+	}
+	_, err_w := wb.sheet.WriteString(`</row>`)
+	return err_w
+}
+
+//Closes the sheetData of the current sheet and adds its autofilter
+func (wb *XLSXWorkbook) finishSheet() error {
+	if wb.sheet == nil {
+		return nil
+	}
+	sheet := wb.sheets[len(wb.sheets)-1]
+	wb.sheet.WriteString(`</sheetData>`)
+	if sheet.Cols > 0 {
+		wb.sheet.WriteString(`<autoFilter ref="A1:` + xlsxColumnName(sheet.Cols-1) + strconv.Itoa(sheet.Rows) + `"/>`)
+	}
+	wb.sheet.WriteString(`</worksheet>`)
+	err_f := wb.sheet.Flush()
+	wb.sheet = nil
+	return err_f
+}
+
+//Close finishes the last sheet and writes the parts of the workbook which list its sheets
+func (wb *XLSXWorkbook) Close() error {
+	if err_f := wb.finishSheet(); err_f != nil {
+		return err_f
+	}
+	if len(wb.sheets) == 0 {
+		//A workbook needs at least one sheet
+		if err_s := wb.StartSheet("Sheet", []string{}); err_s != nil {
+			return err_s
+		}
+		if err_f := wb.finishSheet(); err_f != nil {
+			return err_f
+		}
+	}
+
+	var types, workbook, rels strings.Builder
+	types.WriteString(xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	types.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	types.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	types.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	types.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	workbook.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	definedNames := ""
+	for i, sheet := range wb.sheets {
+		id := strconv.Itoa(i + 1)
+		types.WriteString(`<Override PartName="/xl/worksheets/sheet` + id + `.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`)
+		workbook.WriteString(`<sheet name="`)
+		xml.EscapeText(&workbook, []byte(sheet.Name))
+		workbook.WriteString(`" sheetId="` + id + `" r:id="rId` + id + `"/>`)
+		rels.WriteString(`<Relationship Id="rId` + id + `" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet` + id + `.xml"/>`)
+		if sheet.Cols > 0 {
+			var ref strings.Builder
+			xml.EscapeText(&ref, []byte("'"+strings.ReplaceAll(sheet.Name, "'", "''")+"'!$A$1:$"+xlsxColumnName(sheet.Cols-1)+"$"+strconv.Itoa(sheet.Rows)))
+			definedNames += `<definedName name="_xlnm._FilterDatabase" localSheetId="` + strconv.Itoa(i) + `" hidden="1">` + ref.String() + `</definedName>`
+		}
+	}
+	types.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets>`)
+	if definedNames != "" {
+		workbook.WriteString(`<definedNames>` + definedNames + `</definedNames>`)
+	}
+	workbook.WriteString(`</workbook>`)
+	stylesID := strconv.Itoa(len(wb.sheets) + 1)
+	rels.WriteString(`<Relationship Id="rId` + stylesID + `" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`)
+	rels.WriteString(`</Relationships>`)
+
+	parts := [][2]string{
+		{"[Content_Types].xml", types.String()},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", rels.String()},
+		{"xl/styles.xml", xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+			`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+			`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+			`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+			`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+			`</styleSheet>`},
+	}
+	for _, part := range parts {
+		entry, err_c := wb.zip.Create(part[0])
+		if err_c != nil {
+			return err_c
+		}
+		if _, err_w := io.WriteString(entry, part[1]); err_w != nil {
+			return err_w
+		}
+	}
+	return wb.zip.Close()
+}
+
+//xlsxSheetSource is the parsed CSV files of one sheet group, such as the FileItem files of a host
+type xlsxSheetSource struct {
+	Name  string
+	Files []string
+}
+
+//Reads the headers of each file and returns their union, in the order they are first found
+func xlsxSheetHeaders(dir string, files []string) ([]string, error) {
+	headers := []string{}
+	seen := map[string]bool{}
+	for _, name := range files {
+		file, err_o := os.Open(filepath.Join(dir, name))
+		if err_o != nil {
+			return nil, err_o
+		}
+		reader, _ := NewDialectCSVReader(file)
+		fileHeaders, err_r := reader.Read()
+		file.Close()
+		if err_r == io.EOF {
+			continue
+		} else if err_r != nil {
+			return nil, errors.New("could not read '" + name + "'. " + err_r.Error())
+		}
+		for _, header := range fileHeaders {
+			if !seen[header] {
+				seen[header] = true
+				headers = append(headers, header)
+			}
+		}
+	}
+	return headers, nil
+}
+
+//Writes the rows of the files of a sheet source under the union of their headers, continuing on another sheet of the
+//same name when a sheet is full. Returns the number of rows written
+func writeXLSXSheets(wb *XLSXWorkbook, dir string, source xlsxSheetSource) (int, error) {
+	headers, err_h := xlsxSheetHeaders(dir, source.Files)
+	if err_h != nil {
+		return 0, err_h
+	}
+	if err_s := wb.StartSheet(source.Name, headers); err_s != nil {
+		return 0, err_s
+	}
+	headerIndex := map[string]int{}
+	for i, header := range headers {
+		headerIndex[header] = i
+	}
+	rows := 0
+	merged := make([]string, len(headers))
+	for _, name := range source.Files {
+		file, err_o := os.Open(filepath.Join(dir, name))
+		if err_o != nil {
+			return rows, err_o
+		}
+		reader, _ := NewDialectCSVReader(file)
+		fileHeaders, err_r := reader.Read()
+		for iRow := 0; err_r == nil; iRow++ {
+			var row []string
+			row, err_r = reader.Read()
+			if err_r != nil {
+				break
+			}
+			//The '-pdesc' field descriptions row is not data
+			if iRow == 0 && len(row) > 0 && row[0] == FieldDescriptionsMarker {
+				continue
+			}
+			for i := range merged {
+				merged[i] = ""
+			}
+			for i, value := range row {
+				if i < len(fileHeaders) {
+					merged[headerIndex[fileHeaders[i]]] = value
+				}
+			}
+			if wb.SheetFull() {
+				if err_s := wb.StartSheet(source.Name, headers); err_s != nil {
+					file.Close()
+					return rows, err_s
+				}
+			}
+			if err_w := wb.WriteRow(merged); err_w != nil {
+				file.Close()
+				return rows, err_w
+			}
+			rows++
+		}
+		file.Close()
+		if err_r != nil && err_r != io.EOF {
+			return rows, errors.New("could not read '" + name + "'. " + err_r.Error())
+		}
+	}
+	return rows, nil
+}
+
+//GoAuditXLSX_Start writes the parsed CSV files in the output directory to .xlsx workbooks in "<out_dir>/xlsx/" for
+//'-xlsx <str>', one per host with a sheet per audit type, or one per audit type with a sheet per host
+func GoAuditXLSX_Start(options Options) {
+	csvDir := options.OutputPath
+	files, err_r := ReadOutputDir(options, csvDir)
+	if err_r != nil {
+		options.Log.Println(options.Warnbox + "ERROR - Could not read CSV directory '" + csvDir + "'. " + err_r.Error())
+		return
+	}
+	groups := GroupFilesForMerge(files)
+	if len(groups) == 0 {
+		options.Log.Println(options.Warnbox + "ERROR - Could not identify any parsed CSV files in '" + csvDir + "' to write to workbooks.")
+		return
+	}
+
+	//Workbooks in order, each with its sheets in order
+	byAudit := options.XLSXMode == XLSXByAudit
+	workbooks := []string{}
+	sheets := map[string][]xlsxSheetSource{}
+	for _, group := range groups {
+		workbook, sheet := group.Hostname, group.AuditType
+		if byAudit {
+			workbook, sheet = group.AuditType, group.Hostname
+		}
+		if _, exists := sheets[workbook]; !exists {
+			workbooks = append(workbooks, workbook)
+		}
+		sheets[workbook] = append(sheets[workbook], xlsxSheetSource{sheet, group.Files})
+	}
+	if byAudit {
+		sort.Strings(workbooks)
+	}
+
+	xlsxDir := filepath.Join(csvDir, XLSXDirName)
+	if err_m := MkdirAllOutput(options, xlsxDir); err_m != nil {
+		options.Log.Println(options.Warnbox + "ERROR - Could not create workbook directory '" + xlsxDir + "'. " + err_m.Error())
+		return
+	}
+	options.Log.Println(options.Box + "Writing " + strconv.Itoa(len(workbooks)) + " workbook(s) to '" + xlsxDir + "'...")
+	options.Notifier.AddOutputs(xlsxDir)
+	failed := 0
+	for _, workbook := range workbooks {
+		path := filepath.Join(xlsxDir, workbook+".xlsx")
+		tempPath := TempOutputPath(options, path)
+		file, err_c := CreateOutputFile(options, tempPath)
+		if err_c != nil {
+			options.Log.Println(options.Warnbox + "ERROR - Could not create workbook '" + tempPath + "'. " + err_c.Error())
+			failed++
+			continue
+		}
+		wb := NewXLSXWorkbook(file)
+		rows := 0
+		var err_w error
+		for _, source := range sheets[workbook] {
+			var sheetRows int
+			sheetRows, err_w = writeXLSXSheets(wb, csvDir, source)
+			rows += sheetRows
+			if err_w != nil {
+				err_w = errors.New("sheet '" + source.Name + "', " + err_w.Error())
+				break
+			}
+		}
+		if err_w == nil {
+			err_w = wb.Close()
+		}
+		file.Close()
+		if err_w == nil {
+			err_w = os.Rename(tempPath, path)
+		}
+		if err_w != nil {
+			os.Remove(tempPath)
+			options.Log.Println(options.Warnbox + "ERROR - Could not write workbook '" + path + "'. " + err_w.Error())
+			failed++
+			continue
+		}
+		if options.Verbose > 0 {
+			options.Log.Println(options.Box + "Wrote " + strconv.Itoa(rows) + " row(s) in " + strconv.Itoa(len(wb.sheets)) + " sheet(s) to '" + path + "'.")
+		}
+	}
+	options.Log.Println(options.Box + "Wrote " + strconv.Itoa(len(workbooks)-failed) + " workbook(s) to '" + xlsxDir + "'.")
+}
@@ -12,7 +12,6 @@ package goauditparser
 
 import (
 	"bufio"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
@@ -27,24 +26,12 @@ func GoAuditXMLSplitter_Start(options Options) []os.FileInfo {
 
 	// Make output directory if it doesn't exist
 	if _, err := os.Stat(options.XMLSplitOutputDir); os.IsNotExist(err) {
-		if err = os.MkdirAll(options.XMLSplitOutputDir, os.ModePerm); err != nil {
-			fmt.Println(options.Warnbox + "ERROR - Could not create XML split output directory '" + options.XMLSplitOutputDir + "'.")
+		if err = MkdirAllOutput(options, options.XMLSplitOutputDir); err != nil {
+			options.Log.Println(options.Warnbox + "ERROR - Could not create XML split output directory '" + options.XMLSplitOutputDir + "'.")
 			log.Fatal(err)
 		}
 	} else if options.WipeOutput {
-		outputfiles, _ := ioutil.ReadDir(options.XMLSplitOutputDir)
-		if len(outputfiles) > 0 {
-			fmt.Println(options.Box + "Deleting all pre-existing XML files in the XML split output directory '" + options.XMLSplitOutputDir + "' as specified with the '-wo' flag.")
-			for _, file := range outputfiles {
-				var filename = file.Name()
-				if strings.HasSuffix(filename, ".xml") {
-					if options.Verbose > 0 {
-						fmt.Println(options.Box + "Removing pre-existing XML file '" + filename + "'...")
-					}
-					os.Remove(filepath.Join(options.XMLSplitOutputDir, filename))
-				}
-			}
-		}
+		WipeOutputDirectory(options, options.XMLSplitOutputDir, ".xml")
 	}
 
 	var files []os.FileInfo
@@ -64,12 +51,12 @@ func GoAuditXMLSplitter_Start(options Options) []os.FileInfo {
 			dirfiles, err_r := ioutil.ReadDir(options.InputPath)
 
 			if err_r != nil {
-				fmt.Println(options.Warnbox + "ERROR - Could not read input as an existing file or directory '" + options.InputPath + "'.")
+				options.Log.Println(options.Warnbox + "ERROR - Could not read input as an existing file or directory '" + options.InputPath + "'.")
 				log.Fatal(err_r)
 			}
 
 			if len(dirfiles) == 0 {
-				fmt.Println(options.Warnbox + "ERROR - No files found in input directory '" + options.InputPath + "'.")
+				options.Log.Println(options.Warnbox + "ERROR - No files found in input directory '" + options.InputPath + "'.")
 				return []os.FileInfo{}
 			}
 
@@ -83,42 +70,42 @@ func GoAuditXMLSplitter_Start(options Options) []os.FileInfo {
 		}
 	}
 
-	c_tqdm := make(chan bool)
-
+	var bar *ProgressBar
 	if options.Verbose == 0 {
-		go TQDM(len(files), options, options.Box+"Splitting large XML audits into '"+options.XMLSplitOutputDir+"'", c_tqdm)
+		bar = NewProgressBar(options, options.Box+"Splitting large XML audits into '"+options.XMLSplitOutputDir+"'", len(files))
 	} else {
-		fmt.Println(options.Box + "Extracting archives...")
+		options.Log.Println(options.Box + "Extracting archives...")
 	}
 
 	//Split any files that are too large.
 	filesSplit := []os.FileInfo{}
 	splitSize := int64(options.XMLSplitByteSize)
 	messages := []string{}
-	for _, file := range files {
+	options.Progress.Stage(ProgressStageSplit, len(files))
+	options.Log.StageStarted(ProgressStageSplit, len(files))
+	for i, file := range files {
+		options.Progress.SetPosition(i, file.Name())
 		xmlfilename := filepath.Base(file.Name())
 		if filepath.Ext(xmlfilename) == ".issues" || strings.HasSuffix(strings.TrimSuffix(filepath.Base(xmlfilename), filepath.Ext(xmlfilename)), "issues") {
 			if options.Verbose > 0 {
 				messages = append(messages, options.Warnbox+"NOTICE - Not splitting or including 'issues' file to be split '"+xmlfilename+"'.")
 			}
-			if options.Verbose == 0 {
-				c_tqdm <- true
-			}
+			bar.Add(1)
 			continue
 		}
 
-		if file.Size() > splitSize {
-			if options.Verbose > 0 {
+		if NeedsXMLSplit(options, filepath.Join(options.InputPath, file.Name()), file.Size()) {
+			if options.Verbose > 0 && file.Size() > splitSize {
 				messages = append(messages, options.Warnbox+"NOTICE - File '"+xmlfilename+"' is greater than "+strconv.Itoa(int(splitSize))+" bytes and will be split.")
+			} else if options.Verbose > 0 {
+				messages = append(messages, options.Warnbox+"NOTICE - File '"+xmlfilename+"' has more than "+strconv.Itoa(options.XMLSplitItemCount)+" items and will be split.")
 			}
 			splitCount := 1
 			originalFileName := filepath.Join(options.InputPath, file.Name())
 			originalFile, err_o := os.Open(originalFileName)
 			if err_o != nil {
 				messages = append(messages, options.Warnbox+"ERROR - Could not open file '"+originalFileName+"' to split.")
-				if options.Verbose == 0 {
-					c_tqdm <- true
-				}
+				bar.Add(1)
 				continue
 			}
 
@@ -137,7 +124,7 @@ func GoAuditXMLSplitter_Start(options Options) []os.FileInfo {
 				parts := strings.Split(basefilename, "-")
 				if len(parts) < 4 {
 					messages = append(messages, options.Warnbox+"WARNING - File '"+xmlfilename+"' does not match standardized naming scheme and could not be split.")
-					c_tqdm <- true
+					bar.Add(1)
 					continue
 				}
 				hostname = strings.Join(parts[0:len(parts)-3], "-")
@@ -147,12 +134,10 @@ func GoAuditXMLSplitter_Start(options Options) []os.FileInfo {
 			}
 			splitFileName := filepath.Join(options.XMLSplitOutputDir, hostname+"-"+agentid+"-"+payload+"_spxml"+strconv.Itoa(splitCount)+"-"+oldaudit)
 
-			splitFile, err_c := os.Create(splitFileName)
+			splitFile, err_c := CreateOutputFile(options, TempOutputPath(options, splitFileName))
 			if err_c != nil {
 				messages = append(messages, options.Warnbox+"ERROR - Could not create split file '"+splitFileName+"'. "+err_c.Error())
-				if options.Verbose == 0 {
-					c_tqdm <- true
-				}
+				bar.Add(1)
 				originalFile.Close()
 				continue
 			}
@@ -165,11 +150,64 @@ func GoAuditXMLSplitter_Start(options Options) []os.FileInfo {
 			writer := bufio.NewWriter(splitFile)
 			rowCount := 0
 			bytesWritten := int64(0)
+			itemsWritten := 0
 			header := ""
 			auditType := ""
 			regAuditType := regexp.MustCompile(`<([^ ^>]+)[ >]`)
 			issue := false
-			for scanner.Scan() {
+			finished := false
+			//Split files keep their temp name until complete
+			closeSplitFile := func() {
+				writer.Flush()
+				splitFile.Close()
+				if err_r := os.Rename(TempOutputPath(options, splitFileName), splitFileName); err_r != nil {
+					messages = append(messages, options.Warnbox+"ERROR - Could not rename temp file of split file '"+splitFileName+"'. "+err_r.Error())
+					issue = true
+					return
+				}
+				if fileinfo, err_s := os.Stat(splitFileName); !os.IsNotExist(err_s) {
+					filesSplit = append(filesSplit, fileinfo)
+				}
+			}
+			//End the current split file after an item and start the next one
+			nextSplitFile := func() {
+				_, err_w := writer.WriteString("</itemList>\n")
+				if err_w != nil {
+					messages = append(messages, options.Warnbox+"ERROR - Could not write string to '"+splitFileName+"'. "+err_w.Error())
+					issue = true
+					return
+				}
+				bytesWritten = 0
+				itemsWritten = 0
+				closeSplitFile()
+				if issue {
+					return
+				}
+				//No new split file if the item was the last one
+				if !scanner.Scan() || strings.TrimSpace(scanner.Text()) == "</itemList>" {
+					finished = true
+					return
+				}
+				line := scanner.Text()
+				//Start new split file
+				splitCount++
+				splitFileName = filepath.Join(options.XMLSplitOutputDir, hostname+"-"+agentid+"-"+payload+"_spxml"+strconv.Itoa(splitCount)+"-"+oldaudit)
+				splitFile, err_c = CreateOutputFile(options, TempOutputPath(options, splitFileName))
+				if err_c != nil {
+					messages = append(messages, options.Warnbox+"ERROR - Could not create split file '"+splitFileName+"'. "+err_c.Error())
+					issue = true
+					return
+				}
+				writer = bufio.NewWriter(splitFile)
+				bw, err_w := writer.WriteString(header + line + "\n")
+				if err_w != nil {
+					messages = append(messages, options.Warnbox+"ERROR - Could not write string to '"+splitFileName+"'. "+err_w.Error())
+					issue = true
+					return
+				}
+				bytesWritten += int64(bw)
+			}
+			for !finished && scanner.Scan() {
 				if options.Verbose > 3 && rowCount%1000000 == 0 {
 					messages = append(messages, options.Box+"SplitFile "+strconv.Itoa(splitCount)+" - Line "+strconv.Itoa(splitCount)+" - BytesWritten "+strconv.Itoa(splitCount))
 				}
@@ -187,7 +225,7 @@ func GoAuditXMLSplitter_Start(options Options) []os.FileInfo {
 				}
 				if rowCount == 2 {
 					if !strings.HasPrefix(line, "<itemList") {
-						fmt.Println(options.Warnbox + "ERROR - Unexpected 2nd Line '" + line + "'.")
+						options.Log.Println(options.Warnbox + "ERROR - Unexpected 2nd Line '" + line + "'.")
 						issue = true
 						break
 					} else {
@@ -220,6 +258,18 @@ func GoAuditXMLSplitter_Start(options Options) []os.FileInfo {
 				}
 				bytesWritten += int64(bw)
 
+				//If we have enough items, start up a new split file after this one
+				if strings.TrimSpace(line) == "</"+auditType+">" {
+					itemsWritten++
+					if options.XMLSplitItemCount > 0 && itemsWritten >= options.XMLSplitItemCount {
+						nextSplitFile()
+						if issue {
+							break
+						}
+						continue
+					}
+				}
+
 				//If we are over the byte limit, write the rest of the "row" item to file
 				if bytesWritten > splitSize-3000 {
 					for scanner.Scan() {
@@ -233,38 +283,7 @@ func GoAuditXMLSplitter_Start(options Options) []os.FileInfo {
 						bytesWritten += int64(bw)
 						//If we are at the end of the "row" item, write it out, and start up a new split file
 						if strings.TrimSpace(line) == "</"+auditType+">" {
-							//End current split file
-							_, err_w := writer.WriteString("</itemList>\n")
-							if err_w != nil {
-								messages = append(messages, options.Warnbox+"ERROR - Could not write string to '"+splitFileName+"'. "+err_w.Error())
-								issue = true
-								break
-							}
-							bytesWritten = 0
-							writer.Flush()
-							splitFile.Close()
-							if fileinfo, err_s := os.Stat(splitFileName); !os.IsNotExist(err_s) {
-								filesSplit = append(filesSplit, fileinfo)
-							}
-							//Start new split file
-							splitCount++
-							splitFileName = filepath.Join(options.XMLSplitOutputDir, hostname+"-"+agentid+"-"+payload+"_spxml"+strconv.Itoa(splitCount)+"-"+oldaudit)
-							splitFile, err_c = os.Create(splitFileName)
-							if err_c != nil {
-								messages = append(messages, options.Warnbox+"ERROR - Could not create split file '"+splitFileName+"'. "+err_c.Error())
-								issue = true
-								break
-							}
-							writer = bufio.NewWriter(splitFile)
-							scanner.Scan()
-							line = scanner.Text()
-							bw, err_w := writer.WriteString(header + line + "\n")
-							if err_w != nil {
-								messages = append(messages, options.Warnbox+"ERROR - Could not write string to '"+splitFileName+"'. "+err_w.Error())
-								issue = true
-								break
-							}
-							bytesWritten += int64(bw)
+							nextSplitFile()
 							break
 						}
 					}
@@ -276,9 +295,8 @@ func GoAuditXMLSplitter_Start(options Options) []os.FileInfo {
 			if issue {
 				originalFile.Close()
 				splitFile.Close()
-				if options.Verbose == 0 {
-					c_tqdm <- true
-				}
+				os.Remove(TempOutputPath(options, splitFileName))
+				bar.Add(1)
 				continue
 			}
 			err_se := scanner.Err()
@@ -286,18 +304,15 @@ func GoAuditXMLSplitter_Start(options Options) []os.FileInfo {
 				messages = append(messages, options.Warnbox+"ERROR - Could not completely read file '"+splitFileName+"'.")
 				originalFile.Close()
 				splitFile.Close()
-				if options.Verbose == 0 {
-					c_tqdm <- true
-				}
+				os.Remove(TempOutputPath(options, splitFileName))
+				bar.Add(1)
 				continue
 			}
 			originalFile.Close()
-			writer.Flush()
-			splitFile.Close()
-			if fileinfo, err_s := os.Stat(splitFileName); !os.IsNotExist(err_s) {
-				filesSplit = append(filesSplit, fileinfo)
+			if !finished {
+				closeSplitFile()
 			}
-			c_tqdm <- true
+			bar.Add(1)
 		} else {
 			//Just copy the file
 			//https://opensource.com/article/18/6/copying-files-go (Example #3)
@@ -309,22 +324,18 @@ func GoAuditXMLSplitter_Start(options Options) []os.FileInfo {
 			sourcefile, err_o := os.Open(originalFilePath)
 			if err_o != nil {
 				messages = append(messages, options.Warnbox+"ERROR - Could not open file '"+xmlfilename+"'. "+err_o.Error())
-				if options.Verbose == 0 {
-					c_tqdm <- true
-				}
+				bar.Add(1)
 				continue
 			}
 			defer sourcefile.Close()
 
 			destfilename := filepath.Join(options.XMLSplitOutputDir, xmlfilename)
 
-			destfile, err_w := os.Create(destfilename)
+			destfile, err_w := CreateOutputFile(options, TempOutputPath(options, destfilename))
 			if err_w != nil {
 				messages = append(messages, options.Warnbox+"ERROR - Could not create output file '"+xmlfilename+"'. "+err_w.Error())
 				sourcefile.Close()
-				if options.Verbose == 0 {
-					c_tqdm <- true
-				}
+				bar.Add(1)
 				continue
 			}
 			defer destfile.Close()
@@ -334,20 +345,112 @@ func GoAuditXMLSplitter_Start(options Options) []os.FileInfo {
 				messages = append(messages, options.Warnbox+"ERROR - Could not copy contents of file '"+xmlfilename+"'. "+err_c.Error())
 				sourcefile.Close()
 				destfile.Close()
-				if options.Verbose == 0 {
-					c_tqdm <- true
-				}
+				os.Remove(TempOutputPath(options, destfilename))
+				bar.Add(1)
 				continue
 			}
 
 			sourcefile.Close()
 			destfile.Close()
-			c_tqdm <- true
+			if err_r := os.Rename(TempOutputPath(options, destfilename), destfilename); err_r != nil {
+				messages = append(messages, options.Warnbox+"ERROR - Could not rename temp file of '"+xmlfilename+"'. "+err_r.Error())
+			}
+			bar.Add(1)
 		}
 	}
+	bar.Close()
+	options.Log.StageFinished(ProgressStageSplit, len(files))
+	options.Progress.SetPosition(len(files), "")
 	for _, msg := range messages {
-		fmt.Println(msg)
+		options.Log.Println(msg)
 	}
 	return filesSplit
 
 }
+
+//NeedsXMLSplit reports whether an XML file is over the '-xsb' byte size or the '-xsc' item count
+func NeedsXMLSplit(options Options, path string, size int64) bool {
+	if size > int64(options.XMLSplitByteSize) {
+		return true
+	}
+	return options.XMLSplitItemCount > 0 && XMLItemCount(options, path) > options.XMLSplitItemCount
+}
+
+//First element of an XML audit after its itemList header, <FileItem created="..." uid="...">
+var regXMLAuditItem = regexp.MustCompile(`<([^ ^>]+)[ >]`)
+
+//XMLItemCount counts the items of an XML audit by the close tags of its first item's element, as itemList headers
+//don't say how many items they contain. Returns -1 if the file could not be read
+func XMLItemCount(options Options, path string) int {
+	file, err_o := options.MemoryPayloads.Open(path)
+	if err_o != nil {
+		return -1
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 1024*1024*1024)
+	rowCount := 0
+	closeTag := ""
+	count := 0
+	for scanner.Scan() {
+		rowCount++
+		line := strings.TrimSpace(scanner.Text())
+		if rowCount == 3 {
+			m := regXMLAuditItem.FindStringSubmatch(line)
+			if len(m) <= 1 {
+				return 0
+			}
+			closeTag = "</" + m[1] + ">"
+		}
+		if rowCount >= 3 && line == closeTag {
+			count++
+		}
+	}
+	if scanner.Err() != nil {
+		return -1
+	}
+	return count
+}
+
+//NonAuditXMLRoot returns the root element of an XML file which is not an audit, such as a tool export or report
+//Returns "" for audits ("<itemList>" or "<issueList>" roots), and for files whose root element could not be found,
+//such as truncated or corrupted audits, which are still reported as failures
+func NonAuditXMLRoot(options Options, path string) string {
+	file, err_o := options.MemoryPayloads.Open(path)
+	if err_o != nil {
+		return ""
+	}
+	defer file.Close()
+	head := make([]byte, 64*1024)
+	n, _ := io.ReadFull(file, head)
+	text := strings.TrimPrefix(string(head[:n]), "\uFEFF")
+	//Skip the declaration, comments, and the doctype before the root element
+	for {
+		text = strings.TrimLeft(text, " \t\r\n")
+		end := ""
+		if strings.HasPrefix(text, "<?") {
+			end = "?>"
+		} else if strings.HasPrefix(text, "<!--") {
+			end = "-->"
+		} else if strings.HasPrefix(text, "<!") {
+			end = ">"
+		} else {
+			break
+		}
+		i := strings.Index(text, end)
+		if i == -1 {
+			return ""
+		}
+		text = text[i+len(end):]
+	}
+	m := regexp.MustCompile(`^<([A-Za-z_][\w.:-]*)[\s/>]`).FindStringSubmatch(text)
+	if len(m) <= 1 {
+		return ""
+	}
+	root := strings.ToLower(m[1])
+	if root == "itemlist" || root == "issuelist" {
+		return ""
+	}
+	return m[1]
+}